@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// maxRecordLine 单条记录的最大字节数，超过的行视为损坏跳过
+const maxRecordLine = 1 << 20
+
+// ReadRecords 按写入顺序读取记录文件中 [from, to) 时间范围内的记录（零值表示不限制）
+// 损坏或超长的行跳过（包括写入器正在追加的末行），fn 返回 false 时停止读取；文件不存在时不返回错误
+func ReadRecords(path string, from, to time.Time, fn func(Record) bool) error {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("打开审计文件失败: %w", err)
+	}
+	defer f.Close()
+
+	reader := bufio.NewReaderSize(f, 64<<10)
+	var line []byte
+	skipping := false
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if errors.Is(err, bufio.ErrBufferFull) {
+			// 行尚未结束，继续累积；超过上限后丢弃到行尾
+			if !skipping {
+				line = append(line, chunk...)
+				if len(line) > maxRecordLine {
+					line, skipping = line[:0], true
+				}
+			}
+			continue
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("读取审计文件失败: %w", err)
+		}
+
+		if !skipping {
+			line = append(line, chunk...)
+			var rec Record
+			if len(bytes.TrimSpace(line)) > 0 && json.Unmarshal(line, &rec) == nil && inRange(rec.Time, from, to) && !fn(rec) {
+				return nil
+			}
+		}
+		line, skipping = line[:0], false
+		if err != nil {
+			return nil
+		}
+	}
+}
+
+// inRange 时间是否落在 [from, to) 内，零值边界表示不限制
+func inRange(t, from, to time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+}
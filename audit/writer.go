@@ -0,0 +1,382 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"kiro2api/logger"
+	"kiro2api/redact"
+)
+
+// 记录类型
+const (
+	KindRequest = "request" // /v1 请求统计
+	KindAdmin   = "admin"   // 管理操作审计
+)
+
+// Record 审计/统计记录（JSON Lines 格式落盘）
+type Record struct {
+	Time         time.Time      `json:"time"`
+	Kind         string         `json:"kind"`
+	RequestID    string         `json:"request_id,omitempty"`
+	Actor        string         `json:"actor,omitempty"`
+	ClientIP     string         `json:"client_ip,omitempty"`
+	Method       string         `json:"method,omitempty"`
+	Path         string         `json:"path,omitempty"`
+	Action       string         `json:"action,omitempty"`
+	Status       int            `json:"status,omitempty"`
+	LatencyMs    int64          `json:"latency_ms,omitempty"`
+	Model        string         `json:"model,omitempty"`
+	ClientKey    string         `json:"client_key,omitempty"` // 调用方密钥ID（request 记录）
+	Account      string         `json:"account,omitempty"`    // 处理请求的账号配置ID（request 记录）
+	InputTokens  int            `json:"input_tokens,omitempty"`
+	OutputTokens int            `json:"output_tokens,omitempty"`
+	Cost         float64        `json:"cost,omitempty"`       // 按价格表估算的请求费用（request 记录）
+	ErrorCode    string         `json:"error_code,omitempty"` // 失败请求的稳定错误码（request 记录）
+	Detail       map[string]any `json:"detail,omitempty"`
+}
+
+// Options 异步写入器配置
+type Options struct {
+	QueueSize     int              // 内存队列容量
+	MaxSpoolBytes int64            // 溢出文件最大字节数，超过后丢弃
+	ReplayEvery   time.Duration    // 队列空闲时回放溢出文件的间隔
+	Redactor      *redact.Redactor // 写入前脱敏 Detail 中的字符串，nil 时不脱敏
+}
+
+// DefaultOptions 默认配置
+func DefaultOptions() Options {
+	return Options{
+		QueueSize:     1024,
+		MaxSpoolBytes: 100 << 20,
+		ReplayEvery:   time.Second,
+	}
+}
+
+// Stats 写入器计数
+type Stats struct {
+	Queued      int   `json:"queued"`
+	Enqueued    int64 `json:"enqueued"`
+	Written     int64 `json:"written"`
+	Spilled     int64 `json:"spilled"`
+	Replayed    int64 `json:"replayed"`
+	Dropped     int64 `json:"dropped"`
+	WriteErrors int64 `json:"write_errors"`
+	SpoolBytes  int64 `json:"spool_bytes"`
+}
+
+// Writer 异步记录写入器
+// 请求路径只做非阻塞入队；内存队列满时转入溢出通道由后台追加到磁盘溢出文件，
+// 溢出通道也满或溢出文件超限时丢弃并计数，保证慢存储不会拖慢请求
+type Writer struct {
+	sinkPath  string
+	spoolPath string
+	opts      Options
+
+	queue chan []byte
+	spill chan []byte
+
+	spoolMu   sync.Mutex
+	spoolFile *os.File
+	spoolSize int64
+
+	enqueued    atomic.Int64
+	written     atomic.Int64
+	spilled     atomic.Int64
+	replayed    atomic.Int64
+	dropped     atomic.Int64
+	writeErrors atomic.Int64
+
+	closed    atomic.Bool
+	spillStop chan struct{}
+	spillDone chan struct{}
+	runStop   chan struct{}
+	runDone   chan struct{}
+}
+
+// NewWriter 创建写入器并启动后台协程，溢出文件位于 sinkPath + ".spool"
+func NewWriter(sinkPath string, opts Options) (*Writer, error) {
+	if sinkPath == "" {
+		return nil, fmt.Errorf("审计文件路径不能为空")
+	}
+	defaults := DefaultOptions()
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaults.QueueSize
+	}
+	if opts.MaxSpoolBytes <= 0 {
+		opts.MaxSpoolBytes = defaults.MaxSpoolBytes
+	}
+	if opts.ReplayEvery <= 0 {
+		opts.ReplayEvery = defaults.ReplayEvery
+	}
+
+	sink, err := os.OpenFile(sinkPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("打开审计文件失败: %w", err)
+	}
+
+	w := &Writer{
+		sinkPath:  sinkPath,
+		spoolPath: sinkPath + ".spool",
+		opts:      opts,
+		queue:     make(chan []byte, opts.QueueSize),
+		spill:     make(chan []byte, opts.QueueSize),
+		spillStop: make(chan struct{}),
+		spillDone: make(chan struct{}),
+		runStop:   make(chan struct{}),
+		runDone:   make(chan struct{}),
+	}
+	if info, err := os.Stat(w.spoolPath); err == nil {
+		w.spoolSize = info.Size()
+	}
+
+	go w.spillLoop()
+	go w.runLoop(sink)
+	return w, nil
+}
+
+// Write 非阻塞写入一条记录（nil 写入器为空操作）
+func (w *Writer) Write(rec Record) {
+	if w == nil || w.closed.Load() {
+		return
+	}
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	if rec.Detail != nil && w.opts.Redactor != nil {
+		rec.Detail = w.opts.Redactor.Value(rec.Detail).(map[string]any)
+	}
+	line, err := json.Marshal(rec)
+	if err != nil {
+		w.dropped.Add(1)
+		return
+	}
+	line = append(line, '\n')
+
+	select {
+	case w.queue <- line:
+		w.enqueued.Add(1)
+		return
+	default:
+	}
+
+	select {
+	case w.spill <- line:
+		w.spilled.Add(1)
+	default:
+		w.dropped.Add(1)
+	}
+}
+
+// Stats 返回当前计数（nil 写入器返回零值）
+func (w *Writer) Stats() Stats {
+	if w == nil {
+		return Stats{}
+	}
+	w.spoolMu.Lock()
+	spoolSize := w.spoolSize
+	w.spoolMu.Unlock()
+
+	return Stats{
+		Queued:      len(w.queue),
+		Enqueued:    w.enqueued.Load(),
+		Written:     w.written.Load(),
+		Spilled:     w.spilled.Load(),
+		Replayed:    w.replayed.Load(),
+		Dropped:     w.dropped.Load(),
+		WriteErrors: w.writeErrors.Load(),
+		SpoolBytes:  spoolSize,
+	}
+}
+
+// Path 记录文件路径（nil 写入器返回空）
+func (w *Writer) Path() string {
+	if w == nil {
+		return ""
+	}
+	return w.sinkPath
+}
+
+// Close 停止接收新记录，落盘剩余数据后返回
+func (w *Writer) Close() {
+	if w == nil || !w.closed.CompareAndSwap(false, true) {
+		return
+	}
+	close(w.spillStop)
+	<-w.spillDone
+	close(w.runStop)
+	<-w.runDone
+}
+
+// spillLoop 将溢出记录追加到磁盘溢出文件
+func (w *Writer) spillLoop() {
+	defer close(w.spillDone)
+	for {
+		select {
+		case line := <-w.spill:
+			w.appendSpool(line)
+		case <-w.spillStop:
+			for {
+				select {
+				case line := <-w.spill:
+					w.appendSpool(line)
+				default:
+					w.closeSpool()
+					return
+				}
+			}
+		}
+	}
+}
+
+// appendSpool 追加一条记录到溢出文件，超过容量上限时丢弃
+func (w *Writer) appendSpool(line []byte) {
+	w.spoolMu.Lock()
+	defer w.spoolMu.Unlock()
+
+	if w.spoolSize+int64(len(line)) > w.opts.MaxSpoolBytes {
+		w.dropped.Add(1)
+		return
+	}
+	if w.spoolFile == nil {
+		f, err := os.OpenFile(w.spoolPath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+		if err != nil {
+			w.writeErrors.Add(1)
+			w.dropped.Add(1)
+			return
+		}
+		w.spoolFile = f
+	}
+	if _, err := w.spoolFile.Write(line); err != nil {
+		w.writeErrors.Add(1)
+		w.dropped.Add(1)
+		return
+	}
+	w.spoolSize += int64(len(line))
+}
+
+// closeSpool 关闭溢出文件句柄
+func (w *Writer) closeSpool() {
+	w.spoolMu.Lock()
+	defer w.spoolMu.Unlock()
+	if w.spoolFile != nil {
+		_ = w.spoolFile.Close()
+		w.spoolFile = nil
+	}
+}
+
+// runLoop 从内存队列写入目标文件，空闲时回放溢出文件
+func (w *Writer) runLoop(sink *os.File) {
+	defer close(w.runDone)
+	defer sink.Close()
+
+	ticker := time.NewTicker(w.opts.ReplayEvery)
+	defer ticker.Stop()
+
+	// 启动时回放上次遗留的溢出数据
+	w.replaySpool(sink)
+
+	for {
+		select {
+		case line := <-w.queue:
+			w.writeSink(sink, line)
+		case <-ticker.C:
+			if len(w.queue) == 0 {
+				w.replaySpool(sink)
+			}
+		case <-w.runStop:
+			for {
+				select {
+				case line := <-w.queue:
+					w.writeSink(sink, line)
+				default:
+					w.replaySpool(sink)
+					return
+				}
+			}
+		}
+	}
+}
+
+// writeSink 写入目标文件，失败时转存到溢出文件等待重试
+func (w *Writer) writeSink(sink *os.File, line []byte) {
+	if _, err := sink.Write(line); err != nil {
+		w.writeErrors.Add(1)
+		w.appendSpool(line)
+		return
+	}
+	w.written.Add(1)
+}
+
+// replaySpool 将溢出文件内容追加到目标文件
+func (w *Writer) replaySpool(sink *os.File) {
+	replayPath := w.spoolPath + ".replay"
+
+	// 先处理上次中断遗留的回放文件，避免被覆盖
+	if !w.replayFile(sink, replayPath) {
+		return
+	}
+
+	w.spoolMu.Lock()
+	if w.spoolFile != nil {
+		_ = w.spoolFile.Close()
+		w.spoolFile = nil
+	}
+	err := os.Rename(w.spoolPath, replayPath)
+	if err == nil {
+		w.spoolSize = 0
+	}
+	w.spoolMu.Unlock()
+
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			w.writeErrors.Add(1)
+			logger.Warn("回放审计溢出文件失败", logger.Err(err))
+		}
+		return
+	}
+	w.replayFile(sink, replayPath)
+}
+
+// replayFile 逐行回放文件并在成功后删除，文件不存在时视为成功
+func (w *Writer) replayFile(sink *os.File, path string) bool {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return true
+	}
+	if err != nil {
+		w.writeErrors.Add(1)
+		return false
+	}
+	defer f.Close()
+
+	out := bufio.NewWriter(sink)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20)
+	var count int64
+	for scanner.Scan() {
+		if _, err := out.Write(append(scanner.Bytes(), '\n')); err != nil {
+			break
+		}
+		count++
+	}
+	if err := scanner.Err(); err != nil {
+		w.writeErrors.Add(1)
+		return false
+	}
+	if err := out.Flush(); err != nil {
+		w.writeErrors.Add(1)
+		return false
+	}
+
+	_ = os.Remove(path)
+	w.replayed.Add(count)
+	w.written.Add(count)
+	return true
+}
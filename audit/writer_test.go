@@ -0,0 +1,152 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kiro2api/redact"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readRecords(t *testing.T, path string) []Record {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var rec Record
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestWriter_WritesRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	w, err := NewWriter(path, Options{ReplayEvery: 10 * time.Millisecond})
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		w.Write(Record{Kind: KindRequest, Status: 200 + i})
+	}
+	w.Close()
+
+	records := readRecords(t, path)
+	require.Len(t, records, 10)
+	assert.False(t, records[0].Time.IsZero())
+
+	stats := w.Stats()
+	assert.Equal(t, int64(10), stats.Written)
+	assert.Equal(t, int64(0), stats.Dropped)
+
+	// 关闭后写入被忽略
+	w.Write(Record{Kind: KindRequest})
+	assert.Equal(t, int64(10), w.Stats().Enqueued+w.Stats().Spilled)
+}
+
+func TestWriter_OverflowSpillsAndReplays(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	w, err := NewWriter(path, Options{QueueSize: 1, ReplayEvery: 10 * time.Millisecond})
+	require.NoError(t, err)
+
+	for i := 0; i < 200; i++ {
+		w.Write(Record{Kind: KindAdmin, Status: i})
+	}
+	w.Close()
+
+	stats := w.Stats()
+	assert.Equal(t, int64(200), stats.Enqueued+stats.Spilled+stats.Dropped)
+	assert.Equal(t, int64(200), stats.Written+stats.Dropped, "每条记录要么落盘要么计入丢弃")
+	assert.Len(t, readRecords(t, path), int(stats.Written))
+	assert.Equal(t, int64(0), stats.SpoolBytes)
+
+	_, err = os.Stat(path + ".spool")
+	assert.True(t, os.IsNotExist(err), "回放后溢出文件应被删除")
+}
+
+func TestWriter_ReplaysLeftoverSpool(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.jsonl")
+	line, err := json.Marshal(Record{Kind: KindAdmin, Action: "leftover"})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path+".spool", append(line, '\n'), 0o600))
+
+	w, err := NewWriter(path, Options{})
+	require.NoError(t, err)
+	w.Close()
+
+	records := readRecords(t, path)
+	require.Len(t, records, 1)
+	assert.Equal(t, "leftover", records[0].Action)
+	assert.Equal(t, int64(1), w.Stats().Replayed)
+}
+
+func TestWriter_SpoolLimitDrops(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	w := &Writer{spoolPath: path + ".spool", opts: Options{MaxSpoolBytes: 10}}
+
+	w.appendSpool([]byte("0123456789abcdef\n"))
+	w.closeSpool()
+	assert.Equal(t, int64(1), w.Stats().Dropped)
+	assert.Equal(t, int64(0), w.Stats().SpoolBytes)
+}
+
+func TestWriter_NilSafe(t *testing.T) {
+	var w *Writer
+	w.Write(Record{Kind: KindRequest})
+	w.Close()
+	assert.Equal(t, Stats{}, w.Stats())
+}
+
+func TestWriter_RedactsDetail(t *testing.T) {
+	r, err := redact.New([]redact.Rule{{Builtin: redact.BuiltinEmail}})
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	w, err := NewWriter(path, Options{ReplayEvery: 10 * time.Millisecond, Redactor: r})
+	require.NoError(t, err)
+
+	w.Write(Record{Kind: KindAdmin, Detail: map[string]any{"reason": "invited frank@example.com"}})
+	w.Close()
+
+	records := readRecords(t, path)
+	require.Len(t, records, 1)
+	assert.Equal(t, "invited [REDACTED_EMAIL]", records[0].Detail["reason"])
+}
+
+func TestReadRecords_FiltersAndSkipsCorruptLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	day := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	var buf []byte
+	for i, ts := range []time.Time{day.Add(-time.Hour), day.Add(time.Hour), day.Add(25 * time.Hour)} {
+		line, err := json.Marshal(Record{Time: ts, Kind: KindRequest, Status: 200 + i})
+		require.NoError(t, err)
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+		buf = append(buf, "not json\n"...)
+	}
+	buf = append(buf, `{"time":"2026-10-01T02:00:00Z","kind":"req`...) // 正在追加的末行
+	require.NoError(t, os.WriteFile(path, buf, 0o600))
+
+	var got []Record
+	require.NoError(t, ReadRecords(path, day, day.Add(24*time.Hour), func(rec Record) bool {
+		got = append(got, rec)
+		return true
+	}))
+	require.Len(t, got, 1)
+	assert.Equal(t, 201, got[0].Status)
+
+	assert.NoError(t, ReadRecords(filepath.Join(t.TempDir(), "missing.jsonl"), time.Time{}, time.Time{}, func(Record) bool {
+		t.Fatal("文件不存在时不应有记录")
+		return false
+	}))
+}
@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"kiro2api/config"
+	"kiro2api/types"
+)
+
+// 账号在轮换中的状态
+const (
+	AccountStatusActive    = "active"    // 已缓存可用token
+	AccountStatusExhausted = "exhausted" // 额度耗尽或被上游拒绝，暂时退出轮换
+	AccountStatusPending   = "pending"   // 尚未刷新（懒加载或刷新失败）
+	AccountStatusDisabled  = "disabled"  // 已禁用
+)
+
+// AccountSummary 账号的脱敏摘要，只读取内存中的配置与token缓存，不访问上游
+// 密钥字段仅保留首尾各4位，可安全返回给管理界面
+type AccountSummary struct {
+	Index        int                `json:"index"`
+	ID           string             `json:"id"`
+	AuthType     string             `json:"auth"`
+	RefreshToken string             `json:"refreshToken"`
+	ClientID     string             `json:"clientId,omitempty"`
+	Label        string             `json:"label,omitempty"`
+	Tags         []string           `json:"tags,omitempty"`
+	Note         string             `json:"note,omitempty"`
+	Models       []string           `json:"models,omitempty"`
+	Disabled     bool               `json:"disabled"`
+	Status       string             `json:"status"`
+	CachedAt     time.Time          `json:"cached_at,omitzero"`
+	ExpiresAt    time.Time          `json:"expires_at,omitzero"`
+	LastUsed     time.Time          `json:"last_used,omitzero"`
+	Available    float64            `json:"available"`
+	Usage        *types.UsageLimits `json:"-"` // 最近一次查询到的使用限制，未查询过时为nil
+}
+
+// Accounts 返回所有账号的脱敏摘要（按配置顺序）
+func (as *AuthService) Accounts() []AccountSummary {
+	tm := as.GetTokenManager()
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+
+	accounts := make([]AccountSummary, 0, len(tm.configs))
+	for i, cfg := range tm.configs {
+		account := AccountSummary{
+			Index:        i,
+			ID:           cfg.ID,
+			AuthType:     cfg.AuthType,
+			RefreshToken: MaskSecret(cfg.RefreshToken),
+			ClientID:     cfg.ClientID,
+			Label:        cfg.Label,
+			Tags:         slices.Clone(cfg.Tags),
+			Note:         cfg.Note,
+			Models:       slices.Clone(cfg.Models),
+			Disabled:     cfg.Disabled,
+			Status:       AccountStatusPending,
+		}
+
+		cacheKey := fmt.Sprintf(config.TokenCacheKeyFormat, i)
+		cached, ok := tm.cache.tokens[cacheKey]
+		if ok {
+			account.CachedAt = cached.CachedAt
+			account.ExpiresAt = cached.Token.ExpiresAt
+			account.LastUsed = cached.LastUsed
+			account.Available = cached.Available
+			account.Usage = cached.UsageInfo
+		}
+		switch {
+		case cfg.Disabled:
+			account.Status = AccountStatusDisabled
+		case tm.exhausted[cacheKey] || (ok && cached.Available <= 0):
+			account.Status = AccountStatusExhausted
+		case ok:
+			account.Status = AccountStatusActive
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts
+}
@@ -4,84 +4,351 @@ import (
 	"fmt"
 	"kiro2api/logger"
 	"kiro2api/types"
+	"kiro2api/utils"
+	"strings"
+	"sync"
+	"time"
 )
 
-// AuthService 认证服务（推荐使用依赖注入方式）
+// AuthService 认证服务（推荐使用依赖注入方式），可被请求处理与管理API并发调用
+//   - updateMu 串行化所有配置变更（含持久化），变更按提交顺序生效；持久化期间不阻塞读取
+//   - mu 保护 configs 与 tokenManager，二者只在变更提交时一起替换，写锁仅短暂持有
+//   - configs 写时复制，内部切片一经发布不再修改；GetConfigs/GetConfigByID 返回深拷贝
 type AuthService struct {
-	tokenManager   *TokenManager
-	configs        []AuthConfig
-	configFilePath string // 配置文件路径，用于持久化
+	mu           sync.RWMutex
+	updateMu     sync.Mutex // 串行化配置变更
+	tokenManager *TokenManager
+	configs      []AuthConfig
+	source       ConfigSource // 配置存储，用于持久化
+	readOnly     bool         // 只读副本：拒绝配置变更
+}
+
+// ConfigPatch 配置的部分更新，nil 字段保持不变
+type ConfigPatch struct {
+	Disabled *bool     `json:"disabled,omitempty"`
+	Label    *string   `json:"label,omitempty"`
+	Tags     *[]string `json:"tags,omitempty"`
+	Note     *string   `json:"note,omitempty"`
+	Models   *[]string `json:"models,omitempty"`
+	// MaxConcurrent 同时进行的上游请求数上限，0 表示不限制
+	MaxConcurrent *int `json:"maxConcurrent,omitempty"`
 }
 
 // NewAuthService 创建新的认证服务（推荐使用此方法而不是全局函数）
 func NewAuthService() (*AuthService, error) {
 	logger.Info("创建AuthService实例")
 
-	// 加载配置（同时获取配置文件路径用于后续持久化）
-	configs, configFilePath, err := loadConfigsWithPath()
+	// 加载配置（同时获取配置存储用于后续持久化）
+	configs, source, err := loadConfigSource()
 	if err != nil {
 		return nil, fmt.Errorf("加载配置失败: %w", err)
 	}
 
+	as := NewAuthServiceWithSource(configs, source)
+
 	// 允许空配置启动
 	if len(configs) == 0 {
 		logger.Info("AuthService以空Token池启动，可通过API添加账号")
-		return &AuthService{
-			tokenManager:   NewTokenManager(configs),
-			configs:        configs,
-			configFilePath: configFilePath,
-		}, nil
+		return as, nil
 	}
 
-	// 创建token管理器
-	tokenManager := NewTokenManager(configs)
-
-	// 预热第一个可用token
-	_, warmupErr := tokenManager.getBestToken()
-	if warmupErr != nil {
+	// 预热第一个可用token；LAZY_WARMUP 时跳过，首次请求时按账号刷新，缩短冷启动时间
+	if as.tokenManager.Lazy() {
+		logger.Info("已启用LAZY_WARMUP，跳过token预热")
+	} else if _, warmupErr := as.tokenManager.getBestToken(); warmupErr != nil {
 		logger.Warn("token预热失败", logger.Err(warmupErr))
 	}
 
 	logger.Info("AuthService创建完成", logger.Int("config_count", len(configs)))
 
-	return &AuthService{
-		tokenManager:   tokenManager,
-		configs:        configs,
-		configFilePath: configFilePath,
-	}, nil
+	return as, nil
+}
+
+// NewAuthServiceWithConfigs 使用给定配置创建认证服务（不读取环境变量，不预热token）
+// 主要用于测试与离线工具
+func NewAuthServiceWithConfigs(configs []AuthConfig, configFilePath string) *AuthService {
+	return NewAuthServiceWithSource(configs, NewFileConfigSource(configFilePath))
+}
+
+// NewAuthServiceWithSource 使用给定配置与配置存储创建认证服务（不预热token）
+func NewAuthServiceWithSource(configs []AuthConfig, source ConfigSource) *AuthService {
+	as := &AuthService{
+		configs: configs,
+		source:  source,
+	}
+	as.tokenManager = as.newTokenManager(configs)
+	return as
+}
+
+// newTokenManager 创建token管理器，刷新时上游轮换的refresh token写回本服务的配置
+func (as *AuthService) newTokenManager(configs []AuthConfig) *TokenManager {
+	tm := NewTokenManager(configs)
+	tm.onRefreshTokenRotated = func(cfg AuthConfig, token types.TokenInfo) {
+		if err := as.SaveRotatedRefreshToken(cfg, token); err != nil {
+			logger.Error("保存轮换后的refresh token失败",
+				logger.String("id", cfg.ID),
+				logger.Err(err))
+		}
+	}
+	return tm
+}
+
+// NewOfflineAuthService 按与服务相同的规则加载配置，但不预热token、不发起网络请求
+// 供命令行工具直接管理配置存储
+func NewOfflineAuthService() (*AuthService, error) {
+	configs, source, err := loadConfigSource()
+	if err != nil {
+		return nil, fmt.Errorf("加载配置失败: %w", err)
+	}
+	return NewAuthServiceWithSource(configs, source), nil
+}
+
+// ConfigFilePath 返回配置持久化的文件路径，配置存储不是文件时返回空
+func (as *AuthService) ConfigFilePath() string {
+	if file, ok := as.source.(*FileConfigSource); ok {
+		return file.Path
+	}
+	return ""
+}
+
+// ConfigSource 返回配置存储
+func (as *AuthService) ConfigSource() ConfigSource {
+	return as.source
 }
 
 // GetToken 获取可用的token
 func (as *AuthService) GetToken() (types.TokenInfo, error) {
-	if as.tokenManager == nil {
+	tm := as.GetTokenManager()
+	if tm == nil {
 		return types.TokenInfo{}, fmt.Errorf("token管理器未初始化")
 	}
-	return as.tokenManager.getBestToken()
+	return tm.getBestToken()
 }
 
 // GetTokenWithUsage 获取可用的token（包含使用信息）
 func (as *AuthService) GetTokenWithUsage() (*types.TokenWithUsage, error) {
-	if as.tokenManager == nil {
+	tm := as.GetTokenManager()
+	if tm == nil {
+		return nil, fmt.Errorf("token管理器未初始化")
+	}
+	return tm.GetBestTokenWithUsage()
+}
+
+// GetTokenForModel 获取支持指定模型的可用token（model为空表示不限模型）
+func (as *AuthService) GetTokenForModel(model string) (types.TokenInfo, error) {
+	tm := as.GetTokenManager()
+	if tm == nil {
+		return types.TokenInfo{}, fmt.Errorf("token管理器未初始化")
+	}
+	return tm.getBestTokenForModel(model)
+}
+
+// GetTokenWithUsageForModel 获取支持指定模型的可用token（包含使用信息）
+func (as *AuthService) GetTokenWithUsageForModel(model string) (*types.TokenWithUsage, error) {
+	tm := as.GetTokenManager()
+	if tm == nil {
+		return nil, fmt.Errorf("token管理器未初始化")
+	}
+	return tm.GetBestTokenWithUsageForModel(model)
+}
+
+// GetTokenForModelPreferring 获取支持指定模型的可用token，优先使用 preferID 对应的账号（会话粘性路由）
+// 该账号不可用（不支持该模型、额度耗尽、熔断中）时与 GetTokenForModel 相同
+func (as *AuthService) GetTokenForModelPreferring(model, preferID string) (types.TokenInfo, error) {
+	tm := as.GetTokenManager()
+	if tm == nil {
+		return types.TokenInfo{}, fmt.Errorf("token管理器未初始化")
+	}
+	return tm.getBestTokenPreferring(model, preferID)
+}
+
+// GetTokenWithUsageForModelPreferring 同 GetTokenForModelPreferring，包含使用信息
+func (as *AuthService) GetTokenWithUsageForModelPreferring(model, preferID string) (*types.TokenWithUsage, error) {
+	tm := as.GetTokenManager()
+	if tm == nil {
 		return nil, fmt.Errorf("token管理器未初始化")
 	}
-	return as.tokenManager.GetBestTokenWithUsage()
+	return tm.GetBestTokenWithUsagePreferring(model, preferID)
+}
+
+// GetTokenForTags 同 GetTokenForModelPreferring，只选择带有任一 tags 标签的账号（多租户隔离，tags 为空表示不限）
+func (as *AuthService) GetTokenForTags(model, preferID string, tags []string) (types.TokenInfo, error) {
+	tm := as.GetTokenManager()
+	if tm == nil {
+		return types.TokenInfo{}, fmt.Errorf("token管理器未初始化")
+	}
+	return tm.getBestTokenForTags(model, preferID, tags)
+}
+
+// GetTokenWithUsageForTags 同 GetTokenForTags，包含使用信息
+func (as *AuthService) GetTokenWithUsageForTags(model, preferID string, tags []string) (*types.TokenWithUsage, error) {
+	tm := as.GetTokenManager()
+	if tm == nil {
+		return nil, fmt.Errorf("token管理器未初始化")
+	}
+	return tm.GetBestTokenWithUsageForTags(model, preferID, tags)
+}
+
+// PeekTokenForTags 返回 GetTokenForTags 此刻会选择的token，不影响账号选择状态（用于转换预览）
+func (as *AuthService) PeekTokenForTags(model, preferID string, tags []string) (types.TokenInfo, error) {
+	tm := as.GetTokenManager()
+	if tm == nil {
+		return types.TokenInfo{}, fmt.Errorf("token管理器未初始化")
+	}
+	return tm.PeekTokenForTags(model, preferID, tags)
 }
 
 // GetTokenManager 获取底层的TokenManager（用于高级操作）
 func (as *AuthService) GetTokenManager() *TokenManager {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
 	return as.tokenManager
 }
 
-// GetConfigs 获取认证配置
+// GetConfigs 获取认证配置的快照（深拷贝，调用方可以自由修改）
 func (as *AuthService) GetConfigs() []AuthConfig {
-	return as.configs
+	configs, _ := as.snapshot()
+	return cloneConfigs(configs)
+}
+
+// GetConfigByID 按ID获取认证配置（深拷贝）
+func (as *AuthService) GetConfigByID(id string) (AuthConfig, bool) {
+	configs, _ := as.snapshot()
+	index := indexOfConfig(configs, id)
+	if index < 0 {
+		return AuthConfig{}, false
+	}
+	return configs[index].clone(), true
+}
+
+// snapshot 返回当前的配置与TokenManager（二者总是一起替换，保证相互对应）
+// 返回的切片与服务内部共享，只读；需要返回给外部时使用 cloneConfigs
+func (as *AuthService) snapshot() ([]AuthConfig, *TokenManager) {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	return as.configs, as.tokenManager
+}
+
+// commit 替换配置与TokenManager（调用时需持有 updateMu）
+// 写锁只在替换时短暂持有，持久化等耗时操作在此之前完成，不阻塞取token的请求
+func (as *AuthService) commit(configs []AuthConfig, tm *TokenManager) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.configs = configs
+	as.tokenManager = tm
 }
 
-// AddConfig 动态添加认证配置
+// indexOfConfig 查找配置索引，不存在返回-1
+func indexOfConfig(configs []AuthConfig, id string) int {
+	if id == "" {
+		return -1
+	}
+	for i, cfg := range configs {
+		if cfg.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// findConfigByRefreshToken 按refreshToken哈希查找已有配置，返回其ID
+func findConfigByRefreshToken(configs []AuthConfig, refreshToken string) (string, bool) {
+	hash := refreshTokenHash(refreshToken)
+	for _, cfg := range configs {
+		if refreshTokenHash(cfg.RefreshToken) == hash {
+			return cfg.ID, true
+		}
+	}
+	return "", false
+}
+
+// AddConfig 动态添加认证配置，refreshToken与已有账号重复时返回 *DuplicateConfigError
 func (as *AuthService) AddConfig(config AuthConfig) error {
 	// 验证配置
+	config, err := normalizeConfig(config)
+	if err != nil {
+		return err
+	}
+	_, err = as.addConfig(config, nil)
+	return err
+}
+
+// AddValidatedConfig 先向上游刷新token验证账号，验证通过后再添加，返回添加后的配置与刷新得到的token
+// 上游轮换了refresh token时保存轮换后的值；刷新失败时返回 ErrConfigValidation，不修改配置
+func (as *AuthService) AddValidatedConfig(config AuthConfig) (AuthConfig, *CachedToken, error) {
+	config, err := normalizeConfig(config)
+	if err != nil {
+		return AuthConfig{}, nil, err
+	}
+	current, tm := as.snapshot()
+	if existingID, dup := findConfigByRefreshToken(current, config.RefreshToken); dup {
+		return AuthConfig{}, nil, &DuplicateConfigError{ExistingID: existingID}
+	}
+
+	cached, err := fetchCachedTokenFunc(tm, config)
+	if err != nil {
+		return AuthConfig{}, nil, fmt.Errorf("%w: %v", ErrConfigValidation, err)
+	}
+	if refreshTokenRotated(config, cached.Token) {
+		config.RefreshToken = cached.Token.RefreshToken
+	}
+
+	added, err := as.addConfig(config, cached)
+	if err != nil {
+		return AuthConfig{}, nil, err
+	}
+	return added, cached, nil
+}
+
+// addConfig 添加已校验的配置，cached 非nil时直接作为新账号的token缓存（调用方已刷新过）
+func (as *AuthService) addConfig(config AuthConfig, cached *CachedToken) (AuthConfig, error) {
+	as.updateMu.Lock()
+	defer as.updateMu.Unlock()
+
+	if as.ReadOnly() {
+		return AuthConfig{}, ErrReadOnly
+	}
+	current, tm := as.snapshot()
+
+	// 同一个refreshToken只保留一个账号，避免重复账号扭曲轮换
+	if existingID, dup := findConfigByRefreshToken(current, config.RefreshToken); dup {
+		return AuthConfig{}, &DuplicateConfigError{ExistingID: existingID}
+	}
+
+	// ID冲突时重新分配
+	if indexOfConfig(current, config.ID) >= 0 {
+		config.ID = utils.GenerateUUID()
+	}
+
+	// 添加到配置列表（写时复制）
+	configs := make([]AuthConfig, 0, len(current)+1)
+	configs = append(configs, current...)
+	configs = append(configs, config)
+
+	// 持久化到配置存储（失败时不修改内存状态）
+	if err := as.source.Save(configs); err != nil {
+		return AuthConfig{}, fmt.Errorf("持久化配置失败: %w", err)
+	}
+	as.commit(configs, tm)
+
+	// 更新TokenManager（刷新新账号的token在TokenManager锁外进行）
+	if cached != nil {
+		cached.Token.ConfigID = config.ID
+	}
+	tm.addConfig(config, cached)
+
+	logger.Info("动态添加认证配置",
+		logger.String("auth_type", config.AuthType),
+		logger.Int("total_configs", len(configs)),
+		logger.String("config_source", as.source.Location()))
+
+	return config.clone(), nil
+}
+
+// normalizeConfig 校验配置并补全默认值
+func normalizeConfig(config AuthConfig) (AuthConfig, error) {
 	if config.RefreshToken == "" {
-		return fmt.Errorf("refreshToken不能为空")
+		return config, fmt.Errorf("refreshToken不能为空")
 	}
 
 	// 设置默认认证类型
@@ -92,68 +359,217 @@ func (as *AuthService) AddConfig(config AuthConfig) error {
 	// 验证IdC认证的必要字段
 	if config.AuthType == AuthMethodIdC {
 		if config.ClientID == "" || config.ClientSecret == "" {
-			return fmt.Errorf("IdC认证需要clientId和clientSecret")
+			return config, fmt.Errorf("IdC认证需要clientId和clientSecret")
 		}
 	}
 
-	// 添加到配置列表
-	as.configs = append(as.configs, config)
-
-	// 持久化到文件（失败时回滚）
-	if err := SaveConfigsToFile(as.configFilePath, as.configs); err != nil {
-		as.configs = as.configs[:len(as.configs)-1] // 回滚
-		return fmt.Errorf("持久化配置失败: %w", err)
+	if config.ID == "" {
+		config.ID = utils.GenerateUUID()
 	}
+	config.Label = strings.TrimSpace(config.Label)
+	config.Note = strings.TrimSpace(config.Note)
+	config.Tags = NormalizeTags(config.Tags)
+	config.Models = NormalizeTags(config.Models)
 
-	// 更新TokenManager
-	as.tokenManager.AddConfig(config)
-
-	logger.Info("动态添加认证配置",
-		logger.String("auth_type", config.AuthType),
-		logger.Int("total_configs", len(as.configs)),
-		logger.String("config_file", as.configFilePath))
+	config.ProxyURL = strings.TrimSpace(config.ProxyURL)
+	if config.ProxyURL != "" {
+		if _, err := utils.ParseProxyURL(config.ProxyURL); err != nil {
+			return config, err
+		}
+	}
+	if config.MaxConcurrent < 0 {
+		return config, fmt.Errorf("maxConcurrent不能为负数")
+	}
 
-	return nil
+	return config, nil
 }
 
 // RemoveConfig 动态移除认证配置（通过索引）
 func (as *AuthService) RemoveConfig(index int) error {
-	if index < 0 || index >= len(as.configs) {
-		return fmt.Errorf("无效的配置索引: %d", index)
+	as.updateMu.Lock()
+	defer as.updateMu.Unlock()
+	return as.removeConfigAt(index)
+}
+
+// RemoveConfigByID 动态移除认证配置（通过稳定ID）
+func (as *AuthService) RemoveConfigByID(id string) error {
+	as.updateMu.Lock()
+	defer as.updateMu.Unlock()
+
+	configs, _ := as.snapshot()
+	index := indexOfConfig(configs, id)
+	if index < 0 {
+		return fmt.Errorf("%w: %s", ErrConfigNotFound, id)
 	}
+	return as.removeConfigAt(index)
+}
 
-	// 保存原始状态用于回滚
-	previousConfigs := make([]AuthConfig, len(as.configs))
-	copy(previousConfigs, as.configs)
-	previousManager := as.tokenManager
+// removeConfigAt 移除指定索引的配置并重建TokenManager（调用时需持有 updateMu）
+func (as *AuthService) removeConfigAt(index int) error {
+	if as.ReadOnly() {
+		return ErrReadOnly
+	}
+	current, _ := as.snapshot()
+	if index < 0 || index >= len(current) {
+		return fmt.Errorf("无效的配置索引: %d", index)
+	}
 
-	// 从配置列表中移除
-	as.configs = append(as.configs[:index], as.configs[index+1:]...)
+	// 写时复制，避免修改仍被读取方持有的切片
+	configs := make([]AuthConfig, 0, len(current)-1)
+	configs = append(configs, current[:index]...)
+	configs = append(configs, current[index+1:]...)
 
-	// 持久化到文件（失败时回滚）
-	if err := SaveConfigsToFile(as.configFilePath, as.configs); err != nil {
-		as.configs = previousConfigs
-		as.tokenManager = previousManager
+	// 持久化到配置存储（失败时不修改内存状态）
+	if err := as.source.Save(configs); err != nil {
 		return fmt.Errorf("持久化配置失败: %w", err)
 	}
 
-	// 重建TokenManager
-	as.tokenManager = NewTokenManager(as.configs)
+	// 重建TokenManager，与配置一起替换
+	as.commit(configs, as.newTokenManager(configs))
 
 	logger.Info("移除认证配置",
 		logger.Int("removed_index", index),
-		logger.Int("remaining_configs", len(as.configs)),
-		logger.String("config_file", as.configFilePath))
+		logger.String("removed_id", current[index].ID),
+		logger.Int("remaining_configs", len(configs)),
+		logger.String("config_source", as.source.Location()))
 
 	return nil
 }
 
+// UpdateConfig 部分更新配置（启用/禁用、显示名称、标签、备注）
+// 运行时状态通过 TokenManager.UpdateConfig 原地生效，不重建TokenManager，其他token的缓存保持不变
+func (as *AuthService) UpdateConfig(id string, patch ConfigPatch) (AuthConfig, error) {
+	as.updateMu.Lock()
+	defer as.updateMu.Unlock()
+
+	if as.ReadOnly() {
+		return AuthConfig{}, ErrReadOnly
+	}
+	current, tm := as.snapshot()
+
+	index := indexOfConfig(current, id)
+	if index < 0 {
+		return AuthConfig{}, fmt.Errorf("%w: %s", ErrConfigNotFound, id)
+	}
+
+	updated := current[index].clone()
+	if patch.Disabled != nil {
+		updated.Disabled = *patch.Disabled
+	}
+	if patch.Label != nil {
+		updated.Label = strings.TrimSpace(*patch.Label)
+	}
+	if patch.Note != nil {
+		updated.Note = strings.TrimSpace(*patch.Note)
+	}
+	if patch.Tags != nil {
+		updated.Tags = NormalizeTags(*patch.Tags)
+	}
+	if patch.Models != nil {
+		updated.Models = NormalizeTags(*patch.Models)
+	}
+	if patch.MaxConcurrent != nil {
+		if *patch.MaxConcurrent < 0 {
+			return AuthConfig{}, fmt.Errorf("maxConcurrent不能为负数")
+		}
+		updated.MaxConcurrent = *patch.MaxConcurrent
+	}
+
+	configs := make([]AuthConfig, len(current))
+	copy(configs, current)
+	configs[index] = updated
+
+	if err := as.source.Save(configs); err != nil {
+		return AuthConfig{}, fmt.Errorf("持久化配置失败: %w", err)
+	}
+	as.commit(configs, tm)
+
+	// 重新启用时需要刷新token，在 as.mu 之外进行，避免阻塞取token
+	if err := tm.UpdateConfig(index, updated); err != nil {
+		return AuthConfig{}, err
+	}
+
+	logger.Info("更新认证配置",
+		logger.String("id", id),
+		logger.Bool("disabled", updated.Disabled),
+		logger.String("config_source", as.source.Location()))
+
+	return updated.clone(), nil
+}
+
+// SaveRotatedRefreshToken 刷新结果携带了新的refresh token时，更新账号配置并立即持久化
+// 上游轮换后旧的refresh token随即失效，不保存会导致账号在下次刷新（或重启）后失效
+// 持久化失败时仍更新内存中的配置，保证本进程继续可用，并返回错误
+// 账号已删除，或配置中的refresh token已不是刷新时使用的值（更新的轮换已保存）时不做处理
+func (as *AuthService) SaveRotatedRefreshToken(cfg AuthConfig, token types.TokenInfo) error {
+	if !refreshTokenRotated(cfg, token) {
+		return nil
+	}
+
+	as.updateMu.Lock()
+	defer as.updateMu.Unlock()
+
+	current, tm := as.snapshot()
+	index := indexOfConfig(current, cfg.ID)
+	if index < 0 || current[index].RefreshToken != cfg.RefreshToken {
+		return nil
+	}
+
+	updated := current[index]
+	updated.RefreshToken = token.RefreshToken
+	configs := make([]AuthConfig, len(current))
+	copy(configs, current)
+	configs[index] = updated
+	as.commit(configs, tm)
+	if err := tm.UpdateConfig(index, updated); err != nil {
+		return err
+	}
+
+	if !as.ReadOnly() {
+		if err := as.source.Save(configs); err != nil {
+			return fmt.Errorf("持久化配置失败: %w", err)
+		}
+	}
+
+	logger.Info("上游轮换了refresh token，已更新认证配置",
+		logger.String("id", cfg.ID),
+		logger.String("config_source", as.source.Location()))
+	return nil
+}
+
+// ReportTokenFailure 上报token的账号级上游错误（401/403/429），使其退出轮换
+func (as *AuthService) ReportTokenFailure(configID string, status int) {
+	tm := as.GetTokenManager()
+	if tm == nil {
+		return
+	}
+	tm.ReportFailure(configID, status)
+}
+
+// InvalidateTokenCache 使token缓存失效，下次获取token时重新刷新
+// 用于检测到系统时钟跳变后重新评估token有效期
+func (as *AuthService) InvalidateTokenCache() {
+	tm := as.GetTokenManager()
+	if tm == nil {
+		return
+	}
+	tm.mutex.Lock()
+	tm.lastRefresh = time.Time{}
+	if tm.lazy {
+		// 懒加载模式不做整体刷新，清空缓存使各账号在下次选中时重新刷新
+		tm.cache.tokens = make(map[string]*CachedToken)
+		tm.lazyFailures = make(map[string]time.Time)
+	}
+	tm.mutex.Unlock()
+}
+
 // GetConfigCount 获取配置数量
 func (as *AuthService) GetConfigCount() int {
-	return len(as.configs)
+	configs, _ := as.snapshot()
+	return len(configs)
 }
 
 // HasAvailableToken 检查是否有可用的Token
 func (as *AuthService) HasAvailableToken() bool {
-	return len(as.configs) > 0
+	return as.GetConfigCount() > 0
 }
@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"kiro2api/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubFetchCachedToken 替换按需刷新入口，避免测试访问上游
+func stubFetchCachedToken(t *testing.T) {
+	original := fetchCachedTokenFunc
+	fetchCachedTokenFunc = func(_ *TokenManager, cfg AuthConfig) (*CachedToken, error) {
+		return &CachedToken{
+			Token:     types.TokenInfo{AccessToken: cfg.ID, ConfigID: cfg.ID, ExpiresAt: time.Now().Add(time.Hour)},
+			CachedAt:  time.Now(),
+			Available: 100,
+		}, nil
+	}
+	t.Cleanup(func() { fetchCachedTokenFunc = original })
+}
+
+// TestAuthService_ConcurrentConfigChanges 管理API变更配置的同时请求路径取token与读取配置（配合 go test -race）
+func TestAuthService_ConcurrentConfigChanges(t *testing.T) {
+	t.Setenv("LAZY_WARMUP", "true")
+	stubFetchCachedToken(t)
+	as := NewAuthServiceWithConfigs([]AuthConfig{
+		{ID: "base", AuthType: AuthMethodSocial, RefreshToken: "base", Tags: []string{"primary"}},
+	}, filepath.Join(t.TempDir(), "auth_config.json"))
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				_, _ = as.GetTokenForModel("")
+				// 调用方修改拿到的快照不影响服务状态
+				configs := as.GetConfigs()
+				for j := range configs {
+					configs[j].Label = "mutated"
+					if len(configs[j].Tags) > 0 {
+						configs[j].Tags[0] = "mutated"
+					}
+				}
+				if cfg, ok := as.GetConfigByID("base"); ok {
+					cfg.Tags[0] = "mutated"
+				}
+				_ = as.Export(true)
+				_ = as.GetConfigCount()
+			}
+		}()
+	}
+
+	label := "label"
+	for i := 0; i < 20; i++ {
+		id := fmt.Sprintf("acct-%d", i)
+		require.NoError(t, as.AddConfig(AuthConfig{ID: id, RefreshToken: "rt-" + id}))
+		_, err := as.UpdateConfig("base", ConfigPatch{Label: &label})
+		require.NoError(t, err)
+		if i%2 == 0 {
+			require.NoError(t, as.RemoveConfigByID(id))
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	assert.Equal(t, 11, as.GetConfigCount())
+	base, ok := as.GetConfigByID("base")
+	require.True(t, ok)
+	assert.Equal(t, "label", base.Label)
+	assert.Equal(t, []string{"primary"}, base.Tags)
+	configs, tm := as.snapshot()
+	tm.mutex.RLock()
+	assert.Len(t, tm.configs, len(configs), "配置与TokenManager一起替换")
+	tm.mutex.RUnlock()
+}
+
+// blockingConfigSource Save 阻塞直到 release 关闭，模拟慢速的配置后端（Vault 等）
+type blockingConfigSource struct {
+	saving  chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingConfigSource) Name() string                { return "blocking" }
+func (s *blockingConfigSource) Location() string            { return "blocking" }
+func (s *blockingConfigSource) Load() ([]AuthConfig, error) { return nil, nil }
+func (s *blockingConfigSource) Save([]AuthConfig) error {
+	close(s.saving)
+	<-s.release
+	return nil
+}
+
+func TestAuthService_PersistDoesNotBlockReaders(t *testing.T) {
+	t.Setenv("LAZY_WARMUP", "true")
+	stubFetchCachedToken(t)
+	source := &blockingConfigSource{saving: make(chan struct{}), release: make(chan struct{})}
+	as := NewAuthServiceWithSource([]AuthConfig{{ID: "a", AuthType: AuthMethodSocial, RefreshToken: "a"}}, source)
+
+	done := make(chan error, 1)
+	go func() {
+		label := "new"
+		_, err := as.UpdateConfig("a", ConfigPatch{Label: &label})
+		done <- err
+	}()
+	<-source.saving
+
+	// 持久化进行中：取token与读取配置不等待，读到的是变更前的配置
+	token, err := as.GetTokenForModel("")
+	require.NoError(t, err)
+	assert.Equal(t, "a", token.AccessToken)
+	cfg, _ := as.GetConfigByID("a")
+	assert.Empty(t, cfg.Label)
+
+	close(source.release)
+	require.NoError(t, <-done)
+	cfg, _ = as.GetConfigByID("a")
+	assert.Equal(t, "new", cfg.Label)
+}
@@ -1,10 +1,16 @@
 package auth
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
+
+	"kiro2api/types"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestNewAuthService_FromEnv(t *testing.T) {
@@ -67,3 +73,135 @@ func TestAuthService_GetConfigs(t *testing.T) {
 	assert.Equal(t, AuthMethodSocial, retrievedConfigs[0].AuthType)
 	assert.Equal(t, AuthMethodIdC, retrievedConfigs[1].AuthType)
 }
+
+func TestLoadConfigsFromFile_AssignsAndPersistsIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth_config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"auth":"Social","refreshToken":"a"},
+		{"id":"fixed-id","auth":"Social","refreshToken":"b","disabled":true}
+	]`), 0o600))
+
+	configs, err := loadConfigsFromFile(path)
+	require.NoError(t, err)
+	require.Len(t, configs, 2, "禁用的配置应保留以便重新启用")
+	assert.NotEmpty(t, configs[0].ID)
+	assert.Equal(t, "fixed-id", configs[1].ID)
+	assert.True(t, configs[1].Disabled)
+
+	reloaded, err := loadConfigsFromFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, configs[0].ID, reloaded[0].ID, "ID应在重启后保持稳定")
+}
+
+func TestLoadConfigsFromFile_DropsDuplicateRefreshTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth_config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"id":"first","auth":"Social","refreshToken":"a"},
+		{"id":"second","auth":"Social","refreshToken":"b"},
+		{"id":"copy","auth":"Social","refreshToken":"a"}
+	]`), 0o600))
+
+	configs, err := loadConfigsFromFile(path)
+	require.NoError(t, err)
+	require.Len(t, configs, 2)
+	assert.Equal(t, "first", configs[0].ID)
+	assert.Equal(t, "second", configs[1].ID)
+}
+
+func TestAuthService_AddConfigRejectsDuplicate(t *testing.T) {
+	service := NewAuthServiceWithConfigs([]AuthConfig{
+		{ID: "id-1", AuthType: AuthMethodSocial, RefreshToken: "token1"},
+	}, filepath.Join(t.TempDir(), "auth_config.json"))
+
+	err := service.AddConfig(AuthConfig{RefreshToken: "token1", Label: "copy"})
+	require.ErrorIs(t, err, ErrDuplicateConfig)
+	var dup *DuplicateConfigError
+	require.ErrorAs(t, err, &dup)
+	assert.Equal(t, "id-1", dup.ExistingID)
+	assert.Equal(t, 1, service.GetConfigCount())
+}
+
+func TestAuthService_UpdateAndRemoveByID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth_config.json")
+	service := NewAuthServiceWithConfigs([]AuthConfig{
+		{ID: "id-1", AuthType: AuthMethodSocial, RefreshToken: "token1"},
+		{ID: "id-2", AuthType: AuthMethodSocial, RefreshToken: "token2"},
+	}, path)
+	before := service.GetConfigs()
+
+	disabled := true
+	label := "  主账号 "
+	updated, err := service.UpdateConfig("id-2", ConfigPatch{Disabled: &disabled, Label: &label})
+	require.NoError(t, err)
+	assert.True(t, updated.Disabled)
+	assert.Equal(t, "主账号", updated.Label)
+	assert.False(t, before[1].Disabled, "已返回的配置切片不应被修改")
+
+	_, err = service.UpdateConfig("missing", ConfigPatch{})
+	assert.ErrorIs(t, err, ErrConfigNotFound)
+
+	require.NoError(t, service.RemoveConfigByID("id-1"))
+	assert.ErrorIs(t, service.RemoveConfigByID("id-1"), ErrConfigNotFound)
+
+	configs := service.GetConfigs()
+	require.Len(t, configs, 1)
+	assert.Equal(t, "id-2", configs[0].ID)
+
+	saved, err := loadConfigsFromFile(path)
+	require.NoError(t, err)
+	require.Len(t, saved, 1)
+	assert.Equal(t, "主账号", saved[0].Label)
+	assert.True(t, saved[0].Disabled)
+}
+
+func TestProxyURLValidation(t *testing.T) {
+	cfg, err := normalizeConfig(AuthConfig{RefreshToken: "a", ProxyURL: " socks5://127.0.0.1:1080 "})
+	require.NoError(t, err)
+	assert.Equal(t, "socks5://127.0.0.1:1080", cfg.ProxyURL)
+
+	_, err = normalizeConfig(AuthConfig{RefreshToken: "a", ProxyURL: "ftp://127.0.0.1:21"})
+	assert.Error(t, err)
+
+	configs := processConfigs([]AuthConfig{
+		{RefreshToken: "a", ProxyURL: "http://127.0.0.1:8080"},
+		{RefreshToken: "b", ProxyURL: "not a proxy"},
+	})
+	require.Len(t, configs, 1, "代理无效的配置应被跳过")
+	assert.Equal(t, "a", configs[0].RefreshToken)
+}
+
+func TestAuthService_AddValidatedConfig(t *testing.T) {
+	original := fetchCachedTokenFunc
+	t.Cleanup(func() { fetchCachedTokenFunc = original })
+	fetchCachedTokenFunc = func(_ *TokenManager, cfg AuthConfig) (*CachedToken, error) {
+		if cfg.RefreshToken == "bad" {
+			return nil, errors.New("invalid_grant")
+		}
+		return &CachedToken{
+			Token:     types.TokenInfo{AccessToken: "access", RefreshToken: cfg.RefreshToken + "-rotated", ExpiresAt: time.Now().Add(time.Hour)},
+			CachedAt:  time.Now(),
+			Available: 10,
+		}, nil
+	}
+
+	path := filepath.Join(t.TempDir(), "auth_config.json")
+	service := NewAuthServiceWithConfigs(nil, path)
+
+	_, _, err := service.AddValidatedConfig(AuthConfig{RefreshToken: "bad"})
+	require.ErrorIs(t, err, ErrConfigValidation)
+	assert.Equal(t, 0, service.GetConfigCount(), "验证失败时不添加账号")
+
+	added, cached, err := service.AddValidatedConfig(AuthConfig{RefreshToken: "good", Label: "主账号"})
+	require.NoError(t, err)
+	assert.Equal(t, "good-rotated", added.RefreshToken, "保存上游轮换后的refresh token")
+	assert.Equal(t, added.ID, cached.Token.ConfigID)
+
+	token, ok := service.GetTokenManager().cachedAccessToken(added.ID)
+	require.True(t, ok, "验证时刷新的token直接进入缓存")
+	assert.Equal(t, "access", token.AccessToken)
+
+	saved, err := loadConfigsFromFile(path)
+	require.NoError(t, err)
+	require.Len(t, saved, 1)
+	assert.Equal(t, "good-rotated", saved[0].RefreshToken)
+}
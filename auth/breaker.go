@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"kiro2api/breaker"
+	"kiro2api/config"
+	"kiro2api/utils"
+)
+
+// ErrAllTokensCircuitOpen 所有可用token对应的上游熔断器均处于打开状态
+var ErrAllTokensCircuitOpen = errors.New("所有可用token的上游熔断器均已打开")
+
+// UpstreamBreakers 全局上游熔断器（按 token 与上游端点），跨 TokenManager 重建保留
+// 包初始化时使用默认阈值，main 在加载 .env 与服务配置文件后调用 ConfigureUpstreamBreakers 按配置重建
+var UpstreamBreakers = breaker.NewSet(5, 30*time.Second)
+
+// ConfigureUpstreamBreakers 按环境变量重建 UpstreamBreakers，须在处理请求之前调用
+// - CIRCUIT_BREAKER_THRESHOLD: 连续 5xx/超时 多少次后打开（默认5）
+// - CIRCUIT_BREAKER_COOLDOWN_SECONDS: 打开后多久进入半开探测（默认30）
+func ConfigureUpstreamBreakers() {
+	UpstreamBreakers = breaker.NewSet(
+		utils.GetEnvIntWithDefault("CIRCUIT_BREAKER_THRESHOLD", 5),
+		time.Duration(utils.GetEnvIntWithDefault("CIRCUIT_BREAKER_COOLDOWN_SECONDS", 30))*time.Second,
+	)
+}
+
+// InferenceBreakerKey 推理端点（CodeWhisperer）上指定token的熔断器键
+func InferenceBreakerKey(configID string) string {
+	return breaker.Key(configID, config.CodeWhispererURL)
+}
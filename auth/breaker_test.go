@@ -0,0 +1,20 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigureUpstreamBreakers(t *testing.T) {
+	original := UpstreamBreakers
+	defer func() { UpstreamBreakers = original }()
+
+	t.Setenv("CIRCUIT_BREAKER_THRESHOLD", "2")
+	t.Setenv("CIRCUIT_BREAKER_COOLDOWN_SECONDS", "90")
+	ConfigureUpstreamBreakers()
+
+	assert.Equal(t, 2, UpstreamBreakers.Threshold())
+	assert.Equal(t, 90*time.Second, UpstreamBreakers.Cooldown())
+}
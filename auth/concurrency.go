@@ -0,0 +1,138 @@
+package auth
+
+import (
+	"errors"
+	"maps"
+	"sync"
+	"time"
+)
+
+// ErrAllTokensBusy 支持该模型的可用token均已达到并发上限（maxConcurrent），稍后有请求结束即可恢复
+var ErrAllTokensBusy = errors.New("所有可用token均已达到并发上限")
+
+// AccountSlots 全局账号并发计数（按配置ID），跨 TokenManager 重建保留
+// 选择token时在 tm.mutex 内为设置了 maxConcurrent 的账号预留名额（Reserve），上游请求发出时认领（Claim）、响应体关闭时归还
+var AccountSlots = NewSlotCounter()
+
+// slotLeaseTTL 预留名额的最长保留时间，选择token后未发出上游请求（如请求校验失败）且未取消的预留到期自动归还
+const slotLeaseTTL = time.Minute
+
+// slotLease 已预留但尚未认领的名额
+type slotLease struct {
+	configID  string
+	expiresAt time.Time
+}
+
+// SlotCounter 按配置ID统计进行中的上游请求数（含已预留未认领的名额）
+type SlotCounter struct {
+	mu        sync.Mutex
+	inFlight  map[string]int
+	leases    map[uint64]slotLease
+	nextLease uint64
+}
+
+// NewSlotCounter 创建并发计数器
+func NewSlotCounter() *SlotCounter {
+	return &SlotCounter{inFlight: make(map[string]int), leases: make(map[uint64]slotLease)}
+}
+
+// Acquire 占用账号的一个并发名额，返回的 release 归还名额（重复调用只归还一次）
+// 不会阻塞也不检查上限：选择token时未预留名额（账号不限并发或token非经选择获得）时使用
+func (s *SlotCounter) Acquire(configID string) (release func()) {
+	s.mu.Lock()
+	s.inFlight[configID]++
+	s.mu.Unlock()
+	return s.releaser(configID)
+}
+
+// Reserve 账号进行中的请求数低于 maxConcurrent 时原子地预留一个名额，返回预留编号
+// 预留在 Claim 认领前计入并发数，同一时刻的突发请求因此不会都选中同一账号
+func (s *SlotCounter) Reserve(configID string, maxConcurrent int) (lease uint64, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLeasesLocked(time.Now())
+	if maxConcurrent > 0 && s.inFlight[configID] >= maxConcurrent {
+		return 0, false
+	}
+	s.inFlight[configID]++
+	s.nextLease++
+	s.leases[s.nextLease] = slotLease{configID: configID, expiresAt: time.Now().Add(slotLeaseTTL)}
+	return s.nextLease, true
+}
+
+// Claim 认领预留的名额，返回的 release 归还名额（重复调用只归还一次）
+// 预留不存在（未预留或已到期归还）时按 Acquire 重新占用
+func (s *SlotCounter) Claim(lease uint64, configID string) (release func()) {
+	s.mu.Lock()
+	reserved, ok := s.leases[lease]
+	if ok {
+		delete(s.leases, lease)
+		configID = reserved.configID
+	} else {
+		s.inFlight[configID]++
+	}
+	s.mu.Unlock()
+	return s.releaser(configID)
+}
+
+// Cancel 归还尚未认领的预留名额，已认领或已到期的预留忽略
+func (s *SlotCounter) Cancel(lease uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if reserved, ok := s.leases[lease]; ok {
+		delete(s.leases, lease)
+		s.releaseLocked(reserved.configID)
+	}
+}
+
+// InFlight 账号进行中的上游请求数
+func (s *SlotCounter) InFlight(configID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLeasesLocked(time.Now())
+	return s.inFlight[configID]
+}
+
+// Snapshot 各账号进行中的上游请求数
+func (s *SlotCounter) Snapshot() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.expireLeasesLocked(time.Now())
+	return maps.Clone(s.inFlight)
+}
+
+// releaser 返回只归还一次的 release
+func (s *SlotCounter) releaser(configID string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			s.releaseLocked(configID)
+		})
+	}
+}
+
+// releaseLocked 归还账号的一个名额，调用者必须持有 s.mu
+func (s *SlotCounter) releaseLocked(configID string) {
+	if s.inFlight[configID] <= 1 {
+		delete(s.inFlight, configID)
+		return
+	}
+	s.inFlight[configID]--
+}
+
+// expireLeasesLocked 归还到期未认领的预留，调用者必须持有 s.mu
+func (s *SlotCounter) expireLeasesLocked(now time.Time) {
+	for id, reserved := range s.leases {
+		if now.After(reserved.expiresAt) {
+			delete(s.leases, id)
+			s.releaseLocked(reserved.configID)
+		}
+	}
+}
+
+// hasFreeSlot 账号是否还有空闲的并发名额（maxConcurrent 为0表示不限制）
+func (c AuthConfig) hasFreeSlot() bool {
+	return c.MaxConcurrent <= 0 || AccountSlots.InFlight(c.ID) < c.MaxConcurrent
+}
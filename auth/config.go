@@ -1,20 +1,151 @@
 package auth
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
 
+	"kiro2api/config"
 	"kiro2api/logger"
+	"kiro2api/utils"
 )
 
+// ErrConfigNotFound 指定ID的认证配置不存在
+var ErrConfigNotFound = errors.New("认证配置不存在")
+
+// ErrDuplicateConfig 添加的refreshToken与已有账号重复
+var ErrDuplicateConfig = errors.New("refreshToken已存在")
+
+// ErrConfigValidation 添加账号时向上游刷新token失败（refreshToken无效或已过期）
+var ErrConfigValidation = errors.New("账号验证失败")
+
+// DuplicateConfigError 添加的账号与已有账号使用同一个refreshToken，ExistingID 为已有账号的ID
+type DuplicateConfigError struct {
+	ExistingID string
+}
+
+func (e *DuplicateConfigError) Error() string {
+	return fmt.Sprintf("%v: 与账号 %s 重复", ErrDuplicateConfig, e.ExistingID)
+}
+
+func (e *DuplicateConfigError) Unwrap() error { return ErrDuplicateConfig }
+
 // AuthConfig 简化的认证配置
 type AuthConfig struct {
-	AuthType     string `json:"auth"`
-	RefreshToken string `json:"refreshToken"`
-	ClientID     string `json:"clientId,omitempty"`
-	ClientSecret string `json:"clientSecret,omitempty"`
-	Disabled     bool   `json:"disabled,omitempty"`
+	ID           string   `json:"id,omitempty" yaml:"id,omitempty" toml:"id,omitempty"` // 稳定ID（UUID），加载时自动分配并持久化
+	AuthType     string   `json:"auth" yaml:"auth" toml:"auth"`
+	RefreshToken string   `json:"refreshToken" yaml:"refreshToken" toml:"refreshToken"`
+	ClientID     string   `json:"clientId,omitempty" yaml:"clientId,omitempty" toml:"clientId,omitempty"`
+	ClientSecret string   `json:"clientSecret,omitempty" yaml:"clientSecret,omitempty" toml:"clientSecret,omitempty"`
+	Disabled     bool     `json:"disabled,omitempty" yaml:"disabled,omitempty" toml:"disabled,omitempty"`
+	ProxyURL     string   `json:"proxyUrl,omitempty" yaml:"proxyUrl,omitempty" toml:"proxyUrl,omitempty"` // 出站代理（http/https/socks5），刷新与推理请求经此代理发出
+	Models       []string `json:"models,omitempty" yaml:"models,omitempty" toml:"models,omitempty"`       // 可用的模型系列（opus/sonnet/haiku）或完整模型名，为空表示全部可用
+	// MaxConcurrent 同时进行的上游请求数上限，达到上限时优先选择其他账号；0 表示不限制
+	MaxConcurrent int `json:"maxConcurrent,omitempty" yaml:"maxConcurrent,omitempty" toml:"maxConcurrent,omitempty"`
+
+	// 管理元数据（不影响认证）
+	Label string   `json:"label,omitempty" yaml:"label,omitempty" toml:"label,omitempty"` // 显示名称
+	Tags  []string `json:"tags,omitempty" yaml:"tags,omitempty" toml:"tags,omitempty"`    // 标签，用于筛选分组与选择策略（如 primary/backup）
+	Note  string   `json:"note,omitempty" yaml:"note,omitempty" toml:"note,omitempty"`    // 备注
+
+	// 从配置文件加载时展开的 ${ENV_VAR} 占位符（字段名 → 原始模板），写回文件时还原，不持久化展开后的密钥
+	// 加载后不再修改，复制配置时可共享
+	placeholders map[string]configPlaceholder
+}
+
+// clone 深拷贝配置（复制切片字段），交给调用方的配置与服务内部状态互不影响
+func (c AuthConfig) clone() AuthConfig {
+	c.Models = slices.Clone(c.Models)
+	c.Tags = slices.Clone(c.Tags)
+	return c
+}
+
+// cloneConfigs 深拷贝配置列表
+func cloneConfigs(configs []AuthConfig) []AuthConfig {
+	if configs == nil {
+		return nil
+	}
+	cloned := make([]AuthConfig, len(configs))
+	for i, cfg := range configs {
+		cloned[i] = cfg.clone()
+	}
+	return cloned
+}
+
+// HasTag 判断配置是否带有指定标签（不区分大小写）
+func (c AuthConfig) HasTag(tag string) bool {
+	for _, t := range c.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// SupportsModel 判断账号是否可用于指定模型（未限制模型或匹配系列/完整模型名）
+// 模型路由表为该模型配置了标签时，账号还必须带有其中任一标签；别名按解析后的目标模型识别系列
+func (c AuthConfig) SupportsModel(model string) bool {
+	if model == "" {
+		return true
+	}
+	target := model
+	if route, ok := config.ResolveModel(model); ok {
+		if len(route.Tags) > 0 && !c.hasAnyTag(route.Tags) {
+			return false
+		}
+		target = route.Target
+	}
+	if len(c.Models) == 0 {
+		return true
+	}
+	family := config.ModelFamily(target)
+	for _, m := range c.Models {
+		if strings.EqualFold(m, family) || strings.EqualFold(m, model) || strings.EqualFold(m, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// eligible 判断账号是否可用于指定模型，且带有任一 tags 标签（tags 为空表示不限，用于多租户隔离）
+func (c AuthConfig) eligible(model string, tags []string) bool {
+	if len(tags) > 0 && !c.hasAnyTag(tags) {
+		return false
+	}
+	return c.SupportsModel(model)
+}
+
+// hasAnyTag 判断配置是否带有任一指定标签
+func (c AuthConfig) hasAnyTag(tags []string) bool {
+	for _, tag := range tags {
+		if c.HasTag(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeTags 规范化标签：去除空白、转小写、去重并保持原顺序
+func NormalizeTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool, len(tags))
+	out := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	return out
 }
 
 // 认证方法常量
@@ -103,6 +234,8 @@ func loadConfigsWithPath() ([]AuthConfig, string, error) {
 		return []AuthConfig{}, configFilePath, nil
 	}
 
+	// 环境变量中的配置无法写回，ID在首次通过API修改并保存到配置文件后才会固定
+	assignConfigIDs(configs)
 	validConfigs := processConfigs(configs)
 	if len(validConfigs) == 0 {
 		logger.Warn("没有有效的认证配置，服务将以空Token池启动")
@@ -121,26 +254,31 @@ func GetConfigs() ([]AuthConfig, error) {
 	return loadConfigs()
 }
 
-// parseJSONConfig 解析JSON配置字符串
+// parseJSONConfig 解析JSON配置字符串（v1账号数组、单个账号对象或v2带版本的配置）
 func parseJSONConfig(jsonData string) ([]AuthConfig, error) {
-	var configs []AuthConfig
+	configs, _, err := decodeConfigDocument([]byte(jsonData))
+	return configs, err
+}
 
-	// 尝试解析为数组
-	if err := json.Unmarshal([]byte(jsonData), &configs); err != nil {
-		// 尝试解析为单个对象
-		var single AuthConfig
-		if err := json.Unmarshal([]byte(jsonData), &single); err != nil {
-			return nil, fmt.Errorf("JSON格式无效: %w", err)
+// assignConfigIDs 为缺少ID或ID重复的配置分配UUID，返回分配数量
+func assignConfigIDs(configs []AuthConfig) int {
+	assigned := 0
+	seen := make(map[string]bool, len(configs))
+	for i := range configs {
+		if configs[i].ID == "" || seen[configs[i].ID] {
+			configs[i].ID = utils.GenerateUUID()
+			assigned++
 		}
-		configs = []AuthConfig{single}
+		seen[configs[i].ID] = true
 	}
-
-	return configs, nil
+	return assigned
 }
 
 // processConfigs 处理和验证配置
+// 使用同一个refreshToken的重复配置只保留第一个，避免同一账号在轮换中占多个位置
 func processConfigs(configs []AuthConfig) []AuthConfig {
 	var validConfigs []AuthConfig
+	seen := make(map[string]string, len(configs)) // refreshToken哈希 -> 保留的配置ID
 
 	for i, config := range configs {
 		// 验证必要字段
@@ -160,11 +298,37 @@ func processConfigs(configs []AuthConfig) []AuthConfig {
 			}
 		}
 
-		// 跳过禁用的配置
-		if config.Disabled {
+		config.Tags = NormalizeTags(config.Tags)
+		config.Models = NormalizeTags(config.Models)
+
+		config.ProxyURL = strings.TrimSpace(config.ProxyURL)
+		if config.ProxyURL != "" {
+			if _, err := utils.ParseProxyURL(config.ProxyURL); err != nil {
+				logger.Warn("跳过代理配置无效的认证配置",
+					logger.Int("index", i),
+					logger.Err(err))
+				continue
+			}
+		}
+
+		if config.MaxConcurrent < 0 {
+			logger.Warn("认证配置的maxConcurrent为负数，按不限制处理",
+				logger.Int("index", i),
+				logger.Int("max_concurrent", config.MaxConcurrent))
+			config.MaxConcurrent = 0
+		}
+
+		hash := refreshTokenHash(config.RefreshToken)
+		if existingID, dup := seen[hash]; dup {
+			logger.Warn("跳过refreshToken重复的认证配置",
+				logger.Int("index", i),
+				logger.String("id", config.ID),
+				logger.String("existing_id", existingID))
 			continue
 		}
+		seen[hash] = config.ID
 
+		// 禁用的配置保留在列表中（TokenManager 会跳过），以便通过API重新启用
 		validConfigs = append(validConfigs, config)
 		_ = i // 避免未使用变量警告
 	}
@@ -179,11 +343,21 @@ func loadConfigsFromFile(path string) ([]AuthConfig, error) {
 		return nil, fmt.Errorf("读取配置文件失败: %w\n配置文件路径: %s", err, path)
 	}
 
-	configs, err := parseJSONConfig(string(content))
+	configs, version, err := decodeConfigFile(path, content)
 	if err != nil {
 		return nil, fmt.Errorf("解析配置文件失败: %w\n配置文件路径: %s", err, path)
 	}
 
+	// 为缺少ID的配置分配稳定ID并写回文件
+	if assignConfigIDs(configs) > 0 && version == ConfigFormatVersion {
+		if err := SaveConfigsToFile(path, configs); err != nil {
+			logger.Warn("写回配置ID失败，重启后ID将重新分配", logger.Err(err))
+		}
+	}
+	if version < ConfigFormatVersion {
+		migrateConfigFile(path, content, version, configs)
+	}
+
 	if len(configs) == 0 {
 		logger.Info("配置文件为空，服务将以空Token池启动",
 			logger.String("file_path", path))
@@ -205,9 +379,32 @@ func loadConfigsFromFile(path string) ([]AuthConfig, error) {
 	return validConfigs, nil
 }
 
-// SaveConfigsToFile 将配置持久化到文件（导出供 AuthService 使用）
+// migrateConfigFile 将旧版本的配置文件升级为当前格式，原文件备份为 <path>.v<版本>.bak
+// 迁移失败不影响本次加载，下次启动时重试
+func migrateConfigFile(path string, original []byte, version int, configs []AuthConfig) {
+	backupPath := fmt.Sprintf("%s.v%d.bak", path, version)
+	if err := os.WriteFile(backupPath, original, 0o600); err != nil {
+		logger.Warn("备份旧版本配置文件失败，暂不迁移",
+			logger.String("file_path", path),
+			logger.Err(err))
+		return
+	}
+	if err := SaveConfigsToFile(path, configs); err != nil {
+		logger.Warn("迁移配置文件失败，下次启动时重试",
+			logger.String("file_path", path),
+			logger.Err(err))
+		return
+	}
+	logger.Info("配置文件已迁移到新格式",
+		logger.String("file_path", path),
+		logger.Int("from_version", version),
+		logger.Int("to_version", ConfigFormatVersion),
+		logger.String("backup", backupPath))
+}
+
+// SaveConfigsToFile 将配置按当前格式版本持久化到文件（导出供 AuthService 使用）
 func SaveConfigsToFile(path string, configs []AuthConfig) error {
-	data, err := json.MarshalIndent(configs, "", "  ")
+	data, err := encodeConfigFile(path, configs)
 	if err != nil {
 		return fmt.Errorf("序列化认证配置失败: %w", err)
 	}
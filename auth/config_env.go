@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+)
+
+// configEnvPlaceholder 配置文件中的环境变量占位符 ${ENV_VAR}
+var configEnvPlaceholder = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// configPlaceholder 字段的原始模板与加载时展开得到的值
+type configPlaceholder struct {
+	template string
+	expanded string
+}
+
+// configEnvFields 支持 ${ENV_VAR} 占位符的字段（JSON字段名 → 字段访问）
+var configEnvFields = []struct {
+	name  string
+	field func(*AuthConfig) *string
+}{
+	{"refreshToken", func(c *AuthConfig) *string { return &c.RefreshToken }},
+	{"clientId", func(c *AuthConfig) *string { return &c.ClientID }},
+	{"clientSecret", func(c *AuthConfig) *string { return &c.ClientSecret }},
+	{"proxyUrl", func(c *AuthConfig) *string { return &c.ProxyURL }},
+	{"label", func(c *AuthConfig) *string { return &c.Label }},
+	{"note", func(c *AuthConfig) *string { return &c.Note }},
+}
+
+// expandConfigEnv 展开配置文件中的 ${ENV_VAR} 占位符，并记录原始模板供写回时还原
+// 引用的环境变量未设置时返回错误，避免以空密钥启动
+func expandConfigEnv(configs []AuthConfig) error {
+	for i := range configs {
+		cfg := &configs[i]
+		for _, f := range configEnvFields {
+			value := f.field(cfg)
+			if !configEnvPlaceholder.MatchString(*value) {
+				continue
+			}
+			var missing string
+			expanded := configEnvPlaceholder.ReplaceAllStringFunc(*value, func(match string) string {
+				name := configEnvPlaceholder.FindStringSubmatch(match)[1]
+				env, ok := os.LookupEnv(name)
+				if !ok && missing == "" {
+					missing = name
+				}
+				return env
+			})
+			if missing != "" {
+				return fmt.Errorf("第%d个账号的 %s 引用的环境变量 %s 未设置", i+1, f.name, missing)
+			}
+			if cfg.placeholders == nil {
+				cfg.placeholders = make(map[string]configPlaceholder)
+			}
+			cfg.placeholders[f.name] = configPlaceholder{template: *value, expanded: expanded}
+			*value = expanded
+		}
+	}
+	return nil
+}
+
+// restoreConfigEnv 返回写回文件用的配置副本：值未被修改（仍等于加载时的展开结果）的字段还原为占位符
+// 值已改变（如上游轮换了refresh token）的字段写入新值
+func restoreConfigEnv(configs []AuthConfig) []AuthConfig {
+	if !slices.ContainsFunc(configs, func(cfg AuthConfig) bool { return len(cfg.placeholders) > 0 }) {
+		return configs
+	}
+	restored := slices.Clone(configs)
+	for i := range restored {
+		for _, f := range configEnvFields {
+			p, ok := restored[i].placeholders[f.name]
+			if value := f.field(&restored[i]); ok && *value == p.expanded {
+				*value = p.template
+			}
+		}
+	}
+	return restored
+}
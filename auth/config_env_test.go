@@ -0,0 +1,42 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFile_EnvPlaceholders(t *testing.T) {
+	t.Setenv("KIRO_TEST_CLIENT_SECRET", "secret-from-env")
+	t.Setenv("KIRO_TEST_REFRESH", "refresh-from-env")
+	path := filepath.Join(t.TempDir(), "auth_config.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"version":2,"accounts":[
+		{"id":"idc","auth":"IdC","refreshToken":"${KIRO_TEST_REFRESH}","clientId":"cid","clientSecret":"${KIRO_TEST_CLIENT_SECRET}","label":"团队-${KIRO_TEST_CLIENT_SECRET}"}
+	]}`), 0o600))
+
+	configs, err := loadConfigsFromFile(path)
+	require.NoError(t, err)
+	require.Len(t, configs, 1)
+	assert.Equal(t, "refresh-from-env", configs[0].RefreshToken)
+	assert.Equal(t, "secret-from-env", configs[0].ClientSecret)
+	assert.Equal(t, "团队-secret-from-env", configs[0].Label)
+
+	// 写回时保留占位符；上游轮换后的refresh token写入新值
+	as := NewAuthServiceWithConfigs(configs, path)
+	require.NoError(t, as.SaveRotatedRefreshToken(configs[0], types.TokenInfo{RefreshToken: "rotated"}))
+	saved, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(saved), `"clientSecret": "${KIRO_TEST_CLIENT_SECRET}"`)
+	assert.Contains(t, string(saved), `"refreshToken": "rotated"`)
+	assert.NotContains(t, string(saved), "secret-from-env")
+
+	t.Setenv("KIRO_TEST_CLIENT_SECRET", "")
+	os.Unsetenv("KIRO_TEST_CLIENT_SECRET")
+	_, err = loadConfigsFromFile(path)
+	assert.ErrorContains(t, err, "KIRO_TEST_CLIENT_SECRET 未设置")
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFormatVersion 当前的配置文件格式版本
+//   - v1: 账号数组（或单个账号对象），没有版本字段
+//   - v2: {"version":2,"accounts":[...]}，新增字段时按版本迁移
+const ConfigFormatVersion = 2
+
+// configDocument 带版本的配置文件
+type configDocument struct {
+	Version  int          `json:"version" yaml:"version" toml:"version"`
+	Accounts []AuthConfig `json:"accounts" yaml:"accounts" toml:"accounts"`
+}
+
+// configFileFormat 按扩展名判断配置文件格式：.yaml/.yml、.toml，其余按JSON处理
+func configFileFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return "yaml"
+	case ".toml":
+		return "toml"
+	default:
+		return "json"
+	}
+}
+
+// decodeConfigFile 按扩展名解析配置文件，返回配置与格式版本
+// YAML/TOML 先转换为等价的JSON再解析，字段名、版本判断与JSON格式完全一致（TOML 只能使用v2格式）
+// 字符串字段中的 ${ENV_VAR} 占位符在解析后展开
+func decodeConfigFile(path string, data []byte) ([]AuthConfig, int, error) {
+	configs, version, err := decodeConfigFileFormat(path, data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := expandConfigEnv(configs); err != nil {
+		return nil, 0, err
+	}
+	return configs, version, nil
+}
+
+// decodeConfigFileFormat 按扩展名将配置文件解析为配置列表（不展开占位符）
+func decodeConfigFileFormat(path string, data []byte) ([]AuthConfig, int, error) {
+	var (
+		raw any
+		err error
+	)
+	switch configFileFormat(path) {
+	case "yaml":
+		err = yaml.Unmarshal(data, &raw)
+	case "toml":
+		var table map[string]any
+		err = toml.Unmarshal(data, &table)
+		raw = table
+	default:
+		return decodeConfigDocument(data)
+	}
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s格式无效: %w", strings.ToUpper(configFileFormat(path)), err)
+	}
+	if raw == nil {
+		return []AuthConfig{}, ConfigFormatVersion, nil
+	}
+	converted, err := json.Marshal(raw)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s格式无效: %w", strings.ToUpper(configFileFormat(path)), err)
+	}
+	return decodeConfigDocument(converted)
+}
+
+// encodeConfigFile 按扩展名以当前格式版本序列化配置（写回时不保留原文件中的注释）
+// 加载时展开的 ${ENV_VAR} 占位符原样写回
+func encodeConfigFile(path string, configs []AuthConfig) ([]byte, error) {
+	configs = restoreConfigEnv(configs)
+	if configs == nil {
+		configs = []AuthConfig{}
+	}
+	doc := configDocument{Version: ConfigFormatVersion, Accounts: configs}
+	switch configFileFormat(path) {
+	case "yaml":
+		return yaml.Marshal(doc)
+	case "toml":
+		return toml.Marshal(doc)
+	default:
+		return encodeConfigDocument(configs)
+	}
+}
+
+// decodeConfigDocument 解析配置JSON，兼容v1的账号数组与单个账号对象，返回配置与格式版本
+func decodeConfigDocument(data []byte) ([]AuthConfig, int, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var configs []AuthConfig
+		if err := json.Unmarshal(trimmed, &configs); err != nil {
+			return nil, 0, fmt.Errorf("JSON格式无效: %w", err)
+		}
+		return configs, 1, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &fields); err != nil {
+		return nil, 0, fmt.Errorf("JSON格式无效: %w", err)
+	}
+	if _, versioned := fields["version"]; !versioned {
+		var single AuthConfig
+		if err := json.Unmarshal(trimmed, &single); err != nil {
+			return nil, 0, fmt.Errorf("JSON格式无效: %w", err)
+		}
+		return []AuthConfig{single}, 1, nil
+	}
+
+	var doc configDocument
+	if err := json.Unmarshal(trimmed, &doc); err != nil {
+		return nil, 0, fmt.Errorf("JSON格式无效: %w", err)
+	}
+	if doc.Version < 1 || doc.Version > ConfigFormatVersion {
+		return nil, 0, fmt.Errorf("不支持的配置格式版本 %d（当前版本支持 1-%d，请升级 kiro2api）", doc.Version, ConfigFormatVersion)
+	}
+	if doc.Accounts == nil {
+		doc.Accounts = []AuthConfig{}
+	}
+	return doc.Accounts, doc.Version, nil
+}
+
+// encodeConfigDocument 按当前格式版本序列化配置
+func encodeConfigDocument(configs []AuthConfig) ([]byte, error) {
+	if configs == nil {
+		configs = []AuthConfig{}
+	}
+	return json.MarshalIndent(configDocument{Version: ConfigFormatVersion, Accounts: configs}, "", "  ")
+}
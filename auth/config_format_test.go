@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeConfigDocument(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantVersion int
+		wantCount   int
+		wantErr     string
+	}{
+		{"v1数组", `[{"auth":"Social","refreshToken":"a"},{"auth":"Social","refreshToken":"b"}]`, 1, 2, ""},
+		{"v1单个对象", `{"auth":"Social","refreshToken":"a"}`, 1, 1, ""},
+		{"v2", `{"version":2,"accounts":[{"auth":"Social","refreshToken":"a"}]}`, 2, 1, ""},
+		{"v2空账号", `{"version":2}`, 2, 0, ""},
+		{"未来版本", `{"version":3,"accounts":[]}`, 0, 0, "不支持的配置格式版本 3"},
+		{"无效JSON", `{`, 0, 0, "JSON格式无效"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configs, version, err := decodeConfigDocument([]byte(tt.input))
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantVersion, version)
+			assert.Len(t, configs, tt.wantCount)
+		})
+	}
+}
+
+func TestLoadConfigsFromFile_MigratesV1(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth_config.json")
+	original := []byte(`[{"id":"a","auth":"Social","refreshToken":"token-a","label":"主账号"}]`)
+	require.NoError(t, os.WriteFile(path, original, 0o600))
+
+	configs, err := loadConfigsFromFile(path)
+	require.NoError(t, err)
+	require.Len(t, configs, 1)
+	assert.Equal(t, "主账号", configs[0].Label)
+
+	backup, err := os.ReadFile(path + ".v1.bak")
+	require.NoError(t, err)
+	assert.Equal(t, original, backup, "迁移前备份原文件")
+
+	migrated, err := os.ReadFile(path)
+	require.NoError(t, err)
+	reloaded, version, err := decodeConfigDocument(migrated)
+	require.NoError(t, err)
+	assert.Equal(t, ConfigFormatVersion, version)
+	assert.Equal(t, configs, reloaded)
+}
+
+func TestConfigFile_YAMLAndTOML(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"auth.yaml": `
+version: 2
+accounts:
+  - auth: Social
+    refreshToken: token-a
+    label: 主账号
+    tags: [primary]
+  - auth: IdC
+    refreshToken: token-b
+    clientId: cid
+    clientSecret: secret
+`,
+		"auth.toml": `
+version = 2
+
+[[accounts]]
+auth = "Social"
+refreshToken = "token-a"
+label = "主账号"
+tags = ["primary"]
+
+[[accounts]]
+auth = "IdC"
+refreshToken = "token-b"
+clientId = "cid"
+clientSecret = "secret"
+`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+			configs, err := loadConfigsFromFile(path)
+			require.NoError(t, err)
+			require.Len(t, configs, 2)
+			assert.Equal(t, "主账号", configs[0].Label)
+			assert.Equal(t, []string{"primary"}, configs[0].Tags)
+			assert.Equal(t, AuthMethodIdC, configs[1].AuthType)
+			assert.Equal(t, "secret", configs[1].ClientSecret)
+			assert.NotEmpty(t, configs[0].ID, "缺少的ID写回原格式的文件")
+
+			// 写回后仍是同一格式，可重新加载
+			reloaded, err := loadConfigsFromFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, configs, reloaded)
+			_, statErr := os.Stat(path + ".v1.bak")
+			assert.True(t, os.IsNotExist(statErr), "v2格式不需要迁移")
+		})
+	}
+}
+
+func TestLoadConfigsFromFile_MigratesYAMLArray(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth_config.yml")
+	require.NoError(t, os.WriteFile(path, []byte("- auth: Social\n  refreshToken: token-a\n"), 0o600))
+
+	configs, err := loadConfigsFromFile(path)
+	require.NoError(t, err)
+	require.Len(t, configs, 1)
+
+	migrated, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(migrated), "version: 2")
+	assert.Contains(t, string(migrated), "refreshToken: token-a")
+}
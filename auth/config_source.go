@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"kiro2api/logger"
+)
+
+// 配置存储后端（KIRO_CONFIG_SOURCE）
+const (
+	ConfigSourceFile  = "file"
+	ConfigSourceEnv   = "env"
+	ConfigSourceVault = "vault"
+	ConfigSourceAWS   = "aws-secrets-manager"
+)
+
+// ErrConfigSourceReadOnly 配置存储不支持写回（如环境变量）
+var ErrConfigSourceReadOnly = errors.New("配置存储不支持写回")
+
+// ConfigSource 认证配置的存储后端
+// Load 返回未校验的原始配置，校验与ID分配由调用方统一处理；Save 写回完整配置列表
+type ConfigSource interface {
+	// Name 后端类型（file/env/vault/aws-secrets-manager）
+	Name() string
+	// Location 配置位置描述，用于日志与命令行输出
+	Location() string
+	Load() ([]AuthConfig, error)
+	Save(configs []AuthConfig) error
+}
+
+// FileConfigSource 本地JSON文件
+type FileConfigSource struct {
+	Path string
+}
+
+// NewFileConfigSource 创建文件配置存储
+func NewFileConfigSource(path string) *FileConfigSource {
+	return &FileConfigSource{Path: path}
+}
+
+func (s *FileConfigSource) Name() string     { return ConfigSourceFile }
+func (s *FileConfigSource) Location() string { return s.Path }
+
+func (s *FileConfigSource) Load() ([]AuthConfig, error) {
+	if s.Path == "" {
+		return nil, fmt.Errorf("未配置配置文件路径")
+	}
+	content, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("读取配置文件失败: %w", err)
+	}
+	configs, _, err := decodeConfigFile(s.Path, content)
+	if err != nil {
+		return nil, fmt.Errorf("解析配置文件失败: %w", err)
+	}
+	return configs, nil
+}
+
+func (s *FileConfigSource) Save(configs []AuthConfig) error {
+	return SaveConfigsToFile(s.Path, configs)
+}
+
+// EnvConfigSource 从环境变量 KIRO_AUTH_TOKEN 读取JSON配置，不支持写回
+type EnvConfigSource struct {
+	Var string
+}
+
+func (s *EnvConfigSource) Name() string     { return ConfigSourceEnv }
+func (s *EnvConfigSource) Location() string { return "env:" + s.Var }
+
+func (s *EnvConfigSource) Load() ([]AuthConfig, error) {
+	jsonData := strings.TrimSpace(os.Getenv(s.Var))
+	if jsonData == "" {
+		return []AuthConfig{}, nil
+	}
+	configs, err := parseJSONConfig(jsonData)
+	if err != nil {
+		return nil, fmt.Errorf("解析%s失败: %w", s.Var, err)
+	}
+	return configs, nil
+}
+
+func (s *EnvConfigSource) Save([]AuthConfig) error {
+	return fmt.Errorf("%w: 环境变量 %s 中的配置无法通过API修改", ErrConfigSourceReadOnly, s.Var)
+}
+
+// newConfigSourceFromEnv 按 KIRO_CONFIG_SOURCE 创建配置存储（file 除外，文件存储沿用原有的路径解析规则）
+func newConfigSourceFromEnv(kind string) (ConfigSource, error) {
+	switch kind {
+	case ConfigSourceEnv:
+		return &EnvConfigSource{Var: "KIRO_AUTH_TOKEN"}, nil
+	case ConfigSourceVault:
+		return NewVaultConfigSourceFromEnv()
+	case ConfigSourceAWS:
+		return NewAWSSecretsConfigSourceFromEnv()
+	default:
+		return nil, fmt.Errorf("未知的KIRO_CONFIG_SOURCE: %q（可选 file/env/vault/aws-secrets-manager）", kind)
+	}
+}
+
+// loadConfigSource 按 KIRO_CONFIG_SOURCE 加载配置，返回配置与用于持久化的存储
+// 未设置或为 file 时保持原有行为：KIRO_AUTH_TOKEN 文件路径 > AUTH_CONFIG_FILE > KIRO_AUTH_TOKEN JSON 字符串
+func loadConfigSource() ([]AuthConfig, ConfigSource, error) {
+	kind := strings.ToLower(strings.TrimSpace(os.Getenv("KIRO_CONFIG_SOURCE")))
+	if kind == "" || kind == ConfigSourceFile {
+		configs, path, err := loadConfigsWithPath()
+		return configs, NewFileConfigSource(path), err
+	}
+
+	source, err := newConfigSourceFromEnv(kind)
+	if err != nil {
+		return nil, nil, err
+	}
+	configs, err := loadConfigsFromSource(source)
+	if err != nil {
+		return nil, source, err
+	}
+	return configs, source, nil
+}
+
+// ResolveConfigSource 按与服务相同的规则确定配置存储，不加载配置
+// 文件模式下 KIRO_AUTH_TOKEN 为JSON字符串且默认配置文件不存在时返回环境变量存储（供只读检查使用）
+func ResolveConfigSource() (ConfigSource, error) {
+	kind := strings.ToLower(strings.TrimSpace(os.Getenv("KIRO_CONFIG_SOURCE")))
+	if kind != "" && kind != ConfigSourceFile {
+		return newConfigSourceFromEnv(kind)
+	}
+
+	jsonData := os.Getenv("KIRO_AUTH_TOKEN")
+	if isRegularFile(jsonData) {
+		return NewFileConfigSource(jsonData), nil
+	}
+	path := getDefaultConfigFile()
+	if jsonData == "" || isRegularFile(path) {
+		return NewFileConfigSource(path), nil
+	}
+	return &EnvConfigSource{Var: "KIRO_AUTH_TOKEN"}, nil
+}
+
+func isRegularFile(path string) bool {
+	if path == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// ValidateConfigs 校验原始配置，返回加载时会被跳过的条目及重复的ID、refresh token
+func ValidateConfigs(configs []AuthConfig) []error {
+	var problems []error
+	ids := make(map[string]int, len(configs))
+	tokens := make(map[string]int, len(configs))
+	for i, cfg := range configs {
+		name := fmt.Sprintf("第%d个账号", i+1)
+		if cfg.ID != "" {
+			name += "（" + cfg.ID + "）"
+		}
+		if _, err := normalizeConfig(cfg); err != nil {
+			problems = append(problems, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+		if first, ok := ids[cfg.ID]; ok {
+			problems = append(problems, fmt.Errorf("%s: ID与第%d个账号重复", name, first+1))
+		} else if cfg.ID != "" {
+			ids[cfg.ID] = i
+		}
+		hash := refreshTokenHash(cfg.RefreshToken)
+		if first, ok := tokens[hash]; ok {
+			problems = append(problems, fmt.Errorf("%s: refreshToken与第%d个账号重复", name, first+1))
+		} else {
+			tokens[hash] = i
+		}
+	}
+	return problems
+}
+
+// loadConfigsFromSource 从存储加载并校验配置，缺少ID时分配后写回
+func loadConfigsFromSource(source ConfigSource) ([]AuthConfig, error) {
+	configs, err := source.Load()
+	if err != nil {
+		return nil, fmt.Errorf("从%s加载认证配置失败: %w", source.Name(), err)
+	}
+
+	if assignConfigIDs(configs) > 0 {
+		if err := source.Save(configs); err != nil && !errors.Is(err, ErrConfigSourceReadOnly) {
+			logger.Warn("写回配置ID失败，重启后ID将重新分配", logger.Err(err))
+		}
+	}
+
+	validConfigs := processConfigs(configs)
+	if validConfigs == nil {
+		validConfigs = []AuthConfig{}
+	}
+	logger.Info("从配置存储加载认证配置",
+		logger.String("config_source", source.Location()),
+		logger.Int("total_count", len(configs)),
+		logger.Int("valid_count", len(validConfigs)))
+	return validConfigs, nil
+}
+
+// envOrDefault 读取环境变量，未设置时返回默认值
+func envOrDefault(key, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,235 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"kiro2api/utils"
+)
+
+// awsCredentials AWS 静态凭证（来自 AWS_ACCESS_KEY_ID 等环境变量）
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+}
+
+// awsDelegatedCredentialEnvs 需要 AWS SDK 凭证链才能使用的凭证来源（IRSA、ECS 任务角色、共享配置文件）
+// 本存储只支持环境变量中的静态凭证，检测到这些变量而未配置静态凭证时给出明确的错误
+var awsDelegatedCredentialEnvs = []string{
+	"AWS_WEB_IDENTITY_TOKEN_FILE",
+	"AWS_ROLE_ARN",
+	"AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+	"AWS_CONTAINER_CREDENTIALS_FULL_URI",
+	"AWS_PROFILE",
+}
+
+// AWSSecretsConfigSource AWS Secrets Manager 存储，配置以JSON数组保存在 SecretString 中
+// 请求使用 SigV4 签名，凭证只取自环境变量中的静态凭证：
+// 不支持 IRSA、ECS 任务角色、EC2 实例角色与共享配置文件，这些环境需通过 STS 等方式导出临时凭证到
+// AWS_ACCESS_KEY_ID / AWS_SECRET_ACCESS_KEY / AWS_SESSION_TOKEN
+type AWSSecretsConfigSource struct {
+	SecretID    string
+	Region      string
+	Endpoint    string // 默认 https://secretsmanager.<region>.amazonaws.com
+	Credentials awsCredentials
+	Client      *http.Client
+
+	now func() time.Time
+}
+
+// NewAWSSecretsConfigSourceFromEnv 从环境变量创建 AWS Secrets Manager 配置存储
+func NewAWSSecretsConfigSourceFromEnv() (*AWSSecretsConfigSource, error) {
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	s := &AWSSecretsConfigSource{
+		SecretID: strings.TrimSpace(os.Getenv("KIRO_AWS_SECRET_ID")),
+		Region:   region,
+		Endpoint: strings.TrimRight(os.Getenv("KIRO_AWS_SECRETS_ENDPOINT"), "/"),
+		Credentials: awsCredentials{
+			AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		},
+	}
+	if s.SecretID == "" {
+		return nil, fmt.Errorf("KIRO_CONFIG_SOURCE=aws-secrets-manager 需要设置 KIRO_AWS_SECRET_ID")
+	}
+	if s.Region == "" {
+		return nil, fmt.Errorf("KIRO_CONFIG_SOURCE=aws-secrets-manager 需要设置 AWS_REGION")
+	}
+	if s.Credentials.AccessKeyID == "" || s.Credentials.SecretAccessKey == "" {
+		for _, env := range awsDelegatedCredentialEnvs {
+			if os.Getenv(env) != "" {
+				return nil, fmt.Errorf("KIRO_CONFIG_SOURCE=aws-secrets-manager 只支持静态凭证，检测到 %s 但不支持 IRSA/ECS/实例角色/共享配置文件，请设置 AWS_ACCESS_KEY_ID 与 AWS_SECRET_ACCESS_KEY（临时凭证另设 AWS_SESSION_TOKEN）", env)
+			}
+		}
+		return nil, fmt.Errorf("KIRO_CONFIG_SOURCE=aws-secrets-manager 需要设置 AWS_ACCESS_KEY_ID 与 AWS_SECRET_ACCESS_KEY（不支持 IRSA/ECS/EC2 实例角色）")
+	}
+	return s, nil
+}
+
+func (s *AWSSecretsConfigSource) Name() string     { return ConfigSourceAWS }
+func (s *AWSSecretsConfigSource) Location() string { return "aws-secrets-manager:" + s.SecretID }
+
+// Load 读取 SecretString，密钥为空时视为空配置
+func (s *AWSSecretsConfigSource) Load() ([]AuthConfig, error) {
+	var resp struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := s.call("GetSecretValue", map[string]string{"SecretId": s.SecretID}, &resp); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(resp.SecretString) == "" {
+		return []AuthConfig{}, nil
+	}
+	configs, err := parseJSONConfig(resp.SecretString)
+	if err != nil {
+		return nil, fmt.Errorf("解析SecretString失败: %w", err)
+	}
+	return configs, nil
+}
+
+// Save 写入新的密钥版本（密钥需预先创建）
+func (s *AWSSecretsConfigSource) Save(configs []AuthConfig) error {
+	encoded, err := json.Marshal(configs)
+	if err != nil {
+		return fmt.Errorf("序列化认证配置失败: %w", err)
+	}
+	payload := map[string]string{
+		"SecretId":           s.SecretID,
+		"SecretString":       string(encoded),
+		"ClientRequestToken": utils.GenerateUUID(),
+	}
+	if err := s.call("PutSecretValue", payload, nil); err != nil {
+		return fmt.Errorf("写入Secrets Manager失败: %w", err)
+	}
+	return nil
+}
+
+// call 调用 Secrets Manager JSON API
+func (s *AWSSecretsConfigSource) call(action string, payload any, out any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://secretsmanager.%s.amazonaws.com", s.Region)
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager."+action)
+
+	now := time.Now
+	if s.now != nil {
+		now = s.now
+	}
+	signAWSRequest(req, body, s.Credentials, s.Region, "secretsmanager", now())
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		var awsErr struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+			Msg     string `json:"Message"`
+		}
+		_ = json.Unmarshal(respBody, &awsErr)
+		if awsErr.Message == "" {
+			awsErr.Message = awsErr.Msg
+		}
+		return fmt.Errorf("Secrets Manager %s 返回%d: %s %s", action, resp.StatusCode, awsErr.Type, awsErr.Message)
+	}
+	if out != nil {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return fmt.Errorf("解析Secrets Manager响应失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// signAWSRequest 使用 AWS Signature Version 4 签名请求（签名 Host 与请求上的全部头）
+func signAWSRequest(req *http.Request, body []byte, creds awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		headers[strings.ToLower(key)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
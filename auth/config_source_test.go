@@ -0,0 +1,265 @@
+package auth
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfigSource_Env(t *testing.T) {
+	t.Setenv("KIRO_CONFIG_SOURCE", "env")
+	t.Setenv("KIRO_AUTH_TOKEN", `[{"auth":"Social","refreshToken":"rt-1"},{"auth":"IdC","refreshToken":"rt-2"}]`)
+
+	configs, source, err := loadConfigSource()
+	require.NoError(t, err)
+	assert.Equal(t, ConfigSourceEnv, source.Name())
+	require.Len(t, configs, 1, "缺少clientId的IdC配置被跳过")
+	assert.NotEmpty(t, configs[0].ID)
+
+	as := NewAuthServiceWithSource(configs, source)
+	err = as.AddConfig(AuthConfig{RefreshToken: "rt-3"})
+	assert.ErrorIs(t, err, ErrConfigSourceReadOnly)
+	assert.Equal(t, 1, as.GetConfigCount(), "写回失败时不修改内存状态")
+	assert.Empty(t, as.ConfigFilePath())
+}
+
+func TestLoadConfigSource_Unknown(t *testing.T) {
+	t.Setenv("KIRO_CONFIG_SOURCE", "consul")
+	_, _, err := loadConfigSource()
+	assert.ErrorContains(t, err, "consul")
+
+	t.Setenv("KIRO_CONFIG_SOURCE", "vault")
+	t.Setenv("VAULT_ADDR", "")
+	_, _, err = loadConfigSource()
+	assert.ErrorContains(t, err, "VAULT_ADDR")
+}
+
+// fakeVault 模拟 Vault KV v2 与 Kubernetes 登录
+type fakeVault struct {
+	mu      sync.Mutex
+	token   string
+	version int
+	data    map[string]any
+	logins  int
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if r.URL.Path == "/v1/auth/kubernetes/login" {
+		var req map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req["role"] != "kiro2api" || req["jwt"] != "sa-jwt" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		v.logins++
+		_ = json.NewEncoder(w).Encode(map[string]any{"auth": map[string]string{"client_token": v.token}})
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != v.token {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = io.WriteString(w, `{"errors":["permission denied"]}`)
+		return
+	}
+	if r.URL.Path != "/v1/secret/data/kiro2api/auth" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if v.data == nil {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = io.WriteString(w, `{"errors":[]}`)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+			"data":     v.data,
+			"metadata": map[string]int{"version": v.version},
+		}})
+	case http.MethodPost:
+		var req struct {
+			Options struct {
+				CAS int `json:"cas"`
+			} `json:"options"`
+			Data map[string]any `json:"data"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Options.CAS != v.version {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"errors":["check-and-set parameter did not match the current version"]}`)
+			return
+		}
+		v.version++
+		v.data = req.Data
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": map[string]int{"version": v.version}})
+	}
+}
+
+func TestVaultConfigSource_KubernetesAuthRoundTrip(t *testing.T) {
+	vault := &fakeVault{
+		token:   "vault-token-1",
+		version: 3,
+		data: map[string]any{
+			"other":        "keep-me",
+			"auth_configs": `[{"id":"a","auth":"Social","refreshToken":"rt-a"}]`,
+		},
+	}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+
+	jwtFile := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(jwtFile, []byte("sa-jwt\n"), 0o600))
+
+	t.Setenv("VAULT_ADDR", server.URL+"/")
+	t.Setenv("VAULT_TOKEN", "")
+	t.Setenv("KIRO_VAULT_K8S_ROLE", "kiro2api")
+	t.Setenv("KIRO_VAULT_K8S_TOKEN_FILE", jwtFile)
+	source, err := NewVaultConfigSourceFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, "vault:secret/kiro2api/auth#auth_configs", source.Location())
+
+	configs, err := loadConfigsFromSource(source)
+	require.NoError(t, err)
+	require.Len(t, configs, 1)
+	assert.Equal(t, "a", configs[0].ID)
+
+	as := NewAuthServiceWithSource(configs, source)
+	require.NoError(t, as.AddConfig(AuthConfig{ID: "b", RefreshToken: "rt-b"}))
+	assert.Equal(t, 4, vault.version)
+	assert.Equal(t, "keep-me", vault.data["other"], "写回时保留密钥中的其他字段")
+	stored, _ := json.Marshal(vault.data["auth_configs"])
+	assert.Contains(t, string(stored), `"id":"b"`)
+
+	// token 失效后重新登录
+	vault.mu.Lock()
+	vault.token = "vault-token-2"
+	vault.mu.Unlock()
+	require.NoError(t, as.RemoveConfigByID("a"))
+	assert.Equal(t, 2, vault.logins)
+
+	// 其他实例写入后版本不一致，check-and-set 拒绝覆盖
+	vault.mu.Lock()
+	vault.version++
+	vault.mu.Unlock()
+	err = as.AddConfig(AuthConfig{RefreshToken: "rt-c"})
+	assert.ErrorContains(t, err, "check-and-set")
+	assert.Equal(t, 1, as.GetConfigCount())
+}
+
+func TestVaultConfigSource_MissingSecret(t *testing.T) {
+	vault := &fakeVault{token: "t"}
+	server := httptest.NewServer(vault)
+	defer server.Close()
+
+	source := &VaultConfigSource{Addr: server.URL, Token: "t", Mount: "secret", Path: "kiro2api/auth", Field: "auth_configs"}
+	configs, err := source.Load()
+	require.NoError(t, err)
+	assert.Empty(t, configs)
+
+	require.NoError(t, source.Save([]AuthConfig{{ID: "x", AuthType: AuthMethodSocial, RefreshToken: "rt"}}))
+	assert.Equal(t, 1, vault.version, "密钥不存在时以 cas=0 创建")
+
+	source.Token = "wrong"
+	source.token = ""
+	_, err = source.Load()
+	assert.ErrorContains(t, err, "permission denied")
+}
+
+func TestSignAWSRequest_Vector(t *testing.T) {
+	// AWS SigV4 测试套件 get-vanilla
+	req, err := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	require.NoError(t, err)
+	creds := awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signAWSRequest(req, nil, creds, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(t, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		req.Header.Get("Authorization"))
+}
+
+func TestAWSSecretsConfigSource_RequiresStaticCredentials(t *testing.T) {
+	t.Setenv("KIRO_AWS_SECRET_ID", "kiro2api/auth")
+	t.Setenv("AWS_REGION", "us-east-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	for _, env := range awsDelegatedCredentialEnvs {
+		t.Setenv(env, "")
+	}
+
+	_, err := NewAWSSecretsConfigSourceFromEnv()
+	assert.ErrorContains(t, err, "AWS_ACCESS_KEY_ID")
+
+	// IRSA 环境下未配置静态凭证时应指出不支持的凭证来源
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", "/var/run/secrets/eks.amazonaws.com/serviceaccount/token")
+	_, err = NewAWSSecretsConfigSourceFromEnv()
+	assert.ErrorContains(t, err, "AWS_WEB_IDENTITY_TOKEN_FILE")
+	assert.ErrorContains(t, err, "只支持静态凭证")
+}
+
+func TestAWSSecretsConfigSource_RoundTrip(t *testing.T) {
+	var mu sync.Mutex
+	secret := `[{"id":"a","auth":"Social","refreshToken":"rt-a"}]`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKID/") ||
+			r.Header.Get("X-Amz-Security-Token") != "session" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		var req map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req["SecretId"] != "kiro2api/auth" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = io.WriteString(w, `{"__type":"ResourceNotFoundException","Message":"Secrets Manager can't find the specified secret."}`)
+			return
+		}
+		switch r.Header.Get("X-Amz-Target") {
+		case "secretsmanager.GetSecretValue":
+			_ = json.NewEncoder(w).Encode(map[string]string{"SecretString": secret})
+		case "secretsmanager.PutSecretValue":
+			assert.NotEmpty(t, req["ClientRequestToken"])
+			secret = req["SecretString"]
+			_, _ = io.WriteString(w, `{}`)
+		}
+	}))
+	defer server.Close()
+
+	t.Setenv("KIRO_AWS_SECRET_ID", "kiro2api/auth")
+	t.Setenv("AWS_REGION", "")
+	t.Setenv("AWS_DEFAULT_REGION", "eu-west-1")
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "session")
+	t.Setenv("KIRO_AWS_SECRETS_ENDPOINT", server.URL)
+	source, err := NewAWSSecretsConfigSourceFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, "eu-west-1", source.Region)
+
+	configs, err := loadConfigsFromSource(source)
+	require.NoError(t, err)
+	require.Len(t, configs, 1)
+
+	as := NewAuthServiceWithSource(configs, source)
+	disabled := true
+	_, err = as.UpdateConfig("a", ConfigPatch{Disabled: &disabled})
+	require.NoError(t, err)
+	assert.Contains(t, secret, `"disabled":true`)
+
+	source.SecretID = "missing"
+	_, err = source.Load()
+	assert.ErrorContains(t, err, "ResourceNotFoundException")
+}
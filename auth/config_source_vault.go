@@ -0,0 +1,241 @@
+package auth
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultVaultK8sTokenFile Kubernetes 挂载的服务账号令牌
+const defaultVaultK8sTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// VaultConfigSource HashiCorp Vault KV v2 存储，配置保存在密钥的某个字段中
+// 认证使用 VAULT_TOKEN，或设置 K8sRole 时通过 Kubernetes 服务账号登录
+type VaultConfigSource struct {
+	Addr      string
+	Token     string
+	Namespace string
+	Mount     string // KV v2 挂载点，默认 secret
+	Path      string // 密钥路径，默认 kiro2api/auth
+	Field     string // 保存配置的字段，默认 auth_configs
+
+	K8sRole      string // Kubernetes 认证角色
+	K8sMount     string // Kubernetes 认证挂载点，默认 kubernetes
+	K8sTokenFile string // 服务账号令牌文件
+
+	Client *http.Client
+
+	mu      sync.Mutex
+	token   string                     // 当前使用的 Vault token（K8s 登录后获得）
+	version int                        // 最近读取/写入的版本，写入时作为 check-and-set 参数
+	data    map[string]json.RawMessage // 密钥中的其他字段，写回时保留
+}
+
+// NewVaultConfigSourceFromEnv 从环境变量创建 Vault 配置存储
+func NewVaultConfigSourceFromEnv() (*VaultConfigSource, error) {
+	s := &VaultConfigSource{
+		Addr:         strings.TrimRight(os.Getenv("VAULT_ADDR"), "/"),
+		Token:        os.Getenv("VAULT_TOKEN"),
+		Namespace:    os.Getenv("VAULT_NAMESPACE"),
+		Mount:        envOrDefault("KIRO_VAULT_MOUNT", "secret"),
+		Path:         envOrDefault("KIRO_VAULT_PATH", "kiro2api/auth"),
+		Field:        envOrDefault("KIRO_VAULT_FIELD", "auth_configs"),
+		K8sRole:      os.Getenv("KIRO_VAULT_K8S_ROLE"),
+		K8sMount:     envOrDefault("KIRO_VAULT_K8S_MOUNT", "kubernetes"),
+		K8sTokenFile: envOrDefault("KIRO_VAULT_K8S_TOKEN_FILE", defaultVaultK8sTokenFile),
+	}
+	if s.Addr == "" {
+		return nil, fmt.Errorf("KIRO_CONFIG_SOURCE=vault 需要设置 VAULT_ADDR")
+	}
+	if s.Token == "" && s.K8sRole == "" {
+		return nil, fmt.Errorf("KIRO_CONFIG_SOURCE=vault 需要设置 VAULT_TOKEN 或 KIRO_VAULT_K8S_ROLE")
+	}
+	return s, nil
+}
+
+func (s *VaultConfigSource) Name() string { return ConfigSourceVault }
+
+func (s *VaultConfigSource) Location() string {
+	return fmt.Sprintf("vault:%s/%s#%s", s.Mount, s.Path, s.Field)
+}
+
+func (s *VaultConfigSource) dataURL() string {
+	return fmt.Sprintf("%s/v1/%s/data/%s", s.Addr, strings.Trim(s.Mount, "/"), strings.Trim(s.Path, "/"))
+}
+
+// Load 读取密钥，字段值可以是JSON数组/对象，也可以是JSON字符串；密钥不存在时视为空配置
+func (s *VaultConfigSource) Load() ([]AuthConfig, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var resp struct {
+		Data struct {
+			Data     map[string]json.RawMessage `json:"data"`
+			Metadata struct {
+				Version int `json:"version"`
+			} `json:"metadata"`
+		} `json:"data"`
+	}
+	status, err := s.doLocked(http.MethodGet, s.dataURL(), nil, &resp)
+	if status == http.StatusNotFound {
+		s.version, s.data = 0, nil
+		return []AuthConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.version = resp.Data.Metadata.Version
+	s.data = resp.Data.Data
+	raw, ok := resp.Data.Data[s.Field]
+	if !ok || string(raw) == "null" {
+		return []AuthConfig{}, nil
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err == nil {
+		if strings.TrimSpace(text) == "" {
+			return []AuthConfig{}, nil
+		}
+		raw = json.RawMessage(text)
+	}
+	configs, err := parseJSONConfig(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("解析Vault字段%s失败: %w", s.Field, err)
+	}
+	return configs, nil
+}
+
+// Save 写入新版本，使用 check-and-set 防止覆盖其他实例的并发修改，保留密钥中的其他字段
+func (s *VaultConfigSource) Save(configs []AuthConfig) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	encoded, err := json.Marshal(configs)
+	if err != nil {
+		return fmt.Errorf("序列化认证配置失败: %w", err)
+	}
+	data := make(map[string]json.RawMessage, len(s.data)+1)
+	for k, v := range s.data {
+		data[k] = v
+	}
+	data[s.Field] = encoded
+
+	body := map[string]any{
+		"options": map[string]int{"cas": s.version},
+		"data":    data,
+	}
+	var resp struct {
+		Data struct {
+			Version int `json:"version"`
+		} `json:"data"`
+	}
+	if _, err := s.doLocked(http.MethodPost, s.dataURL(), body, &resp); err != nil {
+		return fmt.Errorf("写入Vault失败: %w", err)
+	}
+	s.version = resp.Data.Version
+	s.data = data
+	return nil
+}
+
+// doLocked 发送请求；使用 Kubernetes 认证时按需登录，token 失效（403）后重新登录一次
+func (s *VaultConfigSource) doLocked(method, url string, body any, out any) (int, error) {
+	if s.token == "" {
+		if err := s.loginLocked(); err != nil {
+			return 0, err
+		}
+	}
+	status, err := s.request(method, url, s.token, body, out)
+	if status == http.StatusForbidden && s.K8sRole != "" {
+		if err := s.loginLocked(); err != nil {
+			return 0, err
+		}
+		status, err = s.request(method, url, s.token, body, out)
+	}
+	return status, err
+}
+
+// loginLocked 获取 Vault token：优先使用静态 token，否则通过 Kubernetes 服务账号登录
+func (s *VaultConfigSource) loginLocked() error {
+	if s.K8sRole == "" {
+		s.token = s.Token
+		return nil
+	}
+	jwt, err := os.ReadFile(s.K8sTokenFile)
+	if err != nil {
+		return fmt.Errorf("读取Kubernetes服务账号令牌失败: %w", err)
+	}
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	url := fmt.Sprintf("%s/v1/auth/%s/login", s.Addr, strings.Trim(s.K8sMount, "/"))
+	payload := map[string]string{"role": s.K8sRole, "jwt": strings.TrimSpace(string(jwt))}
+	if _, err := s.request(http.MethodPost, url, "", payload, &resp); err != nil {
+		return fmt.Errorf("Vault Kubernetes登录失败: %w", err)
+	}
+	if resp.Auth.ClientToken == "" {
+		return fmt.Errorf("Vault Kubernetes登录未返回token")
+	}
+	s.token = resp.Auth.ClientToken
+	return nil
+}
+
+// request 发送 Vault API 请求，非 2xx 时返回 Vault 的错误信息
+func (s *VaultConfigSource) request(method, url, token string, body any, out any) (int, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return 0, err
+		}
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, url, reader)
+	if err != nil {
+		return 0, err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if s.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return resp.StatusCode, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.Unmarshal(respBody, &vaultErr)
+		return resp.StatusCode, fmt.Errorf("Vault返回%d: %s", resp.StatusCode, strings.Join(vaultErr.Errors, "; "))
+	}
+	if out != nil && len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, out); err != nil {
+			return resp.StatusCode, fmt.Errorf("解析Vault响应失败: %w", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Token事件类型
+const (
+	EventTokenRefreshFailed = "token_refresh_failed" // 刷新token失败（refresh token失效、网络错误等）
+	EventTokenQuarantined   = "token_quarantined"    // 上游返回 401/403，token移出轮换
+	EventQuotaExceeded      = "quota_exceeded"       // 上游返回 429 或查询到的剩余额度为0
+	EventAllTokensExhausted = "all_tokens_exhausted" // 没有可用token，请求无法处理
+)
+
+// TokenEvent token状态变化事件
+type TokenEvent struct {
+	Type     string    `json:"type"`
+	ConfigID string    `json:"config_id,omitempty"`
+	Label    string    `json:"label,omitempty"`
+	Status   int       `json:"status,omitempty"` // 上游HTTP状态码
+	Model    string    `json:"model,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
+}
+
+// tokenEventHandler 事件处理函数，未设置时丢弃事件
+var tokenEventHandler atomic.Pointer[func(TokenEvent)]
+
+// SetTokenEventHandler 设置token事件处理函数，传入 nil 取消
+// 事件可能在持有 TokenManager 锁时发出，处理函数必须非阻塞且不能回调 AuthService
+func SetTokenEventHandler(handler func(TokenEvent)) {
+	if handler == nil {
+		tokenEventHandler.Store(nil)
+		return
+	}
+	tokenEventHandler.Store(&handler)
+}
+
+// emitTokenEvent 发出token事件
+func emitTokenEvent(event TokenEvent) {
+	handler := tokenEventHandler.Load()
+	if handler == nil {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+	(*handler)(event)
+}
+
+// emitQuotaIfExhausted 查询到的剩余额度为0时发出 quota_exceeded 事件
+func emitQuotaIfExhausted(cfg AuthConfig, available float64) {
+	if available > 0 {
+		return
+	}
+	emitTokenEvent(TokenEvent{Type: EventQuotaExceeded, ConfigID: cfg.ID, Label: cfg.Label})
+}
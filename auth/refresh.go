@@ -2,29 +2,74 @@ package auth
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"kiro2api/config"
+	"kiro2api/tracing"
 	"kiro2api/types"
 	"kiro2api/utils"
 	"net/http"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
-// refreshSingleToken 刷新单个token
+// refreshSingleToken 刷新单个token，失败时发出 token_refresh_failed 事件
+// 上游轮换了refresh token时通知所属的 AuthService 更新并持久化配置
+// （异步进行：调用方可能持有 tm.mutex，而更新配置需要重新获取该锁）
 func (tm *TokenManager) refreshSingleToken(authConfig AuthConfig) (types.TokenInfo, error) {
+	token, err := refreshConfigToken(authConfig)
+	if err != nil {
+		emitTokenEvent(TokenEvent{
+			Type:     EventTokenRefreshFailed,
+			ConfigID: authConfig.ID,
+			Label:    authConfig.Label,
+			Error:    err.Error(),
+		})
+		return token, err
+	}
+	if tm.onRefreshTokenRotated != nil && refreshTokenRotated(authConfig, token) {
+		go tm.onRefreshTokenRotated(authConfig, token)
+	}
+	return token, nil
+}
+
+// refreshTokenRotated 刷新结果是否携带了与配置不同的新refresh token
+func refreshTokenRotated(authConfig AuthConfig, token types.TokenInfo) bool {
+	return token.RefreshToken != "" && token.RefreshToken != authConfig.RefreshToken
+}
+
+// refreshConfigToken 按认证类型刷新token，刷新请求经配置的出站代理发出
+// 返回的token携带配置ID与代理地址，后续推理与使用限制查询沿用同一代理
+func refreshConfigToken(authConfig AuthConfig) (types.TokenInfo, error) {
+	ctx, span := tracing.Start(context.Background(), "token.refresh",
+		attribute.String("auth.config_id", authConfig.ID),
+		attribute.String("auth.type", authConfig.AuthType))
+
+	var (
+		token types.TokenInfo
+		err   error
+	)
 	switch authConfig.AuthType {
 	case AuthMethodSocial:
-		return refreshSocialToken(authConfig.RefreshToken)
+		token, err = refreshSocialToken(ctx, authConfig.RefreshToken, authConfig.ProxyURL)
 	case AuthMethodIdC:
-		return refreshIdCToken(authConfig)
+		token, err = refreshIdCToken(ctx, authConfig)
 	default:
-		return types.TokenInfo{}, fmt.Errorf("不支持的认证类型: %s", authConfig.AuthType)
+		err = fmt.Errorf("不支持的认证类型: %s", authConfig.AuthType)
+	}
+	tracing.End(span, err)
+	if err != nil {
+		return types.TokenInfo{}, err
 	}
+	token.ConfigID = authConfig.ID
+	token.ProxyURL = authConfig.ProxyURL
+	return token, nil
 }
 
 // refreshSocialToken 刷新Social认证token
-func refreshSocialToken(refreshToken string) (types.TokenInfo, error) {
+func refreshSocialToken(ctx context.Context, refreshToken, proxyURL string) (types.TokenInfo, error) {
 	refreshReq := types.RefreshRequest{
 		RefreshToken: refreshToken,
 	}
@@ -34,15 +79,14 @@ func refreshSocialToken(refreshToken string) (types.TokenInfo, error) {
 		return types.TokenInfo{}, fmt.Errorf("序列化请求失败: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", config.RefreshTokenURL, bytes.NewBuffer(reqBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", config.RefreshTokenURL, bytes.NewBuffer(reqBody))
 	if err != nil {
 		return types.TokenInfo{}, fmt.Errorf("创建请求失败: %v", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
 
-	client := utils.SharedHTTPClient
-	resp, err := client.Do(req)
+	resp, err := utils.DoRequestViaProxy(req, proxyURL)
 	if err != nil {
 		return types.TokenInfo{}, fmt.Errorf("请求失败: %v", err)
 	}
@@ -54,12 +98,7 @@ func refreshSocialToken(refreshToken string) (types.TokenInfo, error) {
 	}
 
 	var refreshResp types.RefreshResponse
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return types.TokenInfo{}, fmt.Errorf("读取响应失败: %v", err)
-	}
-
-	if err := utils.SafeUnmarshal(body, &refreshResp); err != nil {
+	if err := utils.DecodeFrom(resp.Body, &refreshResp); err != nil {
 		return types.TokenInfo{}, fmt.Errorf("解析响应失败: %v", err)
 	}
 
@@ -70,7 +109,7 @@ func refreshSocialToken(refreshToken string) (types.TokenInfo, error) {
 }
 
 // refreshIdCToken 刷新IdC认证token
-func refreshIdCToken(authConfig AuthConfig) (types.TokenInfo, error) {
+func refreshIdCToken(ctx context.Context, authConfig AuthConfig) (types.TokenInfo, error) {
 	refreshReq := types.IdcRefreshRequest{
 		ClientId:     authConfig.ClientID,
 		ClientSecret: authConfig.ClientSecret,
@@ -83,7 +122,7 @@ func refreshIdCToken(authConfig AuthConfig) (types.TokenInfo, error) {
 		return types.TokenInfo{}, fmt.Errorf("序列化IdC请求失败: %v", err)
 	}
 
-	req, err := http.NewRequest("POST", config.IdcRefreshTokenURL, bytes.NewBuffer(reqBody))
+	req, err := http.NewRequestWithContext(ctx, "POST", config.IdcRefreshTokenURL, bytes.NewBuffer(reqBody))
 	if err != nil {
 		return types.TokenInfo{}, fmt.Errorf("创建IdC请求失败: %v", err)
 	}
@@ -99,8 +138,7 @@ func refreshIdCToken(authConfig AuthConfig) (types.TokenInfo, error) {
 	req.Header.Set("User-Agent", "node")
 	req.Header.Set("Accept-Encoding", "br, gzip, deflate")
 
-	client := utils.SharedHTTPClient
-	resp, err := client.Do(req)
+	resp, err := utils.DoRequestViaProxy(req, authConfig.ProxyURL)
 	if err != nil {
 		return types.TokenInfo{}, fmt.Errorf("IdC请求失败: %v", err)
 	}
@@ -112,30 +150,33 @@ func refreshIdCToken(authConfig AuthConfig) (types.TokenInfo, error) {
 	}
 
 	var refreshResp types.RefreshResponse
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return types.TokenInfo{}, fmt.Errorf("读取IdC响应失败: %v", err)
-	}
-
-	if err := utils.SafeUnmarshal(body, &refreshResp); err != nil {
+	if err := utils.DecodeFrom(resp.Body, &refreshResp); err != nil {
 		return types.TokenInfo{}, fmt.Errorf("解析IdC响应失败: %v", err)
 	}
 
 	var token types.Token
 	token.AccessToken = refreshResp.AccessToken
 	token.RefreshToken = authConfig.RefreshToken
+	if refreshResp.RefreshToken != "" {
+		token.RefreshToken = refreshResp.RefreshToken
+	}
 	token.ExpiresIn = refreshResp.ExpiresIn
 	token.ExpiresAt = time.Now().Add(time.Duration(refreshResp.ExpiresIn) * time.Second)
 
 	return token, nil
 }
 
-// RefreshSocialToken 公开的Social token刷新函数
+// RefreshSocialToken 公开的Social token刷新函数（直连，不使用代理）
 func RefreshSocialToken(refreshToken string) (types.TokenInfo, error) {
-	return refreshSocialToken(refreshToken)
+	return refreshSocialToken(context.Background(), refreshToken, "")
+}
+
+// RefreshConfigToken 公开的按配置刷新函数（使用配置的出站代理）
+func RefreshConfigToken(authConfig AuthConfig) (types.TokenInfo, error) {
+	return refreshConfigToken(authConfig)
 }
 
 // RefreshIdCToken 公开的IdC token刷新函数
 func RefreshIdCToken(authConfig AuthConfig) (types.TokenInfo, error) {
-	return refreshIdCToken(authConfig)
+	return refreshIdCToken(context.Background(), authConfig)
 }
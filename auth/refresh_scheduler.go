@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"kiro2api/config"
+	"kiro2api/logger"
+	"kiro2api/utils"
+)
+
+// RefreshSchedule token主动刷新的时间参数
+type RefreshSchedule struct {
+	Margin time.Duration // 在token过期（或缓存到期）前多久刷新
+	Jitter time.Duration // 每个账号额外随机提前的最大时长，错开各账号的刷新时间
+}
+
+// LoadRefreshScheduleFromEnv 从环境变量加载token主动刷新配置
+// - TOKEN_REFRESH_MARGIN_SECONDS: 到期前多久主动刷新（默认0，关闭）
+// - TOKEN_REFRESH_JITTER_SECONDS: 随机提前的最大秒数（默认30）
+func LoadRefreshScheduleFromEnv() (RefreshSchedule, error) {
+	margin := utils.GetEnvIntWithDefault("TOKEN_REFRESH_MARGIN_SECONDS", 0)
+	jitter := utils.GetEnvIntWithDefault("TOKEN_REFRESH_JITTER_SECONDS", 30)
+	if margin < 0 || jitter < 0 {
+		return RefreshSchedule{}, fmt.Errorf("TOKEN_REFRESH_MARGIN_SECONDS 与 TOKEN_REFRESH_JITTER_SECONDS 不能为负数")
+	}
+	schedule := RefreshSchedule{
+		Margin: time.Duration(margin) * time.Second,
+		Jitter: time.Duration(jitter) * time.Second,
+	}
+	if schedule.Enabled() && schedule.Margin+schedule.Jitter >= config.TokenCacheTTL {
+		return RefreshSchedule{}, fmt.Errorf("TOKEN_REFRESH_MARGIN_SECONDS 与 TOKEN_REFRESH_JITTER_SECONDS 之和必须小于token缓存周期 %s", config.TokenCacheTTL)
+	}
+	return schedule, nil
+}
+
+// Enabled 是否启用主动刷新
+func (s RefreshSchedule) Enabled() bool {
+	return s.Margin > 0
+}
+
+// RefreshScheduler 后台按到期时间逐个刷新token，避免请求在token过期后同步等待刷新
+type RefreshScheduler struct {
+	tm       *TokenManager
+	schedule RefreshSchedule
+	jitter   func(max time.Duration) time.Duration
+	due      map[string]scheduledRefresh // 按cache key记录计划刷新时间，仅由调度协程访问
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// scheduledRefresh 为某个缓存条目计划的刷新时间（缓存条目被替换后重新计算）
+type scheduledRefresh struct {
+	entry *CachedToken
+	at    time.Time
+}
+
+// StartRefreshScheduler 启动token主动刷新
+// 启用后非懒加载模式不再在请求路径上整体刷新token池（时钟跳变等整体失效的情况除外）
+func (as *AuthService) StartRefreshScheduler(schedule RefreshSchedule) *RefreshScheduler {
+	tm := as.GetTokenManager()
+	tm.mutex.Lock()
+	tm.scheduled = true
+	tm.mutex.Unlock()
+
+	s := newRefreshScheduler(tm, schedule)
+	go s.loop()
+	return s
+}
+
+func newRefreshScheduler(tm *TokenManager, schedule RefreshSchedule) *RefreshScheduler {
+	return &RefreshScheduler{
+		tm:       tm,
+		schedule: schedule,
+		jitter: func(max time.Duration) time.Duration {
+			if max <= 0 {
+				return 0
+			}
+			return rand.N(max)
+		},
+		due:  make(map[string]scheduledRefresh),
+		stop: make(chan struct{}),
+	}
+}
+
+// Stop 停止后台刷新
+func (s *RefreshScheduler) Stop() {
+	s.stopOnce.Do(func() { close(s.stop) })
+}
+
+func (s *RefreshScheduler) loop() {
+	ticker := time.NewTicker(config.TokenRefreshCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.refreshDue(time.Now())
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// refreshDue 依次刷新已到计划时间的账号，同一账号与按需刷新的并发刷新通过 singleflight 合并
+func (s *RefreshScheduler) refreshDue(now time.Time) {
+	for _, target := range s.dueTargets(now) {
+		_, err, _ := s.tm.refreshGroup.Do(target.key, func() (any, error) {
+			return nil, s.tm.refreshScheduledToken(target.key, target.cfg)
+		})
+		if err != nil {
+			logger.Warn("主动刷新token失败，保留当前token直到过期",
+				logger.String("cache_key", target.key),
+				logger.String("config_id", target.cfg.ID),
+				logger.Err(err))
+		}
+	}
+}
+
+type refreshTarget struct {
+	key string
+	cfg AuthConfig
+}
+
+// dueTargets 找出需要刷新的账号
+// - 已缓存的token：在访问令牌过期与缓存到期中较早者之前 Margin+随机抖动 时刷新
+// - 未缓存的账号（仅非懒加载模式）：立即刷新，失败后在缓存周期内不再重试
+func (s *RefreshScheduler) dueTargets(now time.Time) []refreshTarget {
+	tm := s.tm
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+
+	var targets []refreshTarget
+	seen := make(map[string]bool, len(tm.configs))
+	for i, cfg := range tm.configs {
+		if cfg.Disabled {
+			continue
+		}
+		key := fmt.Sprintf(config.TokenCacheKeyFormat, i)
+		seen[key] = true
+
+		cached, exists := tm.cache.tokens[key]
+		if !exists {
+			if failedAt, failed := tm.lazyFailures[key]; tm.lazy || (failed && now.Sub(failedAt) <= tm.cache.ttl) {
+				continue
+			}
+			targets = append(targets, refreshTarget{key: key, cfg: cfg})
+			continue
+		}
+
+		plan, ok := s.due[key]
+		if !ok || plan.entry != cached {
+			deadline := cached.CachedAt.Add(tm.cache.ttl)
+			if expiry := cached.Token.ExpiresAt.Add(-config.TokenExpirySkew); expiry.Before(deadline) {
+				deadline = expiry
+			}
+			plan = scheduledRefresh{entry: cached, at: deadline.Add(-s.schedule.Margin - s.jitter(s.schedule.Jitter))}
+			s.due[key] = plan
+		}
+		if !now.Before(plan.at) {
+			if failedAt, failed := tm.lazyFailures[key]; failed && now.Sub(failedAt) < config.TokenRefreshRetryInterval {
+				continue // 刷新失败后间隔一段时间再重试
+			}
+			targets = append(targets, refreshTarget{key: key, cfg: cfg})
+		}
+	}
+	for key := range s.due {
+		if !seen[key] {
+			delete(s.due, key)
+		}
+	}
+	return targets
+}
@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"errors"
+	"reflect"
+
+	"kiro2api/logger"
+)
+
+// ErrReadOnly 只读副本不允许修改认证配置
+var ErrReadOnly = errors.New("只读副本不允许修改认证配置")
+
+// SetReadOnly 设置只读模式：只读时拒绝所有配置变更，配置由 ReloadFromFile 从共享配置存储同步
+func (as *AuthService) SetReadOnly(readOnly bool) {
+	as.updateMu.Lock()
+	defer as.updateMu.Unlock()
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.readOnly = readOnly
+}
+
+// ReadOnly 是否为只读模式
+func (as *AuthService) ReadOnly() bool {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	return as.readOnly
+}
+
+// ReloadFromFile 从共享配置存储（文件、Vault 等）重新加载配置（不回写），配置有变化时重建TokenManager
+// 用于只读副本跟随主实例的配置变更，返回配置是否发生变化
+func (as *AuthService) ReloadFromFile() (bool, error) {
+	source := as.source
+	configs, err := source.Load()
+	if err != nil {
+		return false, err
+	}
+	// 主实例会持久化ID；此处仅在内存中补齐，避免副本写共享存储
+	assignConfigIDs(configs)
+	configs = processConfigs(configs)
+
+	as.updateMu.Lock()
+	defer as.updateMu.Unlock()
+	if current, _ := as.snapshot(); reflect.DeepEqual(configs, current) {
+		return false, nil
+	}
+	as.commit(configs, as.newTokenManager(configs))
+
+	logger.Info("已从共享配置存储重新加载认证配置",
+		logger.Int("config_count", len(configs)),
+		logger.String("config_source", source.Location()))
+	return true, nil
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnly_RejectsMutations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth_config.json")
+	as := NewAuthServiceWithConfigs([]AuthConfig{{ID: "a", AuthType: AuthMethodSocial, RefreshToken: "a"}}, path)
+	as.SetReadOnly(true)
+	assert.True(t, as.ReadOnly())
+
+	assert.ErrorIs(t, as.AddConfig(AuthConfig{RefreshToken: "b"}), ErrReadOnly)
+	assert.ErrorIs(t, as.RemoveConfigByID("a"), ErrReadOnly)
+	disabled := true
+	_, err := as.UpdateConfig("a", ConfigPatch{Disabled: &disabled})
+	assert.ErrorIs(t, err, ErrReadOnly)
+	_, err = as.Import([]AuthConfig{{RefreshToken: "c"}})
+	assert.ErrorIs(t, err, ErrReadOnly)
+
+	assert.Equal(t, 1, as.GetConfigCount())
+	assert.NoFileExists(t, path)
+}
+
+func TestReloadFromFile_FollowsSharedConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth_config.json")
+	require.NoError(t, SaveConfigsToFile(path, []AuthConfig{{ID: "a", AuthType: AuthMethodSocial, RefreshToken: "a"}}))
+
+	replica := NewAuthServiceWithConfigs(nil, path)
+	replica.SetReadOnly(true)
+
+	changed, err := replica.ReloadFromFile()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, "a", replica.GetConfigs()[0].ID)
+
+	// 配置未变化时不重建
+	changed, err = replica.ReloadFromFile()
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	// 主实例写入新配置后副本跟随
+	require.NoError(t, SaveConfigsToFile(path, []AuthConfig{
+		{ID: "a", AuthType: AuthMethodSocial, RefreshToken: "a", Disabled: true},
+		{ID: "b", AuthType: AuthMethodSocial, RefreshToken: "b", Label: "new"},
+	}))
+	changed, err = replica.ReloadFromFile()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, 2, replica.GetConfigCount())
+	assert.True(t, replica.GetConfigs()[0].Disabled)
+}
@@ -0,0 +1,243 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"time"
+
+	"kiro2api/config"
+)
+
+// SnapshotFormatVersion 快照格式版本，外部备份工具据此判断兼容性
+const SnapshotFormatVersion = 1
+
+// SnapshotEncryptionAlgorithm 快照密钥字段的加密算法标识
+// 随机生成 AES-256-GCM 数据密钥加密各密钥字段，再用 RSA-OAEP(SHA-256) 包裹数据密钥
+const SnapshotEncryptionAlgorithm = "RSA-OAEP-256+A256GCM"
+
+// 快照中密钥字段的处理方式
+const (
+	SnapshotSecretsOmit    = "omit"    // 不包含密钥字段（默认）
+	SnapshotSecretsPlain   = "plain"   // 明文包含密钥字段
+	SnapshotSecretsEncrypt = "encrypt" // 使用调用方公钥加密密钥字段
+)
+
+// SnapshotOptions 快照生成选项
+type SnapshotOptions struct {
+	Secrets   string         // omit/plain/encrypt
+	PublicKey *rsa.PublicKey // Secrets=encrypt 时必需
+}
+
+// PoolSnapshot Token池的时间点快照（面向外部备份系统）
+type PoolSnapshot struct {
+	Version     int                 `json:"version"`
+	GeneratedAt time.Time           `json:"generated_at"`
+	ConfigFile  string              `json:"config_file,omitempty"`
+	Secrets     string              `json:"secrets"`
+	Encryption  *SnapshotEncryption `json:"encryption,omitempty"`
+	Checksum    string              `json:"checksum"` // accounts 字段的 SHA-256，用于校验完整性
+	Accounts    []SnapshotAccount   `json:"accounts"`
+}
+
+// SnapshotEncryption 加密元数据
+type SnapshotEncryption struct {
+	Algorithm    string `json:"algorithm"`
+	EncryptedKey string `json:"encrypted_key"` // base64(RSA-OAEP(dataKey))
+}
+
+// SnapshotAccount 单个账号的配置与运行时状态
+type SnapshotAccount struct {
+	Index        int              `json:"index"`
+	ID           string           `json:"id"`
+	AuthType     string           `json:"auth"`
+	RefreshToken string           `json:"refreshToken,omitempty"`
+	ClientID     string           `json:"clientId,omitempty"`
+	ClientSecret string           `json:"clientSecret,omitempty"`
+	Disabled     bool             `json:"disabled,omitempty"`
+	Label        string           `json:"label,omitempty"`
+	Tags         []string         `json:"tags,omitempty"`
+	Note         string           `json:"note,omitempty"`
+	TokenHash    string           `json:"token_hash"` // refreshToken 的 SHA-256 前缀，便于去重比对
+	Runtime      *SnapshotRuntime `json:"runtime,omitempty"`
+}
+
+// SnapshotRuntime 账号运行时元数据（来自TokenManager缓存）
+type SnapshotRuntime struct {
+	CachedAt  time.Time `json:"cached_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	LastUsed  time.Time `json:"last_used,omitempty"`
+	Available float64   `json:"available"`
+	Exhausted bool      `json:"exhausted"`
+}
+
+// ParseSnapshotPublicKey 解析PEM格式的RSA公钥（支持PKIX与PKCS#1）
+func ParseSnapshotPublicKey(pemData []byte) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, fmt.Errorf("无效的PEM公钥")
+	}
+
+	if pub, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		rsaPub, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("仅支持RSA公钥")
+		}
+		return rsaPub, nil
+	}
+
+	pub, err := x509.ParsePKCS1PublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析RSA公钥失败: %w", err)
+	}
+	return pub, nil
+}
+
+// Snapshot 在TokenManager锁保护下生成Token池的一致性快照
+func (as *AuthService) Snapshot(opts SnapshotOptions) (*PoolSnapshot, error) {
+	if opts.Secrets == "" {
+		opts.Secrets = SnapshotSecretsOmit
+	}
+
+	var sealer *secretSealer
+	switch opts.Secrets {
+	case SnapshotSecretsOmit, SnapshotSecretsPlain:
+	case SnapshotSecretsEncrypt:
+		if opts.PublicKey == nil {
+			return nil, fmt.Errorf("加密快照需要提供公钥")
+		}
+		s, err := newSecretSealer(opts.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		sealer = s
+	default:
+		return nil, fmt.Errorf("无效的secrets选项: %s", opts.Secrets)
+	}
+
+	tm := as.GetTokenManager()
+	tm.mutex.RLock()
+	accounts := make([]SnapshotAccount, 0, len(tm.configs))
+	for i, cfg := range tm.configs {
+		account := SnapshotAccount{
+			Index:     i,
+			ID:        cfg.ID,
+			AuthType:  cfg.AuthType,
+			ClientID:  cfg.ClientID,
+			Disabled:  cfg.Disabled,
+			Label:     cfg.Label,
+			Tags:      cfg.Tags,
+			Note:      cfg.Note,
+			TokenHash: refreshTokenHash(cfg.RefreshToken),
+		}
+
+		cacheKey := fmt.Sprintf(config.TokenCacheKeyFormat, i)
+		if cached, ok := tm.cache.tokens[cacheKey]; ok {
+			account.Runtime = &SnapshotRuntime{
+				CachedAt:  cached.CachedAt,
+				ExpiresAt: cached.Token.ExpiresAt,
+				LastUsed:  cached.LastUsed,
+				Available: cached.Available,
+				Exhausted: tm.exhausted[cacheKey],
+			}
+		}
+
+		switch opts.Secrets {
+		case SnapshotSecretsPlain:
+			account.RefreshToken = cfg.RefreshToken
+			account.ClientSecret = cfg.ClientSecret
+		case SnapshotSecretsEncrypt:
+			account.RefreshToken = sealer.seal(cfg.RefreshToken)
+			account.ClientSecret = sealer.seal(cfg.ClientSecret)
+		}
+
+		accounts = append(accounts, account)
+	}
+	tm.mutex.RUnlock()
+
+	if sealer != nil && sealer.err != nil {
+		return nil, sealer.err
+	}
+
+	accountsJSON, err := json.Marshal(accounts)
+	if err != nil {
+		return nil, fmt.Errorf("序列化快照失败: %w", err)
+	}
+	sum := sha256.Sum256(accountsJSON)
+
+	snapshot := &PoolSnapshot{
+		Version:     SnapshotFormatVersion,
+		GeneratedAt: time.Now().UTC(),
+		ConfigFile:  as.source.Location(),
+		Secrets:     opts.Secrets,
+		Checksum:    hex.EncodeToString(sum[:]),
+		Accounts:    accounts,
+	}
+	if sealer != nil {
+		snapshot.Encryption = &SnapshotEncryption{
+			Algorithm:    SnapshotEncryptionAlgorithm,
+			EncryptedKey: base64.StdEncoding.EncodeToString(sealer.wrappedKey),
+		}
+	}
+
+	return snapshot, nil
+}
+
+// refreshTokenHash 计算refreshToken的短哈希（不可逆，用于标识与去重）
+func refreshTokenHash(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// secretSealer 使用一次性数据密钥加密快照中的密钥字段
+type secretSealer struct {
+	aead       cipher.AEAD
+	wrappedKey []byte
+	err        error // 记录第一次加密失败，避免在持锁循环中处理错误
+}
+
+// newSecretSealer 生成数据密钥并用公钥包裹
+func newSecretSealer(pub *rsa.PublicKey) (*secretSealer, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("生成数据密钥失败: %w", err)
+	}
+
+	wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, pub, dataKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("公钥加密数据密钥失败: %w", err)
+	}
+
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("初始化AES失败: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("初始化GCM失败: %w", err)
+	}
+
+	return &secretSealer{aead: aead, wrappedKey: wrapped}, nil
+}
+
+// seal 加密单个字段，输出 base64(nonce||ciphertext)；空值保持为空
+func (s *secretSealer) seal(plaintext string) string {
+	if plaintext == "" || s.err != nil {
+		return ""
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		s.err = fmt.Errorf("生成nonce失败: %w", err)
+		return ""
+	}
+	sealed := s.aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.StdEncoding.EncodeToString(sealed)
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"testing"
+	"time"
+
+	"kiro2api/config"
+	"kiro2api/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSnapshotTestService() *AuthService {
+	configs := []AuthConfig{
+		{AuthType: AuthMethodSocial, RefreshToken: "social_refresh"},
+		{AuthType: AuthMethodIdC, RefreshToken: "idc_refresh", ClientID: "cid", ClientSecret: "csecret"},
+	}
+	tm := NewTokenManager(configs)
+	tm.cache.tokens[fmt.Sprintf(config.TokenCacheKeyFormat, 0)] = &CachedToken{
+		Token:     types.TokenInfo{AccessToken: "access", ExpiresAt: time.Now().Add(time.Hour)},
+		CachedAt:  time.Now(),
+		Available: 42,
+	}
+	return &AuthService{tokenManager: tm, configs: configs, source: NewFileConfigSource("auth_config.json")}
+}
+
+func TestSnapshot_OmitSecretsByDefault(t *testing.T) {
+	as := newSnapshotTestService()
+
+	snap, err := as.Snapshot(SnapshotOptions{})
+	require.NoError(t, err)
+
+	assert.Equal(t, SnapshotFormatVersion, snap.Version)
+	assert.Equal(t, SnapshotSecretsOmit, snap.Secrets)
+	require.Len(t, snap.Accounts, 2)
+	assert.Empty(t, snap.Accounts[0].RefreshToken)
+	assert.Empty(t, snap.Accounts[1].ClientSecret)
+	assert.Equal(t, "cid", snap.Accounts[1].ClientID)
+	assert.NotEmpty(t, snap.Accounts[0].TokenHash)
+	assert.NotEmpty(t, snap.Checksum)
+
+	require.NotNil(t, snap.Accounts[0].Runtime)
+	assert.Equal(t, 42.0, snap.Accounts[0].Runtime.Available)
+	assert.Nil(t, snap.Accounts[1].Runtime)
+}
+
+func TestSnapshot_PlainSecrets(t *testing.T) {
+	as := newSnapshotTestService()
+
+	snap, err := as.Snapshot(SnapshotOptions{Secrets: SnapshotSecretsPlain})
+	require.NoError(t, err)
+	assert.Equal(t, "social_refresh", snap.Accounts[0].RefreshToken)
+	assert.Equal(t, "csecret", snap.Accounts[1].ClientSecret)
+}
+
+func TestSnapshot_EncryptedSecrets(t *testing.T) {
+	as := newSnapshotTestService()
+
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&priv.PublicKey)
+	require.NoError(t, err)
+	pub, err := ParseSnapshotPublicKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	require.NoError(t, err)
+
+	snap, err := as.Snapshot(SnapshotOptions{Secrets: SnapshotSecretsEncrypt, PublicKey: pub})
+	require.NoError(t, err)
+	require.NotNil(t, snap.Encryption)
+	assert.Equal(t, SnapshotEncryptionAlgorithm, snap.Encryption.Algorithm)
+
+	wrapped, err := base64.StdEncoding.DecodeString(snap.Encryption.EncryptedKey)
+	require.NoError(t, err)
+	dataKey, err := rsa.DecryptOAEP(sha256.New(), rand.Reader, priv, wrapped, nil)
+	require.NoError(t, err)
+
+	block, err := aes.NewCipher(dataKey)
+	require.NoError(t, err)
+	aead, err := cipher.NewGCM(block)
+	require.NoError(t, err)
+
+	sealed, err := base64.StdEncoding.DecodeString(snap.Accounts[1].ClientSecret)
+	require.NoError(t, err)
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "csecret", string(plain))
+}
+
+func TestSnapshot_EncryptRequiresKey(t *testing.T) {
+	as := newSnapshotTestService()
+
+	_, err := as.Snapshot(SnapshotOptions{Secrets: SnapshotSecretsEncrypt})
+	assert.Error(t, err)
+
+	_, err = as.Snapshot(SnapshotOptions{Secrets: "bogus"})
+	assert.Error(t, err)
+}
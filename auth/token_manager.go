@@ -1,23 +1,47 @@
 package auth
 
 import (
+	"errors"
 	"fmt"
 	"kiro2api/config"
 	"kiro2api/logger"
 	"kiro2api/types"
+	"kiro2api/utils"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
 	"sync"
 	"time"
+
+	"golang.org/x/sync/singleflight"
 )
 
+// ErrTokenPoolExhausted 所有token均已耗尽或不可用
+var ErrTokenPoolExhausted = errors.New("没有可用的token")
+
+// ErrNoEligibleToken 没有任何启用的账号支持请求的模型（配置问题，而非额度耗尽）
+var ErrNoEligibleToken = errors.New("没有支持该模型的账号")
+
 // TokenManager 简化的token管理器
 type TokenManager struct {
-	cache        *SimpleTokenCache
-	configs      []AuthConfig
-	mutex        sync.RWMutex
-	lastRefresh  time.Time
-	configOrder  []string        // 配置顺序
-	currentIndex int             // 当前使用的token索引
-	exhausted    map[string]bool // 已耗尽的token记录
+	cache         *SimpleTokenCache
+	configs       []AuthConfig
+	mutex         sync.RWMutex
+	lastRefresh   time.Time
+	configOrder   []string        // 配置顺序
+	currentIndex  int             // 当前使用的token索引
+	exhausted     map[string]bool // 已耗尽的token记录
+	tagPreference []string        // 标签优先级（如 primary,backup），为空时按配置顺序
+
+	// 懒加载模式（LAZY_WARMUP）：不预热、不整体刷新，首次选中某账号时才刷新该账号
+	lazy         bool
+	refreshGroup singleflight.Group   // 同一账号的并发刷新合并为一次
+	lazyFailures map[string]time.Time // 刷新失败或被上游拒绝的账号，缓存周期内不再按需刷新
+
+	scheduled bool // 已启用主动刷新（RefreshScheduler），各账号在到期前由后台刷新
+
+	onRefreshTokenRotated func(AuthConfig, types.TokenInfo) // 上游轮换refresh token时的回调（由 AuthService 设置）
 }
 
 // SimpleTokenCache 简化的token缓存（纯数据结构，无锁）
@@ -47,38 +71,68 @@ func NewSimpleTokenCache(ttl time.Duration) *SimpleTokenCache {
 // NewTokenManager 创建新的token管理器
 func NewTokenManager(configs []AuthConfig) *TokenManager {
 	// 生成配置顺序
-	configOrder := generateConfigOrder(configs)
+	tagPreference := parseTagPreference(os.Getenv("TOKEN_TAG_PREFERENCE"))
+	configOrder := generateConfigOrder(configs, tagPreference)
 
 	logger.Info("TokenManager初始化（顺序选择策略）",
 		logger.Int("config_count", len(configs)),
-		logger.Int("config_order_count", len(configOrder)))
+		logger.Int("config_order_count", len(configOrder)),
+		logger.Any("tag_preference", tagPreference))
 
 	return &TokenManager{
-		cache:        NewSimpleTokenCache(config.TokenCacheTTL),
-		configs:      configs,
-		configOrder:  configOrder,
-		currentIndex: 0,
-		exhausted:    make(map[string]bool),
+		cache:         NewSimpleTokenCache(config.TokenCacheTTL),
+		configs:       slices.Clone(configs), // 不与调用方共享底层数组，AddConfig 追加时不影响调用方的切片
+		configOrder:   configOrder,
+		currentIndex:  0,
+		exhausted:     make(map[string]bool),
+		tagPreference: tagPreference,
+		lazy:          utils.GetEnvBool("LAZY_WARMUP"),
+		lazyFailures:  make(map[string]time.Time),
 	}
 }
 
+// Lazy 是否为懒加载模式
+func (tm *TokenManager) Lazy() bool {
+	return tm.lazy
+}
+
 // getBestToken 获取最优可用token
-// 统一锁管理：所有操作在单一锁保护下完成，避免多次加锁/解锁
 func (tm *TokenManager) getBestToken() (types.TokenInfo, error) {
+	return tm.getBestTokenForModel("")
+}
+
+// getBestTokenForModel 获取支持指定模型的最优可用token（model为空表示不限模型）
+func (tm *TokenManager) getBestTokenForModel(model string) (types.TokenInfo, error) {
+	return tm.getBestTokenPreferring(model, "")
+}
+
+// getBestTokenPreferring 获取支持指定模型的可用token，优先使用 preferID 对应的账号
+func (tm *TokenManager) getBestTokenPreferring(model, preferID string) (types.TokenInfo, error) {
+	return tm.getBestTokenForTags(model, preferID, nil)
+}
+
+// getBestTokenForTags 获取支持指定模型且带有任一 tags 标签的可用token（tags 为空表示不限），优先使用 preferID 对应的账号
+// 统一锁管理：所有操作在单一锁保护下完成，避免多次加锁/解锁
+func (tm *TokenManager) getBestTokenForTags(model, preferID string, tags []string) (types.TokenInfo, error) {
+	// 懒加载模式：在锁外按需刷新即将选中的账号
+	if tm.lazy {
+		tm.ensureLazyToken(model, tags)
+	}
+
 	tm.mutex.Lock()
 	defer tm.mutex.Unlock()
 
 	// 检查是否需要刷新缓存（在锁内）
-	if time.Since(tm.lastRefresh) > config.TokenCacheTTL {
+	if tm.needsFullRefreshUnlocked() {
 		if err := tm.refreshCacheUnlocked(); err != nil {
 			logger.Warn("刷新token缓存失败", logger.Err(err))
 		}
 	}
 
 	// 选择最优token（内部方法，不加锁）
-	bestToken := tm.selectBestTokenUnlocked()
+	bestToken, lease := tm.selectTokenUnlocked(model, preferID, tags)
 	if bestToken == nil {
-		return types.TokenInfo{}, fmt.Errorf("没有可用的token")
+		return types.TokenInfo{}, tm.noTokenErrorUnlocked(model, tags)
 	}
 
 	// 更新最后使用时间（在锁内，安全）
@@ -87,26 +141,48 @@ func (tm *TokenManager) getBestToken() (types.TokenInfo, error) {
 		bestToken.Available--
 	}
 
-	return bestToken.Token, nil
+	token := bestToken.Token
+	token.SlotLease = lease
+	return token, nil
 }
 
 // GetBestTokenWithUsage 获取最优可用token（包含使用信息）
-// 统一锁管理：所有操作在单一锁保护下完成
 func (tm *TokenManager) GetBestTokenWithUsage() (*types.TokenWithUsage, error) {
+	return tm.GetBestTokenWithUsageForModel("")
+}
+
+// GetBestTokenWithUsageForModel 获取支持指定模型的最优可用token（包含使用信息）
+func (tm *TokenManager) GetBestTokenWithUsageForModel(model string) (*types.TokenWithUsage, error) {
+	return tm.GetBestTokenWithUsagePreferring(model, "")
+}
+
+// GetBestTokenWithUsagePreferring 获取支持指定模型的可用token（包含使用信息），优先使用 preferID 对应的账号
+func (tm *TokenManager) GetBestTokenWithUsagePreferring(model, preferID string) (*types.TokenWithUsage, error) {
+	return tm.GetBestTokenWithUsageForTags(model, preferID, nil)
+}
+
+// GetBestTokenWithUsageForTags 同 GetBestTokenWithUsagePreferring，只选择带有任一 tags 标签的账号（tags 为空表示不限）
+// 统一锁管理：所有操作在单一锁保护下完成
+func (tm *TokenManager) GetBestTokenWithUsageForTags(model, preferID string, tags []string) (*types.TokenWithUsage, error) {
+	// 懒加载模式：在锁外按需刷新即将选中的账号
+	if tm.lazy {
+		tm.ensureLazyToken(model, tags)
+	}
+
 	tm.mutex.Lock()
 	defer tm.mutex.Unlock()
 
 	// 检查是否需要刷新缓存（在锁内）
-	if time.Since(tm.lastRefresh) > config.TokenCacheTTL {
+	if tm.needsFullRefreshUnlocked() {
 		if err := tm.refreshCacheUnlocked(); err != nil {
 			logger.Warn("刷新token缓存失败", logger.Err(err))
 		}
 	}
 
 	// 选择最优token（内部方法，不加锁）
-	bestToken := tm.selectBestTokenUnlocked()
+	bestToken, lease := tm.selectTokenUnlocked(model, preferID, tags)
 	if bestToken == nil {
-		return nil, fmt.Errorf("没有可用的token")
+		return nil, tm.noTokenErrorUnlocked(model, tags)
 	}
 
 	// 更新最后使用时间（在锁内，安全）
@@ -124,6 +200,7 @@ func (tm *TokenManager) GetBestTokenWithUsage() (*types.TokenWithUsage, error) {
 		LastUsageCheck:  bestToken.LastUsed,
 		IsUsageExceeded: available <= 0,
 	}
+	tokenWithUsage.SlotLease = lease
 
 	logger.Debug("返回TokenWithUsage",
 		logger.Float64("available_count", available),
@@ -132,65 +209,428 @@ func (tm *TokenManager) GetBestTokenWithUsage() (*types.TokenWithUsage, error) {
 	return tokenWithUsage, nil
 }
 
-// selectBestTokenUnlocked 按配置顺序选择下一个可用token
+// PeekTokenForTags 返回 GetBestTokenWithUsageForTags 此刻会选择的token，但不产生任何副作用：
+// 不刷新token、不标记耗尽、不移动当前索引、不扣减可用次数、不占用熔断器半开探测，也不触发耗尽事件（用于转换预览等调试场景）
+// 懒加载模式下尚未缓存的账号不会被刷新，因此可能返回无可用token
+func (tm *TokenManager) PeekTokenForTags(model, preferID string, tags []string) (types.TokenInfo, error) {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+
+	if preferID != "" {
+		for key, cached := range tm.cache.tokens {
+			if cached.Token.ConfigID == preferID && tm.peekableUnlocked(key, cached, model, tags) {
+				return cached.Token, nil
+			}
+		}
+	}
+
+	keys := tm.configOrder
+	if len(keys) == 0 {
+		keys = make([]string, 0, len(tm.cache.tokens))
+		for key := range tm.cache.tokens {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+	}
+	start := 0
+	if len(tm.tagPreference) == 0 && tm.currentIndex < len(keys) {
+		start = tm.currentIndex
+	}
+	for i := range keys {
+		key := keys[(start+i)%len(keys)]
+		if cached, ok := tm.cache.tokens[key]; ok && tm.peekableUnlocked(key, cached, model, tags) {
+			return cached.Token, nil
+		}
+	}
+
+	for _, cfg := range tm.configs {
+		if !cfg.Disabled && cfg.eligible(model, tags) {
+			return types.TokenInfo{}, ErrTokenPoolExhausted
+		}
+	}
+	return types.TokenInfo{}, fmt.Errorf("%w: %s", ErrNoEligibleToken, model)
+}
+
+// peekableUnlocked 判断缓存的token此刻是否会被选择（只读检查）
+// 内部方法：调用者必须持有 tm.mutex（读锁即可）
+func (tm *TokenManager) peekableUnlocked(key string, cached *CachedToken, model string, tags []string) bool {
+	return tm.keyEligibleUnlocked(key, model, tags) &&
+		time.Since(cached.CachedAt) <= tm.cache.ttl &&
+		cached.IsUsable() &&
+		tm.keyHasFreeSlotUnlocked(key) &&
+		UpstreamBreakers.Available(InferenceBreakerKey(cached.Token.ConfigID))
+}
+
+// needsFullRefreshUnlocked 是否需要在请求路径上同步整体刷新token池（懒加载模式从不整体刷新）
+// 启用主动刷新后各账号由后台按到期时间刷新，仅在缓存被整体失效（如时钟跳变）后同步刷新
+// 内部方法：调用者必须持有 tm.mutex
+func (tm *TokenManager) needsFullRefreshUnlocked() bool {
+	if tm.lazy {
+		return false
+	}
+	if tm.scheduled {
+		return tm.lastRefresh.IsZero()
+	}
+	return time.Since(tm.lastRefresh) > config.TokenCacheTTL
+}
+
+// selectTokenUnlocked 优先选择 preferID 对应账号的token（会话粘性），该账号不可用时按顺序策略选择
+// 选中设置了 maxConcurrent 的账号时同时预留一个并发名额，返回预留编号（见 reserveSlotUnlocked）
+// 内部方法：调用者必须持有 tm.mutex
+func (tm *TokenManager) selectTokenUnlocked(model, preferID string, tags []string) (*CachedToken, uint64) {
+	if preferID != "" {
+		if cached, lease := tm.preferredTokenUnlocked(model, preferID, tags); cached != nil {
+			return cached, lease
+		}
+		logger.Debug("粘性账号不可用，按顺序策略选择",
+			logger.String("config_id", preferID),
+			logger.String("model", model))
+	}
+	return tm.selectBestTokenUnlocked(model, tags)
+}
+
+// preferredTokenUnlocked 返回指定账号的缓存token，不支持该模型、不带 tags 中的标签、缓存过期、额度耗尽或熔断中时返回 nil
+// 不移动顺序策略的当前索引
+// 内部方法：调用者必须持有 tm.mutex
+func (tm *TokenManager) preferredTokenUnlocked(model, configID string, tags []string) (*CachedToken, uint64) {
+	for key, cached := range tm.cache.tokens {
+		if cached.Token.ConfigID != configID {
+			continue
+		}
+		if !tm.keyEligibleUnlocked(key, model, tags) || time.Since(cached.CachedAt) > tm.cache.ttl || !cached.IsUsable() {
+			return nil, 0
+		}
+		if !tm.keyHasFreeSlotUnlocked(key) || !UpstreamBreakers.Allow(InferenceBreakerKey(configID)) {
+			return nil, 0
+		}
+		lease, ok := tm.reserveSlotUnlocked(key)
+		if !ok {
+			return nil, 0
+		}
+		return cached, lease
+	}
+	return nil, 0
+}
+
+// selectBestTokenUnlocked 按配置顺序选择下一个支持该模型（且带有任一 tags 标签）的可用token
+// 不符合条件的账号直接跳过，既不标记耗尽也不移动当前索引，避免影响其他模型与租户的选择
+// 选中设置了 maxConcurrent 的账号时同时预留一个并发名额，返回预留编号（见 reserveSlotUnlocked）
 // 内部方法：调用者必须持有 tm.mutex
 // 重构说明：从selectBestToken改为Unlocked后缀，明确锁约定
-func (tm *TokenManager) selectBestTokenUnlocked() *CachedToken {
+func (tm *TokenManager) selectBestTokenUnlocked(model string, tags []string) (*CachedToken, uint64) {
 	// 调用者已持有 tm.mutex，无需额外加锁
 
 	// 如果没有配置顺序，降级到按map遍历顺序
 	if len(tm.configOrder) == 0 {
 		for key, cached := range tm.cache.tokens {
-			if time.Since(cached.CachedAt) <= tm.cache.ttl && cached.IsUsable() {
+			if !tm.keyEligibleUnlocked(key, model, tags) {
+				continue
+			}
+			if time.Since(cached.CachedAt) <= tm.cache.ttl && cached.IsUsable() && tm.keyHasFreeSlotUnlocked(key) {
+				lease, ok := tm.reserveSlotUnlocked(key)
+				if !ok {
+					continue
+				}
 				logger.Debug("顺序策略选择token（无顺序配置）",
 					logger.String("selected_key", key),
 					logger.Float64("available_count", cached.Available))
-				return cached
+				return cached, lease
 			}
 		}
-		return nil
+		return nil, 0
+	}
+
+	// 配置了标签优先级时每次从头扫描，高优先级标签的token恢复可用后立即切回
+	if len(tm.tagPreference) > 0 {
+		tm.currentIndex = 0
 	}
 
 	// 从当前索引开始，找到第一个可用的token
+	// advance: 之前扫描的token均不可用（而非不支持该模型）时，当前索引跟随移动
+	index, advance := tm.currentIndex, true
 	for attempts := 0; attempts < len(tm.configOrder); attempts++ {
-		currentKey := tm.configOrder[tm.currentIndex]
+		currentKey := tm.configOrder[index]
+		next := (index + 1) % len(tm.configOrder)
+
+		if !tm.keyEligibleUnlocked(currentKey, model, tags) {
+			advance = false
+			index = next
+			continue
+		}
 
 		// 检查这个token是否存在且可用
 		if cached, exists := tm.cache.tokens[currentKey]; exists {
 			// 检查token是否过期
 			if time.Since(cached.CachedAt) > tm.cache.ttl {
 				tm.exhausted[currentKey] = true
-				tm.currentIndex = (tm.currentIndex + 1) % len(tm.configOrder)
+				index = next
+				if advance {
+					tm.currentIndex = index
+				}
 				continue
 			}
 
-			// 检查token是否可用
+			// 并发已满的token跳过但不标记耗尽、不移动当前索引，有请求结束后重新优先使用
+			if cached.IsUsable() && !tm.keyHasFreeSlotUnlocked(currentKey) {
+				logger.Debug("token并发已满，切换到下一个",
+					logger.String("skipped_key", currentKey),
+					logger.String("config_id", cached.Token.ConfigID))
+				advance = false
+				index = next
+				continue
+			}
+
+			// 上游熔断中的token跳过但不标记耗尽，冷却后半开探测
+			if cached.IsUsable() && !UpstreamBreakers.Allow(InferenceBreakerKey(cached.Token.ConfigID)) {
+				logger.Debug("token熔断中，切换到下一个",
+					logger.String("skipped_key", currentKey),
+					logger.String("config_id", cached.Token.ConfigID))
+				index = next
+				if advance {
+					tm.currentIndex = index
+				}
+				continue
+			}
+
+			// 检查token是否可用，并在锁内预留并发名额
+			// 预留失败说明名额在检查后被其他 TokenManager 实例占用，按并发已满处理
 			if cached.IsUsable() {
+				lease, ok := tm.reserveSlotUnlocked(currentKey)
+				if !ok {
+					advance = false
+					index = next
+					continue
+				}
 				logger.Debug("顺序策略选择token",
 					logger.String("selected_key", currentKey),
-					logger.Int("index", tm.currentIndex),
+					logger.Int("index", index),
+					logger.String("model", model),
 					logger.Float64("available_count", cached.Available))
-				return cached
+				return cached, lease
 			}
 		}
 
 		// 标记当前token为已耗尽，移动到下一个
 		tm.exhausted[currentKey] = true
-		tm.currentIndex = (tm.currentIndex + 1) % len(tm.configOrder)
+		index = next
+		if advance {
+			tm.currentIndex = index
+		}
 
 		logger.Debug("token不可用，切换到下一个",
 			logger.String("exhausted_key", currentKey),
-			logger.Int("next_index", tm.currentIndex))
+			logger.Int("next_index", index))
 	}
 
 	// 所有token都不可用
 	logger.Warn("所有token都不可用",
 		logger.Int("total_count", len(tm.configOrder)),
-		logger.Int("exhausted_count", len(tm.exhausted)))
+		logger.Int("exhausted_count", len(tm.exhausted)),
+		logger.String("model", model))
+
+	return nil, 0
+}
+
+// keyEligibleUnlocked 判断cache key对应的配置是否支持该模型且带有任一 tags 标签
+// 内部方法：调用者必须持有 tm.mutex
+func (tm *TokenManager) keyEligibleUnlocked(key, model string, tags []string) bool {
+	if model == "" && len(tags) == 0 {
+		return true
+	}
+	var index int
+	if _, err := fmt.Sscanf(key, config.TokenCacheKeyFormat, &index); err != nil || index < 0 || index >= len(tm.configs) {
+		return false
+	}
+	return tm.configs[index].eligible(model, tags)
+}
+
+// keyHasFreeSlotUnlocked 判断cache key对应的账号是否还有空闲的并发名额
+// 内部方法：调用者必须持有 tm.mutex
+func (tm *TokenManager) keyHasFreeSlotUnlocked(key string) bool {
+	var index int
+	if _, err := fmt.Sscanf(key, config.TokenCacheKeyFormat, &index); err != nil || index < 0 || index >= len(tm.configs) {
+		return true
+	}
+	return tm.configs[index].hasFreeSlot()
+}
+
+// reserveSlotUnlocked 为cache key对应的账号预留一个并发名额，未设置 maxConcurrent 的账号无需预留（返回 0, true）
+// 名额已满时返回 false
+// 内部方法：调用者必须持有 tm.mutex
+func (tm *TokenManager) reserveSlotUnlocked(key string) (uint64, bool) {
+	var index int
+	if _, err := fmt.Sscanf(key, config.TokenCacheKeyFormat, &index); err != nil || index < 0 || index >= len(tm.configs) {
+		return 0, true
+	}
+	cfg := tm.configs[index]
+	if cfg.MaxConcurrent <= 0 {
+		return 0, true
+	}
+	return AccountSlots.Reserve(cfg.ID, cfg.MaxConcurrent)
+}
+
+// noTokenErrorUnlocked 无可用token时的错误
+// - 没有启用的账号支持该模型（或带有任一 tags 标签）时返回 ErrNoEligibleToken（需调整账号配置，重试无意义）
+// - 有可用token但均已达到并发上限时返回 ErrAllTokensBusy（不触发耗尽事件）
+// - 支持该模型的token均熔断中时返回 ErrAllTokensCircuitOpen
+// - 其余情况返回 ErrTokenPoolExhausted
+// 内部方法：调用者必须持有 tm.mutex
+func (tm *TokenManager) noTokenErrorUnlocked(model string, tags []string) error {
+	if model != "" || len(tags) > 0 {
+		eligible := false
+		for _, cfg := range tm.configs {
+			if !cfg.Disabled && cfg.eligible(model, tags) {
+				eligible = true
+				break
+			}
+		}
+		if !eligible && len(tags) > 0 {
+			return fmt.Errorf("%w: %s（允许的账号标签: %s）", ErrNoEligibleToken, model, strings.Join(tags, ","))
+		}
+		if !eligible {
+			return fmt.Errorf("%w: %s", ErrNoEligibleToken, model)
+		}
+	}
+	err := ErrTokenPoolExhausted
+	for key, cached := range tm.cache.tokens {
+		if !tm.keyEligibleUnlocked(key, model, tags) || !cached.IsUsable() {
+			continue
+		}
+		if time.Since(cached.CachedAt) <= tm.cache.ttl && !tm.keyHasFreeSlotUnlocked(key) {
+			return ErrAllTokensBusy
+		}
+		if !UpstreamBreakers.Available(InferenceBreakerKey(cached.Token.ConfigID)) {
+			err = ErrAllTokensCircuitOpen
+		}
+	}
+	// 空Token池（尚未添加账号）不属于耗尽
+	if len(tm.configs) > 0 {
+		emitTokenEvent(TokenEvent{Type: EventAllTokensExhausted, Model: model, Error: err.Error()})
+	}
+	return err
+}
+
+// ensureLazyToken 懒加载模式下，按选择顺序刷新尚未缓存（或缓存已过期）的账号，直到找到可用token
+// 刷新在锁外进行，同一账号的并发刷新通过 singleflight 合并
+func (tm *TokenManager) ensureLazyToken(model string, tags []string) {
+	tried := make(map[string]bool)
+	for {
+		tm.mutex.Lock()
+		key, cfg, ok := tm.lazyRefreshTargetUnlocked(model, tags, tried)
+		tm.mutex.Unlock()
+		if !ok {
+			return
+		}
+		tried[key] = true
+
+		_, err, shared := tm.refreshGroup.Do(key, func() (any, error) {
+			return nil, tm.refreshLazyToken(key, cfg)
+		})
+		if err != nil {
+			logger.Warn("按需刷新token失败",
+				logger.String("cache_key", key),
+				logger.String("config_id", cfg.ID),
+				logger.Bool("shared", shared),
+				logger.Err(err))
+		}
+	}
+}
+
+// lazyRefreshTargetUnlocked 按选择顺序找出需要按需刷新的账号
+// 遇到已缓存且可用的token时返回 false（无需刷新）
+// 内部方法：调用者必须持有 tm.mutex
+func (tm *TokenManager) lazyRefreshTargetUnlocked(model string, tags []string, tried map[string]bool) (string, AuthConfig, bool) {
+	if len(tm.configOrder) == 0 {
+		return "", AuthConfig{}, false
+	}
+	start := tm.currentIndex
+	if len(tm.tagPreference) > 0 || start >= len(tm.configOrder) {
+		start = 0
+	}
+	for offset := 0; offset < len(tm.configOrder); offset++ {
+		key := tm.configOrder[(start+offset)%len(tm.configOrder)]
+		var index int
+		if _, err := fmt.Sscanf(key, config.TokenCacheKeyFormat, &index); err != nil || index < 0 || index >= len(tm.configs) {
+			continue
+		}
+		cfg := tm.configs[index]
+		if cfg.Disabled || !cfg.eligible(model, tags) || tried[key] {
+			continue
+		}
+		if cached, exists := tm.cache.tokens[key]; exists && time.Since(cached.CachedAt) <= tm.cache.ttl {
+			if cached.IsUsable() {
+				return "", AuthConfig{}, false
+			}
+			continue
+		}
+		if failedAt, failed := tm.lazyFailures[key]; failed && time.Since(failedAt) <= tm.cache.ttl {
+			continue
+		}
+		return key, cfg, true
+	}
+	return "", AuthConfig{}, false
+}
 
+// refreshLazyToken 刷新单个账号并写入缓存（锁外刷新，写入前确认配置未变更）
+func (tm *TokenManager) refreshLazyToken(key string, cfg AuthConfig) error {
+	// 双重检查：上一轮合并刷新可能刚刚完成（成功写入缓存或记录了失败）
+	tm.mutex.Lock()
+	existing, exists := tm.cache.tokens[key]
+	failedAt, failed := tm.lazyFailures[key]
+	tm.mutex.Unlock()
+	if (exists && time.Since(existing.CachedAt) <= tm.cache.ttl) || (failed && time.Since(failedAt) <= tm.cache.ttl) {
+		return nil
+	}
+
+	cached, err := fetchCachedTokenFunc(tm, cfg)
+
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	if err != nil {
+		tm.lazyFailures[key] = time.Now()
+		return err
+	}
+	if tm.storeRefreshedTokenUnlocked(key, cfg, cached) {
+		logger.Debug("按需刷新token完成",
+			logger.String("cache_key", key),
+			logger.Float64("available", cached.Available))
+	}
+	return nil
+}
+
+// refreshScheduledToken 主动刷新单个账号并替换缓存（锁外刷新；失败时保留当前token直到过期）
+func (tm *TokenManager) refreshScheduledToken(key string, cfg AuthConfig) error {
+	cached, err := fetchCachedTokenFunc(tm, cfg)
+
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	if err != nil {
+		tm.lazyFailures[key] = time.Now()
+		return err
+	}
+	if tm.storeRefreshedTokenUnlocked(key, cfg, cached) {
+		logger.Debug("主动刷新token完成",
+			logger.String("cache_key", key),
+			logger.String("expires_at", cached.Token.ExpiresAt.Format(time.RFC3339)),
+			logger.Float64("available", cached.Available))
+	}
 	return nil
 }
 
+// storeRefreshedTokenUnlocked 写入锁外刷新得到的token，刷新期间配置已变更（删除、替换或禁用）时丢弃
+// 内部方法：调用者必须持有 tm.mutex
+func (tm *TokenManager) storeRefreshedTokenUnlocked(key string, cfg AuthConfig, cached *CachedToken) bool {
+	var index int
+	if _, scanErr := fmt.Sscanf(key, config.TokenCacheKeyFormat, &index); scanErr != nil ||
+		index >= len(tm.configs) || tm.configs[index].ID != cfg.ID || tm.configs[index].Disabled {
+		return false
+	}
+	tm.cache.tokens[key] = cached
+	delete(tm.lazyFailures, key)
+	delete(tm.exhausted, key)
+	return true
+}
+
 // refreshCacheUnlocked 刷新token缓存
 // 内部方法：调用者必须持有 tm.mutex
 func (tm *TokenManager) refreshCacheUnlocked() error {
@@ -219,6 +659,7 @@ func (tm *TokenManager) refreshCacheUnlocked() error {
 		if usage, checkErr := checker.CheckUsageLimits(token); checkErr == nil {
 			usageInfo = usage
 			available = CalculateAvailableCount(usage)
+			emitQuotaIfExhausted(cfg, available)
 		} else {
 			logger.Warn("检查使用限制失败", logger.Err(checkErr))
 		}
@@ -241,10 +682,132 @@ func (tm *TokenManager) refreshCacheUnlocked() error {
 	return nil
 }
 
+// ReportFailure 上游对token返回账号级错误时将其移出轮换，直到下次缓存刷新
+// - 401/403: 访问令牌失效，删除缓存以便下次刷新重新获取
+// - 429: 额度或频率受限，保留缓存但将可用次数置零
+func (tm *TokenManager) ReportFailure(configID string, status int) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+
+	for cacheKey, cached := range tm.cache.tokens {
+		if cached.Token.ConfigID != configID {
+			continue
+		}
+		if status == http.StatusTooManyRequests {
+			cached.Available = 0
+		} else {
+			delete(tm.cache.tokens, cacheKey)
+		}
+		tm.exhausted[cacheKey] = true
+		tm.lazyFailures[cacheKey] = time.Now()
+		logger.Info("上游拒绝token，移出轮换",
+			logger.String("cache_key", cacheKey),
+			logger.String("config_id", configID),
+			logger.Int("status", status))
+
+		event := TokenEvent{Type: EventTokenQuarantined, ConfigID: configID, Status: status}
+		if status == http.StatusTooManyRequests {
+			event.Type = EventQuotaExceeded
+		}
+		for _, cfg := range tm.configs {
+			if cfg.ID == configID {
+				event.Label = cfg.Label
+				break
+			}
+		}
+		emitTokenEvent(event)
+		return
+	}
+}
+
+// UpdateConfig 运行时更新单个配置，不重建TokenManager
+// - 禁用时立即移出缓存，退出轮换
+// - 重新启用时立即刷新token重新加入轮换（刷新在锁外进行，不阻塞其他请求）
+// - 标签变化时重新生成选择顺序
+func (tm *TokenManager) UpdateConfig(index int, cfg AuthConfig) error {
+	cacheKey := fmt.Sprintf(config.TokenCacheKeyFormat, index)
+
+	tm.mutex.Lock()
+	if index < 0 || index >= len(tm.configs) || tm.configs[index].ID != cfg.ID {
+		tm.mutex.Unlock()
+		return fmt.Errorf("%w: %s", ErrConfigNotFound, cfg.ID)
+	}
+
+	previous := tm.configs[index]
+	configs := make([]AuthConfig, len(tm.configs))
+	copy(configs, tm.configs)
+	configs[index] = cfg
+	tm.configs = configs
+	tm.configOrder = generateConfigOrder(configs, tm.tagPreference)
+
+	reenabled := previous.Disabled && !cfg.Disabled
+	if cfg.Disabled && !previous.Disabled {
+		delete(tm.cache.tokens, cacheKey)
+		tm.exhausted[cacheKey] = true
+		logger.Info("token已禁用，移出轮换", logger.String("cache_key", cacheKey))
+	}
+	if reenabled {
+		delete(tm.exhausted, cacheKey)
+	}
+	tm.mutex.Unlock()
+
+	if !reenabled {
+		return nil
+	}
+
+	cached, err := tm.fetchCachedToken(cfg)
+	if err != nil {
+		logger.Warn("重新启用的token刷新失败，将在下次缓存刷新时重试",
+			logger.String("cache_key", cacheKey),
+			logger.Err(err))
+		return nil
+	}
+
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	// 刷新期间配置可能再次变更，仅在仍为同一启用配置时写入缓存
+	if index < len(tm.configs) && tm.configs[index].ID == cfg.ID && !tm.configs[index].Disabled {
+		tm.cache.tokens[cacheKey] = cached
+		logger.Info("token已重新启用，加入轮换",
+			logger.String("cache_key", cacheKey),
+			logger.Float64("available", cached.Available))
+	}
+	return nil
+}
+
+// fetchCachedToken 刷新单个配置的token并查询使用限制（不访问TokenManager状态，无需持锁）
+func (tm *TokenManager) fetchCachedToken(cfg AuthConfig) (*CachedToken, error) {
+	token, err := tm.refreshSingleToken(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	var usageInfo *types.UsageLimits
+	var available float64
+	checker := NewUsageLimitsChecker()
+	if usage, checkErr := checker.CheckUsageLimits(token); checkErr == nil {
+		usageInfo = usage
+		available = CalculateAvailableCount(usage)
+		emitQuotaIfExhausted(cfg, available)
+	} else {
+		logger.Warn("检查使用限制失败", logger.Err(checkErr))
+	}
+
+	return &CachedToken{
+		Token:     token,
+		UsageInfo: usageInfo,
+		CachedAt:  time.Now(),
+		Available: available,
+	}, nil
+}
+
+// fetchCachedTokenFunc 按需刷新使用的刷新入口（可在测试中替换）
+var fetchCachedTokenFunc = (*TokenManager).fetchCachedToken
+
 // IsUsable 检查缓存的token是否可用
 func (ct *CachedToken) IsUsable() bool {
-	// 检查token是否过期
-	if time.Now().After(ct.Token.ExpiresAt) {
+	// 检查token是否过期（兼容时钟跳变，见 types.Token.IsExpiredAt）
+	if ct.Token.IsExpired() {
 		return false
 	}
 
@@ -297,14 +860,35 @@ func CalculateAvailableCount(usage *types.UsageLimits) float64 {
 	return 0.0
 }
 
+// parseTagPreference 解析标签优先级（逗号分隔，靠前的优先）
+func parseTagPreference(value string) []string {
+	return NormalizeTags(strings.Split(value, ","))
+}
+
+// tagTier 返回配置所属的优先级层级，未匹配任何标签的排在最后
+func tagTier(cfg AuthConfig, tagPreference []string) int {
+	for tier, tag := range tagPreference {
+		if cfg.HasTag(tag) {
+			return tier
+		}
+	}
+	return len(tagPreference)
+}
+
 // generateConfigOrder 生成token配置的顺序
-func generateConfigOrder(configs []AuthConfig) []string {
+// 配置了标签优先级时按层级稳定排序（如 primary 优先，backup 兜底），同层保持配置顺序
+func generateConfigOrder(configs []AuthConfig, tagPreference []string) []string {
 	var order []string
 
-	for i := range configs {
-		// 使用索引生成cache key，与refreshCache中的逻辑保持一致
-		cacheKey := fmt.Sprintf(config.TokenCacheKeyFormat, i)
-		order = append(order, cacheKey)
+	for tier := 0; tier <= len(tagPreference); tier++ {
+		for i, cfg := range configs {
+			if tagTier(cfg, tagPreference) != tier {
+				continue
+			}
+			// 使用索引生成cache key，与refreshCache中的逻辑保持一致
+			cacheKey := fmt.Sprintf(config.TokenCacheKeyFormat, i)
+			order = append(order, cacheKey)
+		}
 	}
 
 	logger.Debug("生成配置顺序",
@@ -316,45 +900,42 @@ func generateConfigOrder(configs []AuthConfig) []string {
 
 // AddConfig 动态添加认证配置
 func (tm *TokenManager) AddConfig(cfg AuthConfig) {
-	tm.mutex.Lock()
-	defer tm.mutex.Unlock()
+	tm.addConfig(cfg, nil)
+}
 
-	// 添加到配置列表
-	tm.configs = append(tm.configs, cfg)
+// addConfig 添加配置，cached 非nil时直接写入缓存，否则立即刷新
+func (tm *TokenManager) addConfig(cfg AuthConfig, cached *CachedToken) {
+	tm.mutex.Lock()
+	// 写时复制：已取出的配置切片不受影响
+	configs := make([]AuthConfig, 0, len(tm.configs)+1)
+	configs = append(configs, tm.configs...)
+	configs = append(configs, cfg)
+	tm.configs = configs
 
 	// 重新生成配置顺序
-	tm.configOrder = generateConfigOrder(tm.configs)
-
-	// 立即刷新新添加的token
+	tm.configOrder = generateConfigOrder(tm.configs, tm.tagPreference)
 	index := len(tm.configs) - 1
-	token, err := tm.refreshSingleToken(cfg)
-	if err != nil {
-		logger.Warn("刷新新添加的token失败",
-			logger.Int("config_index", index),
-			logger.Err(err))
-		return
-	}
-
-	// 检查使用限制
-	var usageInfo *types.UsageLimits
-	var available float64
-
-	checker := NewUsageLimitsChecker()
-	if usage, checkErr := checker.CheckUsageLimits(token); checkErr == nil {
-		usageInfo = usage
-		available = CalculateAvailableCount(usage)
+	tm.mutex.Unlock()
+
+	// 立即刷新新添加的token（在锁外进行，不阻塞其他请求取token）
+	if cached == nil {
+		var err error
+		if cached, err = fetchCachedTokenFunc(tm, cfg); err != nil {
+			logger.Warn("刷新新添加的token失败",
+				logger.Int("config_index", index),
+				logger.Err(err))
+			return
+		}
 	}
 
-	// 添加到缓存
 	cacheKey := fmt.Sprintf(config.TokenCacheKeyFormat, index)
-	tm.cache.tokens[cacheKey] = &CachedToken{
-		Token:     token,
-		UsageInfo: usageInfo,
-		CachedAt:  time.Now(),
-		Available: available,
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	if !tm.storeRefreshedTokenUnlocked(cacheKey, cfg, cached) {
+		return
 	}
 
 	logger.Info("成功添加并刷新token",
 		logger.String("cache_key", cacheKey),
-		logger.Float64("available", available))
+		logger.Float64("available", cached.Available))
 }
@@ -2,11 +2,17 @@ package auth
 
 import (
 	"fmt"
+	"kiro2api/breaker"
 	"kiro2api/config"
 	"kiro2api/types"
+	"os"
+	"path/filepath"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestTokenManager_ConcurrentAccess 测试TokenManager的并发访问安全性
@@ -243,3 +249,578 @@ func TestTokenManager_SequentialSelection(t *testing.T) {
 
 	t.Logf("✅ 顺序选择策略验证通过：粘性策略正确工作")
 }
+
+func TestCachedToken_IsUsable_ExpirySkew(t *testing.T) {
+	now := time.Now()
+	ct := &CachedToken{Available: 1}
+
+	ct.Token = types.TokenInfo{ExpiresAt: now.Add(time.Hour)}
+	assert.True(t, ct.IsUsable())
+
+	// 在提前量范围内视为过期，提前刷新
+	ct.Token = types.TokenInfo{ExpiresAt: now.Add(config.TokenExpirySkew / 2)}
+	assert.False(t, ct.IsUsable())
+}
+
+func TestTokenIsExpiredAt_WallClock(t *testing.T) {
+	now := time.Now()
+	token := types.TokenInfo{ExpiresAt: now.Add(time.Hour)}
+
+	assert.False(t, token.IsExpiredAt(now, 0))
+	assert.True(t, token.IsExpiredAt(now.Add(2*time.Hour), 0))
+	// 持久化后丢失单调时钟读数时按墙上时钟判断
+	assert.True(t, token.IsExpiredAt(now.Add(2*time.Hour).Round(0), 0))
+	assert.True(t, token.IsExpiredAt(now, 2*time.Hour))
+}
+
+func TestGenerateConfigOrder_TagPreference(t *testing.T) {
+	configs := []AuthConfig{
+		{RefreshToken: "a", Tags: []string{"backup"}},
+		{RefreshToken: "b"},
+		{RefreshToken: "c", Tags: []string{"primary"}},
+		{RefreshToken: "d", Tags: []string{"backup", "primary"}},
+	}
+
+	assert.Equal(t, []string{"token_0", "token_1", "token_2", "token_3"}, generateConfigOrder(configs, nil))
+	assert.Equal(t,
+		[]string{"token_2", "token_3", "token_0", "token_1"},
+		generateConfigOrder(configs, parseTagPreference(" Primary, backup ,")))
+}
+
+func TestTokenManager_PrefersTaggedTokens(t *testing.T) {
+	t.Setenv("TOKEN_TAG_PREFERENCE", "primary,backup")
+	configs := []AuthConfig{
+		{RefreshToken: "backup", Tags: []string{"backup"}},
+		{RefreshToken: "primary", Tags: []string{"primary"}},
+	}
+	tm := NewTokenManager(configs)
+
+	expires := time.Now().Add(time.Hour)
+	tm.cache.tokens["token_0"] = &CachedToken{Token: types.TokenInfo{AccessToken: "backup", ExpiresAt: expires}, CachedAt: time.Now(), Available: 10}
+	tm.cache.tokens["token_1"] = &CachedToken{Token: types.TokenInfo{AccessToken: "primary", ExpiresAt: expires}, CachedAt: time.Now(), Available: 0}
+
+	// primary 耗尽时回退到 backup
+	selected, _ := tm.selectBestTokenUnlocked("", nil)
+	assert.Equal(t, "backup", selected.Token.AccessToken)
+
+	// primary 恢复后立即切回
+	tm.cache.tokens["token_1"].Available = 5
+	selected, _ = tm.selectBestTokenUnlocked("", nil)
+	assert.Equal(t, "primary", selected.Token.AccessToken)
+}
+
+func TestNormalizeTags(t *testing.T) {
+	assert.Equal(t, []string{"primary", "eu"}, NormalizeTags([]string{" Primary ", "", "eu", "PRIMARY"}))
+	assert.Nil(t, NormalizeTags([]string{" "}))
+	assert.True(t, AuthConfig{Tags: []string{"primary"}}.HasTag("PRIMARY"))
+}
+
+func TestTokenManager_UpdateConfig_DisableWithoutRebuild(t *testing.T) {
+	configs := []AuthConfig{
+		{ID: "a", RefreshToken: "a"},
+		{ID: "b", RefreshToken: "b"},
+	}
+	tm := NewTokenManager(configs)
+	expires := time.Now().Add(time.Hour)
+	tm.cache.tokens["token_0"] = &CachedToken{Token: types.TokenInfo{AccessToken: "a", ExpiresAt: expires}, CachedAt: time.Now(), Available: 5}
+	tm.cache.tokens["token_1"] = &CachedToken{Token: types.TokenInfo{AccessToken: "b", ExpiresAt: expires}, CachedAt: time.Now(), Available: 5}
+
+	disabled := configs[0]
+	disabled.Disabled = true
+	assert.NoError(t, tm.UpdateConfig(0, disabled))
+
+	// 被禁用的token立即退出轮换，其他token缓存保留
+	_, exists := tm.cache.tokens["token_0"]
+	assert.False(t, exists)
+	selected, _ := tm.selectBestTokenUnlocked("", nil)
+	assert.Equal(t, "b", selected.Token.AccessToken)
+	assert.True(t, tm.configs[0].Disabled)
+	assert.False(t, configs[0].Disabled, "不应修改调用方持有的配置切片")
+
+	// ID不匹配时拒绝更新
+	assert.ErrorIs(t, tm.UpdateConfig(1, AuthConfig{ID: "other"}), ErrConfigNotFound)
+}
+
+func TestTokenManager_SkipsTokensWithOpenBreaker(t *testing.T) {
+	original := UpstreamBreakers
+	UpstreamBreakers = breaker.NewSet(1, time.Hour)
+	defer func() { UpstreamBreakers = original }()
+
+	tm := NewTokenManager([]AuthConfig{{ID: "a", RefreshToken: "a"}, {ID: "b", RefreshToken: "b"}})
+	tm.lastRefresh = time.Now()
+	expires := time.Now().Add(time.Hour)
+	tm.cache.tokens["token_0"] = &CachedToken{Token: types.TokenInfo{AccessToken: "a", ConfigID: "a", ExpiresAt: expires}, CachedAt: time.Now(), Available: 5}
+	tm.cache.tokens["token_1"] = &CachedToken{Token: types.TokenInfo{AccessToken: "b", ConfigID: "b", ExpiresAt: expires}, CachedAt: time.Now(), Available: 5}
+
+	// token a 的推理端点熔断后切换到 b，且 a 不被标记为耗尽
+	UpstreamBreakers.RecordFailure(InferenceBreakerKey("a"), "500")
+	token, err := tm.getBestToken()
+	require.NoError(t, err)
+	assert.Equal(t, "b", token.AccessToken)
+	assert.False(t, tm.exhausted["token_0"])
+
+	// 全部熔断时返回专用错误
+	UpstreamBreakers.RecordFailure(InferenceBreakerKey("b"), "500")
+	_, err = tm.getBestToken()
+	assert.ErrorIs(t, err, ErrAllTokensCircuitOpen)
+}
+
+func TestTokenManager_SkipsBusyTokens(t *testing.T) {
+	original := AccountSlots
+	AccountSlots = NewSlotCounter()
+	defer func() { AccountSlots = original }()
+
+	tm := NewTokenManager([]AuthConfig{{ID: "a", RefreshToken: "a", MaxConcurrent: 2}, {ID: "b", RefreshToken: "b", MaxConcurrent: 1}})
+	tm.lastRefresh = time.Now()
+	expires := time.Now().Add(time.Hour)
+	tm.cache.tokens["token_0"] = &CachedToken{Token: types.TokenInfo{AccessToken: "a", ConfigID: "a", ExpiresAt: expires}, CachedAt: time.Now(), Available: 50}
+	tm.cache.tokens["token_1"] = &CachedToken{Token: types.TokenInfo{AccessToken: "b", ConfigID: "b", ExpiresAt: expires}, CachedAt: time.Now(), Available: 50}
+
+	// a 达到并发上限后选择有空闲名额的 b，a 不被标记为耗尽
+	releaseA1 := AccountSlots.Acquire("a")
+	AccountSlots.Acquire("a")
+	token, err := tm.getBestToken()
+	require.NoError(t, err)
+	assert.Equal(t, "b", token.AccessToken)
+	assert.False(t, tm.exhausted["token_0"])
+	// 选择时已为 b 预留名额，取消预留后归还
+	assert.NotZero(t, token.SlotLease)
+	assert.Equal(t, 1, AccountSlots.InFlight("b"))
+	AccountSlots.Cancel(token.SlotLease)
+
+	// 粘性账号并发已满时同样回退
+	token, err = tm.getBestTokenPreferring("", "a")
+	require.NoError(t, err)
+	assert.Equal(t, "b", token.AccessToken)
+	AccountSlots.Cancel(token.SlotLease)
+
+	// 全部并发已满时返回专用错误，不触发耗尽事件
+	var events []TokenEvent
+	SetTokenEventHandler(func(event TokenEvent) { events = append(events, event) })
+	defer SetTokenEventHandler(nil)
+	releaseB := AccountSlots.Acquire("b")
+	_, err = tm.getBestToken()
+	assert.ErrorIs(t, err, ErrAllTokensBusy)
+	assert.Empty(t, events)
+
+	// 有请求结束后重新优先使用 a（当前索引未移动）
+	releaseA1()
+	releaseA1() // 重复归还只计一次
+	releaseB()
+	assert.Equal(t, 1, AccountSlots.InFlight("a"))
+	token, err = tm.getBestToken()
+	require.NoError(t, err)
+	assert.Equal(t, "a", token.AccessToken)
+}
+
+func TestTokenManager_ReservesSlotsOnSelection(t *testing.T) {
+	original := AccountSlots
+	AccountSlots = NewSlotCounter()
+	defer func() { AccountSlots = original }()
+
+	tm := NewTokenManager([]AuthConfig{{ID: "a", RefreshToken: "a", MaxConcurrent: 2}})
+	tm.lastRefresh = time.Now()
+	tm.cache.tokens["token_0"] = &CachedToken{Token: types.TokenInfo{AccessToken: "a", ConfigID: "a", ExpiresAt: time.Now().Add(time.Hour)}, CachedAt: time.Now(), Available: 50}
+
+	// 突发请求在发出上游请求前即占用名额，第三个请求不会再选中 a
+	first, err := tm.getBestToken()
+	require.NoError(t, err)
+	second, err := tm.getBestToken()
+	require.NoError(t, err)
+	_, err = tm.getBestToken()
+	assert.ErrorIs(t, err, ErrAllTokensBusy)
+
+	// 认领不重复计数，release 与取消都只归还一次
+	release := AccountSlots.Claim(first.SlotLease, first.ConfigID)
+	assert.Equal(t, 2, AccountSlots.InFlight("a"))
+	AccountSlots.Cancel(first.SlotLease) // 已认领的预留不受影响
+	assert.Equal(t, 2, AccountSlots.InFlight("a"))
+	release()
+	release()
+	AccountSlots.Cancel(second.SlotLease)
+	AccountSlots.Cancel(second.SlotLease)
+	assert.Equal(t, 0, AccountSlots.InFlight("a"))
+}
+
+func TestSlotCounter_ExpiresUnclaimedLeases(t *testing.T) {
+	slots := NewSlotCounter()
+	lease, ok := slots.Reserve("a", 1)
+	require.True(t, ok)
+	_, ok = slots.Reserve("a", 1)
+	assert.False(t, ok)
+
+	// 到期未认领的预留自动归还，之后认领按新占用计数
+	slots.mu.Lock()
+	reserved := slots.leases[lease]
+	reserved.expiresAt = time.Now().Add(-time.Second)
+	slots.leases[lease] = reserved
+	slots.mu.Unlock()
+	assert.Equal(t, 0, slots.InFlight("a"))
+	release := slots.Claim(lease, "a")
+	assert.Equal(t, 1, slots.InFlight("a"))
+	release()
+	assert.Equal(t, 0, slots.InFlight("a"))
+}
+
+func TestTokenManager_ReportFailure(t *testing.T) {
+	tm := NewTokenManager([]AuthConfig{{ID: "a", RefreshToken: "a"}, {ID: "b", RefreshToken: "b"}})
+	tm.lastRefresh = time.Now()
+	expires := time.Now().Add(time.Hour)
+	tm.cache.tokens["token_0"] = &CachedToken{Token: types.TokenInfo{AccessToken: "a", ConfigID: "a", ExpiresAt: expires}, CachedAt: time.Now(), Available: 5}
+	tm.cache.tokens["token_1"] = &CachedToken{Token: types.TokenInfo{AccessToken: "b", ConfigID: "b", ExpiresAt: expires}, CachedAt: time.Now(), Available: 5}
+
+	// 429 保留缓存但可用次数置零
+	tm.ReportFailure("a", 429)
+	assert.Equal(t, float64(0), tm.cache.tokens["token_0"].Available)
+	token, err := tm.getBestToken()
+	require.NoError(t, err)
+	assert.Equal(t, "b", token.AccessToken)
+
+	// 403 删除缓存，等待重新刷新
+	tm.ReportFailure("b", 403)
+	_, exists := tm.cache.tokens["token_1"]
+	assert.False(t, exists)
+	assert.True(t, tm.exhausted["token_1"])
+}
+
+func TestTokenManager_ReportFailureEmitsEvents(t *testing.T) {
+	var events []TokenEvent
+	SetTokenEventHandler(func(event TokenEvent) { events = append(events, event) })
+	defer SetTokenEventHandler(nil)
+
+	tm := NewTokenManager([]AuthConfig{{ID: "a", Label: "主账号", RefreshToken: "a"}, {ID: "b", RefreshToken: "b"}})
+	expires := time.Now().Add(time.Hour)
+	tm.cache.tokens["token_0"] = &CachedToken{Token: types.TokenInfo{AccessToken: "a", ConfigID: "a", ExpiresAt: expires}, CachedAt: time.Now(), Available: 5}
+	tm.cache.tokens["token_1"] = &CachedToken{Token: types.TokenInfo{AccessToken: "b", ConfigID: "b", ExpiresAt: expires}, CachedAt: time.Now(), Available: 5}
+
+	tm.ReportFailure("a", 429)
+	tm.ReportFailure("b", 401)
+	tm.ReportFailure("missing", 403)
+
+	require.Len(t, events, 2)
+	assert.Equal(t, EventQuotaExceeded, events[0].Type)
+	assert.Equal(t, "主账号", events[0].Label)
+	assert.Equal(t, 429, events[0].Status)
+	assert.Equal(t, EventTokenQuarantined, events[1].Type)
+	assert.Equal(t, "b", events[1].ConfigID)
+	assert.False(t, events[1].Time.IsZero())
+}
+
+func TestTokenManager_PreferredToken(t *testing.T) {
+	tm := NewTokenManager([]AuthConfig{{ID: "a", RefreshToken: "a"}, {ID: "b", RefreshToken: "b"}})
+	tm.lastRefresh = time.Now()
+	expires := time.Now().Add(time.Hour)
+	tm.cache.tokens["token_0"] = &CachedToken{Token: types.TokenInfo{AccessToken: "a", ConfigID: "a", ExpiresAt: expires}, CachedAt: time.Now(), Available: 5}
+	tm.cache.tokens["token_1"] = &CachedToken{Token: types.TokenInfo{AccessToken: "b", ConfigID: "b", ExpiresAt: expires}, CachedAt: time.Now(), Available: 5}
+
+	token, err := tm.getBestTokenPreferring("", "b")
+	require.NoError(t, err)
+	assert.Equal(t, "b", token.ConfigID)
+	assert.Equal(t, 0, tm.currentIndex, "粘性选择不移动顺序策略的索引")
+
+	// 粘性账号额度耗尽或不存在时按顺序策略选择
+	tm.ReportFailure("b", 429)
+	withUsage, err := tm.GetBestTokenWithUsagePreferring("", "b")
+	require.NoError(t, err)
+	assert.Equal(t, "a", withUsage.ConfigID)
+	token, err = tm.getBestTokenPreferring("", "missing")
+	require.NoError(t, err)
+	assert.Equal(t, "a", token.ConfigID)
+}
+
+func TestTokenManager_TenantTags(t *testing.T) {
+	tm := NewTokenManager([]AuthConfig{
+		{ID: "a", RefreshToken: "a", Tags: []string{"team-a"}},
+		{ID: "b", RefreshToken: "b", Tags: []string{"team-b", "shared"}},
+		{ID: "c", RefreshToken: "c", Tags: []string{"shared"}},
+	})
+	tm.lastRefresh = time.Now()
+	expires := time.Now().Add(time.Hour)
+	for i, id := range []string{"a", "b", "c"} {
+		tm.cache.tokens[fmt.Sprintf("token_%d", i)] = &CachedToken{Token: types.TokenInfo{AccessToken: id, ConfigID: id, ExpiresAt: expires}, CachedAt: time.Now(), Available: 5}
+	}
+
+	// 只选择带有允许标签的账号，跳过的账号不移动当前索引
+	token, err := tm.getBestTokenForTags("", "", []string{"team-b"})
+	require.NoError(t, err)
+	assert.Equal(t, "b", token.ConfigID)
+	assert.Equal(t, 0, tm.currentIndex)
+
+	// 粘性账号不属于该租户时不使用
+	token, err = tm.getBestTokenForTags("", "a", []string{"shared"})
+	require.NoError(t, err)
+	assert.Equal(t, "b", token.ConfigID)
+
+	// 租户账号额度耗尽时不借用其他租户的账号
+	tm.ReportFailure("a", 429)
+	_, err = tm.getBestTokenForTags("", "", []string{"team-a"})
+	assert.ErrorIs(t, err, ErrTokenPoolExhausted)
+
+	// 没有账号带有允许的标签时返回专用错误
+	_, err = tm.getBestTokenForTags("", "", []string{"team-x"})
+	assert.ErrorIs(t, err, ErrNoEligibleToken)
+	assert.Contains(t, err.Error(), "team-x")
+
+	// 不限标签时行为不变
+	token, err = tm.getBestToken()
+	require.NoError(t, err)
+	assert.Equal(t, "b", token.ConfigID)
+}
+
+func TestTokenManager_ModelEligibility(t *testing.T) {
+	configs := []AuthConfig{
+		{ID: "opus", RefreshToken: "opus", Models: []string{"opus"}},
+		{ID: "any", RefreshToken: "any"},
+		{ID: "haiku", RefreshToken: "haiku", Models: []string{"haiku"}},
+	}
+	tm := NewTokenManager(configs)
+	tm.lastRefresh = time.Now()
+	expires := time.Now().Add(time.Hour)
+	for i, cfg := range configs {
+		tm.cache.tokens[fmt.Sprintf("token_%d", i)] = &CachedToken{Token: types.TokenInfo{AccessToken: cfg.ID, ConfigID: cfg.ID, ExpiresAt: expires}, CachedAt: time.Now(), Available: 5}
+	}
+
+	token, err := tm.getBestTokenForModel("claude-opus-4-1-20250805")
+	require.NoError(t, err)
+	assert.Equal(t, "opus", token.AccessToken)
+
+	// 跳过仅支持 opus 的账号，且不标记耗尽、不移动当前索引
+	token, err = tm.getBestTokenForModel("claude-sonnet-4-5-20250929")
+	require.NoError(t, err)
+	assert.Equal(t, "any", token.AccessToken)
+	assert.False(t, tm.exhausted["token_0"])
+	assert.Equal(t, 0, tm.currentIndex)
+
+	// 不限模型时按原顺序选择
+	token, err = tm.getBestToken()
+	require.NoError(t, err)
+	assert.Equal(t, "opus", token.AccessToken)
+
+	// 支持该模型的账号耗尽：返回池耗尽而非无可用账号
+	tm.cache.tokens["token_1"].Available = 0
+	_, err = tm.getBestTokenForModel("claude-sonnet-4-5-20250929")
+	assert.ErrorIs(t, err, ErrTokenPoolExhausted)
+	assert.NotErrorIs(t, err, ErrNoEligibleToken)
+
+	// 禁用唯一支持 sonnet 的账号后：没有可用账号
+	tm.configs[1].Disabled = true
+	_, err = tm.getBestTokenForModel("claude-sonnet-4-5-20250929")
+	assert.ErrorIs(t, err, ErrNoEligibleToken)
+}
+
+func TestAuthConfig_SupportsModel(t *testing.T) {
+	assert.True(t, AuthConfig{}.SupportsModel("claude-opus-4-1-20250805"))
+	cfg := AuthConfig{Models: []string{"sonnet", "claude-3-7-sonnet-20250219"}}
+	assert.True(t, cfg.SupportsModel("claude-sonnet-4-20250514"))
+	assert.True(t, cfg.SupportsModel("CLAUDE-SONNET-4-5"))
+	assert.False(t, cfg.SupportsModel("claude-haiku-4-5-20251001"))
+	assert.True(t, cfg.SupportsModel(""))
+}
+
+func TestAuthConfig_SupportsModelRouteTags(t *testing.T) {
+	original := config.CurrentModelTable()
+	t.Cleanup(func() { config.SetModelTable(original) })
+	table, err := config.NewModelTable(map[string]config.ModelRoute{
+		"premium": {Alias: "claude-opus-4-5", Tags: []string{"primary"}},
+		"fast":    {Alias: "claude-haiku-4-5-20251001"},
+	})
+	require.NoError(t, err)
+	config.SetModelTable(table)
+
+	primary := AuthConfig{Tags: []string{"primary"}}
+	backup := AuthConfig{Tags: []string{"backup"}}
+	assert.True(t, primary.SupportsModel("premium"))
+	assert.False(t, backup.SupportsModel("premium"), "路由表限制标签时不带该标签的账号不可用")
+	assert.True(t, backup.SupportsModel("claude-opus-4-5"), "标签限制只作用于配置了标签的模型名")
+
+	haikuOnly := AuthConfig{Models: []string{"haiku"}}
+	assert.True(t, haikuOnly.SupportsModel("fast"), "别名按目标模型识别系列")
+	assert.False(t, haikuOnly.SupportsModel("premium"))
+}
+
+func TestTokenManager_LazyWarmup(t *testing.T) {
+	t.Setenv("LAZY_WARMUP", "true")
+	tm := NewTokenManager([]AuthConfig{{ID: "a", RefreshToken: "a"}, {ID: "b", RefreshToken: "b"}})
+	require.True(t, tm.Lazy())
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	original := fetchCachedTokenFunc
+	fetchCachedTokenFunc = func(_ *TokenManager, cfg AuthConfig) (*CachedToken, error) {
+		mu.Lock()
+		calls[cfg.ID]++
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		if cfg.ID == "a" {
+			return nil, fmt.Errorf("refresh failed")
+		}
+		return &CachedToken{Token: types.TokenInfo{AccessToken: cfg.ID, ConfigID: cfg.ID, ExpiresAt: time.Now().Add(time.Hour)}, CachedAt: time.Now(), Available: 100}, nil
+	}
+	t.Cleanup(func() { fetchCachedTokenFunc = original })
+
+	// 并发的首次请求：每个账号只刷新一次，a 失败后回退到 b
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			token, err := tm.getBestToken()
+			assert.NoError(t, err)
+			assert.Equal(t, "b", token.AccessToken)
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 1, calls["a"])
+	assert.Equal(t, 1, calls["b"])
+	assert.True(t, tm.lastRefresh.IsZero(), "懒加载模式不做整体刷新")
+
+	// 缓存周期内不重复刷新失败的账号
+	_, err := tm.getBestToken()
+	require.NoError(t, err)
+	assert.Equal(t, 1, calls["a"])
+}
+
+func TestAuthService_ProbeUsage(t *testing.T) {
+	as := NewAuthServiceWithConfigs([]AuthConfig{{ID: "a", AuthType: AuthMethodSocial, RefreshToken: "rt"}}, "")
+	tm := as.GetTokenManager()
+	tm.cache.tokens["token_0"] = &CachedToken{
+		Token:     types.TokenInfo{AccessToken: "cached", ConfigID: "a", ExpiresAt: time.Now().Add(time.Hour)},
+		CachedAt:  time.Now(),
+		Available: 100,
+	}
+
+	var used string
+	original := checkUsageLimitsFunc
+	checkUsageLimitsFunc = func(token types.TokenInfo) (*types.UsageLimits, error) {
+		used = token.AccessToken
+		return &types.UsageLimits{UsageBreakdownList: []types.UsageBreakdown{
+			{ResourceType: "CREDIT", UsageLimitWithPrecision: 50, CurrentUsageWithPrecision: 50},
+		}}, nil
+	}
+	t.Cleanup(func() { checkUsageLimitsFunc = original })
+
+	usage, err := as.ProbeUsage("a")
+	require.NoError(t, err)
+	require.NotNil(t, usage)
+	assert.Equal(t, "cached", used, "复用缓存中未过期的访问令牌")
+	assert.Equal(t, float64(0), tm.cache.tokens["token_0"].Available, "查询结果写回轮换使用的额度")
+	assert.Same(t, usage, tm.cache.tokens["token_0"].UsageInfo)
+
+	_, err = as.ProbeUsage("missing")
+	assert.ErrorIs(t, err, ErrConfigNotFound)
+}
+
+func TestRefreshScheduler_DueTargets(t *testing.T) {
+	tm := NewTokenManager([]AuthConfig{
+		{ID: "due", RefreshToken: "a"},
+		{ID: "fresh", RefreshToken: "b"},
+		{ID: "missing", RefreshToken: "c"},
+		{ID: "off", RefreshToken: "d", Disabled: true},
+	})
+	now := time.Now()
+	// due 的访问令牌先于缓存到期：按令牌过期时间计划
+	tm.cache.tokens["token_0"] = &CachedToken{
+		Token:     types.TokenInfo{AccessToken: "old", ConfigID: "due", ExpiresAt: now.Add(config.TokenExpirySkew + 90*time.Second)},
+		CachedAt:  now,
+		Available: 10,
+	}
+	tm.cache.tokens["token_1"] = &CachedToken{
+		Token:     types.TokenInfo{AccessToken: "b", ConfigID: "fresh", ExpiresAt: now.Add(time.Hour)},
+		CachedAt:  now,
+		Available: 10,
+	}
+
+	var refreshed []string
+	original := fetchCachedTokenFunc
+	fetchCachedTokenFunc = func(_ *TokenManager, cfg AuthConfig) (*CachedToken, error) {
+		refreshed = append(refreshed, cfg.ID)
+		if cfg.ID == "missing" {
+			return nil, fmt.Errorf("refresh failed")
+		}
+		return &CachedToken{Token: types.TokenInfo{AccessToken: "new", ConfigID: cfg.ID, ExpiresAt: now.Add(time.Hour)}, CachedAt: now, Available: 10}, nil
+	}
+	t.Cleanup(func() { fetchCachedTokenFunc = original })
+
+	s := newRefreshScheduler(tm, RefreshSchedule{Margin: time.Minute, Jitter: 20 * time.Second})
+	s.jitter = func(max time.Duration) time.Duration { return max }
+
+	s.refreshDue(now)
+	assert.Equal(t, []string{"missing"}, refreshed, "未缓存的账号立即刷新，其余未到计划时间")
+
+	refreshed = nil
+	s.refreshDue(now.Add(9 * time.Second))
+	assert.Empty(t, refreshed, "过期前 margin+jitter（80秒）之前不刷新，失败的账号在缓存周期内不重试")
+
+	s.refreshDue(now.Add(10 * time.Second))
+	assert.Equal(t, []string{"due"}, refreshed)
+	assert.Equal(t, "new", tm.cache.tokens["token_0"].Token.AccessToken)
+
+	refreshed = nil
+	s.refreshDue(now.Add(11 * time.Second))
+	assert.Empty(t, refreshed, "新token按新的过期时间重新计划")
+}
+
+func TestTokenManager_ScheduledSkipsFullRefresh(t *testing.T) {
+	tm := NewTokenManager([]AuthConfig{{ID: "a", RefreshToken: "a"}})
+	tm.scheduled = true
+	assert.True(t, tm.needsFullRefreshUnlocked(), "尚未整体刷新过时同步刷新")
+	tm.lastRefresh = time.Now().Add(-time.Hour)
+	assert.False(t, tm.needsFullRefreshUnlocked(), "启用主动刷新后不因缓存周期整体刷新")
+
+	tm.scheduled = false
+	assert.True(t, tm.needsFullRefreshUnlocked())
+
+	t.Setenv("TOKEN_REFRESH_MARGIN_SECONDS", "280")
+	_, err := LoadRefreshScheduleFromEnv()
+	assert.Error(t, err, "margin+jitter 不小于缓存周期")
+}
+
+func TestAuthService_SaveRotatedRefreshToken(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "auth_config.json")
+	as := NewAuthServiceWithConfigs([]AuthConfig{{ID: "a", AuthType: AuthMethodSocial, RefreshToken: "old"}}, configPath)
+	cfg, _ := as.GetConfigByID("a")
+
+	require.NoError(t, as.SaveRotatedRefreshToken(cfg, types.TokenInfo{RefreshToken: "old"}))
+	_, err := os.Stat(configPath)
+	assert.True(t, os.IsNotExist(err), "未轮换时不写配置")
+
+	require.NoError(t, as.SaveRotatedRefreshToken(cfg, types.TokenInfo{RefreshToken: "new"}))
+	updated, _ := as.GetConfigByID("a")
+	assert.Equal(t, "new", updated.RefreshToken)
+	assert.Equal(t, "new", as.GetTokenManager().configs[0].RefreshToken, "后续刷新使用新的refresh token")
+	saved, err := NewFileConfigSource(configPath).Load()
+	require.NoError(t, err)
+	assert.Equal(t, "new", saved[0].RefreshToken, "立即持久化")
+
+	// 用旧值刷新得到的结果晚于更新的轮换到达时不覆盖
+	require.NoError(t, as.SaveRotatedRefreshToken(cfg, types.TokenInfo{RefreshToken: "stale"}))
+	updated, _ = as.GetConfigByID("a")
+	assert.Equal(t, "new", updated.RefreshToken)
+}
+
+func TestTokenManager_PeekToken(t *testing.T) {
+	tm := NewTokenManager([]AuthConfig{{ID: "a", RefreshToken: "a"}, {ID: "b", RefreshToken: "b", Tags: []string{"team-b"}}})
+	tm.lastRefresh = time.Now()
+	expires := time.Now().Add(time.Hour)
+	tm.cache.tokens["token_0"] = &CachedToken{Token: types.TokenInfo{AccessToken: "a", ConfigID: "a", ExpiresAt: expires}, CachedAt: time.Now(), Available: 0}
+	tm.cache.tokens["token_1"] = &CachedToken{Token: types.TokenInfo{AccessToken: "b", ConfigID: "b", ExpiresAt: expires}, CachedAt: time.Now(), Available: 5}
+
+	// 预览跳过额度用尽的 a，但不标记耗尽、不移动索引、不扣减可用次数
+	token, err := tm.PeekTokenForTags("", "", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "b", token.AccessToken)
+	assert.Empty(t, tm.exhausted)
+	assert.Equal(t, 0, tm.currentIndex)
+	assert.Equal(t, float64(5), tm.cache.tokens["token_1"].Available)
+
+	token, err = tm.PeekTokenForTags("", "b", []string{"team-b"})
+	require.NoError(t, err)
+	assert.Equal(t, "b", token.ConfigID)
+
+	_, err = tm.PeekTokenForTags("", "", []string{"team-c"})
+	assert.ErrorIs(t, err, ErrNoEligibleToken)
+
+	tm.cache.tokens["token_1"].Available = 0
+	_, err = tm.PeekTokenForTags("", "", nil)
+	assert.ErrorIs(t, err, ErrTokenPoolExhausted)
+}
@@ -0,0 +1,147 @@
+package auth
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"kiro2api/logger"
+	"kiro2api/utils"
+)
+
+// ExportFormatVersion 导出文件格式版本
+const ExportFormatVersion = 1
+
+// maskedSecretMarker 脱敏字段中的省略标记，导入时据此拒绝脱敏数据
+const maskedSecretMarker = "****"
+
+// PoolExport Token池导出文件（面向人工迁移，可直接导入另一实例）
+type PoolExport struct {
+	Version    int          `json:"version"`
+	ExportedAt time.Time    `json:"exported_at"`
+	Masked     bool         `json:"masked"`
+	Accounts   []AuthConfig `json:"accounts"`
+}
+
+// ImportResult 批量导入结果
+type ImportResult struct {
+	Imported    int               `json:"imported"`
+	Duplicates  int               `json:"duplicates"`
+	DuplicateOf []ImportDuplicate `json:"duplicate_of,omitempty"`
+	Invalid     []ImportError     `json:"invalid,omitempty"`
+	Total       int               `json:"total"`
+}
+
+// ImportDuplicate 与已有账号（或导入内容中更早的条目）重复而跳过的条目
+type ImportDuplicate struct {
+	Index      int    `json:"index"`
+	ExistingID string `json:"existing_id"`
+}
+
+// ImportError 单条导入失败原因
+type ImportError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// MaskSecret 脱敏密钥：保留首尾各4位
+func MaskSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	if len(secret) <= 8 {
+		return maskedSecretMarker
+	}
+	return secret[:4] + maskedSecretMarker + secret[len(secret)-4:]
+}
+
+// Export 导出当前Token池配置，mask=true 时脱敏密钥字段
+func (as *AuthService) Export(mask bool) PoolExport {
+	accounts := as.GetConfigs()
+
+	if mask {
+		for i := range accounts {
+			accounts[i].RefreshToken = MaskSecret(accounts[i].RefreshToken)
+			accounts[i].ClientSecret = MaskSecret(accounts[i].ClientSecret)
+		}
+	}
+
+	return PoolExport{
+		Version:    ExportFormatVersion,
+		ExportedAt: time.Now().UTC(),
+		Masked:     mask,
+		Accounts:   accounts,
+	}
+}
+
+// Import 批量导入配置：按refreshToken哈希与现有配置及批内去重，一次性持久化
+func (as *AuthService) Import(configs []AuthConfig) (ImportResult, error) {
+	result := ImportResult{Total: len(configs)}
+
+	as.updateMu.Lock()
+	defer as.updateMu.Unlock()
+
+	if as.ReadOnly() {
+		return result, ErrReadOnly
+	}
+	current, _ := as.snapshot()
+
+	seen := make(map[string]string, len(current)+len(configs)) // refreshToken哈希 -> 账号ID
+	seenIDs := make(map[string]bool, len(current)+len(configs))
+	for _, existing := range current {
+		seen[refreshTokenHash(existing.RefreshToken)] = existing.ID
+		seenIDs[existing.ID] = true
+	}
+
+	accepted := make([]AuthConfig, 0, len(configs))
+	for i, cfg := range configs {
+		if strings.Contains(cfg.RefreshToken, maskedSecretMarker) || strings.Contains(cfg.ClientSecret, maskedSecretMarker) {
+			result.Invalid = append(result.Invalid, ImportError{Index: i, Error: "配置包含脱敏字段，无法导入"})
+			continue
+		}
+
+		normalized, err := normalizeConfig(cfg)
+		if err != nil {
+			result.Invalid = append(result.Invalid, ImportError{Index: i, Error: err.Error()})
+			continue
+		}
+
+		hash := refreshTokenHash(normalized.RefreshToken)
+		if existingID, dup := seen[hash]; dup {
+			result.Duplicates++
+			result.DuplicateOf = append(result.DuplicateOf, ImportDuplicate{Index: i, ExistingID: existingID})
+			continue
+		}
+		// 保留导入文件中的ID，冲突时重新分配
+		if seenIDs[normalized.ID] {
+			normalized.ID = utils.GenerateUUID()
+		}
+		seen[hash] = normalized.ID
+		seenIDs[normalized.ID] = true
+		accepted = append(accepted, normalized)
+	}
+
+	if len(accepted) == 0 {
+		return result, nil
+	}
+
+	merged := make([]AuthConfig, 0, len(current)+len(accepted))
+	merged = append(merged, current...)
+	merged = append(merged, accepted...)
+
+	if err := as.source.Save(merged); err != nil {
+		return result, fmt.Errorf("持久化配置失败: %w", err)
+	}
+
+	as.commit(merged, as.newTokenManager(merged))
+	result.Imported = len(accepted)
+
+	logger.Info("批量导入认证配置",
+		logger.Int("imported", result.Imported),
+		logger.Int("duplicates", result.Duplicates),
+		logger.Int("invalid", len(result.Invalid)),
+		logger.Int("total_configs", len(merged)),
+		logger.String("config_source", as.source.Location()))
+
+	return result, nil
+}
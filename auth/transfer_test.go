@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaskSecret(t *testing.T) {
+	assert.Equal(t, "", MaskSecret(""))
+	assert.Equal(t, "****", MaskSecret("short"))
+	assert.Equal(t, "abcd****wxyz", MaskSecret("abcdefghijklmnopqrstuvwxyz"))
+}
+
+func TestExport_Masked(t *testing.T) {
+	as := NewAuthServiceWithConfigs([]AuthConfig{
+		{AuthType: AuthMethodIdC, RefreshToken: "refresh_token_value", ClientID: "cid", ClientSecret: "client_secret_value"},
+	}, "")
+
+	plain := as.Export(false)
+	assert.False(t, plain.Masked)
+	assert.Equal(t, "refresh_token_value", plain.Accounts[0].RefreshToken)
+
+	masked := as.Export(true)
+	assert.True(t, masked.Masked)
+	assert.Equal(t, ExportFormatVersion, masked.Version)
+	assert.NotContains(t, masked.Accounts[0].RefreshToken, "token_val")
+	assert.NotContains(t, masked.Accounts[0].ClientSecret, "secret_val")
+
+	// 导出不应修改原配置
+	assert.Equal(t, "refresh_token_value", as.GetConfigs()[0].RefreshToken)
+}
+
+func TestImport_DedupAndPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "auth_config.json")
+	as := NewAuthServiceWithConfigs([]AuthConfig{
+		{ID: "existing-id", AuthType: AuthMethodSocial, RefreshToken: "existing"},
+	}, path)
+
+	result, err := as.Import([]AuthConfig{
+		{RefreshToken: "existing"},
+		{RefreshToken: "new_one"},
+		{RefreshToken: "new_one"},
+		{AuthType: AuthMethodIdC, RefreshToken: "idc_without_client"},
+		{RefreshToken: "abcd****wxyz"},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 5, result.Total)
+	assert.Equal(t, 1, result.Imported)
+	assert.Equal(t, 2, result.Duplicates)
+	require.Len(t, result.DuplicateOf, 2)
+	assert.Equal(t, ImportDuplicate{Index: 0, ExistingID: "existing-id"}, result.DuplicateOf[0])
+	assert.Equal(t, 2, result.DuplicateOf[1].Index)
+	assert.Equal(t, as.GetConfigs()[1].ID, result.DuplicateOf[1].ExistingID, "批内重复指向先导入的条目")
+	require.Len(t, result.Invalid, 2)
+	assert.Equal(t, 3, result.Invalid[0].Index)
+	assert.Equal(t, 4, result.Invalid[1].Index)
+
+	assert.Equal(t, 2, as.GetConfigCount())
+	assert.Equal(t, AuthMethodSocial, as.GetConfigs()[1].AuthType)
+
+	saved, err := loadConfigsFromFile(path)
+	require.NoError(t, err)
+	assert.Len(t, saved, 2)
+}
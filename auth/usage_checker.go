@@ -3,6 +3,7 @@ package auth
 import (
 	"fmt"
 	"io"
+	"kiro2api/config"
 	"kiro2api/logger"
 	"kiro2api/types"
 	"kiro2api/utils"
@@ -26,7 +27,7 @@ func NewUsageLimitsChecker() *UsageLimitsChecker {
 // CheckUsageLimits 检���token的使用限制 (基于token.md API规范)
 func (c *UsageLimitsChecker) CheckUsageLimits(token types.TokenInfo) (*types.UsageLimits, error) {
 	// 构建请求URL (完全遵循token.md中的示例)
-	baseURL := "https://codewhisperer.us-east-1.amazonaws.com/getUsageLimits"
+	baseURL := config.UsageLimitsURL
 	params := url.Values{}
 	params.Add("isEmailRequired", "true")
 	params.Add("origin", "AI_EDITOR")
@@ -54,7 +55,17 @@ func (c *UsageLimitsChecker) CheckUsageLimits(token types.TokenInfo) (*types.Usa
 		logger.String("url", requestURL),
 		logger.String("token_preview", token.AccessToken[:20]+"..."))
 
-	resp, err := c.httpClient.Do(req)
+	// 使用token所属配置的出站代理
+	client := c.httpClient
+	if token.ProxyURL != "" {
+		proxyClient, err := utils.HTTPClientForProxy(token.ProxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("使用限制检查代理配置无效: %w", err)
+		}
+		client = proxyClient
+	}
+
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("使用限制检查请求失败: %v", err)
 	}
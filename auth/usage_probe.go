@@ -0,0 +1,78 @@
+package auth
+
+import (
+	"fmt"
+
+	"kiro2api/logger"
+	"kiro2api/types"
+)
+
+// checkUsageLimitsFunc 查询上游使用限制的入口（可在测试中替换）
+var checkUsageLimitsFunc = func(token types.TokenInfo) (*types.UsageLimits, error) {
+	return NewUsageLimitsChecker().CheckUsageLimits(token)
+}
+
+// ProbeUsage 向上游查询指定账号的实时使用限制
+// 优先复用缓存中未过期的访问令牌，没有时刷新一次；查询结果同步写回token缓存，使轮换按真实剩余额度选择账号
+func (as *AuthService) ProbeUsage(id string) (*types.UsageLimits, error) {
+	cfg, ok := as.GetConfigByID(id)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrConfigNotFound, id)
+	}
+	tm := as.GetTokenManager()
+	if tm == nil {
+		return nil, fmt.Errorf("token管理器未初始化")
+	}
+
+	token, ok := tm.cachedAccessToken(id)
+	if !ok {
+		refreshed, err := tm.refreshSingleToken(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("刷新token失败: %w", err)
+		}
+		token = refreshed
+	}
+
+	usage, err := checkUsageLimitsFunc(token)
+	if err != nil {
+		return nil, fmt.Errorf("查询使用限制失败: %w", err)
+	}
+	tm.RecordUsage(cfg, usage)
+	return usage, nil
+}
+
+// cachedAccessToken 返回账号缓存中仍在有效期内的访问令牌
+func (tm *TokenManager) cachedAccessToken(configID string) (types.TokenInfo, bool) {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+	for _, cached := range tm.cache.tokens {
+		if cached.Token.ConfigID == configID && !cached.Token.IsExpired() {
+			return cached.Token, true
+		}
+	}
+	return types.TokenInfo{}, false
+}
+
+// RecordUsage 用上游查询到的使用限制更新账号的缓存额度（账号未缓存时不做处理）
+func (tm *TokenManager) RecordUsage(cfg AuthConfig, usage *types.UsageLimits) {
+	available := CalculateAvailableCount(usage)
+
+	tm.mutex.Lock()
+	updated := false
+	for _, cached := range tm.cache.tokens {
+		if cached.Token.ConfigID != cfg.ID {
+			continue
+		}
+		cached.UsageInfo = usage
+		cached.Available = available
+		updated = true
+	}
+	tm.mutex.Unlock()
+
+	if updated {
+		logger.Debug("已用上游使用限制更新token额度",
+			logger.String("config_id", cfg.ID),
+			logger.Float64("available", available))
+		emitQuotaIfExhausted(cfg, available)
+	}
+}
@@ -0,0 +1,250 @@
+package breaker
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"kiro2api/logger"
+)
+
+// 熔断器状态
+const (
+	StateClosed   = "closed"    // 正常放行
+	StateOpen     = "open"      // 熔断中，拒绝请求
+	StateHalfOpen = "half_open" // 冷却结束，放行单个探测请求
+)
+
+// Snapshot 熔断器状态快照
+type Snapshot struct {
+	Key                 string    `json:"key"`
+	State               string    `json:"state"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	OpenedAt            time.Time `json:"opened_at,omitempty"`
+	RetryAt             time.Time `json:"retry_at,omitempty"`
+	LastError           string    `json:"last_error,omitempty"`
+	LastErrorAt         time.Time `json:"last_error_at,omitempty"`
+	TotalOpens          int       `json:"total_opens"`
+}
+
+// Breaker 单个熔断器
+// 连续失败达到阈值后打开；冷却结束后进入半开，仅放行一个探测请求：
+// 探测成功则关闭，失败则重新打开
+type Breaker struct {
+	mu        sync.Mutex
+	key       string
+	threshold int
+	cooldown  time.Duration
+
+	state       string
+	failures    int
+	openedAt    time.Time
+	probeAt     time.Time // 半开探测请求的放行时间，零值表示无探测进行中
+	lastError   string
+	lastErrorAt time.Time
+	totalOpens  int
+}
+
+// newBreaker 创建熔断器
+func newBreaker(key string, threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{key: key, threshold: threshold, cooldown: cooldown, state: StateClosed}
+}
+
+// Allow 判断是否放行请求，半开状态下会占用唯一的探测名额
+func (b *Breaker) Allow(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if now.Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = StateHalfOpen
+		b.probeAt = now
+		logger.Info("熔断器进入半开状态，放行探测请求", logger.String("key", b.key))
+		return true
+	case StateHalfOpen:
+		// 探测请求未上报结果（如请求构建失败）超过冷却时间后允许新的探测
+		if !b.probeAt.IsZero() && now.Sub(b.probeAt) < b.cooldown {
+			return false
+		}
+		b.probeAt = now
+		return true
+	default:
+		return true
+	}
+}
+
+// Available 判断当前是否可放行请求（只读，不占用探测名额）
+func (b *Breaker) Available(now time.Time) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		return now.Sub(b.openedAt) >= b.cooldown
+	case StateHalfOpen:
+		return b.probeAt.IsZero() || now.Sub(b.probeAt) >= b.cooldown
+	default:
+		return true
+	}
+}
+
+// RecordSuccess 记录成功调用，关闭熔断器
+func (b *Breaker) RecordSuccess() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != StateClosed {
+		logger.Info("熔断器恢复关闭", logger.String("key", b.key), logger.String("from", b.state))
+	}
+	b.state = StateClosed
+	b.failures = 0
+	b.probeAt = time.Time{}
+}
+
+// RecordFailure 记录失败调用（5xx/超时），达到阈值或半开探测失败时打开熔断器
+func (b *Breaker) RecordFailure(now time.Time, errMsg string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.lastError = errMsg
+	b.lastErrorAt = now
+
+	if b.state == StateHalfOpen || (b.state == StateClosed && b.failures >= b.threshold) {
+		b.state = StateOpen
+		b.openedAt = now
+		b.probeAt = time.Time{}
+		b.totalOpens++
+		logger.Warn("熔断器打开，暂停向该上游发送请求",
+			logger.String("key", b.key),
+			logger.Int("consecutive_failures", b.failures),
+			logger.Duration("cooldown", b.cooldown),
+			logger.String("last_error", errMsg))
+	}
+}
+
+// Snapshot 返回状态快照
+func (b *Breaker) Snapshot() Snapshot {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := Snapshot{
+		Key:                 b.key,
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastError,
+		LastErrorAt:         b.lastErrorAt,
+		TotalOpens:          b.totalOpens,
+	}
+	if b.state != StateClosed {
+		s.OpenedAt = b.openedAt
+		s.RetryAt = b.openedAt.Add(b.cooldown)
+	}
+	return s
+}
+
+// Set 按 token 与上游端点分组的熔断器集合
+type Set struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	breakers  map[string]*Breaker
+}
+
+// NewSet 创建熔断器集合
+func NewSet(threshold int, cooldown time.Duration) *Set {
+	if threshold < 1 {
+		threshold = 1
+	}
+	return &Set{
+		threshold: threshold,
+		cooldown:  cooldown,
+		breakers:  make(map[string]*Breaker),
+	}
+}
+
+// Key 生成熔断器键：token标识@上游端点
+func Key(tokenID, endpoint string) string {
+	return tokenID + "@" + endpoint
+}
+
+// SplitKey 拆分熔断器键为token标识与上游端点
+func SplitKey(key string) (tokenID, endpoint string) {
+	tokenID, endpoint, _ = strings.Cut(key, "@")
+	return tokenID, endpoint
+}
+
+// get 获取或创建熔断器
+func (s *Set) get(key string) *Breaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, ok := s.breakers[key]
+	if !ok {
+		b = newBreaker(key, s.threshold, s.cooldown)
+		s.breakers[key] = b
+	}
+	return b
+}
+
+// lookup 获取已存在的熔断器，不存在时返回 nil
+func (s *Set) lookup(key string) *Breaker {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.breakers[key]
+}
+
+// Allow 判断是否放行请求（未记录过的键视为关闭）
+func (s *Set) Allow(key string) bool {
+	b := s.lookup(key)
+	return b == nil || b.Allow(time.Now())
+}
+
+// Available 只读判断是否可放行请求
+func (s *Set) Available(key string) bool {
+	b := s.lookup(key)
+	return b == nil || b.Available(time.Now())
+}
+
+// RecordSuccess 记录成功调用
+func (s *Set) RecordSuccess(key string) {
+	if b := s.lookup(key); b != nil {
+		b.RecordSuccess()
+	}
+}
+
+// RecordFailure 记录失败调用
+func (s *Set) RecordFailure(key, errMsg string) {
+	s.get(key).RecordFailure(time.Now(), errMsg)
+}
+
+// Snapshots 返回所有熔断器的状态快照（按键排序）
+func (s *Set) Snapshots() []Snapshot {
+	s.mu.Lock()
+	breakers := make([]*Breaker, 0, len(s.breakers))
+	for _, b := range s.breakers {
+		breakers = append(breakers, b)
+	}
+	s.mu.Unlock()
+
+	out := make([]Snapshot, 0, len(breakers))
+	for _, b := range breakers {
+		out = append(out, b.Snapshot())
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// Threshold 打开熔断器所需的连续失败次数
+func (s *Set) Threshold() int {
+	return s.threshold
+}
+
+// Cooldown 熔断器打开后进入半开前的冷却时间
+func (s *Set) Cooldown() time.Duration {
+	return s.cooldown
+}
@@ -0,0 +1,87 @@
+package breaker
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBreaker_OpensAfterConsecutiveFailures(t *testing.T) {
+	b := newBreaker("t@e", 3, time.Minute)
+	now := time.Now()
+
+	b.RecordFailure(now, "500")
+	b.RecordFailure(now, "500")
+	assert.True(t, b.Allow(now))
+
+	// 成功会清零连续失败计数
+	b.RecordSuccess()
+	b.RecordFailure(now, "500")
+	b.RecordFailure(now, "500")
+	assert.Equal(t, StateClosed, b.Snapshot().State)
+
+	b.RecordFailure(now, "timeout")
+	snap := b.Snapshot()
+	assert.Equal(t, StateOpen, snap.State)
+	assert.Equal(t, "timeout", snap.LastError)
+	assert.Equal(t, now.Add(time.Minute), snap.RetryAt)
+	assert.False(t, b.Allow(now.Add(30*time.Second)))
+	assert.False(t, b.Available(now.Add(30*time.Second)))
+}
+
+func TestBreaker_HalfOpenSingleProbe(t *testing.T) {
+	b := newBreaker("t@e", 1, time.Minute)
+	now := time.Now()
+	b.RecordFailure(now, "502")
+
+	later := now.Add(time.Minute)
+	assert.True(t, b.Available(later))
+	require.True(t, b.Allow(later), "冷却结束后放行探测请求")
+	assert.Equal(t, StateHalfOpen, b.Snapshot().State)
+	assert.False(t, b.Allow(later), "探测进行中不放行其他请求")
+
+	// 探测失败重新打开
+	b.RecordFailure(later, "503")
+	assert.Equal(t, StateOpen, b.Snapshot().State)
+	assert.Equal(t, 2, b.Snapshot().TotalOpens)
+
+	// 再次冷却后探测成功则关闭
+	again := later.Add(time.Minute)
+	require.True(t, b.Allow(again))
+	b.RecordSuccess()
+	assert.Equal(t, StateClosed, b.Snapshot().State)
+	assert.True(t, b.Allow(again))
+}
+
+func TestBreaker_StaleProbeReleased(t *testing.T) {
+	b := newBreaker("t@e", 1, time.Minute)
+	now := time.Now()
+	b.RecordFailure(now, "500")
+
+	require.True(t, b.Allow(now.Add(time.Minute)))
+	// 探测请求未上报结果，超过冷却时间后允许新的探测
+	assert.True(t, b.Allow(now.Add(2*time.Minute)))
+}
+
+func TestSet_KeysAndSnapshots(t *testing.T) {
+	s := NewSet(1, time.Minute)
+
+	assert.True(t, s.Allow(Key("a", "https://x/y")), "未记录的键视为关闭")
+	s.RecordSuccess(Key("a", "https://x/y"))
+	assert.Empty(t, s.Snapshots(), "成功调用不创建熔断器")
+
+	s.RecordFailure(Key("b", "https://x/y"), "500")
+	s.RecordFailure(Key("a", "https://x/z"), "500")
+	assert.False(t, s.Allow(Key("b", "https://x/y")))
+	assert.True(t, s.Allow(Key("b", "https://x/other")), "不同端点独立熔断")
+
+	snaps := s.Snapshots()
+	require.Len(t, snaps, 2)
+	assert.Equal(t, Key("a", "https://x/z"), snaps[0].Key)
+
+	tokenID, endpoint := SplitKey(snaps[1].Key)
+	assert.Equal(t, "b", tokenID)
+	assert.Equal(t, "https://x/y", endpoint)
+}
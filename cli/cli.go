@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+const usage = `用法: kiro2api [命令] [参数]
+
+命令:
+  serve [端口]       启动服务（默认命令；端口默认 8080，环境变量 PORT 优先）
+  token <命令>       管理账号配置：list/add/remove/check（别名 tokens）
+  config validate    校验账号配置与服务启动配置，不启动服务
+  hash-password      从标准输入读取密码，生成管理员密码哈希（ADMIN_PASSWORD_HASH）
+  replay <捕获包>    离线回放请求捕获包，以当前代码重新执行转换
+  mockserver         启动模拟上游，用于无真实账号的本地开发与端到端测试
+  help               显示帮助
+
+各命令的参数见 kiro2api <命令> --help。
+`
+
+// IsServe 判断参数是否表示启动服务：无参数、serve 或旧版的端口参数（kiro2api 8080）
+func IsServe(args []string) bool {
+	if len(args) == 0 || args[0] == "serve" {
+		return true
+	}
+	_, err := strconv.Atoi(args[0])
+	return err == nil
+}
+
+// ServePort 解析服务端口：serve [端口] 或旧版的 kiro2api <端口>，环境变量 PORT 优先
+func ServePort(args []string) (string, error) {
+	if len(args) > 0 && args[0] == "serve" {
+		args = args[1:]
+	}
+	if len(args) > 1 {
+		return "", usageError("serve 最多接受一个端口参数")
+	}
+
+	port := "8080" // 默认端口
+	if len(args) == 1 {
+		if _, err := strconv.Atoi(args[0]); err != nil {
+			return "", usageError("无效的端口: " + args[0])
+		}
+		port = args[0]
+	}
+	// 从环境变量获取端口，覆盖命令行参数
+	if envPort := os.Getenv("PORT"); envPort != "" {
+		port = envPort
+	}
+	return port, nil
+}
+
+// Run 执行非服务类子命令（token/config/hash-password/replay/mockserver/help），返回进程退出码
+func Run(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	}
+	switch args[0] {
+	case "token", "tokens":
+		return RunTokens(args[1:], stdout, stderr)
+	case "config":
+		return RunConfig(args[1:], stdout, stderr)
+	case "hash-password":
+		return RunHashPassword(args[1:], stdout, stderr)
+	case "replay":
+		return RunReplay(args[1:], stdout, stderr)
+	case "mockserver":
+		return RunMockServer(args[1:], stdout, stderr)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitOK
+	default:
+		fmt.Fprintf(stderr, "未知命令: %s\n\n%s", args[0], usage)
+		return exitUsage
+	}
+}
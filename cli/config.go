@@ -0,0 +1,93 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"kiro2api/auth"
+	"kiro2api/server"
+
+	"github.com/gin-gonic/gin"
+)
+
+const configUsage = `用法: kiro2api config validate
+
+按服务启动时的规则校验配置，不启动服务、不写入任何文件：
+  - 账号配置：读取 KIRO_CONFIG_SOURCE 选择的存储，列出加载时会被跳过的无效账号与重复账号
+  - 启动配置：CORS、IP访问控制、TLS、限流、模型路由表、管理后台登录等环境变量与配置文件
+
+全部通过时退出码为 0，存在问题时为 1。
+`
+
+// 供测试替换的外部依赖
+var (
+	resolveConfigSource  = auth.ResolveConfigSource
+	validateServerConfig = server.ValidateConfig
+)
+
+// RunConfig 执行 config 子命令，返回进程退出码
+func RunConfig(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(stderr, configUsage)
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+	if args[0] != "validate" || len(args) > 1 {
+		fmt.Fprintf(stderr, "未知命令: %v\n\n%s", args, configUsage)
+		return exitUsage
+	}
+
+	// 校验可信代理时会创建 gin 引擎，避免调试模式的提示干扰命令输出
+	gin.SetMode(gin.ReleaseMode)
+
+	failed := validateAuthConfig(stdout)
+	for _, check := range validateServerConfig() {
+		if check.Err != nil {
+			failed++
+			fmt.Fprintf(stdout, "✗ %s: %v\n", check.Name, check.Err)
+			continue
+		}
+		fmt.Fprintf(stdout, "✓ %s\n", check.Name)
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(stderr, "错误: 发现%d个配置问题\n", failed)
+		return exitFailure
+	}
+	fmt.Fprintln(stdout, "配置校验通过")
+	return exitOK
+}
+
+// validateAuthConfig 读取账号配置存储并校验每个账号，返回问题数量
+func validateAuthConfig(stdout io.Writer) int {
+	source, err := resolveConfigSource()
+	if err != nil {
+		fmt.Fprintf(stdout, "✗ 账号配置: %v\n", err)
+		return 1
+	}
+
+	configs, err := source.Load()
+	if errors.Is(err, os.ErrNotExist) {
+		fmt.Fprintf(stdout, "✓ 账号配置: %s 不存在，服务将以空Token池启动\n", source.Location())
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(stdout, "✗ 账号配置: %s: %v\n", source.Location(), err)
+		return 1
+	}
+
+	problems := auth.ValidateConfigs(configs)
+	if len(problems) == 0 {
+		fmt.Fprintf(stdout, "✓ 账号配置: %s（%d个账号）\n", source.Location(), len(configs))
+		return 0
+	}
+	fmt.Fprintf(stdout, "✗ 账号配置: %s（%d个账号，%d个问题）\n", source.Location(), len(configs), len(problems))
+	for _, problem := range problems {
+		fmt.Fprintf(stdout, "    %v\n", problem)
+	}
+	return len(problems)
+}
@@ -0,0 +1,87 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+
+	"kiro2api/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubServerConfig 替换服务端配置校验结果
+func stubServerConfig(t *testing.T, checks ...server.ConfigCheck) {
+	t.Helper()
+	orig := validateServerConfig
+	validateServerConfig = func() []server.ConfigCheck { return checks }
+	t.Cleanup(func() { validateServerConfig = orig })
+}
+
+func runCLI(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	code := Run(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestConfigValidate(t *testing.T) {
+	path := setupStore(t)
+	stubServerConfig(t, server.ConfigCheck{Name: "CORS"})
+
+	code, out, errOut := runCLI("config", "validate")
+	require.Equal(t, exitOK, code, errOut)
+	assert.Contains(t, out, "不存在，服务将以空Token池启动")
+	assert.Contains(t, out, "✓ CORS")
+
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"id":"a","refreshToken":"rt-1"},
+		{"id":"a","refreshToken":"rt-2"},
+		{"refreshToken":"rt-1"},
+		{"auth":"IdC","refreshToken":"rt-3"}
+	]`), 0o600))
+	stubServerConfig(t, server.ConfigCheck{Name: "TLS", Err: errors.New("TLS_CERT_FILE 与 TLS_KEY_FILE 必须同时设置")})
+
+	code, out, errOut = runCLI("config", "validate")
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, out, "4个账号，3个问题")
+	assert.Contains(t, out, "ID与第1个账号重复")
+	assert.Contains(t, out, "第3个账号: refreshToken与第1个账号重复")
+	assert.Contains(t, out, "clientId")
+	assert.Contains(t, out, "✗ TLS")
+	assert.Contains(t, errOut, "发现4个配置问题")
+	assert.Contains(t, string(mustReadFile(t, path)), `"id":"a"`, "校验不写回配置")
+}
+
+func mustReadFile(t *testing.T, path string) []byte {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return content
+}
+
+func TestRun_Dispatch(t *testing.T) {
+	assert.True(t, IsServe(nil))
+	assert.True(t, IsServe([]string{"serve"}))
+	assert.True(t, IsServe([]string{"9090"}), "兼容旧版端口参数")
+	assert.False(t, IsServe([]string{"token", "list"}))
+
+	t.Setenv("PORT", "")
+	port, err := ServePort([]string{"serve", "9090"})
+	require.NoError(t, err)
+	assert.Equal(t, "9090", port)
+	_, err = ServePort([]string{"serve", "abc"})
+	assert.Error(t, err)
+	t.Setenv("PORT", "7000")
+	port, _ = ServePort([]string{"9090"})
+	assert.Equal(t, "7000", port, "环境变量 PORT 优先")
+
+	code, out, _ := runCLI("help")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, out, "config validate")
+	code, _, _ = runCLI("bogus")
+	assert.Equal(t, exitUsage, code)
+	code, _, _ = runCLI("config", "lint")
+	assert.Equal(t, exitUsage, code)
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"kiro2api/mockserver"
+)
+
+const mockserverUsage = `用法: kiro2api mockserver [参数]
+
+启动模拟上游服务（Social/IdC token刷新、流式推理、使用限制查询），以预置的事件流响应，
+用于无真实账号的本地开发与端到端测试。另一个终端中将服务的上游指向它：
+
+  UPSTREAM_BASE_URL=http://127.0.0.1:9090 \
+  KIRO_AUTH_TOKEN='[{"auth":"Social","refreshToken":"mock-refresh"}]' kiro2api
+
+任意 refreshToken 都能刷新成功，以 invalid 开头的除外（模拟失效账号）。
+在用户消息中写入 [mock:<场景>] 选择推理响应，未标记时使用默认场景：
+  echo            分块回显用户消息（默认）
+  tool            调用请求中的第一个工具
+  throttle        429 限流
+  content_length  400 输入超过上游长度上限
+  expired         403 token失效
+  error           500 上游内部错误
+
+参数:
+  --listen <地址>           监听地址（默认 127.0.0.1:9090）
+  --scenarios <目录>        额外场景目录：每个 *.json 为一个场景，文件名即场景名，
+                            格式与 server/testdata/sse_conformance 中的用例相同
+  --default <场景>          未标记场景时使用的场景（默认 echo）
+  --chunk-delay <时长>      事件帧之间的间隔，如 50ms（默认 0）
+`
+
+// 供测试替换的外部依赖
+var serveMockUpstream = func(ctx context.Context, addr string, handler http.Handler, ready func(net.Addr)) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("监听 %s 失败: %w", addr, err)
+	}
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+	ready(listener.Addr())
+	if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// RunMockServer 执行 mockserver 子命令，收到 SIGINT/SIGTERM 时退出，返回进程退出码
+func RunMockServer(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("kiro2api mockserver", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	listen := fs.String("listen", "127.0.0.1:9090", "监听地址")
+	scenariosDir := fs.String("scenarios", "", "额外场景目录")
+	defaultScenario := fs.String("default", mockserver.ScenarioEcho, "默认场景")
+	chunkDelay := fs.Duration("chunk-delay", 0, "事件帧之间的间隔")
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprint(stderr, mockserverUsage)
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() != 0 || *chunkDelay < 0 {
+		fmt.Fprint(stderr, mockserverUsage)
+		return exitUsage
+	}
+
+	opts := mockserver.Options{DefaultScenario: *defaultScenario, ChunkDelay: *chunkDelay}
+	if *scenariosDir != "" {
+		scenarios, err := mockserver.LoadScenarios(*scenariosDir)
+		if err != nil {
+			fmt.Fprintf(stderr, "错误: %v\n", err)
+			return exitFailure
+		}
+		opts.Scenarios = scenarios
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err := serveMockUpstream(ctx, *listen, mockserver.New(opts), func(addr net.Addr) {
+		fmt.Fprintf(stdout, "模拟上游已启动: http://%s\n", addr)
+		if len(opts.Scenarios) > 0 {
+			names := make([]string, 0, len(opts.Scenarios))
+			for name := range opts.Scenarios {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			fmt.Fprintf(stdout, "已加载场景: %s\n", strings.Join(names, ", "))
+		}
+		fmt.Fprintf(stdout, "启动服务时设置 UPSTREAM_BASE_URL=http://%s\n", addr)
+	})
+	if err != nil {
+		fmt.Fprintf(stderr, "错误: %v\n", err)
+		return exitFailure
+	}
+	return exitOK
+}
@@ -0,0 +1,49 @@
+package cli
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubServeMockUpstream 替换模拟上游的监听，记录监听地址后立即返回
+func stubServeMockUpstream(t *testing.T, addr *string) {
+	t.Helper()
+	orig := serveMockUpstream
+	serveMockUpstream = func(_ context.Context, listen string, _ http.Handler, ready func(net.Addr)) error {
+		*addr = listen
+		ready(&net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9999})
+		return nil
+	}
+	t.Cleanup(func() { serveMockUpstream = orig })
+}
+
+func TestMockServer(t *testing.T) {
+	var addr string
+	stubServeMockUpstream(t, &addr)
+
+	code, out, errOut := runCLI("mockserver")
+	require.Equal(t, exitOK, code, errOut)
+	assert.Equal(t, "127.0.0.1:9090", addr)
+	assert.Contains(t, out, "UPSTREAM_BASE_URL=http://127.0.0.1:9999")
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "slow.json"), []byte(`{"upstream":[{"event":"assistantResponseEvent","payload":{"content":"hi"}}]}`), 0o600))
+	code, out, errOut = runCLI("mockserver", "--listen", ":0", "--scenarios", dir, "--chunk-delay", "20ms")
+	require.Equal(t, exitOK, code, errOut)
+	assert.Equal(t, ":0", addr)
+	assert.Contains(t, out, "已加载场景: slow")
+
+	code, _, errOut = runCLI("mockserver", "--scenarios", t.TempDir())
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, errOut, "没有 *.json 场景文件")
+
+	code, _, _ = runCLI("mockserver", "extra")
+	assert.Equal(t, exitUsage, code)
+}
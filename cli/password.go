@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"kiro2api/server"
+)
+
+const hashPasswordUsage = `用法: kiro2api hash-password [--algo argon2id|bcrypt]
+
+从标准输入读取一行密码，输出可用于 ADMIN_PASSWORD_HASH 或用户文件 password_hash 字段的哈希。
+密码不作为命令行参数传入，避免出现在进程列表与 shell 历史中：
+  read -rs PW && echo "$PW" | kiro2api hash-password
+
+  --algo   哈希算法（默认 argon2id）
+`
+
+// RunHashPassword 执行 hash-password 子命令，返回进程退出码
+func RunHashPassword(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("kiro2api hash-password", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	algo := fs.String("algo", server.PasswordAlgoArgon2id, "")
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			fmt.Fprint(stderr, hashPasswordUsage)
+			return exitOK
+		}
+		fmt.Fprintf(stderr, "错误: %v\n\n%s", err, hashPasswordUsage)
+		return exitUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(stderr, "错误: 密码需从标准输入读取，不接受位置参数\n\n%s", hashPasswordUsage)
+		return exitUsage
+	}
+
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		fmt.Fprintf(stderr, "错误: 读取密码失败: %v\n", err)
+		return exitFailure
+	}
+	hash, err := server.HashPassword(strings.TrimRight(line, "\r\n"), *algo)
+	if err != nil {
+		fmt.Fprintf(stderr, "错误: %v\n", err)
+		return exitFailure
+	}
+	fmt.Fprintln(stdout, hash)
+	return exitOK
+}
@@ -0,0 +1,30 @@
+package cli
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"kiro2api/server"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashPassword(t *testing.T) {
+	stdin = strings.NewReader("s3cret\n")
+	t.Cleanup(func() { stdin = os.Stdin })
+
+	code, out, _ := runCLI("hash-password", "--algo", "bcrypt")
+	require.Equal(t, exitOK, code)
+	hash := strings.TrimSpace(out)
+	assert.True(t, strings.HasPrefix(hash, "$2a$"))
+	ok, err := server.VerifyPasswordHash(hash, "s3cret")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	code, _, _ = runCLI("hash-password", "s3cret")
+	assert.Equal(t, exitUsage, code, "不接受命令行传入的密码")
+	code, _, _ = runCLI("hash-password", "--algo", "md5")
+	assert.Equal(t, exitFailure, code)
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+
+	"kiro2api/server"
+
+	"github.com/gin-gonic/gin"
+)
+
+const replayUsage = `用法: kiro2api replay [--upstream-request] <捕获包目录>
+
+离线回放请求捕获包（CAPTURE_DIR 下的目录，名称见响应头 X-Kiro-Capture-Id）：
+以当前代码重新转换捕获的客户端请求，并把捕获的上游原始响应当作上游返回，输出转换后的客户端响应。
+不访问网络、不需要账号；回放不应用调用方密钥的策略与系统提示策略。
+
+参数:
+  --upstream-request   输出重新转换得到的上游请求体，而不是客户端响应
+
+上游请求体与捕获时一致时退出码为 0，不一致时在标准错误中提示并以 1 退出，便于验证转换修复。
+`
+
+// 供测试替换的外部依赖
+var replayCapture = server.ReplayCapture
+
+// RunReplay 执行 replay 子命令，返回进程退出码
+func RunReplay(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("kiro2api replay", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	upstreamRequest := fs.Bool("upstream-request", false, "输出重新转换得到的上游请求体")
+	if err := fs.Parse(args); err != nil {
+		fmt.Fprint(stderr, replayUsage)
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK
+		}
+		return exitUsage
+	}
+	if fs.NArg() != 1 {
+		fmt.Fprint(stderr, replayUsage)
+		return exitUsage
+	}
+
+	gin.SetMode(gin.ReleaseMode)
+	result, err := replayCapture(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "错误: %v\n", err)
+		return exitFailure
+	}
+
+	if *upstreamRequest {
+		fmt.Fprintf(stdout, "%s\n", result.UpstreamRequest)
+	} else {
+		fmt.Fprintf(stdout, "%s", result.Body)
+	}
+	manifest := result.Manifest
+	fmt.Fprintf(stderr, "捕获包 %s: %s %s，捕获时状态码 %d，回放状态码 %d，上游响应 %d 字节\n",
+		manifest.ID, manifest.Method, manifest.Path, manifest.Status, result.Status, manifest.UpstreamBytes)
+	if manifest.UpstreamTruncated {
+		fmt.Fprintln(stderr, "注意: 上游响应超过 CAPTURE_MAX_BYTES，只保存了前面部分")
+	}
+	if !result.UpstreamRequestMatches {
+		fmt.Fprintln(stderr, "上游请求体与捕获时不一致（可用 --upstream-request 查看重新转换的结果）")
+		return exitFailure
+	}
+	fmt.Fprintln(stderr, "上游请求体与捕获时一致")
+	return exitOK
+}
@@ -0,0 +1,48 @@
+package cli
+
+import (
+	"errors"
+	"testing"
+
+	"kiro2api/server"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// stubReplay 替换捕获包回放结果
+func stubReplay(t *testing.T, result *server.CaptureReplay, err error) {
+	t.Helper()
+	orig := replayCapture
+	replayCapture = func(string) (*server.CaptureReplay, error) { return result, err }
+	t.Cleanup(func() { replayCapture = orig })
+}
+
+func TestReplay(t *testing.T) {
+	result := &server.CaptureReplay{
+		Manifest:               server.CaptureManifest{ID: "20260101T000000Z-abc", Method: "POST", Path: "/v1/messages", Status: 200},
+		Status:                 200,
+		Body:                   []byte(`{"content":"ok"}`),
+		UpstreamRequest:        []byte(`{"conversationState":{}}`),
+		UpstreamRequestMatches: true,
+	}
+	stubReplay(t, result, nil)
+
+	code, out, errOut := runCLI("replay", "bundle")
+	assert.Equal(t, exitOK, code)
+	assert.Equal(t, `{"content":"ok"}`, out)
+	assert.Contains(t, errOut, "上游请求体与捕获时一致")
+
+	result.UpstreamRequestMatches = false
+	code, out, errOut = runCLI("replay", "--upstream-request", "bundle")
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, out, "conversationState")
+	assert.Contains(t, errOut, "不一致")
+
+	code, _, _ = runCLI("replay")
+	assert.Equal(t, exitUsage, code)
+
+	stubReplay(t, nil, errors.New("读取捕获包元数据失败"))
+	code, _, errOut = runCLI("replay", "missing")
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, errOut, "读取捕获包元数据失败")
+}
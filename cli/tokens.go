@@ -0,0 +1,437 @@
+package cli
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"kiro2api/auth"
+	"kiro2api/types"
+)
+
+// 退出码
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+const tokensUsage = `用法: kiro2api token <命令> [参数]（别名 tokens）
+
+直接读写账号配置存储（KIRO_CONFIG_SOURCE 选择的后端，默认为 KIRO_AUTH_TOKEN 指向的文件或 AUTH_CONFIG_FILE），无需启动服务。
+
+命令:
+  list   [--json]                         列出账号
+  add    --refresh-token <token|-> [...]   添加账号（"-" 表示从标准输入读取，避免留在shell历史中）
+  add    --file <path|->                  从JSON文件批量导入（账号数组、单个账号或导出文件），按refresh token去重
+  remove <id|序号>                        删除账号
+  check  [--json] [id|序号 ...]           刷新token并查询剩余额度（默认检查全部启用的账号，别名 test）
+
+运行中的服务不会自动加载变更，需重启（只读副本按 REPLICA_SYNC_SECONDS 自动同步）。
+`
+
+// 供测试替换的外部依赖
+var (
+	loadAuthService = auth.NewOfflineAuthService
+	refreshToken    = auth.RefreshConfigToken
+	checkUsage      = func(token types.TokenInfo) (*types.UsageLimits, error) {
+		return auth.NewUsageLimitsChecker().CheckUsageLimits(token)
+	}
+	stdin io.Reader = os.Stdin
+)
+
+// RunTokens 执行 tokens 子命令，返回进程退出码
+func RunTokens(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		fmt.Fprint(stderr, tokensUsage)
+		if len(args) == 0 {
+			return exitUsage
+		}
+		return exitOK
+	}
+
+	var run func(*auth.AuthService, []string, io.Writer) error
+	switch args[0] {
+	case "list":
+		run = runList
+	case "add":
+		run = runAdd
+	case "remove", "rm":
+		run = runRemove
+	case "check", "test":
+		run = runTest
+	default:
+		fmt.Fprintf(stderr, "未知命令: %s\n\n%s", args[0], tokensUsage)
+		return exitUsage
+	}
+
+	authService, err := loadAuthService()
+	if err != nil {
+		fmt.Fprintf(stderr, "错误: %v\n", err)
+		return exitFailure
+	}
+	if err := run(authService, args[1:], stdout); err != nil {
+		fmt.Fprintf(stderr, "错误: %v\n", err)
+		var usageErr usageError
+		if errors.As(err, &usageErr) || errors.Is(err, flag.ErrHelp) {
+			return exitUsage
+		}
+		return exitFailure
+	}
+	return exitOK
+}
+
+// usageError 参数错误
+type usageError string
+
+func (e usageError) Error() string { return string(e) }
+
+// newFlagSet 创建子命令参数解析器，错误由 RunTokens 统一输出
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet("kiro2api tokens "+name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return fs
+}
+
+// parseFlags 解析参数，错误包装为 usageError
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError(err.Error())
+	}
+	return nil
+}
+
+// splitList 解析逗号分隔的列表参数
+func splitList(value string) []string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// resolveConfig 按稳定ID或从1开始的序号查找账号
+func resolveConfig(configs []auth.AuthConfig, ref string) (int, auth.AuthConfig, error) {
+	for i, cfg := range configs {
+		if cfg.ID == ref {
+			return i, cfg, nil
+		}
+	}
+	if n, err := strconv.Atoi(ref); err == nil && n >= 1 && n <= len(configs) {
+		return n - 1, configs[n-1], nil
+	}
+	return -1, auth.AuthConfig{}, fmt.Errorf("%w: %s", auth.ErrConfigNotFound, ref)
+}
+
+// accountName 账号的显示名称
+func accountName(cfg auth.AuthConfig) string {
+	if cfg.Label != "" {
+		return cfg.Label
+	}
+	return "-"
+}
+
+// runList 列出账号（密钥脱敏）
+func runList(authService *auth.AuthService, args []string, stdout io.Writer) error {
+	fs := newFlagSet("list")
+	asJSON := fs.Bool("json", false, "以JSON输出（密钥脱敏）")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *asJSON {
+		export := authService.Export(true)
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(export.Accounts)
+	}
+
+	configs := authService.GetConfigs()
+	fmt.Fprintf(stdout, "配置存储: %s（共%d个账号）\n", authService.ConfigSource().Location(), len(configs))
+	if len(configs) == 0 {
+		return nil
+	}
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tID\t名称\t认证方式\t状态\t标签\t模型\tRefresh Token")
+	for i, cfg := range configs {
+		status := "启用"
+		if cfg.Disabled {
+			status = "禁用"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			i+1, cfg.ID, accountName(cfg), cfg.AuthType, status,
+			orDash(strings.Join(cfg.Tags, ",")), orDash(strings.Join(cfg.Models, ",")),
+			auth.MaskSecret(cfg.RefreshToken))
+	}
+	return w.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// runAdd 添加账号并持久化
+func runAdd(authService *auth.AuthService, args []string, stdout io.Writer) error {
+	fs := newFlagSet("add")
+	refresh := fs.String("refresh-token", "", `Refresh Token（"-" 从标准输入读取）`)
+	authType := fs.String("auth", auth.AuthMethodSocial, "认证方式: Social 或 IdC")
+	clientID := fs.String("client-id", "", "IdC Client ID")
+	clientSecret := fs.String("client-secret", "", `IdC Client Secret（"-" 从标准输入读取）`)
+	label := fs.String("label", "", "显示名称")
+	tags := fs.String("tags", "", "标签，逗号分隔")
+	models := fs.String("models", "", "可用模型系列，逗号分隔（opus/sonnet/haiku）")
+	proxy := fs.String("proxy", "", "出站代理URL")
+	note := fs.String("note", "", "备注")
+	disabled := fs.Bool("disabled", false, "添加后保持禁用")
+	file := fs.String("file", "", `批量导入的JSON文件（"-" 从标准输入读取）`)
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return usageError("add 不接受位置参数: " + strings.Join(fs.Args(), " "))
+	}
+	if *file != "" {
+		if *refresh != "" {
+			return usageError("--file 与 --refresh-token 不能同时使用")
+		}
+		return runImport(authService, *file, stdout)
+	}
+
+	reader := bufio.NewReader(stdin)
+	readSecret := func(value *string, name string) error {
+		if *value != "-" {
+			return nil
+		}
+		line, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("读取%s失败: %w", name, err)
+		}
+		*value = strings.TrimSpace(line)
+		return nil
+	}
+	if err := readSecret(refresh, "refresh token"); err != nil {
+		return err
+	}
+	if err := readSecret(clientSecret, "client secret"); err != nil {
+		return err
+	}
+	if *refresh == "" {
+		return usageError("缺少 --refresh-token 或 --file")
+	}
+
+	for _, cfg := range authService.GetConfigs() {
+		if cfg.RefreshToken == *refresh {
+			return fmt.Errorf("该refresh token已存在（ID: %s）", cfg.ID)
+		}
+	}
+
+	config := auth.AuthConfig{
+		AuthType:     *authType,
+		RefreshToken: *refresh,
+		ClientID:     *clientID,
+		ClientSecret: *clientSecret,
+		Label:        *label,
+		Tags:         splitList(*tags),
+		Models:       splitList(*models),
+		ProxyURL:     *proxy,
+		Note:         *note,
+		Disabled:     *disabled,
+	}
+	if err := authService.AddConfig(config); err != nil {
+		return fmt.Errorf("添加账号失败: %w", err)
+	}
+
+	configs := authService.GetConfigs()
+	added := configs[len(configs)-1]
+	fmt.Fprintf(stdout, "已添加账号 %s（%s），配置已保存到 %s\n", added.ID, added.AuthType, authService.ConfigSource().Location())
+	return nil
+}
+
+// runImport 从JSON文件批量导入账号，任一条目无效时返回错误（有效条目仍会导入）
+func runImport(authService *auth.AuthService, path string, stdout io.Writer) error {
+	var content []byte
+	var err error
+	if path == "-" {
+		content, err = io.ReadAll(stdin)
+	} else {
+		content, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return fmt.Errorf("读取导入文件失败: %w", err)
+	}
+	configs, err := parseImportFile(content)
+	if err != nil {
+		return err
+	}
+
+	result, err := authService.Import(configs)
+	if err != nil {
+		return fmt.Errorf("导入账号失败: %w", err)
+	}
+	fmt.Fprintf(stdout, "已导入%d个账号（共%d个，重复%d个，无效%d个），配置已保存到 %s\n",
+		result.Imported, result.Total, result.Duplicates, len(result.Invalid), authService.ConfigSource().Location())
+	for _, dup := range result.DuplicateOf {
+		fmt.Fprintf(stdout, "- 第%d个账号与账号 %s 重复，已跳过\n", dup.Index+1, dup.ExistingID)
+	}
+	for _, invalid := range result.Invalid {
+		fmt.Fprintf(stdout, "✗ 第%d个账号: %s\n", invalid.Index+1, invalid.Error)
+	}
+	if len(result.Invalid) > 0 {
+		return fmt.Errorf("%d个账号无效", len(result.Invalid))
+	}
+	return nil
+}
+
+// parseImportFile 解析导入文件：导出文件（{"accounts":[...]}）、账号数组或单个账号
+func parseImportFile(content []byte) ([]auth.AuthConfig, error) {
+	var export auth.PoolExport
+	if err := json.Unmarshal(content, &export); err == nil && export.Accounts != nil {
+		if export.Masked {
+			return nil, errors.New("导出文件已脱敏，无法导入")
+		}
+		return export.Accounts, nil
+	}
+	var configs []auth.AuthConfig
+	if err := json.Unmarshal(content, &configs); err == nil {
+		return configs, nil
+	}
+	var single auth.AuthConfig
+	if err := json.Unmarshal(content, &single); err != nil {
+		return nil, fmt.Errorf("导入文件不是有效的JSON账号配置: %w", err)
+	}
+	return []auth.AuthConfig{single}, nil
+}
+
+// runRemove 删除账号并持久化
+func runRemove(authService *auth.AuthService, args []string, stdout io.Writer) error {
+	fs := newFlagSet("remove")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageError("用法: kiro2api tokens remove <id|序号>")
+	}
+
+	_, cfg, err := resolveConfig(authService.GetConfigs(), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := authService.RemoveConfigByID(cfg.ID); err != nil {
+		return fmt.Errorf("删除账号失败: %w", err)
+	}
+	fmt.Fprintf(stdout, "已删除账号 %s（%s），剩余%d个\n", cfg.ID, accountName(cfg), authService.GetConfigCount())
+	return nil
+}
+
+// checkResult 单个账号的检查结果（--json 输出）
+type checkResult struct {
+	ID        string     `json:"id"`
+	Label     string     `json:"label,omitempty"`
+	OK        bool       `json:"ok"`
+	Email     string     `json:"email,omitempty"`
+	Available float64    `json:"available,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// runTest 刷新token并查询剩余额度，任一账号失败时返回错误
+func runTest(authService *auth.AuthService, args []string, stdout io.Writer) error {
+	fs := newFlagSet("check")
+	asJSON := fs.Bool("json", false, "以JSON输出检查结果")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	configs := authService.GetConfigs()
+	var targets []auth.AuthConfig
+	if fs.NArg() == 0 {
+		for _, cfg := range configs {
+			if !cfg.Disabled {
+				targets = append(targets, cfg)
+			}
+		}
+	} else {
+		for _, ref := range fs.Args() {
+			_, cfg, err := resolveConfig(configs, ref)
+			if err != nil {
+				return err
+			}
+			targets = append(targets, cfg)
+		}
+	}
+	if len(targets) == 0 {
+		return errors.New("没有可测试的账号")
+	}
+
+	failed := 0
+	results := make([]checkResult, 0, len(targets))
+	for _, cfg := range targets {
+		result := checkResult{ID: cfg.ID, Label: cfg.Label}
+		token, err := refreshToken(cfg)
+		if err != nil {
+			failed++
+			result.Error = "刷新失败: " + err.Error()
+			results = append(results, result)
+			if !*asJSON {
+				fmt.Fprintf(stdout, "✗ %s（%s）刷新失败: %v\n", cfg.ID, accountName(cfg), err)
+			}
+			continue
+		}
+		// 上游轮换了refresh token时旧值随即失效，必须写回配置存储
+		if err := authService.SaveRotatedRefreshToken(cfg, token); err != nil {
+			failed++
+			result.Error = "保存轮换后的refresh token失败: " + err.Error()
+			results = append(results, result)
+			if !*asJSON {
+				fmt.Fprintf(stdout, "✗ %s（%s）刷新成功，保存轮换后的refresh token失败: %v\n", cfg.ID, accountName(cfg), err)
+			}
+			continue
+		}
+		expiresAt := token.ExpiresAt
+		result.ExpiresAt = &expiresAt
+		usage, err := checkUsage(token)
+		if err != nil {
+			failed++
+			result.Error = "额度查询失败: " + err.Error()
+			results = append(results, result)
+			if !*asJSON {
+				fmt.Fprintf(stdout, "✗ %s（%s）刷新成功，额度查询失败: %v\n", cfg.ID, accountName(cfg), err)
+			}
+			continue
+		}
+		result.OK = true
+		result.Email = usage.UserInfo.Email
+		result.Available = auth.CalculateAvailableCount(usage)
+		results = append(results, result)
+		if !*asJSON {
+			fmt.Fprintf(stdout, "✓ %s（%s）邮箱: %s，剩余: %.1f，token有效期至 %s\n",
+				cfg.ID, accountName(cfg), orDash(result.Email), result.Available,
+				token.ExpiresAt.Local().Format("2006-01-02 15:04:05"))
+		}
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(results); err != nil {
+			return err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d/%d个账号测试失败", failed, len(targets))
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"kiro2api/auth"
+	"kiro2api/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// setupStore 使用临时配置文件作为配置存储
+func setupStore(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "auth_config.json")
+	t.Setenv("KIRO_AUTH_TOKEN", "")
+	t.Setenv("AUTH_CONFIG_FILE", path)
+	return path
+}
+
+func run(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := RunTokens(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestTokens_AddListRemove(t *testing.T) {
+	path := setupStore(t)
+
+	code, out, errOut := run(t, "add", "--refresh-token", "social-refresh-token-1", "--label", "主账号", "--tags", "Primary, backup", "--models", "sonnet")
+	require.Equal(t, exitOK, code, errOut)
+	assert.Contains(t, out, path)
+
+	stdin = strings.NewReader("idc-refresh-token-2\nidc-client-secret\n")
+	t.Cleanup(func() { stdin = os.Stdin })
+	code, _, errOut = run(t, "add", "--auth", "IdC", "--refresh-token", "-", "--client-id", "cid", "--client-secret", "-")
+	require.Equal(t, exitOK, code, errOut)
+
+	code, _, errOut = run(t, "add", "--refresh-token", "social-refresh-token-1")
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, errOut, "已存在")
+
+	code, out, _ = run(t, "list")
+	require.Equal(t, exitOK, code)
+	assert.Contains(t, out, "共2个账号")
+	assert.Contains(t, out, "主账号")
+	assert.Contains(t, out, "primary,backup")
+	assert.NotContains(t, out, "social-refresh-token-1", "列表中的密钥需脱敏")
+
+	code, out, _ = run(t, "list", "--json")
+	require.Equal(t, exitOK, code)
+	var accounts []auth.AuthConfig
+	require.NoError(t, json.Unmarshal([]byte(out), &accounts))
+	require.Len(t, accounts, 2)
+	assert.Equal(t, "IdC", accounts[1].AuthType)
+	assert.NotContains(t, out, "idc-client-secret")
+
+	saved, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(saved), "idc-client-secret", "配置文件保存完整密钥")
+
+	code, out, errOut = run(t, "remove", "1")
+	require.Equal(t, exitOK, code, errOut)
+	assert.Contains(t, out, "剩余1个")
+
+	code, _, _ = run(t, "remove", accounts[1].ID)
+	require.Equal(t, exitOK, code)
+	code, _, errOut = run(t, "remove", accounts[1].ID)
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, errOut, "认证配置不存在")
+}
+
+func TestTokens_UsageErrors(t *testing.T) {
+	setupStore(t)
+
+	code, _, _ := run(t)
+	assert.Equal(t, exitUsage, code)
+	code, _, _ = run(t, "bogus")
+	assert.Equal(t, exitUsage, code)
+	code, _, _ = run(t, "add")
+	assert.Equal(t, exitUsage, code)
+	code, _, _ = run(t, "add", "--unknown")
+	assert.Equal(t, exitUsage, code)
+	code, _, _ = run(t, "remove")
+	assert.Equal(t, exitUsage, code)
+	code, _, errOut := run(t, "add", "--auth", "IdC", "--refresh-token", "x")
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, errOut, "clientId")
+}
+
+func TestTokens_Test(t *testing.T) {
+	setupStore(t)
+	for _, token := range []string{"good-refresh-token", "bad-refresh-token"} {
+		code, _, errOut := run(t, "add", "--refresh-token", token)
+		require.Equal(t, exitOK, code, errOut)
+	}
+
+	origRefresh, origUsage := refreshToken, checkUsage
+	t.Cleanup(func() { refreshToken, checkUsage = origRefresh, origUsage })
+	refreshToken = func(cfg auth.AuthConfig) (types.TokenInfo, error) {
+		if strings.HasPrefix(cfg.RefreshToken, "bad") {
+			return types.TokenInfo{}, errors.New("invalid_grant")
+		}
+		return types.TokenInfo{AccessToken: "access", RefreshToken: cfg.RefreshToken + "-rotated", ExpiresAt: time.Now().Add(time.Hour)}, nil
+	}
+	checkUsage = func(types.TokenInfo) (*types.UsageLimits, error) {
+		usage := &types.UsageLimits{}
+		usage.UserInfo.Email = "user@example.com"
+		return usage, nil
+	}
+
+	code, out, errOut := run(t, "test")
+	assert.Equal(t, exitFailure, code)
+	assert.Contains(t, out, "✓")
+	assert.Contains(t, out, "user@example.com")
+	assert.Contains(t, out, "invalid_grant")
+	assert.Contains(t, errOut, "1/2个账号测试失败")
+
+	authService, err := loadAuthService()
+	require.NoError(t, err)
+	assert.Equal(t, "good-refresh-token-rotated", authService.GetConfigs()[0].RefreshToken, "上游轮换的refresh token写回配置存储")
+
+	code, _, errOut = run(t, "test", "1")
+	assert.Equal(t, exitOK, code, errOut)
+}
+
+func TestTokens_AddFromFile(t *testing.T) {
+	setupStore(t)
+	code, _, errOut := run(t, "add", "--refresh-token", "existing-token")
+	require.Equal(t, exitOK, code, errOut)
+
+	file := filepath.Join(t.TempDir(), "accounts.json")
+	require.NoError(t, os.WriteFile(file, []byte(`[
+		{"auth":"Social","refreshToken":"existing-token"},
+		{"auth":"Social","refreshToken":"new-token","label":"导入"},
+		{"auth":"IdC","refreshToken":"idc-token"}
+	]`), 0o600))
+
+	code, out, errOut := runCLI("token", "add", "--file", file)
+	assert.Equal(t, exitFailure, code, "存在无效条目时返回失败")
+	assert.Contains(t, out, "已导入1个账号（共3个，重复1个，无效1个）")
+	assert.Contains(t, out, "第3个账号")
+	assert.Contains(t, errOut, "1个账号无效")
+
+	stdin = strings.NewReader(`{"version":1,"masked":false,"accounts":[{"refreshToken":"exported-token"}]}`)
+	t.Cleanup(func() { stdin = os.Stdin })
+	code, out, errOut = run(t, "add", "--file", "-")
+	require.Equal(t, exitOK, code, errOut)
+	assert.Contains(t, out, "已导入1个账号")
+
+	code, out, _ = run(t, "list")
+	require.Equal(t, exitOK, code)
+	assert.Contains(t, out, "共3个账号")
+
+	code, _, _ = run(t, "add", "--file", file, "--refresh-token", "x")
+	assert.Equal(t, exitUsage, code)
+}
+
+func TestTokens_CheckJSON(t *testing.T) {
+	setupStore(t)
+	code, _, errOut := run(t, "add", "--refresh-token", "good-refresh-token", "--label", "main")
+	require.Equal(t, exitOK, code, errOut)
+
+	origRefresh, origUsage := refreshToken, checkUsage
+	t.Cleanup(func() { refreshToken, checkUsage = origRefresh, origUsage })
+	refreshToken = func(cfg auth.AuthConfig) (types.TokenInfo, error) {
+		return types.TokenInfo{AccessToken: "access", ExpiresAt: time.Now().Add(time.Hour)}, nil
+	}
+	checkUsage = func(types.TokenInfo) (*types.UsageLimits, error) {
+		return nil, errors.New("usage api unavailable")
+	}
+
+	code, out, _ := run(t, "check", "--json")
+	assert.Equal(t, exitFailure, code)
+	var results []checkResult
+	require.NoError(t, json.Unmarshal([]byte(out), &results))
+	require.Len(t, results, 1)
+	assert.Equal(t, "main", results[0].Label)
+	assert.False(t, results[0].OK)
+	assert.NotNil(t, results[0].ExpiresAt)
+	assert.Contains(t, results[0].Error, "usage api unavailable")
+}
@@ -1,8 +1,11 @@
 package config
 
 import (
+	"fmt"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 )
 
 // ModelMap 模型映射表
@@ -17,14 +20,70 @@ var ModelMap = map[string]string{
 	"claude-haiku-4-5-20251001":  "auto",
 }
 
+// 模型系列，用于按账号限制可用模型
+const (
+	ModelFamilyOpus   = "opus"
+	ModelFamilySonnet = "sonnet"
+	ModelFamilyHaiku  = "haiku"
+)
+
+// ModelFamily 返回模型所属系列（opus/sonnet/haiku），无法识别时返回小写的模型名
+func ModelFamily(model string) string {
+	model = strings.ToLower(strings.TrimSpace(model))
+	for _, family := range []string{ModelFamilyOpus, ModelFamilySonnet, ModelFamilyHaiku} {
+		if strings.Contains(model, family) {
+			return family
+		}
+	}
+	return model
+}
+
+// 上游服务的默认地址
+const (
+	defaultSocialAuthBaseURL    = "https://prod.us-east-1.auth.desktop.kiro.dev"
+	defaultIdcAuthBaseURL       = "https://oidc.us-east-1.amazonaws.com"
+	defaultCodeWhispererBaseURL = "https://codewhisperer.us-east-1.amazonaws.com"
+)
+
 // RefreshTokenURL 刷新token的URL (social方式)
-const RefreshTokenURL = "https://prod.us-east-1.auth.desktop.kiro.dev/refreshToken"
+var RefreshTokenURL = defaultSocialAuthBaseURL + "/refreshToken"
 
 // IdcRefreshTokenURL IdC认证方式的刷新token URL
-const IdcRefreshTokenURL = "https://oidc.us-east-1.amazonaws.com/token"
+var IdcRefreshTokenURL = defaultIdcAuthBaseURL + "/token"
 
 // CodeWhispererURL CodeWhisperer API的URL
-const CodeWhispererURL = "https://codewhisperer.us-east-1.amazonaws.com/generateAssistantResponse"
+var CodeWhispererURL = defaultCodeWhispererBaseURL + "/generateAssistantResponse"
+
+// UsageLimitsURL 使用限制查询的URL
+var UsageLimitsURL = defaultCodeWhispererBaseURL + "/getUsageLimits"
+
+// UpstreamBaseURL 当前生效的上游基础地址覆盖，空表示使用真实上游
+var UpstreamBaseURL string
+
+// SetUpstreamBaseURL 将全部上游端点（token刷新、推理、使用限制）指向同一个基础地址，
+// 用于本地开发与端到端测试时连接 kiro2api mockserver；传入空字符串恢复真实上游
+// 须在发起任何上游请求之前调用
+func SetUpstreamBaseURL(base string) error {
+	base = strings.TrimRight(strings.TrimSpace(base), "/")
+	if base == "" {
+		RefreshTokenURL = defaultSocialAuthBaseURL + "/refreshToken"
+		IdcRefreshTokenURL = defaultIdcAuthBaseURL + "/token"
+		CodeWhispererURL = defaultCodeWhispererBaseURL + "/generateAssistantResponse"
+		UsageLimitsURL = defaultCodeWhispererBaseURL + "/getUsageLimits"
+		UpstreamBaseURL = ""
+		return nil
+	}
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("上游基础地址无效（需为 http(s)://host[:port]）: %q", base)
+	}
+	RefreshTokenURL = base + "/refreshToken"
+	IdcRefreshTokenURL = base + "/token"
+	CodeWhispererURL = base + "/generateAssistantResponse"
+	UsageLimitsURL = base + "/getUsageLimits"
+	UpstreamBaseURL = base
+	return nil
+}
 
 // MaxToolDescriptionLength 工具描述的最大长度（字符数）
 // 可通过环境变量 MAX_TOOL_DESCRIPTION_LENGTH 配置，默认 10000
@@ -0,0 +1,26 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetUpstreamBaseURL(t *testing.T) {
+	t.Cleanup(func() { _ = SetUpstreamBaseURL("") })
+
+	require.NoError(t, SetUpstreamBaseURL(" http://127.0.0.1:9090/ "))
+	assert.Equal(t, "http://127.0.0.1:9090", UpstreamBaseURL)
+	assert.Equal(t, "http://127.0.0.1:9090/refreshToken", RefreshTokenURL)
+	assert.Equal(t, "http://127.0.0.1:9090/token", IdcRefreshTokenURL)
+	assert.Equal(t, "http://127.0.0.1:9090/generateAssistantResponse", CodeWhispererURL)
+	assert.Equal(t, "http://127.0.0.1:9090/getUsageLimits", UsageLimitsURL)
+
+	assert.Error(t, SetUpstreamBaseURL("127.0.0.1:9090"))
+	assert.Error(t, SetUpstreamBaseURL("ftp://mock"))
+
+	require.NoError(t, SetUpstreamBaseURL(""))
+	assert.Empty(t, UpstreamBaseURL)
+	assert.Equal(t, "https://codewhisperer.us-east-1.amazonaws.com/generateAssistantResponse", CodeWhispererURL)
+}
@@ -76,3 +76,10 @@ func TestSupportedModels_ContainsAllKeys(t *testing.T) {
 	assert.NotEmpty(t, ModelMap, "ModelMap should not be empty")
 	assert.Greater(t, len(ModelMap), 3, "ModelMap should contain at least 3 models")
 }
+
+func TestModelFamily(t *testing.T) {
+	assert.Equal(t, ModelFamilyOpus, ModelFamily("claude-opus-4-5-20251101"))
+	assert.Equal(t, ModelFamilySonnet, ModelFamily("claude-3-7-sonnet-20250219"))
+	assert.Equal(t, ModelFamilyHaiku, ModelFamily(" Claude-Haiku-4-5-20251001 "))
+	assert.Equal(t, "custom-model", ModelFamily("Custom-Model"))
+}
@@ -0,0 +1,197 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxModelAliasDepth 别名链的最大长度，超过视为循环引用
+const maxModelAliasDepth = 8
+
+// ModelRoute 模型路由配置：客户端模型名映射到上游模型ID，或作为另一个模型名的别名
+type ModelRoute struct {
+	Upstream       string   `json:"upstream,omitempty" yaml:"upstream,omitempty"`                 // 上游 modelId
+	Alias          string   `json:"alias,omitempty" yaml:"alias,omitempty"`                       // 指向另一个模型名（与 upstream 二选一）
+	MaxTokens      int      `json:"max_tokens,omitempty" yaml:"max_tokens,omitempty"`             // 请求未指定 max_tokens 时的默认值
+	MaxTokensLimit int      `json:"max_tokens_limit,omitempty" yaml:"max_tokens_limit,omitempty"` // max_tokens 上限，超过时截断
+	TemperatureMin *float64 `json:"temperature_min,omitempty" yaml:"temperature_min,omitempty"`   // temperature 下限
+	TemperatureMax *float64 `json:"temperature_max,omitempty" yaml:"temperature_max,omitempty"`   // temperature 上限
+	Tags           []string `json:"tags,omitempty" yaml:"tags,omitempty"`                         // 只使用带有任一标签的账号
+}
+
+// ResolvedModel 别名解析后的模型路由
+type ResolvedModel struct {
+	ModelRoute
+	Name   string // 客户端请求的模型名
+	Target string // 别名解析后的最终模型名（用于识别模型系列）
+}
+
+// modelsFile 模型路由配置文件格式
+type modelsFile struct {
+	Models map[string]ModelRoute `json:"models" yaml:"models"`
+}
+
+// ModelTable 模型路由表（内置映射 + 配置文件），创建后只读
+type ModelTable struct {
+	routes map[string]ModelRoute
+}
+
+// NewModelTable 以内置 ModelMap 为基础叠加自定义路由并校验
+func NewModelTable(routes map[string]ModelRoute) (*ModelTable, error) {
+	merged := make(map[string]ModelRoute, len(ModelMap)+len(routes))
+	for name, upstream := range ModelMap {
+		merged[name] = ModelRoute{Upstream: upstream}
+	}
+	for name, route := range routes {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("模型名不能为空")
+		}
+		merged[name] = route
+	}
+
+	table := &ModelTable{routes: merged}
+	for name, route := range merged {
+		if err := validateModelRoute(name, route); err != nil {
+			return nil, err
+		}
+		if _, err := table.resolve(name); err != nil {
+			return nil, err
+		}
+	}
+	return table, nil
+}
+
+// validateModelRoute 校验单条路由的字段
+func validateModelRoute(name string, route ModelRoute) error {
+	if (route.Upstream == "") == (route.Alias == "") {
+		return fmt.Errorf("模型 %s 必须且只能设置 upstream 或 alias 之一", name)
+	}
+	if route.MaxTokens < 0 || route.MaxTokensLimit < 0 {
+		return fmt.Errorf("模型 %s 的 max_tokens 与 max_tokens_limit 不能为负数", name)
+	}
+	if route.MaxTokensLimit > 0 && route.MaxTokens > route.MaxTokensLimit {
+		return fmt.Errorf("模型 %s 的 max_tokens 不能大于 max_tokens_limit", name)
+	}
+	if route.TemperatureMin != nil && route.TemperatureMax != nil && *route.TemperatureMin > *route.TemperatureMax {
+		return fmt.Errorf("模型 %s 的 temperature_min 不能大于 temperature_max", name)
+	}
+	return nil
+}
+
+// resolve 沿别名链解析模型，别名上的默认参数与标签优先于目标模型
+func (t *ModelTable) resolve(name string) (ResolvedModel, error) {
+	resolved := ResolvedModel{Name: name}
+	current := name
+	for depth := 0; depth < maxModelAliasDepth; depth++ {
+		route, ok := t.routes[current]
+		if !ok {
+			return ResolvedModel{}, fmt.Errorf("模型 %s 的别名目标 %s 不存在", name, current)
+		}
+		mergeModelRoute(&resolved.ModelRoute, route)
+		if route.Alias == "" {
+			resolved.Upstream = route.Upstream
+			resolved.Alias = ""
+			resolved.Target = current
+			return resolved, nil
+		}
+		current = route.Alias
+	}
+	return ResolvedModel{}, fmt.Errorf("模型 %s 的别名链过长或存在循环引用", name)
+}
+
+// mergeModelRoute 只填充 dst 中尚未设置的默认参数
+func mergeModelRoute(dst *ModelRoute, src ModelRoute) {
+	if dst.MaxTokens == 0 {
+		dst.MaxTokens = src.MaxTokens
+	}
+	if dst.MaxTokensLimit == 0 {
+		dst.MaxTokensLimit = src.MaxTokensLimit
+	}
+	if dst.TemperatureMin == nil {
+		dst.TemperatureMin = src.TemperatureMin
+	}
+	if dst.TemperatureMax == nil {
+		dst.TemperatureMax = src.TemperatureMax
+	}
+	if len(dst.Tags) == 0 {
+		dst.Tags = src.Tags
+	}
+}
+
+// Resolve 解析模型名，未配置时返回 false
+func (t *ModelTable) Resolve(name string) (ResolvedModel, bool) {
+	if _, ok := t.routes[name]; !ok {
+		return ResolvedModel{}, false
+	}
+	resolved, err := t.resolve(name)
+	return resolved, err == nil
+}
+
+// Names 返回所有可用模型名（按字母排序）
+func (t *ModelTable) Names() []string {
+	names := make([]string, 0, len(t.routes))
+	for name := range t.routes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadModelTableFile 从 YAML（.yaml/.yml）或 JSON 文件加载模型路由表
+func LoadModelTableFile(path string) (*ModelTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取模型配置文件失败: %w", err)
+	}
+
+	var file modelsFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &file)
+	default:
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析模型配置文件失败: %w", err)
+	}
+
+	table, err := NewModelTable(file.Models)
+	if err != nil {
+		return nil, fmt.Errorf("模型配置无效: %w", err)
+	}
+	return table, nil
+}
+
+// currentModelTable 当前生效的模型路由表，热加载时整体替换
+var currentModelTable atomic.Pointer[ModelTable]
+
+func init() {
+	table, err := NewModelTable(nil)
+	if err != nil {
+		panic(fmt.Sprintf("内置模型映射无效: %v", err))
+	}
+	currentModelTable.Store(table)
+}
+
+// SetModelTable 替换当前生效的模型路由表
+func SetModelTable(table *ModelTable) {
+	currentModelTable.Store(table)
+}
+
+// CurrentModelTable 返回当前生效的模型路由表
+func CurrentModelTable() *ModelTable {
+	return currentModelTable.Load()
+}
+
+// ResolveModel 在当前路由表中解析模型名
+func ResolveModel(name string) (ResolvedModel, bool) {
+	return CurrentModelTable().Resolve(name)
+}
@@ -0,0 +1,105 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeModelsFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	return path
+}
+
+func TestLoadModelTableFile_YAMLAliases(t *testing.T) {
+	path := writeModelsFile(t, "models.yaml", `
+models:
+  sonnet-latest:
+    alias: claude-sonnet-4-5
+    tags: [primary]
+  gpt-4o:
+    alias: sonnet-latest
+    max_tokens: 4096
+    max_tokens_limit: 8192
+    temperature_max: 0.8
+  custom-opus:
+    upstream: CLAUDE_OPUS_CUSTOM
+`)
+
+	table, err := LoadModelTableFile(path)
+	require.NoError(t, err)
+
+	route, ok := table.Resolve("gpt-4o")
+	require.True(t, ok)
+	assert.Equal(t, "CLAUDE_SONNET_4_5_20250929_V1_0", route.Upstream)
+	assert.Equal(t, "claude-sonnet-4-5", route.Target)
+	assert.Equal(t, 4096, route.MaxTokens)
+	assert.Equal(t, 8192, route.MaxTokensLimit)
+	assert.Equal(t, 0.8, *route.TemperatureMax)
+	assert.Equal(t, []string{"primary"}, route.Tags, "未设置的字段沿别名链继承")
+
+	route, ok = table.Resolve("custom-opus")
+	require.True(t, ok)
+	assert.Equal(t, "CLAUDE_OPUS_CUSTOM", route.Upstream)
+
+	_, ok = table.Resolve("claude-sonnet-4-20250514")
+	assert.True(t, ok, "内置映射保留")
+	_, ok = table.Resolve("unknown")
+	assert.False(t, ok)
+
+	assert.Contains(t, table.Names(), "gpt-4o")
+	assert.IsIncreasing(t, table.Names())
+}
+
+func TestLoadModelTableFile_JSON(t *testing.T) {
+	path := writeModelsFile(t, "models.json", `{"models":{"claude-sonnet-4-5":{"upstream":"OVERRIDDEN","tags":["backup"]}}}`)
+
+	table, err := LoadModelTableFile(path)
+	require.NoError(t, err)
+
+	route, ok := table.Resolve("claude-sonnet-4-5")
+	require.True(t, ok)
+	assert.Equal(t, "OVERRIDDEN", route.Upstream, "配置文件覆盖内置映射")
+	assert.Equal(t, []string{"backup"}, route.Tags)
+}
+
+func TestNewModelTable_Invalid(t *testing.T) {
+	low, high := 0.2, 0.1
+	tests := []struct {
+		name   string
+		routes map[string]ModelRoute
+	}{
+		{"同时设置upstream与alias", map[string]ModelRoute{"m": {Upstream: "X", Alias: "claude-sonnet-4-5"}}},
+		{"两者都未设置", map[string]ModelRoute{"m": {}}},
+		{"别名目标不存在", map[string]ModelRoute{"m": {Alias: "missing"}}},
+		{"循环别名", map[string]ModelRoute{"a": {Alias: "b"}, "b": {Alias: "a"}}},
+		{"默认值超过上限", map[string]ModelRoute{"m": {Upstream: "X", MaxTokens: 200, MaxTokensLimit: 100}}},
+		{"temperature区间无效", map[string]ModelRoute{"m": {Upstream: "X", TemperatureMin: &low, TemperatureMax: &high}}},
+		{"空模型名", map[string]ModelRoute{" ": {Upstream: "X"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewModelTable(tt.routes)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestResolveModel_UsesCurrentTable(t *testing.T) {
+	original := CurrentModelTable()
+	t.Cleanup(func() { SetModelTable(original) })
+
+	table, err := NewModelTable(map[string]ModelRoute{"fast": {Alias: "claude-haiku-4-5-20251001"}})
+	require.NoError(t, err)
+	SetModelTable(table)
+
+	route, ok := ResolveModel("fast")
+	require.True(t, ok)
+	assert.Equal(t, "auto", route.Upstream)
+}
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultClientToken 未设置 KIRO_CLIENT_TOKEN 时使用的开发默认密钥
+const DefaultClientToken = "123456"
+
+// ServerConfig 服务的核心配置，启动时一次性从环境变量加载并校验
+// 数值无效（如 SERVER_READ_TIMEOUT_SECONDS=abc）时启动失败，而不是静默使用默认值
+type ServerConfig struct {
+	Port         string
+	ClientToken  string
+	GinMode      string
+	Admin        AdminSettings
+	Timeouts     TimeoutSettings
+	Limits       LimitSettings
+	FeatureFlags string // FEATURE_FLAGS 原始值，由 server 包解析功能名
+}
+
+// AdminSettings 管理后台登录与会话
+type AdminSettings struct {
+	Username        string
+	Password        string
+	PasswordHash    string // bcrypt/argon2id 哈希，替代明文 Password
+	UsersFile       string
+	SessionIdle     time.Duration
+	SessionAbsolute time.Duration
+	CookieSameSite  string // 会话与 CSRF cookie 的 SameSite 属性：lax（默认）或 strict
+}
+
+// TimeoutSettings 下游连接超时与请求总时长上限
+type TimeoutSettings struct {
+	ReadHeader      time.Duration
+	Read            time.Duration
+	Idle            time.Duration
+	RequestDeadline time.Duration // 0 表示不限制
+}
+
+// LimitSettings 限流与请求大小限制（0 表示不限制）
+type LimitSettings struct {
+	RateLimitRPS             float64
+	RateLimitBurst           int
+	StreamRPS                float64
+	StreamBurst              int
+	MaxConcurrentStreams     int
+	MaxToolDescriptionLength int
+}
+
+// LoadServerConfig 从环境变量加载服务配置，返回所有无效项合并后的错误（每项一行，包含变量名与原因）
+func LoadServerConfig() (*ServerConfig, error) {
+	p := &envParser{}
+	cfg := &ServerConfig{
+		Port:         p.port("PORT", "8080"),
+		ClientToken:  p.str("KIRO_CLIENT_TOKEN", DefaultClientToken),
+		GinMode:      p.oneOf("GIN_MODE", "release", "debug", "release", "test"),
+		FeatureFlags: os.Getenv("FEATURE_FLAGS"),
+		Admin: AdminSettings{
+			Username:        p.str("ADMIN_USERNAME", "admin"),
+			Password:        os.Getenv("ADMIN_PASSWORD"),
+			PasswordHash:    strings.TrimSpace(os.Getenv("ADMIN_PASSWORD_HASH")),
+			UsersFile:       os.Getenv("ADMIN_USERS_FILE"),
+			SessionIdle:     p.duration("SESSION_IDLE_MINUTES", 30, time.Minute, 1),
+			SessionAbsolute: p.duration("SESSION_ABSOLUTE_HOURS", 12, time.Hour, 1),
+			CookieSameSite:  p.oneOf("ADMIN_COOKIE_SAMESITE", "lax", "lax", "strict"),
+		},
+		Timeouts: TimeoutSettings{
+			ReadHeader:      p.duration("SERVER_READ_HEADER_TIMEOUT_SECONDS", 10, time.Second, 1),
+			Read:            p.duration("SERVER_READ_TIMEOUT_SECONDS", 60, time.Second, 1),
+			Idle:            p.duration("SERVER_IDLE_TIMEOUT_SECONDS", 120, time.Second, 1),
+			RequestDeadline: p.duration("REQUEST_DEADLINE_SECONDS", 900, time.Second, 0),
+		},
+		Limits: LimitSettings{
+			RateLimitRPS:             p.float("RATE_LIMIT_RPS", 0),
+			RateLimitBurst:           p.int("RATE_LIMIT_BURST", 0, 0),
+			StreamRPS:                p.float("RATE_LIMIT_STREAM_RPS", 0),
+			StreamBurst:              p.int("RATE_LIMIT_STREAM_BURST", 0, 0),
+			MaxConcurrentStreams:     p.int("RATE_LIMIT_MAX_CONCURRENT_STREAMS", 0, 0),
+			MaxToolDescriptionLength: p.int("MAX_TOOL_DESCRIPTION_LENGTH", 10000, 1),
+		},
+	}
+	if cfg.Admin.Password != "" && cfg.Admin.PasswordHash != "" {
+		p.errs = append(p.errs, fmt.Errorf("ADMIN_PASSWORD 与 ADMIN_PASSWORD_HASH 不能同时设置"))
+	}
+	if len(p.errs) > 0 {
+		return nil, errors.Join(p.errs...)
+	}
+	return cfg, nil
+}
+
+// UsingDefaultClientToken 是否使用开发默认的客户端密钥
+func (c *ServerConfig) UsingDefaultClientToken() bool {
+	return c.ClientToken == DefaultClientToken
+}
+
+// View 返回只读视图（密钥字段脱敏，时长以字符串表示），供管理接口展示
+func (c *ServerConfig) View() map[string]any {
+	return map[string]any{
+		"port":          c.Port,
+		"client_token":  maskSetting(c.ClientToken),
+		"gin_mode":      c.GinMode,
+		"feature_flags": c.FeatureFlags,
+		"admin": map[string]any{
+			"username":         c.Admin.Username,
+			"password":         maskSetting(c.Admin.Password),
+			"password_hash":    maskSetting(c.Admin.PasswordHash),
+			"users_file":       c.Admin.UsersFile,
+			"session_idle":     c.Admin.SessionIdle.String(),
+			"session_absolute": c.Admin.SessionAbsolute.String(),
+			"cookie_samesite":  c.Admin.CookieSameSite,
+		},
+		"timeouts": map[string]any{
+			"read_header":      c.Timeouts.ReadHeader.String(),
+			"read":             c.Timeouts.Read.String(),
+			"idle":             c.Timeouts.Idle.String(),
+			"request_deadline": c.Timeouts.RequestDeadline.String(),
+		},
+		"limits": map[string]any{
+			"rate_limit_rps":              c.Limits.RateLimitRPS,
+			"rate_limit_burst":            c.Limits.RateLimitBurst,
+			"stream_rps":                  c.Limits.StreamRPS,
+			"stream_burst":                c.Limits.StreamBurst,
+			"max_concurrent_streams":      c.Limits.MaxConcurrentStreams,
+			"max_tool_description_length": c.Limits.MaxToolDescriptionLength,
+		},
+	}
+}
+
+// maskSetting 脱敏密钥配置，只说明是否设置及长度
+func maskSetting(value string) string {
+	if value == "" {
+		return ""
+	}
+	return fmt.Sprintf("***（已设置，长度%d）", len(value))
+}
+
+// envParser 严格解析环境变量：未设置时使用默认值，设置了无效值时记录错误
+type envParser struct {
+	errs []error
+}
+
+func (p *envParser) fail(key, value, reason string) {
+	p.errs = append(p.errs, fmt.Errorf("%s=%q 无效: %s", key, value, reason))
+}
+
+func (p *envParser) str(key, def string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return def
+}
+
+func (p *envParser) int(key string, def, min int) int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		p.fail(key, value, "需要整数")
+		return def
+	}
+	if n < min {
+		p.fail(key, value, fmt.Sprintf("不能小于%d", min))
+		return def
+	}
+	return n
+}
+
+func (p *envParser) float(key string, def float64) float64 {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		p.fail(key, value, "需要数字")
+		return def
+	}
+	if f < 0 {
+		p.fail(key, value, "不能为负数")
+		return def
+	}
+	return f
+}
+
+// duration 解析以 unit 为单位的整数时长
+func (p *envParser) duration(key string, def int, unit time.Duration, min int) time.Duration {
+	return time.Duration(p.int(key, def, min)) * unit
+}
+
+func (p *envParser) port(key, def string) string {
+	value := p.str(key, def)
+	if n, err := strconv.Atoi(value); err != nil || n < 1 || n > 65535 {
+		p.fail(key, value, "端口需为 1-65535 的整数")
+		return def
+	}
+	return value
+}
+
+func (p *envParser) oneOf(key, def string, allowed ...string) string {
+	value := p.str(key, def)
+	for _, a := range allowed {
+		if value == a {
+			return value
+		}
+	}
+	p.fail(key, value, "可选值为 "+strings.Join(allowed, "/"))
+	return def
+}
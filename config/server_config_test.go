@@ -0,0 +1,59 @@
+package config
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadServerConfig_Defaults(t *testing.T) {
+	for _, key := range []string{"PORT", "KIRO_CLIENT_TOKEN", "GIN_MODE", "ADMIN_PASSWORD", "SERVER_READ_TIMEOUT_SECONDS", "RATE_LIMIT_RPS"} {
+		t.Setenv(key, "")
+	}
+	cfg, err := LoadServerConfig()
+	require.NoError(t, err)
+	assert.Equal(t, "8080", cfg.Port)
+	assert.Equal(t, "release", cfg.GinMode)
+	assert.True(t, cfg.UsingDefaultClientToken())
+	assert.Equal(t, 30*time.Minute, cfg.Admin.SessionIdle)
+	assert.Equal(t, 60*time.Second, cfg.Timeouts.Read)
+	assert.Equal(t, 900*time.Second, cfg.Timeouts.RequestDeadline)
+	assert.Zero(t, cfg.Limits.RateLimitRPS)
+}
+
+func TestLoadServerConfig_ReportsAllInvalidValues(t *testing.T) {
+	t.Setenv("PORT", "70000")
+	t.Setenv("GIN_MODE", "prod")
+	t.Setenv("SERVER_READ_TIMEOUT_SECONDS", "abc")
+	t.Setenv("RATE_LIMIT_RPS", "-1")
+	t.Setenv("SESSION_IDLE_MINUTES", "0")
+
+	_, err := LoadServerConfig()
+	require.Error(t, err)
+	for _, want := range []string{"PORT=", "GIN_MODE=", "SERVER_READ_TIMEOUT_SECONDS=", "RATE_LIMIT_RPS=", "SESSION_IDLE_MINUTES="} {
+		assert.Contains(t, err.Error(), want)
+	}
+}
+
+func TestServerConfig_ViewMasksSecrets(t *testing.T) {
+	t.Setenv("KIRO_CLIENT_TOKEN", "super-secret-token")
+	t.Setenv("ADMIN_PASSWORD", "hunter2")
+	cfg, err := LoadServerConfig()
+	require.NoError(t, err)
+
+	view := cfg.View()
+	assert.Equal(t, "***（已设置，长度18）", view["client_token"])
+	assert.Equal(t, "***（已设置，长度7）", view["admin"].(map[string]any)["password"])
+	assert.NotContains(t, fmt.Sprint(view), "hunter2")
+}
+
+func TestLoadServerConfig_RejectsPasswordAndHash(t *testing.T) {
+	t.Setenv("ADMIN_PASSWORD", "secret")
+	t.Setenv("ADMIN_PASSWORD_HASH", "$2a$10$abc")
+	_, err := LoadServerConfig()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "ADMIN_PASSWORD_HASH")
+}
@@ -0,0 +1,115 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// LoadServerConfigFile 读取通用服务配置文件（.yaml/.yml、.toml，其余按JSON处理），写入对应的环境变量
+// 键名按层级以下划线连接并转为大写，如 port → PORT、server.read_timeout_seconds → SERVER_READ_TIMEOUT_SECONDS；
+// 列表以逗号连接。已设置的环境变量（含 .env 中的）优先，不会被覆盖。返回从文件写入的变量名
+func LoadServerConfigFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取服务配置文件失败: %w", err)
+	}
+
+	var root map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &root)
+	case ".toml":
+		err = toml.Unmarshal(data, &root)
+	default:
+		err = json.Unmarshal(data, &root)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析服务配置文件失败: %w", err)
+	}
+
+	values := make(map[string]string)
+	if err := flattenServerConfig("", root, values); err != nil {
+		return nil, fmt.Errorf("服务配置文件无效: %w", err)
+	}
+
+	var applied []string
+	for name, value := range values {
+		if _, exists := os.LookupEnv(name); exists {
+			continue
+		}
+		if err := os.Setenv(name, value); err != nil {
+			return nil, fmt.Errorf("设置环境变量 %s 失败: %w", name, err)
+		}
+		applied = append(applied, name)
+	}
+	sort.Strings(applied)
+	return applied, nil
+}
+
+// flattenServerConfig 将嵌套的配置展开为环境变量名到值的映射
+func flattenServerConfig(prefix string, value any, out map[string]string) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case map[string]any:
+		for key, child := range v {
+			name := strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(strings.TrimSpace(key)))
+			if prefix != "" {
+				name = prefix + "_" + name
+			}
+			if err := flattenServerConfig(name, child, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, ok := serverConfigScalar(item)
+			if !ok {
+				return fmt.Errorf("%s: 列表只能包含字符串、数字或布尔值", prefix)
+			}
+			items = append(items, s)
+		}
+		out[prefix] = strings.Join(items, ",")
+		return nil
+	default:
+		s, ok := serverConfigScalar(v)
+		if !ok {
+			return fmt.Errorf("%s: 不支持的值类型 %T", prefix, v)
+		}
+		if prefix == "" {
+			return fmt.Errorf("配置文件顶层必须是键值对")
+		}
+		out[prefix] = s
+		return nil
+	}
+}
+
+// serverConfigScalar 将标量值格式化为环境变量的字符串形式
+func serverConfigScalar(value any) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case int:
+		return strconv.Itoa(v), true
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case uint64:
+		return strconv.FormatUint(v, 10), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
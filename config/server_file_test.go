@@ -0,0 +1,65 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadServerConfigFile(t *testing.T) {
+	files := map[string]string{
+		"server.yaml": `
+port: 9090
+server:
+  read_timeout_seconds: 30
+rate-limit:
+  rpm: 120
+cors_allowed_origins: [https://a.example, https://b.example]
+log_level: debug
+`,
+		"server.toml": `
+port = 9090
+log_level = "debug"
+cors_allowed_origins = ["https://a.example", "https://b.example"]
+
+[server]
+read_timeout_seconds = 30
+
+[rate-limit]
+rpm = 120
+`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+			t.Setenv("LOG_LEVEL", "warn") // 已设置的环境变量优先
+			for _, key := range []string{"PORT", "SERVER_READ_TIMEOUT_SECONDS", "RATE_LIMIT_RPM", "CORS_ALLOWED_ORIGINS"} {
+				t.Setenv(key, "")
+				os.Unsetenv(key)
+			}
+
+			applied, err := LoadServerConfigFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"CORS_ALLOWED_ORIGINS", "PORT", "RATE_LIMIT_RPM", "SERVER_READ_TIMEOUT_SECONDS"}, applied)
+			assert.Equal(t, "9090", os.Getenv("PORT"))
+			assert.Equal(t, "30", os.Getenv("SERVER_READ_TIMEOUT_SECONDS"))
+			assert.Equal(t, "120", os.Getenv("RATE_LIMIT_RPM"))
+			assert.Equal(t, "https://a.example,https://b.example", os.Getenv("CORS_ALLOWED_ORIGINS"))
+			assert.Equal(t, "warn", os.Getenv("LOG_LEVEL"))
+		})
+	}
+}
+
+func TestLoadServerConfigFile_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("upstreams:\n  - name: a\n"), 0o600))
+	_, err := LoadServerConfigFile(path)
+	assert.ErrorContains(t, err, "UPSTREAMS")
+
+	_, err = LoadServerConfigFile(filepath.Join(t.TempDir(), "missing.json"))
+	assert.Error(t, err)
+}
@@ -17,6 +17,25 @@ const (
 	// 过期后需要重新刷新
 	TokenCacheTTL = 5 * time.Minute
 
+	// TokenExpirySkew Token过期判断的提前量
+	// 在到期前提前视为过期，吸收本机与上游之间的时钟偏差
+	TokenExpirySkew = 1 * time.Minute
+
+	// TokenRefreshCheckInterval 主动刷新调度器检查到期token的间隔
+	TokenRefreshCheckInterval = 10 * time.Second
+
+	// TokenRefreshRetryInterval 主动刷新失败后的重试间隔（当前token仍可用到过期）
+	TokenRefreshRetryInterval = 30 * time.Second
+
+	// ========== 时钟跳变检测 ==========
+
+	// ClockCheckInterval 时钟跳变检测间隔
+	ClockCheckInterval = 10 * time.Second
+
+	// ClockJumpThreshold 墙上时钟与单调时钟偏差超过该值视为时钟跳变
+	// 常见原因：NTP校正、虚拟机暂停/恢复、手动修改系统时间
+	ClockJumpThreshold = 30 * time.Second
+
 	// HTTPClientKeepAlive HTTP客户端Keep-Alive间隔
 	HTTPClientKeepAlive = 30 * time.Second
 
@@ -0,0 +1,12 @@
+package config
+
+// 版本信息，构建时通过 ldflags 注入：
+//
+//	go build -ldflags="-X kiro2api/config.Version=v1.2.3 -X kiro2api/config.BuildTime=2025-10-01T00:00:00Z"
+var (
+	// Version 版本号
+	Version = "dev"
+
+	// BuildTime 构建时间（RFC3339）
+	BuildTime = ""
+)
@@ -0,0 +1,80 @@
+package converter
+
+import (
+	"fmt"
+
+	"kiro2api/types"
+)
+
+// MaxCacheBreakpoints 单个请求最多允许的 cache_control 断点数（与 Anthropic API 一致）
+const MaxCacheBreakpoints = 4
+
+// ValidateCacheControl 校验提示缓存标记：type 必须为 ephemeral，ttl 为 5m 或 1h，断点合计不超过4个
+// 标记可以出现在 tools、system 与消息内容块上
+// CodeWhisperer 请求没有缓存断点字段，标记校验后不转发，是否命中缓存由上游决定；
+// 上游在 metadataEvent 中返回的缓存用量会透传到响应的 usage
+func ValidateCacheControl(req types.AnthropicRequest) error {
+	count := 0
+	check := func(path string, cc *types.CacheControl) error {
+		if cc == nil {
+			return nil
+		}
+		count++
+		if count > MaxCacheBreakpoints {
+			return fmt.Errorf("cache_control 断点最多 %d 个", MaxCacheBreakpoints)
+		}
+		if cc.Type != "ephemeral" {
+			return fmt.Errorf("%s.cache_control.type 必须为 ephemeral，实际为 %q", path, cc.Type)
+		}
+		if cc.TTL != "" && cc.TTL != "5m" && cc.TTL != "1h" {
+			return fmt.Errorf("%s.cache_control.ttl 必须为 5m 或 1h，实际为 %q", path, cc.TTL)
+		}
+		return nil
+	}
+
+	for i, tool := range req.Tools {
+		if err := check(fmt.Sprintf("tools[%d]", i), tool.CacheControl); err != nil {
+			return err
+		}
+	}
+	for i, block := range req.System {
+		if err := check(fmt.Sprintf("system[%d]", i), block.CacheControl); err != nil {
+			return err
+		}
+	}
+	for i, msg := range req.Messages {
+		blocks, ok := msg.Content.([]any)
+		if !ok {
+			continue
+		}
+		for j, item := range blocks {
+			block, ok := item.(map[string]any)
+			if !ok {
+				continue
+			}
+			cc, err := parseCacheControl(block["cache_control"])
+			if err != nil {
+				return fmt.Errorf("messages[%d].content[%d].cache_control: %w", i, j, err)
+			}
+			if err := check(fmt.Sprintf("messages[%d].content[%d]", i, j), cc); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// parseCacheControl 解析内容块中的 cache_control（未设置时返回 nil）
+func parseCacheControl(value any) (*types.CacheControl, error) {
+	if value == nil {
+		return nil, nil
+	}
+	m, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("必须是对象")
+	}
+	cc := &types.CacheControl{}
+	cc.Type, _ = m["type"].(string)
+	cc.TTL, _ = m["ttl"].(string)
+	return cc, nil
+}
@@ -0,0 +1,51 @@
+package converter
+
+import (
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCacheControl(t *testing.T) {
+	ephemeral := &types.CacheControl{Type: "ephemeral"}
+	block := func(cc any) map[string]any {
+		return map[string]any{"type": "text", "text": "长文档", "cache_control": cc}
+	}
+	req := types.AnthropicRequest{
+		Tools:  []types.AnthropicTool{{Name: "search", CacheControl: ephemeral}},
+		System: []types.AnthropicSystemMessage{{Type: "text", Text: "规则", CacheControl: &types.CacheControl{Type: "ephemeral", TTL: "1h"}}},
+		Messages: []types.AnthropicRequestMessage{
+			{Role: "user", Content: []any{block(map[string]any{"type": "ephemeral", "ttl": "5m"})}},
+			{Role: "assistant", Content: "好的"},
+		},
+	}
+	require.NoError(t, ValidateCacheControl(req))
+
+	tests := []struct {
+		name   string
+		modify func(r *types.AnthropicRequest)
+		want   string
+	}{
+		{"未知类型", func(r *types.AnthropicRequest) { r.Tools[0].CacheControl = &types.CacheControl{Type: "persistent"} }, "tools[0].cache_control.type"},
+		{"未知TTL", func(r *types.AnthropicRequest) { r.System[0].CacheControl.TTL = "2h" }, "system[0].cache_control.ttl"},
+		{"非对象", func(r *types.AnthropicRequest) { r.Messages[0].Content = []any{block("ephemeral")} }, "messages[0].content[0].cache_control"},
+		{"超过4个断点", func(r *types.AnthropicRequest) {
+			r.Messages[0].Content = []any{block(map[string]any{"type": "ephemeral"}), block(map[string]any{"type": "ephemeral"}), block(map[string]any{"type": "ephemeral"})}
+		}, "最多 4 个"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := req
+			r.Tools = []types.AnthropicTool{{Name: "search", CacheControl: ephemeral}}
+			r.System = []types.AnthropicSystemMessage{{Type: "text", Text: "规则", CacheControl: &types.CacheControl{Type: "ephemeral", TTL: "1h"}}}
+			r.Messages = append([]types.AnthropicRequestMessage(nil), req.Messages...)
+			tt.modify(&r)
+			err := ValidateCacheControl(r)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
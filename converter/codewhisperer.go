@@ -1,6 +1,7 @@
 package converter
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
@@ -86,6 +87,12 @@ func validateCodeWhispererRequest(cwReq *types.CodeWhispererRequest) error {
 	return nil
 }
 
+// isInvalidImageError 判断是否为图片输入错误（需要返回给客户端而不是跳过）
+func isInvalidImageError(err error) bool {
+	var imageErr *types.InvalidImageError
+	return errors.As(err, &imageErr)
+}
+
 // extractToolResultsFromMessage 从消息内容中提取工具结果
 func extractToolResultsFromMessage(content any) []types.ToolResult {
 	var toolResults []types.ToolResult
@@ -208,6 +215,11 @@ func BuildCodeWhispererRequest(anthropicReq types.AnthropicRequest, ctx *gin.Con
 
 	cwReq := types.CodeWhispererRequest{}
 
+	// 开启扩展思考时在系统提示最前面注入思考标记（复制切片，不修改调用方的请求）
+	if prompt := thinkingSystemPrompt(anthropicReq); prompt != "" {
+		anthropicReq.System = append([]types.AnthropicSystemMessage{{Type: "text", Text: prompt}}, anthropicReq.System...)
+	}
+
 	// 设置代理相关字段 (基于参考文档的标准配置)
 	// 使用稳定的代理延续ID生成器，保持会话连续性 (KISS + DRY原则)
 	cwReq.ConversationState.AgentContinuationId = utils.GenerateStableAgentContinuationID(ctx)
@@ -253,7 +265,7 @@ func BuildCodeWhispererRequest(anthropicReq types.AnthropicRequest, ctx *gin.Con
 
 	textContent, images, err := processMessageContent(lastMessage.Content)
 	if err != nil {
-		return cwReq, fmt.Errorf("处理消息内容失败: %v", err)
+		return cwReq, fmt.Errorf("处理消息内容失败: %w", err)
 	}
 
 	cwReq.ConversationState.CurrentMessage.UserInputMessage.Content = textContent
@@ -280,8 +292,9 @@ func BuildCodeWhispererRequest(anthropicReq types.AnthropicRequest, ctx *gin.Con
 		}
 	}
 
-	// 检查模型映射是否存在，如果不存在则返回错误
-	modelId := config.ModelMap[anthropicReq.Model]
+	// 按模型路由表解析上游模型（支持别名），不存在则返回错误
+	route, _ := config.ResolveModel(anthropicReq.Model)
+	modelId := route.Upstream
 	if modelId == "" {
 		logger.Warn("模型映射不存在",
 			logger.String("requested_model", anthropicReq.Model),
@@ -408,11 +421,15 @@ func BuildCodeWhispererRequest(anthropicReq types.AnthropicRequest, ctx *gin.Con
 					for _, userMsg := range userMessagesBuffer {
 						// 处理每个user消息的内容和图片
 						messageContent, messageImages, err := processMessageContent(userMsg.Content)
-						if err == nil && messageContent != "" {
-							contentParts = append(contentParts, messageContent)
-							if len(messageImages) > 0 {
-								allImages = append(allImages, messageImages...)
+						if err != nil {
+							if isInvalidImageError(err) {
+								return cwReq, fmt.Errorf("处理历史消息失败: %w", err)
 							}
+						} else {
+							if messageContent != "" {
+								contentParts = append(contentParts, messageContent)
+							}
+							allImages = append(allImages, messageImages...)
 						}
 
 						// 收集工具结果
@@ -478,11 +495,15 @@ func BuildCodeWhispererRequest(anthropicReq types.AnthropicRequest, ctx *gin.Con
 
 			for _, userMsg := range userMessagesBuffer {
 				messageContent, messageImages, err := processMessageContent(userMsg.Content)
-				if err == nil && messageContent != "" {
-					contentParts = append(contentParts, messageContent)
-					if len(messageImages) > 0 {
-						allImages = append(allImages, messageImages...)
+				if err != nil {
+					if isInvalidImageError(err) {
+						return cwReq, fmt.Errorf("处理历史消息失败: %w", err)
+					}
+				} else {
+					if messageContent != "" {
+						contentParts = append(contentParts, messageContent)
 					}
+					allImages = append(allImages, messageImages...)
 				}
 
 				toolResults := extractToolResultsFromMessage(userMsg.Content)
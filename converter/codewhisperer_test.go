@@ -1,6 +1,7 @@
 package converter
 
 import (
+	"encoding/base64"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -143,9 +144,117 @@ func TestBuildCodeWhispererRequest_FilterWebSearchTool(t *testing.T) {
 	assert.Equal(t, "get_weather", cwReq.ConversationState.CurrentMessage.UserInputMessage.UserInputMessageContext.Tools[0].ToolSpecification.Name)
 }
 
+// testPNGBase64 仅包含PNG文件头的最小数据，足以通过格式识别
+var testPNGBase64 = base64.StdEncoding.EncodeToString([]byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A, 0x00, 0x00, 0x00, 0x0D})
+
 func TestBuildCodeWhispererRequest_WithImages(t *testing.T) {
-	t.Skip("图片验证测试需要有效的 base64 编码图片数据，跳过以保持测试套件的稳定性")
-	// 注意：图片处理逻辑在 processMessageContent 中，已被其他测试间接覆盖
+	anthropicReq := types.AnthropicRequest{
+		Model:     "claude-sonnet-4-20250514",
+		MaxTokens: 1024,
+		Messages: []types.AnthropicRequestMessage{
+			{
+				Role: "user",
+				Content: []any{
+					map[string]any{"type": "text", "text": "描述这张图片"},
+					map[string]any{
+						"type":   "image",
+						"source": map[string]any{"type": "base64", "media_type": "image/png", "data": testPNGBase64},
+					},
+					// OpenAI 格式的 data URL 同样支持
+					map[string]any{
+						"type":      "image_url",
+						"image_url": map[string]any{"url": "data:image/png;base64," + testPNGBase64},
+					},
+				},
+			},
+		},
+	}
+
+	cwReq, err := BuildCodeWhispererRequest(anthropicReq, nil)
+
+	require.NoError(t, err)
+	userInput := cwReq.ConversationState.CurrentMessage.UserInputMessage
+	assert.Equal(t, "描述这张图片", userInput.Content)
+	require.Len(t, userInput.Images, 2)
+	assert.Equal(t, "png", userInput.Images[0].Format)
+	assert.Equal(t, testPNGBase64, userInput.Images[0].Source.Bytes)
+}
+
+func TestBuildCodeWhispererRequest_InvalidImage(t *testing.T) {
+	tests := []struct {
+		name  string
+		block map[string]any
+		want  string
+	}{
+		{
+			name: "不支持的格式",
+			block: map[string]any{
+				"type":   "image",
+				"source": map[string]any{"type": "base64", "media_type": "image/tiff", "data": testPNGBase64},
+			},
+			want: "不支持的图片格式",
+		},
+		{
+			name: "格式与数据不符",
+			block: map[string]any{
+				"type":   "image",
+				"source": map[string]any{"type": "base64", "media_type": "image/jpeg", "data": testPNGBase64},
+			},
+			want: "图片格式不匹配",
+		},
+		{
+			name:  "不支持的URL协议",
+			block: map[string]any{"type": "image_url", "image_url": map[string]any{"url": "file:///etc/passwd"}},
+			want:  "仅支持data URL或http(s)图片地址",
+		},
+		{
+			name:  "缺少source",
+			block: map[string]any{"type": "image"},
+			want:  "缺少source",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			anthropicReq := types.AnthropicRequest{
+				Model:     "claude-sonnet-4-20250514",
+				MaxTokens: 1024,
+				Messages: []types.AnthropicRequestMessage{
+					{Role: "user", Content: []any{tt.block}},
+				},
+			}
+
+			_, err := BuildCodeWhispererRequest(anthropicReq, nil)
+
+			require.Error(t, err)
+			var imageErr *types.InvalidImageError
+			require.ErrorAs(t, err, &imageErr)
+			assert.Contains(t, imageErr.Error(), tt.want)
+		})
+	}
+}
+
+func TestBuildCodeWhispererRequest_InvalidImageInHistory(t *testing.T) {
+	anthropicReq := types.AnthropicRequest{
+		Model:     "claude-sonnet-4-20250514",
+		MaxTokens: 1024,
+		Messages: []types.AnthropicRequestMessage{
+			{
+				Role: "user",
+				Content: []any{map[string]any{
+					"type":   "image",
+					"source": map[string]any{"type": "base64", "media_type": "image/png", "data": "!!!"},
+				}},
+			},
+			{Role: "assistant", Content: "好的"},
+			{Role: "user", Content: "继续"},
+		},
+	}
+
+	_, err := BuildCodeWhispererRequest(anthropicReq, nil)
+
+	var imageErr *types.InvalidImageError
+	require.ErrorAs(t, err, &imageErr)
 }
 
 func TestBuildCodeWhispererRequest_WithToolResults(t *testing.T) {
@@ -0,0 +1,131 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	"kiro2api/types"
+)
+
+// 旧版文本补全（/v1/completions）：提示包装为单条用户消息，复用聊天补全的转换与响应处理
+
+// ValidateCompletionRequest 校验旧版补全请求，不支持的参数返回错误
+func ValidateCompletionRequest(req types.OpenAICompletionRequest) error {
+	if _, err := CompletionPrompt(req); err != nil {
+		return err
+	}
+	if req.Suffix != "" {
+		return fmt.Errorf("suffix 不受支持")
+	}
+	if req.N != nil && *req.N != 1 {
+		return fmt.Errorf("n 仅支持 1")
+	}
+	if req.BestOf != nil && *req.BestOf != 1 {
+		return fmt.Errorf("best_of 仅支持 1")
+	}
+	if req.Logprobs != nil && *req.Logprobs > 0 {
+		return fmt.Errorf("logprobs 不受支持")
+	}
+	return ValidateOpenAIStop(ConvertCompletionToChat(req))
+}
+
+// CompletionPrompt 取出提示文本：string 或只含一个字符串的数组（不支持批量与 token 数组）
+func CompletionPrompt(req types.OpenAICompletionRequest) (string, error) {
+	var prompt string
+	switch v := req.Prompt.(type) {
+	case string:
+		prompt = v
+	case []any:
+		if len(v) != 1 {
+			return "", fmt.Errorf("prompt 数组只支持一个元素（不支持批量补全）")
+		}
+		s, ok := v[0].(string)
+		if !ok {
+			return "", fmt.Errorf("prompt 必须是字符串（不支持 token 数组）")
+		}
+		prompt = s
+	case nil:
+		return "", fmt.Errorf("prompt 不能为空")
+	default:
+		return "", fmt.Errorf("prompt 必须是字符串")
+	}
+	if strings.TrimSpace(prompt) == "" {
+		return "", fmt.Errorf("prompt 不能为空")
+	}
+	return prompt, nil
+}
+
+// ConvertCompletionToChat 将旧版补全请求转换为单条用户消息的聊天补全请求
+// 调用前应先通过 ValidateCompletionRequest 校验
+func ConvertCompletionToChat(req types.OpenAICompletionRequest) types.OpenAIRequest {
+	prompt, _ := CompletionPrompt(req)
+	return types.OpenAIRequest{
+		Model:         req.Model,
+		Messages:      []types.OpenAIMessage{{Role: "user", Content: prompt}},
+		MaxTokens:     req.MaxTokens,
+		Temperature:   req.Temperature,
+		Stream:        req.Stream,
+		Stop:          req.Stop,
+		StreamOptions: req.StreamOptions,
+	}
+}
+
+// completionID 将聊天补全ID（chatcmpl-）改写为旧版补全ID（cmpl-）
+func completionID(id string) string {
+	return "cmpl-" + strings.TrimPrefix(id, "chatcmpl-")
+}
+
+// ConvertChatToTextCompletion 将聊天补全响应转换为旧版补全响应，echo 非空时回显在文本前
+func ConvertChatToTextCompletion(resp types.OpenAIResponse, echo string) types.OpenAICompletionResponse {
+	choices := make([]types.OpenAICompletionChoice, 0, len(resp.Choices))
+	for _, choice := range resp.Choices {
+		text, _ := choice.Message.Content.(string)
+		choices = append(choices, types.OpenAICompletionChoice{
+			Text:         echo + text,
+			Index:        choice.Index,
+			FinishReason: choice.FinishReason,
+		})
+	}
+	return types.OpenAICompletionResponse{
+		ID:      completionID(resp.ID),
+		Object:  "text_completion",
+		Created: resp.Created,
+		Model:   resp.Model,
+		Choices: choices,
+		Usage:   resp.Usage,
+	}
+}
+
+// ConvertChatChunkToTextCompletion 将聊天补全流式块转换为旧版补全流式块
+// delta.content 转为 text；只有角色、思考或工具调用的块返回 nil（跳过）；用量块（choices 为空）保留
+func ConvertChatChunkToTextCompletion(chunk map[string]any) map[string]any {
+	chatChoices, _ := chunk["choices"].([]map[string]any)
+	choices := make([]map[string]any, 0, len(chatChoices))
+	for _, choice := range chatChoices {
+		delta, _ := choice["delta"].(map[string]any)
+		text, _ := delta["content"].(string)
+		finishReason := choice["finish_reason"]
+		if text == "" && finishReason == nil {
+			continue
+		}
+		choices = append(choices, map[string]any{
+			"text":          text,
+			"index":         choice["index"],
+			"logprobs":      nil,
+			"finish_reason": finishReason,
+		})
+	}
+	if len(choices) == 0 && chunk["usage"] == nil {
+		return nil
+	}
+
+	result := make(map[string]any, len(chunk))
+	for k, v := range chunk {
+		result[k] = v
+	}
+	id, _ := chunk["id"].(string)
+	result["id"] = completionID(id)
+	result["object"] = "text_completion"
+	result["choices"] = choices
+	return result
+}
@@ -0,0 +1,99 @@
+package converter
+
+import (
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateCompletionRequest(t *testing.T) {
+	one, two, zero := 1, 2, 0
+	tests := []struct {
+		name string
+		req  types.OpenAICompletionRequest
+		want string
+	}{
+		{"字符串提示", types.OpenAICompletionRequest{Prompt: "hello"}, ""},
+		{"单元素数组", types.OpenAICompletionRequest{Prompt: []any{"hello"}, N: &one, Logprobs: &zero}, ""},
+		{"缺少提示", types.OpenAICompletionRequest{}, "prompt 不能为空"},
+		{"批量提示", types.OpenAICompletionRequest{Prompt: []any{"a", "b"}}, "批量"},
+		{"token数组", types.OpenAICompletionRequest{Prompt: []any{[]any{1.0, 2.0}}}, "token 数组"},
+		{"suffix", types.OpenAICompletionRequest{Prompt: "a", Suffix: "b"}, "suffix"},
+		{"n>1", types.OpenAICompletionRequest{Prompt: "a", N: &two}, "n 仅支持 1"},
+		{"logprobs", types.OpenAICompletionRequest{Prompt: "a", Logprobs: &two}, "logprobs"},
+		{"stop格式", types.OpenAICompletionRequest{Prompt: "a", Stop: []any{1.0}}, "stop[0]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCompletionRequest(tt.req)
+			if tt.want == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestConvertCompletionToChat(t *testing.T) {
+	maxTokens := 64
+	stream := true
+	chat := ConvertCompletionToChat(types.OpenAICompletionRequest{
+		Model:     "claude-sonnet-4-20250514",
+		Prompt:    []any{"Once upon a time"},
+		MaxTokens: &maxTokens,
+		Stream:    &stream,
+		Stop:      "\n\n",
+	})
+	assert.Equal(t, []types.OpenAIMessage{{Role: "user", Content: "Once upon a time"}}, chat.Messages)
+	assert.Equal(t, &maxTokens, chat.MaxTokens)
+	assert.Equal(t, &stream, chat.Stream)
+	assert.Equal(t, "\n\n", chat.Stop)
+}
+
+func TestConvertChatToTextCompletion(t *testing.T) {
+	resp := ConvertChatToTextCompletion(types.OpenAIResponse{
+		ID:      "chatcmpl-123",
+		Created: 42,
+		Model:   "m",
+		Choices: []types.OpenAIChoice{{Message: types.OpenAIMessage{Role: "assistant", Content: " there"}, FinishReason: "length"}},
+		Usage:   types.Usage{PromptTokens: 3, CompletionTokens: 1, TotalTokens: 4},
+	}, "Hi")
+
+	assert.Equal(t, "cmpl-123", resp.ID)
+	assert.Equal(t, "text_completion", resp.Object)
+	require.Len(t, resp.Choices, 1)
+	assert.Equal(t, "Hi there", resp.Choices[0].Text)
+	assert.Equal(t, "length", resp.Choices[0].FinishReason)
+	assert.Equal(t, 4, resp.Usage.TotalTokens)
+}
+
+func TestConvertChatChunkToTextCompletion(t *testing.T) {
+	chunk := func(delta map[string]any, finish any) map[string]any {
+		return map[string]any{
+			"id":      "chatcmpl-1",
+			"object":  "chat.completion.chunk",
+			"choices": []map[string]any{{"index": 0, "delta": delta, "finish_reason": finish}},
+		}
+	}
+
+	assert.Nil(t, ConvertChatChunkToTextCompletion(chunk(map[string]any{"role": "assistant"}, nil)), "角色块跳过")
+	assert.Nil(t, ConvertChatChunkToTextCompletion(chunk(map[string]any{"reasoning_content": "..."}, nil)), "思考块跳过")
+
+	got := ConvertChatChunkToTextCompletion(chunk(map[string]any{"content": "Hi"}, nil))
+	assert.Equal(t, "cmpl-1", got["id"])
+	assert.Equal(t, "text_completion", got["object"])
+	assert.Equal(t, []map[string]any{{"text": "Hi", "index": 0, "logprobs": nil, "finish_reason": nil}}, got["choices"])
+
+	got = ConvertChatChunkToTextCompletion(chunk(map[string]any{}, "stop"))
+	assert.Equal(t, "stop", got["choices"].([]map[string]any)[0]["finish_reason"])
+
+	usage := map[string]any{"prompt_tokens": 1}
+	got = ConvertChatChunkToTextCompletion(map[string]any{"id": "chatcmpl-1", "choices": []map[string]any{}, "usage": usage})
+	assert.Equal(t, usage, got["usage"])
+	assert.Empty(t, got["choices"])
+}
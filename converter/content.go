@@ -27,6 +27,10 @@ func processMessageContent(content any) (string, []types.CodeWhispererImage, err
 			if block, ok := item.(map[string]any); ok {
 				contentBlock, err := parseContentBlock(block)
 				if err != nil {
+					// 图片无效时返回客户端错误，而不是静默丢弃图片
+					if contentBlock.Type == "image" || contentBlock.Type == "image_url" {
+						return "", nil, &types.InvalidImageError{Err: fmt.Errorf("第%d个内容块: %w", i+1, err)}
+					}
 					logger.Warn("解析内容块失败，跳过", logger.Err(err), logger.Int("index", i))
 					continue // 跳过无法解析的块
 				}
@@ -39,19 +43,11 @@ func processMessageContent(content any) (string, []types.CodeWhispererImage, err
 						logger.Warn("文本块的Text字段为nil")
 					}
 				case "image":
-					// ... 图片处理保持不变
-					if contentBlock.Source != nil {
-						// 验证图片内容
-						if err := utils.ValidateImageContent(contentBlock.Source); err != nil {
-							return "", nil, fmt.Errorf("图片验证失败: %v", err)
-						}
-
-						// 转换为 CodeWhisperer 格式
-						cwImage := utils.CreateCodeWhispererImage(contentBlock.Source)
-						if cwImage != nil {
-							images = append(images, *cwImage)
-						}
+					cwImage, err := toCodeWhispererImage(contentBlock.Source)
+					if err != nil {
+						return "", nil, &types.InvalidImageError{Err: fmt.Errorf("第%d个内容块: %w", i+1, err)}
 					}
+					images = append(images, *cwImage)
 				case "tool_result":
 					// 处理工具结果，支持复杂的内容结构
 					if contentBlock.Content != nil {
@@ -72,7 +68,7 @@ func processMessageContent(content any) (string, []types.CodeWhispererImage, err
 
 	case []types.ContentBlock:
 		// 结构化的内容块数组
-		for _, block := range v {
+		for i, block := range v {
 			switch block.Type {
 			case "text":
 				if block.Text != nil {
@@ -81,18 +77,11 @@ func processMessageContent(content any) (string, []types.CodeWhispererImage, err
 					logger.Warn("结构化文本块的Text字段为nil")
 				}
 			case "image":
-				if block.Source != nil {
-					// 验证图片内容
-					if err := utils.ValidateImageContent(block.Source); err != nil {
-						return "", nil, fmt.Errorf("图片验证失败: %v", err)
-					}
-
-					// 转换为 CodeWhisperer 格式
-					cwImage := utils.CreateCodeWhispererImage(block.Source)
-					if cwImage != nil {
-						images = append(images, *cwImage)
-					}
+				cwImage, err := toCodeWhispererImage(block.Source)
+				if err != nil {
+					return "", nil, &types.InvalidImageError{Err: fmt.Errorf("第%d个内容块: %w", i+1, err)}
 				}
+				images = append(images, *cwImage)
 			case "tool_result":
 				// 处理工具结果，支持复杂的内容结构
 				if block.Content != nil {
@@ -124,6 +113,28 @@ func processMessageContent(content any) (string, []types.CodeWhispererImage, err
 	return result, images, nil
 }
 
+// toCodeWhispererImage 校验图片来源并转换为上游格式，url 类型的来源先下载为 base64
+func toCodeWhispererImage(source *types.ImageSource) (*types.CodeWhispererImage, error) {
+	if source == nil {
+		return nil, fmt.Errorf("图片块缺少source")
+	}
+	if source.Type == "url" {
+		fetched, err := utils.FetchImageSource(source.URL)
+		if err != nil {
+			return nil, err
+		}
+		source = fetched
+	}
+	if err := utils.ValidateImageContent(source); err != nil {
+		return nil, err
+	}
+	cwImage := utils.CreateCodeWhispererImage(source)
+	if cwImage == nil {
+		return nil, fmt.Errorf("不支持的图片格式: %s", source.MediaType)
+	}
+	return cwImage, nil
+}
+
 // parseContentBlock 解析内容块
 func parseContentBlock(block map[string]any) (types.ContentBlock, error) {
 	var contentBlock types.ContentBlock
@@ -162,21 +173,30 @@ func parseContentBlock(block map[string]any) (types.ContentBlock, error) {
 			if data, ok := source["data"].(string); ok {
 				imageSource.Data = data
 			}
+			if imageURL, ok := source["url"].(string); ok {
+				imageSource.URL = imageURL
+			}
 
 			contentBlock.Source = imageSource
 		}
 
 	case "image_url":
 		// 处理OpenAI格式的图片块，转换为Anthropic格式
-		if imageURL, ok := block["image_url"].(map[string]any); ok {
-			imageSource, err := utils.ConvertImageURLToImageSource(imageURL)
-			if err != nil {
-				return contentBlock, fmt.Errorf("转换image_url失败: %v", err)
-			}
-			// 将类型改为image并设置source
-			contentBlock.Type = "image"
-			contentBlock.Source = imageSource
+		imageURL, ok := block["image_url"].(map[string]any)
+		if urlStr, isString := block["image_url"].(string); isString {
+			// 兼容部分客户端直接传字符串
+			imageURL, ok = map[string]any{"url": urlStr}, true
+		}
+		if !ok {
+			return contentBlock, fmt.Errorf("image_url块缺少image_url对象")
+		}
+		imageSource, err := utils.ConvertImageURLToImageSource(imageURL)
+		if err != nil {
+			return contentBlock, fmt.Errorf("转换image_url失败: %w", err)
 		}
+		// 将类型改为image并设置source
+		contentBlock.Type = "image"
+		contentBlock.Source = imageSource
 
 	case "tool_result":
 		if toolUseId, ok := block["tool_use_id"].(string); ok {
@@ -0,0 +1,380 @@
+package converter
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"kiro2api/types"
+	"kiro2api/utils"
+)
+
+// Gemini 格式转换器：generateContent 请求转换为 Anthropic 请求，聊天补全响应转换为 Gemini 响应
+
+// defaultGeminiMaxTokens Gemini 请求未指定 maxOutputTokens 时使用的默认值
+const defaultGeminiMaxTokens = 8192
+
+// ConvertGeminiToAnthropic 将 Gemini generateContent 请求转换为 Anthropic 请求
+// 模型名来自请求路径；没有 id 的 functionCall 生成工具调用ID，functionResponse 按名称与之前的调用配对
+func ConvertGeminiToAnthropic(model string, req types.GeminiRequest) (types.AnthropicRequest, error) {
+	if len(req.Contents) == 0 {
+		return types.AnthropicRequest{}, fmt.Errorf("contents 不能为空")
+	}
+
+	anthropicReq := types.AnthropicRequest{
+		Model:     model,
+		MaxTokens: defaultGeminiMaxTokens,
+	}
+
+	if req.SystemInstruction != nil {
+		for _, part := range req.SystemInstruction.Parts {
+			if part.Text != "" {
+				anthropicReq.System = append(anthropicReq.System, types.AnthropicSystemMessage{Type: "text", Text: part.Text})
+			}
+		}
+	}
+
+	pendingCalls := make(map[string][]string) // 函数名 -> 尚未收到结果的工具调用ID
+	nextCallID := 0
+	for i, content := range req.Contents {
+		role := "user"
+		switch content.Role {
+		case "", "user", "function":
+		case "model":
+			role = "assistant"
+		default:
+			return types.AnthropicRequest{}, fmt.Errorf("contents[%d].role 不支持: %s（支持 user、model）", i, content.Role)
+		}
+
+		blocks := make([]any, 0, len(content.Parts))
+		for j, part := range content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				id := part.FunctionCall.ID
+				if id == "" {
+					nextCallID++
+					id = fmt.Sprintf("toolu_gemini_%d", nextCallID)
+				}
+				pendingCalls[part.FunctionCall.Name] = append(pendingCalls[part.FunctionCall.Name], id)
+				args := part.FunctionCall.Args
+				if args == nil {
+					args = map[string]any{}
+				}
+				blocks = append(blocks, map[string]any{
+					"type":  "tool_use",
+					"id":    id,
+					"name":  part.FunctionCall.Name,
+					"input": args,
+				})
+			case part.FunctionResponse != nil:
+				name := part.FunctionResponse.Name
+				id := part.FunctionResponse.ID
+				if id == "" {
+					if queue := pendingCalls[name]; len(queue) > 0 {
+						id, pendingCalls[name] = queue[0], queue[1:]
+					} else {
+						return types.AnthropicRequest{}, fmt.Errorf("contents[%d].parts[%d].functionResponse 没有对应的 functionCall: %s", i, j, name)
+					}
+				}
+				output, err := utils.SafeMarshal(part.FunctionResponse.Response)
+				if err != nil {
+					return types.AnthropicRequest{}, fmt.Errorf("contents[%d].parts[%d].functionResponse 序列化失败: %w", i, j, err)
+				}
+				blocks = append(blocks, map[string]any{
+					"type":        "tool_result",
+					"tool_use_id": id,
+					"content":     string(output),
+				})
+			case part.InlineData != nil:
+				if !strings.HasPrefix(part.InlineData.MimeType, "image/") {
+					return types.AnthropicRequest{}, fmt.Errorf("contents[%d].parts[%d].inlineData 只支持图片: %s", i, j, part.InlineData.MimeType)
+				}
+				blocks = append(blocks, map[string]any{
+					"type": "image",
+					"source": map[string]any{
+						"type":       "base64",
+						"media_type": part.InlineData.MimeType,
+						"data":       part.InlineData.Data,
+					},
+				})
+			case part.Thought:
+				// 历史中的思考内容不回传上游
+			case part.Text != "":
+				blocks = append(blocks, map[string]any{"type": "text", "text": part.Text})
+			}
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+		anthropicReq.Messages = append(anthropicReq.Messages, types.AnthropicRequestMessage{Role: role, Content: blocks})
+	}
+	if len(anthropicReq.Messages) == 0 {
+		return types.AnthropicRequest{}, fmt.Errorf("contents 没有有效内容")
+	}
+
+	if err := applyGeminiTools(&anthropicReq, req); err != nil {
+		return types.AnthropicRequest{}, err
+	}
+	if err := applyGeminiGenerationConfig(&anthropicReq, req.GenerationConfig); err != nil {
+		return types.AnthropicRequest{}, err
+	}
+	return anthropicReq, nil
+}
+
+// applyGeminiTools 转换函数声明与 toolConfig（NONE 模式不下发工具）
+func applyGeminiTools(anthropicReq *types.AnthropicRequest, req types.GeminiRequest) error {
+	mode := "AUTO"
+	var allowed []string
+	if req.ToolConfig != nil && req.ToolConfig.FunctionCallingConfig != nil {
+		if m := strings.ToUpper(req.ToolConfig.FunctionCallingConfig.Mode); m != "" && m != "MODE_UNSPECIFIED" {
+			mode = m
+		}
+		allowed = req.ToolConfig.FunctionCallingConfig.AllowedFunctionNames
+	}
+
+	switch mode {
+	case "AUTO":
+	case "ANY":
+		if len(allowed) == 1 {
+			anthropicReq.ToolChoice = &types.ToolChoice{Type: "tool", Name: allowed[0]}
+		} else {
+			anthropicReq.ToolChoice = &types.ToolChoice{Type: "any"}
+		}
+	case "NONE":
+		return nil
+	default:
+		return fmt.Errorf("toolConfig.functionCallingConfig.mode 不支持: %s（支持 AUTO、ANY、NONE）", mode)
+	}
+
+	for _, tool := range req.Tools {
+		for _, decl := range tool.FunctionDeclarations {
+			if decl.Name == "" {
+				return fmt.Errorf("functionDeclarations 的 name 不能为空")
+			}
+			schema := decl.ParametersJSONSchema
+			if schema == nil {
+				schema, _ = normalizeGeminiSchema(decl.Parameters).(map[string]any)
+			}
+			if schema == nil {
+				schema = map[string]any{"type": "object", "properties": map[string]any{}}
+			}
+			anthropicReq.Tools = append(anthropicReq.Tools, types.AnthropicTool{
+				Name:        decl.Name,
+				Description: decl.Description,
+				InputSchema: schema,
+			})
+		}
+	}
+	return nil
+}
+
+// normalizeGeminiSchema 将 Gemini OpenAPI 子集 schema 的大写类型名（OBJECT、STRING）转为 JSON Schema 小写形式
+func normalizeGeminiSchema(schema any) any {
+	switch v := schema.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for key, value := range v {
+			if typeName, ok := value.(string); ok && key == "type" {
+				out[key] = strings.ToLower(typeName)
+				continue
+			}
+			out[key] = normalizeGeminiSchema(value)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = normalizeGeminiSchema(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// applyGeminiGenerationConfig 转换生成参数；thinkingBudget 为 -1（动态）时按 medium 强度预算
+func applyGeminiGenerationConfig(anthropicReq *types.AnthropicRequest, cfg *types.GeminiGenerationConfig) error {
+	if cfg == nil {
+		return nil
+	}
+	if cfg.CandidateCount != nil && *cfg.CandidateCount != 1 {
+		return fmt.Errorf("generationConfig.candidateCount 仅支持 1")
+	}
+	if cfg.MaxOutputTokens != nil {
+		if *cfg.MaxOutputTokens < 1 {
+			return fmt.Errorf("generationConfig.maxOutputTokens 不能小于 1")
+		}
+		anthropicReq.MaxTokens = *cfg.MaxOutputTokens
+	}
+	anthropicReq.Temperature = cfg.Temperature
+	anthropicReq.StopSequences = cfg.StopSequences
+
+	if cfg.ThinkingConfig != nil && cfg.ThinkingConfig.ThinkingBudget != nil {
+		switch budget := *cfg.ThinkingConfig.ThinkingBudget; {
+		case budget == 0:
+		case budget < 0:
+			anthropicReq.Thinking = &types.AnthropicThinking{Type: "enabled", BudgetTokens: reasoningEffortBudgets["medium"]}
+		default:
+			anthropicReq.Thinking = &types.AnthropicThinking{Type: "enabled", BudgetTokens: max(budget, MinThinkingBudget)}
+		}
+	}
+	return nil
+}
+
+// GeminiIncludeThoughts 请求是否要求在响应中返回思考内容
+func GeminiIncludeThoughts(req types.GeminiRequest) bool {
+	return req.GenerationConfig != nil && req.GenerationConfig.ThinkingConfig != nil && req.GenerationConfig.ThinkingConfig.IncludeThoughts
+}
+
+// geminiFinishReason 将 OpenAI finish_reason 映射为 Gemini finishReason（工具调用同样为 STOP）
+func geminiFinishReason(finishReason string) string {
+	if finishReason == "length" {
+		return "MAX_TOKENS"
+	}
+	return "STOP"
+}
+
+// geminiFunctionCall 将工具调用转换为 functionCall，参数无法解析时为空对象
+func geminiFunctionCall(id, name, arguments string) types.GeminiPart {
+	args := map[string]any{}
+	if arguments != "" {
+		_ = utils.SafeUnmarshal([]byte(arguments), &args)
+	}
+	return types.GeminiPart{FunctionCall: &types.GeminiFunctionCall{ID: id, Name: name, Args: args}}
+}
+
+func geminiUsage(usage types.Usage) *types.GeminiUsageMetadata {
+	return &types.GeminiUsageMetadata{
+		PromptTokenCount:     usage.PromptTokens,
+		CandidatesTokenCount: usage.CompletionTokens,
+		TotalTokenCount:      usage.TotalTokens,
+	}
+}
+
+// ConvertOpenAIToGemini 将聊天补全响应转换为 Gemini generateContent 响应
+func ConvertOpenAIToGemini(resp types.OpenAIResponse, includeThoughts bool) types.GeminiResponse {
+	candidates := make([]types.GeminiCandidate, 0, len(resp.Choices))
+	for _, choice := range resp.Choices {
+		var parts []types.GeminiPart
+		if includeThoughts && choice.Message.ReasoningContent != "" {
+			parts = append(parts, types.GeminiPart{Text: choice.Message.ReasoningContent, Thought: true})
+		}
+		if text, _ := choice.Message.Content.(string); text != "" {
+			parts = append(parts, types.GeminiPart{Text: text})
+		}
+		for _, call := range choice.Message.ToolCalls {
+			parts = append(parts, geminiFunctionCall(call.ID, call.Function.Name, call.Function.Arguments))
+		}
+		if parts == nil {
+			parts = []types.GeminiPart{}
+		}
+		candidates = append(candidates, types.GeminiCandidate{
+			Content:      types.GeminiContent{Role: "model", Parts: parts},
+			FinishReason: geminiFinishReason(choice.FinishReason),
+			Index:        choice.Index,
+		})
+	}
+	return types.GeminiResponse{
+		Candidates:    candidates,
+		UsageMetadata: geminiUsage(resp.Usage),
+		ModelVersion:  resp.Model,
+		ResponseID:    resp.ID,
+	}
+}
+
+// GeminiStreamConverter 将聊天补全流式块逐个转换为 Gemini 流式块
+// 工具调用参数在结束块之前累积，结束时以完整的 functionCall 下发
+type GeminiStreamConverter struct {
+	includeThoughts bool
+	calls           map[int]*geminiPendingCall // tool_calls 索引 -> 累积中的调用
+}
+
+type geminiPendingCall struct {
+	id, name  string
+	arguments strings.Builder
+}
+
+// NewGeminiStreamConverter 创建流式转换器
+func NewGeminiStreamConverter(includeThoughts bool) *GeminiStreamConverter {
+	return &GeminiStreamConverter{includeThoughts: includeThoughts, calls: make(map[int]*geminiPendingCall)}
+}
+
+// Convert 转换一个聊天补全流式块，没有可下发内容时返回 nil
+func (s *GeminiStreamConverter) Convert(chunk map[string]any) *types.GeminiResponse {
+	result := types.GeminiResponse{}
+	result.ModelVersion, _ = chunk["model"].(string)
+	result.ResponseID, _ = chunk["id"].(string)
+
+	if usage, ok := chunk["usage"].(map[string]any); ok {
+		prompt, _ := usage["prompt_tokens"].(int)
+		completion, _ := usage["completion_tokens"].(int)
+		result.UsageMetadata = geminiUsage(types.Usage{PromptTokens: prompt, CompletionTokens: completion, TotalTokens: prompt + completion})
+	}
+
+	choices, _ := chunk["choices"].([]map[string]any)
+	for _, choice := range choices {
+		var parts []types.GeminiPart
+		delta, _ := choice["delta"].(map[string]any)
+		if text, _ := delta["reasoning_content"].(string); text != "" && s.includeThoughts {
+			parts = append(parts, types.GeminiPart{Text: text, Thought: true})
+		}
+		if text, _ := delta["content"].(string); text != "" {
+			parts = append(parts, types.GeminiPart{Text: text})
+		}
+		toolCalls, _ := delta["tool_calls"].([]map[string]any)
+		for _, call := range toolCalls {
+			index, _ := call["index"].(int)
+			pending, ok := s.calls[index]
+			if !ok {
+				pending = &geminiPendingCall{}
+				s.calls[index] = pending
+			}
+			if id, _ := call["id"].(string); id != "" {
+				pending.id = id
+			}
+			function, _ := call["function"].(map[string]any)
+			if name, _ := function["name"].(string); name != "" {
+				pending.name = name
+			}
+			arguments, _ := function["arguments"].(string)
+			pending.arguments.WriteString(arguments)
+		}
+
+		finishReason, finished := choice["finish_reason"].(string)
+		if finished {
+			parts = append(parts, s.flushCalls()...)
+		}
+		if len(parts) == 0 && !finished {
+			continue
+		}
+		candidate := types.GeminiCandidate{Content: types.GeminiContent{Role: "model", Parts: parts}}
+		if candidate.Content.Parts == nil {
+			candidate.Content.Parts = []types.GeminiPart{}
+		}
+		if finished {
+			candidate.FinishReason = geminiFinishReason(finishReason)
+		}
+		result.Candidates = append(result.Candidates, candidate)
+	}
+
+	if len(result.Candidates) == 0 && result.UsageMetadata == nil {
+		return nil
+	}
+	return &result
+}
+
+// flushCalls 按索引顺序输出累积的工具调用
+func (s *GeminiStreamConverter) flushCalls() []types.GeminiPart {
+	indexes := make([]int, 0, len(s.calls))
+	for index := range s.calls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	parts := make([]types.GeminiPart, 0, len(indexes))
+	for _, index := range indexes {
+		call := s.calls[index]
+		parts = append(parts, geminiFunctionCall(call.id, call.name, call.arguments.String()))
+	}
+	s.calls = make(map[int]*geminiPendingCall)
+	return parts
+}
@@ -0,0 +1,140 @@
+package converter
+
+import (
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConvertGeminiToAnthropic(t *testing.T) {
+	maxTokens, budget := 256, 512
+	temperature := 0.2
+	req := types.GeminiRequest{
+		SystemInstruction: &types.GeminiContent{Parts: []types.GeminiPart{{Text: "你是助手"}}},
+		Contents: []types.GeminiContent{
+			{Role: "user", Parts: []types.GeminiPart{{Text: "天气如何"}, {InlineData: &types.GeminiBlob{MimeType: "image/png", Data: "aGk="}}}},
+			{Role: "model", Parts: []types.GeminiPart{{Text: "想一想", Thought: true}, {FunctionCall: &types.GeminiFunctionCall{Name: "get_weather", Args: map[string]any{"city": "SF"}}}}},
+			{Role: "user", Parts: []types.GeminiPart{{FunctionResponse: &types.GeminiFunctionResponse{Name: "get_weather", Response: map[string]any{"temp": 20.0}}}}},
+		},
+		Tools: []types.GeminiTool{{FunctionDeclarations: []types.GeminiFunctionDeclaration{{
+			Name:       "get_weather",
+			Parameters: map[string]any{"type": "OBJECT", "properties": map[string]any{"city": map[string]any{"type": "STRING"}}},
+		}}}},
+		ToolConfig: &types.GeminiToolConfig{FunctionCallingConfig: &types.GeminiFunctionCallingConfig{Mode: "ANY", AllowedFunctionNames: []string{"get_weather"}}},
+		GenerationConfig: &types.GeminiGenerationConfig{
+			MaxOutputTokens: &maxTokens,
+			Temperature:     &temperature,
+			StopSequences:   []string{"END"},
+			ThinkingConfig:  &types.GeminiThinkingConfig{ThinkingBudget: &budget},
+		},
+	}
+
+	got, err := ConvertGeminiToAnthropic("gemini-2.5-pro", req)
+	require.NoError(t, err)
+	assert.Equal(t, "gemini-2.5-pro", got.Model)
+	assert.Equal(t, []types.AnthropicSystemMessage{{Type: "text", Text: "你是助手"}}, got.System)
+	assert.Equal(t, 256, got.MaxTokens)
+	assert.Equal(t, &temperature, got.Temperature)
+	assert.Equal(t, []string{"END"}, got.StopSequences)
+	assert.Equal(t, &types.AnthropicThinking{Type: "enabled", BudgetTokens: MinThinkingBudget}, got.Thinking, "预算不足下限时取下限")
+	assert.Equal(t, &types.ToolChoice{Type: "tool", Name: "get_weather"}, got.ToolChoice)
+
+	require.Len(t, got.Tools, 1)
+	assert.Equal(t, map[string]any{"type": "object", "properties": map[string]any{"city": map[string]any{"type": "string"}}}, got.Tools[0].InputSchema)
+
+	require.Len(t, got.Messages, 3)
+	assert.Equal(t, "user", got.Messages[0].Role)
+	assert.Len(t, got.Messages[0].Content, 2)
+	assert.Equal(t, "assistant", got.Messages[1].Role)
+	assistant := got.Messages[1].Content.([]any)
+	require.Len(t, assistant, 1, "历史思考内容不回传")
+	toolUse := assistant[0].(map[string]any)
+	assert.Equal(t, "tool_use", toolUse["type"])
+	toolResult := got.Messages[2].Content.([]any)[0].(map[string]any)
+	assert.Equal(t, toolUse["id"], toolResult["tool_use_id"], "functionResponse 按名称与调用配对")
+	assert.JSONEq(t, `{"temp":20}`, toolResult["content"].(string))
+}
+
+func TestConvertGeminiToAnthropic_Errors(t *testing.T) {
+	two := 2
+	text := []types.GeminiPart{{Text: "hi"}}
+	tests := []struct {
+		name string
+		req  types.GeminiRequest
+		want string
+	}{
+		{"空contents", types.GeminiRequest{}, "contents 不能为空"},
+		{"未知角色", types.GeminiRequest{Contents: []types.GeminiContent{{Role: "system", Parts: text}}}, "role 不支持"},
+		{"非图片数据", types.GeminiRequest{Contents: []types.GeminiContent{{Parts: []types.GeminiPart{{InlineData: &types.GeminiBlob{MimeType: "application/pdf"}}}}}}, "只支持图片"},
+		{"孤立的functionResponse", types.GeminiRequest{Contents: []types.GeminiContent{{Parts: []types.GeminiPart{{FunctionResponse: &types.GeminiFunctionResponse{Name: "f"}}}}}}, "没有对应的 functionCall"},
+		{"多个候选", types.GeminiRequest{Contents: []types.GeminiContent{{Parts: text}}, GenerationConfig: &types.GeminiGenerationConfig{CandidateCount: &two}}, "candidateCount"},
+		{"未知工具模式", types.GeminiRequest{Contents: []types.GeminiContent{{Parts: text}}, ToolConfig: &types.GeminiToolConfig{FunctionCallingConfig: &types.GeminiFunctionCallingConfig{Mode: "VALIDATED"}}}, "mode 不支持"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ConvertGeminiToAnthropic("m", tt.req)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestConvertOpenAIToGemini(t *testing.T) {
+	resp := ConvertOpenAIToGemini(types.OpenAIResponse{
+		ID:    "chatcmpl-1",
+		Model: "gemini-2.5-pro",
+		Choices: []types.OpenAIChoice{{
+			Message: types.OpenAIMessage{
+				Content:          "好的",
+				ReasoningContent: "思考",
+				ToolCalls:        []types.OpenAIToolCall{{ID: "t1", Function: types.OpenAIToolFunction{Name: "f", Arguments: `{"a":1}`}}},
+			},
+			FinishReason: "length",
+		}},
+		Usage: types.Usage{PromptTokens: 3, CompletionTokens: 4, TotalTokens: 7},
+	}, true)
+
+	require.Len(t, resp.Candidates, 1)
+	assert.Equal(t, "MAX_TOKENS", resp.Candidates[0].FinishReason)
+	assert.Equal(t, []types.GeminiPart{
+		{Text: "思考", Thought: true},
+		{Text: "好的"},
+		{FunctionCall: &types.GeminiFunctionCall{ID: "t1", Name: "f", Args: map[string]any{"a": 1.0}}},
+	}, resp.Candidates[0].Content.Parts)
+	assert.Equal(t, &types.GeminiUsageMetadata{PromptTokenCount: 3, CandidatesTokenCount: 4, TotalTokenCount: 7}, resp.UsageMetadata)
+	assert.Equal(t, "gemini-2.5-pro", resp.ModelVersion)
+}
+
+func TestGeminiStreamConverter(t *testing.T) {
+	s := NewGeminiStreamConverter(false)
+	chunk := func(delta map[string]any, finish any) map[string]any {
+		return map[string]any{"id": "chatcmpl-1", "model": "m", "choices": []map[string]any{{"index": 0, "delta": delta, "finish_reason": finish}}}
+	}
+
+	assert.Nil(t, s.Convert(chunk(map[string]any{"role": "assistant"}, nil)), "角色块跳过")
+	assert.Nil(t, s.Convert(chunk(map[string]any{"reasoning_content": "..."}, nil)), "未要求时不返回思考内容")
+
+	got := s.Convert(chunk(map[string]any{"content": "Hi"}, nil))
+	require.NotNil(t, got)
+	assert.Equal(t, []types.GeminiPart{{Text: "Hi"}}, got.Candidates[0].Content.Parts)
+
+	toolDelta := func(call map[string]any) map[string]any {
+		return map[string]any{"tool_calls": []map[string]any{call}}
+	}
+	assert.Nil(t, s.Convert(chunk(toolDelta(map[string]any{"index": 0, "id": "t1", "function": map[string]any{"name": "f", "arguments": ""}}), nil)))
+	assert.Nil(t, s.Convert(chunk(toolDelta(map[string]any{"index": 0, "function": map[string]any{"arguments": `{"a":`}}), nil)))
+	assert.Nil(t, s.Convert(chunk(toolDelta(map[string]any{"index": 0, "function": map[string]any{"arguments": `1}`}}), nil)))
+
+	got = s.Convert(chunk(map[string]any{}, "tool_calls"))
+	require.NotNil(t, got)
+	assert.Equal(t, "STOP", got.Candidates[0].FinishReason)
+	assert.Equal(t, []types.GeminiPart{{FunctionCall: &types.GeminiFunctionCall{ID: "t1", Name: "f", Args: map[string]any{"a": 1.0}}}}, got.Candidates[0].Content.Parts)
+
+	got = s.Convert(map[string]any{"id": "chatcmpl-1", "choices": []map[string]any{}, "usage": map[string]any{"prompt_tokens": 2, "completion_tokens": 3}})
+	require.NotNil(t, got)
+	assert.Empty(t, got.Candidates)
+	assert.Equal(t, 5, got.UsageMetadata.TotalTokenCount)
+}
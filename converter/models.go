@@ -0,0 +1,39 @@
+package converter
+
+import (
+	"kiro2api/config"
+	"kiro2api/logger"
+	"kiro2api/types"
+)
+
+// ApplyModelDefaults 按模型路由表填充默认 max_tokens 并截断超出上限的参数
+// 未配置路由的模型原样返回（由构建上游请求时报告模型不存在）
+func ApplyModelDefaults(req types.AnthropicRequest) types.AnthropicRequest {
+	route, ok := config.ResolveModel(req.Model)
+	if !ok {
+		return req
+	}
+
+	if req.MaxTokens <= 0 && route.MaxTokens > 0 {
+		req.MaxTokens = route.MaxTokens
+	}
+	if route.MaxTokensLimit > 0 && req.MaxTokens > route.MaxTokensLimit {
+		logger.Debug("max_tokens超过模型上限，已截断",
+			logger.String("model", req.Model),
+			logger.Int("requested", req.MaxTokens),
+			logger.Int("limit", route.MaxTokensLimit))
+		req.MaxTokens = route.MaxTokensLimit
+	}
+
+	if req.Temperature != nil {
+		temperature := *req.Temperature
+		if route.TemperatureMin != nil && temperature < *route.TemperatureMin {
+			temperature = *route.TemperatureMin
+		}
+		if route.TemperatureMax != nil && temperature > *route.TemperatureMax {
+			temperature = *route.TemperatureMax
+		}
+		req.Temperature = &temperature
+	}
+	return req
+}
@@ -0,0 +1,63 @@
+package converter
+
+import (
+	"testing"
+
+	"kiro2api/config"
+	"kiro2api/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withModelTable 在测试期间替换模型路由表
+func withModelTable(t *testing.T, routes map[string]config.ModelRoute) {
+	t.Helper()
+	original := config.CurrentModelTable()
+	t.Cleanup(func() { config.SetModelTable(original) })
+	table, err := config.NewModelTable(routes)
+	require.NoError(t, err)
+	config.SetModelTable(table)
+}
+
+func floatPtr(v float64) *float64 { return &v }
+
+func TestApplyModelDefaults(t *testing.T) {
+	withModelTable(t, map[string]config.ModelRoute{
+		"gpt-4o": {Alias: "claude-sonnet-4-5", MaxTokens: 4096, MaxTokensLimit: 8192, TemperatureMin: floatPtr(0.1), TemperatureMax: floatPtr(0.9)},
+	})
+
+	req := ApplyModelDefaults(types.AnthropicRequest{Model: "gpt-4o"})
+	assert.Equal(t, 4096, req.MaxTokens, "未指定时使用默认值")
+	assert.Nil(t, req.Temperature)
+
+	req = ApplyModelDefaults(types.AnthropicRequest{Model: "gpt-4o", MaxTokens: 20000, Temperature: floatPtr(1.5)})
+	assert.Equal(t, 8192, req.MaxTokens, "超过上限时截断")
+	assert.Equal(t, 0.9, *req.Temperature)
+
+	req = ApplyModelDefaults(types.AnthropicRequest{Model: "gpt-4o", MaxTokens: 100, Temperature: floatPtr(0)})
+	assert.Equal(t, 100, req.MaxTokens)
+	assert.Equal(t, 0.1, *req.Temperature)
+
+	req = ApplyModelDefaults(types.AnthropicRequest{Model: "unknown", MaxTokens: 20000})
+	assert.Equal(t, 20000, req.MaxTokens, "未配置的模型原样返回")
+}
+
+func TestConvertOpenAIToAnthropic_ModelDefaultMaxTokens(t *testing.T) {
+	withModelTable(t, map[string]config.ModelRoute{"gpt-4o": {Alias: "claude-sonnet-4-5", MaxTokens: 2048}})
+
+	req := ConvertOpenAIToAnthropic(types.OpenAIRequest{Model: "gpt-4o"})
+	assert.Equal(t, 2048, req.MaxTokens)
+}
+
+func TestBuildCodeWhispererRequest_ModelAlias(t *testing.T) {
+	withModelTable(t, map[string]config.ModelRoute{"gpt-4o": {Alias: "claude-sonnet-4-5"}})
+
+	cwReq, err := BuildCodeWhispererRequest(types.AnthropicRequest{
+		Model:     "gpt-4o",
+		MaxTokens: 100,
+		Messages:  []types.AnthropicRequestMessage{{Role: "user", Content: "hi"}},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "CLAUDE_SONNET_4_5_20250929_V1_0", cwReq.ConversationState.CurrentMessage.UserInputMessage.ModelId)
+}
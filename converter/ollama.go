@@ -0,0 +1,316 @@
+package converter
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"kiro2api/types"
+	"kiro2api/utils"
+)
+
+// Ollama 格式转换器：/api/chat 请求转换为 Anthropic 请求，聊天补全响应转换为 Ollama 响应
+
+// OllamaModelName 去掉 Ollama 客户端附加的 :latest 标签
+func OllamaModelName(model string) string {
+	return strings.TrimSuffix(model, ":latest")
+}
+
+// OllamaStreamEnabled Ollama 的 stream 未设置时默认为 true
+func OllamaStreamEnabled(req types.OllamaChatRequest) bool {
+	return req.Stream == nil || *req.Stream
+}
+
+// OllamaResponseFormat 将 format（"json" 或 JSON Schema 对象）转换为 OpenAI response_format
+func OllamaResponseFormat(format any) (*types.OpenAIResponseFormat, error) {
+	switch v := format.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		switch v {
+		case "":
+			return nil, nil
+		case "json":
+			return &types.OpenAIResponseFormat{Type: ResponseFormatJSONObject}, nil
+		}
+		return nil, fmt.Errorf("format 只支持 \"json\" 或 JSON Schema 对象")
+	case map[string]any:
+		return &types.OpenAIResponseFormat{
+			Type:       ResponseFormatJSONSchema,
+			JSONSchema: &types.OpenAIJSONSchema{Name: "response", Schema: v},
+		}, nil
+	default:
+		return nil, fmt.Errorf("format 只支持 \"json\" 或 JSON Schema 对象")
+	}
+}
+
+// ConvertOllamaToAnthropic 将 Ollama /api/chat 请求转换为 Anthropic 请求
+// 历史中的 tool_calls 没有ID，生成工具调用ID后与之后的 tool 消息按函数名（缺省时按顺序）配对
+func ConvertOllamaToAnthropic(req types.OllamaChatRequest) (types.AnthropicRequest, error) {
+	if len(req.Messages) == 0 {
+		return types.AnthropicRequest{}, fmt.Errorf("messages 不能为空")
+	}
+
+	anthropicReq := types.AnthropicRequest{
+		Model:     OllamaModelName(req.Model),
+		MaxTokens: defaultOpenAIMaxTokens,
+		Stream:    OllamaStreamEnabled(req),
+	}
+
+	type pendingCall struct{ id, name string }
+	var pendingCalls []pendingCall // 尚未收到结果的工具调用
+	nextCallID := 0
+	for i, msg := range req.Messages {
+		switch msg.Role {
+		case "system":
+			if msg.Content != "" {
+				anthropicReq.System = append(anthropicReq.System, types.AnthropicSystemMessage{Type: "text", Text: msg.Content})
+			}
+		case "user", "assistant":
+			blocks := make([]any, 0, 1+len(msg.Images)+len(msg.ToolCalls))
+			for j, image := range msg.Images {
+				block, err := ollamaImageBlock(image)
+				if err != nil {
+					return types.AnthropicRequest{}, fmt.Errorf("messages[%d].images[%d]: %w", i, j, err)
+				}
+				blocks = append(blocks, block)
+			}
+			if msg.Content != "" {
+				blocks = append(blocks, map[string]any{"type": "text", "text": msg.Content})
+			}
+			for _, call := range msg.ToolCalls {
+				nextCallID++
+				id := fmt.Sprintf("toolu_ollama_%d", nextCallID)
+				name := call.Function.Name
+				pendingCalls = append(pendingCalls, pendingCall{id: id, name: name})
+				args := call.Function.Arguments
+				if args == nil {
+					args = map[string]any{}
+				}
+				blocks = append(blocks, map[string]any{"type": "tool_use", "id": id, "name": name, "input": args})
+			}
+			if len(blocks) > 0 {
+				anthropicReq.Messages = append(anthropicReq.Messages, types.AnthropicRequestMessage{Role: msg.Role, Content: blocks})
+			}
+		case "tool":
+			index := -1
+			for k, call := range pendingCalls {
+				if msg.ToolName == "" || call.name == msg.ToolName {
+					index = k
+					break
+				}
+			}
+			if index < 0 {
+				return types.AnthropicRequest{}, fmt.Errorf("messages[%d] 没有对应的 tool_calls: %s", i, msg.ToolName)
+			}
+			id := pendingCalls[index].id
+			pendingCalls = append(pendingCalls[:index], pendingCalls[index+1:]...)
+			block := map[string]any{"type": "tool_result", "tool_use_id": id, "content": msg.Content}
+
+			// 连续的工具结果合并到同一条用户消息
+			if n := len(anthropicReq.Messages); n > 0 && anthropicReq.Messages[n-1].Role == "user" {
+				if prev, ok := anthropicReq.Messages[n-1].Content.([]any); ok && len(prev) > 0 {
+					if last, ok := prev[len(prev)-1].(map[string]any); ok && last["type"] == "tool_result" {
+						anthropicReq.Messages[n-1].Content = append(prev, block)
+						continue
+					}
+				}
+			}
+			anthropicReq.Messages = append(anthropicReq.Messages, types.AnthropicRequestMessage{Role: "user", Content: []any{block}})
+		default:
+			return types.AnthropicRequest{}, fmt.Errorf("messages[%d].role 不支持: %s", i, msg.Role)
+		}
+	}
+	if len(anthropicReq.Messages) == 0 {
+		return types.AnthropicRequest{}, fmt.Errorf("messages 没有有效内容")
+	}
+
+	if len(req.Tools) > 0 {
+		tools, err := validateAndProcessTools(req.Tools)
+		if err != nil {
+			return types.AnthropicRequest{}, err
+		}
+		anthropicReq.Tools = tools
+	}
+
+	if opts := req.Options; opts != nil {
+		if opts.NumPredict != nil && *opts.NumPredict > 0 {
+			anthropicReq.MaxTokens = *opts.NumPredict
+		}
+		anthropicReq.Temperature = opts.Temperature
+		anthropicReq.StopSequences = opts.Stop
+	}
+	if req.Think != nil && *req.Think {
+		anthropicReq.Thinking = &types.AnthropicThinking{Type: "enabled", BudgetTokens: reasoningEffortBudgets["medium"]}
+	}
+
+	format, err := OllamaResponseFormat(req.Format)
+	if err != nil {
+		return types.AnthropicRequest{}, err
+	}
+	if instruction := responseFormatInstruction(format); instruction != "" {
+		anthropicReq.System = append(anthropicReq.System, types.AnthropicSystemMessage{Type: "text", Text: instruction})
+	}
+	return anthropicReq, nil
+}
+
+// ollamaImageBlock 将 base64 图片转换为 Anthropic 图片内容块，按文件头识别图片格式
+func ollamaImageBlock(data string) (map[string]any, error) {
+	data = strings.TrimSpace(data)
+	if _, encoded, ok := strings.Cut(data, ";base64,"); ok {
+		data = encoded // 兼容 data URL
+	}
+	header, err := base64.StdEncoding.DecodeString(data[:min(len(data), 24)])
+	if err != nil {
+		return nil, fmt.Errorf("图片不是有效的 base64: %w", err)
+	}
+	mediaType, err := utils.DetectImageFormat(header)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		"type": "image",
+		"source": map[string]any{
+			"type":       "base64",
+			"media_type": mediaType,
+			"data":       data,
+		},
+	}, nil
+}
+
+// ollamaDoneReason 将 OpenAI finish_reason 映射为 Ollama done_reason
+func ollamaDoneReason(finishReason string) string {
+	if finishReason == "length" {
+		return "length"
+	}
+	return "stop"
+}
+
+func ollamaTimestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func ollamaToolCall(name, arguments string) types.OllamaToolCall {
+	args := map[string]any{}
+	if arguments != "" {
+		_ = utils.SafeUnmarshal([]byte(arguments), &args)
+	}
+	return types.OllamaToolCall{Function: types.OllamaToolCallFunction{Name: name, Arguments: args}}
+}
+
+// ConvertOpenAIToOllama 将聊天补全响应转换为 Ollama 非流式响应，elapsed 为请求总耗时
+func ConvertOpenAIToOllama(resp types.OpenAIResponse, elapsed time.Duration) types.OllamaChatResponse {
+	result := types.OllamaChatResponse{
+		Model:           resp.Model,
+		CreatedAt:       ollamaTimestamp(time.Now()),
+		Message:         types.OllamaMessage{Role: "assistant"},
+		Done:            true,
+		DoneReason:      "stop",
+		TotalDuration:   elapsed.Nanoseconds(),
+		PromptEvalCount: resp.Usage.PromptTokens,
+		EvalCount:       resp.Usage.CompletionTokens,
+		EvalDuration:    elapsed.Nanoseconds(),
+	}
+	if len(resp.Choices) > 0 {
+		choice := resp.Choices[0]
+		result.Message.Content, _ = choice.Message.Content.(string)
+		result.Message.Thinking = choice.Message.ReasoningContent
+		for _, call := range choice.Message.ToolCalls {
+			result.Message.ToolCalls = append(result.Message.ToolCalls, ollamaToolCall(call.Function.Name, call.Function.Arguments))
+		}
+		result.DoneReason = ollamaDoneReason(choice.FinishReason)
+	}
+	return result
+}
+
+// OllamaStreamConverter 将聊天补全流式块逐个转换为 Ollama 流式消息
+// 工具调用参数累积到结束块再以完整的 tool_calls 下发；用量块转换为 done=true 的最后一条消息
+type OllamaStreamConverter struct {
+	start      time.Time
+	doneReason string
+	calls      map[int]*ollamaPendingCall
+}
+
+type ollamaPendingCall struct {
+	name      string
+	arguments strings.Builder
+}
+
+// NewOllamaStreamConverter 创建流式转换器，start 为请求开始时间（用于统计耗时）
+func NewOllamaStreamConverter(start time.Time) *OllamaStreamConverter {
+	return &OllamaStreamConverter{start: start, doneReason: "stop", calls: make(map[int]*ollamaPendingCall)}
+}
+
+// Convert 转换一个聊天补全流式块，没有可下发内容时返回 nil
+func (s *OllamaStreamConverter) Convert(chunk map[string]any) *types.OllamaChatResponse {
+	now := time.Now()
+	model, _ := chunk["model"].(string)
+	result := &types.OllamaChatResponse{
+		Model:     model,
+		CreatedAt: ollamaTimestamp(now),
+		Message:   types.OllamaMessage{Role: "assistant"},
+	}
+
+	if usage, ok := chunk["usage"].(map[string]any); ok {
+		elapsed := now.Sub(s.start).Nanoseconds()
+		result.Done = true
+		result.DoneReason = s.doneReason
+		result.TotalDuration = elapsed
+		result.EvalDuration = elapsed
+		result.PromptEvalCount, _ = usage["prompt_tokens"].(int)
+		result.EvalCount, _ = usage["completion_tokens"].(int)
+		return result
+	}
+
+	choices, _ := chunk["choices"].([]map[string]any)
+	if len(choices) == 0 {
+		return nil
+	}
+	delta, _ := choices[0]["delta"].(map[string]any)
+	result.Message.Thinking, _ = delta["reasoning_content"].(string)
+	result.Message.Content, _ = delta["content"].(string)
+
+	toolCalls, _ := delta["tool_calls"].([]map[string]any)
+	for _, call := range toolCalls {
+		index, _ := call["index"].(int)
+		pending, ok := s.calls[index]
+		if !ok {
+			pending = &ollamaPendingCall{}
+			s.calls[index] = pending
+		}
+		function, _ := call["function"].(map[string]any)
+		if name, _ := function["name"].(string); name != "" {
+			pending.name = name
+		}
+		arguments, _ := function["arguments"].(string)
+		pending.arguments.WriteString(arguments)
+	}
+
+	if finishReason, ok := choices[0]["finish_reason"].(string); ok {
+		s.doneReason = ollamaDoneReason(finishReason)
+		result.Message.ToolCalls = s.flushCalls()
+	}
+
+	if result.Message.Content == "" && result.Message.Thinking == "" && len(result.Message.ToolCalls) == 0 {
+		return nil
+	}
+	return result
+}
+
+// flushCalls 按索引顺序输出累积的工具调用
+func (s *OllamaStreamConverter) flushCalls() []types.OllamaToolCall {
+	indexes := make([]int, 0, len(s.calls))
+	for index := range s.calls {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	var calls []types.OllamaToolCall
+	for _, index := range indexes {
+		call := s.calls[index]
+		calls = append(calls, ollamaToolCall(call.name, call.arguments.String()))
+	}
+	s.calls = make(map[int]*ollamaPendingCall)
+	return calls
+}
@@ -0,0 +1,117 @@
+package converter
+
+import (
+	"testing"
+	"time"
+
+	"kiro2api/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// 1x1 PNG 文件头
+const ollamaTestPNG = "iVBORw0KGgoAAAANSUhEUgAAAAEAAAAB"
+
+func TestConvertOllamaToAnthropic(t *testing.T) {
+	stream, think := false, true
+	numPredict, temperature := 256, 0.2
+	req := types.OllamaChatRequest{
+		Model: "claude-sonnet-4-20250514:latest",
+		Messages: []types.OllamaMessage{
+			{Role: "system", Content: "你是助手"},
+			{Role: "user", Content: "天气如何", Images: []string{ollamaTestPNG}},
+			{Role: "assistant", ToolCalls: []types.OllamaToolCall{
+				{Function: types.OllamaToolCallFunction{Name: "get_weather", Arguments: map[string]any{"city": "SF"}}},
+				{Function: types.OllamaToolCallFunction{Name: "get_time"}},
+			}},
+			{Role: "tool", ToolName: "get_time", Content: "12:00"},
+			{Role: "tool", ToolName: "get_weather", Content: "晴"},
+		},
+		Stream:  &stream,
+		Think:   &think,
+		Format:  "json",
+		Options: &types.OllamaOptions{NumPredict: &numPredict, Temperature: &temperature, Stop: []string{"END"}},
+	}
+
+	got, err := ConvertOllamaToAnthropic(req)
+	require.NoError(t, err)
+	assert.Equal(t, "claude-sonnet-4-20250514", got.Model)
+	assert.False(t, got.Stream)
+	assert.Equal(t, 256, got.MaxTokens)
+	assert.Equal(t, &temperature, got.Temperature)
+	assert.Equal(t, []string{"END"}, got.StopSequences)
+	require.NotNil(t, got.Thinking)
+	require.Len(t, got.System, 2, "format 追加输出格式说明")
+	assert.Equal(t, "你是助手", got.System[0].Text)
+
+	require.Len(t, got.Messages, 3)
+	user := got.Messages[0].Content.([]any)
+	require.Len(t, user, 2)
+	image := user[0].(map[string]any)
+	assert.Equal(t, "image/png", image["source"].(map[string]any)["media_type"])
+
+	calls := got.Messages[1].Content.([]any)
+	require.Len(t, calls, 2)
+	assert.Equal(t, map[string]any{}, calls[1].(map[string]any)["input"], "缺省参数为空对象")
+
+	results := got.Messages[2].Content.([]any)
+	require.Len(t, results, 2, "连续的工具结果合并为一条消息")
+	assert.Equal(t, calls[1].(map[string]any)["id"], results[0].(map[string]any)["tool_use_id"], "按函数名配对")
+	assert.Equal(t, calls[0].(map[string]any)["id"], results[1].(map[string]any)["tool_use_id"])
+}
+
+func TestConvertOllamaToAnthropic_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		req  types.OllamaChatRequest
+	}{
+		{"空消息", types.OllamaChatRequest{Model: "m"}},
+		{"未知角色", types.OllamaChatRequest{Messages: []types.OllamaMessage{{Role: "developer", Content: "hi"}}}},
+		{"孤立的工具结果", types.OllamaChatRequest{Messages: []types.OllamaMessage{{Role: "tool", ToolName: "f", Content: "x"}}}},
+		{"无效图片", types.OllamaChatRequest{Messages: []types.OllamaMessage{{Role: "user", Images: []string{"not base64!"}}}}},
+		{"无效 format", types.OllamaChatRequest{Messages: []types.OllamaMessage{{Role: "user", Content: "hi"}}, Format: "yaml"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ConvertOllamaToAnthropic(tt.req)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestOllamaStreamConverter(t *testing.T) {
+	s := NewOllamaStreamConverter(time.Now())
+	chunk := func(delta map[string]any, finishReason any) map[string]any {
+		return map[string]any{
+			"model":   "claude-sonnet-4-20250514",
+			"choices": []map[string]any{{"index": 0, "delta": delta, "finish_reason": finishReason}},
+		}
+	}
+
+	assert.Nil(t, s.Convert(chunk(map[string]any{"role": "assistant"}, nil)), "没有内容的块不下发")
+
+	got := s.Convert(chunk(map[string]any{"content": "你好"}, nil))
+	require.NotNil(t, got)
+	assert.Equal(t, "你好", got.Message.Content)
+	assert.False(t, got.Done)
+
+	assert.Nil(t, s.Convert(chunk(map[string]any{"tool_calls": []map[string]any{
+		{"index": 0, "function": map[string]any{"name": "get_weather", "arguments": `{"city":`}},
+	}}, nil)), "工具调用参数累积到结束块")
+	s.Convert(chunk(map[string]any{"tool_calls": []map[string]any{
+		{"index": 0, "function": map[string]any{"arguments": `"SF"}`}},
+	}}, nil))
+
+	got = s.Convert(chunk(map[string]any{}, "length"))
+	require.NotNil(t, got)
+	require.Len(t, got.Message.ToolCalls, 1)
+	assert.Equal(t, map[string]any{"city": "SF"}, got.Message.ToolCalls[0].Function.Arguments)
+
+	got = s.Convert(map[string]any{"model": "m", "usage": map[string]any{"prompt_tokens": 30, "completion_tokens": 12}})
+	require.NotNil(t, got)
+	assert.True(t, got.Done)
+	assert.Equal(t, "length", got.DoneReason)
+	assert.Equal(t, 30, got.PromptEvalCount)
+	assert.Equal(t, 12, got.EvalCount)
+}
@@ -30,11 +30,8 @@ func ConvertOpenAIToAnthropic(openaiReq types.OpenAIRequest) types.AnthropicRequ
 		anthropicMessages = append(anthropicMessages, anthropicMsg)
 	}
 
-	// 设置默认值
-	maxTokens := 16384
-	if openaiReq.MaxTokens != nil {
-		maxTokens = *openaiReq.MaxTokens
-	}
+	// 输出上限：max_completion_tokens 优先于 max_tokens
+	maxTokens := openAIMaxTokens(openaiReq)
 
 	// 为了增强兼容性，当stream未设置时默认为false（非流式响应）
 	// 这样可以避免客户端在处理函数调用时的解析问题
@@ -54,6 +51,9 @@ func ConvertOpenAIToAnthropic(openaiReq types.OpenAIRequest) types.AnthropicRequ
 		anthropicReq.Temperature = openaiReq.Temperature
 	}
 
+	// stop 映射为 stop_sequences（格式错误已在入口校验，这里忽略）
+	anthropicReq.StopSequences, _ = parseOpenAIStop(openaiReq.Stop)
+
 	// 转换 tools
 	if len(openaiReq.Tools) > 0 {
 		anthropicTools, err := validateAndProcessTools(openaiReq.Tools)
@@ -70,12 +70,21 @@ func ConvertOpenAIToAnthropic(openaiReq types.OpenAIRequest) types.AnthropicRequ
 		anthropicReq.ToolChoice = convertOpenAIToolChoiceToAnthropic(openaiReq.ToolChoice)
 	}
 
+	// reasoning_effort 映射为思考预算
+	anthropicReq.Thinking = thinkingFromReasoningEffort(openaiReq.ReasoningEffort)
+
+	// response_format 通过系统提示约束输出格式
+	if instruction := responseFormatInstruction(openaiReq.ResponseFormat); instruction != "" {
+		anthropicReq.System = append(anthropicReq.System, types.AnthropicSystemMessage{Type: "text", Text: instruction})
+	}
+
 	return anthropicReq
 }
 
 // ConvertAnthropicToOpenAI 将Anthropic响应转换为OpenAI响应
 func ConvertAnthropicToOpenAI(anthropicResp map[string]any, model string, messageId string) types.OpenAIResponse {
 	content := ""
+	var reasoningParts []string
 	var toolCalls []types.OpenAIToolCall
 	finishReason := "stop"
 
@@ -91,6 +100,10 @@ func ConvertAnthropicToOpenAI(anthropicResp map[string]any, model string, messag
 						if text, ok := textBlock["text"].(string); ok {
 							textParts = append(textParts, text)
 						}
+					case "thinking":
+						if thinking, ok := textBlock["thinking"].(string); ok {
+							reasoningParts = append(reasoningParts, thinking)
+						}
 					case "tool_use":
 						finishReason = "tool_calls"
 						if toolUseId, ok := textBlock["id"].(string); ok {
@@ -124,6 +137,10 @@ func ConvertAnthropicToOpenAI(anthropicResp map[string]any, model string, messag
 					if text, ok := textBlock["text"].(string); ok {
 						textParts = append(textParts, text)
 					}
+				case "thinking":
+					if thinking, ok := textBlock["thinking"].(string); ok {
+						reasoningParts = append(reasoningParts, thinking)
+					}
 				case "tool_use":
 					finishReason = "tool_calls"
 					if toolUseId, ok := textBlock["id"].(string); ok {
@@ -148,6 +165,11 @@ func ConvertAnthropicToOpenAI(anthropicResp map[string]any, model string, messag
 		content = strings.Join(textParts, "")
 	}
 
+	// 响应携带 stop_reason 时以其为准（max_tokens → length，stop_sequence → stop）
+	if stopReason, ok := anthropicResp["stop_reason"].(string); ok && stopReason != "" {
+		finishReason = FinishReasonFromStopReason(stopReason)
+	}
+
 	// 计算token使用量
 	promptTokens := 0
 	completionTokens := len(content) / 4 // 简单估算
@@ -161,8 +183,9 @@ func ConvertAnthropicToOpenAI(anthropicResp map[string]any, model string, messag
 	}
 
 	message := types.OpenAIMessage{
-		Role:    "assistant",
-		Content: content,
+		Role:             "assistant",
+		Content:          content,
+		ReasoningContent: strings.Join(reasoningParts, ""),
 	}
 
 	// 只有当有tool_calls时才添加ToolCalls字段
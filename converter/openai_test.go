@@ -187,8 +187,9 @@ func TestConvertAnthropicToOpenAI_StopReasonMapping(t *testing.T) {
 		expectedFinishReason string
 	}{
 		{"end_turn映射为stop", "end_turn", "stop"},
-		{"max_tokens映射为stop", "max_tokens", "stop"},
+		{"max_tokens映射为length", "max_tokens", "length"},
 		{"stop_sequence映射为stop", "stop_sequence", "stop"},
+		{"tool_use映射为tool_calls", "tool_use", "tool_calls"},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,136 @@
+package converter
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"kiro2api/types"
+	"kiro2api/utils"
+)
+
+// OpenAI response_format 类型
+const (
+	ResponseFormatText       = "text"
+	ResponseFormatJSONObject = "json_object"
+	ResponseFormatJSONSchema = "json_schema"
+)
+
+// ValidateResponseFormat 校验 response_format 参数，不支持的取值返回错误（由调用方转为400）
+func ValidateResponseFormat(format *types.OpenAIResponseFormat) error {
+	if format == nil {
+		return nil
+	}
+	switch format.Type {
+	case "", ResponseFormatText, ResponseFormatJSONObject:
+		return nil
+	case ResponseFormatJSONSchema:
+		if format.JSONSchema == nil {
+			return fmt.Errorf("response_format.type 为 json_schema 时必须提供 json_schema")
+		}
+		if strings.TrimSpace(format.JSONSchema.Name) == "" {
+			return fmt.Errorf("response_format.json_schema.name 不能为空")
+		}
+		if format.JSONSchema.Schema == nil {
+			return fmt.Errorf("response_format.json_schema.schema 不能为空")
+		}
+		return nil
+	default:
+		return fmt.Errorf("不支持的 response_format.type: %s（支持 text、json_object、json_schema）", format.Type)
+	}
+}
+
+// RequiresJSONOutput 判断是否要求模型输出JSON
+func RequiresJSONOutput(format *types.OpenAIResponseFormat) bool {
+	return format != nil && (format.Type == ResponseFormatJSONObject || format.Type == ResponseFormatJSONSchema)
+}
+
+// responseFormatInstruction 生成注入系统提示的结构化输出要求，text 或未设置时返回空串
+// 提示词使用英文，与上游模型的指令遵循习惯保持一致
+func responseFormatInstruction(format *types.OpenAIResponseFormat) string {
+	if !RequiresJSONOutput(format) {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("Respond with a single valid JSON value and nothing else: no prose, no explanations, no Markdown code fences.")
+	if format.Type == ResponseFormatJSONObject {
+		b.WriteString(" The top-level value must be a JSON object.")
+		return b.String()
+	}
+
+	schema := format.JSONSchema
+	b.WriteString(" The JSON must conform exactly to the following JSON Schema")
+	if schema.Name != "" {
+		fmt.Fprintf(&b, " (named %q)", schema.Name)
+	}
+	b.WriteString(". Include every required property and do not add properties the schema does not allow.")
+	if schema.Description != "" {
+		fmt.Fprintf(&b, "\nSchema description: %s", schema.Description)
+	}
+	if raw, err := utils.SafeMarshal(schema.Schema); err == nil {
+		b.WriteString("\nJSON Schema:\n")
+		b.Write(raw)
+	}
+	return b.String()
+}
+
+// CheckResponseFormat 从模型输出中提取JSON并按 response_format 校验
+// 返回去除代码块等包装后的JSON文本，以及不符合项（为空表示通过）
+func CheckResponseFormat(format *types.OpenAIResponseFormat, output string) (string, []string) {
+	if !RequiresJSONOutput(format) {
+		return output, nil
+	}
+
+	cleaned, value, err := extractJSONOutput(output)
+	if err != nil {
+		return output, []string{err.Error()}
+	}
+	if format.Type == ResponseFormatJSONObject {
+		if _, ok := value.(map[string]any); !ok {
+			return cleaned, []string{"顶层值必须是JSON对象"}
+		}
+		return cleaned, nil
+	}
+	return cleaned, utils.ValidateJSONSchema(format.JSONSchema.Schema, value)
+}
+
+// extractJSONOutput 解析模型输出中的JSON，兼容 ```json 代码块与前后多余文字
+func extractJSONOutput(output string) (string, any, error) {
+	text := strings.TrimSpace(output)
+	if strings.HasPrefix(text, "```") {
+		text = strings.TrimPrefix(text, "```")
+		if newline := strings.IndexByte(text, '\n'); newline >= 0 {
+			text = text[newline+1:]
+		}
+		text = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "```"))
+	}
+
+	var value any
+	if err := json.Unmarshal([]byte(text), &value); err == nil {
+		return text, value, nil
+	}
+
+	// 截取首个 { 或 [ 到最后一个 } 或 ] 之间的内容再尝试
+	start := strings.IndexAny(text, "{[")
+	end := strings.LastIndexAny(text, "}]")
+	if start >= 0 && end > start {
+		candidate := text[start : end+1]
+		if err := json.Unmarshal([]byte(candidate), &value); err == nil {
+			return candidate, value, nil
+		}
+	}
+	return text, nil, fmt.Errorf("输出不是有效的JSON")
+}
+
+// BuildResponseFormatRepairRequest 基于原请求追加模型的无效输出与修正要求，用于修复重试
+func BuildResponseFormatRepairRequest(req types.AnthropicRequest, output string, problems []string) types.AnthropicRequest {
+	repair := req
+	repair.Messages = append(append([]types.AnthropicRequestMessage(nil), req.Messages...),
+		types.AnthropicRequestMessage{Role: "assistant", Content: output},
+		types.AnthropicRequestMessage{Role: "user", Content: "Your previous reply did not satisfy the required JSON format:\n- " +
+			strings.Join(problems, "\n- ") +
+			"\nReply again with only the corrected JSON value."},
+	)
+	return repair
+}
@@ -0,0 +1,100 @@
+package converter
+
+import (
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func personSchemaFormat(strict bool) *types.OpenAIResponseFormat {
+	return &types.OpenAIResponseFormat{
+		Type: ResponseFormatJSONSchema,
+		JSONSchema: &types.OpenAIJSONSchema{
+			Name:   "person",
+			Strict: &strict,
+			Schema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"name": map[string]any{"type": "string"},
+					"age":  map[string]any{"type": "integer", "minimum": float64(0)},
+				},
+				"required":             []any{"name", "age"},
+				"additionalProperties": false,
+			},
+		},
+	}
+}
+
+func TestValidateResponseFormat(t *testing.T) {
+	assert.NoError(t, ValidateResponseFormat(nil))
+	assert.NoError(t, ValidateResponseFormat(&types.OpenAIResponseFormat{Type: "text"}))
+	assert.NoError(t, ValidateResponseFormat(&types.OpenAIResponseFormat{Type: "json_object"}))
+	assert.NoError(t, ValidateResponseFormat(personSchemaFormat(true)))
+
+	assert.ErrorContains(t, ValidateResponseFormat(&types.OpenAIResponseFormat{Type: "xml"}), "不支持的 response_format.type")
+	assert.ErrorContains(t, ValidateResponseFormat(&types.OpenAIResponseFormat{Type: "json_schema"}), "必须提供 json_schema")
+	assert.ErrorContains(t, ValidateResponseFormat(&types.OpenAIResponseFormat{
+		Type:       "json_schema",
+		JSONSchema: &types.OpenAIJSONSchema{Name: "x"},
+	}), "schema 不能为空")
+}
+
+func TestConvertOpenAIToAnthropic_ResponseFormatInstruction(t *testing.T) {
+	req := types.OpenAIRequest{
+		Model:          "claude-sonnet-4-20250514",
+		Messages:       []types.OpenAIMessage{{Role: "user", Content: "hi"}},
+		ResponseFormat: personSchemaFormat(true),
+	}
+
+	anthropicReq := ConvertOpenAIToAnthropic(req)
+
+	require.Len(t, anthropicReq.System, 1)
+	assert.Contains(t, anthropicReq.System[0].Text, "JSON Schema")
+	assert.Contains(t, anthropicReq.System[0].Text, `"required":["name","age"]`)
+
+	req.ResponseFormat = &types.OpenAIResponseFormat{Type: "text"}
+	assert.Empty(t, ConvertOpenAIToAnthropic(req).System)
+}
+
+func TestCheckResponseFormat(t *testing.T) {
+	format := personSchemaFormat(true)
+
+	cleaned, problems := CheckResponseFormat(format, "```json\n{\"name\":\"张三\",\"age\":30}\n```")
+	assert.Empty(t, problems)
+	assert.Equal(t, `{"name":"张三","age":30}`, cleaned)
+
+	cleaned, problems = CheckResponseFormat(format, `结果如下：{"name":"张三","age":30} 完毕`)
+	assert.Empty(t, problems)
+	assert.Equal(t, `{"name":"张三","age":30}`, cleaned)
+
+	_, problems = CheckResponseFormat(format, `{"name":"张三","age":-1,"extra":true}`)
+	assert.Equal(t, []string{"/age: 不能小于 0", `/: 不允许的字段 "extra"`}, problems)
+
+	_, problems = CheckResponseFormat(format, "抱歉，我无法回答")
+	assert.Equal(t, []string{"输出不是有效的JSON"}, problems)
+
+	_, problems = CheckResponseFormat(&types.OpenAIResponseFormat{Type: "json_object"}, `[1,2]`)
+	assert.Equal(t, []string{"顶层值必须是JSON对象"}, problems)
+
+	cleaned, problems = CheckResponseFormat(nil, "plain text")
+	assert.Empty(t, problems)
+	assert.Equal(t, "plain text", cleaned)
+}
+
+func TestBuildResponseFormatRepairRequest(t *testing.T) {
+	req := types.AnthropicRequest{
+		Model:    "claude-sonnet-4-20250514",
+		Messages: []types.AnthropicRequestMessage{{Role: "user", Content: "hi"}},
+	}
+
+	repair := BuildResponseFormatRepairRequest(req, "not json", []string{"输出不是有效的JSON"})
+
+	require.Len(t, repair.Messages, 3)
+	assert.Len(t, req.Messages, 1, "不修改原请求")
+	assert.Equal(t, "assistant", repair.Messages[1].Role)
+	assert.Equal(t, "not json", repair.Messages[1].Content)
+	assert.Contains(t, repair.Messages[2].Content, "输出不是有效的JSON")
+}
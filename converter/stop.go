@@ -0,0 +1,107 @@
+package converter
+
+import (
+	"fmt"
+
+	"kiro2api/config"
+	"kiro2api/types"
+)
+
+// MaxOpenAIStopSequences OpenAI stop 参数最多允许的停止序列数
+const MaxOpenAIStopSequences = 4
+
+// defaultOpenAIMaxTokens OpenAI 请求未指定输出上限时使用的默认值
+const defaultOpenAIMaxTokens = 16384
+
+// ValidateStopSequences 校验 Anthropic stop_sequences 与 max_tokens
+func ValidateStopSequences(req types.AnthropicRequest) error {
+	if req.MaxTokens < 0 {
+		return fmt.Errorf("max_tokens 不能小于 1")
+	}
+	for i, seq := range req.StopSequences {
+		if seq == "" {
+			return fmt.Errorf("stop_sequences[%d] 不能为空字符串", i)
+		}
+	}
+	return nil
+}
+
+// ValidateOpenAIStop 校验 OpenAI stop、max_tokens 与 max_completion_tokens 参数
+func ValidateOpenAIStop(req types.OpenAIRequest) error {
+	if req.MaxTokens != nil && *req.MaxTokens < 1 {
+		return fmt.Errorf("max_tokens 不能小于 1")
+	}
+	if req.MaxCompletionTokens != nil && *req.MaxCompletionTokens < 1 {
+		return fmt.Errorf("max_completion_tokens 不能小于 1")
+	}
+	_, err := parseOpenAIStop(req.Stop)
+	return err
+}
+
+// parseOpenAIStop 将 OpenAI stop（string 或 string 数组）解析为停止序列列表
+func parseOpenAIStop(stop any) ([]string, error) {
+	switch v := stop.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		if v == "" {
+			return nil, nil
+		}
+		return []string{v}, nil
+	case []string:
+		return collectStopSequences(v)
+	case []any:
+		sequences := make([]string, 0, len(v))
+		for i, item := range v {
+			seq, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("stop[%d] 必须是字符串", i)
+			}
+			sequences = append(sequences, seq)
+		}
+		return collectStopSequences(sequences)
+	default:
+		return nil, fmt.Errorf("stop 必须是字符串或字符串数组")
+	}
+}
+
+// collectStopSequences 过滤空字符串并检查数量上限
+func collectStopSequences(sequences []string) ([]string, error) {
+	if len(sequences) > MaxOpenAIStopSequences {
+		return nil, fmt.Errorf("stop 最多支持 %d 个停止序列", MaxOpenAIStopSequences)
+	}
+	var out []string
+	for _, seq := range sequences {
+		if seq != "" {
+			out = append(out, seq)
+		}
+	}
+	return out, nil
+}
+
+// openAIMaxTokens 返回 OpenAI 请求的输出上限，max_completion_tokens 优先于 max_tokens
+// 均未设置时使用模型路由表中的默认值，再退回 defaultOpenAIMaxTokens
+func openAIMaxTokens(req types.OpenAIRequest) int {
+	if req.MaxCompletionTokens != nil {
+		return *req.MaxCompletionTokens
+	}
+	if req.MaxTokens != nil {
+		return *req.MaxTokens
+	}
+	if route, ok := config.ResolveModel(req.Model); ok && route.MaxTokens > 0 {
+		return route.MaxTokens
+	}
+	return defaultOpenAIMaxTokens
+}
+
+// FinishReasonFromStopReason 将 Anthropic stop_reason 映射为 OpenAI finish_reason
+func FinishReasonFromStopReason(stopReason string) string {
+	switch stopReason {
+	case "tool_use":
+		return "tool_calls"
+	case "max_tokens":
+		return "length"
+	default:
+		return "stop"
+	}
+}
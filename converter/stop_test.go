@@ -0,0 +1,71 @@
+package converter
+
+import (
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func intPtr(v int) *int { return &v }
+
+func TestParseOpenAIStop(t *testing.T) {
+	tests := []struct {
+		name    string
+		stop    any
+		want    []string
+		wantErr bool
+	}{
+		{"未设置", nil, nil, false},
+		{"字符串", "END", []string{"END"}, false},
+		{"空字符串", "", nil, false},
+		{"数组", []any{"a", "", "b"}, []string{"a", "b"}, false},
+		{"超过4个", []any{"1", "2", "3", "4", "5"}, nil, true},
+		{"数组元素不是字符串", []any{"a", 1}, nil, true},
+		{"类型错误", 42.0, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOpenAIStop(tt.stop)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestValidateOpenAIStop(t *testing.T) {
+	assert.NoError(t, ValidateOpenAIStop(types.OpenAIRequest{MaxTokens: intPtr(10), Stop: "x"}))
+	assert.Error(t, ValidateOpenAIStop(types.OpenAIRequest{MaxTokens: intPtr(0)}))
+	assert.Error(t, ValidateOpenAIStop(types.OpenAIRequest{MaxCompletionTokens: intPtr(-1)}))
+	assert.Error(t, ValidateOpenAIStop(types.OpenAIRequest{Stop: map[string]any{}}))
+}
+
+func TestValidateStopSequences(t *testing.T) {
+	assert.NoError(t, ValidateStopSequences(types.AnthropicRequest{MaxTokens: 100, StopSequences: []string{"\n\nHuman:"}}))
+	assert.Error(t, ValidateStopSequences(types.AnthropicRequest{MaxTokens: 100, StopSequences: []string{""}}))
+	assert.Error(t, ValidateStopSequences(types.AnthropicRequest{MaxTokens: -1}))
+}
+
+func TestConvertOpenAIToAnthropic_StopAndMaxTokens(t *testing.T) {
+	req := ConvertOpenAIToAnthropic(types.OpenAIRequest{
+		Model:               "gpt-4",
+		Messages:            []types.OpenAIMessage{{Role: "user", Content: "hi"}},
+		MaxTokens:           intPtr(100),
+		MaxCompletionTokens: intPtr(50),
+		Stop:                []any{"END", "\n\n"},
+	})
+
+	assert.Equal(t, 50, req.MaxTokens, "max_completion_tokens 优先于 max_tokens")
+	assert.Equal(t, []string{"END", "\n\n"}, req.StopSequences)
+
+	req = ConvertOpenAIToAnthropic(types.OpenAIRequest{Model: "gpt-4", Stop: "END"})
+	assert.Equal(t, defaultOpenAIMaxTokens, req.MaxTokens)
+	assert.Equal(t, []string{"END"}, req.StopSequences)
+}
@@ -0,0 +1,196 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+
+	"kiro2api/types"
+)
+
+// 思考预算相关常量
+const (
+	// MinThinkingBudget 与 Anthropic API 一致的最小思考预算
+	MinThinkingBudget = 1024
+
+	thinkingOpenTag  = "<thinking>"
+	thinkingCloseTag = "</thinking>"
+)
+
+// reasoningEffortBudgets OpenAI reasoning_effort 对应的思考预算
+var reasoningEffortBudgets = map[string]int{
+	"minimal": MinThinkingBudget,
+	"low":     4096,
+	"medium":  16384,
+	"high":    32768,
+}
+
+// ValidateThinking 校验 Anthropic thinking 参数
+func ValidateThinking(thinking *types.AnthropicThinking) error {
+	if thinking == nil {
+		return nil
+	}
+	switch thinking.Type {
+	case "disabled":
+		return nil
+	case "enabled":
+		if thinking.BudgetTokens < MinThinkingBudget {
+			return fmt.Errorf("thinking.budget_tokens 不能小于 %d", MinThinkingBudget)
+		}
+		return nil
+	default:
+		return fmt.Errorf("不支持的 thinking.type: %s（支持 enabled、disabled）", thinking.Type)
+	}
+}
+
+// ValidateReasoningEffort 校验 OpenAI reasoning_effort 参数
+func ValidateReasoningEffort(effort string) error {
+	if effort == "" {
+		return nil
+	}
+	if _, ok := reasoningEffortBudgets[effort]; !ok {
+		return fmt.Errorf("不支持的 reasoning_effort: %s（支持 minimal、low、medium、high）", effort)
+	}
+	return nil
+}
+
+// thinkingFromReasoningEffort 将 reasoning_effort 映射为 thinking 配置，未设置或无效时返回 nil
+func thinkingFromReasoningEffort(effort string) *types.AnthropicThinking {
+	budget, ok := reasoningEffortBudgets[effort]
+	if !ok {
+		return nil
+	}
+	return &types.AnthropicThinking{Type: "enabled", BudgetTokens: budget}
+}
+
+// ThinkingEnabled 判断请求是否开启了扩展思考
+func ThinkingEnabled(req types.AnthropicRequest) bool {
+	return req.Thinking != nil && req.Thinking.Type == "enabled"
+}
+
+// thinkingSystemPrompt 上游通过系统提示中的标记开启思考，思考内容以 <thinking> 标签输出在回复开头
+func thinkingSystemPrompt(req types.AnthropicRequest) string {
+	if !ThinkingEnabled(req) {
+		return ""
+	}
+	return fmt.Sprintf("<thinking_mode>enabled</thinking_mode>\n<max_thinking_length>%d</max_thinking_length>", req.Thinking.BudgetTokens)
+}
+
+// ThinkingSegment 拆分后的输出片段
+type ThinkingSegment struct {
+	Thinking bool
+	Text     string
+}
+
+// 拆分器状态
+const (
+	splitDetect   = iota // 等待判断回复是否以 <thinking> 开头
+	splitThinking        // 处于思考内容中
+	splitTrimText        // 思考结束，跳过正文开头的空白
+	splitText            // 正文直传
+)
+
+// ThinkingSplitter 从流式文本中拆出开头的 <thinking>...</thinking> 思考内容
+// 只识别回复开头的思考块，正文中出现的标签按普通文本处理；标签被分片截断时暂存到下一片
+type ThinkingSplitter struct {
+	state   int
+	pending string
+}
+
+// NewThinkingSplitter 创建思考内容拆分器
+func NewThinkingSplitter() *ThinkingSplitter {
+	return &ThinkingSplitter{}
+}
+
+// Feed 输入一段文本，返回可以立即输出的片段
+func (s *ThinkingSplitter) Feed(text string) []ThinkingSegment {
+	s.pending += text
+	var out []ThinkingSegment
+
+	for {
+		switch s.state {
+		case splitDetect:
+			trimmed := strings.TrimLeft(s.pending, " \t\r\n")
+			if strings.HasPrefix(trimmed, thinkingOpenTag) {
+				s.pending = trimmed[len(thinkingOpenTag):]
+				s.state = splitThinking
+				continue
+			}
+			if strings.HasPrefix(thinkingOpenTag, trimmed) {
+				return out // 可能是被截断的开始标签，等待更多数据
+			}
+			s.state = splitText
+
+		case splitThinking:
+			if end := strings.Index(s.pending, thinkingCloseTag); end >= 0 {
+				out = appendSegment(out, true, s.pending[:end])
+				s.pending = s.pending[end+len(thinkingCloseTag):]
+				s.state = splitTrimText
+				continue
+			}
+			keep := partialSuffixLen(s.pending, thinkingCloseTag)
+			out = appendSegment(out, true, s.pending[:len(s.pending)-keep])
+			s.pending = s.pending[len(s.pending)-keep:]
+			return out
+
+		case splitTrimText:
+			s.pending = strings.TrimLeft(s.pending, " \t\r\n")
+			if s.pending == "" {
+				return out
+			}
+			s.state = splitText
+
+		case splitText:
+			out = appendSegment(out, false, s.pending)
+			s.pending = ""
+			return out
+		}
+	}
+}
+
+// Flush 结束思考区域并输出暂存内容（未闭合的思考块按思考内容输出），之后的输入均按正文处理
+// 用于输入结束，或正文之外的内容（如工具调用）开始时
+func (s *ThinkingSplitter) Flush() []ThinkingSegment {
+	pending := s.pending
+	state := s.state
+	s.pending = ""
+	s.state = splitText
+	switch state {
+	case splitThinking:
+		return appendSegment(nil, true, pending)
+	case splitTrimText:
+		return nil
+	default:
+		return appendSegment(nil, false, pending)
+	}
+}
+
+// SplitThinking 拆分完整回复中开头的思考内容，返回思考内容与正文
+func SplitThinking(text string) (thinking, content string) {
+	splitter := NewThinkingSplitter()
+	var thinkingParts, contentParts []string
+	for _, segment := range append(splitter.Feed(text), splitter.Flush()...) {
+		if segment.Thinking {
+			thinkingParts = append(thinkingParts, segment.Text)
+		} else {
+			contentParts = append(contentParts, segment.Text)
+		}
+	}
+	return strings.Join(thinkingParts, ""), strings.Join(contentParts, "")
+}
+
+func appendSegment(out []ThinkingSegment, thinking bool, text string) []ThinkingSegment {
+	if text == "" {
+		return out
+	}
+	return append(out, ThinkingSegment{Thinking: thinking, Text: text})
+}
+
+// partialSuffixLen 返回 text 末尾可能是 tag 前缀的最长长度
+func partialSuffixLen(text, tag string) int {
+	for n := len(tag) - 1; n > 0; n-- {
+		if n <= len(text) && strings.HasSuffix(text, tag[:n]) {
+			return n
+		}
+	}
+	return 0
+}
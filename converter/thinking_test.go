@@ -0,0 +1,111 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// feedAll 按分片输入并拼接输出，返回思考内容与正文
+func feedAll(chunks ...string) (string, string) {
+	splitter := NewThinkingSplitter()
+	var thinking, text strings.Builder
+	collect := func(segments []ThinkingSegment) {
+		for _, segment := range segments {
+			if segment.Thinking {
+				thinking.WriteString(segment.Text)
+			} else {
+				text.WriteString(segment.Text)
+			}
+		}
+	}
+	for _, chunk := range chunks {
+		collect(splitter.Feed(chunk))
+	}
+	collect(splitter.Flush())
+	return thinking.String(), text.String()
+}
+
+func TestThinkingSplitter(t *testing.T) {
+	tests := []struct {
+		name         string
+		chunks       []string
+		wantThinking string
+		wantText     string
+	}{
+		{"完整标签", []string{"<thinking>先想一想</thinking>\n\n答案是42"}, "先想一想", "答案是42"},
+		{"标签被截断", []string{"\n<thi", "nking>先想", "一想</thi", "nking>", "\n答案"}, "先想一想", "答案"},
+		{"无思考", []string{"答案是", "42"}, "", "答案是42"},
+		{"正文中的标签按文本处理", []string{"答案 <thinking>x</thinking>"}, "", "答案 <thinking>x</thinking>"},
+		{"未闭合的思考", []string{"<thinking>想到一半"}, "想到一半", ""},
+		{"疑似开始标签", []string{"<thi"}, "", "<thi"},
+		{"结束标签前缀留在正文前", []string{"<thinking>a</", "b</thinking>c"}, "a</b", "c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			thinking, text := feedAll(tt.chunks...)
+			assert.Equal(t, tt.wantThinking, thinking)
+			assert.Equal(t, tt.wantText, text)
+		})
+	}
+}
+
+func TestThinkingSplitter_FlushEndsThinkingRegion(t *testing.T) {
+	splitter := NewThinkingSplitter()
+	assert.Empty(t, splitter.Feed("<thinking"))
+	assert.Equal(t, []ThinkingSegment{{Text: "<thinking"}}, splitter.Flush())
+	assert.Equal(t, []ThinkingSegment{{Text: "<thinking>x"}}, splitter.Feed("<thinking>x"), "Flush 之后不再识别思考标签")
+}
+
+func TestValidateThinking(t *testing.T) {
+	assert.NoError(t, ValidateThinking(nil))
+	assert.NoError(t, ValidateThinking(&types.AnthropicThinking{Type: "disabled"}))
+	assert.NoError(t, ValidateThinking(&types.AnthropicThinking{Type: "enabled", BudgetTokens: 2048}))
+	assert.ErrorContains(t, ValidateThinking(&types.AnthropicThinking{Type: "enabled", BudgetTokens: 100}), "不能小于 1024")
+	assert.ErrorContains(t, ValidateThinking(&types.AnthropicThinking{Type: "auto"}), "不支持的 thinking.type")
+
+	assert.NoError(t, ValidateReasoningEffort(""))
+	assert.NoError(t, ValidateReasoningEffort("high"))
+	assert.ErrorContains(t, ValidateReasoningEffort("extreme"), "不支持的 reasoning_effort")
+}
+
+func TestConvertOpenAIToAnthropic_ReasoningEffort(t *testing.T) {
+	req := types.OpenAIRequest{
+		Model:           "claude-sonnet-4-20250514",
+		Messages:        []types.OpenAIMessage{{Role: "user", Content: "hi"}},
+		ReasoningEffort: "low",
+	}
+
+	anthropicReq := ConvertOpenAIToAnthropic(req)
+
+	require.NotNil(t, anthropicReq.Thinking)
+	assert.Equal(t, "enabled", anthropicReq.Thinking.Type)
+	assert.Equal(t, 4096, anthropicReq.Thinking.BudgetTokens)
+
+	req.ReasoningEffort = ""
+	assert.Nil(t, ConvertOpenAIToAnthropic(req).Thinking)
+}
+
+func TestBuildCodeWhispererRequest_ThinkingPrompt(t *testing.T) {
+	anthropicReq := types.AnthropicRequest{
+		Model:     "claude-sonnet-4-20250514",
+		MaxTokens: 1024,
+		System:    []types.AnthropicSystemMessage{{Type: "text", Text: "你是助手"}},
+		Messages:  []types.AnthropicRequestMessage{{Role: "user", Content: "hi"}},
+		Thinking:  &types.AnthropicThinking{Type: "enabled", BudgetTokens: 2048},
+	}
+
+	cwReq, err := BuildCodeWhispererRequest(anthropicReq, nil)
+
+	require.NoError(t, err)
+	require.NotEmpty(t, cwReq.ConversationState.History)
+	first, ok := cwReq.ConversationState.History[0].(types.HistoryUserMessage)
+	require.True(t, ok)
+	assert.True(t, strings.HasPrefix(first.UserInputMessage.Content,
+		"<thinking_mode>enabled</thinking_mode>\n<max_thinking_length>2048</max_thinking_length>\n你是助手"))
+	assert.Len(t, anthropicReq.System, 1, "不修改调用方的请求")
+}
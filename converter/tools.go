@@ -238,7 +238,11 @@ func convertOpenAIContentToAnthropic(content any) (any, error) {
 			if block, ok := item.(map[string]any); ok {
 				convertedBlock, err := convertContentBlock(block)
 				if err != nil {
-					// 如果转换失败，跳过该块但继续处理其他块
+					// 图片块保留原样，由构建上游请求时统一校验并返回400，避免静默丢弃图片
+					if block["type"] == "image_url" {
+						convertedBlocks = append(convertedBlocks, block)
+					}
+					// 其他块转换失败时跳过该块但继续处理其他块
 					continue
 				}
 				// 如果convertedBlock为nil，表示该块需要被过滤（如web_search）
@@ -284,6 +288,11 @@ func convertContentBlock(block map[string]any) (map[string]any, error) {
 			return nil, fmt.Errorf("image_url字段必须是对象")
 		}
 
+		// http(s) 图片保留原样，构建上游请求时再下载，避免重复下载
+		if urlStr, _ := imageURLMap["url"].(string); utils.IsRemoteImageURL(urlStr) {
+			return block, nil
+		}
+
 		// 使用utils包中的转换函数
 		imageSource, err := utils.ConvertImageURLToImageSource(imageURLMap)
 		if err != nil {
@@ -0,0 +1,250 @@
+package converter
+
+import (
+	"fmt"
+	"regexp"
+
+	"kiro2api/types"
+)
+
+// 请求校验错误码，与 OpenAI 错误对象的 code 字段对应
+const (
+	CodeMissingParameter = "missing_required_parameter"
+	CodeInvalidValue     = "invalid_value"
+	CodeInvalidType      = "invalid_type"
+	CodeInvalidRoleOrder = "invalid_role_order"
+	CodeInvalidTool      = "invalid_tool_schema"
+	// CodeContextLengthExceeded 输入超过 token 上限（由服务端输入守卫返回）
+	CodeContextLengthExceeded = "context_length_exceeded"
+)
+
+// toolNamePattern 工具名称规则（与 OpenAI、Anthropic 一致）
+var toolNamePattern = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// RequestError 请求体校验错误，Param 为出错的参数路径（如 messages[2].role），便于 SDK 直接定位
+type RequestError struct {
+	Message string
+	Param   string
+	Code    string
+}
+
+func (e *RequestError) Error() string {
+	return e.Message
+}
+
+func missingParam(param string) *RequestError {
+	return &RequestError{Message: fmt.Sprintf("缺少必填参数: %s", param), Param: param, Code: CodeMissingParameter}
+}
+
+func invalidParam(param, code, format string, args ...any) *RequestError {
+	return &RequestError{Message: fmt.Sprintf("%s: %s", param, fmt.Sprintf(format, args...)), Param: param, Code: code}
+}
+
+// ValidateOpenAIChatRequest 校验聊天补全请求体：必填字段、消息角色与顺序、工具定义、参数范围
+func ValidateOpenAIChatRequest(req types.OpenAIRequest) error {
+	if req.Model == "" {
+		return missingParam("model")
+	}
+	if len(req.Messages) == 0 {
+		return missingParam("messages")
+	}
+
+	previous := ""
+	for i, msg := range req.Messages {
+		param := fmt.Sprintf("messages[%d]", i)
+		switch msg.Role {
+		case "system", "developer", "user":
+			if msg.Content == nil {
+				return missingParam(param + ".content")
+			}
+		case "assistant":
+			if msg.Content == nil && len(msg.ToolCalls) == 0 {
+				return invalidParam(param+".content", CodeMissingParameter, "assistant 消息需要 content 或 tool_calls")
+			}
+			for j, call := range msg.ToolCalls {
+				if call.ID == "" {
+					return missingParam(fmt.Sprintf("%s.tool_calls[%d].id", param, j))
+				}
+				if call.Function.Name == "" {
+					return missingParam(fmt.Sprintf("%s.tool_calls[%d].function.name", param, j))
+				}
+			}
+		case "tool", "function":
+			if previous != "tool" && previous != "function" &&
+				(previous != "assistant" || len(req.Messages[i-1].ToolCalls) == 0) {
+				return invalidParam(param+".role", CodeInvalidRoleOrder, "%s 消息必须紧跟在包含 tool_calls 的 assistant 消息之后", msg.Role)
+			}
+		case "":
+			return missingParam(param + ".role")
+		default:
+			return invalidParam(param+".role", CodeInvalidValue, "不支持的角色 %q（可选 system、developer、user、assistant、tool）", msg.Role)
+		}
+		previous = msg.Role
+	}
+
+	if req.Temperature != nil && (*req.Temperature < 0 || *req.Temperature > 2) {
+		return invalidParam("temperature", CodeInvalidValue, "取值范围为 0 到 2，当前为 %g", *req.Temperature)
+	}
+	if req.MaxTokens != nil && *req.MaxTokens < 1 {
+		return invalidParam("max_tokens", CodeInvalidValue, "不能小于 1")
+	}
+	if req.MaxCompletionTokens != nil && *req.MaxCompletionTokens < 1 {
+		return invalidParam("max_completion_tokens", CodeInvalidValue, "不能小于 1")
+	}
+
+	names := make(map[string]bool, len(req.Tools))
+	for i, tool := range req.Tools {
+		param := fmt.Sprintf("tools[%d]", i)
+		if tool.Type != "function" {
+			return invalidParam(param+".type", CodeInvalidValue, "不支持的工具类型 %q，仅支持 function", tool.Type)
+		}
+		if err := validateToolName(param+".function.name", tool.Function.Name, names); err != nil {
+			return err
+		}
+		if err := validateToolSchema(param+".function.parameters", tool.Function.Parameters); err != nil {
+			return err
+		}
+	}
+	return validateOpenAIToolChoice(req.ToolChoice, names)
+}
+
+// validateOpenAIToolChoice 校验 tool_choice：auto/none/required 或指定已定义的函数
+func validateOpenAIToolChoice(choice any, names map[string]bool) error {
+	switch v := choice.(type) {
+	case nil:
+		return nil
+	case string:
+		switch v {
+		case "auto", "none", "required", "any":
+			return nil
+		}
+		return invalidParam("tool_choice", CodeInvalidValue, "可选 auto、none、required 或指定函数，当前为 %q", v)
+	case map[string]any:
+		if v["type"] != "function" {
+			return invalidParam("tool_choice.type", CodeInvalidValue, "仅支持 function")
+		}
+		function, _ := v["function"].(map[string]any)
+		name, _ := function["name"].(string)
+		if name == "" {
+			return missingParam("tool_choice.function.name")
+		}
+		if !names[name] {
+			return invalidParam("tool_choice.function.name", CodeInvalidValue, "函数 %q 不在 tools 中", name)
+		}
+		return nil
+	default:
+		return invalidParam("tool_choice", CodeInvalidType, "必须是字符串或对象")
+	}
+}
+
+// ValidateAnthropicMessagesRequest 校验 Messages 请求体：必填字段、消息角色与工具结果顺序、工具定义、参数范围
+func ValidateAnthropicMessagesRequest(req types.AnthropicRequest) error {
+	if req.Model == "" {
+		return missingParam("model")
+	}
+	if len(req.Messages) == 0 {
+		return missingParam("messages")
+	}
+
+	var toolUseIDs map[string]bool // 上一条 assistant 消息中的 tool_use id
+	for i, msg := range req.Messages {
+		param := fmt.Sprintf("messages[%d]", i)
+		if msg.Content == nil {
+			return missingParam(param + ".content")
+		}
+		blocks, _ := msg.Content.([]any)
+		switch msg.Role {
+		case "user":
+			for j, block := range blocks {
+				b, _ := block.(map[string]any)
+				if b["type"] != "tool_result" {
+					continue
+				}
+				id, _ := b["tool_use_id"].(string)
+				blockParam := fmt.Sprintf("%s.content[%d].tool_use_id", param, j)
+				if id == "" {
+					return missingParam(blockParam)
+				}
+				if !toolUseIDs[id] {
+					return invalidParam(blockParam, CodeInvalidRoleOrder, "tool_result 必须对应上一条 assistant 消息中的 tool_use（%s）", id)
+				}
+			}
+			toolUseIDs = nil
+		case "assistant":
+			toolUseIDs = make(map[string]bool)
+			for _, block := range blocks {
+				if b, _ := block.(map[string]any); b["type"] == "tool_use" {
+					if id, _ := b["id"].(string); id != "" {
+						toolUseIDs[id] = true
+					}
+				}
+			}
+		case "":
+			return missingParam(param + ".role")
+		default:
+			return invalidParam(param+".role", CodeInvalidValue, "不支持的角色 %q（可选 user、assistant，系统提示请使用 system 参数）", msg.Role)
+		}
+	}
+
+	if req.Temperature != nil && (*req.Temperature < 0 || *req.Temperature > 1) {
+		return invalidParam("temperature", CodeInvalidValue, "取值范围为 0 到 1，当前为 %g", *req.Temperature)
+	}
+	if req.MaxTokens < 0 {
+		return invalidParam("max_tokens", CodeInvalidValue, "不能小于 1")
+	}
+
+	names := make(map[string]bool, len(req.Tools))
+	for i, tool := range req.Tools {
+		param := fmt.Sprintf("tools[%d]", i)
+		if err := validateToolName(param+".name", tool.Name, names); err != nil {
+			return err
+		}
+		if err := validateToolSchema(param+".input_schema", tool.InputSchema); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateToolName 校验工具名称格式与唯一性
+func validateToolName(param, name string, seen map[string]bool) error {
+	if name == "" {
+		return missingParam(param)
+	}
+	if !toolNamePattern.MatchString(name) {
+		return invalidParam(param, CodeInvalidValue, "工具名称 %q 只能包含字母、数字、下划线与连字符，最长 64 个字符", name)
+	}
+	if seen[name] {
+		return invalidParam(param, CodeInvalidValue, "工具名称 %q 重复", name)
+	}
+	seen[name] = true
+	return nil
+}
+
+// validateToolSchema 校验工具参数 schema：顶层必须是 object，properties 与 required 类型正确
+// 未提供 schema 时不校验（按无参数工具处理）
+func validateToolSchema(param string, schema map[string]any) error {
+	if schema == nil {
+		return nil
+	}
+	if t, ok := schema["type"]; ok && t != "object" {
+		return invalidParam(param+".type", CodeInvalidTool, "顶层类型必须是 object")
+	}
+	if properties, ok := schema["properties"]; ok {
+		if _, isObject := properties.(map[string]any); !isObject {
+			return invalidParam(param+".properties", CodeInvalidTool, "必须是对象")
+		}
+	}
+	if required, ok := schema["required"]; ok {
+		items, isArray := required.([]any)
+		if !isArray {
+			return invalidParam(param+".required", CodeInvalidTool, "必须是字符串数组")
+		}
+		for _, item := range items {
+			if _, isString := item.(string); !isString {
+				return invalidParam(param+".required", CodeInvalidTool, "必须是字符串数组")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package converter
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidateOpenAIChatRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantParam string
+		wantCode  string
+	}{
+		{"合法请求", `{"model":"m","messages":[{"role":"system","content":"s"},{"role":"user","content":"hi"},{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"f","arguments":"{}"}}]},{"role":"tool","tool_call_id":"call_1","content":"ok"}],"tools":[{"type":"function","function":{"name":"f","parameters":{"type":"object","properties":{}}}}],"tool_choice":{"type":"function","function":{"name":"f"}}}`, "", ""},
+		{"缺少模型", `{"messages":[{"role":"user","content":"hi"}]}`, "model", CodeMissingParameter},
+		{"缺少消息", `{"model":"m","messages":[]}`, "messages", CodeMissingParameter},
+		{"未知角色", `{"model":"m","messages":[{"role":"bot","content":"hi"}]}`, "messages[0].role", CodeInvalidValue},
+		{"用户消息缺少内容", `{"model":"m","messages":[{"role":"user"}]}`, "messages[0].content", CodeMissingParameter},
+		{"工具结果顺序错误", `{"model":"m","messages":[{"role":"user","content":"hi"},{"role":"tool","content":"ok"}]}`, "messages[1].role", CodeInvalidRoleOrder},
+		{"工具调用缺少ID", `{"model":"m","messages":[{"role":"assistant","tool_calls":[{"type":"function","function":{"name":"f"}}]}]}`, "messages[0].tool_calls[0].id", CodeMissingParameter},
+		{"温度超出范围", `{"model":"m","messages":[{"role":"user","content":"hi"}],"temperature":2.5}`, "temperature", CodeInvalidValue},
+		{"max_tokens 为0", `{"model":"m","messages":[{"role":"user","content":"hi"}],"max_tokens":0}`, "max_tokens", CodeInvalidValue},
+		{"工具名称无效", `{"model":"m","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"get weather"}}]}`, "tools[0].function.name", CodeInvalidValue},
+		{"工具名称重复", `{"model":"m","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"f"}},{"type":"function","function":{"name":"f"}}]}`, "tools[1].function.name", CodeInvalidValue},
+		{"工具schema不是对象", `{"model":"m","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"f","parameters":{"type":"string"}}}]}`, "tools[0].function.parameters.type", CodeInvalidTool},
+		{"required 类型错误", `{"model":"m","messages":[{"role":"user","content":"hi"}],"tools":[{"type":"function","function":{"name":"f","parameters":{"type":"object","required":"a"}}}]}`, "tools[0].function.parameters.required", CodeInvalidTool},
+		{"tool_choice 指定未定义函数", `{"model":"m","messages":[{"role":"user","content":"hi"}],"tool_choice":{"type":"function","function":{"name":"g"}}}`, "tool_choice.function.name", CodeInvalidValue},
+		{"tool_choice 取值无效", `{"model":"m","messages":[{"role":"user","content":"hi"}],"tool_choice":"always"}`, "tool_choice", CodeInvalidValue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req types.OpenAIRequest
+			require.NoError(t, json.Unmarshal([]byte(tt.body), &req))
+			err := ValidateOpenAIChatRequest(req)
+			if tt.wantParam == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var reqErr *RequestError
+			require.True(t, errors.As(err, &reqErr), "%v", err)
+			assert.Equal(t, tt.wantParam, reqErr.Param)
+			assert.Equal(t, tt.wantCode, reqErr.Code)
+			assert.Contains(t, reqErr.Message, tt.wantParam)
+		})
+	}
+}
+
+func TestValidateAnthropicMessagesRequest(t *testing.T) {
+	tests := []struct {
+		name      string
+		body      string
+		wantParam string
+		wantCode  string
+	}{
+		{"合法请求", `{"model":"m","max_tokens":10,"messages":[{"role":"user","content":"hi"},{"role":"assistant","content":[{"type":"tool_use","id":"toolu_1","name":"f","input":{}}]},{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_1","content":"ok"}]}],"tools":[{"name":"f","input_schema":{"type":"object"}}]}`, "", ""},
+		{"缺少模型", `{"messages":[{"role":"user","content":"hi"}]}`, "model", CodeMissingParameter},
+		{"system 角色", `{"model":"m","messages":[{"role":"system","content":"s"}]}`, "messages[0].role", CodeInvalidValue},
+		{"缺少内容", `{"model":"m","messages":[{"role":"user"}]}`, "messages[0].content", CodeMissingParameter},
+		{"工具结果没有对应调用", `{"model":"m","messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"ok"},{"role":"user","content":[{"type":"tool_result","tool_use_id":"toolu_9","content":"x"}]}]}`, "messages[2].content[0].tool_use_id", CodeInvalidRoleOrder},
+		{"温度超出范围", `{"model":"m","messages":[{"role":"user","content":"hi"}],"temperature":1.5}`, "temperature", CodeInvalidValue},
+		{"工具schema不是对象", `{"model":"m","messages":[{"role":"user","content":"hi"}],"tools":[{"name":"f","input_schema":{"type":"array"}}]}`, "tools[0].input_schema.type", CodeInvalidTool},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var req types.AnthropicRequest
+			require.NoError(t, json.Unmarshal([]byte(tt.body), &req))
+			err := ValidateAnthropicMessagesRequest(req)
+			if tt.wantParam == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var reqErr *RequestError
+			require.True(t, errors.As(err, &reqErr), "%v", err)
+			assert.Equal(t, tt.wantParam, reqErr.Param)
+			assert.Equal(t, tt.wantCode, reqErr.Code)
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package janitor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"kiro2api/logger"
+)
+
+// Target 清理目标：按保留策略删除过期的运行期产物
+type Target interface {
+	Name() string
+	// Prune 清理过期产物，返回删除的条目数与回收的字节数
+	Prune(now time.Time) (removed int, reclaimed int64, err error)
+}
+
+// FileTarget 按修改时间清理目录下匹配的文件或子目录
+type FileTarget struct {
+	Label     string        // 目标名称（用于指标与日志）
+	Dir       string        // 产物所在目录，不存在时跳过
+	Pattern   string        // 文件名匹配模式（filepath.Match 语法），为空表示全部
+	Retention time.Duration // 保留期，<=0 表示不清理
+}
+
+// Name 目标名称
+func (t FileTarget) Name() string {
+	return t.Label
+}
+
+// Prune 删除修改时间早于保留期的条目（跳过符号链接，避免误删目录外的文件）
+func (t FileTarget) Prune(now time.Time) (int, int64, error) {
+	if t.Retention <= 0 || t.Dir == "" {
+		return 0, 0, nil
+	}
+	pattern := t.Pattern
+	if pattern == "" {
+		pattern = "*"
+	}
+
+	matches, err := filepath.Glob(filepath.Join(t.Dir, pattern))
+	if err != nil {
+		return 0, 0, fmt.Errorf("匹配清理目标失败: %w", err)
+	}
+
+	cutoff := now.Add(-t.Retention)
+	removed, reclaimed := 0, int64(0)
+	var errs []error
+	for _, path := range matches {
+		info, err := os.Lstat(path)
+		if err != nil {
+			if !errors.Is(err, fs.ErrNotExist) {
+				errs = append(errs, err)
+			}
+			continue
+		}
+		if info.Mode()&fs.ModeSymlink != 0 || !info.ModTime().Before(cutoff) {
+			continue
+		}
+
+		size := info.Size()
+		if info.IsDir() {
+			size = dirSize(path)
+			err = os.RemoveAll(path)
+		} else {
+			err = os.Remove(path)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("删除 %s 失败: %w", path, err))
+			continue
+		}
+		removed++
+		reclaimed += size
+	}
+	return removed, reclaimed, errors.Join(errs...)
+}
+
+// dirSize 统计目录下普通文件的总大小
+func dirSize(root string) int64 {
+	var total int64
+	_ = filepath.WalkDir(root, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		if info, err := d.Info(); err == nil {
+			total += info.Size()
+		}
+		return nil
+	})
+	return total
+}
+
+// FuncTarget 由子系统提供清理逻辑的目标（如内存中已完成的队列条目）
+type FuncTarget struct {
+	Label string
+	Fn    func(now time.Time) (removed int, reclaimed int64, err error)
+}
+
+// Name 目标名称
+func (t FuncTarget) Name() string {
+	return t.Label
+}
+
+// Prune 调用子系统的清理函数
+func (t FuncTarget) Prune(now time.Time) (int, int64, error) {
+	return t.Fn(now)
+}
+
+// TargetStats 单个目标的累计清理指标
+type TargetStats struct {
+	Name           string    `json:"name"`
+	Runs           int64     `json:"runs"`
+	Removed        int64     `json:"removed"`
+	ReclaimedBytes int64     `json:"reclaimed_bytes"`
+	LastRun        time.Time `json:"last_run,omitempty"`
+	LastRemoved    int       `json:"last_removed"`
+	LastError      string    `json:"last_error,omitempty"`
+}
+
+// Janitor 定期清理运行期产物，防止长期运行的实例磁盘无限增长
+type Janitor struct {
+	mu       sync.Mutex
+	runMu    sync.Mutex
+	interval time.Duration
+	targets  []Target
+	stats    map[string]*TargetStats
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New 创建清理器，interval<=0 时不启动后台清理（仍可手动 RunOnce）
+func New(interval time.Duration) *Janitor {
+	return &Janitor{
+		interval: interval,
+		stats:    make(map[string]*TargetStats),
+	}
+}
+
+// Register 注册清理目标，同名目标会被替换
+func (j *Janitor) Register(target Target) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i, existing := range j.targets {
+		if existing.Name() == target.Name() {
+			j.targets[i] = target
+			return
+		}
+	}
+	j.targets = append(j.targets, target)
+	j.stats[target.Name()] = &TargetStats{Name: target.Name()}
+}
+
+// RunOnce 执行一轮清理并返回各目标本轮的指标
+func (j *Janitor) RunOnce(now time.Time) []TargetStats {
+	j.runMu.Lock()
+	defer j.runMu.Unlock()
+
+	j.mu.Lock()
+	targets := append([]Target(nil), j.targets...)
+	j.mu.Unlock()
+
+	results := make([]TargetStats, 0, len(targets))
+	for _, target := range targets {
+		removed, reclaimed, err := target.Prune(now)
+		result := TargetStats{
+			Name:           target.Name(),
+			Runs:           1,
+			Removed:        int64(removed),
+			ReclaimedBytes: reclaimed,
+			LastRun:        now,
+			LastRemoved:    removed,
+		}
+		if err != nil {
+			result.LastError = err.Error()
+			logger.Warn("清理运行期产物失败", logger.String("target", target.Name()), logger.Err(err))
+		}
+		if removed > 0 {
+			logger.Info("已清理过期运行期产物",
+				logger.String("target", target.Name()),
+				logger.Int("removed", removed),
+				logger.Int64("reclaimed_bytes", reclaimed))
+		}
+
+		j.mu.Lock()
+		if s, ok := j.stats[target.Name()]; ok {
+			s.Runs++
+			s.Removed += result.Removed
+			s.ReclaimedBytes += reclaimed
+			s.LastRun = now
+			s.LastRemoved = removed
+			s.LastError = result.LastError
+		}
+		j.mu.Unlock()
+
+		results = append(results, result)
+	}
+	return results
+}
+
+// Stats 返回各目标的累计指标（按名称排序）
+func (j *Janitor) Stats() []TargetStats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	out := make([]TargetStats, 0, len(j.stats))
+	for _, s := range j.stats {
+		out = append(out, *s)
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Name < out[b].Name })
+	return out
+}
+
+// Interval 后台清理间隔
+func (j *Janitor) Interval() time.Duration {
+	return j.interval
+}
+
+// Start 启动后台定期清理（启动时先执行一轮）
+func (j *Janitor) Start() {
+	if j.interval <= 0 || j.stop != nil {
+		return
+	}
+	j.stop = make(chan struct{})
+	j.done = make(chan struct{})
+	go func() {
+		defer close(j.done)
+		j.RunOnce(time.Now())
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-j.stop:
+				return
+			case now := <-ticker.C:
+				j.RunOnce(now)
+			}
+		}
+	}()
+}
+
+// Stop 停止后台清理
+func (j *Janitor) Stop() {
+	if j.stop == nil {
+		return
+	}
+	close(j.stop)
+	<-j.done
+	j.stop = nil
+}
@@ -0,0 +1,88 @@
+package janitor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeAged 写入文件并设置修改时间
+func writeAged(t *testing.T, path string, size int, age time.Duration) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(t, os.WriteFile(path, make([]byte, size), 0o600))
+	mtime := time.Now().Add(-age)
+	require.NoError(t, os.Chtimes(path, mtime, mtime))
+}
+
+func TestFileTarget_PrunesExpiredEntries(t *testing.T) {
+	dir := t.TempDir()
+	writeAged(t, filepath.Join(dir, "old.jsonl"), 100, 48*time.Hour)
+	writeAged(t, filepath.Join(dir, "new.jsonl"), 100, time.Hour)
+	writeAged(t, filepath.Join(dir, "old.txt"), 100, 48*time.Hour)
+
+	// 过期的子目录整体删除并统计其中文件大小
+	writeAged(t, filepath.Join(dir, "bundle", "a.bin"), 30, 48*time.Hour)
+	writeAged(t, filepath.Join(dir, "bundle", "b.bin"), 20, 48*time.Hour)
+	old := time.Now().Add(-48 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "bundle"), old, old))
+
+	removed, reclaimed, err := FileTarget{Label: "jsonl", Dir: dir, Pattern: "*.jsonl", Retention: 24 * time.Hour}.Prune(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 1, removed)
+	assert.Equal(t, int64(100), reclaimed)
+	assert.NoFileExists(t, filepath.Join(dir, "old.jsonl"))
+	assert.FileExists(t, filepath.Join(dir, "new.jsonl"))
+	assert.FileExists(t, filepath.Join(dir, "old.txt"))
+
+	removed, reclaimed, err = FileTarget{Label: "all", Dir: dir, Retention: 24 * time.Hour}.Prune(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	assert.Equal(t, int64(150), reclaimed)
+	assert.NoDirExists(t, filepath.Join(dir, "bundle"))
+
+	// 目录不存在或未配置保留期时跳过
+	removed, _, err = FileTarget{Label: "missing", Dir: filepath.Join(dir, "none"), Retention: time.Hour}.Prune(time.Now())
+	assert.NoError(t, err)
+	assert.Zero(t, removed)
+	removed, _, _ = FileTarget{Label: "off", Dir: dir}.Prune(time.Now().Add(time.Hour * 1000))
+	assert.Zero(t, removed)
+}
+
+func TestJanitor_AccumulatesStats(t *testing.T) {
+	j := New(0)
+	calls := 0
+	j.Register(FuncTarget{Label: "queue", Fn: func(time.Time) (int, int64, error) {
+		calls++
+		return 2, 10, nil
+	}})
+	j.Register(FuncTarget{Label: "broken", Fn: func(time.Time) (int, int64, error) {
+		return 0, 0, errors.New("boom")
+	}})
+
+	results := j.RunOnce(time.Now())
+	require.Len(t, results, 2)
+	assert.Equal(t, 2, results[0].LastRemoved)
+	assert.Equal(t, "boom", results[1].LastError)
+	j.RunOnce(time.Now())
+
+	stats := j.Stats()
+	require.Len(t, stats, 2)
+	assert.Equal(t, "broken", stats[0].Name)
+	assert.Equal(t, "boom", stats[0].LastError)
+	assert.Equal(t, "queue", stats[1].Name)
+	assert.Equal(t, int64(2), stats[1].Runs)
+	assert.Equal(t, int64(4), stats[1].Removed)
+	assert.Equal(t, int64(20), stats[1].ReclaimedBytes)
+	assert.Equal(t, 2, calls)
+
+	// 未配置间隔时不启动后台清理
+	j.Start()
+	j.Stop()
+	assert.Equal(t, 2, calls)
+}
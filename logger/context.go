@@ -0,0 +1,83 @@
+package logger
+
+import "context"
+
+// contextFieldsKey 上下文中保存日志字段的键
+type contextFieldsKey struct{}
+
+// ContextWithFields 返回附加了日志字段的上下文，WithRequest 会自动带上这些字段
+func ContextWithFields(ctx context.Context, fields ...Field) context.Context {
+	existing, _ := ctx.Value(contextFieldsKey{}).([]Field)
+	merged := make([]Field, 0, len(existing)+len(fields))
+	merged = append(merged, existing...)
+	merged = append(merged, fields...)
+	return context.WithValue(ctx, contextFieldsKey{}, merged)
+}
+
+// ContextWithRequestID 返回附加了 request_id 的上下文
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return ContextWithFields(ctx, String("request_id", requestID))
+}
+
+// RequestIDFromContext 读取上下文中的 request_id（不存在时返回空串）
+func RequestIDFromContext(ctx context.Context) string {
+	fields, _ := ctx.Value(contextFieldsKey{}).([]Field)
+	for i := len(fields) - 1; i >= 0; i-- {
+		if fields[i].Key == "request_id" {
+			if s, ok := fields[i].Value.(string); ok {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// Entry 绑定了请求上下文字段的日志记录器
+type Entry struct {
+	fields []Field
+}
+
+// WithRequest 返回带有请求上下文字段（request_id 等）的日志记录器
+func WithRequest(ctx context.Context) *Entry {
+	if ctx == nil {
+		return &Entry{}
+	}
+	fields, _ := ctx.Value(contextFieldsKey{}).([]Field)
+	return &Entry{fields: fields}
+}
+
+// With 返回追加了字段的新记录器
+func (e *Entry) With(fields ...Field) *Entry {
+	merged := make([]Field, 0, len(e.fields)+len(fields))
+	merged = append(merged, e.fields...)
+	merged = append(merged, fields...)
+	return &Entry{fields: merged}
+}
+
+// merge 合并绑定字段与本次调用字段
+func (e *Entry) merge(fields []Field) []Field {
+	if len(e.fields) == 0 {
+		return fields
+	}
+	out := make([]Field, 0, len(e.fields)+len(fields))
+	out = append(out, e.fields...)
+	return append(out, fields...)
+}
+
+// 以下方法直接调用 log，保持与全局函数相同的调用栈深度
+
+func (e *Entry) Debug(msg string, fields ...Field) {
+	defaultLogger.log(DEBUG, msg, e.merge(fields))
+}
+
+func (e *Entry) Info(msg string, fields ...Field) {
+	defaultLogger.log(INFO, msg, e.merge(fields))
+}
+
+func (e *Entry) Warn(msg string, fields ...Field) {
+	defaultLogger.log(WARN, msg, e.merge(fields))
+}
+
+func (e *Entry) Error(msg string, fields ...Field) {
+	defaultLogger.log(ERROR, msg, e.merge(fields))
+}
@@ -12,6 +12,8 @@ import (
 	"strings"
 	"sync/atomic"
 	"time"
+
+	"kiro2api/redact"
 )
 
 // Level 日志级别类型
@@ -44,12 +46,19 @@ type Field struct {
 type Logger struct {
 	level        int64       // 使用原子操作的日志级别
 	logger       *log.Logger // log.Logger本身线程安全，移除mutex
-	logFile      *os.File
+	logFile      io.Closer
 	writers      []io.Writer
-	enableCaller bool // 控制是否获取调用栈信息（包含文件与函数名）
-	callerSkip   int  // 调用栈深度
+	enableCaller bool   // 控制是否获取调用栈信息（包含文件与函数名）
+	callerSkip   int    // 调用栈深度
+	format       string // 输出格式：json（默认）或 text
 }
 
+// 日志输出格式
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
 var (
 	defaultLogger *Logger
 )
@@ -66,6 +75,15 @@ func createLogger() *Logger {
 		writers:      []io.Writer{os.Stdout}, // 默认输出到控制台
 		enableCaller: false,                  // 默认禁用调用栈获取（可通过LOG_ENABLE_CALLER开启）
 		callerSkip:   3,                      // 默认调用栈深度
+		format:       FormatJSON,             // 默认JSON格式，便于日志平台解析
+	}
+
+	switch format := strings.ToLower(strings.TrimSpace(os.Getenv("LOG_FORMAT"))); format {
+	case "", FormatJSON:
+	case FormatText:
+		logger.format = FormatText
+	default:
+		fmt.Fprintf(os.Stderr, "未知的日志格式 %s，使用json\n", format)
 	}
 
 	// 从环境变量设置级别
@@ -96,9 +114,12 @@ func createLogger() *Logger {
 		}
 	}
 
-	// 设置文件输出
+	// 设置文件输出（追加写入，可按 LOG_MAX_SIZE_MB / LOG_MAX_BACKUPS / LOG_MAX_AGE_DAYS 轮转）
 	if logFile := os.Getenv("LOG_FILE"); logFile != "" {
-		if file, err := os.OpenFile(logFile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644); err == nil {
+		if file, err := openRotatingFile(logFile,
+			envNonNegativeInt("LOG_MAX_SIZE_MB"),
+			envNonNegativeInt("LOG_MAX_BACKUPS"),
+			envNonNegativeInt("LOG_MAX_AGE_DAYS")); err == nil {
 			logger.logFile = file
 			// 检查是否禁用控制台输出
 			if os.Getenv("LOG_CONSOLE") == "false" {
@@ -118,6 +139,28 @@ func createLogger() *Logger {
 	return logger
 }
 
+// envNonNegativeInt 读取非负整数环境变量，未设置或非法时返回0
+func envNonNegativeInt(key string) int {
+	value := strings.TrimSpace(os.Getenv(key))
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		fmt.Fprintf(os.Stderr, "忽略非法的日志配置 %s=%s\n", key, value)
+		return 0
+	}
+	return n
+}
+
+// String 返回级别名称
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
 // ParseLevel 从字符串解析日志级别
 func ParseLevel(s string) (Level, error) {
 	switch strings.ToUpper(strings.TrimSpace(s)) {
@@ -193,14 +236,26 @@ func (l *Logger) log(level Level, msg string, fields []Field) {
 			field.Key == "func" {
 			continue
 		}
-		entry.Fields[field.Key] = field.Value
+		entry.Fields[field.Key] = fieldRedactor.Load().Value(field.Value)
 	}
 
 	// 使用自定义序列化确保字段顺序
-	jsonData := l.marshalLogEntry(entry)
+	var data, jsonData []byte
+	if l.format != FormatText || ringSink != nil {
+		jsonData = l.marshalLogEntry(entry)
+	}
+	if l.format == FormatText {
+		data = l.formatTextEntry(entry)
+	} else {
+		data = jsonData
+	}
+	// 内存缓冲固定保存JSON格式，供管理后台实时查看
+	if ringSink != nil {
+		ringSink.add(level, string(jsonData))
+	}
 
 	// 直接输出日志 - log.Logger本身已经线程安全！
-	l.logger.Println(string(jsonData))
+	l.logger.Println(string(data))
 
 	// Fatal级别退出程序
 	if level == FATAL {
@@ -265,11 +320,73 @@ func (l *Logger) marshalLogEntry(entry *LogEntry) []byte {
 	return []byte(b.String())
 }
 
+// formatTextEntry 文本格式：timestamp LEVEL [file func] message key=value ...
+func (l *Logger) formatTextEntry(entry *LogEntry) []byte {
+	var b strings.Builder
+
+	b.WriteString(entry.Timestamp)
+	b.WriteString(" ")
+	fmt.Fprintf(&b, "%-5s", entry.Level)
+	if entry.File != "" || entry.Func != "" {
+		b.WriteString(" [")
+		b.WriteString(strings.TrimSpace(entry.File + " " + entry.Func))
+		b.WriteString("]")
+	}
+	b.WriteString(" ")
+	b.WriteString(entry.Message)
+
+	keys := make([]string, 0, len(entry.Fields))
+	for k := range entry.Fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteString(" ")
+		b.WriteString(k)
+		b.WriteString("=")
+		b.WriteString(formatTextValue(entry.Fields[k]))
+	}
+	return []byte(b.String())
+}
+
+// formatTextValue 文本格式的字段值，含空白或引号的字符串加引号
+func formatTextValue(v any) string {
+	switch val := v.(type) {
+	case nil:
+		return "<nil>"
+	case string:
+		if val == "" || strings.ContainsAny(val, " \t\r\n\"=") {
+			return strconv.Quote(val)
+		}
+		return val
+	case fmt.Stringer, error, bool, int, int64, float64:
+		return fmt.Sprint(val)
+	default:
+		if data, err := json.Marshal(val); err == nil {
+			return string(data)
+		}
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+// fieldRedactor 日志字段脱敏规则，未设置时不脱敏（重新初始化 logger 后保留）
+var fieldRedactor atomic.Pointer[redact.Redactor]
+
+// SetRedactor 设置日志字段脱敏规则，字符串字段（含请求/响应体）输出前按规则替换，nil 关闭脱敏
+func SetRedactor(r *redact.Redactor) {
+	fieldRedactor.Store(r)
+}
+
 // SetLevel 设置日志级别（优化：原子操作）
 func SetLevel(level Level) {
 	atomic.StoreInt64(&defaultLogger.level, int64(level))
 }
 
+// GetLevel 返回当前日志级别
+func GetLevel() Level {
+	return Level(atomic.LoadInt64(&defaultLogger.level))
+}
+
 // 全局日志函数
 func Debug(msg string, fields ...Field) {
 	defaultLogger.log(DEBUG, msg, fields)
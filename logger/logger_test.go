@@ -0,0 +1,64 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"kiro2api/redact"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLogger(format string) (*Logger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	return &Logger{
+		level:  int64(DEBUG),
+		logger: log.New(buf, "", 0),
+		format: format,
+	}, buf
+}
+
+func TestLogger_JSONFormat(t *testing.T) {
+	l, buf := newTestLogger(FormatJSON)
+	l.log(INFO, "请求完成", []Field{String("path", "/v1/messages"), Int("status", 200), String("level", "ignored")})
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry))
+	assert.Equal(t, "INFO", entry["level"])
+	assert.Equal(t, "请求完成", entry["message"])
+	assert.Equal(t, "/v1/messages", entry["path"])
+	assert.Equal(t, float64(200), entry["status"])
+}
+
+func TestLogger_TextFormat(t *testing.T) {
+	l, buf := newTestLogger(FormatText)
+	l.log(WARN, "上游超时", []Field{
+		String("model", "claude-sonnet-4"),
+		String("error", "context deadline exceeded"),
+		Duration("elapsed", 1500*time.Millisecond),
+	})
+
+	line := strings.TrimSpace(buf.String())
+	assert.Contains(t, line, " WARN  上游超时 ")
+	assert.True(t, strings.HasSuffix(line, `elapsed=1.5s error="context deadline exceeded" model=claude-sonnet-4`), line)
+}
+
+func TestLogger_RedactsFields(t *testing.T) {
+	r, err := redact.New([]redact.Rule{{Builtin: redact.BuiltinEmail}})
+	require.NoError(t, err)
+	SetRedactor(r)
+	t.Cleanup(func() { SetRedactor(nil) })
+
+	l, buf := newTestLogger(FormatJSON)
+	l.log(DEBUG, "收到请求", []Field{String("body", `{"content":"contact erin@example.com"}`), Int("body_size", 38)})
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(bytes.TrimSpace(buf.Bytes()), &entry))
+	assert.Equal(t, `{"content":"contact [REDACTED_EMAIL]"}`, entry["body"])
+	assert.Equal(t, float64(38), entry["body_size"])
+}
@@ -0,0 +1,150 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rotateTimeFormat 轮转文件名中的时间戳格式
+const rotateTimeFormat = "20060102-150405.000"
+
+// rotatingFile 按大小与保留时长轮转的日志文件写入器
+// 轮转时当前文件重命名为 <name>.<时间戳>，并按 maxBackups/maxAge 清理旧文件
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64         // 单个文件最大字节数，0 表示不按大小轮转
+	maxBackups int           // 保留的历史文件数，0 表示不限
+	maxAge     time.Duration // 历史文件最长保留时间，0 表示不限
+	file       *os.File
+	size       int64
+	now        func() time.Time
+}
+
+// openRotatingFile 以追加方式打开日志文件
+func openRotatingFile(path string, maxSizeMB, maxBackups, maxAgeDays int) (*rotatingFile, error) {
+	r := &rotatingFile{
+		path:       path,
+		maxSize:    int64(maxSizeMB) * 1024 * 1024,
+		maxBackups: maxBackups,
+		maxAge:     time.Duration(maxAgeDays) * 24 * time.Hour,
+		now:        time.Now,
+	}
+	if err := r.openExisting(); err != nil {
+		return nil, err
+	}
+	r.cleanup()
+	return r, nil
+}
+
+// openExisting 打开（或创建）当前日志文件并记录已有大小
+func (r *rotatingFile) openExisting() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+// Write 写入日志，超过大小上限时先轮转
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			fmt.Fprintf(os.Stderr, "日志文件轮转失败 %s: %v\n", r.path, err)
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate 关闭当前文件、重命名为带时间戳的历史文件并重新打开
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	backup := r.path + "." + r.now().Format(rotateTimeFormat)
+	renameErr := os.Rename(r.path, backup)
+	// 无论重命名是否成功都需要重新打开，保证日志不中断
+	if err := r.openExisting(); err != nil {
+		r.file = nil
+		return err
+	}
+	if renameErr != nil {
+		return renameErr
+	}
+	r.cleanup()
+	return nil
+}
+
+// backups 按时间从新到旧返回历史文件
+func (r *rotatingFile) backups() []string {
+	matches, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return nil
+	}
+	prefix := r.path + "."
+	out := matches[:0]
+	for _, name := range matches {
+		if _, err := time.Parse(rotateTimeFormat, strings.TrimPrefix(name, prefix)); err == nil {
+			out = append(out, name)
+		}
+	}
+	// 时间戳格式可直接按字典序比较
+	sort.Sort(sort.Reverse(sort.StringSlice(out)))
+	return out
+}
+
+// cleanup 删除超出数量或保留时长的历史文件
+func (r *rotatingFile) cleanup() {
+	if r.maxBackups <= 0 && r.maxAge <= 0 {
+		return
+	}
+	cutoff := r.now().Add(-r.maxAge)
+	for i, name := range r.backups() {
+		expired := false
+		if r.maxBackups > 0 && i >= r.maxBackups {
+			expired = true
+		}
+		if r.maxAge > 0 {
+			if info, err := os.Stat(name); err == nil && info.ModTime().Before(cutoff) {
+				expired = true
+			}
+		}
+		if expired {
+			if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+				fmt.Fprintf(os.Stderr, "删除历史日志文件失败 %s: %v\n", name, err)
+			}
+		}
+	}
+}
+
+// Close 关闭日志文件
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
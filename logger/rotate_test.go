@@ -0,0 +1,70 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFile_RotatesBySizeAndKeepsBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	r, err := openRotatingFile(path, 0, 2, 0)
+	require.NoError(t, err)
+	defer r.Close()
+	r.maxSize = 10
+
+	clock := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	r.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	for _, line := range []string{"first-1\n", "second\n", "third-\n", "fourth\n"} {
+		_, err := r.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "fourth\n", string(current))
+
+	backups := r.backups()
+	require.Len(t, backups, 2, "超出 maxBackups 的历史文件应被删除")
+	newest, err := os.ReadFile(backups[0])
+	require.NoError(t, err)
+	assert.Equal(t, "third-\n", string(newest))
+}
+
+func TestRotatingFile_AppendsAndExpiresByAge(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+	require.NoError(t, os.WriteFile(path, []byte("existing\n"), 0644))
+
+	old := path + "." + time.Now().Add(-72*time.Hour).Format(rotateTimeFormat)
+	require.NoError(t, os.WriteFile(old, []byte("old\n"), 0644))
+	past := time.Now().Add(-72 * time.Hour)
+	require.NoError(t, os.Chtimes(old, past, past))
+	unrelated := path + ".bak"
+	require.NoError(t, os.WriteFile(unrelated, []byte("keep\n"), 0644))
+
+	r, err := openRotatingFile(path, 1, 0, 1)
+	require.NoError(t, err)
+	_, err = r.Write([]byte("new\n"))
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "existing\nnew\n", string(data), "重启后应追加而不是截断")
+	assert.NoFileExists(t, old)
+	assert.FileExists(t, unrelated)
+
+	_, err = r.Write([]byte("after close\n"))
+	assert.ErrorIs(t, err, os.ErrClosed)
+	assert.False(t, strings.Contains(string(data), "after close"))
+}
@@ -0,0 +1,150 @@
+package logger
+
+import (
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultRingSize 未配置 LOG_BUFFER_SIZE 时内存中保留的日志条数
+const defaultRingSize = 1000
+
+// Record 日志缓冲中的一条记录，Line 为 JSON 格式的日志行（与 LOG_FORMAT 无关）
+type Record struct {
+	Seq   uint64
+	Level Level
+	Line  string
+}
+
+// RingSink 固定容量的内存日志缓冲，支持回看最近日志与订阅实时日志
+// 订阅者消费过慢时丢弃新日志而不是阻塞写日志的调用方
+type RingSink struct {
+	mu          sync.Mutex
+	records     []Record
+	next        int
+	full        bool
+	seq         uint64
+	subscribers map[chan Record]struct{}
+	dropped     atomic.Int64
+}
+
+// NewRingSink 创建日志缓冲，capacity<=0 时返回 nil（不缓冲）
+func NewRingSink(capacity int) *RingSink {
+	if capacity <= 0 {
+		return nil
+	}
+	return &RingSink{
+		records:     make([]Record, capacity),
+		subscribers: make(map[chan Record]struct{}),
+	}
+}
+
+// ringSink 全局日志缓冲（LOG_BUFFER_SIZE，默认1000，0关闭）
+// 独立于 Logger 实例，Reinitialize 后仍保留已缓冲的日志；包初始化时使用默认容量，由 InitSink 按配置调整
+var ringSink = NewRingSink(defaultRingSize)
+
+// InitSink 按 LOG_BUFFER_SIZE 重建全局日志缓冲，保留已缓冲的最近日志
+// 包初始化时 .env 与服务配置文件尚未加载，main 须在加载之后、启动服务之前调用
+func InitSink() {
+	size := ringSizeFromEnv()
+	old := ringSink
+	if old != nil && len(old.records) == size {
+		return
+	}
+	sink := NewRingSink(size)
+	if sink != nil && old != nil {
+		for _, record := range old.Recent(DEBUG, 0, size) {
+			sink.seq = record.Seq
+			sink.records[sink.next] = record
+			sink.next = (sink.next + 1) % len(sink.records)
+			if sink.next == 0 {
+				sink.full = true
+			}
+		}
+	}
+	ringSink = sink
+}
+
+// ringSizeFromEnv 读取 LOG_BUFFER_SIZE
+func ringSizeFromEnv() int {
+	value := os.Getenv("LOG_BUFFER_SIZE")
+	if value == "" {
+		return defaultRingSize
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return defaultRingSize
+	}
+	return n
+}
+
+// Sink 返回全局日志缓冲（未启用时为 nil）
+func Sink() *RingSink {
+	return ringSink
+}
+
+// add 追加一条日志并推送给订阅者
+func (s *RingSink) add(level Level, line string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	record := Record{Seq: s.seq, Level: level, Line: line}
+	s.records[s.next] = record
+	s.next = (s.next + 1) % len(s.records)
+	if s.next == 0 {
+		s.full = true
+	}
+	for ch := range s.subscribers {
+		select {
+		case ch <- record:
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// Recent 按时间顺序返回序号大于 afterSeq 且级别不低于 minLevel 的最近日志，limit<=0 表示不限
+func (s *RingSink) Recent(minLevel Level, afterSeq uint64, limit int) []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ordered := s.records[:s.next]
+	if s.full {
+		ordered = append(append([]Record(nil), s.records[s.next:]...), s.records[:s.next]...)
+	}
+	out := make([]Record, 0, len(ordered))
+	for _, record := range ordered {
+		if record.Seq > afterSeq && record.Level >= minLevel {
+			out = append(out, record)
+		}
+	}
+	if limit > 0 && len(out) > limit {
+		out = out[len(out)-limit:]
+	}
+	return out
+}
+
+// Subscribe 订阅实时日志，返回的 cancel 用于取消订阅并关闭通道
+func (s *RingSink) Subscribe(buffer int) (<-chan Record, func()) {
+	ch := make(chan Record, buffer)
+	s.mu.Lock()
+	s.subscribers[ch] = struct{}{}
+	s.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			s.mu.Lock()
+			delete(s.subscribers, ch)
+			s.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Dropped 返回因订阅者消费过慢而丢弃的日志条数
+func (s *RingSink) Dropped() int64 {
+	return s.dropped.Load()
+}
@@ -0,0 +1,72 @@
+package logger
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRingSink_RecentAndSubscribe(t *testing.T) {
+	assert.Nil(t, NewRingSink(0))
+
+	sink := NewRingSink(3)
+	for i := 1; i <= 5; i++ {
+		level := INFO
+		if i%2 == 0 {
+			level = WARN
+		}
+		sink.add(level, strconv.Itoa(i))
+	}
+
+	lines := func(records []Record) []string {
+		out := make([]string, 0, len(records))
+		for _, r := range records {
+			out = append(out, r.Line)
+		}
+		return out
+	}
+	assert.Equal(t, []string{"3", "4", "5"}, lines(sink.Recent(DEBUG, 0, 0)), "超出容量时保留最新的日志")
+	assert.Equal(t, []string{"4"}, lines(sink.Recent(WARN, 0, 0)))
+	assert.Equal(t, []string{"5"}, lines(sink.Recent(DEBUG, 4, 0)))
+	assert.Equal(t, []string{"4", "5"}, lines(sink.Recent(DEBUG, 0, 2)))
+
+	ch, cancel := sink.Subscribe(1)
+	sink.add(ERROR, "6")
+	sink.add(ERROR, "7") // 缓冲已满，丢弃
+	record := <-ch
+	assert.Equal(t, uint64(6), record.Seq)
+	assert.Equal(t, int64(1), sink.Dropped())
+
+	cancel()
+	cancel()
+	_, open := <-ch
+	require.False(t, open)
+	sink.add(INFO, "8") // 取消订阅后不再推送
+}
+
+func TestInitSink(t *testing.T) {
+	original := ringSink
+	t.Cleanup(func() { ringSink = original })
+
+	ringSink = NewRingSink(defaultRingSize)
+	for i := 1; i <= 4; i++ {
+		ringSink.add(INFO, strconv.Itoa(i))
+	}
+
+	// 按 .env 中的容量重建，保留最近的日志与序号
+	t.Setenv("LOG_BUFFER_SIZE", "2")
+	InitSink()
+	require.NotNil(t, Sink())
+	records := Sink().Recent(DEBUG, 0, 0)
+	require.Len(t, records, 2)
+	assert.Equal(t, "3", records[0].Line)
+	assert.Equal(t, uint64(4), records[1].Seq)
+	Sink().add(INFO, "5")
+	assert.Equal(t, uint64(5), Sink().Recent(DEBUG, 0, 1)[0].Seq)
+
+	t.Setenv("LOG_BUFFER_SIZE", "0")
+	InitSink()
+	assert.Nil(t, Sink())
+}
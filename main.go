@@ -4,20 +4,92 @@ import (
 	"os"
 
 	"kiro2api/auth"
+	"kiro2api/cli"
+	"kiro2api/config"
 	"kiro2api/logger"
 	"kiro2api/server"
+	"kiro2api/utils"
 
 	"github.com/joho/godotenv"
 )
 
 func main() {
+	// 命令行子命令：kiro2api token/config ...（直接管理配置，不启动服务）
+	// 无参数、serve 或旧版的端口参数（kiro2api 8080）启动服务
+	args := os.Args[1:]
+	serve := cli.IsServe(args)
+
 	// 自动加载.env文件
-	if err := godotenv.Load(); err != nil {
+	if err := godotenv.Load(); err != nil && serve {
 		logger.Info("未找到.env文件，使用环境变量")
 	}
 
+	// 通用服务配置文件（YAML/TOML/JSON）：环境变量与.env优先，文件中的值只补充未设置的变量
+	var serverConfigApplied []string
+	var serverConfigErr error
+	serverConfigFile := os.Getenv("SERVER_CONFIG_FILE")
+	if serverConfigFile != "" {
+		serverConfigApplied, serverConfigErr = config.LoadServerConfigFile(serverConfigFile)
+	}
+
 	// 重新初始化logger以使用.env文件中的配置
 	logger.Reinitialize()
+	logger.InitSink()
+
+	if serverConfigErr != nil {
+		logger.Error("启动失败: 加载服务配置文件失败",
+			logger.String("file", serverConfigFile),
+			logger.Err(serverConfigErr))
+		os.Exit(1)
+	}
+	if serverConfigFile != "" && serve {
+		logger.Info("已加载服务配置文件",
+			logger.String("file", serverConfigFile),
+			logger.Int("applied", len(serverConfigApplied)))
+	}
+
+	// 上游基础地址覆盖（指向 kiro2api mockserver 等模拟上游），须在发起任何上游请求之前
+	if err := config.SetUpstreamBaseURL(os.Getenv("UPSTREAM_BASE_URL")); err != nil {
+		logger.Error("启动失败: UPSTREAM_BASE_URL 无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if config.UpstreamBaseURL != "" && serve {
+		logger.Warn("上游已指向自定义地址，仅用于本地开发与测试",
+			logger.String("upstream_base_url", config.UpstreamBaseURL))
+	}
+
+	// 上游熔断阈值（CIRCUIT_BREAKER_*），须在 .env 与服务配置文件加载之后
+	auth.ConfigureUpstreamBreakers()
+
+	if !serve {
+		// 未显式配置日志级别时只输出警告以上的日志，避免干扰命令输出
+		if os.Getenv("LOG_LEVEL") == "" {
+			logger.SetLevel(logger.WARN)
+		}
+		os.Exit(cli.Run(args, os.Stdout, os.Stderr))
+	}
+
+	port, err := cli.ServePort(args)
+	if err != nil {
+		logger.Error("启动失败: 命令行参数无效", logger.Err(err))
+		os.Exit(2)
+	}
+
+	// 启动前一次性加载并校验服务配置，数值无效时列出所有问题后退出
+	serverConfig, err := config.LoadServerConfig()
+	if err != nil {
+		logger.Error("启动失败: 服务配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	serverConfig.Port = port // 命令行端口参数（PORT 环境变量优先，见 cli.ServePort）
+
+	// 按环境变量重建共享的上游 Transport（连接池、HTTP/2、TLS 会话复用），须在发起任何上游请求之前
+	upstreamClient, err := utils.LoadUpstreamClientConfigFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 上游连接池配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	utils.ConfigureUpstreamClient(upstreamClient)
 
 	// 显示当前日志级别设置（仅在DEBUG级别时显示详细信息）
 	// 注意：移除重复的系统字段，这些信息已包含在日志结构中
@@ -34,22 +106,11 @@ func main() {
 		os.Exit(1)
 	}
 
-	port := "8080" // 默认端口
-	if len(os.Args) > 1 {
-		port = os.Args[1]
-	}
-	// 从环境变量获取端口，覆盖命令行参数
-	if envPort := os.Getenv("PORT"); envPort != "" {
-		port = envPort
-	}
-
-	// 从环境变量获取客户端认证token（允许默认值用于开发环境）
-	clientToken := os.Getenv("KIRO_CLIENT_TOKEN")
-	if clientToken == "" {
-		clientToken = "123456" // 默认值，方便开发测试
+	// 客户端认证token允许使用默认值（方便开发测试）
+	if serverConfig.UsingDefaultClientToken() {
 		logger.Warn("未设置KIRO_CLIENT_TOKEN，使用默认值123456")
 		logger.Warn("生产环境请设置强密码: KIRO_CLIENT_TOKEN=your-secure-random-password")
 	}
 
-	server.StartServer(port, clientToken, authService)
+	server.StartServer(serverConfig, authService)
 }
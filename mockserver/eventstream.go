@@ -0,0 +1,37 @@
+package mockserver
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+)
+
+// EventStreamContentType 上游流式响应的内容类型（AWS EventStream 二进制帧）
+const EventStreamContentType = "application/vnd.amazon.eventstream"
+
+// EncodeFrame 编码一个 AWS event-stream 事件帧：
+// 总长度(4) + 头部长度(4) + 前导CRC(4) + 头部 + 负载 + 消息CRC(4)，头部均为字符串类型
+func EncodeFrame(eventType string, payload []byte) []byte {
+	var headers bytes.Buffer
+	for _, h := range [][2]string{
+		{":message-type", "event"},
+		{":event-type", eventType},
+		{":content-type", "application/json"},
+	} {
+		headers.WriteByte(byte(len(h[0])))
+		headers.WriteString(h[0])
+		headers.WriteByte(7) // string
+		_ = binary.Write(&headers, binary.BigEndian, uint16(len(h[1])))
+		headers.WriteString(h[1])
+	}
+
+	totalLen := uint32(12 + headers.Len() + len(payload) + 4)
+	var frame bytes.Buffer
+	_ = binary.Write(&frame, binary.BigEndian, totalLen)
+	_ = binary.Write(&frame, binary.BigEndian, uint32(headers.Len()))
+	_ = binary.Write(&frame, binary.BigEndian, crc32.ChecksumIEEE(frame.Bytes()))
+	frame.Write(headers.Bytes())
+	frame.Write(payload)
+	_ = binary.Write(&frame, binary.BigEndian, crc32.ChecksumIEEE(frame.Bytes()))
+	return frame.Bytes()
+}
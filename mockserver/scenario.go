@@ -0,0 +1,162 @@
+package mockserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"kiro2api/types"
+)
+
+// 内置场景名称，在用户消息中写入 [mock:<名称>] 选择
+const (
+	ScenarioEcho          = "echo"           // 默认：分块回显用户消息
+	ScenarioTool          = "tool"           // 调用请求中的第一个工具（无工具时回退为回显）
+	ScenarioThrottle      = "throttle"       // 429 限流
+	ScenarioContentLength = "content_length" // 400 CONTENT_LENGTH_EXCEEDS_THRESHOLD
+	ScenarioExpired       = "expired"        // 403 token失效
+	ScenarioError         = "error"          // 500 上游内部错误
+)
+
+// Frame 场景中的一个上游事件帧
+type Frame struct {
+	Event   string          `json:"event"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// Scenario 推理端点的预置响应
+// JSON 格式与 server/testdata/sse_conformance 中的用例相同（多余字段忽略），可直接作为场景文件使用
+type Scenario struct {
+	Description string          `json:"description,omitempty"`
+	Status      int             `json:"status,omitempty"` // 非 0 且非 200 时以 Body 作为错误响应返回
+	Body        json.RawMessage `json:"body,omitempty"`
+	Upstream    []Frame         `json:"upstream,omitempty"`
+}
+
+// isError 场景是否返回错误响应而不是事件流
+func (s Scenario) isError() bool {
+	return s.Status != 0 && s.Status != http.StatusOK
+}
+
+// builtinScenarios 与请求内容无关的内置场景（echo 与 tool 按请求生成）
+var builtinScenarios = map[string]Scenario{
+	ScenarioThrottle: {
+		Description: "上游限流",
+		Status:      http.StatusTooManyRequests,
+		Body:        json.RawMessage(`{"__type":"ThrottlingException","message":"Too many requests, please wait before trying again."}`),
+	},
+	ScenarioContentLength: {
+		Description: "输入超过上游长度上限",
+		Status:      http.StatusBadRequest,
+		Body:        json.RawMessage(`{"message":"Input is too long.","reason":"CONTENT_LENGTH_EXCEEDS_THRESHOLD"}`),
+	},
+	ScenarioExpired: {
+		Description: "访问令牌失效",
+		Status:      http.StatusForbidden,
+		Body:        json.RawMessage(`{"message":"The bearer token included in the request is invalid."}`),
+	},
+	ScenarioError: {
+		Description: "上游内部错误",
+		Status:      http.StatusInternalServerError,
+		Body:        json.RawMessage(`{"message":"Encountered an unexpected error when processing the request, please try again."}`),
+	},
+}
+
+// scenarioMarker 用户消息中选择场景的标记
+var scenarioMarker = regexp.MustCompile(`\[mock:([A-Za-z0-9_.-]+)\]`)
+
+// echoChunkRunes 回显场景每个事件帧的字符数
+const echoChunkRunes = 16
+
+// LoadScenarios 读取目录下的 *.json 场景文件，文件名（不含扩展名）即场景名称
+func LoadScenarios(dir string) (map[string]Scenario, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("列出场景文件失败: %w", err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("目录 %s 中没有 *.json 场景文件", dir)
+	}
+	scenarios := make(map[string]Scenario, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取场景文件失败: %w", err)
+		}
+		var scenario Scenario
+		if err := json.Unmarshal(data, &scenario); err != nil {
+			return nil, fmt.Errorf("解析场景文件 %s 失败: %w", filepath.Base(path), err)
+		}
+		if !scenario.isError() && len(scenario.Upstream) == 0 {
+			return nil, fmt.Errorf("场景文件 %s 既没有 upstream 事件也没有错误状态码", filepath.Base(path))
+		}
+		name := strings.ToLower(strings.TrimSuffix(filepath.Base(path), ".json"))
+		scenarios[name] = scenario
+	}
+	return scenarios, nil
+}
+
+// selectScenario 按用户消息中的 [mock:<名称>] 标记选择场景，未标记时使用默认场景
+func (s *Server) selectScenario(req types.CodeWhispererRequest) (string, Scenario, bool) {
+	content := req.ConversationState.CurrentMessage.UserInputMessage.Content
+	name := s.defaultScenario
+	if m := scenarioMarker.FindStringSubmatch(content); m != nil {
+		name = strings.ToLower(m[1])
+	}
+	if scenario, ok := s.scenarios[name]; ok {
+		return name, scenario, true
+	}
+	switch name {
+	case ScenarioEcho:
+		return name, echoScenario(content), true
+	case ScenarioTool:
+		tools := req.ConversationState.CurrentMessage.UserInputMessage.UserInputMessageContext.Tools
+		if len(tools) == 0 {
+			return name, echoScenario(content), true
+		}
+		return name, toolScenario(tools[0].ToolSpecification.Name, s.nextToolUseID()), true
+	}
+	if scenario, ok := builtinScenarios[name]; ok {
+		return name, scenario, true
+	}
+	return name, Scenario{}, false
+}
+
+// echoScenario 分块回显用户消息（去掉场景标记）
+func echoScenario(content string) Scenario {
+	text := []rune("Mock response: " + strings.TrimSpace(scenarioMarker.ReplaceAllString(content, "")))
+	var frames []Frame
+	for len(text) > 0 {
+		n := min(echoChunkRunes, len(text))
+		frames = append(frames, textFrame(string(text[:n])))
+		text = text[n:]
+	}
+	return Scenario{Description: "回显用户消息", Upstream: frames}
+}
+
+// toolScenario 先输出一段文本，再以空参数调用指定工具
+func toolScenario(name, toolUseID string) Scenario {
+	return Scenario{
+		Description: "调用工具",
+		Upstream: []Frame{
+			textFrame("Calling " + name + "."),
+			toolFrame(map[string]any{"name": name, "toolUseId": toolUseID}),
+			toolFrame(map[string]any{"name": name, "toolUseId": toolUseID, "input": "{}"}),
+			toolFrame(map[string]any{"name": name, "toolUseId": toolUseID, "stop": true}),
+		},
+	}
+}
+
+func textFrame(text string) Frame {
+	payload, _ := json.Marshal(map[string]string{"content": text})
+	return Frame{Event: "assistantResponseEvent", Payload: payload}
+}
+
+func toolFrame(fields map[string]any) Frame {
+	payload, _ := json.Marshal(fields)
+	return Frame{Event: "toolUseEvent", Payload: payload}
+}
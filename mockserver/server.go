@@ -0,0 +1,274 @@
+// Package mockserver 模拟 kiro2api 依赖的上游服务（Social/IdC token刷新、流式推理、使用限制查询），
+// 以预置的事件流响应请求，用于无真实账号的本地开发与端到端测试。
+// 配合 UPSTREAM_BASE_URL 使用：kiro2api mockserver 启动模拟上游，再将服务的上游基础地址指向它。
+package mockserver
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"kiro2api/logger"
+	"kiro2api/types"
+)
+
+// InvalidRefreshTokenPrefix 以此前缀开头的 refreshToken 刷新失败，用于模拟失效账号
+const InvalidRefreshTokenPrefix = "invalid"
+
+// MockProfileArn 模拟的 Social 账号 profileArn
+const MockProfileArn = "arn:aws:codewhisperer:us-east-1:000000000000:profile/MOCK"
+
+// Options 模拟上游的配置
+type Options struct {
+	Scenarios       map[string]Scenario // 额外的场景，覆盖同名内置场景
+	DefaultScenario string              // 用户消息未标记场景时使用，默认 echo
+	ChunkDelay      time.Duration       // 事件帧之间的间隔，模拟逐步生成
+	TokenTTL        time.Duration       // 签发的访问令牌有效期，默认1小时
+	UsageLimit      int                 // 使用限制查询返回的额度（次），默认1000
+}
+
+// issuedToken 已签发的访问令牌
+type issuedToken struct {
+	refreshToken string
+	expiresAt    time.Time
+}
+
+// Server 模拟上游服务，实现 http.Handler
+type Server struct {
+	scenarios       map[string]Scenario
+	defaultScenario string
+	chunkDelay      time.Duration
+	tokenTTL        time.Duration
+	usageLimit      int
+	mux             *http.ServeMux
+
+	mu       sync.Mutex
+	tokens   map[string]issuedToken // 访问令牌 -> 签发信息
+	usage    map[string]int         // refreshToken -> 已完成的推理请求数
+	requests [][]byte               // 收到的推理请求体
+	toolSeq  int
+}
+
+// New 创建模拟上游
+func New(opts Options) *Server {
+	s := &Server{
+		scenarios:       make(map[string]Scenario, len(opts.Scenarios)),
+		defaultScenario: strings.ToLower(strings.TrimSpace(opts.DefaultScenario)),
+		chunkDelay:      opts.ChunkDelay,
+		tokenTTL:        opts.TokenTTL,
+		usageLimit:      opts.UsageLimit,
+		tokens:          make(map[string]issuedToken),
+		usage:           make(map[string]int),
+	}
+	for name, scenario := range opts.Scenarios {
+		s.scenarios[strings.ToLower(name)] = scenario
+	}
+	if s.defaultScenario == "" {
+		s.defaultScenario = ScenarioEcho
+	}
+	if s.tokenTTL <= 0 {
+		s.tokenTTL = time.Hour
+	}
+	if s.usageLimit <= 0 {
+		s.usageLimit = 1000
+	}
+
+	s.mux = http.NewServeMux()
+	s.mux.HandleFunc("POST /refreshToken", s.handleSocialRefresh)
+	s.mux.HandleFunc("POST /token", s.handleIdcRefresh)
+	s.mux.HandleFunc("POST /generateAssistantResponse", s.handleGenerate)
+	s.mux.HandleFunc("GET /getUsageLimits", s.handleUsageLimits)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Requests 返回收到的推理请求体（按到达顺序），便于测试断言转换结果
+func (s *Server) Requests() [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([][]byte(nil), s.requests...)
+}
+
+// handleSocialRefresh 模拟 Social 方式的token刷新
+func (s *Server) handleSocialRefresh(w http.ResponseWriter, r *http.Request) {
+	var req types.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "Invalid request body"})
+		return
+	}
+	if strings.HasPrefix(req.RefreshToken, InvalidRefreshTokenPrefix) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"message": "Invalid refresh token provided"})
+		return
+	}
+	writeJSON(w, http.StatusOK, types.RefreshResponse{
+		AccessToken:  s.issue(req.RefreshToken),
+		ExpiresIn:    int(s.tokenTTL.Seconds()),
+		RefreshToken: req.RefreshToken,
+		ProfileArn:   MockProfileArn,
+	})
+}
+
+// handleIdcRefresh 模拟 IdC 方式的token刷新（OIDC CreateToken）
+func (s *Server) handleIdcRefresh(w http.ResponseWriter, r *http.Request) {
+	var req types.IdcRefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	if req.ClientId == "" || req.ClientSecret == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_client"})
+		return
+	}
+	if strings.HasPrefix(req.RefreshToken, InvalidRefreshTokenPrefix) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	writeJSON(w, http.StatusOK, types.RefreshResponse{
+		AccessToken:  s.issue(req.RefreshToken),
+		ExpiresIn:    int(s.tokenTTL.Seconds()),
+		RefreshToken: req.RefreshToken,
+		TokenType:    "Bearer",
+	})
+}
+
+// handleGenerate 模拟流式推理：按场景返回事件流或错误响应
+func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	refreshToken, ok := s.authorize(r)
+	if !ok {
+		writeJSON(w, http.StatusForbidden, builtinScenarios[ScenarioExpired].Body)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "Failed to read request body"})
+		return
+	}
+	var req types.CodeWhispererRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "Improperly formed request."})
+		return
+	}
+
+	name, scenario, ok := s.selectScenario(req)
+	s.mu.Lock()
+	s.requests = append(s.requests, body)
+	s.mu.Unlock()
+	if !ok {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"message": "Unknown mock scenario: " + name})
+		return
+	}
+	logger.Debug("模拟上游推理请求",
+		logger.String("scenario", name),
+		logger.String("model", req.ConversationState.CurrentMessage.UserInputMessage.ModelId),
+		logger.Int("request_size", len(body)))
+
+	if scenario.isError() {
+		writeJSON(w, scenario.Status, scenario.Body)
+		return
+	}
+
+	s.mu.Lock()
+	s.usage[refreshToken]++
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", EventStreamContentType)
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	for i, frame := range scenario.Upstream {
+		if i > 0 && s.chunkDelay > 0 {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(s.chunkDelay):
+			}
+		}
+		if _, err := w.Write(EncodeFrame(frame.Event, frame.Payload)); err != nil {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// handleUsageLimits 模拟使用限制查询：额度固定，已用次数为该账号完成的推理请求数
+func (s *Server) handleUsageLimits(w http.ResponseWriter, r *http.Request) {
+	refreshToken, ok := s.authorize(r)
+	if !ok {
+		writeJSON(w, http.StatusForbidden, builtinScenarios[ScenarioExpired].Body)
+		return
+	}
+	s.mu.Lock()
+	used := s.usage[refreshToken]
+	s.mu.Unlock()
+
+	nextReset := time.Now().AddDate(0, 1, 0).Unix()
+	writeJSON(w, http.StatusOK, types.UsageLimits{
+		Limits: []any{},
+		UsageBreakdownList: []types.UsageBreakdown{{
+			ResourceType:              "AGENTIC_REQUEST",
+			Unit:                      "INVOCATIONS",
+			UsageLimit:                s.usageLimit,
+			UsageLimitWithPrecision:   float64(s.usageLimit),
+			CurrentUsage:              used,
+			CurrentUsageWithPrecision: float64(used),
+			NextDateReset:             float64(nextReset),
+			DisplayName:               "Vibe request",
+			DisplayNamePlural:         "Vibe requests",
+		}},
+		UserInfo:             types.UserInfo{Email: "mock@example.com", UserID: "mock-user"},
+		DaysUntilReset:       30,
+		OverageConfiguration: types.OverageConfig{OverageStatus: "DISABLED"},
+		NextDateReset:        float64(nextReset),
+		SubscriptionInfo:     types.SubscriptionInfo{SubscriptionTitle: "KIRO MOCK", Type: "Q_DEVELOPER_STANDALONE_FREE"},
+	})
+}
+
+// issue 为 refreshToken 签发新的访问令牌
+func (s *Server) issue(refreshToken string) string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	accessToken := "mock-access-" + hex.EncodeToString(buf)
+	s.mu.Lock()
+	s.tokens[accessToken] = issuedToken{refreshToken: refreshToken, expiresAt: time.Now().Add(s.tokenTTL)}
+	s.mu.Unlock()
+	return accessToken
+}
+
+// authorize 校验 Bearer 访问令牌为本服务签发且未过期，返回对应的 refreshToken
+func (s *Server) authorize(r *http.Request) (string, bool) {
+	accessToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return "", false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	issued, ok := s.tokens[accessToken]
+	if !ok || time.Now().After(issued.expiresAt) {
+		return "", false
+	}
+	return issued.refreshToken, true
+}
+
+func (s *Server) nextToolUseID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.toolSeq++
+	return fmt.Sprintf("tooluse_mock%06d", s.toolSeq)
+}
+
+// writeJSON 写入 JSON 响应；json.RawMessage 原样输出
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
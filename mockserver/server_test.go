@@ -0,0 +1,116 @@
+package mockserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func do(s *Server, method, path, token, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+// refresh 以 Social 方式刷新，返回访问令牌
+func refresh(t *testing.T, s *Server, refreshToken string) string {
+	t.Helper()
+	w := do(s, http.MethodPost, "/refreshToken", "", `{"refreshToken":"`+refreshToken+`"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp types.RefreshResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, 3600, resp.ExpiresIn)
+	assert.Equal(t, MockProfileArn, resp.ProfileArn)
+	return resp.AccessToken
+}
+
+func generateBody(content string) string {
+	var req types.CodeWhispererRequest
+	req.ConversationState.CurrentMessage.UserInputMessage.Content = content
+	data, _ := json.Marshal(req)
+	return string(data)
+}
+
+func TestServer_Refresh(t *testing.T) {
+	s := New(Options{})
+	assert.NotEmpty(t, refresh(t, s, "rt-1"))
+
+	w := do(s, http.MethodPost, "/refreshToken", "", `{"refreshToken":"invalid-rt"}`)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = do(s, http.MethodPost, "/token", "", `{"clientId":"c","clientSecret":"s","grantType":"refresh_token","refreshToken":"rt-2"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"tokenType":"Bearer"`)
+
+	w = do(s, http.MethodPost, "/token", "", `{"refreshToken":"rt-2"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid_client")
+}
+
+func TestServer_GenerateAndUsage(t *testing.T) {
+	s := New(Options{})
+	token := refresh(t, s, "rt-1")
+
+	// 未签发的访问令牌返回 403
+	assert.Equal(t, http.StatusForbidden, do(s, http.MethodPost, "/generateAssistantResponse", "unknown", generateBody("hi")).Code)
+
+	w := do(s, http.MethodPost, "/generateAssistantResponse", token, generateBody("hi"))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, EventStreamContentType, w.Header().Get("Content-Type"))
+	// 回显文本按 16 个字符分块
+	expected := append(
+		EncodeFrame("assistantResponseEvent", []byte(`{"content":"Mock response: h"}`)),
+		EncodeFrame("assistantResponseEvent", []byte(`{"content":"i"}`))...)
+	assert.Equal(t, expected, w.Body.Bytes())
+
+	w = do(s, http.MethodPost, "/generateAssistantResponse", token, generateBody("[mock:throttle] hi"))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Contains(t, w.Body.String(), "ThrottlingException")
+
+	w = do(s, http.MethodPost, "/generateAssistantResponse", token, generateBody("[mock:nope]"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Len(t, s.Requests(), 3)
+
+	// 已用次数只统计成功返回事件流的请求
+	w = do(s, http.MethodGet, "/getUsageLimits?resourceType=AGENTIC_REQUEST", token, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var usage types.UsageLimits
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &usage))
+	require.Len(t, usage.UsageBreakdownList, 1)
+	assert.Equal(t, 1000.0, usage.UsageBreakdownList[0].UsageLimitWithPrecision)
+	assert.Equal(t, 1.0, usage.UsageBreakdownList[0].CurrentUsageWithPrecision)
+}
+
+func TestLoadScenarios(t *testing.T) {
+	// 一致性用例可直接作为场景文件
+	scenarios, err := LoadScenarios(filepath.Join("..", "server", "testdata", "sse_conformance"))
+	require.NoError(t, err)
+	require.Contains(t, scenarios, "text_then_tool")
+	assert.Len(t, scenarios["text_then_tool"].Upstream, 5)
+
+	s := New(Options{Scenarios: scenarios, DefaultScenario: "text_then_tool"})
+	w := do(s, http.MethodPost, "/generateAssistantResponse", refresh(t, s, "rt"), generateBody("weather"))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "get_weather")
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "empty.json"), []byte(`{"description":"nothing"}`), 0o600))
+	_, err = LoadScenarios(dir)
+	assert.Error(t, err)
+
+	_, err = LoadScenarios(t.TempDir())
+	assert.Error(t, err)
+}
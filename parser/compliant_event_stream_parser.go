@@ -80,12 +80,10 @@ func (cesp *CompliantEventStreamParser) ParseResponse(streamData []byte) (*Parse
 }
 
 // ParseStream 解析流式数据（增量解析）
+// 损坏的帧被跳过时返回的错误描述跳过原因，事件仍然有效，调用方应继续处理
 func (cesp *CompliantEventStreamParser) ParseStream(data []byte) ([]SSEEvent, error) {
 	// 解析新的消息
 	messages, err := cesp.robustParser.ParseStream(data)
-	if err != nil {
-		logger.Warn("流式解析部分失败", logger.Err(err))
-	}
 
 	var allEvents []SSEEvent
 
@@ -100,7 +98,12 @@ func (cesp *CompliantEventStreamParser) ParseStream(data []byte) ([]SSEEvent, er
 		allEvents = append(allEvents, events...)
 	}
 
-	return allEvents, nil
+	return allEvents, err
+}
+
+// Pending 返回尚未组成完整帧的字节数，上游结束时不为0说明流在帧中途被截断
+func (cesp *CompliantEventStreamParser) Pending() int {
+	return cesp.robustParser.Pending()
 }
 
 // generateSummary 生成解析摘要
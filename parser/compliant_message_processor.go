@@ -85,6 +85,9 @@ func (cmp *CompliantMessageProcessor) registerEventHandlers() {
 		toolManager: cmp.toolManager,
 		aggregator:  cmp.toolDataAggregator,
 	}
+
+	// 响应元数据：提取上游提供的 token 用量
+	cmp.eventHandlers[EventTypes.METADATA_EVENT] = &MetadataEventHandler{}
 }
 
 // ProcessMessage 处理单个消息
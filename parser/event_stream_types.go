@@ -100,6 +100,9 @@ var EventTypes = struct {
 	// 兼容旧格式
 	ASSISTANT_RESPONSE_EVENT string
 	TOOL_USE_EVENT           string
+
+	// 响应元数据（可能携带 token 用量）
+	METADATA_EVENT string
 }{
 	COMPLETION:       "completion",
 	COMPLETION_CHUNK: "completion_chunk",
@@ -115,6 +118,8 @@ var EventTypes = struct {
 
 	ASSISTANT_RESPONSE_EVENT: "assistantResponseEvent",
 	TOOL_USE_EVENT:           "toolUseEvent",
+
+	METADATA_EVENT: "metadataEvent",
 }
 
 // ToolExecution 工具执行状态
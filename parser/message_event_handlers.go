@@ -625,3 +625,58 @@ func (h *LegacyToolUseEventHandler) handleToolCallEvent(message *EventStreamMess
 	// 非stop事件的流式片段处理完成，返回空事件
 	return []SSEEvent{}, nil
 }
+
+// MetadataEventHandler 处理 metadataEvent，提取上游提供的 token 用量
+// 载荷中的用量可能位于 tokenUsage、usage 或顶层（inputTokens/outputTokens）；
+// 提示缓存用量兼容 Bedrock（cacheReadInputTokens/cacheWriteInputTokens）与 Anthropic 的字段名；
+// 没有用量信息时不产生事件，由下游按本地估算计费
+type MetadataEventHandler struct{}
+
+func (h *MetadataEventHandler) Handle(message *EventStreamMessage) ([]SSEEvent, error) {
+	var data map[string]any
+	if err := utils.FastUnmarshal(message.Payload, &data); err != nil {
+		logger.Debug("解析metadataEvent失败", logger.Err(err))
+		return []SSEEvent{}, nil
+	}
+
+	usage := data
+	for _, key := range []string{"tokenUsage", "usage"} {
+		if nested, ok := data[key].(map[string]any); ok {
+			usage = nested
+			break
+		}
+	}
+
+	inputTokens, hasInput := usageNumber(usage, "inputTokens", "input_tokens")
+	outputTokens, hasOutput := usageNumber(usage, "outputTokens", "output_tokens")
+	cacheRead, hasCacheRead := usageNumber(usage, "cacheReadInputTokens", "cache_read_input_tokens")
+	cacheCreation, hasCacheCreation := usageNumber(usage, "cacheWriteInputTokens", "cacheCreationInputTokens", "cache_creation_input_tokens")
+	if !hasInput && !hasOutput && !hasCacheRead && !hasCacheCreation {
+		return []SSEEvent{}, nil
+	}
+
+	usageData := map[string]any{"type": "usage"}
+	if hasInput {
+		usageData["input_tokens"] = inputTokens
+	}
+	if hasOutput {
+		usageData["output_tokens"] = outputTokens
+	}
+	if hasCacheRead {
+		usageData["cache_read_input_tokens"] = cacheRead
+	}
+	if hasCacheCreation {
+		usageData["cache_creation_input_tokens"] = cacheCreation
+	}
+	return []SSEEvent{{Event: "usage", Data: usageData}}, nil
+}
+
+// usageNumber 按候选字段名读取非负整数用量
+func usageNumber(data map[string]any, keys ...string) (int, bool) {
+	for _, key := range keys {
+		if v, ok := data[key].(float64); ok && v >= 0 {
+			return int(v), true
+		}
+	}
+	return 0, false
+}
@@ -337,3 +337,34 @@ func TestLegacyToolUseEventHandler_MemoryLeakPrevention(t *testing.T) {
 
 	t.Log("✅ 内存泄漏预防测试通过")
 }
+
+// TestMetadataEventHandler_Usage 测试从 metadataEvent 中提取上游 token 用量
+func TestMetadataEventHandler_Usage(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		want    map[string]any
+	}{
+		{"tokenUsage", `{"tokenUsage":{"inputTokens":120,"outputTokens":35,"totalTokens":155}}`, map[string]any{"type": "usage", "input_tokens": 120, "output_tokens": 35}},
+		{"usage下划线字段", `{"usage":{"output_tokens":7}}`, map[string]any{"type": "usage", "output_tokens": 7}},
+		{"顶层字段", `{"conversationId":"c1","inputTokens":9}`, map[string]any{"type": "usage", "input_tokens": 9}},
+		{"提示缓存", `{"tokenUsage":{"inputTokens":20,"outputTokens":5,"cacheReadInputTokens":1000,"cacheWriteInputTokens":300}}`, map[string]any{"type": "usage", "input_tokens": 20, "output_tokens": 5, "cache_read_input_tokens": 1000, "cache_creation_input_tokens": 300}},
+		{"无用量", `{"conversationId":"c1"}`, nil},
+		{"非法JSON", `{`, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events, err := (&MetadataEventHandler{}).Handle(&EventStreamMessage{Payload: []byte(tt.payload)})
+			assert.NoError(t, err)
+			if tt.want == nil {
+				assert.Empty(t, events)
+				return
+			}
+			if assert.Len(t, events, 1) {
+				assert.Equal(t, "usage", events[0].Event)
+				assert.Equal(t, tt.want, events[0].Data)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package parser
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"kiro2api/config"
@@ -18,6 +19,10 @@ type RobustEventStreamParser struct {
 	maxErrors    int
 	crcTable     *crc32.Table
 	buffer       *bytes.Buffer // 使用标准库bytes.Buffer替代RingBuffer
+	// consecutiveErrors 自上次成功解析以来的错误数，达到 maxErrors 时记录一次错误日志
+	consecutiveErrors int
+	// skipRemaining 超大帧尚未丢弃的字节数
+	skipRemaining int
 	// 并发访问控制
 	mu sync.RWMutex // 保护并发访问
 }
@@ -32,7 +37,7 @@ func NewRobustEventStreamParser() *RobustEventStreamParser {
 	}
 }
 
-// SetMaxErrors 设置最大错误次数
+// SetMaxErrors 设置连续错误告警阈值（损坏的数据总是跳过，不会中止解析）
 func (rp *RobustEventStreamParser) SetMaxErrors(maxErrors int) {
 	rp.maxErrors = maxErrors
 }
@@ -40,11 +45,20 @@ func (rp *RobustEventStreamParser) SetMaxErrors(maxErrors int) {
 // Reset 重置解析器状态
 func (rp *RobustEventStreamParser) Reset() {
 	rp.errorCount = 0
+	rp.consecutiveErrors = 0
+	rp.skipRemaining = 0
 	if rp.buffer != nil {
 		rp.buffer.Reset()
 	}
 }
 
+// Pending 返回尚未组成完整帧的字节数（包括超大帧未到达的部分），上游结束时不为0说明流在帧中途被截断
+func (rp *RobustEventStreamParser) Pending() int {
+	rp.mu.RLock()
+	defer rp.mu.RUnlock()
+	return rp.buffer.Len() + rp.skipRemaining
+}
+
 // ParseStream 解析流数据并返回消息
 func (rp *RobustEventStreamParser) ParseStream(data []byte) ([]*EventStreamMessage, error) {
 	// 并发访问保护
@@ -76,23 +90,7 @@ func (rp *RobustEventStreamParser) parseSingleMessageWithValidation(data []byte)
 		return nil, 0, NewParseError(fmt.Sprintf("数据长度不匹配: 期望 %d 字节，实际 %d 字节", totalLength, len(data)), nil)
 	}
 
-	// AWS EventStream 格式验证：检查 Prelude CRC
-	if len(data) < 12 {
-		return nil, 0, NewParseError("数据长度不足以包含 Prelude CRC", nil)
-	}
-	// preludeCRC := binary.BigEndian.Uint32(data[8:12])
-
-	// 验证 Prelude CRC（前8字节：totalLength + headerLength）
-	// calculatedPreludeCRC := crc32.Checksum(data[:8], rp.crcTable)
-	// if preludeCRC != calculatedPreludeCRC {
-	// 	logger.Warn("Prelude CRC 校验失败",
-	// 		logger.String("expected_crc", fmt.Sprintf("%08x", preludeCRC)),
-	// 		logger.String("calculated_crc", fmt.Sprintf("%08x", calculatedPreludeCRC)))
-	// 	// 在非严格模式下继续处理
-	// 	if rp.strictMode {
-	// 		return nil, int(totalLength), NewParseError(fmt.Sprintf("Prelude CRC 校验失败: 期望 %08x, 实际 %08x", preludeCRC, calculatedPreludeCRC), nil)
-	// 	}
-	// }
+	// Prelude CRC 与消息 CRC 已在 parseStreamWithBuffer 中校验
 
 	// 验证长度合理性（考虑 Prelude CRC）
 	if totalLength < 16 { // 最小: 4(totalLen) + 4(headerLen) + 4(preludeCRC) + 4(msgCRC) = 16
@@ -119,38 +117,25 @@ func (rp *RobustEventStreamParser) parseSingleMessageWithValidation(data []byte)
 
 	payloadData := data[payloadStart:payloadEnd]
 
-	// 添加详细的payload调试信息
-	logger.Debug("Payload调试信息",
-		// logger.Int("total_length", int(totalLength)),
-		// logger.Int("header_length", int(headerLength)),
-		// logger.String("prelude_crc", fmt.Sprintf("%08x", preludeCRC)),
-		// logger.Int("payload_start", int(payloadStart)),
-		// logger.Int("payload_end", payloadEnd),
-		// logger.Int("payload_len", len(payloadData)),
-		// logger.String("payload_hex", func() string {
-		// 	if len(payloadData) > 20 {
-		// 		return fmt.Sprintf("%x", payloadData[:20]) + "..."
-		// 	}
-		// 	return fmt.Sprintf("%x", payloadData)
-		// }()),
-		logger.String("payload_raw", func() string {
-			return string(payloadData)
-		}()))
-
-	// CRC 校验（消息 CRC 覆盖整个消息除了最后4字节）
-	// expectedCRC := binary.BigEndian.Uint32(data[payloadEnd:totalLength])
-	// calculatedCRC := crc32.Checksum(data[:payloadEnd], rp.crcTable)
-
-	// if expectedCRC != calculatedCRC {
-	// 	err := NewParseError(fmt.Sprintf("CRC 校验失败: 期望 %08x, 实际 %08x", expectedCRC, calculatedCRC), nil)
-	// 	if rp.strictMode {
-	// 		return nil, int(totalLength), err
-	// 	} else {
-	// 		logger.Warn("CRC校验失败但继续处理",
-	// 			logger.String("expected_crc", fmt.Sprintf("%08x", expectedCRC)),
-	// 			logger.String("calculated_crc", fmt.Sprintf("%08x", calculatedCRC)))
-	// 	}
-	// }
+	// 添加详细的payload调试信息（仅DEBUG级别时转换，避免每条消息多一次拷贝）
+	if logger.GetLevel() <= logger.DEBUG {
+		logger.Debug("Payload调试信息",
+			// logger.Int("total_length", int(totalLength)),
+			// logger.Int("header_length", int(headerLength)),
+			// logger.String("prelude_crc", fmt.Sprintf("%08x", preludeCRC)),
+			// logger.Int("payload_start", int(payloadStart)),
+			// logger.Int("payload_end", payloadEnd),
+			// logger.Int("payload_len", len(payloadData)),
+			// logger.String("payload_hex", func() string {
+			// 	if len(payloadData) > 20 {
+			// 		return fmt.Sprintf("%x", payloadData[:20]) + "..."
+			// 	}
+			// 	return fmt.Sprintf("%x", payloadData)
+			// }()),
+			logger.String("payload_raw", func() string {
+				return string(payloadData)
+			}()))
+	}
 
 	// 解析头部 - 支持空头部的容错处理和断点续传
 	var headers map[string]HeaderValue
@@ -342,7 +327,16 @@ func (rp *RobustEventStreamParser) isValidToolUseIdFormat(toolUseId string) bool
 	return true
 }
 
+// preludeLength AWS EventStream prelude（totalLength + headerLength + preludeCRC）长度
+const preludeLength = 12
+
 // parseStreamWithBuffer 使用bytes.Buffer解析流数据
+// 帧可能跨多次读取到达，不完整的帧留在缓冲区等待后续数据；损坏的数据按以下方式跳过后继续解析：
+//   - prelude CRC 不匹配或长度字段异常：逐字节向后查找下一个 prelude 校验通过的位置（重新同步）
+//   - 消息 CRC 不匹配：丢弃整帧
+//   - 超过 EventStreamMaxMessageSize 的帧：丢弃整帧（跨读取记录剩余待丢弃字节数）
+//
+// 返回本次解析出的消息；本次有数据被跳过时同时返回描述原因的错误，调用方应记录后继续使用返回的消息
 func (rp *RobustEventStreamParser) parseStreamWithBuffer(data []byte) ([]*EventStreamMessage, error) {
 	// 写入新数据到缓冲区
 	_, err := rp.buffer.Write(data)
@@ -352,67 +346,108 @@ func (rp *RobustEventStreamParser) parseStreamWithBuffer(data []byte) ([]*EventS
 	}
 
 	messages := make([]*EventStreamMessage, 0, 8)
+	var skipped []error
+	skip := func(err error) {
+		rp.errorCount++
+		rp.consecutiveErrors++
+		if rp.consecutiveErrors == rp.maxErrors {
+			logger.Error("事件流连续出现损坏数据", logger.Int("consecutive_errors", rp.consecutiveErrors), logger.Err(err))
+		}
+		skipped = append(skipped, err)
+	}
 
 	for {
-		// 查看可用数据
-		available := rp.buffer.Len()
-		if available < config.EventStreamMinMessageSize {
-			break
+		// 丢弃超大帧尚未到达的剩余部分
+		if rp.skipRemaining > 0 {
+			n := min(rp.skipRemaining, rp.buffer.Len())
+			rp.buffer.Next(n)
+			rp.skipRemaining -= n
+			if rp.skipRemaining > 0 {
+				break
+			}
 		}
 
-		// 查看消息头（不移除数据）
 		bufferBytes := rp.buffer.Bytes()
 		if len(bufferBytes) < config.EventStreamMinMessageSize {
 			break
 		}
 
-		// 解析消息长度
-		totalLength := binary.BigEndian.Uint32(bufferBytes[:4])
+		totalLength, ok := rp.validPrelude(bufferBytes)
+		if !ok {
+			n := rp.resync(bufferBytes)
+			rp.buffer.Next(n)
+			skip(fmt.Errorf("跳过 %d 字节无效数据（prelude 校验失败）", n))
+			continue
+		}
 
-		// 验证长度合理性
-		if totalLength < config.EventStreamMinMessageSize || totalLength > config.EventStreamMaxMessageSize {
-			// 跳过无效数据（丢弃1字节）
-			rp.buffer.Next(1)
-			rp.errorCount++
-			logger.Warn("跳过无效消息头",
-				logger.Int("total_length", int(totalLength)))
+		if totalLength > config.EventStreamMaxMessageSize {
+			rp.skipRemaining = totalLength
+			skip(fmt.Errorf("跳过超大消息: %d 字节", totalLength))
 			continue
 		}
 
-		// 检查是否有足够的数据
-		if available < int(totalLength) {
-			// 等待更多数据
+		// 检查是否有足够的数据，不足时等待下一次读取
+		if len(bufferBytes) < totalLength {
 			break
 		}
 
-		// 读取完整消息
-		messageData := make([]byte, totalLength)
-		n, err := rp.buffer.Read(messageData)
-		if err != nil || n != int(totalLength) {
-			logger.Error("读取消息失败",
-				logger.Int("expected", int(totalLength)),
-				logger.Int("actual", n),
-				logger.Err(err))
-			break
+		// 直接引用缓冲区中的完整消息（下一次写入前有效），避免整条消息的拷贝
+		messageData := rp.buffer.Next(totalLength)
+
+		expectedCRC := binary.BigEndian.Uint32(messageData[totalLength-4:])
+		if crc32.Checksum(messageData[:totalLength-4], rp.crcTable) != expectedCRC {
+			skip(fmt.Errorf("丢弃消息 CRC 校验失败的帧: %d 字节", totalLength))
+			continue
 		}
 
 		// 解析消息
 		message, _, err := rp.parseSingleMessageWithValidation(messageData)
 		if err != nil {
-			logger.Warn("消息解析失败", logger.Err(err))
-			rp.errorCount++
+			skip(fmt.Errorf("消息解析失败: %w", err))
 			continue
 		}
+		rp.consecutiveErrors = 0
 
 		if message != nil {
+			// 返回的消息在后续写入后仍需可用，只拷贝负载部分
+			message.Payload = bytes.Clone(message.Payload)
 			messages = append(messages, message)
 		}
 	}
 
-	// 检查错误计数
-	if rp.errorCount >= rp.maxErrors {
-		return messages, fmt.Errorf("错误次数过多 (%d)，停止解析", rp.errorCount)
+	if len(skipped) > 0 {
+		logger.Warn("事件流存在损坏数据，已跳过",
+			logger.Int("skipped", len(skipped)),
+			logger.Int("parsed", len(messages)),
+			logger.Int("total_errors", rp.errorCount))
+		return messages, errors.Join(skipped...)
 	}
-
 	return messages, nil
 }
+
+// validPrelude 校验 data 开头的 prelude（CRC 与长度字段），通过时返回消息总长度
+func (rp *RobustEventStreamParser) validPrelude(data []byte) (int, bool) {
+	if len(data) < preludeLength {
+		return 0, false
+	}
+	totalLength := binary.BigEndian.Uint32(data[0:4])
+	headerLength := binary.BigEndian.Uint32(data[4:8])
+	if crc32.Checksum(data[:8], rp.crcTable) != binary.BigEndian.Uint32(data[8:12]) {
+		return 0, false
+	}
+	if totalLength < config.EventStreamMinMessageSize || headerLength > totalLength-config.EventStreamMinMessageSize {
+		return 0, false
+	}
+	return int(totalLength), true
+}
+
+// resync 查找下一个 prelude 校验通过的位置，返回需要丢弃的字节数（至少为1）
+// 剩余数据不足一个 prelude 时保留末尾可能是帧开头的字节，等待后续数据
+func (rp *RobustEventStreamParser) resync(data []byte) int {
+	for i := 1; i+preludeLength <= len(data); i++ {
+		if _, ok := rp.validPrelude(data[i:]); ok {
+			return i
+		}
+	}
+	return max(1, len(data)-preludeLength+1)
+}
@@ -0,0 +1,179 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"testing"
+
+	"kiro2api/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// buildTestFrame 构造带正确 prelude CRC 与消息 CRC 的事件流帧
+func buildTestFrame(eventType string, payload []byte) []byte {
+	var headers []byte
+	headers = append(headers, buildSimpleStringHeader(":message-type", "event")...)
+	headers = append(headers, buildSimpleStringHeader(":event-type", eventType)...)
+	headers = append(headers, buildSimpleStringHeader(":content-type", "application/json")...)
+
+	frame := make([]byte, 12, 12+len(headers)+len(payload)+4)
+	binary.BigEndian.PutUint32(frame[0:4], uint32(cap(frame)))
+	binary.BigEndian.PutUint32(frame[4:8], uint32(len(headers)))
+	binary.BigEndian.PutUint32(frame[8:12], crc32.ChecksumIEEE(frame[:8]))
+	frame = append(frame, headers...)
+	frame = append(frame, payload...)
+	return binary.BigEndian.AppendUint32(frame, crc32.ChecksumIEEE(frame))
+}
+
+// testFrames 三条有效的 assistantResponseEvent 帧
+func testFrames() [][]byte {
+	return [][]byte{
+		buildTestFrame("assistantResponseEvent", []byte(`{"content":"one"}`)),
+		buildTestFrame("assistantResponseEvent", []byte(`{"content":"two"}`)),
+		buildTestFrame("assistantResponseEvent", []byte(`{"content":"three"}`)),
+	}
+}
+
+// parseInChunks 按给定大小分块喂给解析器，返回所有消息负载与是否出现过错误
+func parseInChunks(t *testing.T, data []byte, chunkSize int) ([]string, bool) {
+	t.Helper()
+	rp := NewRobustEventStreamParser()
+	var payloads []string
+	var sawErr bool
+	for len(data) > 0 {
+		n := min(chunkSize, len(data))
+		messages, err := rp.ParseStream(data[:n])
+		data = data[n:]
+		sawErr = sawErr || err != nil
+		for _, m := range messages {
+			payloads = append(payloads, string(m.Payload))
+		}
+	}
+	return payloads, sawErr
+}
+
+func TestRobustParser_FramesSplitAcrossReads(t *testing.T) {
+	stream := bytes.Join(testFrames(), nil)
+	want := []string{`{"content":"one"}`, `{"content":"two"}`, `{"content":"three"}`}
+
+	for chunkSize := 1; chunkSize <= len(stream); chunkSize++ {
+		payloads, sawErr := parseInChunks(t, stream, chunkSize)
+		require.Equal(t, want, payloads, "chunk size %d", chunkSize)
+		assert.False(t, sawErr, "chunk size %d", chunkSize)
+	}
+}
+
+func TestRobustParser_SkipsCorruptData(t *testing.T) {
+	frames := testFrames()
+
+	badCRC := bytes.Clone(frames[1])
+	badCRC[len(badCRC)-6] ^= 0xff // 破坏负载，消息 CRC 不再匹配
+
+	badLength := bytes.Clone(frames[1])
+	binary.BigEndian.PutUint32(badLength[0:4], 1<<20) // 长度字段被改写，prelude CRC 不再匹配
+
+	tests := []struct {
+		name   string
+		stream []byte
+		want   []string
+	}{
+		{
+			name:   "开头的垃圾数据",
+			stream: bytes.Join([][]byte{[]byte("garbage-before-first-frame"), frames[0], frames[2]}, nil),
+			want:   []string{`{"content":"one"}`, `{"content":"three"}`},
+		},
+		{
+			name:   "帧之间的垃圾数据",
+			stream: bytes.Join([][]byte{frames[0], {0, 0, 0, 0x20, 1, 2, 3}, frames[1], frames[2]}, nil),
+			want:   []string{`{"content":"one"}`, `{"content":"two"}`, `{"content":"three"}`},
+		},
+		{
+			name:   "消息 CRC 不匹配只丢弃该帧",
+			stream: bytes.Join([][]byte{frames[0], badCRC, frames[2]}, nil),
+			want:   []string{`{"content":"one"}`, `{"content":"three"}`},
+		},
+		{
+			name:   "长度字段损坏不吞掉后续帧",
+			stream: bytes.Join([][]byte{frames[0], badLength, frames[2]}, nil),
+			want:   []string{`{"content":"one"}`, `{"content":"three"}`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, chunkSize := range []int{1, 7, 64, len(tt.stream)} {
+				payloads, sawErr := parseInChunks(t, tt.stream, chunkSize)
+				assert.Equal(t, tt.want, payloads, "chunk size %d", chunkSize)
+				assert.True(t, sawErr, "跳过数据时应返回错误")
+			}
+		})
+	}
+}
+
+func TestRobustParser_SkipsOversizedFrame(t *testing.T) {
+	frames := testFrames()
+
+	// prelude 校验通过但超过最大消息长度的帧，整帧跨多次读取丢弃
+	size := config.EventStreamMaxMessageSize + 1024
+	oversized := make([]byte, size)
+	binary.BigEndian.PutUint32(oversized[0:4], uint32(size))
+	binary.BigEndian.PutUint32(oversized[4:8], 0)
+	binary.BigEndian.PutUint32(oversized[8:12], crc32.ChecksumIEEE(oversized[:8]))
+
+	stream := bytes.Join([][]byte{frames[0], oversized, frames[2]}, nil)
+	payloads, sawErr := parseInChunks(t, stream, 1<<20)
+	assert.Equal(t, []string{`{"content":"one"}`, `{"content":"three"}`}, payloads)
+	assert.True(t, sawErr)
+}
+
+func TestCompliantParser_IgnoresUnknownEventType(t *testing.T) {
+	stream := bytes.Join([][]byte{
+		buildTestFrame("someFutureEvent", []byte(`{"foo":"bar"}`)),
+		buildTestFrame("assistantResponseEvent", []byte(`{"content":"hello"}`)),
+	}, nil)
+
+	p := NewCompliantEventStreamParser()
+	events, err := p.ParseStream(stream)
+	require.NoError(t, err)
+
+	var text string
+	for _, e := range events {
+		if data, ok := e.Data.(map[string]any); ok && data["type"] == "content_block_delta" {
+			if delta, ok := data["delta"].(map[string]any); ok {
+				text += delta["text"].(string)
+			}
+		}
+	}
+	assert.Equal(t, "hello", text)
+}
+
+// FuzzRobustEventStreamParser 任意输入不应 panic，且同一输入无论如何分块解析出的消息都相同
+func FuzzRobustEventStreamParser(f *testing.F) {
+	frames := testFrames()
+	stream := bytes.Join(frames, nil)
+	f.Add(stream, uint16(0))
+	f.Add(stream, uint16(len(frames[0])/2))
+	f.Add(stream[:len(stream)-3], uint16(10))
+	f.Add(append([]byte("garbage"), stream...), uint16(5))
+	f.Add(buildTestFrame("toolUseEvent", []byte(`{"name":"x","toolUseId":"tooluse_1","input":"{","stop":true}`)), uint16(13))
+	f.Add([]byte{0, 0, 0, 16, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}, uint16(4))
+
+	f.Fuzz(func(t *testing.T, data []byte, split uint16) {
+		whole, _ := NewRobustEventStreamParser().ParseStream(data)
+
+		rp := NewRobustEventStreamParser()
+		cut := int(split) % (len(data) + 1)
+		first, _ := rp.ParseStream(data[:cut])
+		second, _ := rp.ParseStream(data[cut:])
+		parts := append(first, second...)
+
+		require.Len(t, parts, len(whole))
+		for i := range whole {
+			assert.Equal(t, whole[i].Payload, parts[i].Payload)
+			assert.Equal(t, whole[i].EventType, parts[i].EventType)
+		}
+	})
+}
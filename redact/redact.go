@@ -0,0 +1,157 @@
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 内置规则名称
+const (
+	BuiltinEmail  = "email"   // 邮箱地址
+	BuiltinAPIKey = "api_key" // sk-/AKIA 等常见 API 密钥与 Bearer 令牌
+)
+
+// builtinPatterns 内置规则的正则与默认替换文本
+var builtinPatterns = map[string]struct {
+	pattern     string
+	replacement string
+}{
+	BuiltinEmail: {`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`, "[REDACTED_EMAIL]"},
+	BuiltinAPIKey: {
+		`\b(?:sk|pk|rk)-[A-Za-z0-9_-]{16,}|\bAKIA[0-9A-Z]{16}\b|(?i:bearer)\s+[A-Za-z0-9._~+/=-]{8,}`,
+		"[REDACTED_API_KEY]",
+	},
+}
+
+// Rule 脱敏规则，Builtin 与 Pattern 二选一
+type Rule struct {
+	Name        string `json:"name" yaml:"name"`
+	Builtin     string `json:"builtin,omitempty" yaml:"builtin,omitempty"`         // 内置规则名称（email、api_key）
+	Pattern     string `json:"pattern,omitempty" yaml:"pattern,omitempty"`         // 自定义正则（RE2 语法）
+	Replacement string `json:"replacement,omitempty" yaml:"replacement,omitempty"` // 替换文本，可引用分组（$1），为空时使用默认值
+}
+
+// rulesFile 规则文件结构
+type rulesFile struct {
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+// compiledRule 编译后的规则
+type compiledRule struct {
+	name        string
+	re          *regexp.Regexp
+	replacement string
+}
+
+// Redactor 按规则顺序依次替换匹配内容
+type Redactor struct {
+	rules []compiledRule
+}
+
+// New 编译脱敏规则
+func New(rules []Rule) (*Redactor, error) {
+	r := &Redactor{rules: make([]compiledRule, 0, len(rules))}
+	for i, rule := range rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rules[%d]", i)
+		}
+
+		pattern, replacement := rule.Pattern, rule.Replacement
+		switch {
+		case rule.Builtin != "" && rule.Pattern != "":
+			return nil, fmt.Errorf("规则 %s 不能同时设置 builtin 与 pattern", name)
+		case rule.Builtin != "":
+			builtin, ok := builtinPatterns[rule.Builtin]
+			if !ok {
+				return nil, fmt.Errorf("规则 %s 的内置规则不存在: %s", name, rule.Builtin)
+			}
+			pattern = builtin.pattern
+			if replacement == "" {
+				replacement = builtin.replacement
+			}
+		case rule.Pattern == "":
+			return nil, fmt.Errorf("规则 %s 必须设置 builtin 或 pattern", name)
+		}
+		if replacement == "" {
+			replacement = "[REDACTED]"
+		}
+
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("规则 %s 的正则无效: %w", name, err)
+		}
+		r.rules = append(r.rules, compiledRule{name: name, re: re, replacement: replacement})
+	}
+	return r, nil
+}
+
+// LoadFile 读取脱敏规则文件（.yaml/.yml 按 YAML 解析，其余按 JSON）
+func LoadFile(path string) (*Redactor, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取脱敏规则文件失败: %w", err)
+	}
+
+	var file rulesFile
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &file)
+	default:
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析脱敏规则文件失败: %w", err)
+	}
+	return New(file.Rules)
+}
+
+// String 脱敏文本，Redactor 为 nil 时原样返回
+func (r *Redactor) String(text string) string {
+	if r == nil {
+		return text
+	}
+	for _, rule := range r.rules {
+		text = rule.re.ReplaceAllString(text, rule.replacement)
+	}
+	return text
+}
+
+// Value 递归脱敏 JSON 风格的值（string、map[string]any、[]any），其他类型原样返回
+func (r *Redactor) Value(v any) any {
+	if r == nil {
+		return v
+	}
+	switch val := v.(type) {
+	case string:
+		return r.String(val)
+	case map[string]any:
+		out := make(map[string]any, len(val))
+		for k, item := range val {
+			out[k] = r.Value(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(val))
+		for i, item := range val {
+			out[i] = r.Value(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
+
+// Len 返回规则数量
+func (r *Redactor) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.rules)
+}
@@ -0,0 +1,78 @@
+package redact
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactor_BuiltinAndCustomRules(t *testing.T) {
+	r, err := New([]Rule{
+		{Name: "email", Builtin: BuiltinEmail},
+		{Name: "keys", Builtin: BuiltinAPIKey, Replacement: "<key>"},
+		{Name: "ssn", Pattern: `(\d{3})-\d{2}-\d{4}`, Replacement: "$1-**-****"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, r.Len())
+
+	text := `{"content":"mail alice@example.com, key sk-abcdefghijklmnop1234, auth Bearer eyJhbGciOi.x, ssn 123-45-6789"}`
+	assert.Equal(t,
+		`{"content":"mail [REDACTED_EMAIL], key <key>, auth <key>, ssn 123-**-****"}`,
+		r.String(text))
+}
+
+func TestRedactor_Value(t *testing.T) {
+	r, err := New([]Rule{{Builtin: BuiltinEmail}})
+	require.NoError(t, err)
+
+	got := r.Value(map[string]any{
+		"user":  "bob@example.org",
+		"items": []any{"carol@example.net", 3},
+		"count": 2,
+	})
+	assert.Equal(t, map[string]any{
+		"user":  "[REDACTED_EMAIL]",
+		"items": []any{"[REDACTED_EMAIL]", 3},
+		"count": 2,
+	}, got)
+
+	var none *Redactor
+	assert.Equal(t, "bob@example.org", none.String("bob@example.org"), "nil 时不脱敏")
+}
+
+func TestNew_InvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule Rule
+	}{
+		{"未设置规则", Rule{Name: "empty"}},
+		{"同时设置builtin与pattern", Rule{Builtin: BuiltinEmail, Pattern: "x"}},
+		{"内置规则不存在", Rule{Builtin: "phone"}},
+		{"正则无效", Rule{Pattern: "("}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New([]Rule{tt.rule})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLoadFile_YAML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+rules:
+  - name: email
+    builtin: email
+    replacement: "[email]"
+  - name: order-id
+    pattern: "ORD-[0-9]+"
+`), 0o644))
+
+	r, err := LoadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "[email] [REDACTED]", r.String("dave@example.com ORD-42"))
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"kiro2api/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errCancelledByAdmin 请求被管理员通过 DELETE /api/requests/active/:id 取消
+var errCancelledByAdmin = errors.New("请求已被管理员取消")
+
+// activeRequestKey gin 上下文中当前请求登记项的键
+const activeRequestKey = "active_request"
+
+// slotLeasesKey 请求选择token时预留的账号并发名额（见 holdSlotLease）
+const slotLeasesKey = "slot_leases"
+
+// activeRequests 进行中的 /v1 请求登记表
+var activeRequests = NewRequestRegistry()
+
+// activeRequest 进行中请求的登记项，模型与token在发起上游请求时补充
+type activeRequest struct {
+	id        string
+	method    string
+	path      string
+	clientKey string
+	startedAt time.Time
+	cancel    context.CancelCauseFunc
+	written   atomic.Int64
+
+	mu      sync.Mutex
+	model   string
+	tokenID string
+	stream  bool
+}
+
+// ActiveRequestInfo 进行中请求的快照
+type ActiveRequestInfo struct {
+	ID           string    `json:"id"`
+	Method       string    `json:"method"`
+	Path         string    `json:"path"`
+	Model        string    `json:"model,omitempty"`
+	Stream       bool      `json:"stream"`
+	ClientKey    string    `json:"client_key,omitempty"`
+	TokenID      string    `json:"token_id,omitempty"`
+	StartedAt    time.Time `json:"started_at"`
+	AgeMs        int64     `json:"age_ms"`
+	BytesWritten int64     `json:"bytes_written"`
+}
+
+func (r *activeRequest) info(now time.Time) ActiveRequestInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return ActiveRequestInfo{
+		ID:           r.id,
+		Method:       r.method,
+		Path:         r.path,
+		Model:        r.model,
+		Stream:       r.stream,
+		ClientKey:    r.clientKey,
+		TokenID:      r.tokenID,
+		StartedAt:    r.startedAt,
+		AgeMs:        now.Sub(r.startedAt).Milliseconds(),
+		BytesWritten: r.written.Load(),
+	}
+}
+
+// RequestRegistry 进程内进行中请求的登记表，供管理后台查看与取消卡住的生成
+type RequestRegistry struct {
+	mu      sync.Mutex
+	entries map[*activeRequest]struct{}
+}
+
+// NewRequestRegistry 创建请求登记表
+func NewRequestRegistry() *RequestRegistry {
+	return &RequestRegistry{entries: make(map[*activeRequest]struct{})}
+}
+
+func (r *RequestRegistry) add(entry *activeRequest) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.entries[entry] = struct{}{}
+}
+
+func (r *RequestRegistry) remove(entry *activeRequest) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.entries, entry)
+}
+
+// List 返回进行中的请求，按已运行时长从长到短排序
+func (r *RequestRegistry) List() []ActiveRequestInfo {
+	now := time.Now()
+	r.mu.Lock()
+	list := make([]ActiveRequestInfo, 0, len(r.entries))
+	for entry := range r.entries {
+		list = append(list, entry.info(now))
+	}
+	r.mu.Unlock()
+
+	slices.SortFunc(list, func(a, b ActiveRequestInfo) int {
+		return a.StartedAt.Compare(b.StartedAt)
+	})
+	return list
+}
+
+// Cancel 取消请求ID对应的进行中请求（客户端自带的 X-Request-ID 可能重复，全部取消），返回取消的数量
+func (r *RequestRegistry) Cancel(id string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	cancelled := 0
+	for entry := range r.entries {
+		if entry.id == id {
+			entry.cancel(errCancelledByAdmin)
+			cancelled++
+		}
+	}
+	return cancelled
+}
+
+// ActiveRequestMiddleware 登记进行中的 /v1 POST 请求（需位于请求ID与认证中间件之后）
+// 请求绑定可由管理员取消的上下文，取消后上游请求随之中止
+func ActiveRequestMiddleware(registry *RequestRegistry, prefixes []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method != http.MethodPost || !requiresAuth(c.Request.URL.Path, prefixes) {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithCancelCause(c.Request.Context())
+		defer cancel(nil)
+		c.Request = c.Request.WithContext(ctx)
+
+		entry := &activeRequest{
+			id:        GetRequestID(c),
+			method:    c.Request.Method,
+			path:      c.Request.URL.Path,
+			clientKey: GetClientKeyID(c),
+			startedAt: time.Now(),
+			cancel:    cancel,
+		}
+		c.Writer = &countingWriter{ResponseWriter: c.Writer, written: &entry.written}
+		c.Set(activeRequestKey, entry)
+
+		registry.add(entry)
+		defer registry.remove(entry)
+		defer cancelSlotLeases(c)
+		c.Next()
+	}
+}
+
+// noteActiveRequest 发起上游请求时补充登记项的模型与token（切换token重试时更新为新token）
+func noteActiveRequest(c *gin.Context, model, tokenID string, stream bool) {
+	value, ok := c.Get(activeRequestKey)
+	if !ok {
+		return
+	}
+	entry := value.(*activeRequest)
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	entry.model = model
+	entry.tokenID = tokenID
+	entry.stream = stream
+}
+
+// cancelledByAdmin 请求是否被管理员取消
+func cancelledByAdmin(c *gin.Context) bool {
+	return c.Request != nil && errors.Is(context.Cause(c.Request.Context()), errCancelledByAdmin)
+}
+
+// respondCancelledByAdmin 非流式请求被管理员取消时返回503
+func respondCancelledByAdmin(c *gin.Context) {
+	respondErrorWithCode(c, http.StatusServiceUnavailable, streamErrCancelled, "%s", errCancelledByAdmin.Error())
+}
+
+// countingWriter 统计写给客户端的响应体字节数
+type countingWriter struct {
+	gin.ResponseWriter
+	written *atomic.Int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.written.Add(int64(n))
+	return n, err
+}
+
+func (w *countingWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	w.written.Add(int64(n))
+	return n, err
+}
+
+// handleListActiveRequests 返回进行中的 /v1 请求
+func handleListActiveRequests(c *gin.Context) {
+	list := activeRequests.List()
+	c.JSON(http.StatusOK, gin.H{
+		"requests": list,
+		"count":    len(list),
+	})
+}
+
+// handleCancelActiveRequest 取消进行中的请求，上游请求随之中止；
+// 流式响应以 request_cancelled 错误事件结束，非流式请求返回503 request_cancelled
+func handleCancelActiveRequest(c *gin.Context) {
+	id := c.Param("id")
+	cancelled := activeRequests.Cancel(id)
+	if cancelled == 0 {
+		respondErrorWithCode(c, http.StatusNotFound, "request_not_found", "请求不存在或已结束: %s", id)
+		return
+	}
+	logger.Warn("管理员取消进行中的请求",
+		logger.String("target_request_id", id),
+		logger.Int("cancelled", cancelled))
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"id":        id,
+		"cancelled": cancelled,
+	})
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestActiveRequestRegistry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	registry := NewRequestRegistry()
+
+	entered := make(chan struct{})
+	var cause error
+	r := gin.New()
+	r.Use(RequestIDMiddleware())
+	r.Use(ActiveRequestMiddleware(registry, []string{"/v1"}))
+	r.POST("/v1/messages", func(c *gin.Context) {
+		noteActiveRequest(c, "claude-sonnet-4-20250514", "account-1", true)
+		_, _ = c.Writer.WriteString("partial")
+		close(entered)
+		<-c.Request.Context().Done()
+		cause = context.Cause(c.Request.Context())
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+		req.Header.Set("X-Request-ID", "req_stuck")
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	<-entered
+
+	list := registry.List()
+	require.Len(t, list, 1)
+	assert.Equal(t, "req_stuck", list[0].ID)
+	assert.Equal(t, "claude-sonnet-4-20250514", list[0].Model)
+	assert.Equal(t, "account-1", list[0].TokenID)
+	assert.True(t, list[0].Stream)
+	assert.Equal(t, int64(len("partial")), list[0].BytesWritten)
+
+	assert.Equal(t, 0, registry.Cancel("req_unknown"))
+	assert.Equal(t, 1, registry.Cancel("req_stuck"))
+	<-done
+	assert.ErrorIs(t, cause, errCancelledByAdmin)
+	assert.Empty(t, registry.List(), "请求结束后移出登记表")
+}
+
+func TestAdminCancelEndsStreamWithError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handlers := map[string]func(*gin.Context, types.AnthropicRequest){
+		"anthropic": func(c *gin.Context, req types.AnthropicRequest) {
+			handleStreamRequest(c, req, &types.TokenWithUsage{})
+		},
+		"openai": func(c *gin.Context, req types.AnthropicRequest) {
+			handleOpenAIStreamRequest(c, req, types.TokenInfo{}, false)
+		},
+	}
+
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			upstreamCtx := stubBlockingUpstream(t, func() { activeRequests.Cancel("req_admin_cancel_" + name) })
+			before := GetStreamStats()
+
+			r := gin.New()
+			r.Use(RequestIDMiddleware())
+			r.Use(ActiveRequestMiddleware(activeRequests, []string{"/v1"}))
+			r.POST("/v1/messages", func(c *gin.Context) {
+				handler(c, types.AnthropicRequest{Model: "claude-sonnet-4-20250514", MaxTokens: 100, Stream: true})
+			})
+
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+			req.Header.Set("X-Request-ID", "req_admin_cancel_"+name)
+			runWithTimeout(t, func() { r.ServeHTTP(w, req) })
+
+			require.NotNil(t, *upstreamCtx)
+			assert.ErrorIs(t, context.Cause(*upstreamCtx), errCancelledByAdmin)
+			assert.Contains(t, w.Body.String(), "hello")
+			assert.Contains(t, w.Body.String(), streamErrCancelled, "以错误事件告知客户端请求被取消")
+			assert.NotContains(t, w.Body.String(), "message_stop")
+			assert.NotContains(t, w.Body.String(), "[DONE]")
+
+			after := GetStreamStats()
+			assert.Equal(t, before.AdminCancelled+1, after.AdminCancelled)
+			assert.Equal(t, before.ClientCancelled, after.ClientCancelled)
+		})
+	}
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"kiro2api/audit"
+	"kiro2api/logger"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handler 写入上下文的请求统计字段
+const (
+	auditModelKey        = "audit_model"         // 模型名
+	auditAccountKey      = "audit_account"       // 处理请求的账号配置ID
+	auditInputTokensKey  = "audit_input_tokens"  // 输入 token
+	auditOutputTokensKey = "audit_output_tokens" // 输出 token
+)
+
+// auditLog 全局审计/统计写入器，未配置 AUDIT_LOG_FILE 时为 nil（写入为空操作）
+var auditLog *audit.Writer
+
+// initAuditLog 根据环境变量初始化审计写入器
+func initAuditLog() {
+	path := strings.TrimSpace(utils.GetEnvWithDefault("AUDIT_LOG_FILE", ""))
+	if path == "" {
+		logger.Info("未配置 AUDIT_LOG_FILE，审计与请求统计不落盘")
+		return
+	}
+
+	opts := audit.DefaultOptions()
+	opts.QueueSize = utils.GetEnvIntWithDefault("AUDIT_QUEUE_SIZE", opts.QueueSize)
+	opts.MaxSpoolBytes = int64(utils.GetEnvIntWithDefault("AUDIT_SPOOL_MAX_MB", int(opts.MaxSpoolBytes>>20))) << 20
+	opts.Redactor = contentRedactor
+
+	writer, err := audit.NewWriter(path, opts)
+	if err != nil {
+		logger.Error("初始化审计写入器失败，审计记录将被忽略", logger.Err(err))
+		return
+	}
+	auditLog = writer
+	logger.Info("审计写入器已启用",
+		logger.String("file", path),
+		logger.Int("queue_size", opts.QueueSize),
+		logger.Int("spool_max_mb", int(opts.MaxSpoolBytes>>20)))
+}
+
+// closeAuditLog 停止审计写入器并落盘队列中剩余的记录，服务退出前调用
+func closeAuditLog() {
+	if auditLog == nil {
+		return
+	}
+	auditLog.Close()
+	stats := auditLog.Stats()
+	logger.Info("审计写入器已关闭",
+		logger.Int64("written", stats.Written),
+		logger.Int64("dropped", stats.Dropped))
+}
+
+// setAuditModel 记录本次请求使用的模型
+func setAuditModel(c *gin.Context, model string) {
+	c.Set(auditModelKey, model)
+}
+
+// setAuditAccount 记录处理本次请求的账号（切换token重试时以最后一个为准）
+func setAuditAccount(c *gin.Context, configID string) {
+	c.Set(auditAccountKey, configID)
+}
+
+// setAuditUsage 记录本次请求下发给客户端的 token 用量
+func setAuditUsage(c *gin.Context, inputTokens, outputTokens int) {
+	c.Set(auditInputTokensKey, inputTokens)
+	c.Set(auditOutputTokensKey, outputTokens)
+}
+
+// RequestStatsMiddleware 记录 /v1 请求统计（非阻塞写入）
+func RequestStatsMiddleware(prefixes []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requiresAuth(c.Request.URL.Path, prefixes) {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+
+		model := c.GetString(auditModelKey)
+		inputTokens, outputTokens := c.GetInt(auditInputTokensKey), c.GetInt(auditOutputTokensKey)
+		cost, _ := pricingTable.Cost(model, inputTokens, outputTokens)
+		auditLog.Write(audit.Record{
+			Time:         start,
+			Kind:         audit.KindRequest,
+			RequestID:    GetRequestID(c),
+			ClientIP:     c.ClientIP(),
+			Method:       c.Request.Method,
+			Path:         c.Request.URL.Path,
+			Status:       c.Writer.Status(),
+			LatencyMs:    time.Since(start).Milliseconds(),
+			Model:        model,
+			ClientKey:    GetClientKeyID(c),
+			Account:      c.GetString(auditAccountKey),
+			ErrorCode:    c.GetString(errorCodeKey),
+			InputTokens:  inputTokens,
+			OutputTokens: outputTokens,
+			Cost:         cost,
+		})
+	}
+}
+
+// AdminAuditMiddleware 记录管理API的变更操作（非安全方法）
+func AdminAuditMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !isUnsafeMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+
+		c.Next()
+
+		auditLog.Write(audit.Record{
+			Kind:      audit.KindAdmin,
+			RequestID: GetRequestID(c),
+			Actor:     GetSessionUser(c),
+			ClientIP:  c.ClientIP(),
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			Action:    c.FullPath(),
+			Status:    c.Writer.Status(),
+		})
+	}
+}
+
+// recordAuditEvent 记录登录等非路由级别的审计事件
+func recordAuditEvent(c *gin.Context, action, actor string, status int, detail map[string]any) {
+	auditLog.Write(audit.Record{
+		Kind:      audit.KindAdmin,
+		RequestID: GetRequestID(c),
+		Actor:     actor,
+		ClientIP:  c.ClientIP(),
+		Path:      c.Request.URL.Path,
+		Action:    action,
+		Status:    status,
+		Detail:    detail,
+	})
+}
+
+// handleAuditStats 返回审计写入器的队列与丢弃计数
+func handleAuditStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"enabled": auditLog != nil,
+		"stats":   auditLog.Stats(),
+	})
+}
@@ -1,9 +1,7 @@
 package server
 
 import (
-	"crypto/subtle"
 	"net/http"
-	"sync"
 	"time"
 
 	"kiro2api/logger"
@@ -20,20 +18,20 @@ const (
 // AuthHandlers 认证相关的HTTP处理器
 type AuthHandlers struct {
 	manager     *SessionManager
-	adminUser   string
-	adminPass   string
+	users       *UserStore
 	idleTimeout time.Duration
-	limiter     *loginRateLimiter
+	lockout     *LoginLockout
+	sameSite    http.SameSite // 会话与 CSRF cookie 的 SameSite 属性
 }
 
-// NewAuthHandlers 创建认证处理器
-func NewAuthHandlers(manager *SessionManager, adminUser, adminPass string, idleTimeout time.Duration) *AuthHandlers {
+// NewAuthHandlers 创建认证处理器，lockout 为登录失败锁定策略，sameSite 为会话 cookie 的 SameSite 属性
+func NewAuthHandlers(manager *SessionManager, users *UserStore, idleTimeout time.Duration, lockout *LoginLockout, sameSite http.SameSite) *AuthHandlers {
 	return &AuthHandlers{
 		manager:     manager,
-		adminUser:   adminUser,
-		adminPass:   adminPass,
+		users:       users,
 		idleTimeout: idleTimeout,
-		limiter:     newLoginRateLimiter(10, 10*time.Minute), // 10分钟内最多10次尝试
+		lockout:     lockout,
+		sameSite:    sameSite,
 	}
 }
 
@@ -52,17 +50,6 @@ type LoginRequest struct {
 func (h *AuthHandlers) HandleLogin(c *gin.Context) {
 	ip := c.ClientIP()
 
-	// 检查限流
-	if !h.limiter.Allow(ip) {
-		logger.Warn("登录请求被限流",
-			logger.String("ip", ip))
-		c.JSON(http.StatusTooManyRequests, gin.H{
-			"success": false,
-			"error":   "登录尝试过于频繁，请稍后再试",
-		})
-		return
-	}
-
 	var req LoginRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -72,16 +59,31 @@ func (h *AuthHandlers) HandleLogin(c *gin.Context) {
 		return
 	}
 
-	// 验证凭据（使用常数时间比较防止时序攻击）
-	userMatch := subtle.ConstantTimeCompare([]byte(req.Username), []byte(h.adminUser)) == 1
-	passMatch := subtle.ConstantTimeCompare([]byte(req.Password), []byte(h.adminPass)) == 1
+	// 锁定期内不校验密码（即使密码正确也拒绝）
+	if retryAfter, banned := h.lockout.Check(ip, req.Username); banned || retryAfter > 0 {
+		logger.Warn("登录请求被锁定",
+			logger.String("username", req.Username),
+			logger.String("ip", ip),
+			logger.Bool("banned", banned),
+			logger.Duration("retry_after", retryAfter))
+		respondLoginLocked(c, retryAfter, banned)
+		return
+	}
 
-	if !userMatch || !passMatch {
+	// 验证凭据（使用常数时间比较防止时序攻击）
+	user, ok := h.users.Authenticate(req.Username, req.Password)
+	if !ok {
 		// 固定延迟防止时序分析
 		time.Sleep(failedLoginDelay)
+		lockedFor, banned := h.lockout.RecordFailure(ip, req.Username)
 		logger.Warn("登录失败: 凭据无效",
 			logger.String("username", req.Username),
-			logger.String("ip", ip))
+			logger.String("ip", ip),
+			logger.Duration("locked_for", lockedFor))
+		recordAuditEvent(c, "login_failed", req.Username, http.StatusUnauthorized, nil)
+		if banned {
+			recordAuditEvent(c, "login_ip_banned", req.Username, http.StatusForbidden, map[string]any{"ip": ip})
+		}
 		c.JSON(http.StatusUnauthorized, gin.H{
 			"success": false,
 			"error":   "用户名或密码错误",
@@ -89,9 +91,8 @@ func (h *AuthHandlers) HandleLogin(c *gin.Context) {
 		return
 	}
 
-	// 创建会话
-	session, err := h.manager.CreateSession(req.Username)
-	if err != nil {
+	// 创建会话并设置cookie
+	if err := h.issueSession(c, user.Username, user.Role); err != nil {
 		logger.Error("创建会话失败",
 			logger.Err(err))
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -101,24 +102,37 @@ func (h *AuthHandlers) HandleLogin(c *gin.Context) {
 		return
 	}
 
-	// 设置cookie
-	maxAge := int(h.idleTimeout.Seconds())
-	if maxAge <= 0 {
-		maxAge = 1800 // 默认30分钟
-	}
-	c.SetSameSite(http.SameSiteLaxMode)
-	c.SetCookie(sessionCookieName, session.ID, maxAge, "/", "", isSecureRequest(c), true)
-
+	h.lockout.RecordSuccess(ip, req.Username)
 	logger.Info("用户登录成功",
-		logger.String("username", req.Username),
+		logger.String("username", user.Username),
+		logger.String("role", string(user.Role)),
 		logger.String("ip", ip))
+	recordAuditEvent(c, "login", user.Username, http.StatusOK, map[string]any{"role": user.Role})
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "登录成功",
+		"role":    user.Role,
 	})
 }
 
+// issueSession 创建会话并写入会话cookie，同时下发绑定到新会话的 CSRF token（登录前的 token 随之失效）
+func (h *AuthHandlers) issueSession(c *gin.Context, username string, role Role) error {
+	session, err := h.manager.CreateSession(username, role)
+	if err != nil {
+		return err
+	}
+
+	maxAge := int(h.idleTimeout.Seconds())
+	if maxAge <= 0 {
+		maxAge = 1800 // 默认30分钟
+	}
+	c.SetSameSite(h.sameSite)
+	c.SetCookie(sessionCookieName, session.ID, maxAge, "/", "", isSecureRequest(c), true)
+	setCSRFCookie(c, session.CSRFToken, h.sameSite)
+	return nil
+}
+
 // HandleLogout 处理登出请求
 func (h *AuthHandlers) HandleLogout(c *gin.Context) {
 	// 删除服务端会话
@@ -126,9 +140,12 @@ func (h *AuthHandlers) HandleLogout(c *gin.Context) {
 		h.manager.Delete(sid)
 	}
 
-	// 清除cookie
-	c.SetSameSite(http.SameSiteLaxMode)
+	// 清除cookie，并轮换 CSRF token（已登出会话的 token 不再使用）
+	c.SetSameSite(h.sameSite)
 	c.SetCookie(sessionCookieName, "", -1, "/", "", isSecureRequest(c), true)
+	if token, err := generateCSRFToken(); err == nil {
+		setCSRFCookie(c, token, h.sameSite)
+	}
 
 	user := GetSessionUser(c)
 	if user != "" {
@@ -151,71 +168,111 @@ func (h *AuthHandlers) HandleSessionCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
 		"authenticated": authenticated,
 		"user":          user,
+		"role":          GetSessionRole(c),
 	})
 }
 
-// loginRateLimiter 简单的登录限流器（按IP）
-type loginRateLimiter struct {
-	mu          sync.Mutex
-	limit       int
-	window      time.Duration
-	buckets     map[string]rateBucket
-	maxBuckets  int       // 最大桶数量
-	lastCleanup time.Time // 上次清理时间
-}
-
-type rateBucket struct {
-	count int
-	reset time.Time
+// UserAPIResponse 用户信息（不含密码）
+type UserAPIResponse struct {
+	Username string `json:"username"`
+	Role     Role   `json:"role"`
 }
 
-func newLoginRateLimiter(limit int, window time.Duration) *loginRateLimiter {
-	return &loginRateLimiter{
-		limit:       limit,
-		window:      window,
-		buckets:     make(map[string]rateBucket),
-		maxBuckets:  10000, // 最多保留10000个IP记录
-		lastCleanup: time.Now(),
+// HandleListUsers 列出管理后台用户（仅管理员）
+func (h *AuthHandlers) HandleListUsers(c *gin.Context) {
+	users := h.users.List()
+	result := make([]UserAPIResponse, 0, len(users))
+	for _, u := range users {
+		result = append(result, UserAPIResponse{Username: u.Username, Role: u.Role})
 	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"users":   result,
+	})
 }
 
-func (l *loginRateLimiter) Allow(key string) bool {
-	now := time.Now()
+// HandleUpsertUser 新增或更新管理后台用户（仅管理员）
+func (h *AuthHandlers) HandleUpsertUser(c *gin.Context) {
+	var req AdminUser
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "请求格式无效",
+		})
+		return
+	}
 
-	l.mu.Lock()
-	defer l.mu.Unlock()
+	// 更新已有用户时允许省略密码，沿用原密码（或密码哈希）
+	existing, existed := h.users.Get(req.Username)
+	credentialChanged := req.Password != "" || (req.PasswordHash != "" && req.PasswordHash != existing.PasswordHash)
+	if req.Password == "" && req.PasswordHash == "" && existed {
+		req.Password = existing.Password
+		req.PasswordHash = existing.PasswordHash
+	}
 
-	// 定期清理过期桶（每分钟检查一次）
-	if now.Sub(l.lastCleanup) > time.Minute {
-		l.cleanupExpiredLocked(now)
-		l.lastCleanup = now
+	// 明文密码转换为哈希后再保存，用户文件中不落明文
+	if req.Password != "" && req.PasswordHash == "" {
+		hash, err := HashPassword(req.Password, PasswordAlgoArgon2id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"success": false,
+				"error":   err.Error(),
+			})
+			return
+		}
+		req.Password, req.PasswordHash = "", hash
 	}
 
-	bucket := l.buckets[key]
+	if err := h.users.Upsert(req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
 
-	// 窗口已过期，重置计数
-	if now.After(bucket.reset) {
-		bucket = rateBucket{
-			count: 0,
-			reset: now.Add(l.window),
-		}
+	// 会话缓存了登录时的角色，角色或密码变更后撤销该用户的会话
+	if existed && (existing.Role != req.Role || credentialChanged) {
+		h.manager.RevokeUser(req.Username)
 	}
 
-	bucket.count++
-	l.buckets[key] = bucket
+	logger.Info("管理后台用户已更新",
+		logger.String("username", req.Username),
+		logger.String("role", string(req.Role)),
+		logger.String("operator", GetSessionUser(c)))
 
-	return bucket.count <= l.limit
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "用户已保存",
+	})
 }
 
-// cleanupExpiredLocked 清理过期的桶（调用时需持有锁）
-func (l *loginRateLimiter) cleanupExpiredLocked(now time.Time) {
-	// 如果桶数量超过限制，强制清理
-	if len(l.buckets) > l.maxBuckets {
-		// 清理所有过期桶
-		for key, bucket := range l.buckets {
-			if now.After(bucket.reset) {
-				delete(l.buckets, key)
-			}
-		}
+// HandleDeleteUser 删除管理后台用户（仅管理员）
+func (h *AuthHandlers) HandleDeleteUser(c *gin.Context) {
+	username := c.Param("username")
+	if username == GetSessionUser(c) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "不能删除当前登录用户",
+		})
+		return
 	}
+
+	if err := h.users.Remove(username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   err.Error(),
+		})
+		return
+	}
+	h.manager.RevokeUser(username)
+
+	logger.Info("管理后台用户已删除",
+		logger.String("username", username),
+		logger.String("operator", GetSessionUser(c)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "用户已删除",
+	})
 }
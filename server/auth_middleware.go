@@ -16,6 +16,8 @@ const (
 	// Context keys
 	sessionUserKey = "session_user"
 	sessionIDKey   = "session_id"
+	sessionRoleKey = "session_role"
+	sessionCSRFKey = "session_csrf"
 
 	// CSRF 配置
 	csrfTokenCookieName = "csrf_token"
@@ -31,6 +33,8 @@ func SessionMiddleware(manager *SessionManager) gin.HandlerFunc {
 			if session, ok := manager.Validate(cookie.Value); ok {
 				c.Set(sessionUserKey, session.User)
 				c.Set(sessionIDKey, session.ID)
+				c.Set(sessionRoleKey, session.Role)
+				c.Set(sessionCSRFKey, session.CSRFToken)
 			}
 		}
 		c.Next()
@@ -38,6 +42,7 @@ func SessionMiddleware(manager *SessionManager) gin.HandlerFunc {
 }
 
 // AdminAPIAuthGuard 保护管理API，未认证返回401 JSON
+// 读操作要求 viewer 及以上角色，写操作要求 operator 及以上角色
 func AdminAPIAuthGuard() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		if _, exists := c.Get(sessionUserKey); !exists {
@@ -50,10 +55,47 @@ func AdminAPIAuthGuard() gin.HandlerFunc {
 			})
 			return
 		}
+
+		required := RoleViewer
+		if isUnsafeMethod(c.Request.Method) {
+			required = RoleOperator
+		}
+		if !abortIfRoleDenied(c, required) {
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireRole 要求当前会话具备指定角色（需在 AdminAPIAuthGuard 之后使用）
+func RequireRole(required Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !abortIfRoleDenied(c, required) {
+			return
+		}
 		c.Next()
 	}
 }
 
+// abortIfRoleDenied 角色不足时返回403，返回值表示是否放行
+func abortIfRoleDenied(c *gin.Context, required Role) bool {
+	role := GetSessionRole(c)
+	if role.Allows(required) {
+		return true
+	}
+	logger.Warn("管理API访问被拒绝: 权限不足",
+		logger.String("path", c.Request.URL.Path),
+		logger.String("user", GetSessionUser(c)),
+		logger.String("role", string(role)),
+		logger.String("required_role", string(required)),
+		logger.String("ip", c.ClientIP()))
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"success": false,
+		"error":   "权限不足",
+	})
+	return false
+}
+
 // DashboardAuthGuard 保护Dashboard页面，未认证重定向到登录页
 func DashboardAuthGuard() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -76,6 +118,16 @@ func GetSessionUser(c *gin.Context) string {
 	return ""
 }
 
+// GetSessionRole 从context获取当前登录用户的角色
+func GetSessionRole(c *gin.Context) Role {
+	if role, exists := c.Get(sessionRoleKey); exists {
+		if r, ok := role.(Role); ok {
+			return r
+		}
+	}
+	return ""
+}
+
 // GetSessionID 从context获取当前会话ID
 func GetSessionID(c *gin.Context) string {
 	if sid, exists := c.Get(sessionIDKey); exists {
@@ -86,10 +138,11 @@ func GetSessionID(c *gin.Context) string {
 	return ""
 }
 
-// CSRFMiddleware 使用双提交 Cookie 模式验证 CSRF token
-// 保护所有非安全 HTTP 方法（POST, PUT, PATCH, DELETE）
+// CSRFMiddleware 验证 CSRF token，保护所有非安全 HTTP 方法（POST, PUT, PATCH, DELETE）
+// 已登录的请求使用绑定到会话的 token（同步器令牌模式），cookie 只用于把 token 交给前端脚本，
+// 注入或篡改 cookie 不能伪造出有效的 token；未登录的请求（登录页）使用双提交 Cookie 模式
 // 跳过 /v1 开头的 API 路由（外部客户端 API 使用 Authorization header）
-func CSRFMiddleware(_ bool) gin.HandlerFunc {
+func CSRFMiddleware(sameSite http.SameSite) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 跳过 /v1 API 路由（外部 API 使用 token 认证，不需要 CSRF）
 		if strings.HasPrefix(c.Request.URL.Path, "/v1") {
@@ -98,13 +151,18 @@ func CSRFMiddleware(_ bool) gin.HandlerFunc {
 		}
 
 		// 从 cookie 获取现有 token
-		token := ""
+		cookieToken := ""
 		if cookie, err := c.Request.Cookie(csrfTokenCookieName); err == nil && cookie.Value != "" {
-			token = cookie.Value
+			cookieToken = cookie.Value
+		}
+
+		expected := cookieToken
+		if sessionToken := getSessionCSRFToken(c); sessionToken != "" {
+			expected = sessionToken
 		}
 
-		// 如果没有 token，生成新的并设置 cookie
-		if token == "" {
+		// 如果没有 token，生成新的
+		if expected == "" {
 			newToken, err := generateCSRFToken()
 			if err != nil {
 				logger.Error("生成 CSRF token 失败", logger.Err(err))
@@ -114,29 +172,22 @@ func CSRFMiddleware(_ bool) gin.HandlerFunc {
 				})
 				return
 			}
-			token = newToken
-			// 基于实际请求协议判断是否使用 Secure cookie
-			// 支持直接 HTTPS 和反向代理（X-Forwarded-Proto）
-			isSecure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
-			http.SetCookie(c.Writer, &http.Cookie{
-				Name:     csrfTokenCookieName,
-				Value:    token,
-				Path:     "/",
-				HttpOnly: false, // 前端需要读取
-				SameSite: http.SameSiteLaxMode,
-				Secure:   isSecure,
-				MaxAge:   3600, // 1小时
-			})
+			expected = newToken
+		}
+		// cookie 缺失或与会话 token 不一致时下发正确的 token
+		if cookieToken != expected {
+			setCSRFCookie(c, expected, sameSite)
 		}
 
 		// 对于非安全方法，验证 header 中的 token
 		if isUnsafeMethod(c.Request.Method) {
 			headerToken := c.GetHeader(csrfHeaderName)
-			if headerToken == "" || token == "" ||
-				subtle.ConstantTimeCompare([]byte(headerToken), []byte(token)) != 1 {
+			if headerToken == "" ||
+				subtle.ConstantTimeCompare([]byte(headerToken), []byte(expected)) != 1 {
 				logger.Warn("CSRF 校验失败",
 					logger.String("path", c.Request.URL.Path),
 					logger.String("method", c.Request.Method),
+					logger.Bool("session", getSessionCSRFToken(c) != ""),
 					logger.String("ip", c.ClientIP()))
 				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
 					"success": false,
@@ -150,6 +201,38 @@ func CSRFMiddleware(_ bool) gin.HandlerFunc {
 	}
 }
 
+// setCSRFCookie 下发 CSRF token cookie（前端脚本需要读取，因此不设置 HttpOnly）
+func setCSRFCookie(c *gin.Context, token string, sameSite http.SameSite) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     csrfTokenCookieName,
+		Value:    token,
+		Path:     "/",
+		HttpOnly: false, // 前端需要读取
+		SameSite: sameSite,
+		// 基于实际请求协议判断是否使用 Secure cookie，支持直接 HTTPS 和反向代理（X-Forwarded-Proto）
+		Secure: isSecureRequest(c),
+		MaxAge: 3600, // 1小时，过期后下一个请求重新下发
+	})
+}
+
+// getSessionCSRFToken 从context获取当前会话绑定的 CSRF token（未登录时为空）
+func getSessionCSRFToken(c *gin.Context) string {
+	if token, exists := c.Get(sessionCSRFKey); exists {
+		if t, ok := token.(string); ok {
+			return t
+		}
+	}
+	return ""
+}
+
+// ParseCookieSameSite 解析管理后台 cookie 的 SameSite 配置（lax/strict）
+func ParseCookieSameSite(value string) http.SameSite {
+	if strings.EqualFold(value, "strict") {
+		return http.SameSiteStrictMode
+	}
+	return http.SameSiteLaxMode
+}
+
 // generateCSRFToken 生成安全的随机 CSRF token
 func generateCSRFToken() (string, error) {
 	b := make([]byte, csrfTokenLength)
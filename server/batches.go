@@ -0,0 +1,664 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kiro2api/logger"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 批量任务状态（与 OpenAI Batch API 一致）
+const (
+	BatchStatusInProgress = "in_progress"
+	BatchStatusCompleted  = "completed"
+	BatchStatusCancelling = "cancelling"
+	BatchStatusCancelled  = "cancelled"
+)
+
+// 批量任务目录下的文件
+const (
+	batchMetaFile   = "batch.json"
+	batchInputFile  = "input.jsonl"
+	batchOutputFile = "output.jsonl" // 状态码 200 的结果
+	batchErrorFile  = "errors.jsonl" // 失败的结果
+)
+
+// maxBatchLineBytes 输入 JSONL 单行的最大长度
+const maxBatchLineBytes = 16 << 20
+
+// batchEndpoints 批量请求支持的端点
+var batchEndpoints = map[string]bool{
+	"/v1/messages":         true,
+	"/v1/chat/completions": true,
+	"/v1/completions":      true,
+}
+
+// errBatchNotFound 批量任务不存在
+var errBatchNotFound = errors.New("批量任务不存在")
+
+// BatchConfig 批量请求配置
+type BatchConfig struct {
+	Dir         string // 任务与结果的持久化目录（BATCH_OUTPUT_DIR，与产物清理共用）
+	Concurrency int    // 所有任务共享的并发上限
+	MaxRequests int    // 单个任务的最大请求数
+}
+
+// LoadBatchConfigFromEnv 从环境变量加载批量请求配置（需启用 enable_batches 功能开关）
+// - BATCH_OUTPUT_DIR: 持久化目录
+// - BATCH_CONCURRENCY: 并发上限（默认4）
+// - BATCH_MAX_REQUESTS: 单个任务的最大请求数（默认1000）
+func LoadBatchConfigFromEnv() (BatchConfig, error) {
+	cfg := BatchConfig{
+		Dir:         strings.TrimSpace(os.Getenv("BATCH_OUTPUT_DIR")),
+		Concurrency: utils.GetEnvIntWithDefault("BATCH_CONCURRENCY", 4),
+		MaxRequests: utils.GetEnvIntWithDefault("BATCH_MAX_REQUESTS", 1000),
+	}
+	if cfg.Concurrency < 1 {
+		return BatchConfig{}, fmt.Errorf("BATCH_CONCURRENCY 必须大于0: %d", cfg.Concurrency)
+	}
+	if cfg.MaxRequests < 1 {
+		return BatchConfig{}, fmt.Errorf("BATCH_MAX_REQUESTS 必须大于0: %d", cfg.MaxRequests)
+	}
+	return cfg, nil
+}
+
+// Validate 启用批量请求时的必填项检查
+func (c BatchConfig) Validate() error {
+	if c.Dir == "" {
+		return fmt.Errorf("启用 enable_batches 时必须配置 BATCH_OUTPUT_DIR")
+	}
+	return nil
+}
+
+// Batch 批量任务（OpenAI batch 对象）
+type Batch struct {
+	ID            string             `json:"id"`
+	Object        string             `json:"object"`
+	Endpoint      string             `json:"endpoint"`
+	Status        string             `json:"status"`
+	CreatedAt     int64              `json:"created_at"`
+	InProgressAt  int64              `json:"in_progress_at,omitempty"`
+	CompletedAt   int64              `json:"completed_at,omitempty"`
+	CancellingAt  int64              `json:"cancelling_at,omitempty"`
+	CancelledAt   int64              `json:"cancelled_at,omitempty"`
+	RequestCounts BatchRequestCounts `json:"request_counts"`
+}
+
+type BatchRequestCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+// batchRecord 持久化的任务元数据
+type batchRecord struct {
+	Batch
+	RemoteAddr string `json:"remote_addr,omitempty"` // 创建者地址，执行时沿用以通过IP访问控制
+	ClientKey  string `json:"client_key,omitempty"`  // 创建者的调用方密钥ID，执行时沿用以应用按密钥的限流与策略
+}
+
+// owner 任务所属的调用方密钥ID，早期版本创建的任务未记录密钥，归属默认密钥
+func (r *batchRecord) owner() string {
+	if r.ClientKey == "" {
+		return defaultClientKeyID
+	}
+	return r.ClientKey
+}
+
+// batchInputLine 输入 JSONL 的一行
+type batchInputLine struct {
+	CustomID string         `json:"custom_id"`
+	Method   string         `json:"method"`
+	URL      string         `json:"url"`
+	Body     map[string]any `json:"body"`
+}
+
+// batchOutputLine 结果 JSONL 的一行
+type batchOutputLine struct {
+	ID       string             `json:"id"`
+	CustomID string             `json:"custom_id"`
+	Response *batchLineResponse `json:"response"`
+	Error    *batchLineError    `json:"error"`
+}
+
+type batchLineResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestID  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type batchLineError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// BatchStore 批量任务的持久化与后台执行
+// 每个请求以创建者的调用方身份交给本机路由以非流式执行（与模板试运行相同），结果逐条追加到任务目录，
+// 重启后未完成的任务从未完成的请求继续
+type BatchStore struct {
+	cfg      BatchConfig
+	engine   http.Handler
+	verifier *SignatureVerifier // 校验创建者的密钥仍然有效，为 nil 表示未启用请求签名
+	slots    chan struct{}      // 所有任务共享的并发槽位
+
+	mu      sync.Mutex
+	batches map[string]*batchRecord
+}
+
+// NewBatchStore 创建批量任务存储并加载持久化目录中的任务
+func NewBatchStore(cfg BatchConfig, engine http.Handler, verifier *SignatureVerifier) (*BatchStore, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o700); err != nil {
+		return nil, fmt.Errorf("创建批量任务目录失败: %w", err)
+	}
+	s := &BatchStore{
+		cfg:      cfg,
+		engine:   engine,
+		verifier: verifier,
+		slots:    make(chan struct{}, cfg.Concurrency),
+		batches:  make(map[string]*batchRecord),
+	}
+
+	entries, err := os.ReadDir(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取批量任务目录失败: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(cfg.Dir, entry.Name(), batchMetaFile))
+		if err != nil {
+			continue // 不是批量任务目录
+		}
+		var record batchRecord
+		if err := json.Unmarshal(data, &record); err != nil || record.ID != entry.Name() {
+			logger.Warn("跳过无效的批量任务", logger.String("dir", entry.Name()), logger.Err(err))
+			continue
+		}
+		s.batches[record.ID] = &record
+	}
+	return s, nil
+}
+
+// Resume 继续执行未完成的任务，需在路由注册完成后调用
+func (s *BatchStore) Resume() {
+	s.mu.Lock()
+	var pending []string
+	for id, record := range s.batches {
+		if record.Status == BatchStatusInProgress || record.Status == BatchStatusCancelling {
+			pending = append(pending, id)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, id := range pending {
+		logger.Info("继续执行未完成的批量任务", logger.String("batch_id", id))
+		go s.run(id)
+	}
+}
+
+// Create 保存输入并在后台开始执行
+func (s *BatchStore) Create(lines []batchInputLine, remoteAddr, clientKey string) (Batch, error) {
+	now := time.Now().Unix()
+	record := &batchRecord{
+		Batch: Batch{
+			ID:            "batch_" + utils.GenerateUUID(),
+			Object:        "batch",
+			Endpoint:      lines[0].URL,
+			Status:        BatchStatusInProgress,
+			CreatedAt:     now,
+			InProgressAt:  now,
+			RequestCounts: BatchRequestCounts{Total: len(lines)},
+		},
+		RemoteAddr: remoteAddr,
+		ClientKey:  clientKey,
+	}
+
+	dir := s.batchDir(record.ID)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return Batch{}, fmt.Errorf("创建批量任务目录失败: %w", err)
+	}
+	var input bytes.Buffer
+	for _, line := range lines {
+		data, err := json.Marshal(line)
+		if err != nil {
+			return Batch{}, fmt.Errorf("序列化批量请求失败: %w", err)
+		}
+		input.Write(data)
+		input.WriteByte('\n')
+	}
+	if err := os.WriteFile(filepath.Join(dir, batchInputFile), input.Bytes(), 0o600); err != nil {
+		return Batch{}, fmt.Errorf("写入批量任务输入失败: %w", err)
+	}
+
+	// 启动执行前在锁内复制任务状态，执行过程会在锁内更新计数
+	s.mu.Lock()
+	s.batches[record.ID] = record
+	err := s.saveLocked(record)
+	batch := record.Batch
+	s.mu.Unlock()
+	if err != nil {
+		return Batch{}, err
+	}
+
+	go s.run(batch.ID)
+	return batch, nil
+}
+
+// Get 获取 clientKey 创建的任务状态；任务属于其他调用方或目录已被产物清理删除时视为不存在
+func (s *BatchStore) Get(id, clientKey string) (Batch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.batches[id]
+	if !ok || record.owner() != clientKey {
+		return Batch{}, errBatchNotFound
+	}
+	if _, err := os.Stat(s.batchDir(id)); errors.Is(err, fs.ErrNotExist) {
+		delete(s.batches, id)
+		return Batch{}, errBatchNotFound
+	}
+	return record.Batch, nil
+}
+
+// List 按创建时间倒序列出 clientKey 创建的任务
+func (s *BatchStore) List(clientKey string) []Batch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batches := make([]Batch, 0, len(s.batches))
+	for _, record := range s.batches {
+		if record.owner() == clientKey {
+			batches = append(batches, record.Batch)
+		}
+	}
+	sort.Slice(batches, func(i, j int) bool {
+		if batches[i].CreatedAt != batches[j].CreatedAt {
+			return batches[i].CreatedAt > batches[j].CreatedAt
+		}
+		return batches[i].ID > batches[j].ID
+	})
+	return batches
+}
+
+// Cancel 停止派发 clientKey 创建的任务中新的请求，执行中的请求完成后任务变为 cancelled
+func (s *BatchStore) Cancel(id, clientKey string) (Batch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.batches[id]
+	if !ok || record.owner() != clientKey {
+		return Batch{}, errBatchNotFound
+	}
+	if record.Status == BatchStatusInProgress {
+		record.Status = BatchStatusCancelling
+		record.CancellingAt = time.Now().Unix()
+		if err := s.saveLocked(record); err != nil {
+			return Batch{}, err
+		}
+	}
+	return record.Batch, nil
+}
+
+// run 派发任务中尚无结果的请求，全部完成（或取消）后更新任务状态
+func (s *BatchStore) run(id string) {
+	dir := s.batchDir(id)
+	lines, err := readBatchInput(filepath.Join(dir, batchInputFile))
+	if err != nil {
+		logger.Error("读取批量任务输入失败", logger.String("batch_id", id), logger.Err(err))
+		return
+	}
+	done := make(map[string]bool)
+	for _, name := range []string{batchOutputFile, batchErrorFile} {
+		for _, customID := range readBatchResultIDs(filepath.Join(dir, name)) {
+			done[customID] = true
+		}
+	}
+
+	s.mu.Lock()
+	var remoteAddr string
+	clientKey := defaultClientKeyID
+	if record, ok := s.batches[id]; ok {
+		remoteAddr = record.RemoteAddr
+		clientKey = record.owner()
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for i, line := range lines {
+		if done[line.CustomID] {
+			continue
+		}
+		s.slots <- struct{}{}
+		if s.status(id) != BatchStatusInProgress {
+			<-s.slots
+			break
+		}
+		wg.Add(1)
+		go func(index int, line batchInputLine) {
+			defer wg.Done()
+			defer func() { <-s.slots }()
+			s.record(id, s.dispatch(id, index, line, remoteAddr, clientKey))
+		}(i, line)
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.batches[id]
+	if !ok {
+		return // 任务目录已被清理
+	}
+	now := time.Now().Unix()
+	if record.Status == BatchStatusCancelling {
+		record.Status = BatchStatusCancelled
+		record.CancelledAt = now
+	} else {
+		record.Status = BatchStatusCompleted
+		record.CompletedAt = now
+	}
+	if err := s.saveLocked(record); err != nil {
+		logger.Error("保存批量任务状态失败", logger.String("batch_id", id), logger.Err(err))
+	}
+	logger.Info("批量任务结束",
+		logger.String("batch_id", id),
+		logger.String("status", record.Status),
+		logger.Int("completed", record.RequestCounts.Completed),
+		logger.Int("failed", record.RequestCounts.Failed))
+}
+
+// dispatch 以创建者的调用方身份、非流式方式在本机路由执行单个请求
+func (s *BatchStore) dispatch(batchID string, index int, line batchInputLine, remoteAddr, clientKey string) batchOutputLine {
+	result := batchOutputLine{ID: "batch_req_" + utils.GenerateUUID(), CustomID: line.CustomID}
+	// 创建后密钥被移除（或改为强制签名）时不再以该身份执行
+	if err := validateClientKeyID(s.verifier, clientKey); err != nil {
+		result.Error = &batchLineError{Code: "invalid_client_key", Message: err.Error()}
+		return result
+	}
+
+	body := make(map[string]any, len(line.Body)+1)
+	for k, v := range line.Body {
+		body[k] = v
+	}
+	body["stream"] = false
+	payload, err := json.Marshal(body)
+	if err != nil {
+		result.Error = &batchLineError{Code: "invalid_request", Message: err.Error()}
+		return result
+	}
+	req, err := http.NewRequest(http.MethodPost, line.URL, bytes.NewReader(payload))
+	if err != nil {
+		result.Error = &batchLineError{Code: "invalid_request", Message: err.Error()}
+		return result
+	}
+	requestID := batchID + "-" + strconv.Itoa(index)
+	req = withInternalIdentity(req, clientKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", requestID)
+	req.RemoteAddr = remoteAddr
+
+	recorder := httptest.NewRecorder()
+	s.engine.ServeHTTP(recorder, req)
+	respBody := recorder.Body.Bytes()
+	if !json.Valid(respBody) {
+		respBody, _ = json.Marshal(string(respBody))
+	}
+	result.Response = &batchLineResponse{StatusCode: recorder.Code, RequestID: requestID, Body: respBody}
+	if recorder.Code != http.StatusOK {
+		result.Error = &batchLineError{Code: "request_failed", Message: fmt.Sprintf("请求失败，状态码 %d", recorder.Code)}
+	}
+	return result
+}
+
+// record 追加一条结果并更新计数
+func (s *BatchStore) record(id string, result batchOutputLine) {
+	data, err := json.Marshal(result)
+	if err != nil {
+		logger.Error("序列化批量结果失败", logger.String("batch_id", id), logger.Err(err))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, ok := s.batches[id]
+	if !ok {
+		return
+	}
+	name := batchOutputFile
+	if result.Error != nil {
+		name = batchErrorFile
+	}
+	if err := appendLine(filepath.Join(s.batchDir(id), name), data); err != nil {
+		logger.Error("写入批量结果失败", logger.String("batch_id", id), logger.Err(err))
+		return
+	}
+	if result.Error != nil {
+		record.RequestCounts.Failed++
+	} else {
+		record.RequestCounts.Completed++
+	}
+	if err := s.saveLocked(record); err != nil {
+		logger.Error("保存批量任务状态失败", logger.String("batch_id", id), logger.Err(err))
+	}
+}
+
+func (s *BatchStore) status(id string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if record, ok := s.batches[id]; ok {
+		return record.Status
+	}
+	return ""
+}
+
+func (s *BatchStore) batchDir(id string) string {
+	return filepath.Join(s.cfg.Dir, id)
+}
+
+// saveLocked 保存任务元数据，并刷新目录修改时间，避免执行中的任务被产物清理按保留期删除
+func (s *BatchStore) saveLocked(record *batchRecord) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化批量任务失败: %w", err)
+	}
+	dir := s.batchDir(record.ID)
+	if err := os.WriteFile(filepath.Join(dir, batchMetaFile), data, 0o600); err != nil {
+		return fmt.Errorf("写入批量任务失败: %w", err)
+	}
+	now := time.Now()
+	_ = os.Chtimes(dir, now, now)
+	return nil
+}
+
+func appendLine(path string, data []byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// parseBatchInput 解析并校验输入 JSONL：custom_id 唯一、method 为 POST、所有请求使用同一个受支持的端点
+func parseBatchInput(data []byte, maxRequests int) ([]batchInputLine, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBatchLineBytes)
+	var lines []batchInputLine
+	seen := make(map[string]bool)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		raw := bytes.TrimSpace(scanner.Bytes())
+		if len(raw) == 0 {
+			continue
+		}
+		var line batchInputLine
+		if err := json.Unmarshal(raw, &line); err != nil {
+			return nil, fmt.Errorf("第 %d 行不是有效的 JSON: %w", lineNo, err)
+		}
+		switch {
+		case line.CustomID == "":
+			return nil, fmt.Errorf("第 %d 行缺少 custom_id", lineNo)
+		case seen[line.CustomID]:
+			return nil, fmt.Errorf("第 %d 行 custom_id 重复: %s", lineNo, line.CustomID)
+		case line.Method != http.MethodPost:
+			return nil, fmt.Errorf("第 %d 行 method 只支持 POST", lineNo)
+		case !batchEndpoints[line.URL]:
+			return nil, fmt.Errorf("第 %d 行 url 不支持: %s", lineNo, line.URL)
+		case len(lines) > 0 && line.URL != lines[0].URL:
+			return nil, fmt.Errorf("第 %d 行 url 与第一个请求不同，同一任务的请求必须使用同一个端点", lineNo)
+		case line.Body == nil:
+			return nil, fmt.Errorf("第 %d 行缺少 body", lineNo)
+		}
+		seen[line.CustomID] = true
+		lines = append(lines, line)
+		if len(lines) > maxRequests {
+			return nil, fmt.Errorf("请求数超过上限 %d", maxRequests)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取输入失败: %w", err)
+	}
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("输入中没有请求")
+	}
+	return lines, nil
+}
+
+func readBatchInput(path string) ([]batchInputLine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parseBatchInput(data, len(data)) // 已在创建时校验数量
+}
+
+// readBatchResultIDs 读取结果文件中已完成请求的 custom_id（文件不存在时为空）
+func readBatchResultIDs(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	for _, raw := range bytes.Split(data, []byte{'\n'}) {
+		var line batchOutputLine
+		if json.Unmarshal(raw, &line) == nil && line.CustomID != "" {
+			ids = append(ids, line.CustomID)
+		}
+	}
+	return ids
+}
+
+// HandleCreate POST /v1/batches：请求体为 JSONL，每行一个 {custom_id, method, url, body}
+func (s *BatchStore) HandleCreate(c *gin.Context) {
+	data, err := c.GetRawData()
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "读取请求体失败: %v", err)
+		return
+	}
+	lines, err := parseBatchInput(data, s.cfg.MaxRequests)
+	if err != nil {
+		respondErrorWithCode(c, http.StatusBadRequest, "invalid_request_error", "%v", err)
+		return
+	}
+	batch, err := s.Create(lines, c.Request.RemoteAddr, GetClientKeyID(c))
+	if err != nil {
+		logger.Error("创建批量任务失败", addReqFields(c, logger.Err(err))...)
+		respondError(c, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	logger.Info("创建批量任务",
+		addReqFields(c,
+			logger.String("batch_id", batch.ID),
+			logger.String("endpoint", batch.Endpoint),
+			logger.Int("total", batch.RequestCounts.Total),
+		)...)
+	c.JSON(http.StatusOK, batch)
+}
+
+// HandleList GET /v1/batches?limit=20
+func (s *BatchStore) HandleList(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit < 1 || limit > 100 {
+		respondErrorWithCode(c, http.StatusBadRequest, "invalid_request_error", "limit 取值范围为 1-100")
+		return
+	}
+	batches := s.List(GetClientKeyID(c))
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+	c.JSON(http.StatusOK, gin.H{"object": "list", "data": batches, "has_more": hasMore})
+}
+
+// HandleGet GET /v1/batches/:id
+func (s *BatchStore) HandleGet(c *gin.Context) {
+	batch, err := s.Get(c.Param("id"), GetClientKeyID(c))
+	if err != nil {
+		respondError(c, http.StatusNotFound, "%v", err)
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
+
+// HandleCancel POST /v1/batches/:id/cancel
+func (s *BatchStore) HandleCancel(c *gin.Context) {
+	batch, err := s.Cancel(c.Param("id"), GetClientKeyID(c))
+	if errors.Is(err, errBatchNotFound) {
+		respondError(c, http.StatusNotFound, "%v", err)
+		return
+	}
+	if err != nil {
+		respondError(c, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
+
+// handleResults 下载结果 JSONL（执行中时为已完成的部分）
+func (s *BatchStore) handleResults(name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.Param("id")
+		if _, err := s.Get(id, GetClientKeyID(c)); err != nil {
+			respondError(c, http.StatusNotFound, "%v", err)
+			return
+		}
+		s.mu.Lock()
+		data, err := os.ReadFile(filepath.Join(s.batchDir(id), name))
+		s.mu.Unlock()
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			respondError(c, http.StatusInternalServerError, "读取结果失败: %v", err)
+			return
+		}
+		c.Data(http.StatusOK, "application/jsonl", data)
+	}
+}
+
+// RegisterRoutes 注册 /v1/batches 路由
+func (s *BatchStore) RegisterRoutes(g *gin.RouterGroup) {
+	g.POST("", s.HandleCreate)
+	g.GET("", s.HandleList)
+	g.GET("/:id", s.HandleGet)
+	g.POST("/:id/cancel", s.HandleCancel)
+	g.GET("/:id/output", s.handleResults(batchOutputFile))
+	g.GET("/:id/errors", s.handleResults(batchErrorFile))
+}
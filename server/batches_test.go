@@ -0,0 +1,278 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBatchInput(t *testing.T) {
+	line := func(id, method, url string) string {
+		return `{"custom_id":"` + id + `","method":"` + method + `","url":"` + url + `","body":{"model":"m"}}`
+	}
+	tests := []struct {
+		name    string
+		input   string
+		max     int
+		wantErr string
+	}{
+		{"有效输入", line("a", "POST", "/v1/messages") + "\n\n" + line("b", "POST", "/v1/messages") + "\n", 10, ""},
+		{"空输入", "\n", 10, "没有请求"},
+		{"无效JSON", "{", 10, "第 1 行不是有效的 JSON"},
+		{"缺少custom_id", line("", "POST", "/v1/messages"), 10, "缺少 custom_id"},
+		{"custom_id重复", line("a", "POST", "/v1/messages") + "\n" + line("a", "POST", "/v1/messages"), 10, "custom_id 重复"},
+		{"非POST", line("a", "GET", "/v1/messages"), 10, "只支持 POST"},
+		{"不支持的端点", line("a", "POST", "/v1/batches"), 10, "url 不支持"},
+		{"端点不一致", line("a", "POST", "/v1/messages") + "\n" + line("b", "POST", "/v1/chat/completions"), 10, "同一个端点"},
+		{"缺少body", `{"custom_id":"a","method":"POST","url":"/v1/messages"}`, 10, "缺少 body"},
+		{"超过上限", line("a", "POST", "/v1/messages") + "\n" + line("b", "POST", "/v1/messages"), 1, "超过上限"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, err := parseBatchInput([]byte(tt.input), tt.max)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Len(t, lines, 2)
+		})
+	}
+}
+
+// batchTestVerifier 强制请求签名、只有 team-a 一个密钥的校验器
+func batchTestVerifier(t *testing.T) *SignatureVerifier {
+	v, err := NewSignatureVerifier([]SigningKey{{ID: "team-a", Secret: "s"}}, time.Minute, true)
+	require.NoError(t, err)
+	return v
+}
+
+// newBatchTestEngine 模拟经过认证中间件的 /v1/chat/completions：model 为 fail 时返回400，其余返回200
+func newBatchTestEngine(t *testing.T, block <-chan struct{}, calls *atomic.Int32) *gin.Engine {
+	r := gin.New()
+	r.Use(PathBasedAuthMiddlewareWithSigning("secret", []string{"/v1"}, batchTestVerifier(t)))
+	r.POST("/v1/chat/completions", func(c *gin.Context) {
+		calls.Add(1)
+		if block != nil {
+			<-block
+		}
+		assert.Equal(t, "team-a", GetClientKeyID(c), "以创建者的调用方身份执行")
+		assert.Empty(t, c.GetHeader("Authorization"))
+		var body map[string]any
+		require.NoError(t, c.ShouldBindJSON(&body))
+		assert.Equal(t, false, body["stream"], "批量请求总是非流式执行")
+		if body["model"] == "fail" {
+			respondError(c, http.StatusBadRequest, "%s", "bad model")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"object": "chat.completion", "model": body["model"]})
+	})
+	return r
+}
+
+func batchLines(t *testing.T, models ...string) []batchInputLine {
+	var input []string
+	for i, model := range models {
+		input = append(input, `{"custom_id":"req-`+string(rune('a'+i))+`","method":"POST","url":"/v1/chat/completions","body":{"model":"`+model+`","stream":true}}`)
+	}
+	lines, err := parseBatchInput([]byte(strings.Join(input, "\n")), 100)
+	require.NoError(t, err)
+	return lines
+}
+
+func waitBatchStatus(t *testing.T, s *BatchStore, id, status string) Batch {
+	t.Helper()
+	var batch Batch
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		owner := s.batches[id].owner()
+		s.mu.Unlock()
+		var err error
+		batch, err = s.Get(id, owner)
+		return err == nil && batch.Status == status
+	}, 5*time.Second, 10*time.Millisecond)
+	return batch
+}
+
+func readBatchResults(t *testing.T, s *BatchStore, id, name string) []batchOutputLine {
+	data, err := os.ReadFile(filepath.Join(s.batchDir(id), name))
+	require.NoError(t, err)
+	var results []batchOutputLine
+	for _, raw := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var line batchOutputLine
+		require.NoError(t, json.Unmarshal([]byte(raw), &line))
+		results = append(results, line)
+	}
+	return results
+}
+
+func TestBatchStore_Run(t *testing.T) {
+	var calls atomic.Int32
+	s, err := NewBatchStore(BatchConfig{Dir: t.TempDir(), Concurrency: 2, MaxRequests: 100}, newBatchTestEngine(t, nil, &calls), batchTestVerifier(t))
+	require.NoError(t, err)
+
+	batch, err := s.Create(batchLines(t, "ok", "fail", "ok"), "127.0.0.1:1234", "team-a")
+	require.NoError(t, err)
+	assert.Equal(t, "/v1/chat/completions", batch.Endpoint)
+	assert.Equal(t, 3, batch.RequestCounts.Total)
+
+	batch = waitBatchStatus(t, s, batch.ID, BatchStatusCompleted)
+	assert.Equal(t, BatchRequestCounts{Total: 3, Completed: 2, Failed: 1}, batch.RequestCounts)
+	assert.NotZero(t, batch.CompletedAt)
+
+	output := readBatchResults(t, s, batch.ID, batchOutputFile)
+	require.Len(t, output, 2)
+	assert.Equal(t, http.StatusOK, output[0].Response.StatusCode)
+	assert.Nil(t, output[0].Error)
+	errorsOut := readBatchResults(t, s, batch.ID, batchErrorFile)
+	require.Len(t, errorsOut, 1)
+	assert.Equal(t, "req-b", errorsOut[0].CustomID)
+	assert.Equal(t, http.StatusBadRequest, errorsOut[0].Response.StatusCode)
+	assert.Equal(t, "request_failed", errorsOut[0].Error.Code)
+
+	// 重新加载后任务状态与结果保留
+	reloaded, err := NewBatchStore(s.cfg, s.engine, batchTestVerifier(t))
+	require.NoError(t, err)
+	got, err := reloaded.Get(batch.ID, "team-a")
+	require.NoError(t, err)
+	assert.Equal(t, batch, got)
+}
+
+func TestBatchStore_RejectsInvalidClientKey(t *testing.T) {
+	var calls atomic.Int32
+	s, err := NewBatchStore(BatchConfig{Dir: t.TempDir(), Concurrency: 1, MaxRequests: 100}, newBatchTestEngine(t, nil, &calls), batchTestVerifier(t))
+	require.NoError(t, err)
+
+	// 强制签名时不能以 default 身份执行（例如早期版本创建、未记录密钥的任务）
+	batch, err := s.Create(batchLines(t, "ok"), "", defaultClientKeyID)
+	require.NoError(t, err)
+	got := waitBatchStatus(t, s, batch.ID, BatchStatusCompleted)
+	assert.Equal(t, 1, got.RequestCounts.Failed)
+	assert.Equal(t, int32(0), calls.Load())
+	errorsOut := readBatchResults(t, s, batch.ID, batchErrorFile)
+	require.Len(t, errorsOut, 1)
+	assert.Equal(t, "invalid_client_key", errorsOut[0].Error.Code)
+}
+
+func TestBatchStore_ResumeSkipsFinishedRequests(t *testing.T) {
+	var calls atomic.Int32
+	dir := t.TempDir()
+	s, err := NewBatchStore(BatchConfig{Dir: dir, Concurrency: 1, MaxRequests: 100}, newBatchTestEngine(t, nil, &calls), batchTestVerifier(t))
+	require.NoError(t, err)
+	batch, err := s.Create(batchLines(t, "ok", "ok"), "", "team-a")
+	require.NoError(t, err)
+	waitBatchStatus(t, s, batch.ID, BatchStatusCompleted)
+
+	// 模拟执行到一半时重启：只保留第一条结果
+	output := readBatchResults(t, s, batch.ID, batchOutputFile)
+	first, err := json.Marshal(output[0])
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(s.batchDir(batch.ID), batchOutputFile), append(first, '\n'), 0o600))
+	s.mu.Lock()
+	record := s.batches[batch.ID]
+	record.Status = BatchStatusInProgress
+	record.RequestCounts.Completed = 1
+	require.NoError(t, s.saveLocked(record))
+	s.mu.Unlock()
+
+	calls.Store(0)
+	resumed, err := NewBatchStore(s.cfg, s.engine, batchTestVerifier(t))
+	require.NoError(t, err)
+	resumed.Resume()
+	got := waitBatchStatus(t, resumed, batch.ID, BatchStatusCompleted)
+	assert.Equal(t, int32(1), calls.Load(), "只执行尚无结果的请求")
+	assert.Equal(t, 2, got.RequestCounts.Completed)
+	assert.Len(t, readBatchResults(t, resumed, batch.ID, batchOutputFile), 2)
+}
+
+func TestBatchStore_Cancel(t *testing.T) {
+	var calls atomic.Int32
+	block := make(chan struct{})
+	s, err := NewBatchStore(BatchConfig{Dir: t.TempDir(), Concurrency: 1, MaxRequests: 100}, newBatchTestEngine(t, block, &calls), batchTestVerifier(t))
+	require.NoError(t, err)
+	batch, err := s.Create(batchLines(t, "ok", "ok", "ok"), "", "team-a")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+	cancelled, err := s.Cancel(batch.ID, "team-a")
+	require.NoError(t, err)
+	assert.Equal(t, BatchStatusCancelling, cancelled.Status)
+	close(block)
+
+	got := waitBatchStatus(t, s, batch.ID, BatchStatusCancelled)
+	assert.Equal(t, int32(1), calls.Load(), "取消后不再派发新的请求")
+	assert.Equal(t, 1, got.RequestCounts.Completed)
+
+	_, err = s.Cancel("batch_missing", "team-a")
+	assert.ErrorIs(t, err, errBatchNotFound)
+}
+
+func TestBatchConfig_Validate(t *testing.T) {
+	assert.Error(t, BatchConfig{}.Validate())
+	assert.NoError(t, BatchConfig{Dir: "./data/batches"}.Validate())
+
+	t.Setenv("BATCH_CONCURRENCY", "0")
+	_, err := LoadBatchConfigFromEnv()
+	assert.Error(t, err)
+}
+
+func TestBatchStore_ScopedToClientKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var calls atomic.Int32
+	block := make(chan struct{})
+	s, err := NewBatchStore(BatchConfig{Dir: t.TempDir(), Concurrency: 1, MaxRequests: 100}, newBatchTestEngine(t, block, &calls), batchTestVerifier(t))
+	require.NoError(t, err)
+	batch, err := s.Create(batchLines(t, "ok", "ok"), "", "team-a")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return calls.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	newRouter := func(keyID string) *gin.Engine {
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			c.Set(clientKeyIDKey, keyID)
+			c.Next()
+		})
+		s.RegisterRoutes(r.Group("/v1/batches"))
+		return r
+	}
+	serve := func(keyID, method, path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		newRouter(keyID).ServeHTTP(w, httptest.NewRequest(method, path, nil))
+		return w
+	}
+
+	// 其他调用方看不到、读不到、也取消不了该任务
+	w := serve("team-b", http.MethodGet, "/v1/batches")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), batch.ID)
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/v1/batches/" + batch.ID},
+		{http.MethodGet, "/v1/batches/" + batch.ID + "/output"},
+		{http.MethodGet, "/v1/batches/" + batch.ID + "/errors"},
+		{http.MethodPost, "/v1/batches/" + batch.ID + "/cancel"},
+	} {
+		assert.Equal(t, http.StatusNotFound, serve("team-b", req.method, req.path).Code, "%s %s", req.method, req.path)
+	}
+	got, err := s.Get(batch.ID, "team-a")
+	require.NoError(t, err)
+	assert.Equal(t, BatchStatusInProgress, got.Status)
+
+	// 创建者可以正常访问
+	w = serve("team-a", http.MethodGet, "/v1/batches")
+	assert.Contains(t, w.Body.String(), batch.ID)
+	assert.Equal(t, http.StatusOK, serve("team-a", http.MethodGet, "/v1/batches/"+batch.ID).Code)
+	assert.Equal(t, http.StatusOK, serve("team-a", http.MethodPost, "/v1/batches/"+batch.ID+"/cancel").Code)
+	close(block)
+	waitBatchStatus(t, s, batch.ID, BatchStatusCancelled)
+}
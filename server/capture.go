@@ -0,0 +1,279 @@
+package server
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"kiro2api/logger"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 请求捕获相关请求头与响应头
+const (
+	captureHeader   = "X-Kiro-Capture"    // 请求头：true/1 表示保存本次请求的捕获包
+	captureIDHeader = "X-Kiro-Capture-Id" // 响应头：捕获包名称（CAPTURE_DIR 下的目录名），附在问题报告中
+)
+
+// 捕获包中的文件
+const (
+	captureManifestFile        = "capture.json"          // 元数据（CaptureManifest）
+	captureRequestFile         = "request.json"          // 客户端请求体
+	captureUpstreamRequestFile = "upstream_request.json" // 转换后发送给上游的请求体
+	captureUpstreamFile        = "upstream_response.bin" // 上游原始响应字节（AWS 事件流）
+)
+
+// captureVersion 捕获包格式版本
+const captureVersion = 1
+
+// capturePaths 支持捕获与回放的端点
+var capturePaths = map[string]bool{
+	"/v1/messages":         true,
+	"/v1/chat/completions": true,
+}
+
+// CaptureManifest 捕获包元数据
+type CaptureManifest struct {
+	Version             int               `json:"version"`
+	ID                  string            `json:"id"`
+	RequestID           string            `json:"request_id,omitempty"`
+	CreatedAt           time.Time         `json:"created_at"`
+	Method              string            `json:"method"`
+	Path                string            `json:"path"`
+	Query               string            `json:"query,omitempty"`
+	Headers             map[string]string `json:"headers,omitempty"` // 认证、签名与 Cookie 等敏感请求头不保存
+	ClientKey           string            `json:"client_key,omitempty"`
+	Status              int               `json:"status"`                          // 返回给客户端的状态码
+	UpstreamStatus      int               `json:"upstream_status,omitempty"`       // 0 表示请求未到达上游
+	UpstreamContentType string            `json:"upstream_content_type,omitempty"` // 回放时原样返回
+	UpstreamBytes       int               `json:"upstream_bytes"`
+	UpstreamTruncated   bool              `json:"upstream_truncated,omitempty"` // 上游响应超过 CAPTURE_MAX_BYTES，只保存了前面部分
+}
+
+// CaptureStore 请求捕获包的保存位置与上限
+// 需同时配置 CAPTURE_DIR 与启用功能开关 enable_capture，且请求带 X-Kiro-Capture: true 时才保存，
+// 用于问题报告：kiro2api replay <捕获包> 可以离线重新执行转换
+type CaptureStore struct {
+	dir      string
+	maxBytes int
+}
+
+// LoadCaptureStoreFromEnv 从环境变量加载捕获包配置，未配置目录时返回 nil
+// - CAPTURE_DIR: 捕获包目录（与运行期产物清理共用，保留期见 CAPTURE_RETENTION_HOURS）
+// - CAPTURE_MAX_BYTES: 单个捕获包中上游响应的最大字节数，超过时截断（默认10MB）
+func LoadCaptureStoreFromEnv() (*CaptureStore, error) {
+	dir := strings.TrimSpace(os.Getenv("CAPTURE_DIR"))
+	if dir == "" {
+		return nil, nil
+	}
+	maxBytes := utils.GetEnvIntWithDefault("CAPTURE_MAX_BYTES", 10<<20)
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("CAPTURE_MAX_BYTES 必须大于0")
+	}
+	return &CaptureStore{dir: dir, maxBytes: maxBytes}, nil
+}
+
+// captureSession 一次请求的捕获数据，转换与上游调用过程中写入
+type captureSession struct {
+	mu                  sync.Mutex
+	maxBytes            int
+	upstreamRequest     []byte
+	upstreamStatus      int
+	upstreamContentType string
+	upstream            bytes.Buffer
+	truncated           bool
+}
+
+// captureSessionKey 上下文中保存的 *captureSession
+const captureSessionKey = "capture_session"
+
+// captureUpstreamRequest 记录转换后发送给上游的请求体（切换token重试时保留最后一次）
+func captureUpstreamRequest(c *gin.Context, body []byte) {
+	if s := getCaptureSession(c); s != nil {
+		s.mu.Lock()
+		s.upstreamRequest = bytes.Clone(body)
+		s.mu.Unlock()
+	}
+}
+
+// captureUpstreamResponse 记录上游响应状态，并在读取响应体时复制原始字节（切换token重试时只保留最后一次响应）
+func captureUpstreamResponse(c *gin.Context, resp *http.Response) io.ReadCloser {
+	s := getCaptureSession(c)
+	if s == nil {
+		return resp.Body
+	}
+	s.mu.Lock()
+	s.upstreamStatus = resp.StatusCode
+	s.upstreamContentType = resp.Header.Get("Content-Type")
+	s.upstream.Reset()
+	s.truncated = false
+	s.mu.Unlock()
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.TeeReader(resp.Body, s), resp.Body}
+}
+
+// Write 复制上游响应字节，超过上限的部分丢弃
+func (s *captureSession) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if room := s.maxBytes - s.upstream.Len(); room < len(p) {
+		s.upstream.Write(p[:max(room, 0)])
+		s.truncated = true
+		return len(p), nil
+	}
+	s.upstream.Write(p)
+	return len(p), nil
+}
+
+func getCaptureSession(c *gin.Context) *captureSession {
+	if v, ok := c.Get(captureSessionKey); ok {
+		if s, ok := v.(*captureSession); ok {
+			return s
+		}
+	}
+	return nil
+}
+
+// wantsCapture 请求是否要求保存捕获包
+func wantsCapture(c *gin.Context) bool {
+	switch strings.ToLower(strings.TrimSpace(c.GetHeader(captureHeader))) {
+	case "1", "true", "yes", "on":
+		return true
+	}
+	return false
+}
+
+// CaptureMiddleware 为带 X-Kiro-Capture: true 的 /v1/messages 与 /v1/chat/completions 请求保存捕获包
+// 捕获包包含客户端请求、转换后的上游请求与上游原始响应，响应头 X-Kiro-Capture-Id 返回捕获包名称；
+// 功能开关 enable_capture 在运行期关闭后不再保存；捕获包含完整的对话内容，仅应在排查问题时短期启用
+func CaptureMiddleware(store *CaptureStore, enabled func() bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if store == nil || c.Request.Method != http.MethodPost || !capturePaths[c.Request.URL.Path] || !wantsCapture(c) || !enabled() {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "读取请求体失败: %v", err)
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		id := newCaptureID(c)
+		session := &captureSession{maxBytes: store.maxBytes}
+		c.Set(captureSessionKey, session)
+		c.Header(captureIDHeader, id)
+
+		c.Next()
+
+		manifest := CaptureManifest{
+			Version:   captureVersion,
+			ID:        id,
+			RequestID: GetRequestID(c),
+			CreatedAt: time.Now(),
+			Method:    c.Request.Method,
+			Path:      c.Request.URL.Path,
+			Query:     c.Request.URL.RawQuery,
+			Headers:   captureHeaders(c.Request.Header),
+			ClientKey: GetClientKeyID(c),
+			Status:    c.Writer.Status(),
+		}
+		if err := store.save(manifest, body, session); err != nil {
+			logger.Error("保存捕获包失败", addReqFields(c, logger.String("capture_id", id), logger.Err(err))...)
+			return
+		}
+		logger.Info("已保存捕获包", addReqFields(c,
+			logger.String("capture_id", id),
+			logger.Int("upstream_bytes", manifest.UpstreamBytes))...)
+	}
+}
+
+// save 将捕获包写入 CAPTURE_DIR/<id>/，先写入临时目录再改名，避免留下不完整的捕获包
+func (s *CaptureStore) save(manifest CaptureManifest, body []byte, session *captureSession) error {
+	session.mu.Lock()
+	upstreamRequest := session.upstreamRequest
+	upstream := bytes.Clone(session.upstream.Bytes())
+	manifest.UpstreamStatus = session.upstreamStatus
+	manifest.UpstreamContentType = session.upstreamContentType
+	manifest.UpstreamTruncated = session.truncated
+	session.mu.Unlock()
+	manifest.UpstreamBytes = len(upstream)
+
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return fmt.Errorf("创建捕获目录失败: %w", err)
+	}
+	tmp, err := os.MkdirTemp(s.dir, ".tmp-"+manifest.ID+"-")
+	if err != nil {
+		return fmt.Errorf("创建捕获目录失败: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化捕获元数据失败: %w", err)
+	}
+	files := map[string][]byte{
+		captureManifestFile: manifestJSON,
+		captureRequestFile:  body,
+		captureUpstreamFile: upstream,
+	}
+	if upstreamRequest != nil {
+		files[captureUpstreamRequestFile] = upstreamRequest
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(tmp, name), data, 0o600); err != nil {
+			return fmt.Errorf("写入 %s 失败: %w", name, err)
+		}
+	}
+	return os.Rename(tmp, filepath.Join(s.dir, manifest.ID))
+}
+
+// newCaptureID 捕获包名称：时间戳 + 请求ID（缺失时使用随机串），只包含文件名安全的字符
+func newCaptureID(c *gin.Context) string {
+	suffix := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return -1
+	}, GetRequestID(c))
+	if suffix == "" || len(suffix) > 64 {
+		buf := make([]byte, 6)
+		_, _ = rand.Read(buf)
+		suffix = hex.EncodeToString(buf)
+	}
+	return time.Now().UTC().Format("20060102T150405Z") + "-" + suffix
+}
+
+// captureHeaders 捕获包中保存的请求头：去掉认证、签名、Cookie 等敏感请求头
+func captureHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string, len(header))
+	for name := range header {
+		upper := strings.ToUpper(name)
+		sensitive := false
+		for _, marker := range []string{"AUTH", "KEY", "TOKEN", "COOKIE", "SIGNATURE", "SECRET"} {
+			if strings.Contains(upper, marker) {
+				sensitive = true
+				break
+			}
+		}
+		if !sensitive {
+			headers[name] = header.Get(name)
+		}
+	}
+	return headers
+}
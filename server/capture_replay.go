@@ -0,0 +1,202 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+
+	"kiro2api/types"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CaptureReplay 捕获包的离线回放结果
+type CaptureReplay struct {
+	Manifest CaptureManifest
+	// Status 与 Body 为以当前代码转换上游原始响应后返回给客户端的响应
+	Status      int
+	ContentType string
+	Body        []byte
+	// UpstreamRequest 为以当前代码重新转换客户端请求得到的上游请求体
+	UpstreamRequest []byte
+	// UpstreamRequestMatches 重新转换的上游请求体与捕获时一致（忽略按客户端信息生成的会话ID）
+	// 捕获包中没有上游请求体（请求未到达转换阶段）时为 false
+	UpstreamRequestMatches bool
+}
+
+// captureVolatileFields 按客户端信息生成的会话字段，回放环境不同时会变化，比较上游请求体时忽略
+var captureVolatileFields = []string{"conversationId", "agentContinuationId"}
+
+// replayMu 回放期间替换共享HTTP客户端的 Transport，同一时间只允许一个回放
+var replayMu sync.Mutex
+
+// Capture 从磁盘读取的捕获包
+type Capture struct {
+	Manifest        CaptureManifest
+	Request         []byte // 客户端请求体
+	UpstreamRequest []byte // 转换后的上游请求体，请求未到达转换阶段时为 nil
+	Upstream        []byte // 上游原始响应
+}
+
+// LoadCapture 读取捕获包目录
+func LoadCapture(dir string) (*Capture, error) {
+	var capture Capture
+	data, err := os.ReadFile(filepath.Join(dir, captureManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("读取捕获包元数据失败: %w", err)
+	}
+	if err := utils.SafeUnmarshal(data, &capture.Manifest); err != nil {
+		return nil, fmt.Errorf("解析捕获包元数据失败: %w", err)
+	}
+	if capture.Manifest.Version != captureVersion {
+		return nil, fmt.Errorf("不支持的捕获包版本: %d", capture.Manifest.Version)
+	}
+	if !capturePaths[capture.Manifest.Path] {
+		return nil, fmt.Errorf("不支持回放的端点: %s", capture.Manifest.Path)
+	}
+	if capture.Request, err = os.ReadFile(filepath.Join(dir, captureRequestFile)); err != nil {
+		return nil, fmt.Errorf("读取客户端请求失败: %w", err)
+	}
+	if capture.UpstreamRequest, err = os.ReadFile(filepath.Join(dir, captureUpstreamRequestFile)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("读取上游请求失败: %w", err)
+	}
+	if capture.Upstream, err = os.ReadFile(filepath.Join(dir, captureUpstreamFile)); err != nil {
+		return nil, fmt.Errorf("读取上游响应失败: %w", err)
+	}
+	return &capture, nil
+}
+
+// ReplayCapture 离线回放捕获包：以当前代码重新转换客户端请求，并把捕获的上游原始响应当作上游返回，
+// 经与真实请求相同的处理器转换为客户端响应；不访问网络、不需要账号
+// 回放不应用调用方密钥的策略与系统提示策略（捕获包中的上游请求体已包含它们的效果）
+func ReplayCapture(dir string) (*CaptureReplay, error) {
+	capture, err := LoadCapture(dir)
+	if err != nil {
+		return nil, err
+	}
+	manifest := capture.Manifest
+	if manifest.UpstreamStatus == 0 {
+		return nil, fmt.Errorf("捕获包中的请求未到达上游（客户端状态码 %d），无法回放", manifest.Status)
+	}
+
+	replayMu.Lock()
+	defer replayMu.Unlock()
+	transport := &replayTransport{status: manifest.UpstreamStatus, contentType: manifest.UpstreamContentType, body: capture.Upstream}
+	original := utils.SharedHTTPClient.Transport
+	utils.SharedHTTPClient.Transport = transport
+	defer func() { utils.SharedHTTPClient.Transport = original }()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(manifest.Method, manifest.Path, bytes.NewReader(capture.Request))
+	c.Request.URL.RawQuery = manifest.Query
+	for name, value := range manifest.Headers {
+		c.Request.Header.Set(name, value)
+	}
+	c.Set(clientKeyIDKey, manifest.ClientKey)
+	if err := replayRequest(c, manifest.Path, capture.Request); err != nil {
+		return nil, err
+	}
+
+	result := &CaptureReplay{
+		Manifest:        manifest,
+		Status:          w.Code,
+		ContentType:     w.Header().Get("Content-Type"),
+		Body:            w.Body.Bytes(),
+		UpstreamRequest: transport.request,
+	}
+	result.UpstreamRequestMatches = capture.UpstreamRequest != nil && sameUpstreamRequest(capture.UpstreamRequest, transport.request)
+	return result, nil
+}
+
+// replayRequest 按端点解析客户端请求并交给对应的处理器
+func replayRequest(c *gin.Context, path string, request []byte) error {
+	token := types.TokenInfo{AccessToken: "replay", ConfigID: "replay"}
+	if path == "/v1/chat/completions" {
+		var openaiReq types.OpenAIRequest
+		if err := utils.SafeUnmarshal(request, &openaiReq); err != nil {
+			return fmt.Errorf("解析客户端请求失败: %w", err)
+		}
+		anthropicReq, err := prepareOpenAIChatRequest(c, openaiReq, nil)
+		if err != nil {
+			return fmt.Errorf("转换客户端请求失败: %w", err)
+		}
+		if anthropicReq.Stream {
+			includeUsage := openaiReq.StreamOptions != nil && openaiReq.StreamOptions.IncludeUsage
+			handleOpenAIStreamRequest(c, anthropicReq, token, includeUsage)
+		} else {
+			handleOpenAINonStreamRequest(c, anthropicReq, token, openaiReq.ResponseFormat)
+		}
+		return nil
+	}
+
+	var anthropicReq types.AnthropicRequest
+	if err := utils.SafeUnmarshal(request, &anthropicReq); err != nil {
+		return fmt.Errorf("解析客户端请求失败: %w", err)
+	}
+	anthropicReq, err := prepareAnthropicRequest(c, anthropicReq, nil)
+	if err != nil {
+		return fmt.Errorf("转换客户端请求失败: %w", err)
+	}
+	if anthropicReq.Stream {
+		handleStreamRequest(c, anthropicReq, &types.TokenWithUsage{TokenInfo: token})
+	} else {
+		handleNonStreamRequest(c, anthropicReq, token)
+	}
+	return nil
+}
+
+// sameUpstreamRequest 比较两个上游请求体，忽略按客户端信息生成的会话字段
+func sameUpstreamRequest(a, b []byte) bool {
+	var left, right map[string]any
+	if utils.SafeUnmarshal(a, &left) != nil || utils.SafeUnmarshal(b, &right) != nil {
+		return false
+	}
+	for _, m := range []map[string]any{left, right} {
+		if state, ok := m["conversationState"].(map[string]any); ok {
+			for _, field := range captureVolatileFields {
+				delete(state, field)
+			}
+		}
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+// replayTransport 以捕获的上游原始响应代替上游，并记录发送的请求体
+type replayTransport struct {
+	status      int
+	contentType string
+	body        []byte
+	request     []byte
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return nil, err
+		}
+		t.request = body
+	}
+	header := make(http.Header)
+	if t.contentType != "" {
+		header.Set("Content-Type", t.contentType)
+	}
+	return &http.Response{
+		StatusCode:    t.status,
+		Status:        fmt.Sprintf("%d %s", t.status, http.StatusText(t.status)),
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(t.body)),
+		ContentLength: int64(len(t.body)),
+		Request:       req,
+	}, nil
+}
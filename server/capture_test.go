@@ -0,0 +1,134 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kiro2api/types"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureTestRouter 带捕获中间件的 /v1/messages 路由，上游由 transport 代替
+func captureTestRouter(t *testing.T, store *CaptureStore, enabled *bool, upstream []byte) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	original := utils.SharedHTTPClient.Transport
+	utils.SharedHTTPClient.Transport = &replayTransport{status: http.StatusOK, contentType: upstreamEventStreamType, body: upstream}
+	t.Cleanup(func() { utils.SharedHTTPClient.Transport = original })
+
+	r := gin.New()
+	r.Use(CaptureMiddleware(store, func() bool { return *enabled }))
+	r.POST("/v1/messages", func(c *gin.Context) {
+		var req types.AnthropicRequest
+		require.NoError(t, c.ShouldBindJSON(&req))
+		handleNonStreamRequest(c, req, types.TokenInfo{AccessToken: "secret-access-token", ConfigID: "acc"})
+	})
+	return r
+}
+
+func TestCaptureMiddleware_SaveAndReplay(t *testing.T) {
+	dir := t.TempDir()
+	store := &CaptureStore{dir: dir, maxBytes: 1 << 20}
+	enabled := true
+	upstream := append(
+		encodeEventStreamFrame("assistantResponseEvent", []byte(`{"content":"captured "}`)),
+		encodeEventStreamFrame("assistantResponseEvent", []byte(`{"content":"answer"}`))...)
+	r := captureTestRouter(t, store, &enabled, upstream)
+
+	const body = `{"model":"claude-sonnet-4-20250514","max_tokens":100,"messages":[{"role":"user","content":"hello"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+	req.Header.Set(captureHeader, "true")
+	req.Header.Set("Authorization", "Bearer client-secret")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	id := w.Header().Get(captureIDHeader)
+	require.NotEmpty(t, id)
+
+	bundle := filepath.Join(dir, id)
+	capture, err := LoadCapture(bundle)
+	require.NoError(t, err)
+	assert.JSONEq(t, body, string(capture.Request))
+	assert.Equal(t, upstream, capture.Upstream)
+	assert.Contains(t, string(capture.UpstreamRequest), "hello")
+	assert.Equal(t, http.StatusOK, capture.Manifest.UpstreamStatus)
+	assert.NotContains(t, capture.Manifest.Headers, "Authorization", "认证请求头不保存")
+	for _, name := range []string{captureManifestFile, captureUpstreamRequestFile} {
+		data, err := os.ReadFile(filepath.Join(bundle, name))
+		require.NoError(t, err)
+		assert.NotContains(t, string(data), "secret", name)
+	}
+
+	// 离线回放：重新转换的上游请求体与捕获时一致，客户端响应包含上游文本
+	replay, err := ReplayCapture(bundle)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, replay.Status)
+	assert.Contains(t, string(replay.Body), "captured answer")
+	assert.True(t, replay.UpstreamRequestMatches)
+
+	// 捕获的上游请求体与当前转换结果不同时报告不一致
+	require.NoError(t, os.WriteFile(filepath.Join(bundle, captureUpstreamRequestFile), []byte(`{"conversationState":{}}`), 0o600))
+	replay, err = ReplayCapture(bundle)
+	require.NoError(t, err)
+	assert.False(t, replay.UpstreamRequestMatches)
+}
+
+func TestCaptureMiddleware_Conditions(t *testing.T) {
+	dir := t.TempDir()
+	store := &CaptureStore{dir: dir, maxBytes: 8}
+	enabled := true
+	upstream := encodeEventStreamFrame("assistantResponseEvent", []byte(`{"content":"hi"}`))
+	r := captureTestRouter(t, store, &enabled, upstream)
+
+	send := func(header string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(`{"model":"claude-sonnet-4-20250514","max_tokens":10,"messages":[{"role":"user","content":"hi"}]}`))
+		if header != "" {
+			req.Header.Set(captureHeader, header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 未带请求头或功能开关运行期关闭时不保存
+	assert.Empty(t, send("").Header().Get(captureIDHeader))
+	enabled = false
+	assert.Empty(t, send("1").Header().Get(captureIDHeader))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	// 上游响应超过上限时截断
+	enabled = true
+	id := send("1").Header().Get(captureIDHeader)
+	require.NotEmpty(t, id)
+	capture, err := LoadCapture(filepath.Join(dir, id))
+	require.NoError(t, err)
+	assert.True(t, capture.Manifest.UpstreamTruncated)
+	assert.True(t, bytes.HasPrefix(upstream, capture.Upstream))
+	assert.Len(t, capture.Upstream, 8)
+}
+
+func TestLoadCaptureStoreFromEnv(t *testing.T) {
+	t.Setenv("CAPTURE_DIR", "")
+	store, err := LoadCaptureStoreFromEnv()
+	require.NoError(t, err)
+	assert.Nil(t, store)
+
+	t.Setenv("CAPTURE_DIR", "/tmp/captures")
+	store, err = LoadCaptureStoreFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 10<<20, store.maxBytes)
+
+	t.Setenv("CAPTURE_MAX_BYTES", "0")
+	_, err = LoadCaptureStoreFromEnv()
+	assert.Error(t, err)
+}
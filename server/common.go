@@ -2,29 +2,42 @@ package server
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"strings"
 
+	"kiro2api/auth"
 	"kiro2api/config"
 	"kiro2api/converter"
 	"kiro2api/logger"
+	"kiro2api/tracing"
 	"kiro2api/types"
 	"kiro2api/utils"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // respondErrorWithCode 标准化的错误响应结构
-// 统一返回: {"error": {"message": string, "code": string}}
+// 按端点返回 OpenAI 或 Anthropic 格式的错误体（见 errorEnvelope），error 对象均包含 message、type 与 code
 func respondErrorWithCode(c *gin.Context, statusCode int, code string, format string, args ...any) {
-	c.JSON(statusCode, gin.H{
-		"error": gin.H{
-			"message": fmt.Sprintf(format, args...),
-			"code":    code,
-		},
-	})
+	c.JSON(statusCode, errorEnvelope(c, statusCode, code, fmt.Sprintf(format, args...), nil))
+}
+
+// respondInvalidRequest 请求体校验失败时按 OpenAI 错误对象返回400
+// 统一返回: {"error": {"message": string, "type": "invalid_request_error", "param": string|null, "code": string}}
+// 非 converter.RequestError 的校验错误 param 为 null、code 为 invalid_request_error
+func respondInvalidRequest(c *gin.Context, err error) {
+	var param any
+	code := "invalid_request_error"
+	var reqErr *converter.RequestError
+	if errors.As(err, &reqErr) {
+		param, code = reqErr.Param, reqErr.Code
+	}
+	c.JSON(http.StatusBadRequest, errorEnvelope(c, http.StatusBadRequest, code, err.Error(), gin.H{"param": param}))
 }
 
 // respondError 简化封装，依据statusCode映射默认code
@@ -41,6 +54,8 @@ func respondError(c *gin.Context, statusCode int, format string, args ...any) {
 		code = "not_found"
 	case http.StatusTooManyRequests:
 		code = "rate_limited"
+	case http.StatusServiceUnavailable:
+		code = "service_unavailable"
 	default:
 		code = "internal_error"
 	}
@@ -50,17 +65,50 @@ func respondError(c *gin.Context, statusCode int, format string, args ...any) {
 // 通用请求处理错误函数
 func handleRequestBuildError(c *gin.Context, err error) {
 	logger.Error("构建请求失败", addReqFields(c, logger.Err(err))...)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		respondAPIError(c, apiErr)
+		return
+	}
 	respondError(c, http.StatusInternalServerError, "构建请求失败: %v", err)
 }
 
 func handleRequestSendError(c *gin.Context, err error) {
 	logger.Error("发送请求失败", addReqFields(c, logger.Err(err))...)
-	respondError(c, http.StatusInternalServerError, "发送请求失败: %v", err)
+	recordErrorSample(c, "upstream_send", 0, err.Error())
+	if cancelledByAdmin(c) {
+		respondCancelledByAdmin(c)
+		return
+	}
+	if isTimeoutError(err) {
+		respondAPIError(c, newAPIError(ErrCodeUpstreamTimeout, err, "上游请求超时: %v", err))
+		return
+	}
+	respondAPIError(c, newAPIError(ErrCodeUpstreamUnreachable, err, "发送请求失败: %v", err))
+}
+
+// handleUpstreamContentError 上游响应无法解析时返回带片段的结构化错误（502）
+func handleUpstreamContentError(c *gin.Context, err *UpstreamContentError) {
+	logger.Error("上游返回非预期响应",
+		addReqFields(c,
+			logger.String("direction", "upstream_response"),
+			logger.Int("status_code", err.StatusCode),
+			logger.String("content_type", err.ContentType),
+			logger.String("body_kind", err.Kind),
+			logger.String("snippet", err.Snippet),
+		)...)
+	recordErrorSample(c, "upstream_content", err.StatusCode, err.Error())
+	respondErrorWithCode(c, http.StatusBadGateway, ErrCodeUpstreamInvalidResponse,
+		"上游返回了非预期的%s响应（HTTP %d，可能被代理、验证门户或WAF拦截）: %s", err.Kind, err.StatusCode, err.Snippet)
 }
 
 func handleResponseReadError(c *gin.Context, err error) {
 	logger.Error("读取响应体失败", addReqFields(c, logger.Err(err))...)
-	respondError(c, http.StatusInternalServerError, "读取响应体失败: %v", err)
+	if cancelledByAdmin(c) {
+		respondCancelledByAdmin(c)
+		return
+	}
+	respondAPIError(c, newAPIError(streamErrUpstreamDisconnected, err, "读取响应体失败: %v", err))
 }
 
 // 通用请求执行函数
@@ -88,35 +136,139 @@ func filterSupportedTools(tools []types.AnthropicTool) []types.AnthropicTool {
 }
 
 func executeCodeWhispererRequest(c *gin.Context, anthropicReq types.AnthropicRequest, tokenInfo types.TokenInfo, isStream bool) (*http.Response, error) {
-	req, err := buildCodeWhispererRequest(c, anthropicReq, tokenInfo, isStream)
-	if err != nil {
-		// 检查是否是模型未找到错误，如果是，则响应已经发送，不需要再次处理
-		if _, ok := err.(*types.ModelNotFoundErrorType); ok {
+	// 上游返回账号级错误（401/403/429）且尚未向客户端写出响应体时，切换token重试
+	for attempt := 0; ; attempt++ {
+		// 认领选择token时预留的账号并发名额（maxConcurrent），出错或响应体关闭时归还
+		release := auth.AccountSlots.Claim(tokenInfo.SlotLease, tokenInfo.ConfigID)
+		req, err := buildCodeWhispererRequest(c, anthropicReq, tokenInfo, isStream)
+		if err != nil {
+			release()
+			// 检查是否是模型未找到错误，如果是，则响应已经发送，不需要再次处理
+			if _, ok := err.(*types.ModelNotFoundErrorType); ok {
+				return nil, err
+			}
+			var imageErr *types.InvalidImageError
+			if errors.As(err, &imageErr) {
+				logger.Warn("图片输入无效", addReqFields(c, logger.Err(err))...)
+				respondErrorWithCode(c, http.StatusBadRequest, ErrCodeInvalidImage, "%s", imageErr.Error())
+				return nil, err
+			}
+			handleRequestBuildError(c, err)
 			return nil, err
 		}
-		handleRequestBuildError(c, err)
-		return nil, err
+
+		account := accountKeyFromRefreshToken(tokenInfo.RefreshToken)
+
+		breakerKey := auth.InferenceBreakerKey(tokenInfo.ConfigID)
+
+		// 登记当前使用的模型与token，供 /api/requests/active 查看
+		noteActiveRequest(c, anthropicReq.Model, tokenInfo.ConfigID, isStream)
+		setAuditAccount(c, tokenInfo.ConfigID)
+
+		resp, err := utils.DoRequestViaProxy(req, tokenInfo.ProxyURL)
+		if err != nil {
+			release()
+			// 客户端主动断开不是上游故障，不计入熔断与故障检测
+			if !errors.Is(err, context.Canceled) {
+				upstreamIncidents.RecordFailure(account, 0, err.Error())
+				auth.UpstreamBreakers.RecordFailure(breakerKey, err.Error())
+			}
+			handleRequestSendError(c, err)
+			return nil, err
+		}
+
+		resp.Body = &slotReleasingBody{ReadCloser: captureUpstreamResponse(c, resp), release: release}
+
+		// 成功状态码但响应体不是事件流（验证门户、WAF拦截页等）时按上游故障处理
+		if resp.StatusCode == http.StatusOK {
+			if contentErr := guardUpstreamStream(resp); contentErr != nil {
+				resp.Body.Close()
+				upstreamIncidents.RecordFailure(account, resp.StatusCode, contentErr.Error())
+				auth.UpstreamBreakers.RecordFailure(breakerKey, contentErr.Error())
+				handleUpstreamContentError(c, contentErr)
+				return nil, contentErr
+			}
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			upstreamIncidents.RecordFailure(account, resp.StatusCode, resp.Status)
+		} else {
+			upstreamIncidents.RecordSuccess(account)
+		}
+		// 熔断器只统计上游侧故障（5xx），账号级错误（401/403/429）视为上游可达
+		if isUpstreamSideStatus(resp.StatusCode) {
+			auth.UpstreamBreakers.RecordFailure(breakerKey, resp.Status)
+		} else {
+			auth.UpstreamBreakers.RecordSuccess(breakerKey)
+		}
+
+		if resp.StatusCode != http.StatusOK {
+			if next, ok := nextRetryToken(c, tokenInfo, resp.StatusCode, attempt); ok {
+				_, _ = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+				tokenInfo = next
+				continue
+			}
+		}
+
+		if handleCodeWhispererError(c, resp) {
+			resp.Body.Close()
+			return nil, fmt.Errorf("CodeWhisperer API error")
+		}
+
+		// 上游响应成功，记录方向与会话
+		logger.Debug("上游响应成功",
+			addReqFields(c,
+				logger.String("direction", "upstream_response"),
+				logger.Int("status_code", resp.StatusCode),
+				logger.Int("attempts", attempt+1),
+			)...)
+
+		return resp, nil
 	}
+}
 
-	resp, err := utils.DoRequest(req)
-	if err != nil {
-		handleRequestSendError(c, err)
-		return nil, err
+// holdSlotLease 登记请求选择token时预留的并发名额，请求结束时由 ActiveRequestMiddleware 取消未认领的预留
+// （如请求校验失败而未发出上游请求），避免名额等到预留到期才归还
+func holdSlotLease(c *gin.Context, lease uint64) {
+	if lease == 0 {
+		return
 	}
+	leases, _ := c.Get(slotLeasesKey)
+	held, _ := leases.([]uint64)
+	c.Set(slotLeasesKey, append(held, lease))
+}
 
-	if handleCodeWhispererError(c, resp) {
-		resp.Body.Close()
-		return nil, fmt.Errorf("CodeWhisperer API error")
+// cancelSlotLeases 取消并清空请求登记的预留名额，已认领的预留忽略
+func cancelSlotLeases(c *gin.Context) {
+	leases, _ := c.Get(slotLeasesKey)
+	held, _ := leases.([]uint64)
+	for _, lease := range held {
+		auth.AccountSlots.Cancel(lease)
 	}
+	if len(held) > 0 {
+		c.Set(slotLeasesKey, []uint64(nil))
+	}
+}
 
-	// 上游响应成功，记录方向与会话
-	logger.Debug("上游响应成功",
-		addReqFields(c,
-			logger.String("direction", "upstream_response"),
-			logger.Int("status_code", resp.StatusCode),
-		)...)
+// slotReleasingBody 关闭响应体时归还账号的并发名额
+type slotReleasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *slotReleasingBody) Close() error {
+	b.release()
+	return b.ReadCloser.Close()
+}
+
+// upstreamRequestIDHeader 透传请求ID给上游时使用的请求头（UPSTREAM_REQUEST_ID_HEADER，默认不透传）
+// StartServer 在加载配置后经 loadUpstreamRequestIDHeaderFromEnv 设置
+var upstreamRequestIDHeader string
 
-	return resp, nil
+// loadUpstreamRequestIDHeaderFromEnv 从环境变量读取透传请求ID的请求头名
+func loadUpstreamRequestIDHeaderFromEnv() string {
+	return strings.TrimSpace(utils.GetEnvWithDefault("UPSTREAM_REQUEST_ID_HEADER", ""))
 }
 
 // execCWRequest 供测试覆盖的请求执行入口（可在测试中替换）
@@ -124,7 +276,11 @@ var execCWRequest = executeCodeWhispererRequest
 
 // buildCodeWhispererRequest 构建通用的CodeWhisperer请求
 func buildCodeWhispererRequest(c *gin.Context, anthropicReq types.AnthropicRequest, tokenInfo types.TokenInfo, isStream bool) (*http.Request, error) {
+	_, span := tracing.Start(c.Request.Context(), "converter.build_request",
+		attribute.Int("converter.message_count", len(anthropicReq.Messages)),
+		attribute.Int("converter.tool_count", len(anthropicReq.Tools)))
 	cwReq, err := converter.BuildCodeWhispererRequest(anthropicReq, c)
+	tracing.End(span, err)
 	if err != nil {
 		// 检查是否是模型未找到错误
 		if modelNotFoundErr, ok := err.(*types.ModelNotFoundErrorType); ok {
@@ -132,13 +288,14 @@ func buildCodeWhispererRequest(c *gin.Context, anthropicReq types.AnthropicReque
 			c.JSON(http.StatusBadRequest, modelNotFoundErr.ErrorData)
 			return nil, err
 		}
-		return nil, fmt.Errorf("构建CodeWhisperer请求失败: %v", err)
+		return nil, newAPIError(ErrCodeConversionFailed, err, "请求转换失败: %v", err)
 	}
 
 	cwReqBody, err := utils.SafeMarshal(cwReq)
 	if err != nil {
 		return nil, fmt.Errorf("序列化请求失败: %v", err)
 	}
+	captureUpstreamRequest(c, cwReqBody)
 
 	// 临时调试：记录发送给CodeWhisperer的请求内容
 	// 补充：当工具直传启用时输出工具名称预览
@@ -160,12 +317,19 @@ func buildCodeWhispererRequest(c *gin.Context, anthropicReq types.AnthropicReque
 		logger.Int("tools_count", len(cwReq.ConversationState.CurrentMessage.UserInputMessage.UserInputMessageContext.Tools)),
 		logger.String("tools_names", toolNamesPreview))
 
-	req, err := http.NewRequest("POST", config.CodeWhispererURL, bytes.NewReader(cwReqBody))
+	// 绑定下游请求上下文：客户端断开或请求总时长到期时取消上游请求
+	req, err := http.NewRequestWithContext(c.Request.Context(), "POST", config.CodeWhispererURL, bytes.NewReader(cwReqBody))
 	if err != nil {
 		return nil, fmt.Errorf("创建请求失败: %v", err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+tokenInfo.AccessToken)
+	// 可选：将请求ID透传给上游，便于与上游日志关联
+	if upstreamRequestIDHeader != "" {
+		if rid := GetRequestID(c); rid != "" {
+			req.Header.Set(upstreamRequestIDHeader, rid)
+		}
+	}
 	req.Header.Set("Content-Type", "application/json")
 	if isStream {
 		req.Header.Set("Accept", "text/event-stream")
@@ -192,7 +356,13 @@ func handleCodeWhispererError(c *gin.Context, resp *http.Response) bool {
 				logger.String("direction", "upstream_response"),
 				logger.Err(err),
 			)...)
-		respondError(c, http.StatusInternalServerError, "%s", "读取响应失败")
+		respondAPIError(c, newAPIError(streamErrUpstreamDisconnected, err, "%s", "读取响应失败"))
+		return true
+	}
+
+	// HTML错误页或非JSON文本（网关、WAF拦截等）不是上游业务错误，转换为带片段的结构化错误
+	if kind := classifyUpstreamBody(resp.Header.Get("Content-Type"), body); kind != upstreamBodyJSON && len(bytes.TrimSpace(body)) > 0 {
+		handleUpstreamContentError(c, newUpstreamContentError(resp, kind, body))
 		return true
 	}
 
@@ -203,11 +373,12 @@ func handleCodeWhispererError(c *gin.Context, resp *http.Response) bool {
 			logger.Int("response_len", len(body)),
 			logger.String("response_body", string(body)),
 		)...)
+	recordErrorSample(c, "upstream_response", resp.StatusCode, string(body))
 
-	// 特殊处理：403错误表示token失效 (保持向后兼容)
+	// 特殊处理：403错误表示token失效
 	if resp.StatusCode == http.StatusForbidden {
 		logger.Warn("收到403错误，token可能已失效")
-		respondErrorWithCode(c, http.StatusUnauthorized, "unauthorized", "%s", "Token已失效，请重试")
+		respondAPIError(c, newAPIError(ErrCodeAuthExpired, nil, "%s", "Token已失效，请重试"))
 		return true
 	}
 
@@ -225,8 +396,12 @@ func handleCodeWhispererError(c *gin.Context, resp *http.Response) bool {
 			)...)
 		errorMapper.SendClaudeError(c, claudeError)
 	} else {
-		// 其他错误使用传统方式处理 (向后兼容)
-		respondErrorWithCode(c, http.StatusInternalServerError, "cw_error", "CodeWhisperer Error: %s", string(body))
+		// 其他错误：上游限流与其他上游错误分别使用对应的错误码
+		code := ErrCodeUpstreamError
+		if resp.StatusCode == http.StatusTooManyRequests {
+			code = ErrCodeUpstreamThrottled
+		}
+		respondAPIError(c, newAPIError(code, nil, "CodeWhisperer Error: %s", string(body)))
 	}
 
 	return true
@@ -251,44 +426,76 @@ func (s *AnthropicStreamSender) SendEvent(c *gin.Context, data any) error {
 
 	}
 
-	json, err := utils.SafeMarshal(data)
-	if err != nil {
+	// 在复用的缓冲区中组装完整事件，一次写出
+	buf := utils.GetBuffer()
+	defer utils.PutBuffer(buf)
+	buf.WriteString("event: ")
+	buf.WriteString(eventType)
+	buf.WriteString("\ndata: ")
+	start := buf.Len()
+	if err := utils.AppendJSON(buf, data); err != nil {
 		return err
 	}
 
-	// 压缩日志：仅记录事件类型与负载长度
-	logger.Debug("发送SSE事件",
-		addReqFields(c,
-			// logger.String("direction", "downstream_send"),
-			logger.String("event", eventType),
-			// logger.Int("payload_len", len(json)),
-			logger.String("payload_preview", string(json)),
-		)...)
+	// 压缩日志：仅记录事件类型与负载（仅DEBUG级别时转换负载，避免每个事件多一次拷贝）
+	if logger.GetLevel() <= logger.DEBUG {
+		logger.Debug("发送SSE事件",
+			addReqFields(c,
+				logger.String("event", eventType),
+				logger.String("payload_preview", string(buf.Bytes()[start:])),
+			)...)
+	}
 
-	fmt.Fprintf(c.Writer, "event: %s\n", eventType)
-	fmt.Fprintf(c.Writer, "data: %s\n\n", string(json))
+	buf.WriteString("\n\n")
+	_, _ = c.Writer.Write(buf.Bytes())
 	c.Writer.Flush()
 	return nil
 }
 
-func (s *AnthropicStreamSender) SendError(c *gin.Context, message string, _ error) error {
-	errorResp := map[string]any{
-		"type": "error",
-		"error": map[string]any{
-			"type":    "overloaded_error",
-			"message": message,
-		},
+// SendError 发送 error 事件；err 为流错误时携带对应的错误类型与机器可读的 code
+func (s *AnthropicStreamSender) SendError(c *gin.Context, message string, err error) error {
+	code := streamErrorCode(err)
+	recordErrorCode(c, code)
+	body := map[string]any{
+		"type":    anthropicStreamErrorType(code),
+		"message": message,
 	}
-	return s.SendEvent(c, errorResp)
+	if code != "" {
+		body["code"] = code
+	}
+	return s.SendEvent(c, map[string]any{"type": "error", "error": body})
 }
 
 // OpenAIStreamSender OpenAI格式的流事件发送器
-type OpenAIStreamSender struct{}
+type OpenAIStreamSender struct {
+	// transform 发送前改写事件（如转换为旧版补全或 Gemini 格式），返回 nil 时跳过该事件
+	transform func(map[string]any) any
+	// omitDone 结束时不发送 [DONE] 标记（Gemini 流没有结束标记）
+	omitDone bool
+	// errorEvent 流中错误事件的格式（如 Ollama 的 {"error": msg}），为空时使用 OpenAI 错误格式
+	errorEvent func(message string) any
+	// emitter 传输层，为空时以 SSE 下发
+	emitter streamEmitter
+}
+
+// transport 返回发送器使用的传输层
+func (s *OpenAIStreamSender) transport() streamEmitter {
+	if s.emitter == nil {
+		return sseEmitter{}
+	}
+	return s.emitter
+}
 
 func (s *OpenAIStreamSender) SendEvent(c *gin.Context, data any) error {
+	if event, ok := data.(map[string]any); ok && s.transform != nil {
+		if data = s.transform(event); data == nil {
+			return nil
+		}
+	}
 
-	json, err := utils.SafeMarshal(data)
-	if err != nil {
+	buf := utils.GetBuffer()
+	defer utils.PutBuffer(buf)
+	if err := utils.AppendJSON(buf, data); err != nil {
 		return err
 	}
 
@@ -296,61 +503,162 @@ func (s *OpenAIStreamSender) SendEvent(c *gin.Context, data any) error {
 	logger.Debug("发送OpenAI SSE事件",
 		addReqFields(c,
 			logger.String("direction", "downstream_send"),
-			logger.Int("payload_len", len(json)),
+			logger.Int("payload_len", buf.Len()),
 		)...)
 
-	fmt.Fprintf(c.Writer, "data: %s\n\n", string(json))
-	c.Writer.Flush()
-	return nil
+	return s.transport().emit(c, buf.Bytes())
 }
 
-func (s *OpenAIStreamSender) SendError(c *gin.Context, message string, _ error) error {
-	errorResp := map[string]any{
+// SendDone 发送流结束标记
+func (s *OpenAIStreamSender) SendDone(c *gin.Context) {
+	if s.omitDone {
+		return
+	}
+	_ = s.transport().done(c)
+}
+
+// SendError 发送错误数据块；err 为流错误时 code 为对应的机器可读错误码
+func (s *OpenAIStreamSender) SendError(c *gin.Context, message string, err error) error {
+	code := streamErrorCode(err)
+	if code == "" {
+		code = ErrCodeInternal
+	}
+	recordErrorCode(c, code)
+	openAIType, _ := errorTypes(code, errorStatus(code))
+	var errorResp any = map[string]any{
 		"error": map[string]any{
 			"message": message,
-			"type":    "server_error",
-			"code":    "internal_error",
+			"type":    openAIType,
+			"code":    code,
 		},
 	}
+	if s.errorEvent != nil {
+		errorResp = s.errorEvent(message)
+	}
 
 	json, err := utils.FastMarshal(errorResp)
 	if err != nil {
 		return err
 	}
+	return s.transport().emit(c, json)
+}
 
-	fmt.Fprintf(c.Writer, "data: %s\n\n", string(json))
-	c.Writer.Flush()
-	return nil
+// tokenUnavailableError 获取token失败的原因对应的错误码
+// - 全部达到并发上限时返回429，有请求结束后即可重试
+// - 全部熔断或账号池耗尽时返回503便于客户端稍后重试
+// - 没有账号支持该模型时返回400，重试无意义，需更换模型或调整账号配置
+func tokenUnavailableError(err error) *APIError {
+	switch {
+	case isTimeoutError(err):
+		return newAPIError(ErrCodeRequestTimeout, err, "等待可用token超时: %v", err)
+	case errors.Is(err, auth.ErrNoEligibleToken):
+		return newAPIError(ErrCodeNoEligibleAccount, err, "获取token失败: %v", err)
+	case errors.Is(err, auth.ErrAllTokensBusy):
+		return newAPIError(ErrCodeAccountsBusy, err, "获取token失败: %v", err)
+	case errors.Is(err, auth.ErrAllTokensCircuitOpen):
+		return newAPIError(ErrCodeAccountsUnavailable, err, "获取token失败: %v", err)
+	case errors.Is(err, auth.ErrTokenPoolExhausted):
+		return newAPIError(ErrCodeTokenPoolEmpty, err, "获取token失败: %v", err)
+	default:
+		return newAPIError(ErrCodeInternal, err, "获取token失败: %v", err)
+	}
+}
+
+// respondTokenUnavailable 返回获取token失败的错误响应
+func respondTokenUnavailable(c *gin.Context, err error) {
+	var rejected *QueueRejectedError
+	if errors.As(err, &rejected) {
+		respondQueueRejected(c, rejected)
+		return
+	}
+	apiErr := tokenUnavailableError(err)
+	if apiErr.Code == ErrCodeAccountsBusy {
+		c.Header("Retry-After", "1")
+	}
+	respondAPIError(c, apiErr)
+}
+
+// requestModelKey 上下文中保存的请求模型，切换token重试时按同一模型选择账号
+const requestModelKey = "request_model"
+
+// peekRequestModel 从请求体中读取模型名（解析失败时返回空串，由后续转换逻辑报错）
+func peekRequestModel(body []byte) string {
+	var req struct {
+		Model string `json:"model"`
+	}
+	if err := utils.FastUnmarshal(body, &req); err != nil {
+		return ""
+	}
+	return req.Model
+}
+
+// modelTokenSource 按模型选择账号的token来源（AuthService 或测试替身）
+type modelTokenSource interface {
+	GetTokenForModel(model string) (types.TokenInfo, error)
+	GetTokenWithUsageForModel(model string) (*types.TokenWithUsage, error)
 }
 
 // RequestContext 请求处理上下文，封装通用的请求处理逻辑
 type RequestContext struct {
 	GinContext  *gin.Context
-	AuthService interface {
-		GetToken() (types.TokenInfo, error)
-		GetTokenWithUsage() (*types.TokenWithUsage, error)
-	}
+	AuthService modelTokenSource
 	RequestType string // "anthropic" 或 "openai"
+	Model       string // 模型名不在请求体中时（如 Gemini 路径参数）显式指定
+}
+
+// readBody 读取请求体并记录请求模型，按调用方密钥的策略校验模型与工具（违反策略时已写出错误响应）
+func (rc *RequestContext) readBody() ([]byte, string, error) {
+	body, err := rc.GinContext.GetRawData()
+	if err != nil {
+		logger.Error("读取请求体失败", logger.Err(err))
+		respondError(rc.GinContext, http.StatusBadRequest, "读取请求体失败: %v", err)
+		return nil, "", err
+	}
+	model := rc.Model
+	if model == "" {
+		model = peekRequestModel(body)
+	}
+	rc.GinContext.Set(requestModelKey, model)
+	if !checkKeyPolicy(rc.GinContext, model, body) {
+		return nil, "", errKeyPolicyViolation
+	}
+	return body, model, nil
 }
 
 // GetTokenAndBody 通用的token获取和请求体读取
+// 先读取请求体，按请求的模型选择支持该模型的账号（配置了多租户时只在调用方密钥允许的账号标签内选择）
+// 账号池耗尽时若配置了备用上游，请求转发到备用上游，此时仍返回原错误（响应已写出）
 // 返回: tokenInfo, requestBody, error
 func (rc *RequestContext) GetTokenAndBody() (types.TokenInfo, []byte, error) {
-	// 获取token
-	tokenInfo, err := rc.AuthService.GetToken()
+	// 读取请求体
+	body, model, err := rc.readBody()
 	if err != nil {
-		logger.Error("获取token失败", logger.Err(err))
-		respondError(rc.GinContext, http.StatusInternalServerError, "获取token失败: %v", err)
 		return types.TokenInfo{}, nil, err
 	}
 
-	// 读取请求体
-	body, err := rc.GinContext.GetRawData()
+	// 获取token
+	_, span := tracing.Start(rc.GinContext.Request.Context(), "token.select", attribute.String("gen_ai.request.model", model))
+	source := tenantScopedSource(rc.GinContext, rc.AuthService)
+	preferID := stickyPreference(rc.GinContext, body)
+	tokenInfo, err := acquireTokenQueued(rc.GinContext, func() (types.TokenInfo, error) {
+		if sticky, ok := source.(stickyTokenSource); ok && preferID != "" {
+			return sticky.GetTokenForModelPreferring(model, preferID)
+		}
+		return source.GetTokenForModel(model)
+	})
+	span.SetAttributes(attribute.String("auth.config_id", tokenInfo.ConfigID))
+	tracing.End(span, err)
 	if err != nil {
-		logger.Error("读取请求体失败", logger.Err(err))
-		respondError(rc.GinContext, http.StatusBadRequest, "读取请求体失败: %v", err)
+		logger.Error("获取token失败", logger.String("model", model), logger.Err(err))
+		if !fallbackChain.serveFallback(rc.GinContext, body, model, err) {
+			respondTokenUnavailable(rc.GinContext, err)
+		}
 		return types.TokenInfo{}, nil, err
 	}
+	setTokenSource(rc.GinContext, source)
+	markKiroBackend(rc.GinContext)
+	rememberStickyToken(rc.GinContext, preferID, tokenInfo.ConfigID)
+	holdSlotLease(rc.GinContext, tokenInfo.SlotLease)
 
 	// 记录请求日志
 	logger.Debug(fmt.Sprintf("收到%s请求", rc.RequestType),
@@ -368,21 +676,39 @@ func (rc *RequestContext) GetTokenAndBody() (types.TokenInfo, []byte, error) {
 // GetTokenWithUsageAndBody 获取token（包含使用信息）和请求体
 // 返回: tokenWithUsage, requestBody, error
 func (rc *RequestContext) GetTokenWithUsageAndBody() (*types.TokenWithUsage, []byte, error) {
-	// 获取token（包含使用信息）
-	tokenWithUsage, err := rc.AuthService.GetTokenWithUsage()
+	// 读取请求体
+	body, model, err := rc.readBody()
 	if err != nil {
-		logger.Error("获取token失败", logger.Err(err))
-		respondError(rc.GinContext, http.StatusInternalServerError, "获取token失败: %v", err)
 		return nil, nil, err
 	}
 
-	// 读取请求体
-	body, err := rc.GinContext.GetRawData()
+	// 获取token（包含使用信息）
+	_, span := tracing.Start(rc.GinContext.Request.Context(), "token.select", attribute.String("gen_ai.request.model", model))
+	source := tenantScopedSource(rc.GinContext, rc.AuthService)
+	preferID := stickyPreference(rc.GinContext, body)
+	tokenWithUsage, err := acquireTokenQueued(rc.GinContext, func() (*types.TokenWithUsage, error) {
+		if sticky, ok := source.(stickyTokenSource); ok && preferID != "" {
+			return sticky.GetTokenWithUsageForModelPreferring(model, preferID)
+		}
+		return source.GetTokenWithUsageForModel(model)
+	})
+	if tokenWithUsage != nil {
+		span.SetAttributes(
+			attribute.String("auth.config_id", tokenWithUsage.ConfigID),
+			attribute.Float64("auth.available_count", tokenWithUsage.AvailableCount))
+	}
+	tracing.End(span, err)
 	if err != nil {
-		logger.Error("读取请求体失败", logger.Err(err))
-		respondError(rc.GinContext, http.StatusBadRequest, "读取请求体失败: %v", err)
+		logger.Error("获取token失败", logger.String("model", model), logger.Err(err))
+		if !fallbackChain.serveFallback(rc.GinContext, body, model, err) {
+			respondTokenUnavailable(rc.GinContext, err)
+		}
 		return nil, nil, err
 	}
+	setTokenSource(rc.GinContext, source)
+	markKiroBackend(rc.GinContext)
+	rememberStickyToken(rc.GinContext, preferID, tokenWithUsage.ConfigID)
+	holdSlotLease(rc.GinContext, tokenWithUsage.SlotLease)
 
 	// 记录请求日志
 	logger.Debug(fmt.Sprintf("收到%s请求", rc.RequestType),
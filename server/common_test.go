@@ -4,14 +4,20 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"kiro2api/auth"
+	"kiro2api/converter"
 	"kiro2api/types"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func init() {
@@ -23,13 +29,16 @@ type MockAuthService struct {
 	token      types.TokenInfo
 	tokenUsage *types.TokenWithUsage
 	err        error
+	model      string // 最近一次请求的模型
 }
 
-func (m *MockAuthService) GetToken() (types.TokenInfo, error) {
+func (m *MockAuthService) GetTokenForModel(model string) (types.TokenInfo, error) {
+	m.model = model
 	return m.token, m.err
 }
 
-func (m *MockAuthService) GetTokenWithUsage() (*types.TokenWithUsage, error) {
+func (m *MockAuthService) GetTokenWithUsageForModel(model string) (*types.TokenWithUsage, error) {
+	m.model = model
 	if m.tokenUsage != nil {
 		return m.tokenUsage, m.err
 	}
@@ -43,6 +52,20 @@ func (m *MockAuthService) GetTokenWithUsage() (*types.TokenWithUsage, error) {
 	}, nil
 }
 
+func TestRespondInvalidRequest(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	respondInvalidRequest(c, converter.ValidateOpenAIChatRequest(types.OpenAIRequest{Model: "m"}))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":{"message":"缺少必填参数: messages","type":"invalid_request_error","param":"messages","code":"missing_required_parameter"}}`, w.Body.String())
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	respondInvalidRequest(c, errors.New("stop 最多支持 4 个停止序列"))
+	assert.JSONEq(t, `{"error":{"message":"stop 最多支持 4 个停止序列","type":"invalid_request_error","param":null,"code":"invalid_request_error"}}`, w.Body.String())
+}
+
 func TestRespondError(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -185,7 +208,7 @@ func TestHandleRequestSendError(t *testing.T) {
 	testErr := assert.AnError
 	handleRequestSendError(c, testErr)
 
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
 
 	var response map[string]any
 	err := json.Unmarshal(w.Body.Bytes(), &response)
@@ -193,7 +216,8 @@ func TestHandleRequestSendError(t *testing.T) {
 
 	errorObj, ok := response["error"].(map[string]any)
 	assert.True(t, ok)
-	assert.Equal(t, "internal_error", errorObj["code"])
+	assert.Equal(t, "upstream_unreachable", errorObj["code"])
+	assert.Equal(t, "server_error", errorObj["type"])
 	assert.Contains(t, errorObj["message"], "发送请求失败")
 }
 
@@ -204,7 +228,7 @@ func TestHandleResponseReadError(t *testing.T) {
 	testErr := assert.AnError
 	handleResponseReadError(c, testErr)
 
-	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
 
 	var response map[string]any
 	err := json.Unmarshal(w.Body.Bytes(), &response)
@@ -212,7 +236,7 @@ func TestHandleResponseReadError(t *testing.T) {
 
 	errorObj, ok := response["error"].(map[string]any)
 	assert.True(t, ok)
-	assert.Equal(t, "internal_error", errorObj["code"])
+	assert.Equal(t, "upstream_disconnected", errorObj["code"])
 	assert.Contains(t, errorObj["message"], "读取响应体失败")
 }
 
@@ -280,3 +304,101 @@ func TestOpenAIStreamSender_SendEvent(t *testing.T) {
 	body := w.Body.String()
 	assert.Contains(t, body, "data:")
 }
+
+func TestRequestContext_SelectsTokenByRequestModel(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/messages", bytes.NewBufferString(`{"model":"claude-opus-4-1-20250805"}`))
+
+	mockAuth := &MockAuthService{token: types.TokenInfo{AccessToken: "t"}}
+	reqCtx := &RequestContext{GinContext: c, AuthService: mockAuth, RequestType: "test"}
+	_, _, err := reqCtx.GetTokenWithUsageAndBody()
+	assert.NoError(t, err)
+	assert.Equal(t, "claude-opus-4-1-20250805", mockAuth.model)
+	assert.Equal(t, "claude-opus-4-1-20250805", c.GetString(requestModelKey))
+}
+
+func TestRequestContext_NoEligibleAccount(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/messages", bytes.NewBufferString(`{"model":"claude-haiku-4-5-20251001"}`))
+
+	mockAuth := &MockAuthService{err: fmt.Errorf("%w: claude-haiku-4-5-20251001", auth.ErrNoEligibleToken)}
+	reqCtx := &RequestContext{GinContext: c, AuthService: mockAuth, RequestType: "test"}
+	_, _, err := reqCtx.GetTokenAndBody()
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "no_eligible_account")
+}
+
+func TestRequestContext_AccountsBusy(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/messages", bytes.NewBufferString(`{"model":"claude-sonnet-4-20250514"}`))
+
+	mockAuth := &MockAuthService{err: auth.ErrAllTokensBusy}
+	reqCtx := &RequestContext{GinContext: c, AuthService: mockAuth, RequestType: "test"}
+	_, _, err := reqCtx.GetTokenAndBody()
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "accounts_busy")
+}
+
+func TestSlotReleasingBody(t *testing.T) {
+	release := auth.AccountSlots.Acquire("slot-test")
+	body := &slotReleasingBody{ReadCloser: io.NopCloser(strings.NewReader("")), release: release}
+	assert.Equal(t, 1, auth.AccountSlots.InFlight("slot-test"))
+	assert.NoError(t, body.Close())
+	assert.NoError(t, body.Close())
+	assert.Equal(t, 0, auth.AccountSlots.InFlight("slot-test"))
+}
+
+func TestCancelSlotLeases(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	claimed, ok := auth.AccountSlots.Reserve("lease-test", 2)
+	require.True(t, ok)
+	unclaimed, ok := auth.AccountSlots.Reserve("lease-test", 2)
+	require.True(t, ok)
+	holdSlotLease(c, claimed)
+	holdSlotLease(c, unclaimed)
+	release := auth.AccountSlots.Claim(claimed, "lease-test")
+
+	// 请求结束时只归还未认领的预留，已认领的名额由响应体关闭时归还
+	cancelSlotLeases(c)
+	assert.Equal(t, 1, auth.AccountSlots.InFlight("lease-test"))
+	release()
+	assert.Equal(t, 0, auth.AccountSlots.InFlight("lease-test"))
+}
+
+func TestExecuteCodeWhispererRequest_InvalidImage(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/messages", nil)
+	anthropicReq := types.AnthropicRequest{
+		Model:     "claude-sonnet-4-20250514",
+		MaxTokens: 100,
+		Messages: []types.AnthropicRequestMessage{{
+			Role: "user",
+			Content: []any{map[string]any{
+				"type":      "image_url",
+				"image_url": map[string]any{"url": "ftp://example.com/a.png"},
+			}},
+		}},
+	}
+
+	_, err := executeCodeWhispererRequest(c, anthropicReq, types.TokenInfo{AccessToken: "t"}, false)
+
+	var imageErr *types.InvalidImageError
+	assert.ErrorAs(t, err, &imageErr)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var body struct {
+		Type  string         `json:"type"`
+		Error map[string]any `json:"error"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "error", body.Type)
+	assert.Equal(t, "invalid_request_error", body.Error["type"])
+	assert.Equal(t, "invalid_image", body.Error["code"])
+	assert.Contains(t, body.Error["message"], "仅支持data URL或http(s)图片地址")
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+
+	"kiro2api/auth"
+	"kiro2api/converter"
+	"kiro2api/logger"
+	"kiro2api/types"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleTextCompletions 旧版 OpenAI 文本补全端点（POST /v1/completions）
+// 提示包装为单条用户消息后走与 /v1/chat/completions 相同的转换、策略与响应处理，响应转换为 text_completion 格式
+func handleTextCompletions(authService *auth.AuthService, promptPolicies *PromptPolicies, responseCache *ResponseCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reqCtx := &RequestContext{
+			GinContext:  c,
+			AuthService: authService,
+			RequestType: "OpenAI",
+		}
+
+		tokenInfo, body, err := reqCtx.GetTokenAndBody()
+		if err != nil {
+			return // 错误已在GetTokenAndBody中处理
+		}
+
+		var completionReq types.OpenAICompletionRequest
+		if err := utils.SafeUnmarshal(body, &completionReq); err != nil {
+			logger.Error("解析补全请求体失败", logger.Err(err))
+			respondError(c, http.StatusBadRequest, "解析请求体失败: %v", err)
+			return
+		}
+
+		setAuditModel(c, completionReq.Model)
+
+		if err := converter.ValidateCompletionRequest(completionReq); err != nil {
+			respondInvalidRequest(c, err)
+			return
+		}
+		echo := ""
+		if completionReq.Echo {
+			echo, _ = converter.CompletionPrompt(completionReq)
+		}
+
+		// 按调用方密钥应用系统提示策略，再转换为Anthropic格式并应用模型默认参数
+		openaiReq, policySystem := promptPolicies.ForKey(GetClientKeyID(c)).ApplyOpenAI(converter.ConvertCompletionToChat(completionReq))
+		anthropicReq := clampKeyPolicy(c, converter.ApplyModelDefaults(converter.ConvertOpenAIToAnthropic(openaiReq)))
+		if len(policySystem) > 0 {
+			anthropicReq.System = append(policySystem, anthropicReq.System...)
+		}
+		anthropicReq, err = guardInput(c, anthropicReq)
+		if err != nil {
+			respondInvalidRequest(c, err)
+			return
+		}
+
+		if anthropicReq.Stream {
+			includeUsage := openaiReq.StreamOptions != nil && openaiReq.StreamOptions.IncludeUsage
+			streamOpenAIResponse(c, anthropicReq, tokenInfo, includeUsage, textCompletionStreamSender(echo))
+			return
+		}
+		cacheKey := struct {
+			Request types.AnthropicRequest `json:"request"`
+			Echo    string                 `json:"echo,omitempty"`
+		}{anthropicReq, echo}
+		serveWithResponseCache(c, responseCache, "completions", cacheKey, func() {
+			openaiResp, ok := buildOpenAIResponse(c, anthropicReq, tokenInfo, nil)
+			if !ok {
+				return
+			}
+			c.JSON(http.StatusOK, converter.ConvertChatToTextCompletion(openaiResp, echo))
+		})
+	}
+}
+
+// textCompletionStreamSender 将聊天补全增量块转换为旧版补全块的发送器
+// echo 非空时以首个块（原角色块）回显提示
+func textCompletionStreamSender(echo string) *OpenAIStreamSender {
+	return &OpenAIStreamSender{transform: func(chunk map[string]any) any {
+		if echo != "" {
+			text := echo
+			echo = ""
+			chunk["choices"] = []map[string]any{{"index": 0, "delta": map[string]any{"content": text}, "finish_reason": nil}}
+		}
+		if converted := converter.ConvertChatChunkToTextCompletion(chunk); converted != nil {
+			return converted
+		}
+		return nil
+	}}
+}
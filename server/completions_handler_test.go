@@ -0,0 +1,45 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTextCompletionStream(t *testing.T) {
+	upstream := withUpstreamUsage(thinkingUpstream("Hello", " world"), `{"tokenUsage":{"inputTokens":7,"outputTokens":2}}`)
+	body := replayStream(t, upstream, func(c *gin.Context, req types.AnthropicRequest) {
+		streamOpenAIResponse(c, req, types.TokenInfo{}, true, textCompletionStreamSender("Say hi:"))
+	})
+
+	var text string
+	var finishReason any
+	var usage map[string]any
+	events := parseSSE(t, body)
+	require.NotEmpty(t, events)
+	assert.Equal(t, "[DONE]", events[len(events)-1].Data)
+	for _, ev := range events[:len(events)-1] {
+		var chunk map[string]any
+		require.NoError(t, json.Unmarshal([]byte(ev.Data), &chunk))
+		assert.Equal(t, "text_completion", chunk["object"])
+		assert.Regexp(t, `^cmpl-`, chunk["id"])
+		if u, ok := chunk["usage"].(map[string]any); ok {
+			usage = u
+		}
+		for _, choice := range chunk["choices"].([]any) {
+			choice := choice.(map[string]any)
+			text += choice["text"].(string)
+			if choice["finish_reason"] != nil {
+				finishReason = choice["finish_reason"]
+			}
+		}
+	}
+	assert.Equal(t, "Say hi:Hello world", text, "echo 回显提示后接补全文本")
+	assert.Equal(t, "stop", finishReason)
+	assert.Equal(t, float64(9), usage["total_tokens"])
+}
@@ -0,0 +1,201 @@
+package server
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CompressionConfig 响应压缩配置
+type CompressionConfig struct {
+	Enabled  bool
+	MinBytes int // 响应体小于该大小时不压缩
+	Level    int // gzip/zlib 压缩级别（-1 为默认级别，1-9）
+}
+
+// LoadCompressionConfigFromEnv 从环境变量加载响应压缩配置
+// - RESPONSE_COMPRESSION: 是否对非流式响应启用 gzip/deflate 压缩（默认false）
+// - RESPONSE_COMPRESSION_MIN_BYTES: 最小压缩大小（默认1024）
+// - RESPONSE_COMPRESSION_LEVEL: 压缩级别（默认-1，即 gzip 默认级别；1最快，9最小）
+func LoadCompressionConfigFromEnv() (CompressionConfig, error) {
+	cfg := CompressionConfig{
+		Enabled:  utils.GetEnvBoolWithDefault("RESPONSE_COMPRESSION", false),
+		MinBytes: utils.GetEnvIntWithDefault("RESPONSE_COMPRESSION_MIN_BYTES", 1024),
+		Level:    utils.GetEnvIntWithDefault("RESPONSE_COMPRESSION_LEVEL", gzip.DefaultCompression),
+	}
+	if cfg.MinBytes < 0 {
+		return CompressionConfig{}, fmt.Errorf("RESPONSE_COMPRESSION_MIN_BYTES 不能为负数")
+	}
+	if cfg.Level < gzip.DefaultCompression || cfg.Level > gzip.BestCompression {
+		return CompressionConfig{}, fmt.Errorf("RESPONSE_COMPRESSION_LEVEL 需为 -1 到 9")
+	}
+	return cfg, nil
+}
+
+// CompressionMiddleware 按 Accept-Encoding 压缩响应（优先 gzip，其次 deflate）
+// 是否压缩在响应体首次写出时按响应头决定：SSE 与 NDJSON 流、调用过 Flush 的流式响应、
+// 已编码或分段（206）的响应、非文本类型以及小于 MinBytes 的响应体均原样输出
+func CompressionMiddleware(cfg CompressionConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		encoding := negotiateEncoding(c.GetHeader("Accept-Encoding"))
+		if encoding == "" || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		w := &compressWriter{ResponseWriter: c.Writer, cfg: cfg, encoding: encoding}
+		c.Writer = w
+		defer w.finish()
+		c.Next()
+	}
+}
+
+// negotiateEncoding 从 Accept-Encoding 中选择压缩方式（忽略 q=0 的编码）
+func negotiateEncoding(header string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v <= 0 {
+				continue
+			}
+		}
+		accepted[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+	switch {
+	case accepted["gzip"], accepted["*"]:
+		return "gzip"
+	case accepted["deflate"]:
+		return "deflate"
+	default:
+		return ""
+	}
+}
+
+// compressibleContentType 是否为值得压缩的非流式文本类型
+func compressibleContentType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	switch mediaType {
+	case "text/event-stream", "application/x-ndjson":
+		return false // 流式响应需要逐条下发
+	case "application/json", "application/jsonl", "application/javascript", "application/xml", "image/svg+xml":
+		return true
+	}
+	return strings.HasPrefix(mediaType, "text/")
+}
+
+// compressWriter 缓冲响应体开头的 MinBytes 字节，据此与响应头决定是否压缩
+type compressWriter struct {
+	gin.ResponseWriter
+	cfg      CompressionConfig
+	encoding string
+
+	buf     []byte
+	decided bool
+	enc     io.WriteCloser // 为 nil 表示原样输出
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if !w.decided {
+		if !w.compressible() {
+			if err := w.decide(false); err != nil {
+				return 0, err
+			}
+		} else {
+			w.buf = append(w.buf, p...)
+			if len(w.buf) < w.cfg.MinBytes {
+				return len(p), nil
+			}
+			if err := w.decide(true); err != nil {
+				return 0, err
+			}
+			return len(p), nil
+		}
+	}
+	if w.enc != nil {
+		return w.enc.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush 流式响应在确定压缩方式前调用 Flush 时按原样输出，保证逐条下发
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		_ = w.decide(false)
+	}
+	if f, ok := w.enc.(interface{ Flush() error }); ok {
+		_ = f.Flush()
+	}
+	w.ResponseWriter.Flush()
+}
+
+// compressible 按已设置的响应头判断能否压缩
+func (w *compressWriter) compressible() bool {
+	status := w.Status()
+	h := w.Header()
+	switch {
+	case w.ResponseWriter.Written(),
+		status < http.StatusOK, status == http.StatusNoContent, status == http.StatusPartialContent, status == http.StatusNotModified,
+		h.Get("Content-Encoding") != "", h.Get("Content-Range") != "":
+		return false
+	}
+	return compressibleContentType(h.Get("Content-Type"))
+}
+
+// decide 确定压缩方式并写出已缓冲的数据
+func (w *compressWriter) decide(compress bool) error {
+	w.decided = true
+	if compress {
+		h := w.Header()
+		h.Set("Content-Encoding", w.encoding)
+		h.Add("Vary", "Accept-Encoding")
+		h.Del("Content-Length")
+		// 压缩后的表示与原文不同，强 ETag 改为弱 ETag
+		if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+			h.Set("ETag", "W/"+etag)
+		}
+		var err error
+		if w.encoding == "gzip" {
+			w.enc, err = gzip.NewWriterLevel(w.ResponseWriter, w.cfg.Level)
+		} else {
+			w.enc, err = zlib.NewWriterLevel(w.ResponseWriter, w.cfg.Level)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if len(w.buf) == 0 {
+		return nil
+	}
+	buf := w.buf
+	w.buf = nil
+	if w.enc != nil {
+		_, err := w.enc.Write(buf)
+		return err
+	}
+	_, err := w.ResponseWriter.Write(buf)
+	return err
+}
+
+// finish 请求结束时写出未达到压缩阈值的响应体并结束压缩流
+func (w *compressWriter) finish() {
+	if !w.decided {
+		_ = w.decide(false)
+	}
+	if w.enc != nil {
+		_ = w.enc.Close()
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	assert.Equal(t, "gzip", negotiateEncoding("gzip, deflate, br"))
+	assert.Equal(t, "deflate", negotiateEncoding("deflate"))
+	assert.Equal(t, "deflate", negotiateEncoding("gzip;q=0, deflate"))
+	assert.Equal(t, "gzip", negotiateEncoding("*"))
+	assert.Equal(t, "", negotiateEncoding("br"))
+	assert.Equal(t, "", negotiateEncoding(""))
+}
+
+func newCompressionTestEngine() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CompressionMiddleware(CompressionConfig{Enabled: true, MinBytes: 64, Level: gzip.DefaultCompression}))
+	big := strings.Repeat("kiro2api ", 100)
+	r.GET("/json", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"data": big}) })
+	r.GET("/small", func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"ok": true}) })
+	r.GET("/zip", func(c *gin.Context) { c.Data(http.StatusOK, "application/zip", []byte(big)) })
+	r.GET("/sse", func(c *gin.Context) {
+		setSSEHeaders(c)
+		for range 3 {
+			_, _ = c.Writer.WriteString("data: " + big + "\n\n")
+			c.Writer.Flush()
+		}
+	})
+	r.GET("/etag", func(c *gin.Context) {
+		c.Header("ETag", `"abc"`)
+		c.Data(http.StatusOK, "text/css", []byte(big))
+	})
+	return r
+}
+
+func compressionGet(r http.Handler, path, acceptEncoding string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	if acceptEncoding != "" {
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCompressionMiddleware(t *testing.T) {
+	r := newCompressionTestEngine()
+
+	w := compressionGet(r, "/json", "gzip")
+	require.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", w.Header().Get("Vary"))
+	gz, err := gzip.NewReader(w.Body)
+	require.NoError(t, err)
+	body, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"data":"kiro2api`)
+
+	w = compressionGet(r, "/json", "deflate")
+	require.Equal(t, "deflate", w.Header().Get("Content-Encoding"))
+	zr, err := zlib.NewReader(w.Body)
+	require.NoError(t, err)
+	body, err = io.ReadAll(zr)
+	require.NoError(t, err)
+	assert.Contains(t, string(body), `"data":"kiro2api`)
+
+	w = compressionGet(r, "/json", "")
+	assert.Empty(t, w.Header().Get("Content-Encoding"), "客户端不支持压缩")
+	assert.Contains(t, w.Body.String(), `"data":"kiro2api`)
+
+	w = compressionGet(r, "/small", "gzip")
+	assert.Empty(t, w.Header().Get("Content-Encoding"), "小于阈值不压缩")
+	assert.JSONEq(t, `{"ok":true}`, w.Body.String())
+
+	w = compressionGet(r, "/zip", "gzip")
+	assert.Empty(t, w.Header().Get("Content-Encoding"), "已压缩的类型不再压缩")
+
+	w = compressionGet(r, "/sse", "gzip")
+	assert.Empty(t, w.Header().Get("Content-Encoding"), "SSE 流不压缩")
+	assert.Equal(t, 3, strings.Count(w.Body.String(), "data: "))
+	assert.True(t, w.Flushed)
+
+	w = compressionGet(r, "/etag", "gzip")
+	assert.Equal(t, "gzip", w.Header().Get("Content-Encoding"))
+	assert.Equal(t, `W/"abc"`, w.Header().Get("ETag"), "压缩后改为弱 ETag")
+}
+
+func TestLoadCompressionConfigFromEnv(t *testing.T) {
+	cfg, err := LoadCompressionConfigFromEnv()
+	require.NoError(t, err)
+	assert.False(t, cfg.Enabled)
+
+	t.Setenv("RESPONSE_COMPRESSION_LEVEL", "11")
+	_, err = LoadCompressionConfigFromEnv()
+	assert.Error(t, err)
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CORS 默认配置
+const (
+	defaultCORSMethods       = "GET, POST, PUT, DELETE, OPTIONS"
+	defaultCORSHeaders       = "Content-Type, Authorization, x-api-key, X-CSRF-Token, X-Request-ID, anthropic-version, anthropic-beta, X-Kiro-Key-Id, X-Kiro-Timestamp, X-Kiro-Signature, X-Cache-Control, X-Conversation-ID, x-goog-api-key, X-Kiro-Passthrough, Idempotency-Key, X-Kiro-Capture"
+	defaultCORSExposeHeaders = "X-Request-ID, Retry-After, X-Cache, Age, X-Kiro-Backend, Idempotent-Replayed, X-Kiro-Capture-Id"
+)
+
+// CORSConfig 跨域策略，/v1 与管理后台（Dashboard 与 /api）分别配置允许的来源
+type CORSConfig struct {
+	V1Origins     []string      // /v1 允许的来源，"*" 表示任意来源（不携带凭据）
+	AdminOrigins  []string      // 管理后台允许的来源，携带 Cookie 凭据，不允许 "*"
+	Methods       []string      // 允许的方法
+	Headers       []string      // 允许的请求头
+	ExposeHeaders []string      // 允许浏览器读取的响应头
+	MaxAge        time.Duration // 预检结果缓存时间
+}
+
+// LoadCORSConfigFromEnv 从环境变量加载跨域策略（列表均为逗号分隔）
+// - CORS_ALLOWED_ORIGINS: /v1 允许的来源（默认 "*"），支持 https://*.example.com 形式的子域名通配
+// - CORS_ADMIN_ALLOWED_ORIGINS: 管理后台允许的来源（默认空，仅同源访问）
+// - CORS_ALLOWED_METHODS / CORS_ALLOWED_HEADERS / CORS_EXPOSE_HEADERS: 允许的方法、请求头与暴露的响应头
+// - CORS_MAX_AGE_SECONDS: 预检结果缓存时间（默认600）
+func LoadCORSConfigFromEnv() CORSConfig {
+	return CORSConfig{
+		V1Origins:     splitList(utils.GetEnvWithDefault("CORS_ALLOWED_ORIGINS", "*")),
+		AdminOrigins:  splitList(utils.GetEnvWithDefault("CORS_ADMIN_ALLOWED_ORIGINS", "")),
+		Methods:       splitList(utils.GetEnvWithDefault("CORS_ALLOWED_METHODS", defaultCORSMethods)),
+		Headers:       splitList(utils.GetEnvWithDefault("CORS_ALLOWED_HEADERS", defaultCORSHeaders)),
+		ExposeHeaders: splitList(utils.GetEnvWithDefault("CORS_EXPOSE_HEADERS", defaultCORSExposeHeaders)),
+		MaxAge:        time.Duration(utils.GetEnvIntWithDefault("CORS_MAX_AGE_SECONDS", 600)) * time.Second,
+	}
+}
+
+// Validate 校验跨域策略
+func (cfg CORSConfig) Validate() error {
+	for _, origin := range cfg.AdminOrigins {
+		if origin == "*" {
+			return fmt.Errorf("CORS_ADMIN_ALLOWED_ORIGINS 不能为 *（管理后台请求携带 Cookie 凭据）")
+		}
+	}
+	for _, origin := range append(append([]string{}, cfg.V1Origins...), cfg.AdminOrigins...) {
+		if origin != "*" && !strings.HasPrefix(origin, "http://") && !strings.HasPrefix(origin, "https://") {
+			return fmt.Errorf("CORS 来源必须以 http:// 或 https:// 开头: %s", origin)
+		}
+	}
+	return nil
+}
+
+// splitList 拆分逗号分隔的列表，忽略空项
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// originAllowed 判断来源是否匹配允许列表，返回是否为通配 "*" 匹配
+func originAllowed(origin string, allowed []string) (ok bool, wildcard bool) {
+	for _, pattern := range allowed {
+		switch {
+		case pattern == "*":
+			return true, true
+		case strings.EqualFold(pattern, origin):
+			return true, false
+		case strings.Contains(pattern, "://*."):
+			// https://*.example.com 匹配任意子域名（不含 example.com 本身）
+			scheme, domain, _ := strings.Cut(pattern, "://*")
+			if strings.HasPrefix(strings.ToLower(origin), strings.ToLower(scheme)+"://") &&
+				strings.HasSuffix(strings.ToLower(origin), strings.ToLower(domain)) &&
+				len(origin) > len(scheme)+3+len(domain) {
+				return true, false
+			}
+		}
+	}
+	return false, false
+}
+
+// CORSMiddleware 按跨域策略设置响应头并处理预检请求
+// 不带 Origin 的请求（非浏览器客户端）不受影响；来源不在允许列表时不返回 CORS 头，预检请求返回 403
+func CORSMiddleware(cfg CORSConfig) gin.HandlerFunc {
+	methods := strings.Join(cfg.Methods, ", ")
+	headers := strings.Join(cfg.Headers, ", ")
+	exposeHeaders := strings.Join(cfg.ExposeHeaders, ", ")
+	maxAge := strconv.Itoa(int(cfg.MaxAge.Seconds()))
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions
+		if origin == "" {
+			if preflight {
+				c.AbortWithStatus(http.StatusNoContent)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		v1 := strings.HasPrefix(c.Request.URL.Path, "/v1")
+		allowed := cfg.AdminOrigins
+		if v1 {
+			allowed = cfg.V1Origins
+		}
+		ok, wildcard := originAllowed(origin, allowed)
+		c.Writer.Header().Add("Vary", "Origin")
+		if !ok {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if wildcard {
+			c.Header("Access-Control-Allow-Origin", "*")
+		} else {
+			c.Header("Access-Control-Allow-Origin", origin)
+			if !v1 {
+				c.Header("Access-Control-Allow-Credentials", "true")
+			}
+		}
+		if exposeHeaders != "" {
+			c.Header("Access-Control-Expose-Headers", exposeHeaders)
+		}
+
+		if preflight {
+			c.Header("Access-Control-Allow-Methods", methods)
+			c.Header("Access-Control-Allow-Headers", headers)
+			c.Header("Access-Control-Max-Age", maxAge)
+			c.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		c.Next()
+	}
+}
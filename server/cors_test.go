@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func newCORSRouter(cfg CORSConfig) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(CORSMiddleware(cfg))
+	ok := func(c *gin.Context) { c.String(http.StatusOK, "ok") }
+	r.POST("/v1/messages", ok)
+	r.GET("/api/tokens", ok)
+	return r
+}
+
+func corsRequest(r *gin.Engine, method, path, origin string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	if method == http.MethodOptions {
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCORSMiddleware_V1Wildcard(t *testing.T) {
+	r := newCORSRouter(CORSConfig{
+		V1Origins: []string{"*"},
+		Methods:   []string{"GET", "POST"},
+		Headers:   []string{"Authorization", "X-CSRF-Token"},
+		MaxAge:    time.Minute,
+	})
+
+	w := corsRequest(r, http.MethodOptions, "/v1/messages", "https://playground.example.com")
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, POST", w.Header().Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Authorization, X-CSRF-Token", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "60", w.Header().Get("Access-Control-Max-Age"))
+
+	w = corsRequest(r, http.MethodPost, "/v1/messages", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), "非浏览器请求不返回CORS头")
+}
+
+func TestCORSMiddleware_AdminOrigins(t *testing.T) {
+	r := newCORSRouter(CORSConfig{
+		V1Origins:    []string{"https://*.example.com"},
+		AdminOrigins: []string{"https://admin.example.com"},
+	})
+
+	w := corsRequest(r, http.MethodGet, "/api/tokens", "https://admin.example.com")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "https://admin.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", w.Header().Get("Access-Control-Allow-Credentials"))
+	assert.Contains(t, w.Header().Values("Vary"), "Origin")
+
+	w = corsRequest(r, http.MethodOptions, "/api/tokens", "https://evil.example.net")
+	assert.Equal(t, http.StatusForbidden, w.Code, "不在允许列表的预检请求被拒绝")
+
+	w = corsRequest(r, http.MethodPost, "/v1/messages", "https://app.example.com")
+	assert.Equal(t, "https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"), "子域名通配")
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Credentials"))
+
+	w = corsRequest(r, http.MethodPost, "/v1/messages", "https://example.com")
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"), "通配不匹配主域名本身")
+}
+
+func TestCORSConfig_Validate(t *testing.T) {
+	assert.NoError(t, CORSConfig{V1Origins: []string{"*"}}.Validate())
+	assert.Error(t, CORSConfig{AdminOrigins: []string{"*"}}.Validate())
+	assert.Error(t, CORSConfig{V1Origins: []string{"example.com"}}.Validate())
+}
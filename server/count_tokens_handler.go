@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"net/http"
 
+	"kiro2api/converter"
 	"kiro2api/logger"
 	"kiro2api/types"
 	"kiro2api/utils"
@@ -60,3 +61,93 @@ func handleCountTokens(c *gin.Context) {
 		InputTokens: tokenCount,
 	})
 }
+
+// OpenAITokenCountRequest OpenAI风格的token计数请求
+// 与 /v1/chat/completions 请求体相同（可直接复用），也可仅传 input 估算纯文本
+type OpenAITokenCountRequest struct {
+	types.OpenAIRequest
+	Input any `json:"input,omitempty"` // 字符串或字符串数组
+}
+
+// OpenAITokenCountResponse OpenAI风格的token计数响应
+type OpenAITokenCountResponse struct {
+	Object       string `json:"object"`
+	Model        string `json:"model"`
+	PromptTokens int    `json:"prompt_tokens"`
+}
+
+// respondOpenAICountError 返回OpenAI格式的参数错误
+func respondOpenAICountError(c *gin.Context, message string) {
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error": gin.H{
+			"type":    "invalid_request_error",
+			"message": message,
+		},
+	})
+}
+
+// handleOpenAICountTokens OpenAI风格的token计数接口（/v1/tokens/count）
+// 请求经与 /v1/chat/completions 相同的转换后使用同一估算器，保证计数与实际发送的内容一致，不调用上游
+func handleOpenAICountTokens(c *gin.Context) {
+	var req OpenAITokenCountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Warn("token计数请求解析失败", addReqFields(c, logger.Err(err))...)
+		respondOpenAICountError(c, fmt.Sprintf("Invalid request body: %v", err))
+		return
+	}
+	if !utils.IsValidClaudeModel(req.Model) {
+		logger.Warn("无效的模型参数", addReqFields(c, logger.String("model", req.Model))...)
+		respondOpenAICountError(c, fmt.Sprintf("Invalid model: %s", req.Model))
+		return
+	}
+
+	estimator := utils.NewTokenEstimator()
+	var tokenCount int
+	switch {
+	case len(req.Messages) > 0:
+		anthropicReq := converter.ConvertOpenAIToAnthropic(req.OpenAIRequest)
+		tokenCount = estimator.EstimateTokens(&types.CountTokensRequest{
+			Model:    anthropicReq.Model,
+			System:   anthropicReq.System,
+			Messages: anthropicReq.Messages,
+			Tools:    filterSupportedTools(anthropicReq.Tools),
+		})
+	case req.Input != nil:
+		texts, ok := tokenCountInputs(req.Input)
+		if !ok {
+			respondOpenAICountError(c, "input must be a string or an array of strings")
+			return
+		}
+		for _, text := range texts {
+			tokenCount += estimator.EstimateTextTokens(text)
+		}
+	default:
+		respondOpenAICountError(c, "messages or input is required")
+		return
+	}
+
+	c.JSON(http.StatusOK, OpenAITokenCountResponse{
+		Object:       "tokens.count",
+		Model:        req.Model,
+		PromptTokens: tokenCount,
+	})
+}
+
+// tokenCountInputs 解析 input 字段（字符串或字符串数组）
+func tokenCountInputs(input any) ([]string, bool) {
+	switch v := input.(type) {
+	case string:
+		return []string{v}, true
+	case []any:
+		texts := make([]string, 0, len(v))
+		for _, item := range v {
+			text, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			texts = append(texts, text)
+		}
+		return texts, true
+	}
+	return nil, false
+}
@@ -389,3 +389,56 @@ func BenchmarkHandleCountTokens(b *testing.B) {
 		handleCountTokens(c)
 	}
 }
+
+// TestHandleOpenAICountTokens 测试OpenAI格式的token计数
+func TestHandleOpenAICountTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.POST("/v1/tokens/count", handleOpenAICountTokens)
+	r.POST("/v1/messages/count_tokens", handleCountTokens)
+
+	send := func(path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("/v1/tokens/count", `{
+		"model": "claude-sonnet-4-20250514",
+		"messages": [{"role": "user", "content": "What is the weather in Paris today?"}],
+		"tools": [{"type": "function", "function": {"name": "get_weather", "description": "Get weather", "parameters": {"type": "object", "properties": {"city": {"type": "string"}}}}}]
+	}`)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp OpenAITokenCountResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "tokens.count", resp.Object)
+	assert.Equal(t, "claude-sonnet-4-20250514", resp.Model)
+
+	// 与Anthropic格式的等价请求计数一致
+	anthropic := send("/v1/messages/count_tokens", `{
+		"model": "claude-sonnet-4-20250514",
+		"messages": [{"role": "user", "content": "What is the weather in Paris today?"}],
+		"tools": [{"name": "get_weather", "description": "Get weather", "input_schema": {"type": "object", "properties": {"city": {"type": "string"}}}}]
+	}`)
+	var anthropicResp types.CountTokensResponse
+	assert.NoError(t, json.Unmarshal(anthropic.Body.Bytes(), &anthropicResp))
+	assert.Equal(t, anthropicResp.InputTokens, resp.PromptTokens)
+
+	w = send("/v1/tokens/count", `{"model": "claude-sonnet-4-20250514", "input": ["hello world", "你好，世界"]}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Greater(t, resp.PromptTokens, 0)
+
+	for _, body := range []string{
+		`{"model": "llama-2", "input": "hi"}`,
+		`{"model": "claude-sonnet-4-20250514"}`,
+		`{"model": "claude-sonnet-4-20250514", "input": [1, 2]}`,
+		`not json`,
+	} {
+		w = send("/v1/tokens/count", body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+		assert.Contains(t, w.Body.String(), "invalid_request_error", body)
+	}
+}
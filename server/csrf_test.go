@@ -0,0 +1,95 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCSRFTestEngine 会话中间件 + CSRF 中间件 + 登录/登出与一个受保护的写接口
+func newCSRFTestEngine(t *testing.T, sameSite http.SameSite) (*gin.Engine, *SessionManager) {
+	gin.SetMode(gin.TestMode)
+	store, err := NewUserStore("", &AdminUser{Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+	sessions := NewSessionManager(time.Hour, time.Hour)
+	t.Cleanup(sessions.Close)
+	h := NewAuthHandlers(sessions, store, time.Hour, newTestLoginLockout(t), sameSite)
+
+	r := gin.New()
+	r.Use(SessionMiddleware(sessions))
+	r.Use(CSRFMiddleware(sameSite))
+	r.POST("/api/login", h.HandleLogin)
+	r.POST("/api/logout", h.HandleLogout)
+	r.POST("/api/tokens", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+	return r, sessions
+}
+
+func csrfRequest(r http.Handler, method, path, body string, cookies []*http.Cookie, csrfToken string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if csrfToken != "" {
+		req.Header.Set(csrfHeaderName, csrfToken)
+	}
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func responseCookie(w *httptest.ResponseRecorder, name string) *http.Cookie {
+	var found *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == name {
+			found = cookie // 同名 cookie 以最后一个为准
+		}
+	}
+	return found
+}
+
+func TestCSRFMiddleware_BindsTokenToSession(t *testing.T) {
+	r, _ := newCSRFTestEngine(t, http.SameSiteStrictMode)
+
+	// 登录前：双提交 cookie
+	w := csrfRequest(r, http.MethodGet, "/static/login.html", "", nil, "")
+	anon := responseCookie(w, csrfTokenCookieName)
+	require.NotNil(t, anon)
+	assert.Equal(t, http.SameSiteStrictMode, anon.SameSite)
+
+	w = csrfRequest(r, http.MethodPost, "/api/login", `{"username":"admin","password":"secret"}`, []*http.Cookie{anon}, anon.Value)
+	require.Equal(t, http.StatusOK, w.Code)
+	sid := responseCookie(w, sessionCookieName)
+	rotated := responseCookie(w, csrfTokenCookieName)
+	require.NotNil(t, sid)
+	require.NotNil(t, rotated)
+	assert.Equal(t, http.SameSiteStrictMode, sid.SameSite)
+	assert.NotEqual(t, anon.Value, rotated.Value, "登录时轮换 CSRF token")
+
+	// 登录后：只接受绑定到会话的 token
+	assert.Equal(t, http.StatusForbidden, csrfRequest(r, http.MethodPost, "/api/tokens", "{}", []*http.Cookie{sid, anon}, anon.Value).Code,
+		"登录前的 token 失效")
+	forged := &http.Cookie{Name: csrfTokenCookieName, Value: "attacker-injected"}
+	assert.Equal(t, http.StatusForbidden, csrfRequest(r, http.MethodPost, "/api/tokens", "{}", []*http.Cookie{sid, forged}, forged.Value).Code,
+		"注入的 cookie 不能通过校验")
+	w = csrfRequest(r, http.MethodPost, "/api/tokens", "{}", []*http.Cookie{sid, forged}, rotated.Value)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, rotated.Value, responseCookie(w, csrfTokenCookieName).Value, "cookie 与会话不一致时重新下发")
+
+	// 登出后 token 再次轮换
+	w = csrfRequest(r, http.MethodPost, "/api/logout", "", []*http.Cookie{sid, rotated}, rotated.Value)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, rotated.Value, responseCookie(w, csrfTokenCookieName).Value)
+}
+
+func TestParseCookieSameSite(t *testing.T) {
+	assert.Equal(t, http.SameSiteStrictMode, ParseCookieSameSite("strict"))
+	assert.Equal(t, http.SameSiteLaxMode, ParseCookieSameSite("lax"))
+	assert.Equal(t, http.SameSiteLaxMode, ParseCookieSameSite(""))
+}
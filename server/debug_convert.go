@@ -0,0 +1,172 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"kiro2api/auth"
+	"kiro2api/config"
+	"kiro2api/types"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tokenPeeker 可以预览账号选择结果的token来源（AuthService 实现）
+type tokenPeeker interface {
+	PeekTokenForTags(model, preferID string, tags []string) (types.TokenInfo, error)
+}
+
+// DebugConvertModel 转换预览中的模型映射
+type DebugConvertModel struct {
+	Requested string   `json:"requested"`        // 客户端请求的模型名
+	Target    string   `json:"target,omitempty"` // 别名解析后的模型名
+	Upstream  string   `json:"upstream"`         // 发送给上游的 modelId
+	Routed    bool     `json:"routed"`           // 模型路由表中是否有该模型
+	Tags      []string `json:"tags,omitempty"`   // 模型路由限定的账号标签
+	MaxTokens int      `json:"max_tokens"`       // 应用默认值与上限后的 max_tokens
+	Stream    bool     `json:"stream"`
+	Messages  int      `json:"messages"` // 输入保护处理后的消息数
+}
+
+// DebugConvertToken 转换预览中此刻将被选中的账号，无可用账号时只有 Code 与 Error
+type DebugConvertToken struct {
+	ConfigID    string `json:"config_id,omitempty"`
+	AccessToken string `json:"access_token,omitempty"` // 脱敏后的访问令牌
+	ExpiresAt   string `json:"expires_at,omitempty"`
+	Sticky      bool   `json:"sticky,omitempty"` // 命中会话粘性绑定的账号
+	Code        string `json:"code,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// DebugConvertResult 转换预览结果
+type DebugConvertResult struct {
+	Format  string            `json:"format"`
+	KeyID   string            `json:"key_id"`
+	Model   DebugConvertModel `json:"model"`
+	Token   DebugConvertToken `json:"token"`
+	URL     string            `json:"upstream_url"`
+	Headers map[string]string `json:"upstream_headers"`
+	Body    any               `json:"upstream_body"`
+}
+
+// handleDebugConvert 转换预览：按真实请求的处理流程（密钥策略、模型路由、系统提示策略、输入保护）转换请求，
+// 返回将发送给上游的请求头与请求体、模型映射与此刻将被选中的账号；不调用上游、不消耗额度，也不影响账号选择状态
+// 查询参数：
+//   - format: anthropic（默认，/v1/messages 请求体）/ openai（/v1/chat/completions 请求体）
+//   - key_id: 以该调用方密钥的身份转换（默认 default），用于复现按密钥生效的策略与租户账号范围
+//
+// 访问令牌只保留首尾4位，请求体按 REDACTION_RULES 脱敏
+func handleDebugConvert(c *gin.Context, peeker tokenPeeker, promptPolicies *PromptPolicies) {
+	format := strings.ToLower(strings.TrimSpace(c.DefaultQuery("format", "anthropic")))
+	if format != "anthropic" && format != "openai" {
+		respondError(c, http.StatusBadRequest, "不支持的格式: %s（可选 anthropic、openai）", format)
+		return
+	}
+	keyID := strings.TrimSpace(c.DefaultQuery("key_id", defaultClientKeyID))
+	c.Set(clientKeyIDKey, keyID)
+
+	body, err := c.GetRawData()
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "读取请求体失败: %v", err)
+		return
+	}
+	model := peekRequestModel(body)
+	if !checkKeyPolicy(c, model, body) {
+		return
+	}
+
+	anthropicReq, err := prepareDebugConvertRequest(c, format, body, promptPolicies)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+
+	// 与真实请求相同的模型、租户标签与粘性绑定，但只预览，不占用额度与并发名额
+	preferID := stickyPreference(c, body)
+	token, tokenErr := peeker.PeekTokenForTags(model, preferID, tenants.TagsFor(keyID))
+
+	req, err := buildCodeWhispererRequest(c, anthropicReq, token, anthropicReq.Stream)
+	if err != nil {
+		if !c.Writer.Written() { // 模型未找到时已写出响应
+			handleRequestBuildError(c, err)
+		}
+		return
+	}
+	upstreamBody, err := io.ReadAll(req.Body)
+	if err != nil {
+		handleRequestBuildError(c, err)
+		return
+	}
+	var cwReq types.CodeWhispererRequest
+	var decoded any
+	if err := utils.SafeUnmarshal(upstreamBody, &cwReq); err != nil {
+		handleRequestBuildError(c, err)
+		return
+	}
+	if err := utils.SafeUnmarshal(upstreamBody, &decoded); err != nil {
+		handleRequestBuildError(c, err)
+		return
+	}
+
+	result := DebugConvertResult{
+		Format: format,
+		KeyID:  keyID,
+		Model: DebugConvertModel{
+			Requested: model,
+			Upstream:  cwReq.ConversationState.CurrentMessage.UserInputMessage.ModelId,
+			MaxTokens: anthropicReq.MaxTokens,
+			Stream:    anthropicReq.Stream,
+			Messages:  len(anthropicReq.Messages),
+		},
+		URL:     req.URL.String(),
+		Headers: make(map[string]string, len(req.Header)),
+		Body:    contentRedactor.Value(decoded),
+	}
+	if resolved, ok := config.ResolveModel(model); ok {
+		result.Model.Routed = true
+		result.Model.Target = resolved.Target
+		result.Model.Tags = resolved.Tags
+	}
+	for name := range req.Header {
+		result.Headers[name] = req.Header.Get(name)
+	}
+	if tokenErr != nil {
+		delete(result.Headers, "Authorization")
+		result.Token = DebugConvertToken{Code: tokenUnavailableError(tokenErr).Code, Error: tokenErr.Error()}
+	} else {
+		result.Headers["Authorization"] = "Bearer " + auth.MaskSecret(token.AccessToken)
+		result.Token = DebugConvertToken{
+			ConfigID:    token.ConfigID,
+			AccessToken: auth.MaskSecret(token.AccessToken),
+			Sticky:      preferID != "" && preferID == token.ConfigID,
+		}
+		if !token.ExpiresAt.IsZero() {
+			result.Token.ExpiresAt = token.ExpiresAt.Format(time.RFC3339)
+		}
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// prepareDebugConvertRequest 按对应端点的处理流程解析并调整请求
+func prepareDebugConvertRequest(c *gin.Context, format string, body []byte, promptPolicies *PromptPolicies) (types.AnthropicRequest, error) {
+	if format == "openai" {
+		var openaiReq types.OpenAIRequest
+		if err := utils.SafeUnmarshal(body, &openaiReq); err != nil {
+			return types.AnthropicRequest{}, fmt.Errorf("解析请求体失败: %w", err)
+		}
+		return prepareOpenAIChatRequest(c, openaiReq, promptPolicies)
+	}
+
+	var anthropicReq types.AnthropicRequest
+	if err := utils.SafeUnmarshal(body, &anthropicReq); err != nil {
+		return types.AnthropicRequest{}, fmt.Errorf("解析请求体失败: %w", err)
+	}
+	if len(anthropicReq.Messages) == 0 {
+		return types.AnthropicRequest{}, fmt.Errorf("messages 数组不能为空")
+	}
+	return prepareAnthropicRequest(c, anthropicReq, promptPolicies)
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"kiro2api/auth"
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakePeeker 记录预览参数的token来源
+type fakePeeker struct {
+	token types.TokenInfo
+	err   error
+	model string
+	tags  []string
+}
+
+func (p *fakePeeker) PeekTokenForTags(model, preferID string, tags []string) (types.TokenInfo, error) {
+	p.model, p.tags = model, tags
+	return p.token, p.err
+}
+
+func debugConvert(t *testing.T, peeker tokenPeeker, query, body string) (*httptest.ResponseRecorder, DebugConvertResult) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/debug/convert"+query, strings.NewReader(body))
+	handleDebugConvert(c, peeker, nil)
+
+	var result DebugConvertResult
+	if w.Code == http.StatusOK {
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result), w.Body.String())
+	}
+	return w, result
+}
+
+func TestHandleDebugConvert_Anthropic(t *testing.T) {
+	peeker := &fakePeeker{token: types.TokenInfo{AccessToken: "aoa-secret-access-token", ConfigID: "acc-1", ExpiresAt: time.Now().Add(time.Hour)}}
+	w, result := debugConvert(t, peeker, "", `{"model":"claude-sonnet-4-20250514","max_tokens":100,"messages":[{"role":"user","content":"hello"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	assert.Equal(t, "anthropic", result.Format)
+	assert.Equal(t, defaultClientKeyID, result.KeyID)
+	assert.Equal(t, "claude-sonnet-4-20250514", peeker.model)
+	assert.Equal(t, "claude-sonnet-4-20250514", result.Model.Requested)
+	assert.NotEmpty(t, result.Model.Upstream)
+	assert.Equal(t, 100, result.Model.MaxTokens)
+
+	assert.Equal(t, "acc-1", result.Token.ConfigID)
+	assert.Equal(t, auth.MaskSecret("aoa-secret-access-token"), result.Token.AccessToken)
+	assert.Equal(t, "Bearer "+auth.MaskSecret("aoa-secret-access-token"), result.Headers["Authorization"])
+	assert.NotContains(t, w.Body.String(), "aoa-secret-access-token", "访问令牌不应出现在响应中")
+
+	body, ok := result.Body.(map[string]any)
+	require.True(t, ok)
+	assert.Contains(t, body, "conversationState")
+	assert.Contains(t, w.Body.String(), "hello")
+}
+
+func TestHandleDebugConvert_OpenAIAndErrors(t *testing.T) {
+	// 无可用账号时仍返回转换结果，账号部分给出错误码
+	peeker := &fakePeeker{err: auth.ErrAllTokensBusy}
+	w, result := debugConvert(t, peeker, "?format=openai&key_id=team-a", `{"model":"claude-sonnet-4-20250514","messages":[{"role":"system","content":"be brief"},{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "openai", result.Format)
+	assert.Equal(t, "team-a", result.KeyID)
+	assert.Equal(t, ErrCodeAccountsBusy, result.Token.Code)
+	assert.NotContains(t, result.Headers, "Authorization")
+	assert.NotEmpty(t, result.Model.Upstream)
+
+	w, _ = debugConvert(t, peeker, "?format=gemini", `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w, _ = debugConvert(t, peeker, "", `{"model":"claude-sonnet-4-20250514","max_tokens":100,"messages":[]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"kiro2api/logger"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxEmbeddingsResponseBytes 嵌入后端响应体上限
+const maxEmbeddingsResponseBytes = 64 << 20
+
+// EmbeddingsBackend 嵌入请求的次级后端（OpenAI 兼容接口）
+// Kiro 上游不提供嵌入能力，/v1/embeddings 原样转发到该后端，客户端可与聊天共用同一个基础地址
+type EmbeddingsBackend struct {
+	URL    string // 完整的嵌入接口地址（基础地址 + /embeddings）
+	APIKey string // 后端API密钥，为空时不发送 Authorization
+	client *http.Client
+}
+
+// LoadEmbeddingsBackendFromEnv 从环境变量加载嵌入后端，未配置时返回 nil（/v1/embeddings 返回501）
+// - EMBEDDINGS_BACKEND_URL: OpenAI 兼容接口的基础地址，如 https://api.openai.com/v1
+// - EMBEDDINGS_BACKEND_API_KEY: 后端API密钥（可选）
+// - EMBEDDINGS_TIMEOUT_SECONDS: 单次请求超时（默认30）
+func LoadEmbeddingsBackendFromEnv() (*EmbeddingsBackend, error) {
+	base := strings.TrimSpace(os.Getenv("EMBEDDINGS_BACKEND_URL"))
+	if base == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(base)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("EMBEDDINGS_BACKEND_URL 必须是 http(s) 地址: %s", base)
+	}
+	timeout := utils.GetEnvIntWithDefault("EMBEDDINGS_TIMEOUT_SECONDS", 30)
+	if timeout <= 0 {
+		return nil, fmt.Errorf("EMBEDDINGS_TIMEOUT_SECONDS 必须大于0")
+	}
+	return &EmbeddingsBackend{
+		URL:    strings.TrimSuffix(base, "/") + "/embeddings",
+		APIKey: strings.TrimSpace(os.Getenv("EMBEDDINGS_BACKEND_API_KEY")),
+		client: &http.Client{Timeout: time.Duration(timeout) * time.Second},
+	}, nil
+}
+
+// handleEmbeddings OpenAI 兼容的嵌入端点（POST /v1/embeddings）
+// 未配置嵌入后端时返回501 embeddings_not_supported；否则按密钥策略校验模型后转发，后端的状态码与响应体原样返回
+func handleEmbeddings(backend *EmbeddingsBackend) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if backend == nil {
+			respondErrorWithCode(c, http.StatusNotImplemented, "embeddings_not_supported", "%s",
+				"当前服务未配置嵌入后端（EMBEDDINGS_BACKEND_URL），不支持 /v1/embeddings")
+			return
+		}
+
+		body, err := c.GetRawData()
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "读取请求体失败: %v", err)
+			return
+		}
+		var req struct {
+			Model string `json:"model"`
+			Input any    `json:"input"`
+		}
+		if err := utils.SafeUnmarshal(body, &req); err != nil {
+			respondErrorWithCode(c, http.StatusBadRequest, "invalid_request_error", "解析请求体失败: %v", err)
+			return
+		}
+		if req.Model == "" || req.Input == nil {
+			respondErrorWithCode(c, http.StatusBadRequest, "invalid_request_error", "%s", "model 与 input 不能为空")
+			return
+		}
+		c.Set(requestModelKey, req.Model)
+		setAuditModel(c, req.Model)
+		if !checkKeyPolicy(c, req.Model, body) {
+			return
+		}
+
+		status, contentType, respBody, err := backend.forward(c, body)
+		if err != nil {
+			logger.Error("嵌入后端请求失败", addReqFields(c, logger.String("model", req.Model), logger.Err(err))...)
+			respondErrorWithCode(c, http.StatusBadGateway, "embeddings_backend_error", "嵌入后端请求失败: %v", err)
+			return
+		}
+		if status == http.StatusOK {
+			var resp struct {
+				Usage struct {
+					PromptTokens int `json:"prompt_tokens"`
+				} `json:"usage"`
+			}
+			if utils.FastUnmarshal(respBody, &resp) == nil {
+				setAuditUsage(c, resp.Usage.PromptTokens, 0)
+			}
+		} else {
+			logger.Warn("嵌入后端返回错误",
+				addReqFields(c, logger.String("model", req.Model), logger.Int("status", status))...)
+		}
+		c.Data(status, contentType, respBody)
+	}
+}
+
+// forward 将请求体转发到嵌入后端，返回后端的状态码、Content-Type 与响应体
+func (b *EmbeddingsBackend) forward(c *gin.Context, body []byte) (int, string, []byte, error) {
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPost, b.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("构建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if b.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+b.APIKey)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return 0, "", nil, err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxEmbeddingsResponseBytes+1))
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("读取响应失败: %w", err)
+	}
+	if len(respBody) > maxEmbeddingsResponseBytes {
+		return 0, "", nil, fmt.Errorf("响应体超过 %d 字节", maxEmbeddingsResponseBytes)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	return resp.StatusCode, contentType, respBody, nil
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadEmbeddingsBackendFromEnv(t *testing.T) {
+	t.Setenv("EMBEDDINGS_BACKEND_URL", "")
+	backend, err := LoadEmbeddingsBackendFromEnv()
+	require.NoError(t, err)
+	assert.Nil(t, backend)
+
+	t.Setenv("EMBEDDINGS_BACKEND_URL", "https://api.openai.com/v1/")
+	t.Setenv("EMBEDDINGS_BACKEND_API_KEY", " sk-test ")
+	backend, err = LoadEmbeddingsBackendFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, "https://api.openai.com/v1/embeddings", backend.URL)
+	assert.Equal(t, "sk-test", backend.APIKey)
+
+	t.Setenv("EMBEDDINGS_BACKEND_URL", "api.openai.com/v1")
+	_, err = LoadEmbeddingsBackendFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("EMBEDDINGS_BACKEND_URL", "https://api.openai.com/v1")
+	t.Setenv("EMBEDDINGS_TIMEOUT_SECONDS", "0")
+	_, err = LoadEmbeddingsBackendFromEnv()
+	assert.Error(t, err)
+}
+
+func TestHandleEmbeddings(t *testing.T) {
+	var gotAuth, gotBody string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		if r.URL.Path != "/v1/embeddings" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if bytes.Contains(body, []byte("unknown-model")) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"message":"model not found"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"object":"list","data":[{"object":"embedding","index":0,"embedding":[0.1,0.2]}],"usage":{"prompt_tokens":3,"total_tokens":3}}`))
+	}))
+	defer upstream.Close()
+
+	store, err := NewKeyPolicyStore("")
+	require.NoError(t, err)
+	_, err = store.Set("restricted", KeyPolicy{Models: []string{"claude-*"}})
+	require.NoError(t, err)
+	withKeyPolicies(t, store)
+
+	backend := &EmbeddingsBackend{URL: upstream.URL + "/v1/embeddings", APIKey: "sk-test", client: upstream.Client()}
+	do := func(backend *EmbeddingsBackend, keyID, body string) *httptest.ResponseRecorder {
+		router := gin.New()
+		router.POST("/v1/embeddings", func(c *gin.Context) { c.Set(clientKeyIDKey, keyID) }, handleEmbeddings(backend))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/embeddings", bytes.NewBufferString(body)))
+		return w
+	}
+
+	// 未配置后端时返回明确的能力错误
+	w := do(nil, "default", `{"model":"text-embedding-3-small","input":"hi"}`)
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+	assert.Contains(t, w.Body.String(), "embeddings_not_supported")
+
+	request := `{"model":"text-embedding-3-small","input":["hello"]}`
+	w = do(backend, "default", request)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"embedding":[0.1,0.2]`)
+	assert.Equal(t, "Bearer sk-test", gotAuth)
+	assert.JSONEq(t, request, gotBody)
+
+	// 后端错误原样返回
+	w = do(backend, "default", `{"model":"unknown-model","input":"hi"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "model not found")
+
+	w = do(backend, "default", `{"model":"text-embedding-3-small"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// 密钥策略的模型白名单同样适用
+	gotBody = ""
+	w = do(backend, "restricted", request)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "model_not_allowed")
+	assert.Empty(t, gotBody, "违反策略时不转发")
+
+	// 后端不可达时返回502
+	upstream.Close()
+	w = do(backend, "default", request)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "embeddings_backend_error")
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 对外的稳定错误码：出现在错误体的 code 字段、请求日志、审计记录与 /api/errors 统计中，客户端可据此决定是否重试
+// 流式响应开始后的错误码见 stream_errors.go（upstream_disconnected 等），同样在此登记状态码与错误类型
+const (
+	ErrCodeTokenPoolEmpty          = "token_pool_empty"          // 账号池已耗尽（全部失效或额度用尽）
+	ErrCodeAccountsUnavailable     = "accounts_unavailable"      // 可用账号全部熔断
+	ErrCodeAccountsBusy            = "accounts_busy"             // 可用账号全部达到并发上限
+	ErrCodeNoEligibleAccount       = "no_eligible_account"       // 没有账号支持该模型或满足密钥策略
+	ErrCodeTokenPoolSaturated      = "token_pool_saturated"      // token池饱和，排队失败
+	ErrCodeRequestTimeout          = "request_timeout"           // 等待可用token超时
+	ErrCodeUpstreamThrottled       = "upstream_throttled"        // 上游限流（429）
+	ErrCodeUpstreamTimeout         = "upstream_timeout"          // 上游请求超时
+	ErrCodeUpstreamUnreachable     = "upstream_unreachable"      // 无法连接上游
+	ErrCodeUpstreamInvalidResponse = "upstream_invalid_response" // 上游返回非预期的响应（HTML、网关页等）
+	ErrCodeUpstreamError           = "upstream_error"            // 上游返回其他错误
+	ErrCodeAuthExpired             = "auth_expired"              // 上游拒绝账号凭证（403），token可能已失效
+	ErrCodeConversionFailed        = "conversion_failed"         // 请求无法转换为上游格式
+	ErrCodeInvalidImage            = "invalid_image"             // 图片输入无效
+	ErrCodeRateLimited             = "rate_limited"              // 超过调用方密钥的限流
+	ErrCodeServerOverloaded        = "server_overloaded"         // 进行中的请求已达全局上限
+	ErrCodeInternal                = "internal_error"            // 内部错误
+)
+
+// errorSpec 错误码对应的 HTTP 状态码与两种错误格式中的 type；type 为空时按状态码推断
+type errorSpec struct {
+	status        int
+	openAIType    string
+	anthropicType string
+}
+
+// errorSpecs 错误码表：同一错误码在所有端点使用相同的状态码与错误类型
+var errorSpecs = map[string]errorSpec{
+	ErrCodeTokenPoolEmpty:          {status: http.StatusServiceUnavailable},
+	ErrCodeAccountsUnavailable:     {status: http.StatusServiceUnavailable},
+	ErrCodeAccountsBusy:            {status: http.StatusTooManyRequests},
+	ErrCodeNoEligibleAccount:       {status: http.StatusBadRequest},
+	ErrCodeTokenPoolSaturated:      {status: http.StatusTooManyRequests},
+	ErrCodeRequestTimeout:          {status: http.StatusGatewayTimeout},
+	ErrCodeUpstreamThrottled:       {status: http.StatusTooManyRequests},
+	ErrCodeUpstreamTimeout:         {status: http.StatusGatewayTimeout},
+	ErrCodeUpstreamUnreachable:     {status: http.StatusBadGateway},
+	ErrCodeUpstreamInvalidResponse: {status: http.StatusBadGateway},
+	ErrCodeUpstreamError:           {status: http.StatusBadGateway},
+	ErrCodeAuthExpired:             {status: http.StatusBadGateway},
+	ErrCodeConversionFailed:        {status: http.StatusBadRequest},
+	ErrCodeInvalidImage:            {status: http.StatusBadRequest},
+	ErrCodeRateLimited:             {status: http.StatusTooManyRequests},
+	ErrCodeServerOverloaded:        {status: http.StatusServiceUnavailable},
+	ErrCodeInternal:                {status: http.StatusInternalServerError},
+	streamErrUpstreamDisconnected:  {status: http.StatusBadGateway},
+	streamErrUpstreamTruncated:     {status: http.StatusBadGateway},
+	streamErrTimeout:               {status: http.StatusGatewayTimeout},
+	streamErrCancelled:             {status: http.StatusServiceUnavailable, anthropicType: "api_error"},
+}
+
+// errorStatus 错误码对应的 HTTP 状态码，未登记的错误码返回500
+func errorStatus(code string) int {
+	if spec, ok := errorSpecs[code]; ok {
+		return spec.status
+	}
+	return http.StatusInternalServerError
+}
+
+// errorTypes 错误码在 OpenAI 与 Anthropic 错误体中的 type，未登记时按状态码推断
+func errorTypes(code string, status int) (openAIType, anthropicType string) {
+	spec := errorSpecs[code]
+	openAIType, anthropicType = spec.openAIType, spec.anthropicType
+	if openAIType == "" {
+		openAIType = openAIErrorType(status)
+	}
+	if anthropicType == "" {
+		anthropicType = anthropicErrorType(status)
+	}
+	return openAIType, anthropicType
+}
+
+// openAIErrorType 状态码对应的 OpenAI 错误类型
+func openAIErrorType(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return "authentication_error"
+	case status == http.StatusForbidden:
+		return "permission_error"
+	case status == http.StatusNotFound:
+		return "not_found_error"
+	case status == http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case status >= http.StatusInternalServerError:
+		return "server_error"
+	default:
+		return "invalid_request_error"
+	}
+}
+
+// anthropicErrorType 状态码对应的 Anthropic 错误类型
+func anthropicErrorType(status int) string {
+	switch {
+	case status == http.StatusUnauthorized:
+		return "authentication_error"
+	case status == http.StatusForbidden:
+		return "permission_error"
+	case status == http.StatusNotFound:
+		return "not_found_error"
+	case status == http.StatusRequestEntityTooLarge:
+		return "request_too_large"
+	case status == http.StatusTooManyRequests:
+		return "rate_limit_error"
+	case status == http.StatusServiceUnavailable:
+		return "overloaded_error"
+	case status == http.StatusGatewayTimeout:
+		return "timeout_error"
+	case status >= http.StatusInternalServerError:
+		return "api_error"
+	default:
+		return "invalid_request_error"
+	}
+}
+
+// APIError 带稳定错误码的请求错误，状态码与错误类型由错误码表决定
+type APIError struct {
+	Code    string
+	Message string
+	Err     error
+}
+
+// newAPIError 以错误码包装错误，Message 为返回给客户端的错误信息
+func newAPIError(code string, err error, format string, args ...any) *APIError {
+	return &APIError{Code: code, Message: fmt.Sprintf(format, args...), Err: err}
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Status 错误码对应的 HTTP 状态码
+func (e *APIError) Status() int {
+	return errorStatus(e.Code)
+}
+
+// respondAPIError 按错误码表返回错误响应
+func respondAPIError(c *gin.Context, err *APIError) {
+	respondErrorWithCode(c, err.Status(), err.Code, "%s", err.Message)
+}
+
+// isAnthropicFormat 端点是否使用 Anthropic 错误格式（/v1/messages 及其子路径）
+func isAnthropicFormat(c *gin.Context) bool {
+	return c.Request != nil && strings.HasPrefix(c.Request.URL.Path, "/v1/messages")
+}
+
+// errorEnvelope 按端点格式构造错误体并记录错误码，extra 中的字段并入 error 对象
+// - Anthropic: {"type": "error", "error": {"type": anthropicType, "message": string, "code": string}}
+// - OpenAI 及其他端点: {"error": {"message": string, "type": openAIType, "code": string}}
+func errorEnvelope(c *gin.Context, status int, code, message string, extra gin.H) gin.H {
+	recordErrorCode(c, code)
+	openAIType, anthropicType := errorTypes(code, status)
+	body := gin.H{"message": message, "code": code}
+	for k, v := range extra {
+		body[k] = v
+	}
+	if isAnthropicFormat(c) {
+		body["type"] = anthropicType
+		return gin.H{"type": "error", "error": body}
+	}
+	body["type"] = openAIType
+	return gin.H{"error": body}
+}
+
+// errorCodeKey 上下文中保存的本次请求错误码，供请求日志、审计记录与链路追踪使用
+const errorCodeKey = "error_code"
+
+// recordErrorCode 记录本次请求的错误码并计数
+func recordErrorCode(c *gin.Context, code string) {
+	if code == "" {
+		return
+	}
+	c.Set(errorCodeKey, code)
+	errorCodeCounts.add(code)
+}
+
+// errorCodeCounter 进程启动以来按错误码的计数
+type errorCodeCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+	since  time.Time
+}
+
+var errorCodeCounts = &errorCodeCounter{counts: make(map[string]int64), since: time.Now()}
+
+func (e *errorCodeCounter) add(code string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.counts[code]++
+}
+
+// ErrorCodeStat 一个错误码的计数
+type ErrorCodeStat struct {
+	Code   string `json:"code"`
+	Status int    `json:"status"`
+	Count  int64  `json:"count"`
+}
+
+// snapshot 按次数从多到少排序的计数
+func (e *errorCodeCounter) snapshot() []ErrorCodeStat {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	stats := make([]ErrorCodeStat, 0, len(e.counts))
+	for code, count := range e.counts {
+		stats = append(stats, ErrorCodeStat{Code: code, Status: errorStatus(code), Count: count})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Count != stats[j].Count {
+			return stats[i].Count > stats[j].Count
+		}
+		return stats[i].Code < stats[j].Code
+	})
+	return stats
+}
+
+// handleErrorCodeStats 返回进程启动以来按错误码的计数
+func handleErrorCodeStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"since":  errorCodeCounts.since,
+		"errors": errorCodeCounts.snapshot(),
+	})
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kiro2api/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// errorResponse 解析错误响应（兼容两种格式）
+type errorResponse struct {
+	Type  string         `json:"type"`
+	Error map[string]any `json:"error"`
+}
+
+func serveError(t *testing.T, path string, respond func(c *gin.Context)) (*httptest.ResponseRecorder, errorResponse) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, path, nil)
+	respond(c)
+
+	var body errorResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), w.Body.String())
+	return w, body
+}
+
+func TestErrorEnvelope_Formats(t *testing.T) {
+	apiErr := newAPIError(ErrCodeTokenPoolEmpty, auth.ErrTokenPoolExhausted, "获取token失败")
+
+	w, body := serveError(t, "/v1/messages", func(c *gin.Context) { respondAPIError(c, apiErr) })
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "error", body.Type)
+	assert.Equal(t, "overloaded_error", body.Error["type"])
+	assert.Equal(t, ErrCodeTokenPoolEmpty, body.Error["code"])
+
+	w, body = serveError(t, "/v1/chat/completions", func(c *gin.Context) { respondAPIError(c, apiErr) })
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Empty(t, body.Type)
+	assert.Equal(t, "server_error", body.Error["type"])
+	assert.Equal(t, ErrCodeTokenPoolEmpty, body.Error["code"])
+
+	// 未登记的错误码按状态码推断类型
+	_, body = serveError(t, "/v1/messages", func(c *gin.Context) {
+		respondErrorWithCode(c, http.StatusForbidden, "model_not_allowed", "不允许")
+	})
+	assert.Equal(t, "permission_error", body.Error["type"])
+	assert.ErrorIs(t, apiErr, auth.ErrTokenPoolExhausted)
+}
+
+func TestTokenUnavailableError(t *testing.T) {
+	tests := []struct {
+		err    error
+		code   string
+		status int
+	}{
+		{fmt.Errorf("%w: 全部账号已耗尽", auth.ErrTokenPoolExhausted), ErrCodeTokenPoolEmpty, http.StatusServiceUnavailable},
+		{auth.ErrAllTokensCircuitOpen, ErrCodeAccountsUnavailable, http.StatusServiceUnavailable},
+		{auth.ErrAllTokensBusy, ErrCodeAccountsBusy, http.StatusTooManyRequests},
+		{auth.ErrNoEligibleToken, ErrCodeNoEligibleAccount, http.StatusBadRequest},
+		{assert.AnError, ErrCodeInternal, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		apiErr := tokenUnavailableError(tt.err)
+		assert.Equal(t, tt.code, apiErr.Code, tt.err.Error())
+		assert.Equal(t, tt.status, apiErr.Status(), tt.err.Error())
+	}
+}
+
+func TestHandleCodeWhispererError_Codes(t *testing.T) {
+	tests := []struct {
+		status     int
+		code       string
+		clientCode int
+	}{
+		{http.StatusTooManyRequests, ErrCodeUpstreamThrottled, http.StatusTooManyRequests},
+		{http.StatusForbidden, ErrCodeAuthExpired, http.StatusBadGateway},
+		{http.StatusInternalServerError, ErrCodeUpstreamError, http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		w, body := serveError(t, "/v1/chat/completions", func(c *gin.Context) {
+			assert.True(t, handleCodeWhispererError(c, newUpstreamResponse(tt.status, "application/json", `{"message":"x"}`)))
+			assert.Equal(t, tt.code, c.GetString(errorCodeKey))
+		})
+		assert.Equal(t, tt.clientCode, w.Code)
+		assert.Equal(t, tt.code, body.Error["code"])
+	}
+}
+
+func TestErrorCodeStats(t *testing.T) {
+	original := errorCodeCounts
+	errorCodeCounts = &errorCodeCounter{counts: make(map[string]int64)}
+	t.Cleanup(func() { errorCodeCounts = original })
+
+	for range 2 {
+		serveError(t, "/v1/messages", func(c *gin.Context) { respondAPIError(c, tokenUnavailableError(auth.ErrAllTokensBusy)) })
+	}
+	serveError(t, "/v1/messages", func(c *gin.Context) { respondAPIError(c, tokenUnavailableError(auth.ErrNoEligibleToken)) })
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	handleErrorCodeStats(c)
+	var stats struct {
+		Errors []ErrorCodeStat `json:"errors"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	assert.Equal(t, []ErrorCodeStat{
+		{Code: ErrCodeAccountsBusy, Status: http.StatusTooManyRequests, Count: 2},
+		{Code: ErrCodeNoEligibleAccount, Status: http.StatusBadRequest, Count: 1},
+	}, stats.Errors)
+}
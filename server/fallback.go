@@ -0,0 +1,288 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"kiro2api/auth"
+	"kiro2api/logger"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// backendHeader 响应头：处理本次请求的后端（kiro 或 fallback:<名称>），仅在配置了备用上游时设置
+const backendHeader = "X-Kiro-Backend"
+
+// fallbackChain 当前生效的备用上游，未配置 FALLBACK_FILE 时为 nil
+var fallbackChain *FallbackChain
+
+// 备用上游的接口格式
+const (
+	fallbackTypeAnthropic = "anthropic"
+	fallbackTypeOpenAI    = "openai"
+)
+
+// fallbackEndpoints 可转发到备用上游的端点：请求格式与备用上游上的路径
+var fallbackEndpoints = map[string]struct{ format, path string }{
+	"/v1/messages":         {fallbackTypeAnthropic, "/messages"},
+	"/v1/chat/completions": {fallbackTypeOpenAI, "/chat/completions"},
+}
+
+// FallbackProvider 备用上游：Anthropic 或 OpenAI 兼容接口
+type FallbackProvider struct {
+	Name           string            `json:"name" yaml:"name"`
+	Type           string            `json:"type" yaml:"type"`         // anthropic / openai，只接收同格式的请求
+	BaseURL        string            `json:"base_url" yaml:"base_url"` // 如 https://api.anthropic.com/v1
+	APIKey         string            `json:"api_key,omitempty" yaml:"api_key,omitempty"`
+	APIKeyEnv      string            `json:"api_key_env,omitempty" yaml:"api_key_env,omitempty"`         // 从该环境变量读取密钥，避免写入文件
+	Models         map[string]string `json:"models,omitempty" yaml:"models,omitempty"`                   // 客户端模型 -> 备用上游模型，以 * 结尾按最长前缀匹配，未匹配时使用原模型名
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty" yaml:"timeout_seconds,omitempty"` // 等待响应头的超时（默认60）
+
+	client *http.Client
+}
+
+// FallbackChain 备用上游链：token池耗尽或全部熔断时按顺序尝试与请求格式相同的备用上游
+type FallbackChain struct {
+	Providers []*FallbackProvider `json:"providers" yaml:"providers"`
+}
+
+// LoadFallbackChainFromEnv 从环境变量加载备用上游链，未配置时返回 nil
+// - FALLBACK_FILE: 备用上游文件（.yaml/.yml 按 YAML 解析，其余按 JSON）
+func LoadFallbackChainFromEnv() (*FallbackChain, error) {
+	path := utils.GetEnvWithDefault("FALLBACK_FILE", "")
+	if path == "" {
+		return nil, nil
+	}
+	return LoadFallbackChainFile(path)
+}
+
+// LoadFallbackChainFile 读取并校验备用上游文件
+func LoadFallbackChainFile(path string) (*FallbackChain, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取备用上游文件失败: %w", err)
+	}
+
+	var chain FallbackChain
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &chain)
+	default:
+		err = json.Unmarshal(data, &chain)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析备用上游文件失败: %w", err)
+	}
+
+	if len(chain.Providers) == 0 {
+		return nil, fmt.Errorf("备用上游文件未配置任何上游")
+	}
+	names := make(map[string]bool)
+	for i, p := range chain.Providers {
+		if p == nil {
+			return nil, fmt.Errorf("第 %d 个备用上游为空", i+1)
+		}
+		if err := p.init(); err != nil {
+			return nil, fmt.Errorf("备用上游 %q 无效: %w", p.Name, err)
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("备用上游名称重复: %s", p.Name)
+		}
+		names[p.Name] = true
+	}
+	return &chain, nil
+}
+
+// init 校验配置并创建HTTP客户端
+func (p *FallbackProvider) init() error {
+	p.Name = strings.TrimSpace(p.Name)
+	if p.Name == "" {
+		return fmt.Errorf("name 不能为空")
+	}
+	p.Type = strings.ToLower(strings.TrimSpace(p.Type))
+	if p.Type != fallbackTypeAnthropic && p.Type != fallbackTypeOpenAI {
+		return fmt.Errorf("type 必须是 anthropic 或 openai: %q", p.Type)
+	}
+	u, err := url.Parse(strings.TrimSpace(p.BaseURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("base_url 必须是 http(s) 地址: %s", p.BaseURL)
+	}
+	p.BaseURL = strings.TrimSuffix(strings.TrimSpace(p.BaseURL), "/")
+	if p.APIKeyEnv != "" {
+		p.APIKey = os.Getenv(p.APIKeyEnv)
+		if p.APIKey == "" {
+			return fmt.Errorf("环境变量 %s 未设置", p.APIKeyEnv)
+		}
+	}
+	for model, target := range p.Models {
+		if strings.TrimSpace(strings.TrimSuffix(model, "*")) == "" && model != "*" {
+			return fmt.Errorf("models 中的模型名不能为空")
+		}
+		if strings.TrimSpace(target) == "" {
+			return fmt.Errorf("模型 %s 的映射目标不能为空", model)
+		}
+	}
+	if p.TimeoutSeconds < 0 {
+		return fmt.Errorf("timeout_seconds 不能为负数")
+	}
+	timeout := p.TimeoutSeconds
+	if timeout == 0 {
+		timeout = 60
+	}
+	// 流式响应可能持续较长时间，只限制等待响应头的时间
+	p.client = &http.Client{Transport: &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		ResponseHeaderTimeout: time.Duration(timeout) * time.Second,
+	}}
+	return nil
+}
+
+// mapModel 映射备用上游的模型名：精确匹配、最长的 * 前缀匹配，都未匹配时使用原模型名
+func (p *FallbackProvider) mapModel(model string) string {
+	if target, ok := p.Models[model]; ok {
+		return target
+	}
+	best, target := -1, model
+	for pattern, mapped := range p.Models {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		if ok && strings.HasPrefix(model, prefix) && len(prefix) > best {
+			best, target = len(prefix), mapped
+		}
+	}
+	return target
+}
+
+// isFallbackEligible token获取失败的原因是否为账号池耗尽（全部耗尽、熔断或排队失败）
+func isFallbackEligible(err error) bool {
+	var rejected *QueueRejectedError
+	return errors.Is(err, auth.ErrTokenPoolExhausted) || errors.Is(err, auth.ErrAllTokensCircuitOpen) ||
+		errors.As(err, &rejected)
+}
+
+// markKiroBackend 配置了备用上游时在响应头标记请求由 Kiro 账号池处理
+func markKiroBackend(c *gin.Context) {
+	if fallbackChain != nil {
+		c.Header(backendHeader, "kiro")
+	}
+}
+
+// serveFallback token池耗尽时将请求转发到备用上游，已写出响应时返回 true
+// 依次尝试与请求格式相同的备用上游，连接失败、429 或 5xx 时尝试下一个；全部失败时返回 false，由调用方返回原错误
+func (f *FallbackChain) serveFallback(c *gin.Context, body []byte, model string, cause error) bool {
+	if f == nil || !isFallbackEligible(cause) {
+		return false
+	}
+	endpoint, ok := fallbackEndpoints[c.Request.URL.Path]
+	if !ok {
+		return false
+	}
+
+	for _, p := range f.Providers {
+		if p.Type != endpoint.format {
+			continue
+		}
+		resp, err := p.send(c, endpoint.path, body, model)
+		if err != nil {
+			logger.Warn("备用上游请求失败", addReqFields(c, logger.String("provider", p.Name), logger.Err(err))...)
+			continue
+		}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError {
+			_ = resp.Body.Close()
+			logger.Warn("备用上游返回错误，尝试下一个",
+				addReqFields(c, logger.String("provider", p.Name), logger.Int("status", resp.StatusCode))...)
+			continue
+		}
+
+		logger.Info("token池耗尽，请求由备用上游处理",
+			addReqFields(c,
+				logger.String("provider", p.Name),
+				logger.String("model", model),
+				logger.Int("status", resp.StatusCode),
+				logger.String("cause", cause.Error()),
+			)...)
+		setAuditAccount(c, "fallback:"+p.Name)
+		copyFallbackResponse(c, resp, p.Name)
+		return true
+	}
+	return false
+}
+
+// send 按备用上游的格式与模型映射发送请求
+func (p *FallbackProvider) send(c *gin.Context, path string, body []byte, model string) (*http.Response, error) {
+	if target := p.mapModel(model); target != model {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(body, &fields); err != nil {
+			return nil, fmt.Errorf("解析请求体失败: %w", err)
+		}
+		encoded, _ := json.Marshal(target)
+		fields["model"] = encoded
+		mapped, err := json.Marshal(fields)
+		if err != nil {
+			return nil, fmt.Errorf("序列化请求体失败: %w", err)
+		}
+		body = mapped
+	}
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPost, p.BaseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("构建请求失败: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	switch p.Type {
+	case fallbackTypeAnthropic:
+		req.Header.Set("x-api-key", p.APIKey)
+		version := c.GetHeader("anthropic-version")
+		if version == "" {
+			version = "2023-06-01"
+		}
+		req.Header.Set("anthropic-version", version)
+		if beta := c.GetHeader("anthropic-beta"); beta != "" {
+			req.Header.Set("anthropic-beta", beta)
+		}
+	default:
+		if p.APIKey != "" {
+			req.Header.Set("Authorization", "Bearer "+p.APIKey)
+		}
+	}
+	return p.client.Do(req)
+}
+
+// copyFallbackResponse 将备用上游的响应原样写给客户端，流式响应逐块刷新
+func copyFallbackResponse(c *gin.Context, resp *http.Response, name string) {
+	defer resp.Body.Close()
+	for _, header := range []string{"Content-Type", "Cache-Control", "Retry-After"} {
+		if value := resp.Header.Get(header); value != "" {
+			c.Header(header, value)
+		}
+	}
+	c.Header(backendHeader, "fallback:"+name)
+	c.Status(resp.StatusCode)
+
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := resp.Body.Read(buf)
+		if n > 0 {
+			if _, werr := c.Writer.Write(buf[:n]); werr != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+		if err != nil {
+			if err != io.EOF {
+				logger.Warn("读取备用上游响应中断", addReqFields(c, logger.String("provider", name), logger.Err(err))...)
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kiro2api/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withFallbackChain(t *testing.T, chain *FallbackChain) {
+	original := fallbackChain
+	fallbackChain = chain
+	t.Cleanup(func() { fallbackChain = original })
+}
+
+func TestLoadFallbackChainFile(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("BACKUP_ANTHROPIC_KEY", "sk-ant")
+	path := filepath.Join(dir, "fallback.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`providers:
+  - name: anthropic
+    type: Anthropic
+    base_url: https://api.anthropic.com/v1/
+    api_key_env: BACKUP_ANTHROPIC_KEY
+  - name: openrouter
+    type: openai
+    base_url: https://openrouter.ai/api/v1
+    api_key: sk-or
+    models:
+      claude-sonnet-4-5: anthropic/claude-sonnet-4.5
+      claude-haiku-*: anthropic/claude-3.5-haiku
+      "*": openai/gpt-4o-mini
+`), 0o600))
+
+	chain, err := LoadFallbackChainFile(path)
+	require.NoError(t, err)
+	require.Len(t, chain.Providers, 2)
+	assert.Equal(t, "anthropic", chain.Providers[0].Type)
+	assert.Equal(t, "https://api.anthropic.com/v1", chain.Providers[0].BaseURL)
+	assert.Equal(t, "sk-ant", chain.Providers[0].APIKey)
+
+	router := chain.Providers[1]
+	assert.Equal(t, "anthropic/claude-sonnet-4.5", router.mapModel("claude-sonnet-4-5"))
+	assert.Equal(t, "anthropic/claude-3.5-haiku", router.mapModel("claude-haiku-4-5-20251001"))
+	assert.Equal(t, "openai/gpt-4o-mini", router.mapModel("claude-opus-4-1"))
+	assert.Equal(t, "claude-opus-4-1", chain.Providers[0].mapModel("claude-opus-4-1"), "未配置映射时使用原模型名")
+
+	invalid := map[string]string{
+		"empty.json":     `{"providers": []}`,
+		"no-name.json":   `{"providers": [{"type": "openai", "base_url": "https://x"}]}`,
+		"bad-type.json":  `{"providers": [{"name": "a", "type": "gemini", "base_url": "https://x"}]}`,
+		"bad-url.json":   `{"providers": [{"name": "a", "type": "openai", "base_url": "x.example.com"}]}`,
+		"dup.json":       `{"providers": [{"name": "a", "type": "openai", "base_url": "https://x"}, {"name": "a", "type": "openai", "base_url": "https://y"}]}`,
+		"no-env.json":    `{"providers": [{"name": "a", "type": "openai", "base_url": "https://x", "api_key_env": "KIRO2API_TEST_UNSET"}]}`,
+		"bad-model.json": `{"providers": [{"name": "a", "type": "openai", "base_url": "https://x", "models": {"gpt-4o": " "}}]}`,
+		"broken.json":    `{`,
+	}
+	for name, content := range invalid {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o600))
+		_, err := LoadFallbackChainFile(p)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestRequestContext_Fallback(t *testing.T) {
+	var gotPath, gotKey, gotBody string
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotKey = r.URL.Path, r.Header.Get("x-api-key")
+		body, _ := io.ReadAll(r.Body)
+		gotBody = string(body)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"msg_backup","type":"message"}`))
+	}))
+	defer backup.Close()
+
+	providers := []*FallbackProvider{
+		{Name: "openai-backup", Type: "openai", BaseURL: backup.URL},
+		{Name: "flaky", Type: "anthropic", BaseURL: failing.URL},
+		{Name: "anthropic-backup", Type: "anthropic", BaseURL: backup.URL + "/v1", APIKey: "sk-ant",
+			Models: map[string]string{"claude-sonnet-*": "claude-sonnet-4-5-20250929"}},
+	}
+	for _, p := range providers {
+		require.NoError(t, p.init())
+	}
+	withFallbackChain(t, &FallbackChain{Providers: providers})
+
+	do := func(path string, tokenErr error) (*httptest.ResponseRecorder, error) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, path, bytes.NewBufferString(`{"model":"claude-sonnet-4-20250514","max_tokens":10}`))
+		mockAuth := &MockAuthService{err: tokenErr}
+		_, _, err := (&RequestContext{GinContext: c, AuthService: mockAuth, RequestType: "test"}).GetTokenAndBody()
+		return w, err
+	}
+
+	// 账号池耗尽：跳过格式不同与失败的上游，由 anthropic-backup 处理
+	w, err := do("/v1/messages", fmt.Errorf("%w: 全部账号已耗尽", auth.ErrTokenPoolExhausted))
+	assert.ErrorIs(t, err, auth.ErrTokenPoolExhausted)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "fallback:anthropic-backup", w.Header().Get(backendHeader))
+	assert.Contains(t, w.Body.String(), "msg_backup")
+	assert.Equal(t, "/v1/messages", gotPath)
+	assert.Equal(t, "sk-ant", gotKey)
+	assert.JSONEq(t, `{"model":"claude-sonnet-4-5-20250929","max_tokens":10}`, gotBody)
+
+	// 其他错误不转发
+	gotPath = ""
+	w, _ = do("/v1/messages", auth.ErrNoEligibleToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Empty(t, w.Header().Get(backendHeader))
+	assert.Empty(t, gotPath)
+
+	// 不支持转发的端点返回原错误
+	w, _ = do("/v1/completions", auth.ErrTokenPoolExhausted)
+	assert.NotEqual(t, http.StatusOK, w.Code)
+	assert.Empty(t, gotPath)
+
+	// 正常请求标记为 kiro
+	w = httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", bytes.NewBufferString(`{"model":"claude-sonnet-4-20250514"}`))
+	_, _, err = (&RequestContext{GinContext: c, AuthService: &MockAuthService{}, RequestType: "test"}).GetTokenAndBody()
+	require.NoError(t, err)
+	assert.Equal(t, "kiro", w.Header().Get(backendHeader))
+}
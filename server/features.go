@@ -0,0 +1,213 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"kiro2api/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 功能开关名称
+const (
+	FeatureBatches    = "enable_batches"    // 异步批量请求API
+	FeatureWebhooks   = "enable_webhooks"   // Webhook事件通知
+	FeaturePlayground = "enable_playground" // 管理后台请求模板试运行
+	FeatureCapture    = "enable_capture"    // 按请求保存可回放的捕获包
+)
+
+// featureDefinition 已知的功能开关
+type featureDefinition struct {
+	Default     bool
+	Description string
+}
+
+// knownFeatures 已知功能开关及默认值：高风险的新子系统默认关闭，按部署显式启用
+var knownFeatures = map[string]featureDefinition{
+	FeatureBatches:    {Default: false, Description: "异步批量请求API"},
+	FeatureWebhooks:   {Default: false, Description: "Token失败与额度耗尽的Webhook通知"},
+	FeaturePlayground: {Default: false, Description: "管理后台以指定调用方密钥的身份试运行请求模板"},
+	FeatureCapture:    {Default: false, Description: "带 X-Kiro-Capture 请求头的请求保存可回放的捕获包"},
+}
+
+// FeatureState 功能开关状态
+type FeatureState struct {
+	Name           string `json:"name"`
+	Description    string `json:"description"`
+	Enabled        bool   `json:"enabled"`
+	Default        bool   `json:"default"`
+	StartupEnabled bool   `json:"startup_enabled"`
+}
+
+// FeatureFlags 功能开关集合
+// 启动时决定是否注册对应路由；运行期可关闭已启用的功能作为紧急开关，
+// 但启动时未启用的功能没有注册路由，需修改配置后重启
+type FeatureFlags struct {
+	mu      sync.RWMutex
+	startup map[string]bool
+	current map[string]bool
+}
+
+// NewFeatureFlags 创建功能开关集合，overrides 覆盖默认值（未知名称返回错误）
+func NewFeatureFlags(overrides map[string]bool) (*FeatureFlags, error) {
+	flags := &FeatureFlags{
+		startup: make(map[string]bool, len(knownFeatures)),
+		current: make(map[string]bool, len(knownFeatures)),
+	}
+	for name, def := range knownFeatures {
+		flags.startup[name] = def.Default
+	}
+	for name, enabled := range overrides {
+		if _, ok := knownFeatures[name]; !ok {
+			return nil, fmt.Errorf("未知的功能开关: %s", name)
+		}
+		flags.startup[name] = enabled
+	}
+	for name, enabled := range flags.startup {
+		flags.current[name] = enabled
+	}
+	return flags, nil
+}
+
+// parseFeatureFlags 解析功能开关配置，格式: "enable_batches,enable_webhooks=false"
+func parseFeatureFlags(raw string) (map[string]bool, error) {
+	overrides := make(map[string]bool)
+	for _, item := range strings.Split(raw, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, hasValue := strings.Cut(item, "=")
+		enabled := true
+		if hasValue {
+			parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+			if err != nil {
+				return nil, fmt.Errorf("功能开关 %s 的取值无效: %s", name, value)
+			}
+			enabled = parsed
+		}
+		overrides[strings.ToLower(strings.TrimSpace(name))] = enabled
+	}
+	return overrides, nil
+}
+
+// LoadFeatureFlagsFromEnv 从环境变量 FEATURE_FLAGS 加载功能开关
+func LoadFeatureFlagsFromEnv() (*FeatureFlags, error) {
+	overrides, err := parseFeatureFlags(os.Getenv("FEATURE_FLAGS"))
+	if err != nil {
+		return nil, err
+	}
+	return NewFeatureFlags(overrides)
+}
+
+// Enabled 功能当前是否启用（未知功能视为关闭）
+func (f *FeatureFlags) Enabled(name string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.current[name]
+}
+
+// StartupEnabled 功能在启动时是否启用（决定是否注册路由）
+func (f *FeatureFlags) StartupEnabled(name string) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.startup[name]
+}
+
+// SetEnabled 运行期切换功能开关，仅允许切换启动时已启用的功能
+func (f *FeatureFlags) SetEnabled(name string, enabled bool) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	startup, ok := f.startup[name]
+	if !ok {
+		return fmt.Errorf("未知的功能开关: %s", name)
+	}
+	if enabled && !startup {
+		return fmt.Errorf("功能 %s 启动时未启用，需在 FEATURE_FLAGS 中配置后重启", name)
+	}
+	f.current[name] = enabled
+	return nil
+}
+
+// States 返回所有功能开关状态（按名称排序）
+func (f *FeatureFlags) States() []FeatureState {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	states := make([]FeatureState, 0, len(knownFeatures))
+	for name, def := range knownFeatures {
+		states = append(states, FeatureState{
+			Name:           name,
+			Description:    def.Description,
+			Enabled:        f.current[name],
+			Default:        def.Default,
+			StartupEnabled: f.startup[name],
+		})
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Name < states[j].Name })
+	return states
+}
+
+// featureFlags 全局功能开关（StartServer 中按环境变量初始化）
+var featureFlags, _ = NewFeatureFlags(nil)
+
+// FeatureGate 运行期检查功能开关，关闭时按路由不存在处理
+func FeatureGate(flags *FeatureFlags, name string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !flags.Enabled(name) {
+			respondErrorWithCode(c, http.StatusNotFound, "feature_disabled", "功能 %s 未启用", name)
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// registerFeatureRoutes 仅在功能启动时启用的情况下注册路由，并附加运行期开关检查
+func registerFeatureRoutes(flags *FeatureFlags, name string, group *gin.RouterGroup, register func(*gin.RouterGroup)) {
+	if !flags.StartupEnabled(name) {
+		logger.Info("功能未启用，跳过路由注册", logger.String("feature", name), logger.String("prefix", group.BasePath()))
+		return
+	}
+	gated := group.Group("")
+	gated.Use(FeatureGate(flags, name))
+	register(gated)
+}
+
+// handleListFeatures 列出功能开关状态
+func handleListFeatures(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"features": featureFlags.States()})
+}
+
+// handleUpdateFeature 运行期切换功能开关（紧急关闭已启用的功能）
+func handleUpdateFeature(c *gin.Context) {
+	var req struct {
+		Enabled *bool `json:"enabled"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Enabled == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "请求体需包含 enabled 字段"})
+		return
+	}
+
+	name := c.Param("name")
+	if err := featureFlags.SetEnabled(name, *req.Enabled); err != nil {
+		status := http.StatusConflict
+		if _, ok := knownFeatures[name]; !ok {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	logger.Warn("运行期切换功能开关",
+		addReqFields(c,
+			logger.String("feature", name),
+			logger.Bool("enabled", *req.Enabled),
+		)...)
+	c.JSON(http.StatusOK, gin.H{"success": true, "features": featureFlags.States()})
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeatureFlags_SafeDefaults(t *testing.T) {
+	t.Setenv("FEATURE_FLAGS", "")
+	flags, err := LoadFeatureFlagsFromEnv()
+	require.NoError(t, err)
+	for _, state := range flags.States() {
+		assert.False(t, state.Enabled, state.Name)
+	}
+
+	t.Setenv("FEATURE_FLAGS", "enable_playground, ENABLE_BATCHES=true,enable_webhooks=false")
+	flags, err = LoadFeatureFlagsFromEnv()
+	require.NoError(t, err)
+	assert.True(t, flags.Enabled(FeaturePlayground))
+	assert.True(t, flags.Enabled(FeatureBatches))
+	assert.False(t, flags.Enabled(FeatureWebhooks))
+	assert.False(t, flags.Enabled("unknown"))
+
+	for _, raw := range []string{"enable_typo", "enable_batches=maybe"} {
+		t.Setenv("FEATURE_FLAGS", raw)
+		_, err = LoadFeatureFlagsFromEnv()
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestFeatureFlags_RuntimeToggle(t *testing.T) {
+	flags, err := NewFeatureFlags(map[string]bool{FeaturePlayground: true})
+	require.NoError(t, err)
+
+	// 运行期可关闭并重新开启启动时已启用的功能
+	require.NoError(t, flags.SetEnabled(FeaturePlayground, false))
+	assert.False(t, flags.Enabled(FeaturePlayground))
+	assert.True(t, flags.StartupEnabled(FeaturePlayground))
+	require.NoError(t, flags.SetEnabled(FeaturePlayground, true))
+
+	// 启动时未启用的功能没有注册路由，不允许运行期开启
+	assert.Error(t, flags.SetEnabled(FeatureBatches, true))
+	assert.NoError(t, flags.SetEnabled(FeatureBatches, false))
+	assert.Error(t, flags.SetEnabled("unknown", false))
+}
+
+func TestRegisterFeatureRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	flags, err := NewFeatureFlags(map[string]bool{FeaturePlayground: true})
+	require.NoError(t, err)
+
+	r := gin.New()
+	api := r.Group("/api")
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	registerFeatureRoutes(flags, FeaturePlayground, api, func(g *gin.RouterGroup) { g.POST("/run", ok) })
+	registerFeatureRoutes(flags, FeatureBatches, api, func(g *gin.RouterGroup) { g.POST("/batches", ok) })
+
+	send := func(path string) int {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, send("/api/run"))
+	assert.Equal(t, http.StatusNotFound, send("/api/batches"), "未启用的功能不注册路由")
+
+	require.NoError(t, flags.SetEnabled(FeaturePlayground, false))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/run", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "feature_disabled")
+}
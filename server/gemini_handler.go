@@ -0,0 +1,161 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"kiro2api/auth"
+	"kiro2api/converter"
+	"kiro2api/logger"
+	"kiro2api/types"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// geminiPathPrefix Gemini 兼容端点前缀，路径形如 /v1beta/models/{model}:{method}
+const geminiPathPrefix = "/v1beta/models/"
+
+// handleGemini Gemini 兼容端点：generateContent、streamGenerateContent 与 countTokens
+// 请求转换为 Anthropic 格式后走与 /v1/chat/completions 相同的上游与响应处理，响应转换为 Gemini 格式
+// 模型名直接作为请求模型，可在模型路由表中配置别名映射到 Claude 模型
+func handleGemini(authService *auth.AuthService, promptPolicies *PromptPolicies, responseCache *ResponseCache) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		model, method, ok := strings.Cut(c.Param("action"), ":")
+		if !ok || model == "" {
+			respondGeminiError(c, http.StatusNotFound, "路径格式应为 /v1beta/models/{model}:{method}")
+			return
+		}
+		switch method {
+		case "generateContent", "streamGenerateContent":
+		case "countTokens":
+			handleGeminiCountTokens(c, model)
+			return
+		default:
+			respondGeminiError(c, http.StatusNotFound, "不支持的方法: "+method)
+			return
+		}
+
+		reqCtx := &RequestContext{
+			GinContext:  c,
+			AuthService: authService,
+			RequestType: "Gemini",
+			Model:       model,
+		}
+		tokenInfo, body, err := reqCtx.GetTokenAndBody()
+		if err != nil {
+			return // 错误已在GetTokenAndBody中处理
+		}
+
+		anthropicReq, geminiReq, ok := parseGeminiRequest(c, model, body)
+		if !ok {
+			return
+		}
+		anthropicReq = promptPolicies.ForKey(GetClientKeyID(c)).ApplyAnthropic(anthropicReq)
+		includeThoughts := converter.GeminiIncludeThoughts(geminiReq)
+
+		// 只有 alt=sse 时以 SSE 流式下发；否则按 REST 约定一次性返回响应数组
+		if method == "streamGenerateContent" && c.Query("alt") == "sse" {
+			anthropicReq.Stream = true
+			streamConverter := converter.NewGeminiStreamConverter(includeThoughts)
+			streamOpenAIResponse(c, anthropicReq, tokenInfo, true, &OpenAIStreamSender{
+				omitDone: true,
+				transform: func(chunk map[string]any) any {
+					if converted := streamConverter.Convert(chunk); converted != nil {
+						return converted
+					}
+					return nil
+				},
+			})
+			return
+		}
+
+		cacheKey := struct {
+			Request         types.AnthropicRequest `json:"request"`
+			IncludeThoughts bool                   `json:"include_thoughts,omitempty"`
+			Method          string                 `json:"method"`
+		}{anthropicReq, includeThoughts, method}
+		serveWithResponseCache(c, responseCache, "gemini", cacheKey, func() {
+			openaiResp, ok := buildOpenAIResponse(c, anthropicReq, tokenInfo, nil)
+			if !ok {
+				return
+			}
+			geminiResp := converter.ConvertOpenAIToGemini(openaiResp, includeThoughts)
+			if method == "streamGenerateContent" {
+				c.JSON(http.StatusOK, []types.GeminiResponse{geminiResp})
+				return
+			}
+			c.JSON(http.StatusOK, geminiResp)
+		})
+	}
+}
+
+// parseGeminiRequest 解析并转换 Gemini 请求，应用模型默认参数与密钥策略并做与 /v1/messages 相同的校验，失败时已写出错误响应
+func parseGeminiRequest(c *gin.Context, model string, body []byte) (types.AnthropicRequest, types.GeminiRequest, bool) {
+	var geminiReq types.GeminiRequest
+	if err := utils.SafeUnmarshal(body, &geminiReq); err != nil {
+		logger.Error("解析Gemini请求体失败", logger.Err(err))
+		respondGeminiError(c, http.StatusBadRequest, "解析请求体失败: "+err.Error())
+		return types.AnthropicRequest{}, geminiReq, false
+	}
+	setAuditModel(c, model)
+
+	anthropicReq, err := converter.ConvertGeminiToAnthropic(model, geminiReq)
+	if err == nil {
+		err = converter.ValidateStopSequences(anthropicReq)
+	}
+	if err != nil {
+		respondGeminiError(c, http.StatusBadRequest, err.Error())
+		return types.AnthropicRequest{}, geminiReq, false
+	}
+	anthropicReq, err = guardInput(c, clampKeyPolicy(c, converter.ApplyModelDefaults(anthropicReq)))
+	if err != nil {
+		respondGeminiError(c, http.StatusBadRequest, err.Error())
+		return types.AnthropicRequest{}, geminiReq, false
+	}
+	return anthropicReq, geminiReq, true
+}
+
+// handleGeminiCountTokens 本地估算输入token数（countTokens），不调用上游
+func handleGeminiCountTokens(c *gin.Context, model string) {
+	body, err := c.GetRawData()
+	if err != nil {
+		respondGeminiError(c, http.StatusBadRequest, "读取请求体失败: "+err.Error())
+		return
+	}
+	// countTokens 请求体可以直接是 contents，也可以包装在 generateContentRequest 中
+	var wrapped struct {
+		GenerateContentRequest *types.GeminiRequest `json:"generateContentRequest"`
+	}
+	_ = utils.SafeUnmarshal(body, &wrapped)
+	if wrapped.GenerateContentRequest != nil {
+		if body, err = utils.SafeMarshal(wrapped.GenerateContentRequest); err != nil {
+			respondGeminiError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	anthropicReq, _, ok := parseGeminiRequest(c, model, body)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"totalTokens": estimateInputTokens(anthropicReq)})
+}
+
+// respondGeminiError 以 Gemini API 的错误格式返回
+func respondGeminiError(c *gin.Context, statusCode int, message string) {
+	status := "INTERNAL"
+	switch statusCode {
+	case http.StatusBadRequest:
+		status = "INVALID_ARGUMENT"
+	case http.StatusNotFound:
+		status = "NOT_FOUND"
+	}
+	c.JSON(statusCode, gin.H{
+		"error": gin.H{
+			"code":    statusCode,
+			"message": message,
+			"status":  status,
+		},
+	})
+}
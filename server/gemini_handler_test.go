@@ -0,0 +1,63 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"kiro2api/converter"
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGeminiStream(t *testing.T) {
+	upstream := withUpstreamUsage(textThenToolUpstream("Let me check."), `{"tokenUsage":{"inputTokens":30,"outputTokens":12}}`)
+	body := replayStream(t, upstream, func(c *gin.Context, req types.AnthropicRequest) {
+		req.Messages = []types.AnthropicRequestMessage{{Role: "user", Content: "天气如何"}}
+		streamConverter := converter.NewGeminiStreamConverter(false)
+		streamOpenAIResponse(c, req, types.TokenInfo{}, true, &OpenAIStreamSender{
+			omitDone: true,
+			transform: func(chunk map[string]any) any {
+				if converted := streamConverter.Convert(chunk); converted != nil {
+					return converted
+				}
+				return nil
+			},
+		})
+	})
+
+	var text string
+	var calls []types.GeminiFunctionCall
+	var finishReason string
+	var usage *types.GeminiUsageMetadata
+	for _, ev := range parseSSE(t, body) {
+		require.NotEqual(t, "[DONE]", ev.Data, "Gemini 流没有 [DONE] 标记")
+		var chunk types.GeminiResponse
+		require.NoError(t, json.Unmarshal([]byte(ev.Data), &chunk))
+		if chunk.UsageMetadata != nil {
+			usage = chunk.UsageMetadata
+		}
+		for _, candidate := range chunk.Candidates {
+			assert.Equal(t, "model", candidate.Content.Role)
+			for _, part := range candidate.Content.Parts {
+				text += part.Text
+				if part.FunctionCall != nil {
+					calls = append(calls, *part.FunctionCall)
+				}
+			}
+			if candidate.FinishReason != "" {
+				finishReason = candidate.FinishReason
+			}
+		}
+	}
+
+	assert.Equal(t, "Let me check.", text)
+	require.Len(t, calls, 1, "工具调用参数累积后一次下发")
+	assert.Equal(t, "get_weather", calls[0].Name)
+	assert.Equal(t, map[string]any{"city": "SF"}, calls[0].Args)
+	assert.Equal(t, "STOP", finishReason)
+	require.NotNil(t, usage)
+	assert.Equal(t, 42, usage.TotalTokenCount)
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -10,12 +11,15 @@ import (
 
 	"kiro2api/auth"
 	"kiro2api/config"
+	"kiro2api/converter"
 	"kiro2api/logger"
 	"kiro2api/parser"
+	"kiro2api/tracing"
 	"kiro2api/types"
 	"kiro2api/utils"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // extractRelevantHeaders 提取相关的请求头信息
@@ -49,6 +53,26 @@ func extractRelevantHeaders(c *gin.Context) map[string]string {
 	return relevantHeaders
 }
 
+// prepareAnthropicRequest 校验 Anthropic 请求，并按模型路由表、调用方密钥的策略与系统提示策略调整，输入超过token上限时拒绝或截断对话历史
+func prepareAnthropicRequest(c *gin.Context, anthropicReq types.AnthropicRequest, promptPolicies *PromptPolicies) (types.AnthropicRequest, error) {
+	if err := converter.ValidateAnthropicMessagesRequest(anthropicReq); err != nil {
+		return types.AnthropicRequest{}, err
+	}
+	if err := converter.ValidateThinking(anthropicReq.Thinking); err != nil {
+		return types.AnthropicRequest{}, err
+	}
+	if err := converter.ValidateStopSequences(anthropicReq); err != nil {
+		return types.AnthropicRequest{}, err
+	}
+	if err := converter.ValidateCacheControl(anthropicReq); err != nil {
+		return types.AnthropicRequest{}, err
+	}
+
+	anthropicReq = clampKeyPolicy(c, converter.ApplyModelDefaults(anthropicReq))
+	anthropicReq = promptPolicies.ForKey(GetClientKeyID(c)).ApplyAnthropic(anthropicReq)
+	return guardInput(c, anthropicReq)
+}
+
 // handleStreamRequest 处理流式请求
 // handleStreamRequest 处理流式请求
 func handleStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequest, tokenWithUsage *types.TokenWithUsage) {
@@ -59,14 +83,7 @@ func handleStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequest, to
 // handleGenericStreamRequest 通用流式请求处理
 func handleGenericStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequest, token *types.TokenWithUsage, sender StreamEventSender, eventCreator func(string, int, string) []map[string]any) {
 	// 计算输入tokens（基于实际发送给上游的数据）
-	estimator := utils.NewTokenEstimator()
-	countReq := &types.CountTokensRequest{
-		Model:    anthropicReq.Model,
-		System:   anthropicReq.System,
-		Messages: anthropicReq.Messages,
-		Tools:    filterSupportedTools(anthropicReq.Tools), // 过滤不支持的工具后计算
-	}
-	inputTokens := estimator.EstimateTokens(countReq)
+	inputTokens := estimateInputTokens(anthropicReq)
 
 	// 初始化SSE响应
 	if err := initializeSSEResponse(c); err != nil {
@@ -74,6 +91,11 @@ func handleGenericStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequ
 		return
 	}
 
+	// 客户端断开时立即取消上游请求与读取
+	var streamErr error
+	finish := trackStream(c)
+	defer func() { finish(streamErr) }()
+
 	// 生成消息ID并注入上下文
 	messageID := fmt.Sprintf(config.MessageIDFormat, time.Now().Format(config.MessageIDTimeFormat))
 	c.Set("message_id", messageID)
@@ -81,8 +103,10 @@ func handleGenericStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequ
 	// 执行CodeWhisperer请求
 	resp, err := execCWRequest(c, anthropicReq, token.TokenInfo, true)
 	if err != nil {
+		streamErr = err
 		var modelNotFoundErrorType *types.ModelNotFoundErrorType
-		if errors.As(err, &modelNotFoundErrorType) {
+		var imageErr *types.InvalidImageError
+		if errors.As(err, &modelNotFoundErrorType) || errors.As(err, &imageErr) {
 			return
 		}
 		_ = sender.SendError(c, "构建请求失败", err)
@@ -90,22 +114,56 @@ func handleGenericStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequ
 	}
 	defer resp.Body.Close()
 
+	// 生成停顿期间定期发送保活注释，防止空闲连接被断开
+	defer startSSEKeepalive(c, sseKeepaliveInterval)()
+
 	// 创建流处理上下文
 	ctx := NewStreamProcessorContext(c, anthropicReq, token, sender, messageID, inputTokens)
 	defer ctx.Cleanup()
 
 	// 发送初始事件
 	if err := ctx.sendInitialEvents(eventCreator); err != nil {
+		streamErr = err
 		return
 	}
 
 	// 处理事件流
+	_, parseSpan := tracing.Start(c.Request.Context(), "stream.parse", attribute.String("stream.format", "anthropic"))
 	processor := NewEventStreamProcessor(ctx)
-	if err := processor.ProcessEventStream(resp.Body); err != nil {
+	err = processor.ProcessEventStream(resp.Body)
+	tracing.End(parseSpan, err)
+	streamErr = err
+	if err != nil {
+		// 上游中途失败：下发带错误码的 error 事件，客户端据此区分截断与正常结束
+		if code := streamErrorCode(err); code != "" {
+			logger.Warn("上游流式响应中途失败", addReqFields(c, logger.String("code", code), logger.Err(err))...)
+			_ = sender.SendError(c, "上游响应流中断", err)
+			return
+		}
 		logger.Error("事件流处理失败", logger.Err(err))
 		return
 	}
 
+	// 请求总时长到期：上游读取已被取消，通知客户端而不是伪装成正常结束
+	if err := c.Request.Context().Err(); errors.Is(err, context.DeadlineExceeded) {
+		logger.Warn("流式响应超过最大时长，已取消上游请求", addReqFields(c, logger.Err(err))...)
+		_ = sender.SendError(c, "流式响应超过最大时长", newStreamError(streamErrTimeout, err))
+		return
+	}
+
+	// 管理员取消：上游读取已被取消，通知客户端而不是伪装成正常结束
+	if cancelledByAdmin(c) {
+		logger.Warn("流式响应被管理员取消，已取消上游请求", addReqFields(c)...)
+		streamErr = newStreamError(streamErrCancelled, errCancelledByAdmin)
+		_ = sender.SendError(c, errCancelledByAdmin.Error(), streamErr)
+		return
+	}
+
+	// 客户端已断开：上游读取已被取消，不再发送结束事件
+	if clientGone(c) {
+		return
+	}
+
 	// 发送结束事件
 	if err := ctx.sendFinalEvents(); err != nil {
 		logger.Error("发送结束事件失败", logger.Err(err))
@@ -136,8 +194,10 @@ func createAnthropicStreamEvents(messageId string, inputTokens int, model string
 				"stop_reason":   nil,
 				"stop_sequence": nil,
 				"usage": map[string]any{
-					"input_tokens":  inputTokens,
-					"output_tokens": 0, // 初始输出tokens为0，最终在message_delta中更新
+					"input_tokens":                inputTokens,
+					"output_tokens":               0, // 初始输出tokens为0，最终在message_delta中更新
+					"cache_creation_input_tokens": 0,
+					"cache_read_input_tokens":     0,
 				},
 			},
 		},
@@ -149,13 +209,8 @@ func createAnthropicStreamEvents(messageId string, inputTokens int, model string
 }
 
 // createAnthropicFinalEvents 创建Anthropic流式结束事件
-func createAnthropicFinalEvents(outputTokens, inputTokens int, stopReason string) []map[string]any {
-	// 构建符合Claude规范的完整usage信息
-	usage := map[string]any{
-		"output_tokens": outputTokens,
-		"input_tokens":  inputTokens,
-	}
-
+// usage 为完整的用量信息（见 upstreamUsage.anthropicUsage）；stopSequence 为命中的停止序列，未命中时为空（输出为 null）
+func createAnthropicFinalEvents(usage map[string]any, stopReason, stopSequence string) []map[string]any {
 	// 删除硬编码的content_block_stop，依赖sendFinalEvents的动态保护机制
 	// sendFinalEvents在调用本函数前已经自动关闭所有未关闭的content_block（stream_processor.go:353-365）
 	// 这样避免了重复发送content_block_stop导致的违规错误
@@ -169,7 +224,7 @@ func createAnthropicFinalEvents(outputTokens, inputTokens int, stopReason string
 			"type": "message_delta",
 			"delta": map[string]any{
 				"stop_reason":   stopReason,
-				"stop_sequence": nil,
+				"stop_sequence": stopSequenceValue(stopSequence),
 			},
 			"usage": usage,
 		},
@@ -185,13 +240,7 @@ func createAnthropicFinalEvents(outputTokens, inputTokens int, stopReason string
 func handleNonStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequest, token types.TokenInfo) {
 	// 计算输入tokens（基于实际发送给上游的数据）
 	estimator := utils.NewTokenEstimator()
-	countReq := &types.CountTokensRequest{
-		Model:    anthropicReq.Model,
-		System:   anthropicReq.System,
-		Messages: anthropicReq.Messages,
-		Tools:    filterSupportedTools(anthropicReq.Tools), // 过滤不支持的工具后计算
-	}
-	inputTokens := estimator.EstimateTokens(countReq)
+	inputTokens := estimateInputTokens(anthropicReq)
 
 	resp, err := executeCodeWhispererRequest(c, anthropicReq, token, false)
 	if err != nil {
@@ -264,6 +313,10 @@ func handleNonStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequest,
 		return
 	}
 
+	// 上游 metadataEvent 提供的用量（含提示缓存用量）优先于本地估算
+	var upstream upstreamUsage
+	upstream.recordEvents(result.Events)
+
 	// 转换为Anthropic格式
 	var contexts []map[string]any
 	textAgg := result.GetCompletionText()
@@ -292,6 +345,22 @@ func handleNonStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequest,
 	// 		logger.Bool("saw_tool_use", sawToolUse),
 	// 	)...)
 
+	// 扩展思考：回复开头的思考内容作为 thinking 块放在最前面
+	thinkingText, textAgg := splitReasoning(anthropicReq, textAgg)
+	if thinkingText != "" {
+		contexts = append(contexts, map[string]any{
+			"type":     "thinking",
+			"thinking": thinkingText,
+		})
+	}
+
+	// 客户端侧执行 stop_sequences 与 max_tokens：截断正文，截断后的工具调用不再下发
+	textAgg, limiter := applyOutputLimits(anthropicReq, textAgg)
+	if limiter.done() {
+		allTools = nil
+		sawToolUse = false
+	}
+
 	// 添加文本内容
 	if textAgg != "" {
 		contexts = append(contexts, map[string]any{
@@ -363,6 +432,12 @@ func handleNonStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequest,
 			if text, ok := contentBlock["text"].(string); ok {
 				outputTokens += estimator.EstimateTextTokens(text)
 			}
+
+		case "thinking":
+			// 思考块：与文本同样计费
+			if thinking, ok := contentBlock["thinking"].(string); ok {
+				outputTokens += estimator.EstimateTextTokens(thinking)
+			}
 		
 		case "tool_use":
 			// 工具调用块：基于实际发送的工具名称和参数
@@ -379,6 +454,7 @@ func handleNonStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequest,
 	}
 
 	stopReasonManager.UpdateToolCallStatus(sawToolUse, sawToolUse)
+	stopReasonManager.MarkOutputLimit(limiter.stopReason, limiter.stopSequence)
 	stopReason := stopReasonManager.DetermineStopReason()
 
 	// logger.Debug("非流式响应stop_reason决策",
@@ -387,17 +463,17 @@ func handleNonStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequest,
 	// 	logger.Bool("saw_tool_use", sawToolUse),
 	// 	logger.Int("output_tokens", outputTokens))
 
+	auditInput, auditOutput := upstream.apply(inputTokens, outputTokens)
+	setAuditUsage(c, auditInput, auditOutput)
+
 	anthropicResp := map[string]any{
 		"content":       contexts,
 		"model":         anthropicReq.Model,
 		"role":          "assistant",
 		"stop_reason":   stopReason,
-		"stop_sequence": nil,
+		"stop_sequence": stopSequenceValue(stopReasonManager.StopSequence()),
 		"type":          "message",
-		"usage": map[string]any{
-			"input_tokens":  inputTokens,
-			"output_tokens": outputTokens,
-		},
+		"usage":         upstream.anthropicUsage(inputTokens, outputTokens),
 	}
 
 	// logger.Debug("非流式响应最终数据",
@@ -414,6 +490,14 @@ func handleNonStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequest,
 	c.JSON(http.StatusOK, anthropicResp)
 }
 
+// stopSequenceValue 将命中的停止序列转换为响应字段值，未命中时为 null
+func stopSequenceValue(stopSequence string) any {
+	if stopSequence == "" {
+		return nil
+	}
+	return stopSequence
+}
+
 // createTokenPreview 创建token预览显示格式 (***+后10位)
 func createTokenPreview(token string) string {
 	if len(token) <= 10 {
@@ -509,8 +593,15 @@ func handleTokenPoolAPI(c *gin.Context, authService *auth.AuthService) {
 		return
 	}
 
+	// 可选按标签筛选
+	tagFilter := strings.ToLower(strings.TrimSpace(c.Query("tag")))
+
 	// 遍历所有配置
 	for i, authConfig := range configs {
+		if tagFilter != "" && !authConfig.HasTag(tagFilter) {
+			continue
+		}
+
 		// 检查配置是否被禁用
 		if authConfig.Disabled {
 			tokenData := map[string]any{
@@ -524,12 +615,13 @@ func handleTokenPoolAPI(c *gin.Context, authService *auth.AuthService) {
 				"status":          "disabled",
 				"error":           "配置已禁用",
 			}
+			applyTokenMetadata(tokenData, authConfig)
 			tokenList = append(tokenList, tokenData)
 			continue
 		}
 
 		// 尝试获取token信息
-		tokenInfo, err := refreshSingleTokenByConfig(authConfig)
+		tokenInfo, err := refreshSingleTokenByConfig(authService, authConfig)
 		if err != nil {
 			tokenData := map[string]any{
 				"index":           i,
@@ -542,6 +634,7 @@ func handleTokenPoolAPI(c *gin.Context, authService *auth.AuthService) {
 				"status":          "error",
 				"error":           err.Error(),
 			}
+			applyTokenMetadata(tokenData, authConfig)
 			tokenList = append(tokenList, tokenData)
 			continue
 		}
@@ -629,6 +722,7 @@ func handleTokenPoolAPI(c *gin.Context, authService *auth.AuthService) {
 			}()
 		}
 
+		applyTokenMetadata(tokenData, authConfig)
 		tokenList = append(tokenList, tokenData)
 	}
 
@@ -638,6 +732,8 @@ func handleTokenPoolAPI(c *gin.Context, authService *auth.AuthService) {
 		"total_tokens":  len(tokenList),
 		"active_tokens": activeCount,
 		"tokens":        tokenList,
+		"tag_filter":    tagFilter,
+		"tag_groups":    groupTokensByTag(tokenList),
 		"pool_stats": map[string]any{
 			"total_tokens":  len(configs),
 			"active_tokens": activeCount,
@@ -645,16 +741,59 @@ func handleTokenPoolAPI(c *gin.Context, authService *auth.AuthService) {
 	})
 }
 
-// refreshSingleTokenByConfig 根据配置刷新单个token
-func refreshSingleTokenByConfig(config auth.AuthConfig) (types.TokenInfo, error) {
-	switch config.AuthType {
-	case auth.AuthMethodSocial:
-		return auth.RefreshSocialToken(config.RefreshToken)
-	case auth.AuthMethodIdC:
-		return auth.RefreshIdCToken(config)
-	default:
-		return types.TokenInfo{}, fmt.Errorf("不支持的认证类型: %s", config.AuthType)
+// applyTokenMetadata 为token数据附加稳定ID、标签、显示名称、备注与可用模型
+func applyTokenMetadata(tokenData map[string]any, authConfig auth.AuthConfig) {
+	tokenData["id"] = authConfig.ID
+	tokenData["label"] = authConfig.Label
+	tokenData["tags"] = authConfig.Tags
+	tokenData["note"] = authConfig.Note
+	tokenData["models"] = authConfig.Models
+	if authConfig.MaxConcurrent > 0 {
+		tokenData["max_concurrent"] = authConfig.MaxConcurrent
+	}
+	tokenData["in_flight"] = auth.AccountSlots.InFlight(authConfig.ID)
+	if authConfig.ProxyURL != "" {
+		tokenData["proxy"] = utils.RedactProxyURL(authConfig.ProxyURL)
+	}
+}
+
+// groupTokensByTag 按标签汇总token数量与活跃数量
+func groupTokensByTag(tokenList []any) map[string]map[string]any {
+	groups := make(map[string]map[string]any)
+	for _, item := range tokenList {
+		tokenData, ok := item.(map[string]any)
+		if !ok {
+			continue
+		}
+		tags, _ := tokenData["tags"].([]string)
+		for _, tag := range tags {
+			group, exists := groups[tag]
+			if !exists {
+				group = map[string]any{"total": 0, "active": 0, "indexes": []int{}}
+				groups[tag] = group
+			}
+			group["total"] = group["total"].(int) + 1
+			if tokenData["status"] == "active" {
+				group["active"] = group["active"].(int) + 1
+			}
+			group["indexes"] = append(group["indexes"].([]int), tokenData["index"].(int))
+		}
+	}
+	return groups
+}
+
+// refreshSingleTokenByConfig 根据配置刷新单个token，上游轮换的refresh token立即写回配置
+func refreshSingleTokenByConfig(authService *auth.AuthService, config auth.AuthConfig) (types.TokenInfo, error) {
+	token, err := auth.RefreshConfigToken(config)
+	if err != nil {
+		return token, err
+	}
+	if saveErr := authService.SaveRotatedRefreshToken(config, token); saveErr != nil {
+		logger.Error("保存轮换后的refresh token失败",
+			logger.String("id", config.ID),
+			logger.Err(saveErr))
 	}
+	return token, nil
 }
 
 // 已移除复杂的token数据收集函数，现在使用简单的内存数据读取
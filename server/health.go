@@ -0,0 +1,155 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"kiro2api/auth"
+	"kiro2api/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 就绪状态
+const (
+	ReadinessReady       = "ready"       // 全部检查通过
+	ReadinessDegraded    = "degraded"    // 可以提供服务，但存在上游异常或配置无法持久化
+	ReadinessUnavailable = "unavailable" // 没有可用token，无法提供代理服务（返回 503）
+)
+
+// 单项检查结果
+const (
+	checkOK       = "ok"
+	checkFail     = "fail"
+	checkSkipped  = "skipped"
+	checkUnknown  = "unknown"
+	checkDegraded = "degraded"
+)
+
+// processStartedAt 进程启动时间，用于计算运行时长
+var processStartedAt = time.Now()
+
+// handleHealthz 存活检查：进程能处理请求即返回 200，不检查依赖
+func handleHealthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":         "ok",
+		"version":        config.Version,
+		"uptime_seconds": int(time.Since(processStartedAt).Seconds()),
+	})
+}
+
+// handleReadyz 就绪检查：可用token、配置文件可写、最近窗口内的上游可达性
+func handleReadyz(c *gin.Context, authService *auth.AuthService, readOnly bool) {
+	tokens := checkTokens(authService)
+	configFile := checkConfigWritable(authService.ConfigFilePath(), readOnly)
+	incident := upstreamIncidents.State()
+	upstream := checkUpstream(incident)
+
+	status := ReadinessReady
+	code := http.StatusOK
+	switch {
+	case tokens["status"] == checkFail && !readOnly:
+		// 只读副本不提供代理服务，token不可用不影响就绪
+		status = ReadinessUnavailable
+		code = http.StatusServiceUnavailable
+	case tokens["status"] == checkFail,
+		configFile["status"] == checkFail,
+		upstream["status"] == checkDegraded,
+		upstream["status"] == checkFail:
+		status = ReadinessDegraded
+	}
+
+	c.JSON(code, gin.H{
+		"status":    status,
+		"read_only": readOnly,
+		"checks": gin.H{
+			"tokens":      tokens,
+			"config_file": configFile,
+			"upstream":    upstream,
+		},
+		"upstream_incident": incident,
+	})
+}
+
+// checkTokens 统计可用token：未禁用且推理端点熔断器未打开
+func checkTokens(authService *auth.AuthService) gin.H {
+	configs := authService.GetConfigs()
+	usable, disabled, circuitOpen := 0, 0, 0
+	for _, cfg := range configs {
+		switch {
+		case cfg.Disabled:
+			disabled++
+		case !auth.UpstreamBreakers.Available(auth.InferenceBreakerKey(cfg.ID)):
+			circuitOpen++
+		default:
+			usable++
+		}
+	}
+
+	status := checkOK
+	if usable == 0 {
+		status = checkFail
+	}
+	return gin.H{
+		"status":       status,
+		"total":        len(configs),
+		"usable":       usable,
+		"disabled":     disabled,
+		"circuit_open": circuitOpen,
+	}
+}
+
+// checkConfigWritable 检查token配置文件可写（管理后台增删账号需要持久化）
+// 未使用配置文件（环境变量直接提供配置）或只读副本时跳过
+func checkConfigWritable(path string, readOnly bool) gin.H {
+	if path == "" || readOnly {
+		return gin.H{"status": checkSkipped}
+	}
+	if err := probeWritable(path); err != nil {
+		return gin.H{"status": checkFail, "path": path, "error": err.Error()}
+	}
+	return gin.H{"status": checkOK, "path": path}
+}
+
+// probeWritable 文件存在时以写模式打开（不写入内容），不存在时在所在目录创建临时文件
+func probeWritable(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err == nil {
+		return f.Close()
+	}
+	if !os.IsNotExist(err) {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".kiro2api-write-check-*")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	return os.Remove(tmp.Name())
+}
+
+// checkUpstream 根据最近窗口（INCIDENT_WINDOW_SECONDS）内的上游调用判断可达性
+func checkUpstream(incident IncidentState) gin.H {
+	status := checkOK
+	switch {
+	case incident.Requests == 0:
+		status = checkUnknown
+	case incident.Status == UpstreamStatusIncident:
+		status = checkFail
+	case incident.Status == UpstreamStatusDegraded:
+		status = checkDegraded
+	}
+
+	result := gin.H{
+		"status":         status,
+		"window_seconds": incident.WindowSeconds,
+		"requests":       incident.Requests,
+		"errors":         incident.Errors,
+	}
+	if !incident.LastSuccessAt.IsZero() {
+		result["last_success_at"] = incident.LastSuccessAt
+	}
+	return result
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kiro2api/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withIncidentDetector 替换全局上游故障检测器，测试结束后恢复
+func withIncidentDetector(t *testing.T) *IncidentDetector {
+	t.Helper()
+	original := upstreamIncidents
+	upstreamIncidents = NewIncidentDetector(5*time.Minute, 5, 2)
+	t.Cleanup(func() { upstreamIncidents = original })
+	return upstreamIncidents
+}
+
+func getReadyz(t *testing.T, authService *auth.AuthService, readOnly bool) (int, map[string]any) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/readyz", func(c *gin.Context) { handleReadyz(c, authService, readOnly) })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	return w.Code, body
+}
+
+func readyzCheck(body map[string]any, name string) map[string]any {
+	return body["checks"].(map[string]any)[name].(map[string]any)
+}
+
+func TestHandleHealthz(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/healthz", handleHealthz)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"ok"`)
+}
+
+func TestHandleReadyz_Ready(t *testing.T) {
+	detector := withIncidentDetector(t)
+	detector.RecordSuccess("acct-1")
+
+	configPath := filepath.Join(t.TempDir(), "auth_config.json")
+	authService := auth.NewAuthServiceWithConfigs([]auth.AuthConfig{
+		{ID: "readyz-ok-1", AuthType: auth.AuthMethodSocial, RefreshToken: "rt-1"},
+		{ID: "readyz-ok-2", AuthType: auth.AuthMethodSocial, RefreshToken: "rt-2", Disabled: true},
+	}, configPath)
+
+	code, body := getReadyz(t, authService, false)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, ReadinessReady, body["status"])
+
+	tokens := readyzCheck(body, "tokens")
+	assert.Equal(t, float64(1), tokens["usable"])
+	assert.Equal(t, float64(1), tokens["disabled"])
+	assert.Equal(t, checkOK, readyzCheck(body, "config_file")["status"], "文件不存在时检查所在目录可写")
+	upstream := readyzCheck(body, "upstream")
+	assert.Equal(t, checkOK, upstream["status"])
+	assert.NotEmpty(t, upstream["last_success_at"])
+}
+
+func TestHandleReadyz_NoUsableToken(t *testing.T) {
+	withIncidentDetector(t)
+
+	id := "readyz-circuit-open"
+	for i := 0; i < auth.UpstreamBreakers.Threshold(); i++ {
+		auth.UpstreamBreakers.RecordFailure(auth.InferenceBreakerKey(id), "upstream 500")
+	}
+	authService := auth.NewAuthServiceWithConfigs([]auth.AuthConfig{
+		{ID: id, AuthType: auth.AuthMethodSocial, RefreshToken: "rt"},
+	}, "")
+
+	code, body := getReadyz(t, authService, false)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, ReadinessUnavailable, body["status"])
+	assert.Equal(t, float64(1), readyzCheck(body, "tokens")["circuit_open"])
+	assert.Equal(t, checkSkipped, readyzCheck(body, "config_file")["status"])
+	assert.Equal(t, checkUnknown, readyzCheck(body, "upstream")["status"], "窗口内没有上游调用")
+
+	code, body = getReadyz(t, authService, true)
+	assert.Equal(t, http.StatusOK, code, "只读副本不依赖token")
+	assert.Equal(t, ReadinessDegraded, body["status"])
+}
+
+func TestHandleReadyz_ConfigNotWritable(t *testing.T) {
+	withIncidentDetector(t)
+
+	// 所在目录不存在，无法创建配置文件
+	configPath := filepath.Join(t.TempDir(), "missing", "auth_config.json")
+	authService := auth.NewAuthServiceWithConfigs([]auth.AuthConfig{
+		{ID: "readyz-unwritable", AuthType: auth.AuthMethodSocial, RefreshToken: "rt"},
+	}, configPath)
+
+	code, body := getReadyz(t, authService, false)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, ReadinessDegraded, body["status"])
+	assert.Equal(t, checkFail, readyzCheck(body, "config_file")["status"])
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"kiro2api/logger"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 幂等相关请求头与响应头
+const (
+	idempotencyKeyHeader     = "Idempotency-Key"     // 请求头：客户端生成的幂等键（最长255个字符）
+	idempotentReplayedHeader = "Idempotent-Replayed" // 响应头：true 表示响应为重放的首次结果
+)
+
+// IdempotencyStore 非流式请求的幂等记录
+// 同一调用方密钥、端点与 Idempotency-Key 的首个请求正常处理，成功（2xx）响应在窗口内保存；
+// 相同请求体的重试直接重放保存的响应，不再调用上游，避免客户端因网络错误重试时重复消耗额度
+type IdempotencyStore struct {
+	window       time.Duration
+	maxEntries   int
+	maxBodyBytes int
+
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	now     func() time.Time
+}
+
+type idempotencyEntry struct {
+	bodyHash    [sha256.Size]byte
+	pending     bool // 首个请求仍在处理中
+	status      int
+	contentType string
+	body        []byte
+	expiresAt   time.Time
+}
+
+// LoadIdempotencyStoreFromEnv 从环境变量加载幂等记录，未启用时返回 nil
+// - IDEMPOTENCY_WINDOW_SECONDS: 响应保存时间（默认0，关闭；启用后才处理 Idempotency-Key）
+// - IDEMPOTENCY_MAX_ENTRIES: 最多保存的记录数（默认10000，已满时新的幂等键不再记录）
+// - IDEMPOTENCY_MAX_BODY_BYTES: 单条响应的最大字节数，超过时不保存（默认1MB）
+func LoadIdempotencyStoreFromEnv() (*IdempotencyStore, error) {
+	windowSeconds := utils.GetEnvIntWithDefault("IDEMPOTENCY_WINDOW_SECONDS", 0)
+	if windowSeconds < 0 {
+		return nil, fmt.Errorf("IDEMPOTENCY_WINDOW_SECONDS 不能为负数")
+	}
+	if windowSeconds == 0 {
+		return nil, nil
+	}
+	maxEntries := utils.GetEnvIntWithDefault("IDEMPOTENCY_MAX_ENTRIES", 10000)
+	if maxEntries <= 0 {
+		return nil, fmt.Errorf("IDEMPOTENCY_MAX_ENTRIES 必须大于0")
+	}
+	maxBodyBytes := utils.GetEnvIntWithDefault("IDEMPOTENCY_MAX_BODY_BYTES", 1<<20)
+	if maxBodyBytes <= 0 {
+		return nil, fmt.Errorf("IDEMPOTENCY_MAX_BODY_BYTES 必须大于0")
+	}
+	return NewIdempotencyStore(time.Duration(windowSeconds)*time.Second, maxEntries, maxBodyBytes), nil
+}
+
+// NewIdempotencyStore 创建幂等记录
+func NewIdempotencyStore(window time.Duration, maxEntries, maxBodyBytes int) *IdempotencyStore {
+	return &IdempotencyStore{
+		window:       window,
+		maxEntries:   maxEntries,
+		maxBodyBytes: maxBodyBytes,
+		entries:      make(map[string]*idempotencyEntry),
+		now:          time.Now,
+	}
+}
+
+// Len 当前记录数（含处理中与尚未清理的过期记录）
+func (s *IdempotencyStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+// idempotencyState begin 的结果
+type idempotencyState int
+
+const (
+	idempotencyNew        idempotencyState = iota // 首个请求，已登记为处理中
+	idempotencyReplay                             // 已有保存的响应
+	idempotencyInProgress                         // 首个请求仍在处理中
+	idempotencyMismatch                           // 幂等键已用于不同的请求体
+	idempotencyFull                               // 记录已满，本次不做幂等处理
+)
+
+// begin 查找幂等键：不存在时登记为处理中
+func (s *IdempotencyStore) begin(key string, bodyHash [sha256.Size]byte) (idempotencyState, *idempotencyEntry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if entry, ok := s.entries[key]; ok {
+		switch {
+		case !entry.pending && !now.Before(entry.expiresAt):
+			delete(s.entries, key)
+		case entry.bodyHash != bodyHash:
+			return idempotencyMismatch, nil
+		case entry.pending:
+			return idempotencyInProgress, nil
+		default:
+			return idempotencyReplay, entry
+		}
+	}
+
+	if len(s.entries) >= s.maxEntries {
+		s.cleanupLocked(now)
+		if len(s.entries) >= s.maxEntries {
+			return idempotencyFull, nil
+		}
+	}
+	s.entries[key] = &idempotencyEntry{bodyHash: bodyHash, pending: true}
+	return idempotencyNew, nil
+}
+
+// complete 保存首个请求的成功响应；失败或响应过大时删除记录，允许客户端重试
+func (s *IdempotencyStore) complete(key string, status int, contentType string, body []byte, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, exists := s.entries[key]
+	if !exists {
+		return
+	}
+	if !ok {
+		delete(s.entries, key)
+		return
+	}
+	entry.pending = false
+	entry.status = status
+	entry.contentType = contentType
+	entry.body = body
+	entry.expiresAt = s.now().Add(s.window)
+}
+
+// Prune 清理过期记录，返回清理的记录数与释放的响应字节数（注册为运行期产物清理目标定期调用）
+func (s *IdempotencyStore) Prune(now time.Time) (int, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed, reclaimed := s.cleanupLocked(now)
+	return removed, reclaimed, nil
+}
+
+// cleanupLocked 清理过期记录，返回清理的记录数与释放的响应字节数（调用方需持有锁）
+func (s *IdempotencyStore) cleanupLocked(now time.Time) (int, int64) {
+	removed, reclaimed := 0, int64(0)
+	for key, entry := range s.entries {
+		if !entry.pending && !now.Before(entry.expiresAt) {
+			removed++
+			reclaimed += int64(len(entry.body))
+			delete(s.entries, key)
+		}
+	}
+	return removed, reclaimed
+}
+
+// IdempotencyMiddleware 处理带 Idempotency-Key 的 /v1 非流式 POST 请求（需位于认证之后，按调用方密钥隔离）
+// 首个请求的 2xx 响应在窗口内保存，相同请求体的重试返回保存的响应并带 Idempotent-Replayed: true；
+// 首个请求仍在处理中时返回409，同一幂等键用于不同请求体时返回422；失败的请求不保存，可以用同一幂等键重试
+func IdempotencyMiddleware(store *IdempotencyStore, prefixes []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idempotencyKey := strings.TrimSpace(c.GetHeader(idempotencyKeyHeader))
+		if store == nil || idempotencyKey == "" || c.Request.Method != http.MethodPost || !requiresAuth(c.Request.URL.Path, prefixes) {
+			c.Next()
+			return
+		}
+		if len(idempotencyKey) > 255 {
+			respondErrorWithCode(c, http.StatusBadRequest, "invalid_idempotency_key", "Idempotency-Key 不能超过255个字符")
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "读取请求体失败: %v", err)
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		// 流式响应无法整体重放，不做幂等处理
+		if isStreamRequest(body) || strings.Contains(c.Request.URL.Path, ":streamGenerateContent") {
+			c.Next()
+			return
+		}
+
+		key := GetClientKeyID(c) + "\x00" + c.Request.URL.Path + "\x00" + idempotencyKey
+		state, entry := store.begin(key, sha256.Sum256(body))
+		switch state {
+		case idempotencyReplay:
+			logger.Info("幂等请求重放已保存的响应", addReqFields(c, logger.String("idempotency_key", idempotencyKey))...)
+			c.Header(idempotentReplayedHeader, "true")
+			c.Data(entry.status, entry.contentType, entry.body)
+			c.Abort()
+			return
+		case idempotencyInProgress:
+			c.Header("Retry-After", "1")
+			respondErrorWithCode(c, http.StatusConflict, "idempotency_request_in_progress", "使用该 Idempotency-Key 的请求仍在处理中，请稍后重试")
+			c.Abort()
+			return
+		case idempotencyMismatch:
+			respondErrorWithCode(c, http.StatusUnprocessableEntity, "idempotency_key_reused", "Idempotency-Key 已用于不同的请求体")
+			c.Abort()
+			return
+		case idempotencyFull:
+			logger.Warn("幂等记录已满，本次请求不做幂等处理", addReqFields(c, logger.Int("max_entries", store.maxEntries))...)
+			c.Next()
+			return
+		}
+
+		writer := &cacheCaptureWriter{ResponseWriter: c.Writer, limit: store.maxBodyBytes}
+		c.Writer = writer
+		defer func() {
+			c.Writer = writer.ResponseWriter
+			status := writer.Status()
+			ok := status >= http.StatusOK && status < http.StatusMultipleChoices && !writer.overflow && writer.buf.Len() > 0
+			store.complete(key, status, writer.Header().Get("Content-Type"), bytes.Clone(writer.buf.Bytes()), ok)
+		}()
+		c.Next()
+	}
+}
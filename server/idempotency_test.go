@@ -0,0 +1,150 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func idempotentRequest(r *gin.Engine, key, keyID, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", strings.NewReader(body))
+	if key != "" {
+		req.Header.Set(idempotencyKeyHeader, key)
+	}
+	req.Header.Set("X-Test-Key", keyID)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := NewIdempotencyStore(time.Minute, 100, 1<<20)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	var calls atomic.Int32
+	status := http.StatusOK
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(clientKeyIDKey, c.GetHeader("X-Test-Key"))
+		c.Next()
+	})
+	r.Use(IdempotencyMiddleware(store, []string{"/v1"}))
+	r.POST("/v1/messages", func(c *gin.Context) {
+		n := calls.Add(1)
+		c.JSON(status, gin.H{"call": n})
+	})
+
+	const body = `{"model":"m","messages":[]}`
+	first := idempotentRequest(r, "k1", "team-a", body)
+	require.Equal(t, http.StatusOK, first.Code)
+	assert.Empty(t, first.Header().Get(idempotentReplayedHeader))
+
+	// 相同请求体的重试重放首次响应，不再调用处理器
+	retry := idempotentRequest(r, "k1", "team-a", body)
+	assert.Equal(t, http.StatusOK, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get(idempotentReplayedHeader))
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, "application/json; charset=utf-8", retry.Header().Get("Content-Type"))
+	assert.Equal(t, int32(1), calls.Load())
+
+	// 同一幂等键用于不同请求体
+	w := idempotentRequest(r, "k1", "team-a", `{"model":"other"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "idempotency_key_reused")
+
+	// 不同调用方密钥、未带幂等键与流式请求不共享记录
+	assert.Empty(t, idempotentRequest(r, "k1", "team-b", body).Header().Get(idempotentReplayedHeader))
+	assert.Empty(t, idempotentRequest(r, "", "team-a", body).Header().Get(idempotentReplayedHeader))
+	idempotentRequest(r, "k2", "team-a", `{"stream":true}`)
+	assert.Empty(t, idempotentRequest(r, "k2", "team-a", `{"stream":true}`).Header().Get(idempotentReplayedHeader))
+	assert.Equal(t, int32(5), calls.Load())
+
+	// 失败的响应不保存，可以用同一幂等键重试
+	status = http.StatusBadGateway
+	idempotentRequest(r, "k3", "team-a", body)
+	status = http.StatusOK
+	w = idempotentRequest(r, "k3", "team-a", body)
+	assert.Empty(t, w.Header().Get(idempotentReplayedHeader))
+	assert.Equal(t, int32(7), calls.Load())
+
+	// 窗口过期后重新处理
+	now = now.Add(time.Minute)
+	assert.Empty(t, idempotentRequest(r, "k1", "team-a", body).Header().Get(idempotentReplayedHeader))
+
+	w = idempotentRequest(r, strings.Repeat("x", 256), "team-a", body)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestIdempotencyMiddleware_InProgress(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store := NewIdempotencyStore(time.Minute, 100, 1<<20)
+
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	r := gin.New()
+	r.Use(IdempotencyMiddleware(store, []string{"/v1"}))
+	r.POST("/v1/messages", func(c *gin.Context) {
+		close(entered)
+		<-unblock
+		c.JSON(http.StatusOK, gin.H{"ok": true})
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		idempotentRequest(r, "k1", "", `{}`)
+	}()
+	<-entered
+
+	w := idempotentRequest(r, "k1", "", `{}`)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "idempotency_request_in_progress")
+
+	close(unblock)
+	<-done
+	assert.Equal(t, "true", idempotentRequest(r, "k1", "", `{}`).Header().Get(idempotentReplayedHeader))
+}
+
+func TestIdempotencyStore_Full(t *testing.T) {
+	store := NewIdempotencyStore(time.Minute, 1, 1<<20)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	state, _ := store.begin("a", [32]byte{1})
+	require.Equal(t, idempotencyNew, state)
+	state, _ = store.begin("b", [32]byte{1})
+	assert.Equal(t, idempotencyFull, state, "处理中的记录不会被清理")
+
+	store.complete("a", http.StatusOK, "application/json", []byte("{}"), true)
+	now = now.Add(time.Minute)
+	state, _ = store.begin("b", [32]byte{1})
+	assert.Equal(t, idempotencyNew, state, "过期记录清理后可以登记新的幂等键")
+	assert.Equal(t, 1, store.Len())
+}
+
+func TestLoadIdempotencyStoreFromEnv(t *testing.T) {
+	t.Setenv("IDEMPOTENCY_WINDOW_SECONDS", "")
+	store, err := LoadIdempotencyStoreFromEnv()
+	require.NoError(t, err)
+	assert.Nil(t, store)
+
+	t.Setenv("IDEMPOTENCY_WINDOW_SECONDS", "600")
+	store, err = LoadIdempotencyStoreFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, 10*time.Minute, store.window)
+	assert.Equal(t, 10000, store.maxEntries)
+
+	t.Setenv("IDEMPOTENCY_MAX_ENTRIES", "0")
+	_, err = LoadIdempotencyStoreFromEnv()
+	assert.Error(t, err)
+}
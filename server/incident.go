@@ -0,0 +1,260 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"sync"
+	"time"
+
+	"kiro2api/logger"
+	"kiro2api/utils"
+)
+
+// 上游状态常量
+const (
+	UpstreamStatusNormal   = "normal"   // 上游正常
+	UpstreamStatusDegraded = "degraded" // 个别账号异常
+	UpstreamStatusIncident = "incident" // 多账号同时出现上游错误，推断为上游故障
+)
+
+// incidentBuckets 事件窗口划分的计数桶数，窗口内的请求与错误数按桶滚动累计
+const incidentBuckets = 60
+
+// incidentBucket 一个时间片内的计数
+type incidentBucket struct {
+	index          int64 // 时间片序号（时间 / 桶宽度），用于识别过期的桶
+	requests       int
+	errors         int
+	upstreamErrors int
+}
+
+// accountIncident 单个账号最近的调用结果时间
+type accountIncident struct {
+	lastSeen         time.Time
+	lastOK           time.Time
+	lastFail         time.Time
+	lastUpstreamFail time.Time // 上游侧错误（5xx/网络错误），账号级错误（401/403/429）不计
+}
+
+// IncidentState 上游状态评估结果
+type IncidentState struct {
+	Status           string    `json:"status"`
+	Since            time.Time `json:"since,omitempty"`
+	WindowSeconds    int       `json:"window_seconds"`
+	Requests         int       `json:"requests"`
+	Errors           int       `json:"errors"`
+	UpstreamErrors   int       `json:"upstream_errors"`
+	AccountsSeen     int       `json:"accounts_seen"`
+	AccountsFailing  int       `json:"accounts_failing"`
+	FailingAccounts  []string  `json:"failing_accounts,omitempty"`
+	LastError        string    `json:"last_error,omitempty"`
+	LastErrorAt      time.Time `json:"last_error_at,omitempty"`
+	LastSuccessAt    time.Time `json:"last_success_at,omitempty"`
+	EvaluatedAt      time.Time `json:"evaluated_at"`
+	RetriesSuspended bool      `json:"retries_suspended"`
+}
+
+// IncidentDetector 跨账号聚合上游错误，区分"单个账号异常"与"上游故障"
+// 窗口内的计数按时间片滚动累计，每个账号只保留最近的调用结果时间，评估开销与请求量无关
+type IncidentDetector struct {
+	mu          sync.Mutex
+	window      time.Duration
+	bucketWidth time.Duration
+	minErrors   int // 判定故障所需的最少上游错误数
+	minAccounts int // 判定故障所需的最少失败账号数
+	buckets     [incidentBuckets]incidentBucket
+	accounts    map[string]*accountIncident
+	status      string
+	since       time.Time
+	lastError   string
+	lastErrorAt time.Time
+	lastOKAt    time.Time // 最近一次成功调用时间（不受事件窗口影响）
+}
+
+// NewIncidentDetector 创建上游故障检测器
+func NewIncidentDetector(window time.Duration, minErrors, minAccounts int) *IncidentDetector {
+	if minAccounts < 1 {
+		minAccounts = 1
+	}
+	bucketWidth := window / incidentBuckets
+	if bucketWidth <= 0 {
+		bucketWidth = 1
+	}
+	return &IncidentDetector{
+		window:      window,
+		bucketWidth: bucketWidth,
+		minErrors:   minErrors,
+		minAccounts: minAccounts,
+		accounts:    make(map[string]*accountIncident),
+		status:      UpstreamStatusNormal,
+		since:       time.Now(),
+	}
+}
+
+// LoadIncidentDetectorFromEnv 从环境变量创建上游故障检测器
+// - INCIDENT_WINDOW_SECONDS: 事件窗口（默认300）
+// - INCIDENT_MIN_ERRORS: 判定故障所需的最少上游错误数（默认5）
+// - INCIDENT_MIN_ACCOUNTS: 判定故障所需的最少失败账号数（默认2）
+func LoadIncidentDetectorFromEnv() *IncidentDetector {
+	return NewIncidentDetector(
+		time.Duration(utils.GetEnvIntWithDefault("INCIDENT_WINDOW_SECONDS", 300))*time.Second,
+		utils.GetEnvIntWithDefault("INCIDENT_MIN_ERRORS", 5),
+		utils.GetEnvIntWithDefault("INCIDENT_MIN_ACCOUNTS", 2),
+	)
+}
+
+// upstreamIncidents 全局上游故障检测器，StartServer 在加载配置后按环境变量重新创建
+var upstreamIncidents = NewIncidentDetector(5*time.Minute, 5, 2)
+
+// accountKeyFromRefreshToken 生成账号标识（refreshToken哈希前缀，避免泄露密钥）
+func accountKeyFromRefreshToken(refreshToken string) string {
+	sum := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// isUpstreamSideStatus 判断状态码是否属于上游侧故障
+func isUpstreamSideStatus(status int) bool {
+	return status == 0 || status >= http.StatusInternalServerError
+}
+
+// RecordSuccess 记录一次成功的上游调用
+func (d *IncidentDetector) RecordSuccess(account string) {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastOKAt = now
+
+	d.bucketLocked(now).requests++
+	d.accountLocked(account, now).lastOK = now
+	d.evaluateLocked(now)
+}
+
+// RecordFailure 记录一次失败的上游调用（status=0表示网络错误/超时）
+func (d *IncidentDetector) RecordFailure(account string, status int, errMsg string) {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lastError = errMsg
+	d.lastErrorAt = now
+
+	bucket := d.bucketLocked(now)
+	bucket.requests++
+	bucket.errors++
+	acct := d.accountLocked(account, now)
+	acct.lastFail = now
+	if isUpstreamSideStatus(status) {
+		bucket.upstreamErrors++
+		acct.lastUpstreamFail = now
+	}
+	d.evaluateLocked(now)
+}
+
+// bucketLocked 返回 now 所在时间片的计数桶，桶中是已滚出窗口的旧计数时先清零（调用时需持有锁）
+func (d *IncidentDetector) bucketLocked(now time.Time) *incidentBucket {
+	index := now.UnixNano() / int64(d.bucketWidth)
+	bucket := &d.buckets[index%incidentBuckets]
+	if bucket.index != index {
+		*bucket = incidentBucket{index: index}
+	}
+	return bucket
+}
+
+// accountLocked 返回账号的调用结果记录并更新最近出现时间（调用时需持有锁）
+func (d *IncidentDetector) accountLocked(account string, now time.Time) *accountIncident {
+	acct, ok := d.accounts[account]
+	if !ok {
+		acct = &accountIncident{}
+		d.accounts[account] = acct
+	}
+	acct.lastSeen = now
+	return acct
+}
+
+// State 返回当前上游状态
+func (d *IncidentDetector) State() IncidentState {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.evaluateLocked(time.Now())
+}
+
+// InIncident 是否处于上游故障状态（用于暂停激进重试）
+func (d *IncidentDetector) InIncident() bool {
+	return d.State().Status == UpstreamStatusIncident
+}
+
+// evaluateLocked 汇总窗口内的计数、清理窗口外的账号并计算状态（调用时需持有锁）
+func (d *IncidentDetector) evaluateLocked(now time.Time) IncidentState {
+	cutoff := now.Add(-d.window)
+
+	requests, errors, upstreamErrors := 0, 0, 0
+	oldest := now.UnixNano()/int64(d.bucketWidth) - incidentBuckets
+	for _, bucket := range d.buckets {
+		if bucket.index > oldest {
+			requests += bucket.requests
+			errors += bucket.errors
+			upstreamErrors += bucket.upstreamErrors
+		}
+	}
+
+	// 账号最近一次失败晚于最近一次成功时计为失败账号，失败后又成功的账号不计入
+	seen, upstreamFailing := 0, 0
+	failingList := make([]string, 0)
+	for account, acct := range d.accounts {
+		if acct.lastSeen.Before(cutoff) {
+			delete(d.accounts, account)
+			continue
+		}
+		seen++
+		if !acct.lastFail.Before(cutoff) && !acct.lastOK.After(acct.lastFail) {
+			failingList = append(failingList, account)
+		}
+		if !acct.lastUpstreamFail.Before(cutoff) && !acct.lastOK.After(acct.lastUpstreamFail) {
+			upstreamFailing++
+		}
+	}
+
+	status := UpstreamStatusNormal
+	switch {
+	case upstreamErrors >= d.minErrors && upstreamFailing >= d.minAccounts &&
+		upstreamFailing*2 >= seen:
+		// 过半账号同时出现上游侧错误 → 上游故障
+		status = UpstreamStatusIncident
+	case len(failingList) > 0:
+		status = UpstreamStatusDegraded
+	}
+
+	if status != d.status {
+		fields := []logger.Field{
+			logger.String("from", d.status),
+			logger.String("to", status),
+			logger.Int("upstream_errors", upstreamErrors),
+			logger.Int("accounts_failing", len(failingList)),
+			logger.Int("accounts_seen", seen),
+		}
+		if status == UpstreamStatusIncident {
+			logger.Warn("检测到上游故障，暂停激进重试", fields...)
+		} else {
+			logger.Info("上游状态变化", fields...)
+		}
+		d.status = status
+		d.since = now
+	}
+
+	return IncidentState{
+		Status:           d.status,
+		Since:            d.since,
+		WindowSeconds:    int(d.window.Seconds()),
+		Requests:         requests,
+		Errors:           errors,
+		UpstreamErrors:   upstreamErrors,
+		AccountsSeen:     seen,
+		AccountsFailing:  len(failingList),
+		FailingAccounts:  failingList,
+		LastError:        d.lastError,
+		LastErrorAt:      d.lastErrorAt,
+		LastSuccessAt:    d.lastOKAt,
+		EvaluatedAt:      now,
+		RetriesSuspended: d.status == UpstreamStatusIncident,
+	}
+}
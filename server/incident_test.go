@@ -0,0 +1,97 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIncidentDetector_SingleAccountDegraded(t *testing.T) {
+	d := NewIncidentDetector(time.Minute, 3, 2)
+
+	d.RecordSuccess("b")
+	for i := 0; i < 5; i++ {
+		d.RecordFailure("a", http.StatusInternalServerError, "500")
+	}
+
+	state := d.State()
+	assert.Equal(t, UpstreamStatusDegraded, state.Status)
+	assert.Equal(t, 1, state.AccountsFailing)
+	assert.False(t, d.InIncident())
+}
+
+func TestIncidentDetector_MultiAccountIncident(t *testing.T) {
+	d := NewIncidentDetector(time.Minute, 3, 2)
+
+	d.RecordFailure("a", http.StatusBadGateway, "502")
+	d.RecordFailure("b", 0, "timeout")
+	d.RecordFailure("a", http.StatusServiceUnavailable, "503")
+
+	state := d.State()
+	assert.Equal(t, UpstreamStatusIncident, state.Status)
+	assert.True(t, state.RetriesSuspended)
+	assert.Equal(t, "503", state.LastError)
+	assert.True(t, d.InIncident())
+}
+
+func TestIncidentDetector_AccountErrorsAreNotIncident(t *testing.T) {
+	d := NewIncidentDetector(time.Minute, 3, 2)
+
+	for _, account := range []string{"a", "b", "c"} {
+		d.RecordFailure(account, http.StatusForbidden, "403")
+		d.RecordFailure(account, http.StatusTooManyRequests, "429")
+	}
+
+	assert.Equal(t, UpstreamStatusDegraded, d.State().Status)
+}
+
+func TestIncidentDetector_RecoveryClearsFailure(t *testing.T) {
+	d := NewIncidentDetector(time.Minute, 3, 2)
+
+	d.RecordFailure("a", http.StatusInternalServerError, "500")
+	d.RecordSuccess("a")
+
+	assert.Equal(t, UpstreamStatusNormal, d.State().Status)
+}
+
+func TestIncidentDetector_WindowExpiry(t *testing.T) {
+	d := NewIncidentDetector(20*time.Millisecond, 1, 1)
+
+	d.RecordFailure("a", http.StatusInternalServerError, "500")
+	assert.Equal(t, UpstreamStatusIncident, d.State().Status)
+
+	time.Sleep(30 * time.Millisecond)
+	state := d.State()
+	assert.Equal(t, UpstreamStatusNormal, state.Status)
+	assert.Equal(t, 0, state.Requests)
+}
+
+func TestLoadIncidentDetectorFromEnv(t *testing.T) {
+	t.Setenv("INCIDENT_WINDOW_SECONDS", "60")
+	t.Setenv("INCIDENT_MIN_ERRORS", "1")
+	t.Setenv("INCIDENT_MIN_ACCOUNTS", "1")
+
+	d := LoadIncidentDetectorFromEnv()
+	d.RecordFailure("a", http.StatusBadGateway, "502")
+	state := d.State()
+	assert.Equal(t, UpstreamStatusIncident, state.Status)
+	assert.Equal(t, 60, state.WindowSeconds)
+}
+
+func TestIncidentDetector_RollingCounts(t *testing.T) {
+	d := NewIncidentDetector(time.Minute, 100, 2)
+	for i := 0; i < 3; i++ {
+		d.RecordSuccess("a")
+		d.RecordFailure("b", http.StatusBadGateway, "502")
+	}
+	d.RecordFailure("a", http.StatusForbidden, "403")
+
+	state := d.State()
+	assert.Equal(t, 7, state.Requests)
+	assert.Equal(t, 4, state.Errors)
+	assert.Equal(t, 3, state.UpstreamErrors)
+	assert.Equal(t, 2, state.AccountsSeen)
+	assert.ElementsMatch(t, []string{"a", "b"}, state.FailingAccounts)
+}
@@ -0,0 +1,242 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"kiro2api/logger"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 全局并发上限达到后的处理方式
+const (
+	inflightModeReject = "reject" // 立即返回503
+	inflightModeQueue  = "queue"  // 等待空闲名额，超过等待时间或队列已满时返回503
+)
+
+// inflightLimiter /v1 全局进行中请求上限（nil 表示未启用）
+var inflightLimiter *InflightLimiter
+
+// InflightLimiter 全进程进行中的 /v1 请求上限
+// 上游变慢时流式请求会持续堆积，每个请求都占用协程与缓冲区，限制总量避免进程内存失控
+type InflightLimiter struct {
+	max      int
+	mode     string
+	maxQueue int
+	maxWait  time.Duration
+	shedLow  bool // 名额已满时低优先级请求不排队，直接拒绝
+	slots    chan struct{}
+
+	waiting  atomic.Int64
+	peak     atomic.Int64
+	admitted atomic.Int64
+	queued   atomic.Int64
+	rejected atomic.Int64
+	timedOut atomic.Int64
+	shed     atomic.Int64
+}
+
+// InflightStats 全局并发统计
+type InflightStats struct {
+	Enabled        bool    `json:"enabled"`
+	Mode           string  `json:"mode,omitempty"`
+	InFlight       int     `json:"in_flight"`
+	Max            int     `json:"max"`
+	Peak           int64   `json:"peak"`
+	Waiting        int64   `json:"waiting"`
+	MaxQueue       int     `json:"max_queue,omitempty"`
+	MaxWaitSeconds float64 `json:"max_wait_seconds,omitempty"`
+	Admitted       int64   `json:"admitted"`
+	Queued         int64   `json:"queued"`
+	Rejected       int64   `json:"rejected"`
+	TimedOut       int64   `json:"timed_out"`
+	Shed           int64   `json:"shed"`
+}
+
+// LoadInflightLimiterFromEnv 从环境变量加载全局并发上限，未启用时返回 nil
+// - INFLIGHT_MAX_REQUESTS: 同时进行的 /v1 请求上限（默认0，关闭）
+// - INFLIGHT_MODE: 达到上限时 reject（立即失败，默认）或 queue（等待空闲名额）
+// - INFLIGHT_QUEUE_MAX_DEPTH: queue 模式下的最大等待请求数（默认等于上限）
+// - INFLIGHT_QUEUE_MAX_WAIT_SECONDS: queue 模式下单个请求的最长等待时间（默认10）
+// - PRIORITY_SHED_LOW: queue 模式下名额已满时低优先级请求不排队，直接拒绝（默认 false）
+func LoadInflightLimiterFromEnv() (*InflightLimiter, error) {
+	maxRequests := utils.GetEnvIntWithDefault("INFLIGHT_MAX_REQUESTS", 0)
+	if maxRequests < 0 {
+		return nil, fmt.Errorf("INFLIGHT_MAX_REQUESTS 不能为负数")
+	}
+	if maxRequests == 0 {
+		return nil, nil
+	}
+
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("INFLIGHT_MODE")))
+	switch mode {
+	case "":
+		mode = inflightModeReject
+	case inflightModeReject, inflightModeQueue:
+	default:
+		return nil, fmt.Errorf("INFLIGHT_MODE 只能是 reject 或 queue: %s", mode)
+	}
+
+	maxQueue := utils.GetEnvIntWithDefault("INFLIGHT_QUEUE_MAX_DEPTH", maxRequests)
+	if maxQueue < 0 {
+		return nil, fmt.Errorf("INFLIGHT_QUEUE_MAX_DEPTH 不能为负数")
+	}
+	maxWait := utils.GetEnvIntWithDefault("INFLIGHT_QUEUE_MAX_WAIT_SECONDS", 10)
+	if maxWait <= 0 {
+		return nil, fmt.Errorf("INFLIGHT_QUEUE_MAX_WAIT_SECONDS 必须大于0")
+	}
+	limiter := NewInflightLimiter(maxRequests, mode, maxQueue, time.Duration(maxWait)*time.Second)
+	limiter.shedLow = utils.GetEnvBoolWithDefault("PRIORITY_SHED_LOW", false)
+	return limiter, nil
+}
+
+// NewInflightLimiter 创建全局并发上限，mode 为 reject 时忽略 maxQueue 与 maxWait
+func NewInflightLimiter(maxRequests int, mode string, maxQueue int, maxWait time.Duration) *InflightLimiter {
+	return &InflightLimiter{
+		max:      maxRequests,
+		mode:     mode,
+		maxQueue: maxQueue,
+		maxWait:  maxWait,
+		slots:    make(chan struct{}, maxRequests),
+	}
+}
+
+// Acquire 以普通优先级占用一个名额，见 AcquirePriority
+func (l *InflightLimiter) Acquire(ctx context.Context) (release func(), ok bool) {
+	return l.AcquirePriority(ctx, PriorityNormal)
+}
+
+// AcquirePriority 占用一个名额，成功时返回归还名额的 release
+// 名额已满时 reject 模式立即返回 false；queue 模式等待空闲名额，队列已满、等待超时或请求取消时返回 false；
+// 启用低优先级卸载时低优先级请求不等待
+func (l *InflightLimiter) AcquirePriority(ctx context.Context, priority RequestPriority) (release func(), ok bool) {
+	select {
+	case l.slots <- struct{}{}:
+		return l.admit(), true
+	default:
+	}
+
+	if l.mode != inflightModeQueue {
+		l.rejected.Add(1)
+		return nil, false
+	}
+	if priority == PriorityLow && l.shedLow {
+		l.shed.Add(1)
+		return nil, false
+	}
+	if l.waiting.Add(1) > int64(l.maxQueue) {
+		l.waiting.Add(-1)
+		l.rejected.Add(1)
+		return nil, false
+	}
+	defer l.waiting.Add(-1)
+	l.queued.Add(1)
+
+	timer := time.NewTimer(l.maxWait)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return l.admit(), true
+	case <-timer.C:
+		l.timedOut.Add(1)
+		return nil, false
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// admit 记录放行并返回只归还一次的 release
+func (l *InflightLimiter) admit() func() {
+	l.admitted.Add(1)
+	current := int64(len(l.slots))
+	for peak := l.peak.Load(); current > peak && !l.peak.CompareAndSwap(peak, current); peak = l.peak.Load() {
+	}
+	var released atomic.Bool
+	return func() {
+		if released.CompareAndSwap(false, true) {
+			<-l.slots
+		}
+	}
+}
+
+// Stats 全局并发统计（未启用时只返回 enabled=false）
+func (l *InflightLimiter) Stats() InflightStats {
+	if l == nil {
+		return InflightStats{}
+	}
+	stats := InflightStats{
+		Enabled:  true,
+		Mode:     l.mode,
+		InFlight: len(l.slots),
+		Max:      l.max,
+		Peak:     l.peak.Load(),
+		Waiting:  l.waiting.Load(),
+		Admitted: l.admitted.Load(),
+		Queued:   l.queued.Load(),
+		Rejected: l.rejected.Load(),
+		TimedOut: l.timedOut.Load(),
+		Shed:     l.shed.Load(),
+	}
+	if l.mode == inflightModeQueue {
+		stats.MaxQueue = l.maxQueue
+		stats.MaxWaitSeconds = l.maxWait.Seconds()
+	}
+	return stats
+}
+
+// handleInflightStats 返回全局并发统计
+func handleInflightStats(c *gin.Context) {
+	c.JSON(http.StatusOK, inflightLimiter.Stats())
+}
+
+// InflightLimitMiddleware 限制同时进行的 /v1 POST 请求数（需位于认证与限流之后，被拒绝的请求不占用名额）
+// 名额在处理器返回后归还，流式请求占用到响应结束
+func InflightLimitMiddleware(limiter *InflightLimiter, prefixes []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil || c.Request.Method != http.MethodPost || !requiresAuth(c.Request.URL.Path, prefixes) {
+			c.Next()
+			return
+		}
+
+		release, ok := admitInflight(c, limiter)
+		if !ok {
+			c.Abort()
+			return
+		}
+		defer release()
+
+		c.Next()
+	}
+}
+
+// admitInflight 占用一个全局进行中请求名额，名额已满时写入 503 响应（客户端已断开时不写）；
+// WebSocket 的每个请求帧同样经此占用名额
+func admitInflight(c *gin.Context, limiter *InflightLimiter) (release func(), ok bool) {
+	if limiter == nil {
+		return func() {}, true
+	}
+	priority := requestPriority(c)
+	release, ok = limiter.AcquirePriority(c.Request.Context(), priority)
+	if ok {
+		return release, true
+	}
+	if clientGone(c) {
+		return nil, false
+	}
+	logger.Warn("进行中的请求已达全局上限，拒绝请求",
+		addReqFields(c,
+			logger.String("mode", limiter.mode),
+			logger.Int("max", limiter.max),
+			logger.String("priority", priority.String()),
+		)...)
+	c.Header("Retry-After", "1")
+	respondErrorWithCode(c, http.StatusServiceUnavailable, ErrCodeServerOverloaded, "服务繁忙：进行中的请求已达上限（%d），请稍后重试", limiter.max)
+	return nil, false
+}
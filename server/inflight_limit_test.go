@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInflightLimiter_RejectMode(t *testing.T) {
+	limiter := NewInflightLimiter(2, inflightModeReject, 0, time.Second)
+
+	first, ok := limiter.Acquire(context.Background())
+	require.True(t, ok)
+	_, ok = limiter.Acquire(context.Background())
+	require.True(t, ok)
+
+	_, ok = limiter.Acquire(context.Background())
+	assert.False(t, ok, "名额已满时立即拒绝")
+
+	first()
+	first()
+	_, ok = limiter.Acquire(context.Background())
+	assert.True(t, ok, "重复 release 只归还一个名额")
+	_, ok = limiter.Acquire(context.Background())
+	assert.False(t, ok)
+
+	stats := limiter.Stats()
+	assert.Equal(t, 2, stats.InFlight)
+	assert.Equal(t, int64(2), stats.Peak)
+	assert.Equal(t, int64(3), stats.Admitted)
+	assert.Equal(t, int64(2), stats.Rejected)
+}
+
+func TestInflightLimiter_QueueMode(t *testing.T) {
+	limiter := NewInflightLimiter(1, inflightModeQueue, 1, time.Second)
+	release, ok := limiter.Acquire(context.Background())
+	require.True(t, ok)
+
+	admitted := make(chan bool)
+	go func() {
+		_, ok := limiter.Acquire(context.Background())
+		admitted <- ok
+	}()
+	require.Eventually(t, func() bool { return limiter.Stats().Waiting == 1 }, time.Second, 5*time.Millisecond)
+
+	_, ok = limiter.Acquire(context.Background())
+	assert.False(t, ok, "等待队列已满时立即拒绝")
+
+	release()
+	assert.True(t, <-admitted, "名额归还后排队的请求放行")
+	assert.Equal(t, int64(1), limiter.Stats().Queued)
+}
+
+func TestInflightLimiter_QueueTimeout(t *testing.T) {
+	limiter := NewInflightLimiter(1, inflightModeQueue, 1, 20*time.Millisecond)
+	_, ok := limiter.Acquire(context.Background())
+	require.True(t, ok)
+
+	_, ok = limiter.Acquire(context.Background())
+	assert.False(t, ok)
+	assert.Equal(t, int64(1), limiter.Stats().TimedOut)
+	assert.Equal(t, int64(0), limiter.Stats().Waiting)
+}
+
+func TestInflightLimiter_ShedLowPriority(t *testing.T) {
+	limiter := NewInflightLimiter(1, inflightModeQueue, 1, 20*time.Millisecond)
+	limiter.shedLow = true
+	_, ok := limiter.AcquirePriority(context.Background(), PriorityLow)
+	require.True(t, ok, "有空闲名额时低优先级请求正常放行")
+
+	_, ok = limiter.AcquirePriority(context.Background(), PriorityLow)
+	assert.False(t, ok)
+	stats := limiter.Stats()
+	assert.Equal(t, int64(1), stats.Shed)
+	assert.Equal(t, int64(0), stats.Queued, "低优先级请求不排队")
+
+	_, ok = limiter.AcquirePriority(context.Background(), PriorityHigh)
+	assert.False(t, ok)
+	assert.Equal(t, int64(1), limiter.Stats().Queued, "其他优先级仍然排队")
+}
+
+func TestInflightLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := NewInflightLimiter(1, inflightModeReject, 0, time.Second)
+
+	entered := make(chan struct{})
+	unblock := make(chan struct{})
+	r := gin.New()
+	r.Use(InflightLimitMiddleware(limiter, []string{"/v1"}))
+	r.POST("/v1/messages", func(c *gin.Context) {
+		close(entered)
+		<-unblock
+		c.Status(http.StatusOK)
+	})
+	r.GET("/v1/models", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/v1/messages", nil))
+	}()
+	<-entered
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/messages", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	assert.Contains(t, w.Body.String(), "server_overloaded")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/v1/models", nil))
+	assert.Equal(t, http.StatusOK, w.Code, "GET 请求不受全局上限限制")
+
+	close(unblock)
+	<-done
+	assert.Equal(t, 0, limiter.Stats().InFlight)
+}
+
+func TestLoadInflightLimiterFromEnv(t *testing.T) {
+	limiter, err := LoadInflightLimiterFromEnv()
+	require.NoError(t, err)
+	assert.Nil(t, limiter)
+
+	t.Setenv("INFLIGHT_MAX_REQUESTS", "100")
+	t.Setenv("INFLIGHT_MODE", "queue")
+	limiter, err = LoadInflightLimiterFromEnv()
+	require.NoError(t, err)
+	stats := limiter.Stats()
+	assert.Equal(t, inflightModeQueue, stats.Mode)
+	assert.Equal(t, 100, stats.MaxQueue)
+	assert.Equal(t, 10.0, stats.MaxWaitSeconds)
+
+	t.Setenv("INFLIGHT_MODE", "drop")
+	_, err = LoadInflightLimiterFromEnv()
+	assert.Error(t, err)
+}
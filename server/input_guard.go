@@ -0,0 +1,161 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"kiro2api/converter"
+	"kiro2api/logger"
+	"kiro2api/types"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 输入超限时的处理方式
+const (
+	inputOverflowReject   = "reject"
+	inputOverflowTruncate = "truncate"
+)
+
+// inputGuard 当前生效的输入 token 守卫，未配置 INPUT_MAX_TOKENS 时为 nil（不检查）
+var inputGuard *InputGuard
+
+// InputGuard 输入 token 守卫：在转换为上游请求前按估算的输入 token 数检查对话历史，
+// 超过上限时直接拒绝，或丢弃中间的对话轮次（保留系统提示、第一轮与最近若干轮），避免上游对超长历史静默失败
+type InputGuard struct {
+	MaxTokens int    // 输入 token 上限（按本地估算）
+	Mode      string // reject / truncate
+	KeepTurns int    // 截断时最多保留的最近轮次数
+}
+
+// LoadInputGuardFromEnv 从环境变量加载输入 token 守卫，未配置上限时返回 nil
+// - INPUT_MAX_TOKENS: 输入 token 上限（默认0，不检查）
+// - INPUT_OVERFLOW_MODE: 超限处理方式 reject（默认，返回400）或 truncate（丢弃中间轮次）
+// - INPUT_KEEP_TURNS: 截断时最多保留的最近轮次数（默认4）
+func LoadInputGuardFromEnv() (*InputGuard, error) {
+	maxTokens := utils.GetEnvIntWithDefault("INPUT_MAX_TOKENS", 0)
+	if maxTokens < 0 {
+		return nil, fmt.Errorf("INPUT_MAX_TOKENS 不能为负数")
+	}
+	if maxTokens == 0 {
+		return nil, nil
+	}
+
+	guard := &InputGuard{
+		MaxTokens: maxTokens,
+		Mode:      strings.ToLower(strings.TrimSpace(utils.GetEnvWithDefault("INPUT_OVERFLOW_MODE", inputOverflowReject))),
+		KeepTurns: utils.GetEnvIntWithDefault("INPUT_KEEP_TURNS", 4),
+	}
+	if guard.Mode != inputOverflowReject && guard.Mode != inputOverflowTruncate {
+		return nil, fmt.Errorf("INPUT_OVERFLOW_MODE 必须是 reject 或 truncate: %q", guard.Mode)
+	}
+	if guard.KeepTurns < 1 {
+		return nil, fmt.Errorf("INPUT_KEEP_TURNS 不能小于 1")
+	}
+	return guard, nil
+}
+
+// guardInput 按输入 token 守卫检查请求，返回的错误为 converter.RequestError（code 为 context_length_exceeded）
+func guardInput(c *gin.Context, req types.AnthropicRequest) (types.AnthropicRequest, error) {
+	if inputGuard == nil {
+		return req, nil
+	}
+	guarded, dropped, err := inputGuard.enforce(req)
+	if err != nil {
+		logger.Warn("输入超过token上限，拒绝请求", addReqFields(c, logger.String("model", req.Model), logger.Err(err))...)
+		return req, err
+	}
+	if dropped > 0 {
+		logger.Info("输入超过token上限，已截断中间的对话历史",
+			addReqFields(c,
+				logger.String("model", req.Model),
+				logger.Int("dropped_messages", dropped),
+				logger.Int("kept_messages", len(guarded.Messages)),
+			)...)
+	}
+	return guarded, nil
+}
+
+// enforce 检查估算的输入 token 数，返回（可能截断后的）请求与丢弃的消息数
+func (g *InputGuard) enforce(req types.AnthropicRequest) (types.AnthropicRequest, int, error) {
+	tokens := estimateInputTokens(req)
+	if tokens <= g.MaxTokens {
+		return req, 0, nil
+	}
+	if g.Mode == inputOverflowTruncate {
+		if truncated, ok := g.truncate(req); ok {
+			return truncated, len(req.Messages) - len(truncated.Messages), nil
+		}
+		return req, 0, g.exceeded(tokens, "截断对话历史后仍超过上限，")
+	}
+	return req, 0, g.exceeded(tokens, "")
+}
+
+// exceeded 构造超限错误
+func (g *InputGuard) exceeded(tokens int, detail string) error {
+	return &converter.RequestError{
+		Message: fmt.Sprintf("输入约 %d 个 token，超过上限 %d，%s请缩减对话历史或附带的内容", tokens, g.MaxTokens, detail),
+		Param:   "messages",
+		Code:    converter.CodeContextLengthExceeded,
+	}
+}
+
+// truncate 丢弃中间的对话轮次：优先保留第一轮与尽可能多的最近轮次（不超过 KeepTurns），
+// 其次只保留最近轮次；系统提示与工具定义始终保留。轮次以用户发起的消息（不含工具结果）为界，
+// 因此 tool_use 与对应的 tool_result 不会被拆开，截断后仍以 user 消息开头
+func (g *InputGuard) truncate(req types.AnthropicRequest) (types.AnthropicRequest, bool) {
+	starts := turnStarts(req.Messages)
+	if len(starts) < 2 {
+		return req, false
+	}
+
+	try := func(messages []types.AnthropicRequestMessage) (types.AnthropicRequest, bool) {
+		candidate := req
+		candidate.Messages = messages
+		return candidate, estimateInputTokens(candidate) <= g.MaxTokens
+	}
+	for keep := min(g.KeepTurns, len(starts)-1); keep >= 1; keep-- {
+		tail := starts[len(starts)-keep]
+		if head := starts[1]; head < tail {
+			messages := append(append([]types.AnthropicRequestMessage{}, req.Messages[:head]...), req.Messages[tail:]...)
+			if candidate, ok := try(messages); ok {
+				return candidate, true
+			}
+		}
+		if candidate, ok := try(req.Messages[tail:]); ok {
+			return candidate, true
+		}
+	}
+	return req, false
+}
+
+// turnStarts 返回每一轮对话的起始下标：用户发起的消息（不是只回传工具结果的 user 消息）
+func turnStarts(messages []types.AnthropicRequestMessage) []int {
+	var starts []int
+	for i, msg := range messages {
+		if msg.Role == "user" && !hasToolResult(msg.Content) {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+// hasToolResult 消息内容中是否包含 tool_result 块
+func hasToolResult(content any) bool {
+	switch blocks := content.(type) {
+	case []any:
+		for _, block := range blocks {
+			if b, ok := block.(map[string]any); ok && b["type"] == "tool_result" {
+				return true
+			}
+		}
+	case []types.ContentBlock:
+		for _, block := range blocks {
+			if block.Type == "tool_result" {
+				return true
+			}
+		}
+	}
+	return false
+}
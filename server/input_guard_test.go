@@ -0,0 +1,116 @@
+package server
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"kiro2api/converter"
+	"kiro2api/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadInputGuardFromEnv(t *testing.T) {
+	t.Setenv("INPUT_MAX_TOKENS", "")
+	guard, err := LoadInputGuardFromEnv()
+	require.NoError(t, err)
+	assert.Nil(t, guard)
+
+	t.Setenv("INPUT_MAX_TOKENS", "1000")
+	t.Setenv("INPUT_OVERFLOW_MODE", " Truncate ")
+	t.Setenv("INPUT_KEEP_TURNS", "2")
+	guard, err = LoadInputGuardFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, &InputGuard{MaxTokens: 1000, Mode: inputOverflowTruncate, KeepTurns: 2}, guard)
+
+	invalid := map[string][3]string{
+		"负数上限":   {"-1", "reject", "4"},
+		"未知处理方式": {"1000", "drop", "4"},
+		"保留轮次为0": {"1000", "truncate", "0"},
+	}
+	for name, env := range invalid {
+		t.Setenv("INPUT_MAX_TOKENS", env[0])
+		t.Setenv("INPUT_OVERFLOW_MODE", env[1])
+		t.Setenv("INPUT_KEEP_TURNS", env[2])
+		_, err := LoadInputGuardFromEnv()
+		assert.Error(t, err, name)
+	}
+}
+
+// guardTestRequest 四轮对话：第二轮包含工具调用与工具结果，中间两轮正文较长
+func guardTestRequest() types.AnthropicRequest {
+	long := strings.Repeat("lorem ipsum dolor sit amet ", 200)
+	return types.AnthropicRequest{
+		Model:  "claude-sonnet-4",
+		System: []types.AnthropicSystemMessage{{Type: "text", Text: "You are helpful."}},
+		Messages: []types.AnthropicRequestMessage{
+			{Role: "user", Content: "task description"},
+			{Role: "assistant", Content: "ok"},
+			{Role: "user", Content: long},
+			{Role: "assistant", Content: []any{map[string]any{"type": "tool_use", "id": "toolu_1", "name": "f", "input": map[string]any{}}}},
+			{Role: "user", Content: []any{map[string]any{"type": "tool_result", "tool_use_id": "toolu_1", "content": long}}},
+			{Role: "assistant", Content: "done"},
+			{Role: "user", Content: long},
+			{Role: "assistant", Content: "fine"},
+			{Role: "user", Content: "latest question"},
+		},
+	}
+}
+
+func TestInputGuard_Reject(t *testing.T) {
+	req := guardTestRequest()
+	tokens := estimateInputTokens(req)
+
+	guard := &InputGuard{MaxTokens: tokens, Mode: inputOverflowReject, KeepTurns: 4}
+	out, dropped, err := guard.enforce(req)
+	require.NoError(t, err)
+	assert.Zero(t, dropped)
+	assert.Len(t, out.Messages, len(req.Messages))
+
+	guard.MaxTokens = tokens - 1
+	_, _, err = guard.enforce(req)
+	var reqErr *converter.RequestError
+	require.True(t, errors.As(err, &reqErr))
+	assert.Equal(t, "messages", reqErr.Param)
+	assert.Equal(t, converter.CodeContextLengthExceeded, reqErr.Code)
+}
+
+func TestInputGuard_Truncate(t *testing.T) {
+	req := guardTestRequest()
+	firstAndLast := req
+	firstAndLast.Messages = append(append([]types.AnthropicRequestMessage{}, req.Messages[:2]...), req.Messages[8:]...)
+	lastTwo := req
+	lastTwo.Messages = req.Messages[6:]
+
+	// 上限只够保留第一轮与最后一轮：丢弃中间两轮（工具调用与结果一起丢弃）
+	guard := &InputGuard{MaxTokens: estimateInputTokens(firstAndLast), Mode: inputOverflowTruncate, KeepTurns: 4}
+	out, dropped, err := guard.enforce(req)
+	require.NoError(t, err)
+	assert.Equal(t, 6, dropped)
+	assert.Equal(t, firstAndLast.Messages, out.Messages)
+	assert.Equal(t, req.System, out.System)
+
+	// 上限允许时保留尽可能多的最近轮次，但不超过 KeepTurns
+	guard = &InputGuard{MaxTokens: estimateInputTokens(lastTwo) + 100, Mode: inputOverflowTruncate, KeepTurns: 4}
+	out, dropped, err = guard.enforce(req)
+	require.NoError(t, err)
+	assert.Equal(t, 4, dropped)
+	assert.Equal(t, append(append([]types.AnthropicRequestMessage{}, req.Messages[:2]...), req.Messages[6:]...), out.Messages)
+
+	guard.KeepTurns = 1
+	out, _, err = guard.enforce(req)
+	require.NoError(t, err)
+	assert.Equal(t, firstAndLast.Messages, out.Messages)
+
+	// 工具结果消息不作为轮次起点
+	assert.Equal(t, []int{0, 2, 6, 8}, turnStarts(req.Messages))
+
+	// 只保留最后一轮仍超限时拒绝
+	guard = &InputGuard{MaxTokens: 1, Mode: inputOverflowTruncate, KeepTurns: 4}
+	_, _, err = guard.enforce(req)
+	var reqErr *converter.RequestError
+	require.True(t, errors.As(err, &reqErr))
+	assert.Contains(t, reqErr.Message, "截断对话历史后仍超过上限")
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	"kiro2api/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IP访问控制的作用范围
+const (
+	ipScopeAdmin = "admin" // Dashboard、静态资源与 /api 管理接口
+	ipScopeV1    = "v1"    // /v1 代理接口
+)
+
+// IPAccessList 单个作用范围的IP访问控制，拒绝列表优先，允许列表为空时不限制
+type IPAccessList struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// NewIPAccessList 解析IP或CIDR列表
+func NewIPAccessList(allow, deny []string) (*IPAccessList, error) {
+	allowNets, err := parseIPNetworks(allow)
+	if err != nil {
+		return nil, fmt.Errorf("允许列表无效: %w", err)
+	}
+	denyNets, err := parseIPNetworks(deny)
+	if err != nil {
+		return nil, fmt.Errorf("拒绝列表无效: %w", err)
+	}
+	return &IPAccessList{allow: allowNets, deny: denyNets}, nil
+}
+
+// Check 判断IP是否允许访问，拒绝时返回原因
+func (l *IPAccessList) Check(ip net.IP) (bool, string) {
+	if l == nil {
+		return true, ""
+	}
+	if ip == nil {
+		return false, "invalid_ip"
+	}
+	if ipInNetworks(ip, l.deny) {
+		return false, "denylist"
+	}
+	if len(l.allow) > 0 && !ipInNetworks(ip, l.allow) {
+		return false, "not_in_allowlist"
+	}
+	return true, ""
+}
+
+// IPAccessConfig 按作用范围配置的IP访问控制，未配置的范围不限制
+type IPAccessConfig struct {
+	Admin *IPAccessList
+	V1    *IPAccessList
+}
+
+// LoadIPAccessConfigFromEnv 从环境变量加载IP访问控制（逗号分隔的IP或CIDR）
+// - ADMIN_IP_ALLOWLIST / ADMIN_IP_DENYLIST: Dashboard 与 /api 管理接口
+// - V1_IP_ALLOWLIST / V1_IP_DENYLIST: /v1 代理接口
+func LoadIPAccessConfigFromEnv() (IPAccessConfig, error) {
+	var cfg IPAccessConfig
+	var err error
+	if cfg.Admin, err = loadIPAccessList("ADMIN_IP_ALLOWLIST", "ADMIN_IP_DENYLIST"); err != nil {
+		return cfg, err
+	}
+	if cfg.V1, err = loadIPAccessList("V1_IP_ALLOWLIST", "V1_IP_DENYLIST"); err != nil {
+		return cfg, err
+	}
+	return cfg, nil
+}
+
+// loadIPAccessList 读取一组允许/拒绝列表环境变量，均未设置时返回 nil
+func loadIPAccessList(allowEnv, denyEnv string) (*IPAccessList, error) {
+	allow, deny := envList(allowEnv), envList(denyEnv)
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+	list, err := NewIPAccessList(allow, deny)
+	if err != nil {
+		return nil, fmt.Errorf("%s/%s: %w", allowEnv, denyEnv, err)
+	}
+	return list, nil
+}
+
+// envList 读取逗号分隔的环境变量，忽略空项
+func envList(key string) []string {
+	return splitList(os.Getenv(key))
+}
+
+// ipAccessScope 返回路径所属的作用范围，存活与就绪检查不受限制（供负载均衡探活）
+func ipAccessScope(path string) string {
+	switch {
+	case path == "/readyz" || path == "/healthz":
+		return ""
+	case strings.HasPrefix(path, "/v1"):
+		return ipScopeV1
+	default:
+		return ipScopeAdmin
+	}
+}
+
+// IPAccessMiddleware 按作用范围校验客户端IP（c.ClientIP()，受 TRUSTED_PROXIES 影响）
+// 拒绝的请求返回 403 并记录审计事件
+func IPAccessMiddleware(cfg IPAccessConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scope := ipAccessScope(c.Request.URL.Path)
+		list := cfg.Admin
+		if scope == ipScopeV1 {
+			list = cfg.V1
+		}
+		if scope == "" || list == nil {
+			c.Next()
+			return
+		}
+
+		clientIP := c.ClientIP()
+		allowed, reason := list.Check(net.ParseIP(clientIP))
+		if allowed {
+			c.Next()
+			return
+		}
+
+		logger.Warn("IP访问控制拒绝请求",
+			addReqFields(c,
+				logger.String("client_ip", clientIP),
+				logger.String("scope", scope),
+				logger.String("reason", reason),
+				logger.String("path", c.Request.URL.Path))...)
+		recordAuditEvent(c, "ip_blocked", "", http.StatusForbidden, map[string]any{
+			"scope":  scope,
+			"reason": reason,
+		})
+
+		if scope == ipScopeV1 {
+			respondErrorWithCode(c, http.StatusForbidden, "ip_not_allowed", "客户端IP %s 不允许访问该接口", clientIP)
+		} else {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "error": fmt.Sprintf("客户端IP %s 不允许访问管理后台", clientIP)})
+		}
+		c.Abort()
+	}
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kiro2api/audit"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newIPAccessRouter(t *testing.T, cfg IPAccessConfig) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(IPAccessMiddleware(cfg))
+	ok := func(c *gin.Context) { c.String(http.StatusOK, "ok") }
+	r.GET("/v1/models", ok)
+	r.GET("/api/tokens", ok)
+	r.GET("/readyz", ok)
+	return r
+}
+
+func requestFrom(r *gin.Engine, path, remoteAddr string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	req.RemoteAddr = remoteAddr
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestIPAccessMiddleware(t *testing.T) {
+	admin, err := NewIPAccessList([]string{"10.0.0.0/8"}, []string{"10.0.0.66"})
+	require.NoError(t, err)
+	v1, err := NewIPAccessList(nil, []string{"203.0.113.0/24"})
+	require.NoError(t, err)
+	r := newIPAccessRouter(t, IPAccessConfig{Admin: admin, V1: v1})
+
+	tests := []struct {
+		name       string
+		path       string
+		remoteAddr string
+		wantStatus int
+	}{
+		{"管理后台允许列表内", "/api/tokens", "10.1.2.3:5000", http.StatusOK},
+		{"管理后台不在允许列表", "/api/tokens", "198.51.100.1:5000", http.StatusForbidden},
+		{"拒绝列表优先", "/api/tokens", "10.0.0.66:5000", http.StatusForbidden},
+		{"v1未配置允许列表时放行", "/v1/models", "198.51.100.1:5000", http.StatusOK},
+		{"v1拒绝列表", "/v1/models", "203.0.113.9:5000", http.StatusForbidden},
+		{"就绪检查不受限制", "/readyz", "203.0.113.9:5000", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantStatus, requestFrom(r, tt.path, tt.remoteAddr).Code)
+		})
+	}
+
+	w := requestFrom(r, "/v1/models", "203.0.113.9:5000")
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "ip_not_allowed", body["error"].(map[string]any)["code"])
+}
+
+func TestIPAccessMiddleware_AuditsBlockedRequests(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	writer, err := audit.NewWriter(path, audit.DefaultOptions())
+	require.NoError(t, err)
+	auditLog = writer
+	t.Cleanup(func() { auditLog = nil })
+
+	v1, err := NewIPAccessList([]string{"10.0.0.0/8"}, nil)
+	require.NoError(t, err)
+	r := newIPAccessRouter(t, IPAccessConfig{V1: v1})
+	requestFrom(r, "/v1/models", "198.51.100.1:5000")
+	writer.Close()
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	require.True(t, scanner.Scan())
+	var rec audit.Record
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &rec))
+	assert.Equal(t, "ip_blocked", rec.Action)
+	assert.Equal(t, "198.51.100.1", rec.ClientIP)
+	assert.Equal(t, "not_in_allowlist", rec.Detail["reason"])
+}
+
+func TestNewIPAccessList_Invalid(t *testing.T) {
+	_, err := NewIPAccessList([]string{"10.0.0.0/33"}, nil)
+	assert.Error(t, err)
+	_, err = NewIPAccessList(nil, []string{"example.com"})
+	assert.Error(t, err)
+}
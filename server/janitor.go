@@ -0,0 +1,72 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"kiro2api/janitor"
+	"kiro2api/logger"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// runtimeJanitor 全局运行期产物清理器，各子系统启动时注册自己的清理目标
+var runtimeJanitor = janitor.New(0)
+
+// artifactRetention 按目录保留期清理的产物类型
+type artifactRetention struct {
+	name         string
+	dirEnv       string
+	retentionEnv string
+	defaultHours int
+}
+
+// artifactRetentions 可通过环境变量配置目录与保留期的产物
+var artifactRetentions = []artifactRetention{
+	{name: "batch_outputs", dirEnv: "BATCH_OUTPUT_DIR", retentionEnv: "BATCH_OUTPUT_RETENTION_HOURS", defaultHours: 72},
+	{name: "capture_bundles", dirEnv: "CAPTURE_DIR", retentionEnv: "CAPTURE_RETENTION_HOURS", defaultHours: 7 * 24},
+}
+
+// initJanitor 按环境变量注册清理目标并启动后台清理，extra 为子系统提供的内存条目清理目标
+// - JANITOR_INTERVAL_MINUTES: 清理间隔（默认60，0关闭后台清理，仍可手动触发）
+// - <产物>_DIR / <产物>_RETENTION_HOURS: 产物目录与保留期（未配置目录时不清理）
+func initJanitor(extra ...janitor.Target) {
+	interval := time.Duration(utils.GetEnvIntWithDefault("JANITOR_INTERVAL_MINUTES", 60)) * time.Minute
+	runtimeJanitor = janitor.New(interval)
+	for _, target := range extra {
+		runtimeJanitor.Register(target)
+	}
+
+	for _, r := range artifactRetentions {
+		dir := strings.TrimSpace(os.Getenv(r.dirEnv))
+		if dir == "" {
+			continue
+		}
+		retention := time.Duration(utils.GetEnvIntWithDefault(r.retentionEnv, r.defaultHours)) * time.Hour
+		runtimeJanitor.Register(janitor.FileTarget{Label: r.name, Dir: dir, Retention: retention})
+		logger.Info("已注册运行期产物清理目标",
+			logger.String("target", r.name),
+			logger.String("dir", dir),
+			logger.Duration("retention", retention))
+	}
+
+	runtimeJanitor.Start()
+}
+
+// handleJanitorStats 查看各清理目标的累计回收指标
+func handleJanitorStats(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"interval_seconds": int(runtimeJanitor.Interval().Seconds()),
+		"targets":          runtimeJanitor.Stats(),
+	})
+}
+
+// handleJanitorRun 立即执行一轮清理
+func handleJanitorRun(c *gin.Context) {
+	results := runtimeJanitor.RunOnce(time.Now())
+	logger.Info("手动触发运行期产物清理", addReqFields(c, logger.Int("targets", len(results)))...)
+	c.JSON(http.StatusOK, gin.H{"success": true, "results": results})
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"kiro2api/janitor"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitJanitor_PrunesExpiredBatchDirs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	t.Setenv("JANITOR_INTERVAL_MINUTES", "0")
+	t.Setenv("BATCH_OUTPUT_DIR", dir)
+	t.Setenv("BATCH_OUTPUT_RETENTION_HOURS", "72")
+	t.Setenv("CAPTURE_DIR", "")
+	original := runtimeJanitor
+	t.Cleanup(func() { runtimeJanitor = original })
+
+	idempotency := NewIdempotencyStore(time.Minute, 10, 1024)
+	idempotency.now = func() time.Time { return time.Now().Add(-time.Hour) }
+	state, _ := idempotency.begin("k1", sha256.Sum256([]byte("body")))
+	require.Equal(t, idempotencyNew, state)
+	idempotency.complete("k1", http.StatusOK, "application/json", []byte(`{"ok":true}`), true)
+	initJanitor(janitor.FuncTarget{Label: "idempotency_entries", Fn: idempotency.Prune})
+
+	var calls atomic.Int32
+	s, err := NewBatchStore(BatchConfig{Dir: dir, Concurrency: 1, MaxRequests: 100}, newBatchTestEngine(t, nil, &calls), batchTestVerifier(t))
+	require.NoError(t, err)
+	expired, err := s.Create(batchLines(t, "ok"), "", "team-a")
+	require.NoError(t, err)
+	recent, err := s.Create(batchLines(t, "ok"), "", "team-a")
+	require.NoError(t, err)
+	waitBatchStatus(t, s, expired.ID, BatchStatusCompleted)
+	waitBatchStatus(t, s, recent.ID, BatchStatusCompleted)
+
+	// 两个任务目录都超过保留期，其中一个随后保存过元数据（如任务仍在执行）
+	old := time.Now().Add(-100 * time.Hour)
+	require.NoError(t, os.Chtimes(s.batchDir(expired.ID), old, old))
+	require.NoError(t, os.Chtimes(s.batchDir(recent.ID), old, old))
+	s.mu.Lock()
+	require.NoError(t, s.saveLocked(s.batches[recent.ID]))
+	s.mu.Unlock()
+
+	r := gin.New()
+	r.POST("/api/admin/janitor/run", handleJanitorRun)
+	r.GET("/api/admin/janitor", handleJanitorStats)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/admin/janitor/run", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	_, err = os.Stat(s.batchDir(expired.ID))
+	assert.True(t, os.IsNotExist(err), "超过保留期的任务目录应被删除")
+	_, err = os.Stat(s.batchDir(recent.ID))
+	assert.NoError(t, err, "最近保存过的任务目录应保留")
+	_, err = s.Get(expired.ID, "team-a")
+	assert.ErrorIs(t, err, errBatchNotFound)
+	assert.Equal(t, 0, idempotency.Len(), "过期的幂等记录应被清理")
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/admin/janitor", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var stats struct {
+		Targets []janitor.TargetStats `json:"targets"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &stats))
+	byName := make(map[string]janitor.TargetStats)
+	for _, target := range stats.Targets {
+		byName[target.Name] = target
+	}
+	assert.Equal(t, int64(1), byName["batch_outputs"].Removed)
+	assert.Positive(t, byName["batch_outputs"].ReclaimedBytes)
+	assert.Equal(t, int64(1), byName["idempotency_entries"].Removed)
+}
@@ -0,0 +1,333 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"kiro2api/logger"
+	"kiro2api/types"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// keyPolicies 按调用方密钥的模型白名单与参数上限（nil 表示不限制）
+var keyPolicies *KeyPolicyStore
+
+// errKeyPolicyNotFound 密钥未配置策略
+var errKeyPolicyNotFound = errors.New("密钥未配置策略")
+
+// errKeyPolicyViolation 请求违反调用方密钥的策略（错误响应已写出）
+var errKeyPolicyViolation = errors.New("请求违反密钥策略")
+
+// KeyPolicy 调用方密钥的请求策略
+// 模型不在白名单或使用被禁用的工具时拒绝请求；max_tokens 与 temperature 超出范围时截断到范围内；
+// priority 决定token池饱和排队时的处理顺序
+type KeyPolicy struct {
+	Models         []string  `json:"models,omitempty"`          // 允许的模型（客户端请求的模型名，以 * 结尾时按前缀匹配），为空表示不限制
+	MaxTokens      int       `json:"max_tokens,omitempty"`      // max_tokens 上限，0 表示不限制
+	TemperatureMin *float64  `json:"temperature_min,omitempty"` // temperature 下限
+	TemperatureMax *float64  `json:"temperature_max,omitempty"` // temperature 上限
+	DisableTools   bool      `json:"disable_tools,omitempty"`   // 禁止请求携带工具定义
+	Priority       string    `json:"priority,omitempty"`        // 请求优先级 high/normal/low（为空表示 normal），资源争用时高优先级先处理
+	UpdatedBy      string    `json:"updated_by,omitempty"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// validate 校验策略字段
+func (p KeyPolicy) validate() error {
+	for _, model := range p.Models {
+		if strings.TrimSpace(strings.TrimSuffix(model, "*")) == "" {
+			return fmt.Errorf("models 中的模型名不能为空")
+		}
+	}
+	if _, err := ParseRequestPriority(p.Priority); err != nil {
+		return err
+	}
+	if p.MaxTokens < 0 {
+		return fmt.Errorf("max_tokens 不能为负数")
+	}
+	if (p.TemperatureMin != nil && *p.TemperatureMin < 0) || (p.TemperatureMax != nil && *p.TemperatureMax < 0) {
+		return fmt.Errorf("temperature_min 与 temperature_max 不能为负数")
+	}
+	if p.TemperatureMin != nil && p.TemperatureMax != nil && *p.TemperatureMin > *p.TemperatureMax {
+		return fmt.Errorf("temperature_min 不能大于 temperature_max")
+	}
+	return nil
+}
+
+// AllowsModel 模型是否在白名单内（不区分大小写），未配置白名单时允许所有模型
+func (p *KeyPolicy) AllowsModel(model string) bool {
+	if p == nil || len(p.Models) == 0 {
+		return true
+	}
+	for _, allowed := range p.Models {
+		if modelPatternMatches(allowed, model) {
+			return true
+		}
+	}
+	return false
+}
+
+// modelPatternMatches 模型名是否匹配模式（不区分大小写，以 * 结尾时按前缀匹配）
+func modelPatternMatches(pattern, model string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+		return len(model) >= len(prefix) && strings.EqualFold(model[:len(prefix)], prefix)
+	}
+	return strings.EqualFold(model, pattern)
+}
+
+// Clamp 将 max_tokens 与 temperature 截断到策略允许的范围内（在模型默认参数之后应用）
+func (p *KeyPolicy) Clamp(req types.AnthropicRequest) types.AnthropicRequest {
+	if p == nil {
+		return req
+	}
+	if p.MaxTokens > 0 && (req.MaxTokens <= 0 || req.MaxTokens > p.MaxTokens) {
+		req.MaxTokens = p.MaxTokens
+	}
+	if req.Temperature != nil {
+		temperature := *req.Temperature
+		if p.TemperatureMin != nil && temperature < *p.TemperatureMin {
+			temperature = *p.TemperatureMin
+		}
+		if p.TemperatureMax != nil && temperature > *p.TemperatureMax {
+			temperature = *p.TemperatureMax
+		}
+		req.Temperature = &temperature
+	}
+	return req
+}
+
+// KeyPolicyStore 调用方密钥策略存储（文件持久化），键为密钥ID（签名密钥ID，Bearer 认证时为 default）
+type KeyPolicyStore struct {
+	mu       sync.RWMutex
+	policies map[string]KeyPolicy
+	filePath string // 为空时仅保存在内存中
+}
+
+// NewKeyPolicyStore 创建密钥策略存储，文件存在时加载
+func NewKeyPolicyStore(filePath string) (*KeyPolicyStore, error) {
+	s := &KeyPolicyStore{
+		policies: make(map[string]KeyPolicy),
+		filePath: filePath,
+	}
+	if filePath == "" {
+		return s, nil
+	}
+
+	content, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取密钥策略文件失败: %w\n密钥策略文件路径: %s", err, filePath)
+	}
+	if err := json.Unmarshal(content, &s.policies); err != nil {
+		return nil, fmt.Errorf("解析密钥策略文件失败: %w\n密钥策略文件路径: %s", err, filePath)
+	}
+	if s.policies == nil {
+		s.policies = make(map[string]KeyPolicy)
+	}
+	for keyID, policy := range s.policies {
+		if err := policy.validate(); err != nil {
+			return nil, fmt.Errorf("密钥 %s 的策略无效: %w", keyID, err)
+		}
+	}
+
+	logger.Info("从文件加载密钥策略",
+		logger.String("file_path", filePath),
+		logger.Int("policy_count", len(s.policies)))
+	return s, nil
+}
+
+// ForKey 返回密钥的策略，未配置时返回 nil
+func (s *KeyPolicyStore) ForKey(keyID string) *KeyPolicy {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	policy, ok := s.policies[keyID]
+	if !ok {
+		return nil
+	}
+	return &policy
+}
+
+// Count 已配置策略的密钥数
+func (s *KeyPolicyStore) Count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.policies)
+}
+
+// Set 替换密钥的策略并持久化
+func (s *KeyPolicyStore) Set(keyID string, policy KeyPolicy) (KeyPolicy, error) {
+	if strings.TrimSpace(keyID) == "" {
+		return KeyPolicy{}, fmt.Errorf("密钥ID不能为空")
+	}
+	if err := policy.validate(); err != nil {
+		return KeyPolicy{}, err
+	}
+	policy.UpdatedAt = time.Now().UTC()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.policies[keyID]
+	s.policies[keyID] = policy
+	if err := s.saveLocked(); err != nil {
+		if existed {
+			s.policies[keyID] = previous
+		} else {
+			delete(s.policies, keyID)
+		}
+		return KeyPolicy{}, err
+	}
+	return policy, nil
+}
+
+// Delete 删除密钥的策略并持久化
+func (s *KeyPolicyStore) Delete(keyID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, exists := s.policies[keyID]
+	if !exists {
+		return fmt.Errorf("%w: %s", errKeyPolicyNotFound, keyID)
+	}
+	delete(s.policies, keyID)
+	if err := s.saveLocked(); err != nil {
+		s.policies[keyID] = previous
+		return err
+	}
+	return nil
+}
+
+// saveLocked 持久化策略到文件（调用时需持有锁）
+func (s *KeyPolicyStore) saveLocked() error {
+	if s.filePath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.policies, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化密钥策略失败: %w", err)
+	}
+	if err := os.WriteFile(s.filePath, data, 0o600); err != nil {
+		return fmt.Errorf("写入密钥策略文件失败: %w\n密钥策略文件路径: %s", err, s.filePath)
+	}
+	return nil
+}
+
+// checkKeyPolicy 在选择账号前按调用方密钥的策略校验请求，违反策略时写出错误响应并返回 false
+// - 模型不在白名单内返回403 model_not_allowed
+// - 禁用工具时携带工具定义返回400 tools_not_allowed
+func checkKeyPolicy(c *gin.Context, model string, body []byte) bool {
+	keyID := GetClientKeyID(c)
+	policy := keyPolicies.ForKey(keyID)
+	if policy == nil {
+		return true
+	}
+	if !policy.AllowsModel(model) {
+		logger.Warn("密钥策略不允许该模型", addReqFields(c, logger.String("client_key", keyID), logger.String("model", model))...)
+		respondErrorWithCode(c, http.StatusForbidden, "model_not_allowed", "当前密钥不允许使用模型: %s", model)
+		return false
+	}
+	if policy.DisableTools && requestHasTools(body) {
+		logger.Warn("密钥策略禁止使用工具", addReqFields(c, logger.String("client_key", keyID), logger.String("model", model))...)
+		respondErrorWithCode(c, http.StatusBadRequest, "tools_not_allowed", "%s", "当前密钥不允许在请求中使用工具")
+		return false
+	}
+	return true
+}
+
+// requestHasTools 请求体是否携带工具定义（Anthropic/OpenAI/Gemini/Ollama 的 tools 与 OpenAI 旧版 functions）
+func requestHasTools(body []byte) bool {
+	var req struct {
+		Tools     json.RawMessage `json:"tools"`
+		Functions json.RawMessage `json:"functions"`
+	}
+	if err := utils.FastUnmarshal(body, &req); err != nil {
+		return false
+	}
+	return nonEmptyJSON(req.Tools) || nonEmptyJSON(req.Functions)
+}
+
+// nonEmptyJSON 原始JSON是否为非空值（null、空数组、空对象视为空）
+func nonEmptyJSON(raw json.RawMessage) bool {
+	switch strings.TrimSpace(string(raw)) {
+	case "", "null", "[]", "{}":
+		return false
+	}
+	return true
+}
+
+// clampKeyPolicy 按调用方密钥的策略截断 max_tokens 与 temperature
+func clampKeyPolicy(c *gin.Context, req types.AnthropicRequest) types.AnthropicRequest {
+	return keyPolicies.ForKey(GetClientKeyID(c)).Clamp(req)
+}
+
+// registerKeyPolicyRoutes 注册密钥策略API：查看沿用管理API的默认权限，修改与删除策略仅管理员可用
+func registerKeyPolicyRoutes(g gin.IRoutes) {
+	g.GET("/keys/:id/policy", handleGetKeyPolicy)
+	g.PUT("/keys/:id/policy", RequireRole(RoleAdmin), handlePutKeyPolicy)
+	g.DELETE("/keys/:id/policy", RequireRole(RoleAdmin), handleDeleteKeyPolicy)
+}
+
+// handleGetKeyPolicy 返回密钥的策略
+func handleGetKeyPolicy(c *gin.Context) {
+	id := c.Param("id")
+	policy := keyPolicies.ForKey(id)
+	if policy == nil {
+		respondErrorWithCode(c, http.StatusNotFound, "policy_not_found", "%v: %s", errKeyPolicyNotFound, id)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "id": id, "policy": policy})
+}
+
+// handlePutKeyPolicy 替换密钥的策略，立即对后续请求生效
+func handlePutKeyPolicy(c *gin.Context) {
+	var policy KeyPolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		respondErrorWithCode(c, http.StatusBadRequest, "invalid_request_error", "无效的请求格式: %v", err)
+		return
+	}
+	policy.UpdatedBy = GetSessionUser(c)
+
+	id := c.Param("id")
+	saved, err := keyPolicies.Set(id, policy)
+	if err != nil {
+		respondErrorWithCode(c, http.StatusBadRequest, "invalid_request_error", "%v", err)
+		return
+	}
+	logger.Info("更新密钥策略",
+		logger.String("client_key", id),
+		logger.Int("models", len(saved.Models)),
+		logger.Int("max_tokens", saved.MaxTokens),
+		logger.Bool("disable_tools", saved.DisableTools),
+		logger.String("operator", saved.UpdatedBy))
+	c.JSON(http.StatusOK, gin.H{"success": true, "id": id, "policy": saved})
+}
+
+// handleDeleteKeyPolicy 删除密钥的策略，恢复为不限制
+func handleDeleteKeyPolicy(c *gin.Context) {
+	id := c.Param("id")
+	if err := keyPolicies.Delete(id); err != nil {
+		if errors.Is(err, errKeyPolicyNotFound) {
+			respondErrorWithCode(c, http.StatusNotFound, "policy_not_found", "%v", err)
+			return
+		}
+		respondError(c, http.StatusInternalServerError, "%v", err)
+		return
+	}
+	logger.Info("删除密钥策略",
+		logger.String("client_key", id),
+		logger.String("operator", GetSessionUser(c)))
+	c.JSON(http.StatusOK, gin.H{"success": true, "id": id})
+}
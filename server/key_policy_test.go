@@ -0,0 +1,228 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withKeyPolicies(t *testing.T, store *KeyPolicyStore) {
+	original := keyPolicies
+	keyPolicies = store
+	t.Cleanup(func() { keyPolicies = original })
+}
+
+func TestKeyPolicy_AllowsModel(t *testing.T) {
+	var none *KeyPolicy
+	assert.True(t, none.AllowsModel("claude-opus-4-1"))
+	assert.True(t, (&KeyPolicy{}).AllowsModel("claude-opus-4-1"))
+
+	policy := &KeyPolicy{Models: []string{"claude-sonnet-4-20250514", "claude-haiku-*"}}
+	assert.True(t, policy.AllowsModel("claude-sonnet-4-20250514"))
+	assert.True(t, policy.AllowsModel("Claude-Haiku-4-5-20251001"))
+	assert.False(t, policy.AllowsModel("claude-opus-4-1-20250805"))
+	assert.False(t, policy.AllowsModel("claude"))
+	assert.False(t, policy.AllowsModel(""))
+}
+
+func TestKeyPolicy_Clamp(t *testing.T) {
+	low, high := 0.2, 0.8
+	policy := &KeyPolicy{MaxTokens: 1000, TemperatureMin: &low, TemperatureMax: &high}
+
+	temperature := 1.5
+	got := policy.Clamp(types.AnthropicRequest{MaxTokens: 4096, Temperature: &temperature})
+	assert.Equal(t, 1000, got.MaxTokens)
+	assert.Equal(t, 0.8, *got.Temperature)
+	assert.Equal(t, 1.5, temperature, "不修改调用方的请求")
+
+	zero := 0.0
+	got = policy.Clamp(types.AnthropicRequest{MaxTokens: 500, Temperature: &zero})
+	assert.Equal(t, 500, got.MaxTokens)
+	assert.Equal(t, 0.2, *got.Temperature)
+
+	got = policy.Clamp(types.AnthropicRequest{})
+	assert.Equal(t, 1000, got.MaxTokens, "未指定 max_tokens 时使用上限")
+	assert.Nil(t, got.Temperature)
+}
+
+func TestRequestPriority(t *testing.T) {
+	store, err := NewKeyPolicyStore("")
+	require.NoError(t, err)
+	_, err = store.Set("batch", KeyPolicy{Priority: "LOW"})
+	require.NoError(t, err)
+	_, err = store.Set("interactive", KeyPolicy{Priority: "high"})
+	require.NoError(t, err)
+	_, err = store.Set("batch", KeyPolicy{Priority: "urgent"})
+	assert.Error(t, err)
+	withKeyPolicies(t, store)
+
+	for keyID, want := range map[string]RequestPriority{"batch": PriorityLow, "interactive": PriorityHigh, "other": PriorityNormal} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Set(clientKeyIDKey, keyID)
+		assert.Equal(t, want, requestPriority(c), keyID)
+	}
+	assert.Equal(t, "low", PriorityLow.String())
+}
+
+func TestKeyPolicyStore_Persistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "key_policies.json")
+	store, err := NewKeyPolicyStore(path)
+	require.NoError(t, err)
+	assert.Nil(t, store.ForKey("ci-runner"))
+
+	saved, err := store.Set("ci-runner", KeyPolicy{Models: []string{"claude-haiku-*"}, DisableTools: true})
+	require.NoError(t, err)
+	assert.False(t, saved.UpdatedAt.IsZero())
+
+	low, high := 1.0, 0.5
+	_, err = store.Set("ci-runner", KeyPolicy{TemperatureMin: &low, TemperatureMax: &high})
+	assert.Error(t, err)
+	_, err = store.Set("ci-runner", KeyPolicy{MaxTokens: -1})
+	assert.Error(t, err)
+	_, err = store.Set(" ", KeyPolicy{})
+	assert.Error(t, err)
+
+	reloaded, err := NewKeyPolicyStore(path)
+	require.NoError(t, err)
+	policy := reloaded.ForKey("ci-runner")
+	require.NotNil(t, policy)
+	assert.Equal(t, []string{"claude-haiku-*"}, policy.Models)
+	assert.True(t, policy.DisableTools)
+
+	require.NoError(t, reloaded.Delete("ci-runner"))
+	assert.ErrorIs(t, reloaded.Delete("ci-runner"), errKeyPolicyNotFound)
+	reloaded, err = NewKeyPolicyStore(path)
+	require.NoError(t, err)
+	assert.Equal(t, 0, reloaded.Count())
+}
+
+func TestRequestContext_KeyPolicy(t *testing.T) {
+	store, err := NewKeyPolicyStore("")
+	require.NoError(t, err)
+	_, err = store.Set(defaultClientKeyID, KeyPolicy{Models: []string{"claude-haiku-*"}, DisableTools: true})
+	require.NoError(t, err)
+	withKeyPolicies(t, store)
+
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+		wantErr  string
+	}{
+		{"允许的模型", `{"model":"claude-haiku-4-5-20251001","tools":[]}`, http.StatusOK, ""},
+		{"模型不在白名单", `{"model":"claude-opus-4-1-20250805"}`, http.StatusForbidden, "model_not_allowed"},
+		{"禁用工具", `{"model":"claude-haiku-4-5-20251001","tools":[{"name":"search"}]}`, http.StatusBadRequest, "tools_not_allowed"},
+		{"禁用旧版函数调用", `{"model":"claude-haiku-4-5-20251001","functions":[{"name":"search"}]}`, http.StatusBadRequest, "tools_not_allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("POST", "/v1/messages", bytes.NewBufferString(tt.body))
+			c.Set(clientKeyIDKey, defaultClientKeyID)
+
+			mockAuth := &MockAuthService{token: types.TokenInfo{AccessToken: "t"}}
+			reqCtx := &RequestContext{GinContext: c, AuthService: mockAuth, RequestType: "test"}
+			_, _, err := reqCtx.GetTokenAndBody()
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, errKeyPolicyViolation)
+			assert.Equal(t, tt.wantCode, w.Code)
+			assert.Contains(t, w.Body.String(), tt.wantErr)
+			assert.Empty(t, mockAuth.model, "违反策略时不选择账号")
+		})
+	}
+
+	// 其他密钥不受影响
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("POST", "/v1/messages", bytes.NewBufferString(`{"model":"claude-opus-4-1-20250805"}`))
+	c.Set(clientKeyIDKey, "other")
+	_, _, err = (&RequestContext{GinContext: c, AuthService: &MockAuthService{}, RequestType: "test"}).GetTokenAndBody()
+	assert.NoError(t, err)
+}
+
+func TestKeyPolicyHandlers(t *testing.T) {
+	store, err := NewKeyPolicyStore("")
+	require.NoError(t, err)
+	withKeyPolicies(t, store)
+
+	router := gin.New()
+	router.GET("/api/keys/:id/policy", handleGetKeyPolicy)
+	router.PUT("/api/keys/:id/policy", handlePutKeyPolicy)
+	router.DELETE("/api/keys/:id/policy", handleDeleteKeyPolicy)
+	do := func(method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(method, "/api/keys/team-a/policy", bytes.NewBufferString(body)))
+		return w
+	}
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodGet, "").Code)
+
+	w := do(http.MethodPut, `{"models":["claude-sonnet-*"],"max_tokens":2048}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, 2048, store.ForKey("team-a").MaxTokens)
+
+	w = do(http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"claude-sonnet-*"`)
+
+	w = do(http.MethodPut, `{"max_tokens":-5}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, 2048, store.ForKey("team-a").MaxTokens, "无效策略不覆盖原策略")
+
+	assert.Equal(t, http.StatusOK, do(http.MethodDelete, "").Code)
+	assert.Nil(t, store.ForKey("team-a"))
+	assert.Equal(t, http.StatusNotFound, do(http.MethodDelete, "").Code)
+}
+
+func TestKeyPolicyRoutes_RequireAdminToModify(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store, err := NewKeyPolicyStore("")
+	require.NoError(t, err)
+	withKeyPolicies(t, store)
+	_, err = store.Set("team-a", KeyPolicy{Models: []string{"claude-sonnet-*"}})
+	require.NoError(t, err)
+
+	newRouter := func(role Role) *gin.Engine {
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			c.Set(sessionUserKey, "u")
+			c.Set(sessionRoleKey, role)
+			c.Next()
+		})
+		api := r.Group("/api")
+		api.Use(AdminAPIAuthGuard())
+		registerKeyPolicyRoutes(api)
+		return r
+	}
+
+	tests := []struct {
+		role   Role
+		method string
+		body   string
+		want   int
+	}{
+		{RoleViewer, http.MethodGet, "", http.StatusOK},
+		{RoleOperator, http.MethodPut, `{"max_tokens":1}`, http.StatusForbidden},
+		{RoleOperator, http.MethodDelete, "", http.StatusForbidden},
+		{RoleAdmin, http.MethodPut, `{"models":["claude-sonnet-*"],"max_tokens":1}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		newRouter(tt.role).ServeHTTP(w, httptest.NewRequest(tt.method, "/api/keys/team-a/policy", bytes.NewBufferString(tt.body)))
+		assert.Equal(t, tt.want, w.Code, "%s as %s", tt.method, tt.role)
+	}
+	assert.Equal(t, []string{"claude-sonnet-*"}, store.ForKey("team-a").Models, "运维角色不能移除模型白名单")
+	assert.Equal(t, 1, store.ForKey("team-a").MaxTokens)
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"kiro2api/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// defaultLogStreamBacklog 建立连接时回放的最近日志条数
+	defaultLogStreamBacklog = 100
+	// logStreamSubscriberBuffer 单个订阅者的缓冲条数，消费过慢时丢弃新日志
+	logStreamSubscriberBuffer = 256
+)
+
+// handleLogStream 通过SSE实时推送日志（先回放最近日志，再持续推送）
+// 查询参数：level 最低级别（默认debug，即当前输出的全部日志）、backlog 回放条数（默认100，0不回放）
+// 断线重连时浏览器携带 Last-Event-ID，仅回放之后的日志
+func handleLogStream(c *gin.Context) {
+	sink := logger.Sink()
+	if sink == nil {
+		respondError(c, http.StatusServiceUnavailable, "%s", "日志缓冲未启用（LOG_BUFFER_SIZE=0）")
+		return
+	}
+
+	minLevel := logger.DEBUG
+	if raw := c.Query("level"); raw != "" {
+		level, err := logger.ParseLevel(raw)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "无效的日志级别: %s", raw)
+			return
+		}
+		minLevel = level
+	}
+	backlog := defaultLogStreamBacklog
+	if raw := c.Query("backlog"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			respondError(c, http.StatusBadRequest, "无效的 backlog: %s", raw)
+			return
+		}
+		backlog = n
+	}
+	var lastSeq uint64
+	if raw := strings.TrimSpace(c.GetHeader("Last-Event-ID")); raw != "" {
+		if seq, err := strconv.ParseUint(raw, 10, 64); err == nil {
+			lastSeq = seq
+		}
+	}
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		respondError(c, http.StatusInternalServerError, "%s", "连接不支持SSE刷新")
+		return
+	}
+
+	// 先订阅再回放，避免两者之间的日志丢失；按序号去重
+	records, cancel := sink.Subscribe(logStreamSubscriberBuffer)
+	defer cancel()
+
+	setSSEHeaders(c)
+	c.Status(http.StatusOK)
+
+	send := func(record logger.Record) bool {
+		if record.Seq <= lastSeq || record.Level < minLevel {
+			return true
+		}
+		lastSeq = record.Seq
+		if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: log\ndata: %s\n\n", record.Seq, redactSecrets(record.Line)); err != nil {
+			return false
+		}
+		return true
+	}
+
+	if backlog > 0 {
+		for _, record := range sink.Recent(minLevel, lastSeq, backlog) {
+			if !send(record) {
+				return
+			}
+		}
+	}
+	flusher.Flush()
+
+	var keepalive <-chan time.Time
+	if sseKeepaliveInterval > 0 {
+		ticker := time.NewTicker(sseKeepaliveInterval)
+		defer ticker.Stop()
+		keepalive = ticker.C
+	}
+
+	done := c.Request.Context().Done()
+	for {
+		select {
+		case <-done:
+			return
+		case record, ok := <-records:
+			if !ok || !send(record) {
+				return
+			}
+			flusher.Flush()
+		case <-keepalive:
+			if _, err := c.Writer.WriteString(sseKeepaliveComment); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
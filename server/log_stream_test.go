@@ -0,0 +1,69 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"kiro2api/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogStream_ReplaysAndTailsFilteredLogs(t *testing.T) {
+	require.NotNil(t, logger.Sink())
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/logs/stream", handleLogStream)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	logger.Warn("log-stream-backlog", logger.String("authorization", "Bearer secret-token-value"))
+	logger.Info("log-stream-info-filtered")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/api/logs/stream?level=warn&backlog=50", nil)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, resp.Header.Get("Content-Type"), "text/event-stream")
+
+	scanner := bufio.NewScanner(resp.Body)
+	waitFor := func(marker string) string {
+		for scanner.Scan() {
+			line := scanner.Text()
+			assert.NotContains(t, line, "log-stream-info-filtered")
+			if strings.HasPrefix(line, "data: ") && strings.Contains(line, marker) {
+				return line
+			}
+		}
+		t.Fatalf("未收到日志 %s: %v", marker, scanner.Err())
+		return ""
+	}
+
+	backlogLine := waitFor("log-stream-backlog")
+	assert.NotContains(t, backlogLine, "secret-token-value", "推送的日志需脱敏")
+
+	logger.Error("log-stream-live")
+	waitFor("log-stream-live")
+}
+
+func TestLogStream_InvalidQuery(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/api/logs/stream", handleLogStream)
+
+	for _, query := range []string{"level=verbose", "backlog=-1", "backlog=abc"} {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/logs/stream?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+}
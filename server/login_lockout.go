@@ -0,0 +1,383 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kiro2api/logger"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 登录失败计数的键前缀
+const (
+	lockoutKeyIP   = "ip:"
+	lockoutKeyUser = "user:"
+)
+
+// LoginLockoutConfig 登录失败锁定策略
+type LoginLockoutConfig struct {
+	FreeAttempts int           // 连续失败多少次后开始锁定
+	BaseDelay    time.Duration // 首次锁定时长，此后每次失败翻倍
+	MaxDelay     time.Duration // 单次锁定时长上限
+	ResetAfter   time.Duration // 多久没有失败后清零失败计数
+	BanThreshold int           // 同一IP累计失败多少次后临时封禁（0 不封禁）
+	BanDuration  time.Duration // 封禁时长
+	BanFile      string        // 封禁列表持久化文件（空表示仅保存在内存中）
+}
+
+// LoadLoginLockoutConfigFromEnv 从环境变量加载登录锁定策略
+// - LOGIN_FREE_ATTEMPTS: 连续失败多少次后开始锁定（默认5）
+// - LOGIN_LOCKOUT_BASE_SECONDS / LOGIN_LOCKOUT_MAX_SECONDS: 首次锁定时长与上限（默认30/3600，逐次翻倍）
+// - LOGIN_FAILURE_RESET_SECONDS: 多久没有失败后清零计数（默认86400）
+// - LOGIN_BAN_THRESHOLD / LOGIN_BAN_HOURS: 同一IP累计失败次数达到阈值后封禁的时长（默认50/24，阈值0不封禁）
+// - LOGIN_BAN_FILE: 封禁列表文件，重启后保留（默认 login_bans.json，设为 none 仅保存在内存中）
+func LoadLoginLockoutConfigFromEnv() (LoginLockoutConfig, error) {
+	cfg := LoginLockoutConfig{
+		FreeAttempts: utils.GetEnvIntWithDefault("LOGIN_FREE_ATTEMPTS", 5),
+		BaseDelay:    time.Duration(utils.GetEnvIntWithDefault("LOGIN_LOCKOUT_BASE_SECONDS", 30)) * time.Second,
+		MaxDelay:     time.Duration(utils.GetEnvIntWithDefault("LOGIN_LOCKOUT_MAX_SECONDS", 3600)) * time.Second,
+		ResetAfter:   time.Duration(utils.GetEnvIntWithDefault("LOGIN_FAILURE_RESET_SECONDS", 86400)) * time.Second,
+		BanThreshold: utils.GetEnvIntWithDefault("LOGIN_BAN_THRESHOLD", 50),
+		BanDuration:  time.Duration(utils.GetEnvIntWithDefault("LOGIN_BAN_HOURS", 24)) * time.Hour,
+		BanFile:      strings.TrimSpace(utils.GetEnvWithDefault("LOGIN_BAN_FILE", "login_bans.json")),
+	}
+	if cfg.BanFile == "none" {
+		cfg.BanFile = ""
+	}
+	if cfg.FreeAttempts < 1 || cfg.BaseDelay <= 0 || cfg.ResetAfter <= 0 {
+		return LoginLockoutConfig{}, fmt.Errorf("LOGIN_FREE_ATTEMPTS、LOGIN_LOCKOUT_BASE_SECONDS 与 LOGIN_FAILURE_RESET_SECONDS 必须大于0")
+	}
+	if cfg.MaxDelay < cfg.BaseDelay {
+		return LoginLockoutConfig{}, fmt.Errorf("LOGIN_LOCKOUT_MAX_SECONDS 不能小于 LOGIN_LOCKOUT_BASE_SECONDS")
+	}
+	if cfg.BanThreshold < 0 || (cfg.BanThreshold > 0 && cfg.BanDuration <= 0) {
+		return LoginLockoutConfig{}, fmt.Errorf("LOGIN_BAN_THRESHOLD 不能为负数，启用封禁时 LOGIN_BAN_HOURS 必须大于0")
+	}
+	return cfg, nil
+}
+
+// LoginLockout 登录失败锁定：按IP与用户名分别计数，超过免费次数后锁定时长逐次翻倍，
+// 同一IP失败过多时临时封禁。用户名只锁定不封禁，避免他人通过猜错密码长期锁死管理员账号
+type LoginLockout struct {
+	cfg LoginLockoutConfig
+	now func() time.Time
+
+	mu          sync.Mutex
+	failures    map[string]*loginFailure // "ip:<IP>" / "user:<用户名>" → 失败记录
+	bans        map[string]LoginBan      // IP → 封禁记录
+	maxEntries  int                      // 失败记录上限，超出后不再记录新的用户名
+	lastCleanup time.Time
+}
+
+// loginFailure 单个IP或用户名的连续失败记录
+type loginFailure struct {
+	count       int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// LoginBan 临时封禁的IP
+type LoginBan struct {
+	IP        string    `json:"ip"`
+	Failures  int       `json:"failures"`
+	CreatedAt time.Time `json:"created_at"`
+	Until     time.Time `json:"until"`
+}
+
+// LoginLockoutEntry 锁定状态（管理接口展示）
+type LoginLockoutEntry struct {
+	Key         string    `json:"key"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil time.Time `json:"locked_until,omitzero"`
+}
+
+// NewLoginLockout 创建登录锁定策略，配置了封禁列表文件时加载其中未过期的封禁
+func NewLoginLockout(cfg LoginLockoutConfig) (*LoginLockout, error) {
+	l := &LoginLockout{
+		cfg:         cfg,
+		now:         time.Now,
+		failures:    make(map[string]*loginFailure),
+		bans:        make(map[string]LoginBan),
+		maxEntries:  10000,
+		lastCleanup: time.Now(),
+	}
+	if cfg.BanFile == "" {
+		return l, nil
+	}
+
+	data, err := os.ReadFile(cfg.BanFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取登录封禁列表失败: %w", err)
+	}
+	var bans []LoginBan
+	if err := json.Unmarshal(data, &bans); err != nil {
+		return nil, fmt.Errorf("解析登录封禁列表失败: %w\n文件路径: %s", err, cfg.BanFile)
+	}
+	now := l.now()
+	for _, ban := range bans {
+		if ban.Until.After(now) {
+			l.bans[ban.IP] = ban
+		}
+	}
+	if len(l.bans) > 0 {
+		logger.Info("已加载登录封禁列表",
+			logger.String("file", cfg.BanFile),
+			logger.Int("count", len(l.bans)))
+	}
+	return l, nil
+}
+
+// Check 登录前检查：IP被封禁时 banned 为 true，IP或用户名处于锁定期时返回剩余等待时长
+func (l *LoginLockout) Check(ip, username string) (retryAfter time.Duration, banned bool) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if ban, ok := l.bans[ip]; ok && ban.Until.After(now) {
+		return ban.Until.Sub(now), true
+	}
+	for _, key := range lockoutKeys(ip, username) {
+		if f, ok := l.failures[key]; ok && f.lockedUntil.After(now) {
+			retryAfter = max(retryAfter, f.lockedUntil.Sub(now))
+		}
+	}
+	return retryAfter, false
+}
+
+// RecordFailure 记录一次登录失败，返回本次失败后的锁定时长（0 表示尚未锁定）以及IP是否因此被封禁
+func (l *LoginLockout) RecordFailure(ip, username string) (lockedFor time.Duration, banned bool) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastCleanup) > time.Minute {
+		l.cleanupLocked(now)
+		l.lastCleanup = now
+	}
+
+	for _, key := range lockoutKeys(ip, username) {
+		f, ok := l.failures[key]
+		if !ok {
+			if strings.HasPrefix(key, lockoutKeyUser) && len(l.failures) >= l.maxEntries {
+				continue // 防止大量随机用户名撑爆内存，IP计数仍然生效
+			}
+			f = &loginFailure{}
+			l.failures[key] = f
+		}
+		if now.Sub(f.lastFailure) > l.cfg.ResetAfter {
+			f.count = 0
+		}
+		f.count++
+		f.lastFailure = now
+		if f.count > l.cfg.FreeAttempts {
+			f.lockedUntil = now.Add(l.lockDuration(f.count - l.cfg.FreeAttempts))
+			lockedFor = max(lockedFor, f.lockedUntil.Sub(now))
+		}
+
+		if key == lockoutKeyIP+ip && l.cfg.BanThreshold > 0 && f.count >= l.cfg.BanThreshold {
+			l.bans[ip] = LoginBan{IP: ip, Failures: f.count, CreatedAt: now, Until: now.Add(l.cfg.BanDuration)}
+			banned = true
+		}
+	}
+	if banned {
+		logger.Warn("登录失败次数过多，临时封禁IP",
+			logger.String("ip", ip),
+			logger.Duration("duration", l.cfg.BanDuration))
+		l.saveBansLocked()
+	}
+	return lockedFor, banned
+}
+
+// RecordSuccess 登录成功后清除该IP与用户名的失败记录
+func (l *LoginLockout) RecordSuccess(ip, username string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, key := range lockoutKeys(ip, username) {
+		delete(l.failures, key)
+	}
+}
+
+// lockDuration 第 n 次锁定的时长：BaseDelay × 2^(n-1)，不超过 MaxDelay
+func (l *LoginLockout) lockDuration(n int) time.Duration {
+	d := l.cfg.BaseDelay
+	for i := 1; i < n && d < l.cfg.MaxDelay; i++ {
+		d *= 2
+	}
+	return min(d, l.cfg.MaxDelay)
+}
+
+// Entries 返回失败记录与封禁列表（已过期的不返回）
+func (l *LoginLockout) Entries() ([]LoginLockoutEntry, []LoginBan) {
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.cleanupLocked(now)
+
+	entries := make([]LoginLockoutEntry, 0, len(l.failures))
+	for key, f := range l.failures {
+		entry := LoginLockoutEntry{Key: key, Failures: f.count, LastFailure: f.lastFailure}
+		if f.lockedUntil.After(now) {
+			entry.LockedUntil = f.lockedUntil
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+
+	bans := make([]LoginBan, 0, len(l.bans))
+	for _, ban := range l.bans {
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].IP < bans[j].IP })
+	return entries, bans
+}
+
+// Clear 清除指定键（ip:<IP> 同时解除封禁，user:<用户名>）的记录，key 为空时清除全部，返回是否有记录被清除
+func (l *LoginLockout) Clear(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if key == "" {
+		cleared := len(l.failures) > 0 || len(l.bans) > 0
+		hadBans := len(l.bans) > 0
+		l.failures = make(map[string]*loginFailure)
+		l.bans = make(map[string]LoginBan)
+		if hadBans {
+			l.saveBansLocked()
+		}
+		return cleared
+	}
+
+	_, cleared := l.failures[key]
+	delete(l.failures, key)
+	if ip, ok := strings.CutPrefix(key, lockoutKeyIP); ok {
+		if _, banned := l.bans[ip]; banned {
+			delete(l.bans, ip)
+			l.saveBansLocked()
+			cleared = true
+		}
+	}
+	return cleared
+}
+
+// cleanupLocked 清理已过期的失败记录与封禁（调用时需持有锁）
+func (l *LoginLockout) cleanupLocked(now time.Time) {
+	for key, f := range l.failures {
+		if now.Sub(f.lastFailure) > l.cfg.ResetAfter && !f.lockedUntil.After(now) {
+			delete(l.failures, key)
+		}
+	}
+	expired := false
+	for ip, ban := range l.bans {
+		if !ban.Until.After(now) {
+			delete(l.bans, ip)
+			expired = true
+		}
+	}
+	if expired {
+		l.saveBansLocked()
+	}
+}
+
+// saveBansLocked 持久化封禁列表（调用时需持有锁），写入失败只记录日志
+func (l *LoginLockout) saveBansLocked() {
+	if l.cfg.BanFile == "" {
+		return
+	}
+	bans := make([]LoginBan, 0, len(l.bans))
+	for _, ban := range l.bans {
+		bans = append(bans, ban)
+	}
+	sort.Slice(bans, func(i, j int) bool { return bans[i].IP < bans[j].IP })
+	data, err := json.MarshalIndent(bans, "", "  ")
+	if err == nil {
+		err = os.WriteFile(l.cfg.BanFile, data, 0o600)
+	}
+	if err != nil {
+		logger.Error("保存登录封禁列表失败",
+			logger.String("file", l.cfg.BanFile),
+			logger.Err(err))
+	}
+}
+
+// lockoutKeys 登录请求对应的计数键（用户名为空时只按IP计数）
+func lockoutKeys(ip, username string) []string {
+	keys := []string{lockoutKeyIP + ip}
+	if username != "" {
+		keys = append(keys, lockoutKeyUser+username)
+	}
+	return keys
+}
+
+// retryAfterSeconds 向上取整的等待秒数（用于 Retry-After）
+func retryAfterSeconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// HandleListLoginLockouts 查看登录失败记录与IP封禁列表（仅管理员）
+func (h *AuthHandlers) HandleListLoginLockouts(c *gin.Context) {
+	entries, bans := h.lockout.Entries()
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"lockouts": entries,
+		"bans":     bans,
+	})
+}
+
+// HandleClearLoginLockout 清除登录锁定（仅管理员）
+// DELETE /api/admin/login-lockouts/:key 清除单个IP（ip:<IP>，同时解除封禁）或用户名（user:<用户名>），不带 key 时清除全部
+func (h *AuthHandlers) HandleClearLoginLockout(c *gin.Context) {
+	key := c.Param("key")
+	if key != "" && !strings.HasPrefix(key, lockoutKeyIP) && !strings.HasPrefix(key, lockoutKeyUser) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"error":   "key 需为 ip:<IP> 或 user:<用户名>",
+		})
+		return
+	}
+	if !h.lockout.Clear(key) && key != "" {
+		c.JSON(http.StatusNotFound, gin.H{
+			"success": false,
+			"error":   "没有该键的锁定记录: " + key,
+		})
+		return
+	}
+
+	logger.Info("已清除登录锁定",
+		logger.String("key", key),
+		logger.String("operator", GetSessionUser(c)))
+	recordAuditEvent(c, "login_lockout_cleared", GetSessionUser(c), http.StatusOK, map[string]any{"key": key})
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// respondLoginLocked 登录被锁定或封禁时的响应
+func respondLoginLocked(c *gin.Context, retryAfter time.Duration, banned bool) {
+	seconds := retryAfterSeconds(retryAfter)
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	if banned {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success":     false,
+			"error":       "登录失败次数过多，该IP已被临时封禁",
+			"retry_after": seconds,
+		})
+		return
+	}
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"success":     false,
+		"error":       fmt.Sprintf("登录尝试过于频繁，请在%d秒后重试", seconds),
+		"retry_after": seconds,
+	})
+}
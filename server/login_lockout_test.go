@@ -0,0 +1,111 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLoginLockout(t *testing.T) *LoginLockout {
+	l, err := NewLoginLockout(LoginLockoutConfig{
+		FreeAttempts: 2,
+		BaseDelay:    time.Minute,
+		MaxDelay:     5 * time.Minute,
+		ResetAfter:   time.Hour,
+		BanThreshold: 6,
+		BanDuration:  time.Hour,
+	})
+	require.NoError(t, err)
+	return l
+}
+
+func TestLoginLockout_EscalatingDelays(t *testing.T) {
+	l := newTestLoginLockout(t)
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+
+	var delays []time.Duration
+	for range 5 {
+		d, banned := l.RecordFailure("1.2.3.4", "admin")
+		assert.False(t, banned)
+		delays = append(delays, d)
+	}
+	assert.Equal(t, []time.Duration{0, 0, time.Minute, 2 * time.Minute, 4 * time.Minute}, delays)
+
+	retry, banned := l.Check("5.6.7.8", "admin")
+	assert.False(t, banned)
+	assert.Equal(t, 4*time.Minute, retry, "换IP仍按用户名锁定")
+	retry, _ = l.Check("1.2.3.4", "other")
+	assert.Equal(t, 4*time.Minute, retry, "换用户名仍按IP锁定")
+
+	d, _ := l.RecordFailure("9.9.9.9", "")
+	assert.Zero(t, d)
+	now = now.Add(2 * time.Hour)
+	d, _ = l.RecordFailure("1.2.3.4", "admin")
+	assert.Zero(t, d, "长时间没有失败后重新计数")
+
+	l.RecordSuccess("1.2.3.4", "admin")
+	retry, _ = l.Check("1.2.3.4", "admin")
+	assert.Zero(t, retry)
+}
+
+func TestLoginLockout_BanPersists(t *testing.T) {
+	cfg := newTestLoginLockout(t).cfg
+	cfg.BanFile = filepath.Join(t.TempDir(), "bans.json")
+	l, err := NewLoginLockout(cfg)
+	require.NoError(t, err)
+
+	for i := range 6 {
+		_, banned := l.RecordFailure("1.2.3.4", "user"+strings.Repeat("x", i))
+		assert.Equal(t, i == 5, banned)
+	}
+
+	reloaded, err := NewLoginLockout(cfg)
+	require.NoError(t, err)
+	retry, banned := reloaded.Check("1.2.3.4", "")
+	assert.True(t, banned, "封禁列表在重启后保留")
+	assert.Greater(t, retry, 59*time.Minute)
+
+	assert.True(t, reloaded.Clear("ip:1.2.3.4"))
+	_, banned = reloaded.Check("1.2.3.4", "")
+	assert.False(t, banned)
+	reloaded, err = NewLoginLockout(cfg)
+	require.NoError(t, err)
+	_, bans := reloaded.Entries()
+	assert.Empty(t, bans, "解除封禁同步写回文件")
+}
+
+func TestHandleLogin_Lockout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store, err := NewUserStore("", &AdminUser{Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+	h := NewAuthHandlers(NewSessionManager(time.Hour, time.Hour), store, time.Hour, newTestLoginLockout(t), http.SameSiteLaxMode)
+	r := gin.New()
+	r.POST("/api/login", h.HandleLogin)
+
+	login := func(password string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"username":"admin","password":"`+password+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, login("wrong").Code)
+	assert.Equal(t, http.StatusUnauthorized, login("wrong").Code)
+	assert.Equal(t, http.StatusUnauthorized, login("wrong").Code)
+	w := login("secret")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, "锁定期内正确的密码也被拒绝")
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	h.lockout.Clear("user:admin")
+	h.lockout.Clear("ip:192.0.2.1")
+	assert.Equal(t, http.StatusOK, login("secret").Code)
+}
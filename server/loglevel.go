@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"kiro2api/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleGetLogLevel 查询当前日志级别
+func handleGetLogLevel(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"success": true, "level": strings.ToLower(logger.GetLevel().String())})
+}
+
+// handleSetLogLevel 运行期调整日志级别（仅影响本实例，重启后恢复 LOG_LEVEL）
+func handleSetLogLevel(c *gin.Context) {
+	var req struct {
+		Level string `json:"level"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || strings.TrimSpace(req.Level) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "请求体需包含 level 字段（debug/info/warn/error）"})
+		return
+	}
+	level, err := logger.ParseLevel(req.Level)
+	if err != nil || level == logger.FATAL {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "无效的日志级别: " + req.Level})
+		return
+	}
+
+	previous := logger.GetLevel()
+	// 先以 WARN 记录，保证调高级别时该条变更日志仍可见
+	logger.Warn("运行期调整日志级别",
+		addReqFields(c,
+			logger.String("from", strings.ToLower(previous.String())),
+			logger.String("to", strings.ToLower(level.String())),
+			logger.String("operator", GetSessionUser(c)),
+		)...)
+	logger.SetLevel(level)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":  true,
+		"level":    strings.ToLower(level.String()),
+		"previous": strings.ToLower(previous.String()),
+	})
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"kiro2api/logger"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogLevelEndpoint(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	original := logger.GetLevel()
+	t.Cleanup(func() { logger.SetLevel(original) })
+	logger.SetLevel(logger.INFO)
+
+	r := gin.New()
+	r.GET("/api/admin/loglevel", handleGetLogLevel)
+	r.PUT("/api/admin/loglevel", handleSetLogLevel)
+
+	send := func(method, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, "/api/admin/loglevel", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(http.MethodGet, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"level":"info"`)
+
+	w = send(http.MethodPut, `{"level":"DEBUG"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"previous":"info"`)
+	assert.Equal(t, logger.DEBUG, logger.GetLevel())
+
+	for _, body := range []string{`{}`, `{"level":"verbose"}`, `{"level":"fatal"}`, `not json`} {
+		w = send(http.MethodPut, body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+	assert.Equal(t, logger.DEBUG, logger.GetLevel(), "非法请求不应修改级别")
+}
@@ -3,6 +3,7 @@ package server
 import (
 	"net/http"
 	"strings"
+	"time"
 
 	"kiro2api/logger"
 	"kiro2api/utils"
@@ -12,6 +13,12 @@ import (
 
 // PathBasedAuthMiddleware 创建基于路径的API密钥验证中间件
 func PathBasedAuthMiddleware(authToken string, protectedPrefixes []string) gin.HandlerFunc {
+	return PathBasedAuthMiddlewareWithSigning(authToken, protectedPrefixes, nil)
+}
+
+// PathBasedAuthMiddlewareWithSigning 在Bearer令牌之外支持HMAC请求签名
+// 携带签名头的请求按签名校验；verifier 要求签名时拒绝Bearer令牌
+func PathBasedAuthMiddlewareWithSigning(authToken string, protectedPrefixes []string, verifier *SignatureVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		path := c.Request.URL.Path
 
@@ -22,30 +29,103 @@ func PathBasedAuthMiddleware(authToken string, protectedPrefixes []string) gin.H
 			return
 		}
 
+		// 本机派发的内部请求沿用提交者的调用方身份
+		if keyID, ok := internalIdentity(c.Request); ok {
+			c.Set(clientKeyIDKey, keyID)
+			c.Next()
+			return
+		}
+
+		if verifier != nil && (verifier.required || HasSignature(c.Request)) {
+			if !verifySignedRequest(c, verifier) {
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
 		if !validateAPIKey(c, authToken) {
 			c.Abort()
 			return
 		}
+		c.Set(clientKeyIDKey, defaultClientKeyID)
 
 		c.Next()
 	}
 }
 
+// maxRequestIDLength 接受的客户端请求ID最大长度
+const maxRequestIDLength = 128
+
 // RequestIDMiddleware 为每个请求注入 request_id 并通过响应头返回
-// - 优先使用客户端的 X-Request-ID
+// - 优先使用客户端的 X-Request-ID（仅接受字母数字与 ._:- 且不超过128字符，防止日志注入）
 // - 若无则生成一个UUID（utils.GenerateUUID）
+// - 同时写入 gin 上下文与请求 context，供 logger.WithRequest 使用
 func RequestIDMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		rid := c.GetHeader("X-Request-ID")
-		if rid == "" {
+		if !isValidRequestID(rid) {
 			rid = "req_" + utils.GenerateUUID()
 		}
 		c.Set("request_id", rid)
+		c.Request = c.Request.WithContext(logger.ContextWithRequestID(c.Request.Context(), rid))
 		c.Writer.Header().Set("X-Request-ID", rid)
 		c.Next()
 	}
 }
 
+// isValidRequestID 校验客户端提供的请求ID
+func isValidRequestID(rid string) bool {
+	if rid == "" || len(rid) > maxRequestIDLength {
+		return false
+	}
+	for _, r := range rid {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		case r == '-' || r == '_' || r == '.' || r == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// RequestLogMiddleware 每个请求结束后输出一条结构化访问日志（替代 gin 默认的文本日志）
+// 静态资源与健康检查降级为 Debug，避免刷屏
+func RequestLogMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		path := c.Request.URL.Path
+		status := c.Writer.Status()
+		fields := addReqFields(c,
+			logger.String("method", c.Request.Method),
+			logger.String("path", path),
+			logger.Int("status", status),
+			logger.Int64("latency_ms", time.Since(start).Milliseconds()),
+			logger.String("client_ip", c.ClientIP()),
+			logger.Int("response_bytes", c.Writer.Size()),
+		)
+		if code := c.GetString(errorCodeKey); code != "" {
+			fields = append(fields, logger.String("error_code", code))
+		}
+		if len(c.Errors) > 0 {
+			fields = append(fields, logger.String("errors", c.Errors.String()))
+		}
+
+		switch {
+		case status >= http.StatusInternalServerError:
+			logger.Error("请求完成", fields...)
+		case strings.HasPrefix(path, "/static/") || path == "/readyz" || path == "/healthz":
+			logger.Debug("请求完成", fields...)
+		default:
+			logger.Info("请求完成", fields...)
+		}
+	}
+}
+
 // GetRequestID 从上下文读取 request_id（若不存在返回空串）
 func GetRequestID(c *gin.Context) string {
 	if v, ok := c.Get("request_id"); ok {
@@ -93,6 +173,7 @@ func requiresAuth(path string, protectedPrefixes []string) bool {
 }
 
 // extractAPIKey 提取API密钥的通用逻辑
+// 依次读取 Authorization、x-api-key 与 Gemini SDK 使用的 x-goog-api-key；Gemini 端点还接受 ?key= 查询参数
 func extractAPIKey(c *gin.Context) string {
 	apiKey := c.GetHeader("Authorization")
 	if apiKey == "" {
@@ -100,6 +181,12 @@ func extractAPIKey(c *gin.Context) string {
 	} else {
 		apiKey = strings.TrimPrefix(apiKey, "Bearer ")
 	}
+	if apiKey == "" {
+		apiKey = c.GetHeader("x-goog-api-key")
+	}
+	if apiKey == "" && strings.HasPrefix(c.Request.URL.Path, geminiPathPrefix) {
+		apiKey = c.Query("key")
+	}
 	return apiKey
 }
 
@@ -3,10 +3,15 @@ package server
 import (
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"kiro2api/logger"
+	"kiro2api/types"
+
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestPathBasedAuthMiddleware_ValidToken(t *testing.T) {
@@ -161,3 +166,91 @@ func TestPathBasedAuthMiddleware_MultipleProtectedPrefixes(t *testing.T) {
 
 	assert.Equal(t, http.StatusOK, w.Code)
 }
+
+func TestPathBasedAuthMiddleware_GeminiAPIKey(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.Use(PathBasedAuthMiddleware("test-token-123", []string{"/v1"}))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.POST(geminiPathPrefix+":action", ok)
+	router.POST("/v1/messages", ok)
+
+	tests := []struct {
+		name   string
+		path   string
+		header string
+		want   int
+	}{
+		{"x-goog-api-key", geminiPathPrefix + "gemini-pro:generateContent", "test-token-123", http.StatusOK},
+		{"key查询参数", geminiPathPrefix + "gemini-pro:generateContent?key=test-token-123", "", http.StatusOK},
+		{"错误的key", geminiPathPrefix + "gemini-pro:generateContent?key=wrong", "", http.StatusUnauthorized},
+		{"非Gemini端点不接受key查询参数", "/v1/messages?key=test-token-123", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, nil)
+			if tt.header != "" {
+				req.Header.Set("x-goog-api-key", tt.header)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestIDMiddleware())
+
+	var ctxID, ginID string
+	router.GET("/v1/models", func(c *gin.Context) {
+		ctxID = logger.RequestIDFromContext(c.Request.Context())
+		ginID = GetRequestID(c)
+	})
+
+	send := func(incoming string) string {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", "/v1/models", nil)
+		if incoming != "" {
+			req.Header.Set("X-Request-ID", incoming)
+		}
+		router.ServeHTTP(w, req)
+		assert.Equal(t, ginID, ctxID, "gin 上下文与请求 context 中的ID一致")
+		assert.Equal(t, ginID, w.Header().Get("X-Request-ID"))
+		return ginID
+	}
+
+	assert.Equal(t, "client-trace_01:a.b", send("client-trace_01:a.b"), "沿用合法的客户端请求ID")
+	assert.True(t, strings.HasPrefix(send(""), "req_"))
+	assert.True(t, strings.HasPrefix(send("bad id\n{\"level\":\"ERROR\"}"), "req_"), "拒绝可能注入日志的请求ID")
+	assert.True(t, strings.HasPrefix(send(strings.Repeat("a", maxRequestIDLength+1)), "req_"))
+}
+
+func TestUpstreamRequestIDForwarding(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	original := upstreamRequestIDHeader
+	t.Cleanup(func() { upstreamRequestIDHeader = original })
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/messages", nil)
+	c.Set("request_id", "req_forward")
+	anthropicReq := types.AnthropicRequest{
+		Model:     "claude-sonnet-4-20250514",
+		MaxTokens: 100,
+		Messages:  []types.AnthropicRequestMessage{{Role: "user", Content: "hi"}},
+	}
+
+	upstreamRequestIDHeader = ""
+	req, err := buildCodeWhispererRequest(c, anthropicReq, types.TokenInfo{AccessToken: "t"}, true)
+	require.NoError(t, err)
+	assert.Empty(t, req.Header.Get("X-Request-ID"), "默认不透传")
+
+	t.Setenv("UPSTREAM_REQUEST_ID_HEADER", " X-Request-ID ")
+	upstreamRequestIDHeader = loadUpstreamRequestIDHeaderFromEnv()
+	req, err = buildCodeWhispererRequest(c, anthropicReq, types.TokenInfo{AccessToken: "t"}, true)
+	require.NoError(t, err)
+	assert.Equal(t, "req_forward", req.Header.Get("X-Request-ID"))
+}
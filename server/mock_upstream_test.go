@@ -0,0 +1,103 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kiro2api/auth"
+	"kiro2api/config"
+	"kiro2api/mockserver"
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mockUpstreamRouter 启动模拟上游并将上游基础地址指向它，返回经真实token刷新与转换流程的 /v1 路由
+func mockUpstreamRouter(t *testing.T, configs []auth.AuthConfig) (*gin.Engine, *mockserver.Server) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	mock := mockserver.New(mockserver.Options{})
+	upstream := httptest.NewServer(mock)
+	t.Cleanup(upstream.Close)
+	require.NoError(t, config.SetUpstreamBaseURL(upstream.URL))
+	t.Cleanup(func() { _ = config.SetUpstreamBaseURL("") })
+
+	authService := auth.NewAuthServiceWithConfigs(configs, filepath.Join(t.TempDir(), "auth_config.json"))
+	r := gin.New()
+	r.POST("/v1/messages", func(c *gin.Context) {
+		var req types.AnthropicRequest
+		require.NoError(t, c.ShouldBindJSON(&req))
+		req, err := prepareAnthropicRequest(c, req, nil)
+		if err != nil {
+			return
+		}
+		token, err := authService.GetTokenWithUsageForTags(req.Model, "", nil)
+		require.NoError(t, err)
+		if req.Stream {
+			handleStreamRequest(c, req, token)
+		} else {
+			handleNonStreamRequest(c, req, token.TokenInfo)
+		}
+	})
+	r.POST("/v1/chat/completions", func(c *gin.Context) {
+		var openaiReq types.OpenAIRequest
+		require.NoError(t, c.ShouldBindJSON(&openaiReq))
+		req, err := prepareOpenAIChatRequest(c, openaiReq, nil)
+		if err != nil {
+			return
+		}
+		token, err := authService.GetTokenForTags(req.Model, "", nil)
+		require.NoError(t, err)
+		handleOpenAINonStreamRequest(c, req, token, openaiReq.ResponseFormat)
+	})
+	return r, mock
+}
+
+func postJSON(r http.Handler, path, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, strings.NewReader(body)))
+	return w
+}
+
+func TestMockUpstream_EndToEnd(t *testing.T) {
+	r, mock := mockUpstreamRouter(t, []auth.AuthConfig{
+		{ID: "mock-social", AuthType: auth.AuthMethodSocial, RefreshToken: "mock-refresh"},
+	})
+
+	// 非流式：Social 刷新 -> 使用限制查询 -> 转换 -> 推理 -> 聚合为 Anthropic 响应
+	w := postJSON(r, "/v1/messages", `{"model":"claude-sonnet-4-20250514","max_tokens":100,"messages":[{"role":"user","content":"hello mock"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	content := resp["content"].([]any)
+	assert.Equal(t, "Mock response: hello mock", content[0].(map[string]any)["text"])
+	require.Len(t, mock.Requests(), 1)
+	assert.Contains(t, string(mock.Requests()[0]), "hello mock")
+
+	// 流式工具调用
+	w = postJSON(r, "/v1/messages", `{"model":"claude-sonnet-4-20250514","max_tokens":100,"stream":true,
+		"tools":[{"name":"get_weather","description":"查询天气","input_schema":{"type":"object","properties":{}}}],
+		"messages":[{"role":"user","content":"[mock:tool] weather?"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"name":"get_weather"`)
+	assert.Contains(t, w.Body.String(), `"stop_reason":"tool_use"`)
+
+	// OpenAI 格式 + 上游限流映射为 429
+	w = postJSON(r, "/v1/chat/completions", `{"model":"claude-sonnet-4-20250514","messages":[{"role":"user","content":"[mock:throttle]"}]}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code, w.Body.String())
+}
+
+func TestMockUpstream_IdCRefresh(t *testing.T) {
+	r, _ := mockUpstreamRouter(t, []auth.AuthConfig{
+		{ID: "mock-idc", AuthType: auth.AuthMethodIdC, RefreshToken: "mock-refresh", ClientID: "client", ClientSecret: "secret"},
+	})
+	w := postJSON(r, "/v1/chat/completions", `{"model":"claude-sonnet-4-20250514","messages":[{"role":"user","content":"hi"}]}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "Mock response: hi")
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"kiro2api/config"
+	"kiro2api/logger"
+	"kiro2api/utils"
+)
+
+// ModelsConfig 模型路由配置
+type ModelsConfig struct {
+	FilePath       string        // 配置文件路径，为空时只使用内置映射
+	ReloadInterval time.Duration // 检查文件变更的间隔，<=0 表示不热加载
+}
+
+// LoadModelsConfigFromEnv 从环境变量加载模型路由配置
+// - MODELS_CONFIG_FILE: 模型路由文件（.yaml/.yml 按 YAML 解析，其余按 JSON），为空时只使用内置映射
+// - MODELS_RELOAD_SECONDS: 检查文件变更的间隔（默认10，0 表示不热加载）
+func LoadModelsConfigFromEnv() ModelsConfig {
+	return ModelsConfig{
+		FilePath:       utils.GetEnvWithDefault("MODELS_CONFIG_FILE", ""),
+		ReloadInterval: time.Duration(utils.GetEnvIntWithDefault("MODELS_RELOAD_SECONDS", 10)) * time.Second,
+	}
+}
+
+// modelsFileWatcher 按修改时间检测模型路由文件变更并重新加载
+type modelsFileWatcher struct {
+	path    string
+	modTime time.Time
+}
+
+// reload 文件修改时间变化时重新加载并替换当前路由表，返回是否已替换
+// 加载失败时保留当前路由表
+func (w *modelsFileWatcher) reload() (bool, error) {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return false, fmt.Errorf("读取模型配置文件失败: %w", err)
+	}
+	if info.ModTime().Equal(w.modTime) {
+		return false, nil
+	}
+
+	table, err := config.LoadModelTableFile(w.path)
+	if err != nil {
+		return false, err
+	}
+	w.modTime = info.ModTime()
+	config.SetModelTable(table)
+	logger.Info("模型路由表已加载",
+		logger.String("file_path", w.path),
+		logger.Int("model_count", len(table.Names())))
+	return true, nil
+}
+
+// startModelsConfig 加载模型路由文件并定期热加载，返回停止函数
+// 首次加载失败返回错误（配置错误应在启动时暴露），之后的加载失败只记录日志
+func startModelsConfig(cfg ModelsConfig) (stop func(), err error) {
+	if cfg.FilePath == "" {
+		return func() {}, nil
+	}
+	watcher := &modelsFileWatcher{path: cfg.FilePath}
+	if _, err := watcher.reload(); err != nil {
+		return nil, err
+	}
+	if cfg.ReloadInterval <= 0 {
+		return func() {}, nil
+	}
+
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(cfg.ReloadInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, err := watcher.reload(); err != nil {
+					logger.Warn("热加载模型路由表失败，继续使用当前配置",
+						logger.String("file_path", cfg.FilePath),
+						logger.Err(err))
+				}
+			}
+		}
+	}()
+	return func() { close(done) }, nil
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kiro2api/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeModelsConfig 写入模型路由文件并设置修改时间，避免同一秒内修改检测不到
+func writeModelsConfig(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func TestModelsFileWatcher_Reload(t *testing.T) {
+	original := config.CurrentModelTable()
+	t.Cleanup(func() { config.SetModelTable(original) })
+
+	path := filepath.Join(t.TempDir(), "models.yaml")
+	base := time.Now().Add(-time.Hour)
+	writeModelsConfig(t, path, "models:\n  gpt-4o:\n    alias: claude-sonnet-4-5\n", base)
+
+	watcher := &modelsFileWatcher{path: path}
+	reloaded, err := watcher.reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	route, ok := config.ResolveModel("gpt-4o")
+	require.True(t, ok)
+	assert.Equal(t, "CLAUDE_SONNET_4_5_20250929_V1_0", route.Upstream)
+
+	reloaded, err = watcher.reload()
+	require.NoError(t, err)
+	assert.False(t, reloaded, "文件未修改时不重新加载")
+
+	// 无效配置：保留当前路由表
+	writeModelsConfig(t, path, "models:\n  gpt-4o:\n    alias: missing\n", base.Add(time.Minute))
+	_, err = watcher.reload()
+	assert.Error(t, err)
+	_, ok = config.ResolveModel("gpt-4o")
+	assert.True(t, ok)
+
+	writeModelsConfig(t, path, "models:\n  gpt-4o:\n    alias: claude-haiku-4-5-20251001\n", base.Add(2*time.Minute))
+	reloaded, err = watcher.reload()
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	route, _ = config.ResolveModel("gpt-4o")
+	assert.Equal(t, "claude-haiku-4-5-20251001", route.Target)
+}
+
+func TestStartModelsConfig_InvalidFileFailsAtStartup(t *testing.T) {
+	original := config.CurrentModelTable()
+	t.Cleanup(func() { config.SetModelTable(original) })
+
+	_, err := startModelsConfig(ModelsConfig{FilePath: filepath.Join(t.TempDir(), "missing.yaml")})
+	assert.Error(t, err)
+
+	stop, err := startModelsConfig(ModelsConfig{})
+	require.NoError(t, err, "未配置文件时只使用内置映射")
+	stop()
+	assert.Same(t, original, config.CurrentModelTable())
+}
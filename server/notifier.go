@@ -0,0 +1,311 @@
+package server
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"kiro2api/auth"
+	"kiro2api/logger"
+	"kiro2api/utils"
+)
+
+// notifierEventTypes 支持通知的事件类型
+var notifierEventTypes = []string{
+	auth.EventTokenRefreshFailed,
+	auth.EventTokenQuarantined,
+	auth.EventQuotaExceeded,
+	auth.EventAllTokensExhausted,
+}
+
+// NotifierConfig Webhook 通知配置
+type NotifierConfig struct {
+	URLs             []string        // 通用 JSON Webhook
+	SlackURLs        []string        // Slack Incoming Webhook
+	TelegramBotToken string          // Telegram 机器人 token
+	TelegramChatID   string          // Telegram 会话ID
+	Secret           string          // 通用 Webhook 的 HMAC-SHA256 签名密钥
+	Events           map[string]bool // 需要通知的事件
+	Cooldown         time.Duration   // 同一账号同一事件的最短通知间隔
+	MaxAttempts      int             // 每次投递的最大尝试次数
+}
+
+// LoadNotifierConfigFromEnv 从环境变量加载 Webhook 通知配置
+// - WEBHOOK_URLS: 通用 JSON Webhook 地址，逗号分隔
+// - WEBHOOK_SLACK_URLS: Slack Incoming Webhook 地址，逗号分隔
+// - WEBHOOK_TELEGRAM_BOT_TOKEN / WEBHOOK_TELEGRAM_CHAT_ID: Telegram 机器人通知
+// - WEBHOOK_SECRET: 通用 Webhook 请求体签名密钥（X-Kiro-Signature: sha256=<hex>）
+// - WEBHOOK_EVENTS: 需要通知的事件，逗号分隔（默认全部）
+// - WEBHOOK_COOLDOWN_SECONDS: 同一账号同一事件的最短通知间隔（默认300）
+// - WEBHOOK_MAX_ATTEMPTS: 投递失败（网络错误、429、5xx）时的最大尝试次数（默认3）
+func LoadNotifierConfigFromEnv() (NotifierConfig, error) {
+	cfg := NotifierConfig{
+		URLs:             envList("WEBHOOK_URLS"),
+		SlackURLs:        envList("WEBHOOK_SLACK_URLS"),
+		TelegramBotToken: strings.TrimSpace(os.Getenv("WEBHOOK_TELEGRAM_BOT_TOKEN")),
+		TelegramChatID:   strings.TrimSpace(os.Getenv("WEBHOOK_TELEGRAM_CHAT_ID")),
+		Secret:           os.Getenv("WEBHOOK_SECRET"),
+		Events:           make(map[string]bool),
+		Cooldown:         time.Duration(utils.GetEnvIntWithDefault("WEBHOOK_COOLDOWN_SECONDS", 300)) * time.Second,
+		MaxAttempts:      utils.GetEnvIntWithDefault("WEBHOOK_MAX_ATTEMPTS", 3),
+	}
+
+	events := envList("WEBHOOK_EVENTS")
+	if len(events) == 0 {
+		events = notifierEventTypes
+	}
+	for _, event := range events {
+		known := false
+		for _, candidate := range notifierEventTypes {
+			if event == candidate {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return cfg, fmt.Errorf("WEBHOOK_EVENTS 包含未知事件: %s（可选 %s）", event, strings.Join(notifierEventTypes, ", "))
+		}
+		cfg.Events[event] = true
+	}
+
+	if (cfg.TelegramBotToken == "") != (cfg.TelegramChatID == "") {
+		return cfg, fmt.Errorf("WEBHOOK_TELEGRAM_BOT_TOKEN 与 WEBHOOK_TELEGRAM_CHAT_ID 必须同时设置")
+	}
+	if cfg.MaxAttempts < 1 {
+		return cfg, fmt.Errorf("WEBHOOK_MAX_ATTEMPTS 必须大于0")
+	}
+	if cfg.Cooldown < 0 {
+		return cfg, fmt.Errorf("WEBHOOK_COOLDOWN_SECONDS 不能为负数")
+	}
+	return cfg, nil
+}
+
+// HasSinks 是否配置了任一通知目标
+func (cfg NotifierConfig) HasSinks() bool {
+	return len(cfg.URLs) > 0 || len(cfg.SlackURLs) > 0 || cfg.TelegramBotToken != ""
+}
+
+// notifySink 通知目标：地址与请求体格式
+type notifySink struct {
+	name   string // webhook/slack/telegram，用于日志
+	url    string
+	format func(auth.TokenEvent) ([]byte, error)
+	sign   bool // 是否附带 HMAC 签名
+}
+
+// Notifier 将token事件异步投递到 Webhook，失败时指数退避重试
+// 同一账号的同一事件在冷却时间内只通知一次，队列满时丢弃事件，不阻塞请求处理
+type Notifier struct {
+	cfg     NotifierConfig
+	sinks   []notifySink
+	enabled func() bool // 运行期开关（功能开关 enable_webhooks）
+	client  *http.Client
+	backoff time.Duration // 首次重试的等待时间，之后每次翻倍
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+
+	queue chan auth.TokenEvent
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+// telegramAPIBase Telegram Bot API 地址（测试中替换）
+var telegramAPIBase = "https://api.telegram.org"
+
+// NewNotifier 创建通知器并启动投递协程，enabled 为 nil 时始终启用
+func NewNotifier(cfg NotifierConfig, enabled func() bool) *Notifier {
+	n := &Notifier{
+		cfg:      cfg,
+		enabled:  enabled,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		backoff:  time.Second,
+		lastSent: make(map[string]time.Time),
+		queue:    make(chan auth.TokenEvent, 100),
+		done:     make(chan struct{}),
+	}
+	for _, url := range cfg.URLs {
+		n.sinks = append(n.sinks, notifySink{name: "webhook", url: url, format: formatWebhookEvent, sign: cfg.Secret != ""})
+	}
+	for _, url := range cfg.SlackURLs {
+		n.sinks = append(n.sinks, notifySink{name: "slack", url: url, format: formatSlackEvent})
+	}
+	if cfg.TelegramBotToken != "" {
+		chatID := cfg.TelegramChatID
+		n.sinks = append(n.sinks, notifySink{
+			name: "telegram",
+			url:  telegramAPIBase + "/bot" + cfg.TelegramBotToken + "/sendMessage",
+			format: func(event auth.TokenEvent) ([]byte, error) {
+				return json.Marshal(map[string]string{"chat_id": chatID, "text": eventSummary(event)})
+			},
+		})
+	}
+
+	n.wg.Add(1)
+	go n.run()
+	return n
+}
+
+// Notify 过滤、去重后将事件放入投递队列（非阻塞，可在持锁时调用）
+func (n *Notifier) Notify(event auth.TokenEvent) {
+	if !n.cfg.Events[event.Type] || (n.enabled != nil && !n.enabled()) {
+		return
+	}
+
+	key := event.Type + "|" + event.ConfigID
+	n.mu.Lock()
+	if last, ok := n.lastSent[key]; ok && time.Since(last) < n.cfg.Cooldown {
+		n.mu.Unlock()
+		return
+	}
+	n.lastSent[key] = time.Now()
+	n.mu.Unlock()
+
+	select {
+	case n.queue <- event:
+	default:
+		logger.Warn("Webhook通知队列已满，丢弃事件",
+			logger.String("event", event.Type),
+			logger.String("config_id", event.ConfigID))
+	}
+}
+
+// Close 停止投递协程，丢弃尚未投递的事件
+func (n *Notifier) Close() {
+	close(n.done)
+	n.wg.Wait()
+}
+
+func (n *Notifier) run() {
+	defer n.wg.Done()
+	for {
+		select {
+		case <-n.done:
+			return
+		case event := <-n.queue:
+			for _, sink := range n.sinks {
+				if err := n.deliver(sink, event); err != nil {
+					logger.Warn("Webhook通知投递失败",
+						logger.String("sink", sink.name),
+						logger.String("event", event.Type),
+						logger.String("config_id", event.ConfigID),
+						logger.Err(err))
+				}
+			}
+		}
+	}
+}
+
+// deliver 投递到单个目标，网络错误、429 与 5xx 时重试
+func (n *Notifier) deliver(sink notifySink, event auth.TokenEvent) error {
+	body, err := sink.format(event)
+	if err != nil {
+		return fmt.Errorf("序列化事件失败: %w", err)
+	}
+
+	wait := n.backoff
+	for attempt := 1; ; attempt++ {
+		retryable, err := n.post(sink, event, body)
+		if err == nil {
+			return nil
+		}
+		if !retryable || attempt >= n.cfg.MaxAttempts {
+			return fmt.Errorf("第%d次尝试: %w", attempt, err)
+		}
+		select {
+		case <-n.done:
+			return err
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// post 发送一次请求，返回失败是否可重试
+func (n *Notifier) post(sink notifySink, event auth.TokenEvent, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, sink.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "kiro2api-webhook")
+	if sink.name == "webhook" {
+		req.Header.Set("X-Kiro-Event", event.Type)
+	}
+	if sink.sign {
+		mac := hmac.New(sha256.New, []byte(n.cfg.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Kiro-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retryable, fmt.Errorf("目标返回 %s", resp.Status)
+}
+
+// webhookPayload 通用 Webhook 请求体
+type webhookPayload struct {
+	auth.TokenEvent
+	Message  string `json:"message"`
+	Instance string `json:"instance,omitempty"`
+}
+
+func formatWebhookEvent(event auth.TokenEvent) ([]byte, error) {
+	hostname, _ := os.Hostname()
+	return json.Marshal(webhookPayload{
+		TokenEvent: event,
+		Message:    eventSummary(event),
+		Instance:   hostname,
+	})
+}
+
+func formatSlackEvent(event auth.TokenEvent) ([]byte, error) {
+	return json.Marshal(map[string]string{"text": eventSummary(event)})
+}
+
+// eventSummary 事件的可读摘要，用于 Slack/Telegram 消息与通用 Webhook 的 message 字段
+func eventSummary(event auth.TokenEvent) string {
+	account := event.ConfigID
+	if event.Label != "" {
+		account = event.Label + "（" + event.ConfigID + "）"
+	}
+
+	var text string
+	switch event.Type {
+	case auth.EventTokenRefreshFailed:
+		text = "账号 " + account + " 刷新token失败"
+	case auth.EventTokenQuarantined:
+		text = fmt.Sprintf("账号 %s 被上游拒绝（HTTP %d），已移出轮换", account, event.Status)
+	case auth.EventQuotaExceeded:
+		text = "账号 " + account + " 额度已耗尽"
+	case auth.EventAllTokensExhausted:
+		text = "没有可用的token，请求将失败"
+		if event.Model != "" {
+			text += "（模型 " + event.Model + "）"
+		}
+	default:
+		text = event.Type
+	}
+	if event.Error != "" {
+		text += ": " + event.Error
+	}
+	return "[kiro2api] " + text
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"kiro2api/auth"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// webhookRecorder 记录收到的请求，前 fail 次返回 500
+type webhookRecorder struct {
+	calls    atomic.Int32
+	fail     int32
+	received chan *http.Request
+	bodies   chan []byte
+}
+
+func newWebhookRecorder(t *testing.T, fail int32) (*webhookRecorder, *httptest.Server) {
+	rec := &webhookRecorder{fail: fail, received: make(chan *http.Request, 10), bodies: make(chan []byte, 10)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if rec.calls.Add(1) <= rec.fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		rec.received <- r
+		rec.bodies <- body
+	}))
+	t.Cleanup(srv.Close)
+	return rec, srv
+}
+
+func (rec *webhookRecorder) next(t *testing.T) (*http.Request, []byte) {
+	t.Helper()
+	select {
+	case r := <-rec.received:
+		return r, <-rec.bodies
+	case <-time.After(2 * time.Second):
+		t.Fatal("未收到通知")
+		return nil, nil
+	}
+}
+
+func testNotifierConfig() NotifierConfig {
+	events := make(map[string]bool)
+	for _, event := range notifierEventTypes {
+		events[event] = true
+	}
+	return NotifierConfig{Events: events, Cooldown: time.Minute, MaxAttempts: 3}
+}
+
+func TestNotifier_WebhookPayloadAndSignature(t *testing.T) {
+	rec, srv := newWebhookRecorder(t, 0)
+	cfg := testNotifierConfig()
+	cfg.URLs = []string{srv.URL}
+	cfg.Secret = "s3cret"
+	n := NewNotifier(cfg, nil)
+	defer n.Close()
+
+	n.Notify(auth.TokenEvent{Type: auth.EventTokenQuarantined, ConfigID: "a", Label: "主账号", Status: 403, Time: time.Now()})
+
+	req, body := rec.next(t)
+	assert.Equal(t, auth.EventTokenQuarantined, req.Header.Get("X-Kiro-Event"))
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), req.Header.Get("X-Kiro-Signature"))
+
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal(body, &payload))
+	assert.Equal(t, auth.EventTokenQuarantined, payload["type"])
+	assert.Equal(t, "a", payload["config_id"])
+	assert.Equal(t, float64(403), payload["status"])
+	assert.Contains(t, payload["message"], "主账号（a）")
+}
+
+func TestNotifier_RetriesServerErrors(t *testing.T) {
+	rec, srv := newWebhookRecorder(t, 2)
+	cfg := testNotifierConfig()
+	cfg.URLs = []string{srv.URL}
+	n := NewNotifier(cfg, nil)
+	n.backoff = time.Millisecond
+	defer n.Close()
+
+	n.Notify(auth.TokenEvent{Type: auth.EventTokenRefreshFailed, ConfigID: "a", Error: "invalid_grant"})
+
+	rec.next(t)
+	assert.Equal(t, int32(3), rec.calls.Load())
+}
+
+func TestNotifier_CooldownAndFilters(t *testing.T) {
+	rec, srv := newWebhookRecorder(t, 0)
+	cfg := testNotifierConfig()
+	cfg.URLs = []string{srv.URL}
+	delete(cfg.Events, auth.EventQuotaExceeded)
+	var enabled atomic.Bool
+	enabled.Store(true)
+	n := NewNotifier(cfg, enabled.Load)
+	defer n.Close()
+
+	// 未订阅的事件与冷却期内的重复事件不投递
+	n.Notify(auth.TokenEvent{Type: auth.EventQuotaExceeded, ConfigID: "a"})
+	n.Notify(auth.TokenEvent{Type: auth.EventTokenQuarantined, ConfigID: "a"})
+	n.Notify(auth.TokenEvent{Type: auth.EventTokenQuarantined, ConfigID: "a"})
+	// 不同账号不受冷却影响
+	n.Notify(auth.TokenEvent{Type: auth.EventTokenQuarantined, ConfigID: "b"})
+	// 运行期关闭后不再投递
+	enabled.Store(false)
+	n.Notify(auth.TokenEvent{Type: auth.EventAllTokensExhausted})
+
+	_, first := rec.next(t)
+	_, second := rec.next(t)
+	assert.Contains(t, string(first), `"config_id":"a"`)
+	assert.Contains(t, string(second), `"config_id":"b"`)
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int32(2), rec.calls.Load())
+}
+
+func TestNotifier_SlackAndTelegramFormats(t *testing.T) {
+	slack, slackSrv := newWebhookRecorder(t, 0)
+	telegram, telegramSrv := newWebhookRecorder(t, 0)
+	original := telegramAPIBase
+	telegramAPIBase = telegramSrv.URL
+	defer func() { telegramAPIBase = original }()
+
+	cfg := testNotifierConfig()
+	cfg.SlackURLs = []string{slackSrv.URL}
+	cfg.TelegramBotToken = "123:abc"
+	cfg.TelegramChatID = "-100"
+	n := NewNotifier(cfg, nil)
+	defer n.Close()
+
+	n.Notify(auth.TokenEvent{Type: auth.EventAllTokensExhausted, Model: "claude-sonnet-4-5"})
+
+	req, body := slack.next(t)
+	assert.Empty(t, req.Header.Get("X-Kiro-Event"))
+	assert.JSONEq(t, `{"text":"[kiro2api] 没有可用的token，请求将失败（模型 claude-sonnet-4-5）"}`, string(body))
+
+	req, body = telegram.next(t)
+	assert.Equal(t, "/bot123:abc/sendMessage", req.URL.Path)
+	var msg map[string]string
+	require.NoError(t, json.Unmarshal(body, &msg))
+	assert.Equal(t, "-100", msg["chat_id"])
+	assert.Contains(t, msg["text"], "没有可用的token")
+}
+
+func TestLoadNotifierConfigFromEnv(t *testing.T) {
+	t.Setenv("WEBHOOK_URLS", "https://a.example.com/hook, https://b.example.com/hook")
+	t.Setenv("WEBHOOK_EVENTS", "")
+	cfg, err := LoadNotifierConfigFromEnv()
+	require.NoError(t, err)
+	assert.True(t, cfg.HasSinks())
+	assert.Len(t, cfg.URLs, 2)
+	assert.Len(t, cfg.Events, len(notifierEventTypes))
+	assert.Equal(t, 5*time.Minute, cfg.Cooldown)
+	assert.Equal(t, 3, cfg.MaxAttempts)
+
+	t.Setenv("WEBHOOK_EVENTS", "quota_exceeded")
+	cfg, err = LoadNotifierConfigFromEnv()
+	require.NoError(t, err)
+	assert.True(t, cfg.Events[auth.EventQuotaExceeded])
+	assert.False(t, cfg.Events[auth.EventTokenQuarantined])
+
+	t.Setenv("WEBHOOK_EVENTS", "quota_typo")
+	_, err = LoadNotifierConfigFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("WEBHOOK_EVENTS", "")
+	t.Setenv("WEBHOOK_TELEGRAM_BOT_TOKEN", "123:abc")
+	_, err = LoadNotifierConfigFromEnv()
+	assert.Error(t, err, "缺少 chat_id")
+}
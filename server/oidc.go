@@ -0,0 +1,596 @@
+package server
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"kiro2api/logger"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// oidcStateTTL 登录流程state的有效期
+	oidcStateTTL = 10 * time.Minute
+	// oidcClockSkew ID Token时间校验允许的时钟偏差
+	oidcClockSkew = time.Minute
+	// oidcJWKSRefreshInterval JWKS缓存刷新间隔
+	oidcJWKSRefreshInterval = time.Hour
+	// oidcMaxPending 同时进行中的登录流程上限，超出时淘汰最早的流程
+	oidcMaxPending = 1000
+	// oidcStateCookieName 绑定登录流程与发起浏览器的 state cookie
+	oidcStateCookieName = "oidc_state"
+	// oidcStateCookiePath state cookie 只随OIDC接口发送
+	oidcStateCookiePath = "/api/oidc"
+)
+
+// OIDCConfig OIDC登录配置（从环境变量加载）
+type OIDCConfig struct {
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string
+	Scopes        []string
+	UsernameClaim string          // 用户名取值的claim，默认 email（缺失时回退 sub）
+	RoleClaim     string          // 角色映射使用的claim，默认 groups
+	RoleMap       map[string]Role // claim值 -> 角色
+	DefaultRole   Role            // 未匹配任何映射时的角色，空表示拒绝登录
+}
+
+// LoadOIDCConfigFromEnv 从环境变量加载OIDC配置，未配置 OIDC_ISSUER 时返回 nil
+func LoadOIDCConfigFromEnv() (*OIDCConfig, error) {
+	issuer := os.Getenv("OIDC_ISSUER")
+	if issuer == "" {
+		return nil, nil
+	}
+
+	cfg := &OIDCConfig{
+		Issuer:        strings.TrimRight(issuer, "/"),
+		ClientID:      os.Getenv("OIDC_CLIENT_ID"),
+		ClientSecret:  os.Getenv("OIDC_CLIENT_SECRET"),
+		RedirectURL:   os.Getenv("OIDC_REDIRECT_URL"),
+		Scopes:        strings.Fields(utils.GetEnvWithDefault("OIDC_SCOPES", "openid email profile")),
+		UsernameClaim: utils.GetEnvWithDefault("OIDC_USERNAME_CLAIM", "email"),
+		RoleClaim:     utils.GetEnvWithDefault("OIDC_ROLE_CLAIM", "groups"),
+		RoleMap:       make(map[string]Role),
+	}
+
+	if cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, fmt.Errorf("启用OIDC需要同时设置 OIDC_CLIENT_ID 和 OIDC_REDIRECT_URL")
+	}
+
+	// OIDC_ROLE_MAP 格式: "kiro-admins=admin,kiro-ops=operator"
+	for _, pair := range strings.Split(os.Getenv("OIDC_ROLE_MAP"), ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		value, roleName, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("OIDC_ROLE_MAP 格式无效: %s（应为 claim值=角色）", pair)
+		}
+		role, err := ParseRole(strings.TrimSpace(roleName))
+		if err != nil {
+			return nil, fmt.Errorf("OIDC_ROLE_MAP: %w", err)
+		}
+		cfg.RoleMap[strings.TrimSpace(value)] = role
+	}
+
+	if defaultRole := os.Getenv("OIDC_DEFAULT_ROLE"); defaultRole != "" {
+		role, err := ParseRole(defaultRole)
+		if err != nil {
+			return nil, fmt.Errorf("OIDC_DEFAULT_ROLE: %w", err)
+		}
+		cfg.DefaultRole = role
+	}
+
+	return cfg, nil
+}
+
+// oidcDiscovery OIDC发现文档中使用到的字段
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// oidcPendingLogin 进行中的登录流程
+type oidcPendingLogin struct {
+	nonce        string
+	codeVerifier string
+	expiresAt    time.Time
+}
+
+// OIDCHandlers OIDC登录处理器
+type OIDCHandlers struct {
+	cfg        *OIDCConfig
+	auth       *AuthHandlers
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	discovery   *oidcDiscovery
+	keys        map[string]*rsa.PublicKey
+	keysFetched time.Time
+	pending     map[string]oidcPendingLogin
+}
+
+// NewOIDCHandlers 创建OIDC登录处理器
+func NewOIDCHandlers(cfg *OIDCConfig, authHandlers *AuthHandlers) *OIDCHandlers {
+	return &OIDCHandlers{
+		cfg:        cfg,
+		auth:       authHandlers,
+		httpClient: utils.SharedHTTPClient,
+		keys:       make(map[string]*rsa.PublicKey),
+		pending:    make(map[string]oidcPendingLogin),
+	}
+}
+
+// HandleStatus 返回OIDC是否启用（供登录页决定是否显示SSO按钮）
+func (h *OIDCHandlers) HandleStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"enabled": h != nil,
+	})
+}
+
+// HandleLogin 发起OIDC授权码流程（PKCE）
+func (h *OIDCHandlers) HandleLogin(c *gin.Context) {
+	discovery, err := h.getDiscovery()
+	if err != nil {
+		logger.Error("获取OIDC发现文档失败", logger.Err(err))
+		c.JSON(http.StatusBadGateway, gin.H{
+			"success": false,
+			"error":   "SSO服务暂不可用",
+		})
+		return
+	}
+
+	state, err1 := randomURLSafe(24)
+	nonce, err2 := randomURLSafe(24)
+	verifier, err3 := randomURLSafe(48)
+	if err1 != nil || err2 != nil || err3 != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "服务器内部错误",
+		})
+		return
+	}
+
+	h.mu.Lock()
+	h.cleanupPendingLocked(time.Now())
+	if len(h.pending) >= oidcMaxPending {
+		h.evictOldestPendingLocked()
+	}
+	h.pending[state] = oidcPendingLogin{
+		nonce:        nonce,
+		codeVerifier: verifier,
+		expiresAt:    time.Now().Add(oidcStateTTL),
+	}
+	h.mu.Unlock()
+
+	// state 同时写入发起浏览器的 cookie，回调时必须一致，防止把他人发起的回调链接用于登录CSRF
+	// 回调是身份提供方跨站发起的顶层导航，固定使用 Lax 才能随回调发送
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    state,
+		Path:     oidcStateCookiePath,
+		MaxAge:   int(oidcStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   isSecureRequest(c),
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	challenge := sha256.Sum256([]byte(verifier))
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", h.cfg.ClientID)
+	params.Set("redirect_uri", h.cfg.RedirectURL)
+	params.Set("scope", strings.Join(h.cfg.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	c.Redirect(http.StatusFound, discovery.AuthorizationEndpoint+separator+params.Encode())
+}
+
+// HandleCallback 处理授权回调：换取ID Token、校验并创建会话
+func (h *OIDCHandlers) HandleCallback(c *gin.Context) {
+	if errParam := c.Query("error"); errParam != "" {
+		logger.Warn("OIDC授权被拒绝",
+			logger.String("error", errParam),
+			logger.String("description", c.Query("error_description")))
+		c.Redirect(http.StatusFound, "/static/login.html?sso_error=denied")
+		return
+	}
+
+	state := c.Query("state")
+	code := c.Query("code")
+
+	stateCookie, _ := c.Cookie(oidcStateCookieName)
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    "",
+		Path:     oidcStateCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   isSecureRequest(c),
+		SameSite: http.SameSiteLaxMode,
+	})
+	if state == "" || subtle.ConstantTimeCompare([]byte(stateCookie), []byte(state)) != 1 {
+		logger.Warn("OIDC回调state与发起浏览器不一致，拒绝登录", logger.String("ip", c.ClientIP()))
+		c.Redirect(http.StatusFound, "/static/login.html?sso_error=state")
+		return
+	}
+
+	h.mu.Lock()
+	pending, ok := h.pending[state]
+	delete(h.pending, state)
+	h.mu.Unlock()
+
+	if !ok || time.Now().After(pending.expiresAt) || code == "" {
+		logger.Warn("OIDC回调state无效或已过期", logger.String("ip", c.ClientIP()))
+		c.Redirect(http.StatusFound, "/static/login.html?sso_error=state")
+		return
+	}
+
+	claims, err := h.exchangeAndVerify(code, pending)
+	if err != nil {
+		logger.Warn("OIDC登录校验失败", logger.Err(err), logger.String("ip", c.ClientIP()))
+		c.Redirect(http.StatusFound, "/static/login.html?sso_error=verify")
+		return
+	}
+
+	username := claimString(claims, h.cfg.UsernameClaim)
+	if username == "" {
+		username = claimString(claims, "sub")
+	}
+
+	role := h.mapRole(claims)
+	if role == "" {
+		logger.Warn("OIDC用户未映射到任何角色，拒绝登录",
+			logger.String("username", username),
+			logger.String("ip", c.ClientIP()))
+		c.Redirect(http.StatusFound, "/static/login.html?sso_error=forbidden")
+		return
+	}
+
+	if err := h.auth.issueSession(c, username, role); err != nil {
+		logger.Error("创建会话失败", logger.Err(err))
+		c.Redirect(http.StatusFound, "/static/login.html?sso_error=session")
+		return
+	}
+
+	logger.Info("用户通过OIDC登录成功",
+		logger.String("username", username),
+		logger.String("role", string(role)),
+		logger.String("ip", c.ClientIP()))
+	if h.auth.sameSite == http.SameSiteStrictMode {
+		c.Header("Cache-Control", "no-store")
+		c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(oidcLandingPage))
+		return
+	}
+	c.Redirect(http.StatusFound, "/")
+}
+
+// oidcLandingPage SameSite=Strict 时登录成功返回的跳转页
+// 回调由身份提供方跨站发起，302 跳转仍属于同一跨站导航链，浏览器不会携带 Strict cookie；
+// 由本站页面发起的 meta refresh 是新的同站导航，会携带刚设置的会话 cookie
+const oidcLandingPage = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta http-equiv="refresh" content="0;url=/"><title>登录成功</title></head>
+<body><p>登录成功，正在跳转… <a href="/">进入管理后台</a></p></body></html>
+`
+
+// mapRole 根据claim映射角色，多个匹配时取最高权限
+func (h *OIDCHandlers) mapRole(claims map[string]any) Role {
+	var best Role
+	for _, value := range claimStrings(claims, h.cfg.RoleClaim) {
+		if role, ok := h.cfg.RoleMap[value]; ok && roleRank[role] > roleRank[best] {
+			best = role
+		}
+	}
+	if best == "" {
+		best = h.cfg.DefaultRole
+	}
+	return best
+}
+
+// exchangeAndVerify 用授权码换取ID Token并完成校验
+func (h *OIDCHandlers) exchangeAndVerify(code string, pending oidcPendingLogin) (map[string]any, error) {
+	discovery, err := h.getDiscovery()
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", h.cfg.RedirectURL)
+	form.Set("client_id", h.cfg.ClientID)
+	form.Set("code_verifier", pending.codeVerifier)
+	if h.cfg.ClientSecret != "" {
+		form.Set("client_secret", h.cfg.ClientSecret)
+	}
+
+	resp, err := h.httpClient.PostForm(discovery.TokenEndpoint, form)
+	if err != nil {
+		return nil, fmt.Errorf("请求token端点失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("读取token响应失败: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token端点返回状态码 %d: %s", resp.StatusCode, string(body))
+	}
+
+	var tokenResp struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokenResp); err != nil {
+		return nil, fmt.Errorf("解析token响应失败: %w", err)
+	}
+	if tokenResp.IDToken == "" {
+		return nil, fmt.Errorf("token响应中缺少id_token")
+	}
+
+	return h.verifyIDToken(tokenResp.IDToken, pending.nonce, time.Now())
+}
+
+// verifyIDToken 校验ID Token签名（RS256）与标准claims
+func (h *OIDCHandlers) verifyIDToken(rawToken, expectedNonce string, now time.Time) (map[string]any, error) {
+	parts := strings.Split(rawToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("id_token格式无效")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("解析id_token头失败: %w", err)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, fmt.Errorf("解析id_token头失败: %w", err)
+	}
+	if header.Alg != "RS256" {
+		return nil, fmt.Errorf("不支持的签名算法: %s", header.Alg)
+	}
+
+	key, err := h.getSigningKey(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("解析id_token签名失败: %w", err)
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+		return nil, fmt.Errorf("id_token签名校验失败: %w", err)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("解析id_token载荷失败: %w", err)
+	}
+	var claims map[string]any
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("解析id_token载荷失败: %w", err)
+	}
+
+	if strings.TrimRight(claimString(claims, "iss"), "/") != h.cfg.Issuer {
+		return nil, fmt.Errorf("id_token签发者不匹配")
+	}
+	audienceOK := false
+	for _, aud := range claimStrings(claims, "aud") {
+		if aud == h.cfg.ClientID {
+			audienceOK = true
+			break
+		}
+	}
+	if !audienceOK {
+		return nil, fmt.Errorf("id_token受众不匹配")
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(oidcClockSkew)) {
+		return nil, fmt.Errorf("id_token已过期")
+	}
+	if claimString(claims, "nonce") != expectedNonce {
+		return nil, fmt.Errorf("id_token nonce不匹配")
+	}
+
+	return claims, nil
+}
+
+// getDiscovery 获取（并缓存）OIDC发现文档
+func (h *OIDCHandlers) getDiscovery() (*oidcDiscovery, error) {
+	h.mu.Lock()
+	if h.discovery != nil {
+		d := h.discovery
+		h.mu.Unlock()
+		return d, nil
+	}
+	h.mu.Unlock()
+
+	var discovery oidcDiscovery
+	if err := h.getJSON(h.cfg.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, err
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC发现文档缺少必要端点")
+	}
+
+	h.mu.Lock()
+	h.discovery = &discovery
+	h.mu.Unlock()
+	return &discovery, nil
+}
+
+// getSigningKey 获取指定kid的签名公钥，未知kid时刷新JWKS
+func (h *OIDCHandlers) getSigningKey(kid string) (*rsa.PublicKey, error) {
+	h.mu.Lock()
+	key, ok := h.keys[kid]
+	stale := time.Since(h.keysFetched) > oidcJWKSRefreshInterval
+	h.mu.Unlock()
+	if ok && !stale {
+		return key, nil
+	}
+
+	if err := h.refreshKeys(); err != nil {
+		return nil, err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if key, ok := h.keys[kid]; ok {
+		return key, nil
+	}
+	// 只有一个密钥且token未指定kid时直接使用
+	if kid == "" && len(h.keys) == 1 {
+		for _, k := range h.keys {
+			return k, nil
+		}
+	}
+	return nil, fmt.Errorf("未找到签名密钥: %s", kid)
+}
+
+// refreshKeys 拉取JWKS并解析RSA公钥
+func (h *OIDCHandlers) refreshKeys() error {
+	discovery, err := h.getDiscovery()
+	if err != nil {
+		return err
+	}
+
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := h.getJSON(discovery.JWKSURI, &jwks); err != nil {
+		return err
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		nBytes, err1 := base64.RawURLEncoding.DecodeString(k.N)
+		eBytes, err2 := base64.RawURLEncoding.DecodeString(k.E)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(nBytes),
+			E: int(new(big.Int).SetBytes(eBytes).Int64()),
+		}
+	}
+
+	h.mu.Lock()
+	h.keys = keys
+	h.keysFetched = time.Now()
+	h.mu.Unlock()
+	return nil
+}
+
+// getJSON GET请求并解析JSON响应
+func (h *OIDCHandlers) getJSON(rawURL string, out any) error {
+	resp, err := h.httpClient.Get(rawURL)
+	if err != nil {
+		return fmt.Errorf("请求 %s 失败: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("请求 %s 返回状态码 %d", rawURL, resp.StatusCode)
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out); err != nil {
+		return fmt.Errorf("解析 %s 响应失败: %w", rawURL, err)
+	}
+	return nil
+}
+
+// cleanupPendingLocked 清理过期的登录流程（调用时需持有锁）
+func (h *OIDCHandlers) cleanupPendingLocked(now time.Time) {
+	for state, p := range h.pending {
+		if now.After(p.expiresAt) {
+			delete(h.pending, state)
+		}
+	}
+}
+
+// evictOldestPendingLocked 淘汰最早过期的登录流程（调用时需持有锁）
+func (h *OIDCHandlers) evictOldestPendingLocked() {
+	var oldest string
+	var oldestAt time.Time
+	for state, p := range h.pending {
+		if oldest == "" || p.expiresAt.Before(oldestAt) {
+			oldest, oldestAt = state, p.expiresAt
+		}
+	}
+	delete(h.pending, oldest)
+}
+
+// claimString 读取字符串类型claim
+func claimString(claims map[string]any, key string) string {
+	if v, ok := claims[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+// claimStrings 读取字符串或字符串数组类型claim
+func claimStrings(claims map[string]any, key string) []string {
+	switch v := claims[key].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// randomURLSafe 生成URL安全的随机字符串
+func randomURLSafe(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,320 @@
+package server
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeOIDCProvider 模拟OIDC提供方（发现文档、JWKS、token端点）
+type fakeOIDCProvider struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]any
+}
+
+func newFakeOIDCProvider(t *testing.T) *fakeOIDCProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	p := &fakeOIDCProvider{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL,
+			"authorization_endpoint": p.server.URL + "/authorize",
+			"token_endpoint":         p.server.URL + "/token",
+			"jwks_uri":               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": "k1",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		if r.Form.Get("code") != "good-code" || r.Form.Get("code_verifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": p.sign(t, p.claims)})
+	})
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *fakeOIDCProvider) sign(t *testing.T, claims map[string]any) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","kid":"k1"}`))
+	payloadJSON, err := json.Marshal(claims)
+	require.NoError(t, err)
+	payload := base64.RawURLEncoding.EncodeToString(payloadJSON)
+	digest := sha256.Sum256([]byte(header + "." + payload))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+	return header + "." + payload + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// findCookie 按名称查找响应cookie，不存在时返回 nil
+func findCookie(cookies []*http.Cookie, name string) *http.Cookie {
+	for _, cookie := range cookies {
+		if cookie.Name == name {
+			return cookie
+		}
+	}
+	return nil
+}
+
+func newTestOIDCHandlers(t *testing.T, p *fakeOIDCProvider, sameSite http.SameSite) (*OIDCHandlers, *SessionManager) {
+	store, err := NewUserStore("", nil)
+	require.NoError(t, err)
+	sessions := NewSessionManager(time.Hour, time.Hour)
+	t.Cleanup(sessions.Close)
+
+	cfg := &OIDCConfig{
+		Issuer:        p.server.URL,
+		ClientID:      "kiro2api",
+		RedirectURL:   "http://localhost/api/oidc/callback",
+		Scopes:        []string{"openid"},
+		UsernameClaim: "email",
+		RoleClaim:     "groups",
+		RoleMap:       map[string]Role{"ops": RoleOperator, "admins": RoleAdmin},
+	}
+	return NewOIDCHandlers(cfg, NewAuthHandlers(sessions, store, time.Hour, newTestLoginLockout(t), sameSite)), sessions
+}
+
+func TestOIDC_LoginFlow(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p := newFakeOIDCProvider(t)
+	h, sessions := newTestOIDCHandlers(t, p, http.SameSiteLaxMode)
+
+	r := gin.New()
+	r.GET("/api/oidc/login", h.HandleLogin)
+	r.GET("/api/oidc/callback", h.HandleCallback)
+
+	// 发起登录，获取 state 与 nonce
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/oidc/login", nil))
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(location.String(), p.server.URL+"/authorize"))
+	assert.Equal(t, "S256", location.Query().Get("code_challenge_method"))
+
+	p.claims = map[string]any{
+		"iss":    p.server.URL,
+		"aud":    "kiro2api",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"nonce":  location.Query().Get("nonce"),
+		"email":  "alice@example.com",
+		"groups": []string{"ops", "admins"},
+	}
+
+	stateCookie := findCookie(w.Result().Cookies(), oidcStateCookieName)
+	require.NotNil(t, stateCookie)
+	assert.True(t, stateCookie.HttpOnly)
+
+	w = httptest.NewRecorder()
+	callback := "/api/oidc/callback?code=good-code&state=" + location.Query().Get("state")
+	req := httptest.NewRequest(http.MethodGet, callback, nil)
+	req.AddCookie(stateCookie)
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/", w.Header().Get("Location"))
+
+	var sid string
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == sessionCookieName {
+			sid = cookie.Value
+		}
+	}
+	session, ok := sessions.Validate(sid)
+	require.True(t, ok)
+	assert.Equal(t, "alice@example.com", session.User)
+	assert.Equal(t, RoleAdmin, session.Role)
+
+	// state 只能使用一次
+	w = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, callback, nil)
+	req.AddCookie(stateCookie)
+	r.ServeHTTP(w, req)
+	assert.Contains(t, w.Header().Get("Location"), "sso_error=state")
+}
+
+func TestOIDC_StrictCookieLandingPage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p := newFakeOIDCProvider(t)
+	h, sessions := newTestOIDCHandlers(t, p, http.SameSiteStrictMode)
+
+	r := gin.New()
+	r.GET("/api/oidc/login", h.HandleLogin)
+	r.GET("/api/oidc/callback", h.HandleCallback)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/oidc/login", nil))
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+
+	p.claims = map[string]any{
+		"iss":    p.server.URL,
+		"aud":    "kiro2api",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"nonce":  location.Query().Get("nonce"),
+		"email":  "alice@example.com",
+		"groups": []string{"ops"},
+	}
+
+	// Strict cookie 不会随跨站回调后的 302 携带，改为返回同站跳转页
+	stateCookie := findCookie(w.Result().Cookies(), oidcStateCookieName)
+	require.NotNil(t, stateCookie)
+
+	w = httptest.NewRecorder()
+	callback := "/api/oidc/callback?code=good-code&state=" + location.Query().Get("state")
+	req := httptest.NewRequest(http.MethodGet, callback, nil)
+	req.AddCookie(stateCookie)
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get("Location"))
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), `http-equiv="refresh" content="0;url=/"`)
+
+	var session *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == sessionCookieName {
+			session = cookie
+		}
+	}
+	require.NotNil(t, session)
+	assert.Equal(t, http.SameSiteStrictMode, session.SameSite)
+	_, ok := sessions.Validate(session.Value)
+	assert.True(t, ok)
+}
+
+func TestOIDC_CallbackRequiresStateCookie(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p := newFakeOIDCProvider(t)
+	h, sessions := newTestOIDCHandlers(t, p, http.SameSiteLaxMode)
+
+	r := gin.New()
+	r.GET("/api/oidc/login", h.HandleLogin)
+	r.GET("/api/oidc/callback", h.HandleCallback)
+
+	// 攻击者自行发起登录，把回调链接发给受害者
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/oidc/login", nil))
+	require.Equal(t, http.StatusFound, w.Code)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(t, err)
+	p.claims = map[string]any{
+		"iss":    p.server.URL,
+		"aud":    "kiro2api",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+		"nonce":  location.Query().Get("nonce"),
+		"email":  "attacker@example.com",
+		"groups": []string{"admins"},
+	}
+	callback := "/api/oidc/callback?code=good-code&state=" + location.Query().Get("state")
+
+	// 受害者浏览器没有 state cookie
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, callback, nil))
+	assert.Contains(t, w.Header().Get("Location"), "sso_error=state")
+	assert.Nil(t, findCookie(w.Result().Cookies(), sessionCookieName))
+
+	// 受害者浏览器持有自己发起的另一个登录流程的 state cookie
+	w = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, callback, nil)
+	req.AddCookie(&http.Cookie{Name: oidcStateCookieName, Value: "victim-state"})
+	r.ServeHTTP(w, req)
+	assert.Contains(t, w.Header().Get("Location"), "sso_error=state")
+	assert.Equal(t, 0, sessions.Count())
+}
+
+func TestOIDC_PendingLoginsCapped(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	p := newFakeOIDCProvider(t)
+	h, _ := newTestOIDCHandlers(t, p, http.SameSiteLaxMode)
+
+	r := gin.New()
+	r.GET("/api/oidc/login", h.HandleLogin)
+	for i := 0; i < oidcMaxPending+10; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/oidc/login", nil))
+		require.Equal(t, http.StatusFound, w.Code)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	assert.Len(t, h.pending, oidcMaxPending)
+}
+
+func TestOIDC_VerifyIDTokenRejects(t *testing.T) {
+	p := newFakeOIDCProvider(t)
+	h, _ := newTestOIDCHandlers(t, p, http.SameSiteLaxMode)
+
+	valid := map[string]any{
+		"iss":   p.server.URL,
+		"aud":   []string{"other", "kiro2api"},
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"nonce": "n1",
+	}
+	_, err := h.verifyIDToken(p.sign(t, valid), "n1", time.Now())
+	require.NoError(t, err)
+
+	cases := map[string]func(map[string]any){
+		"wrong issuer":   func(c map[string]any) { c["iss"] = "https://evil.example.com" },
+		"wrong audience": func(c map[string]any) { c["aud"] = "other" },
+		"expired":        func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"wrong nonce":    func(c map[string]any) { c["nonce"] = "n2" },
+	}
+	for name, mutate := range cases {
+		claims := map[string]any{}
+		for k, v := range valid {
+			claims[k] = v
+		}
+		mutate(claims)
+		_, err := h.verifyIDToken(p.sign(t, claims), "n1", time.Now())
+		assert.Error(t, err, name)
+	}
+
+	// 篡改载荷导致签名失效
+	token := p.sign(t, valid)
+	parts := strings.Split(token, ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"iss":"x"}`))
+	_, err = h.verifyIDToken(strings.Join(parts, "."), "n1", time.Now())
+	assert.Error(t, err)
+}
+
+func TestOIDC_MapRole(t *testing.T) {
+	h := &OIDCHandlers{cfg: &OIDCConfig{
+		RoleClaim: "groups",
+		RoleMap:   map[string]Role{"ops": RoleOperator},
+	}}
+
+	assert.Equal(t, RoleOperator, h.mapRole(map[string]any{"groups": []any{"x", "ops"}}))
+	assert.Equal(t, Role(""), h.mapRole(map[string]any{"groups": "x"}))
+
+	h.cfg.DefaultRole = RoleViewer
+	assert.Equal(t, RoleViewer, h.mapRole(map[string]any{}))
+}
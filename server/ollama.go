@@ -0,0 +1,145 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"kiro2api/auth"
+	"kiro2api/config"
+	"kiro2api/converter"
+	"kiro2api/logger"
+	"kiro2api/types"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ollamaRoutePrefix Ollama 兼容端点在路由中的前缀
+// /api/* 是管理接口命名空间（会话认证、CSRF），Ollama 路径在路由前改写到 /v1 下，
+// 复用代理端点的 API Key 认证、限流、统计与请求截止时间等中间件
+const ollamaRoutePrefix = "/v1/ollama"
+
+// ollamaVersion /api/version 返回的版本号，部分客户端据此判断接口能力
+const ollamaVersion = "0.9.0"
+
+// ollamaPaths 需要改写的 Ollama 端点
+var ollamaPaths = map[string]bool{
+	"/api/chat":    true,
+	"/api/tags":    true,
+	"/api/version": true,
+}
+
+// ollamaPathRewrite 将 Ollama 端点路径改写为 ollamaRoutePrefix 下的路由
+func ollamaPathRewrite(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ollamaPaths[r.URL.Path] {
+			r.URL.Path = ollamaRoutePrefix + r.URL.Path
+			r.URL.RawPath = ""
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleOllamaChat Ollama /api/chat：默认以 NDJSON 流式下发，stream=false 时一次性返回
+// 请求转换为 Anthropic 格式后走与 /v1/chat/completions 相同的上游与响应处理
+func handleOllamaChat(authService *auth.AuthService, promptPolicies *PromptPolicies) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		// 模型名可能带 :latest 标签，去掉后再按模型选择账号
+		raw, err := c.GetRawData()
+		if err != nil {
+			respondOllamaError(c, http.StatusBadRequest, "读取请求体失败: "+err.Error())
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(raw))
+		model := converter.OllamaModelName(peekRequestModel(raw))
+
+		reqCtx := &RequestContext{
+			GinContext:  c,
+			AuthService: authService,
+			RequestType: "Ollama",
+			Model:       model,
+		}
+		tokenInfo, body, err := reqCtx.GetTokenAndBody()
+		if err != nil {
+			return // 错误已在GetTokenAndBody中处理
+		}
+		var ollamaReq types.OllamaChatRequest
+		if err := utils.SafeUnmarshal(body, &ollamaReq); err != nil {
+			logger.Error("解析Ollama请求体失败", logger.Err(err))
+			respondOllamaError(c, http.StatusBadRequest, "解析请求体失败: "+err.Error())
+			return
+		}
+		setAuditModel(c, model)
+
+		anthropicReq, err := converter.ConvertOllamaToAnthropic(ollamaReq)
+		if err == nil {
+			err = converter.ValidateStopSequences(anthropicReq)
+		}
+		if err != nil {
+			respondOllamaError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		anthropicReq = clampKeyPolicy(c, converter.ApplyModelDefaults(anthropicReq))
+		anthropicReq = promptPolicies.ForKey(GetClientKeyID(c)).ApplyAnthropic(anthropicReq)
+		if anthropicReq, err = guardInput(c, anthropicReq); err != nil {
+			respondOllamaError(c, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		if anthropicReq.Stream {
+			streamConverter := converter.NewOllamaStreamConverter(start)
+			streamOpenAIResponse(c, anthropicReq, tokenInfo, true, &OpenAIStreamSender{
+				emitter:    ndjsonEmitter{},
+				errorEvent: func(message string) any { return gin.H{"error": message} },
+				transform: func(chunk map[string]any) any {
+					if converted := streamConverter.Convert(chunk); converted != nil {
+						return converted
+					}
+					return nil
+				},
+			})
+			return
+		}
+
+		format, _ := converter.OllamaResponseFormat(ollamaReq.Format) // 已在转换时校验
+		openaiResp, ok := buildOpenAIResponse(c, anthropicReq, tokenInfo, format)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, converter.ConvertOpenAIToOllama(openaiResp, time.Since(start)))
+	}
+}
+
+// handleOllamaTags Ollama /api/tags：列出模型路由表中的模型
+func handleOllamaTags(c *gin.Context) {
+	models := []types.OllamaModel{}
+	for _, name := range config.CurrentModelTable().Names() {
+		models = append(models, types.OllamaModel{
+			Name:       name,
+			Model:      name,
+			ModifiedAt: ollamaModifiedAt,
+			Details: types.OllamaModelDetails{
+				Format:   "api",
+				Family:   "claude",
+				Families: []string{"claude"},
+			},
+		})
+	}
+	c.JSON(http.StatusOK, gin.H{"models": models})
+}
+
+// ollamaModifiedAt 模型列表中的固定修改时间（远程模型没有本地文件）
+const ollamaModifiedAt = "2024-01-01T00:00:00Z"
+
+// handleOllamaVersion Ollama /api/version
+func handleOllamaVersion(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"version": ollamaVersion})
+}
+
+// respondOllamaError 以 Ollama 的错误格式返回
+func respondOllamaError(c *gin.Context, statusCode int, message string) {
+	c.JSON(statusCode, gin.H{"error": message})
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"kiro2api/config"
+	"kiro2api/converter"
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOllamaPathRewrite(t *testing.T) {
+	var paths []string
+	handler := ollamaPathRewrite(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+	}))
+	for _, path := range []string{"/api/chat", "/api/tags", "/api/version", "/api/tokens", "/v1/messages"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	assert.Equal(t, []string{
+		"/v1/ollama/api/chat",
+		"/v1/ollama/api/tags",
+		"/v1/ollama/api/version",
+		"/api/tokens", // 管理接口不改写
+		"/v1/messages",
+	}, paths)
+}
+
+func TestOllamaTags(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	handleOllamaTags(c)
+
+	var resp struct {
+		Models []types.OllamaModel `json:"models"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	names := make([]string, 0, len(resp.Models))
+	for _, model := range resp.Models {
+		names = append(names, model.Name)
+		assert.Equal(t, "claude", model.Details.Family)
+	}
+	assert.Equal(t, config.CurrentModelTable().Names(), names)
+}
+
+func TestOllamaStream_NDJSON(t *testing.T) {
+	upstream := withUpstreamUsage(textThenToolUpstream("Let me check."), `{"tokenUsage":{"inputTokens":30,"outputTokens":12}}`)
+	original := execCWRequest
+	t.Cleanup(func() { execCWRequest = original })
+	execCWRequest = func(c *gin.Context, _ types.AnthropicRequest, _ types.TokenInfo, _ bool) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/vnd.amazon.eventstream"}},
+			Body:       io.NopCloser(bytes.NewReader(upstream)),
+		}, nil
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/ollama/api/chat", nil)
+	req := types.AnthropicRequest{
+		Model:     "claude-sonnet-4-20250514",
+		MaxTokens: 100,
+		Stream:    true,
+		Messages:  []types.AnthropicRequestMessage{{Role: "user", Content: "天气如何"}},
+	}
+	streamConverter := converter.NewOllamaStreamConverter(time.Now())
+	streamOpenAIResponse(c, req, types.TokenInfo{}, true, &OpenAIStreamSender{
+		emitter: ndjsonEmitter{},
+		transform: func(chunk map[string]any) any {
+			if converted := streamConverter.Convert(chunk); converted != nil {
+				return converted
+			}
+			return nil
+		},
+	})
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	var text string
+	var calls []types.OllamaToolCall
+	var last types.OllamaChatResponse
+	for _, line := range lines {
+		require.False(t, strings.HasPrefix(line, "data:"), "NDJSON 不带 SSE 前缀: %s", line)
+		var chunk types.OllamaChatResponse
+		require.NoError(t, json.Unmarshal([]byte(line), &chunk), line)
+		text += chunk.Message.Content
+		calls = append(calls, chunk.Message.ToolCalls...)
+		last = chunk
+	}
+
+	assert.Equal(t, "Let me check.", text)
+	require.Len(t, calls, 1, "工具调用参数累积后一次下发")
+	assert.Equal(t, "get_weather", calls[0].Function.Name)
+	assert.Equal(t, map[string]any{"city": "SF"}, calls[0].Function.Arguments)
+	assert.True(t, last.Done, "最后一行 done=true")
+	assert.Equal(t, "stop", last.DoneReason)
+	assert.Equal(t, 30, last.PromptEvalCount)
+	assert.Equal(t, 12, last.EvalCount)
+}
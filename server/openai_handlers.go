@@ -1,48 +1,79 @@
 package server
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"time"
 
 	"kiro2api/config"
 	"kiro2api/converter"
 	"kiro2api/logger"
 	"kiro2api/parser"
+	"kiro2api/tracing"
 	"kiro2api/types"
 	"kiro2api/utils"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// responseFormatRepairAttempts 非流式输出不符合 response_format 时的修复重试次数（0 表示不重试）
+// StartServer 注册 OpenAI 端点时按 RESPONSE_FORMAT_REPAIR_ATTEMPTS 设置
+var responseFormatRepairAttempts = 1
+
+// loadResponseFormatRepairAttemptsFromEnv 读取 RESPONSE_FORMAT_REPAIR_ATTEMPTS（默认1）
+func loadResponseFormatRepairAttemptsFromEnv() int {
+	return utils.GetEnvIntWithDefault("RESPONSE_FORMAT_REPAIR_ATTEMPTS", 1)
+}
+
 // handleOpenAINonStreamRequest 处理OpenAI非流式请求
-func handleOpenAINonStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequest, token types.TokenInfo) {
-	resp, err := executeCodeWhispererRequest(c, anthropicReq, token, false)
-	if err != nil {
+func handleOpenAINonStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequest, token types.TokenInfo, format *types.OpenAIResponseFormat) {
+	openaiResp, ok := buildOpenAIResponse(c, anthropicReq, token, format)
+	if !ok {
 		return
 	}
-	defer resp.Body.Close()
+	c.JSON(http.StatusOK, openaiResp)
+}
 
-	// 读取响应体
-	body, err := utils.ReadHTTPResponse(resp.Body)
-	if err != nil {
-		handleResponseReadError(c, err)
-		return
+// buildOpenAIResponse 执行上游请求并构建OpenAI非流式响应，失败时已写出错误响应
+func buildOpenAIResponse(c *gin.Context, anthropicReq types.AnthropicRequest, token types.TokenInfo, format *types.OpenAIResponseFormat) (types.OpenAIResponse, bool) {
+	result, ok := fetchOpenAICompletion(c, anthropicReq, token)
+	if !ok {
+		return types.OpenAIResponse{}, false
 	}
 
-	// 使用新的符合AWS规范的解析器
-	compliantParser := parser.NewCompliantEventStreamParser()
-	result, err := compliantParser.ParseResponse(body)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "响应解析失败"})
-		return
+	reasoning, allContent := splitReasoning(anthropicReq, result.GetCompletionText())
+	toolCalls := result.GetToolCalls()
+	sawToolUse := len(toolCalls) > 0
+
+	// 结构化输出：校验最终文本，必要时发起修复重试（调用工具时不校验）
+	if converter.RequiresJSONOutput(format) && !sawToolUse {
+		if allContent, ok = enforceResponseFormat(c, anthropicReq, token, format, allContent); !ok {
+			return types.OpenAIResponse{}, false
+		}
+	}
+
+	// 客户端侧执行 stop 与 max_tokens：截断正文，截断后的工具调用不再下发
+	allContent, limiter := applyOutputLimits(anthropicReq, allContent)
+	if limiter.done() {
+		toolCalls = nil
+		sawToolUse = false
 	}
 
 	// 转换为Anthropic格式
 	contexts := []map[string]any{}
-	allContent := result.GetCompletionText()
-	sawToolUse := len(result.GetToolCalls()) > 0
+
+	// 添加思考内容（转换后作为 reasoning_content 返回）
+	if reasoning != "" {
+		contexts = append(contexts, map[string]any{
+			"type":     "thinking",
+			"thinking": reasoning,
+		})
+	}
 
 	// 添加文本内容
 	if allContent != "" {
@@ -53,7 +84,7 @@ func handleOpenAINonStreamRequest(c *gin.Context, anthropicReq types.AnthropicRe
 	}
 
 	// 添加工具调用
-	for _, tool := range result.GetToolCalls() {
+	for _, tool := range toolCalls {
 		contexts = append(contexts, map[string]any{
 			"type":  "tool_use",
 			"id":    tool.ID,
@@ -65,6 +96,9 @@ func handleOpenAINonStreamRequest(c *gin.Context, anthropicReq types.AnthropicRe
 	// 构建Anthropic响应
 	inputContent, _ := utils.GetMessageContent(anthropicReq.Messages[0].Content)
 	stopReason := func() string {
+		if limiter.done() {
+			return limiter.stopReason
+		}
 		if sawToolUse {
 			return "tool_use"
 		}
@@ -75,7 +109,7 @@ func handleOpenAINonStreamRequest(c *gin.Context, anthropicReq types.AnthropicRe
 		"model":         anthropicReq.Model,
 		"role":          "assistant",
 		"stop_reason":   stopReason,
-		"stop_sequence": nil,
+		"stop_sequence": stopSequenceValue(limiter.stopSequence),
 		"type":          "message",
 		"usage": map[string]any{
 			"input_tokens":  len(inputContent),
@@ -86,6 +120,7 @@ func handleOpenAINonStreamRequest(c *gin.Context, anthropicReq types.AnthropicRe
 	// 转换为OpenAI格式
 	openaiMessageId := fmt.Sprintf("chatcmpl-%s", time.Now().Format(config.MessageIDTimeFormat))
 	openaiResp := converter.ConvertAnthropicToOpenAI(anthropicResp, anthropicReq.Model, openaiMessageId)
+	setAuditUsage(c, openaiResp.Usage.PromptTokens, openaiResp.Usage.CompletionTokens)
 
 	// 下发OpenAI兼容非流式响应
 	logger.Debug("下发OpenAI非流式响应",
@@ -93,22 +128,119 @@ func handleOpenAINonStreamRequest(c *gin.Context, anthropicReq types.AnthropicRe
 			logger.String("direction", "downstream_send"),
 			logger.Bool("saw_tool_use", sawToolUse),
 		)...)
-	c.JSON(http.StatusOK, openaiResp)
+	return openaiResp, true
+}
+
+// fetchOpenAICompletion 执行上游请求并解析完整响应，失败时已写出错误响应
+func fetchOpenAICompletion(c *gin.Context, anthropicReq types.AnthropicRequest, token types.TokenInfo) (*parser.ParseResult, bool) {
+	resp, err := execCWRequest(c, anthropicReq, token, false)
+	if err != nil {
+		return nil, false
+	}
+	defer resp.Body.Close()
+
+	// 读取响应体
+	body, err := utils.ReadHTTPResponse(resp.Body)
+	if err != nil {
+		handleResponseReadError(c, err)
+		return nil, false
+	}
+
+	// 使用新的符合AWS规范的解析器
+	compliantParser := parser.NewCompliantEventStreamParser()
+	result, err := compliantParser.ParseResponse(body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "响应解析失败"})
+		return nil, false
+	}
+	return result, true
+}
+
+// enforceResponseFormat 校验模型输出是否符合 response_format，不符合时携带错误说明重试
+// 重试后仍不符合：json_schema 且 strict=true 时返回502，否则记录告警并返回最后一次输出
+func enforceResponseFormat(c *gin.Context, anthropicReq types.AnthropicRequest, token types.TokenInfo, format *types.OpenAIResponseFormat, output string) (string, bool) {
+	cleaned, problems := converter.CheckResponseFormat(format, output)
+	for attempt := 1; len(problems) > 0 && attempt <= responseFormatRepairAttempts; attempt++ {
+		logger.Warn("模型输出不符合response_format，发起修复重试",
+			addReqFields(c,
+				logger.String("format", format.Type),
+				logger.Int("attempt", attempt),
+				logger.String("problems", strings.Join(problems, "; ")),
+			)...)
+		repairReq := converter.BuildResponseFormatRepairRequest(anthropicReq, output, problems)
+		result, ok := fetchOpenAICompletion(c, repairReq, token)
+		if !ok {
+			return "", false
+		}
+		_, output = splitReasoning(anthropicReq, result.GetCompletionText())
+		cleaned, problems = converter.CheckResponseFormat(format, output)
+	}
+	if len(problems) == 0 {
+		return cleaned, true
+	}
+
+	if format.JSONSchema != nil && format.JSONSchema.Strict != nil && *format.JSONSchema.Strict {
+		respondErrorWithCode(c, http.StatusBadGateway, "response_format_violation",
+			"模型输出不符合response_format: %s", strings.Join(problems, "; "))
+		return "", false
+	}
+	logger.Warn("模型输出仍不符合response_format，返回最后一次输出",
+		addReqFields(c,
+			logger.String("format", format.Type),
+			logger.String("problems", strings.Join(problems, "; ")),
+		)...)
+	return output, true
+}
+
+// prepareOpenAIChatRequest 校验聊天补全请求，按调用方密钥应用系统提示策略后转换为 Anthropic 请求
+// 返回的错误均为请求参数错误
+func prepareOpenAIChatRequest(c *gin.Context, openaiReq types.OpenAIRequest, promptPolicies *PromptPolicies) (types.AnthropicRequest, error) {
+	if err := converter.ValidateOpenAIChatRequest(openaiReq); err != nil {
+		return types.AnthropicRequest{}, err
+	}
+	if err := converter.ValidateResponseFormat(openaiReq.ResponseFormat); err != nil {
+		return types.AnthropicRequest{}, err
+	}
+	if err := converter.ValidateReasoningEffort(openaiReq.ReasoningEffort); err != nil {
+		return types.AnthropicRequest{}, err
+	}
+	if err := converter.ValidateOpenAIStop(openaiReq); err != nil {
+		return types.AnthropicRequest{}, err
+	}
+
+	// 客户端系统消息改写后作为 system 前置
+	openaiReq, policySystem := promptPolicies.ForKey(GetClientKeyID(c)).ApplyOpenAI(openaiReq)
+
+	// 转换为Anthropic格式，并按模型路由表与调用方密钥的策略应用默认参数与上限
+	anthropicReq := clampKeyPolicy(c, converter.ApplyModelDefaults(converter.ConvertOpenAIToAnthropic(openaiReq)))
+	if len(policySystem) > 0 {
+		anthropicReq.System = append(policySystem, anthropicReq.System...)
+	}
+	return guardInput(c, anthropicReq)
 }
 
 // handleOpenAIStreamRequest 处理OpenAI流式请求
-func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequest, token types.TokenInfo) {
-	c.Header("Content-Type", "text/event-stream")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-	c.Header("X-Accel-Buffering", "no") // 禁用nginx缓冲
+// includeUsage 对应 stream_options.include_usage，为 true 时在 [DONE] 前追加用量块
+func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequest, token types.TokenInfo, includeUsage bool) {
+	streamOpenAIResponse(c, anthropicReq, token, includeUsage, &OpenAIStreamSender{})
+}
+
+// streamOpenAIResponse 执行上游流式请求，以聊天补全增量块经 sender 下发
+func streamOpenAIResponse(c *gin.Context, anthropicReq types.AnthropicRequest, token types.TokenInfo, includeUsage bool, sender *OpenAIStreamSender) {
+	sender.transport().start(c)
+
+	// 客户端断开时立即取消上游请求与读取
+	var streamErr error
+	finish := trackStream(c)
+	defer func() { finish(streamErr) }()
 
 	messageId := fmt.Sprintf("chatcmpl-%s", time.Now().Format(config.MessageIDTimeFormat))
 	// 注入 message_id，便于统一日志会话标识
 	c.Set("message_id", messageId)
 
-	resp, err := executeCodeWhispererRequest(c, anthropicReq, token, true)
+	resp, err := execCWRequest(c, anthropicReq, token, true)
 	if err != nil {
+		streamErr = err
 		return
 	}
 	defer resp.Body.Close()
@@ -116,7 +248,10 @@ func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicReque
 	// 立即刷新响应头
 	c.Writer.Flush()
 
-	sender := &OpenAIStreamSender{}
+	// 生成停顿期间定期发送保活注释，防止空闲连接被断开（只有 SSE 有注释语法）
+	if sender.transport().keepalive() {
+		defer startSSEKeepalive(c, sseKeepaliveInterval)()
+	}
 
 	// 发送初始OpenAI事件
 	initialEvent := map[string]any{
@@ -136,6 +271,60 @@ func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicReque
 	}
 	sender.SendEvent(c, initialEvent)
 
+	// sendDelta 发送单个增量块
+	sendDelta := func(delta map[string]any) {
+		sender.SendEvent(c, map[string]any{
+			"id":      messageId,
+			"object":  "chat.completion.chunk",
+			"created": time.Now().Unix(),
+			"model":   anthropicReq.Model,
+			"choices": []map[string]any{
+				{
+					"index":         0,
+					"delta":         delta,
+					"finish_reason": nil,
+				},
+			},
+		})
+	}
+
+	// 输出用量：与 Anthropic 流式一致，按实际下发的内容累计估算
+	estimator := utils.NewTokenEstimator()
+	completionTokens := 0
+	toolJSONBytes := 0
+	var upstream upstreamUsage
+
+	// 客户端侧执行 stop 与 max_tokens：正文经限制器截断后下发
+	limiter := newOutputLimiter(anthropicReq)
+	sendText := func(text string) {
+		if text != "" {
+			completionTokens += estimator.EstimateTextTokens(text)
+			sendDelta(map[string]any{"content": text})
+		}
+	}
+	sendContent := func(text string) {
+		sendText(limiter.feed(text))
+	}
+	flushContent := func() {
+		sendText(limiter.flush())
+	}
+
+	// 扩展思考：回复开头的 <thinking> 内容以 reasoning_content 增量下发（THINKING_STRIP 时丢弃）
+	var thinkingSplitter *converter.ThinkingSplitter
+	if converter.ThinkingEnabled(anthropicReq) {
+		thinkingSplitter = converter.NewThinkingSplitter()
+	}
+	sendSegments := func(segments []converter.ThinkingSegment) {
+		for _, segment := range segments {
+			if !segment.Thinking {
+				sendContent(segment.Text)
+			} else if !thinkingStripEnabled {
+				completionTokens += estimator.EstimateTextTokens(segment.Text)
+				sendDelta(map[string]any{"reasoning_content": segment.Text})
+			}
+		}
+	}
+
 	// 创建符合AWS规范的流式解析器
 	compliantParser := parser.NewCompliantEventStreamParser()
 
@@ -152,9 +341,15 @@ func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicReque
 	hasMoreData := true
 	consecutiveErrors := 0
 	const maxConsecutiveErrors = 3
+	var upstreamErr error // 上游中途失败的原因，非空时以错误数据块结束而不是正常结束
 
-	// 使用更大的缓冲区避免数据丢失
-	buf := make([]byte, 8192) // 增加到8KB
+	// 流解析耗时（从首个事件到上游结束）
+	_, parseSpan := tracing.Start(c.Request.Context(), "stream.parse", attribute.String("stream.format", "openai"))
+
+	// 复用的8KB读缓冲区（解析器会拷贝所需数据，缓冲区可在下一次读取时覆盖）
+	bufPtr := utils.GetStreamReadBuffer()
+	defer utils.PutStreamReadBuffer(bufPtr)
+	buf := *bufPtr
 	for hasMoreData {
 		n, err := resp.Body.Read(buf)
 		if n > 0 {
@@ -163,11 +358,18 @@ func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicReque
 
 			events, parseErr := compliantParser.ParseStream(buf[:n])
 			if parseErr != nil {
-				// 在宽松模式下继续处理
-				continue
+				// 损坏的帧已被跳过，继续处理本次解析出的事件
+				logger.Warn("上游事件流存在损坏数据",
+					addReqFields(c,
+						logger.Err(parseErr),
+						logger.Int("read_bytes", n),
+					)...)
 			}
 			messageCount += len(events)
 			for _, event := range events {
+				if limiter.done() {
+					break // 已命中停止序列或达到 max_tokens，丢弃剩余输出
+				}
 				if event.Data != nil {
 					if dataMap, ok := event.Data.(map[string]any); ok {
 						switch dataMap["type"] {
@@ -176,24 +378,13 @@ func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicReque
 								if deltaMap, ok := delta.(map[string]any); ok {
 									switch deltaMap["type"] {
 									case "text_delta":
-										if text, ok := deltaMap["text"]; ok {
+										if text, ok := deltaMap["text"].(string); ok {
 											// 发送文本内容的增量
-											contentEvent := map[string]any{
-												"id":      messageId,
-												"object":  "chat.completion.chunk",
-												"created": time.Now().Unix(),
-												"model":   anthropicReq.Model,
-												"choices": []map[string]any{
-													{
-														"index": 0,
-														"delta": map[string]any{
-															"content": text.(string),
-														},
-														"finish_reason": nil,
-													},
-												},
+											if thinkingSplitter != nil {
+												sendSegments(thinkingSplitter.Feed(text))
+											} else {
+												sendContent(text)
 											}
-											sender.SendEvent(c, contentEvent)
 										}
 									case "input_json_delta":
 										// 工具调用参数增量
@@ -225,6 +416,7 @@ func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicReque
 													}
 												}
 												if partial != "" {
+													toolJSONBytes += len(partial)
 													toolDelta := map[string]any{
 														"id":      messageId,
 														"object":  "chat.completion.chunk",
@@ -259,6 +451,15 @@ func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicReque
 							if contentBlock, ok := dataMap["content_block"]; ok {
 								if blockMap, ok := contentBlock.(map[string]any); ok {
 									if blockType, _ := blockMap["type"].(string); blockType == "tool_use" {
+										// 工具调用开始，思考区域随之结束
+										if thinkingSplitter != nil {
+											sendSegments(thinkingSplitter.Flush())
+										}
+										// 输出暂存正文后若已触发限制，工具调用不再下发
+										flushContent()
+										if limiter.done() {
+											break
+										}
 										toolUseId, _ := blockMap["id"].(string)
 										toolName, _ := blockMap["name"].(string)
 										// 获取内容块索引
@@ -282,6 +483,7 @@ func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicReque
 											}
 											toolUseIdByBlockIndex[toolBlockIndex] = toolUseId
 											sawToolUse = true
+											completionTokens += 12 + estimator.EstimateTextTokens(toolName) // 工具调用结构开销
 											toolIdx := toolIndexByToolUseId[toolUseId]
 											// 发送OpenAI工具调用开始增量
 											toolStart := map[string]any{
@@ -339,6 +541,9 @@ func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicReque
 							}
 						case "content_block_stop":
 							// 忽略，最终结束由message_delta驱动
+						case "usage":
+							// 上游 metadataEvent 提供的用量，最终计费时优先使用
+							upstream.record(dataMap)
 						}
 					}
 				}
@@ -346,10 +551,22 @@ func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicReque
 			}
 		}
 
+		// 已命中停止序列或达到 max_tokens，不再读取上游剩余输出
+		if limiter.done() {
+			break
+		}
+
 		// 错误处理
 		if err != nil {
 			if err == io.EOF {
-				// 正常结束
+				// 正常结束；解析器仍有不完整的帧说明上游在帧中途结束
+				hasMoreData = false
+				if pending := compliantParser.Pending(); pending > 0 {
+					upstreamErr = newStreamError(streamErrUpstreamTruncated,
+						fmt.Errorf("上游在帧中途结束，剩余 %d 字节", pending))
+				}
+			} else if c.Request.Context().Err() != nil {
+				// 客户端断开或超过最大时长，上游读取已被取消，不再重试
 				hasMoreData = false
 			} else if err == io.ErrUnexpectedEOF {
 				// 意外结束，尝试恢复
@@ -357,6 +574,7 @@ func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicReque
 				if consecutiveErrors >= maxConsecutiveErrors {
 					// 连续错误过多，停止
 					hasMoreData = false
+					upstreamErr = newStreamError(streamErrUpstreamTruncated, err)
 				} else {
 					// 使用select支持context取消
 					select {
@@ -371,6 +589,7 @@ func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicReque
 				consecutiveErrors++
 				if consecutiveErrors >= maxConsecutiveErrors {
 					hasMoreData = false
+					upstreamErr = newStreamError(streamErrUpstreamDisconnected, err)
 				} else {
 					// 尝试继续读取
 					continue
@@ -378,11 +597,52 @@ func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicReque
 			}
 		}
 	}
+	parseSpan.SetAttributes(
+		attribute.Int("stream.bytes", totalBytesRead),
+		attribute.Int("stream.events", messageCount))
+	parseSpan.End()
+
+	// 请求总时长到期：上游读取已被取消，通知客户端而不是伪装成正常结束
+	if err := c.Request.Context().Err(); errors.Is(err, context.DeadlineExceeded) {
+		logger.Warn("流式响应超过最大时长，已取消上游请求", addReqFields(c, logger.Err(err))...)
+		_ = sender.SendError(c, "流式响应超过最大时长", newStreamError(streamErrTimeout, err))
+		return
+	}
+
+	// 管理员取消：上游读取已被取消，通知客户端而不是伪装成正常结束
+	if cancelledByAdmin(c) {
+		logger.Warn("流式响应被管理员取消，已取消上游请求", addReqFields(c)...)
+		streamErr = newStreamError(streamErrCancelled, errCancelledByAdmin)
+		_ = sender.SendError(c, errCancelledByAdmin.Error(), streamErr)
+		return
+	}
+
+	// 客户端已断开：上游读取已被取消，不再发送剩余内容与结束标记
+	if clientGone(c) {
+		return
+	}
+
+	// 输出思考拆分器与输出限制器暂存的内容
+	if thinkingSplitter != nil {
+		sendSegments(thinkingSplitter.Flush())
+	}
+	flushContent()
+
+	// 上游中途失败：以带错误码的错误数据块结束，不发送 finish_reason 与 [DONE]，客户端据此区分截断与正常结束
+	if upstreamErr != nil {
+		streamErr = upstreamErr
+		logger.Warn("上游流式响应中途失败",
+			addReqFields(c, logger.String("code", streamErrorCode(upstreamErr)), logger.Err(upstreamErr))...)
+		_ = sender.SendError(c, "上游响应流中断", upstreamErr)
+		return
+	}
 
 	// 确保发送了结束原因（如果还没有发送）
 	if !sentFinal && messageCount > 0 {
 		finishReason := "stop"
-		if sawToolUse {
+		if limiter.done() {
+			finishReason = converter.FinishReasonFromStopReason(limiter.stopReason)
+		} else if sawToolUse {
 			finishReason = "tool_calls"
 		}
 
@@ -403,7 +663,26 @@ func handleOpenAIStreamRequest(c *gin.Context, anthropicReq types.AnthropicReque
 		c.Writer.Flush()
 	}
 
+	completion := completionTokens + (toolJSONBytes+3)/4
+	if completion < 1 && messageCount > 0 {
+		completion = 1 // 最小保护：有输出时至少 1 token
+	}
+	promptTokens, completion := upstream.apply(estimateInputTokens(anthropicReq), completion)
+	setAuditUsage(c, promptTokens, completion)
+
+	// stream_options.include_usage：最后一个数据块携带用量，choices 为空数组
+	if includeUsage {
+		sender.SendEvent(c, map[string]any{
+			"id":      messageId,
+			"object":  "chat.completion.chunk",
+			"created": time.Now().Unix(),
+			"model":   anthropicReq.Model,
+			"choices": []map[string]any{},
+			"usage":   openAIUsage(promptTokens, completion),
+		})
+		c.Writer.Flush()
+	}
+
 	// 发送结束标记
-	fmt.Fprintf(c.Writer, "data: [DONE]\n\n")
-	c.Writer.Flush()
+	sender.SendDone(c)
 }
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"kiro2api/utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+// outputFilters 当前生效的输出过滤规则，未配置 OUTPUT_FILTER_FILE 时为 nil（不过滤）
+var outputFilters *OutputFilters
+
+// OutputFilters 模型输出的后处理规则，作用于流式与非流式响应的正文（不含思考内容与工具调用）
+// 同一模型匹配多条规则时按文件顺序依次应用
+type OutputFilters struct {
+	Rules []OutputFilterRule `json:"rules" yaml:"rules"`
+}
+
+// OutputFilterRule 一条输出过滤规则
+type OutputFilterRule struct {
+	Models                 []string            `json:"models,omitempty" yaml:"models,omitempty"`                                     // 适用的模型（以 * 结尾时按前缀匹配），为空表示所有模型
+	Replace                []OutputReplacement `json:"replace,omitempty" yaml:"replace,omitempty"`                                   // 正则替换，按行匹配
+	Banned                 []string            `json:"banned,omitempty" yaml:"banned,omitempty"`                                     // 命中时在该处截断输出并结束响应
+	TrimTrailingWhitespace bool                `json:"trim_trailing_whitespace,omitempty" yaml:"trim_trailing_whitespace,omitempty"` // 去除行尾空白与正文末尾的空行
+}
+
+// OutputReplacement 正则替换：With 中可以用 $1 引用分组
+type OutputReplacement struct {
+	Pattern string `json:"pattern" yaml:"pattern"`
+	With    string `json:"with" yaml:"with"`
+
+	re *regexp.Regexp
+}
+
+// LoadOutputFiltersFromEnv 从环境变量加载输出过滤规则，未配置时返回 nil
+// - OUTPUT_FILTER_FILE: 规则文件（.yaml/.yml 按 YAML 解析，其余按 JSON）
+func LoadOutputFiltersFromEnv() (*OutputFilters, error) {
+	path := utils.GetEnvWithDefault("OUTPUT_FILTER_FILE", "")
+	if path == "" {
+		return nil, nil
+	}
+	return LoadOutputFiltersFile(path)
+}
+
+// LoadOutputFiltersFile 读取并校验输出过滤规则文件，编译其中的正则
+func LoadOutputFiltersFile(path string) (*OutputFilters, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取输出过滤规则文件失败: %w", err)
+	}
+
+	var filters OutputFilters
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &filters)
+	default:
+		err = json.Unmarshal(data, &filters)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析输出过滤规则文件失败: %w", err)
+	}
+
+	if len(filters.Rules) == 0 {
+		return nil, fmt.Errorf("输出过滤规则文件未配置任何规则")
+	}
+	for i := range filters.Rules {
+		if err := filters.Rules[i].compile(); err != nil {
+			return nil, fmt.Errorf("第 %d 条输出过滤规则无效: %w", i+1, err)
+		}
+	}
+	return &filters, nil
+}
+
+// compile 校验规则并编译正则
+func (r *OutputFilterRule) compile() error {
+	for _, model := range r.Models {
+		if strings.TrimSpace(strings.TrimSuffix(model, "*")) == "" {
+			return fmt.Errorf("models 中的模型名不能为空")
+		}
+	}
+	for i := range r.Replace {
+		if r.Replace[i].Pattern == "" {
+			return fmt.Errorf("正则不能为空")
+		}
+		re, err := regexp.Compile(r.Replace[i].Pattern)
+		if err != nil {
+			return fmt.Errorf("正则 %q 无效: %w", r.Replace[i].Pattern, err)
+		}
+		r.Replace[i].re = re
+	}
+	for _, banned := range r.Banned {
+		if banned == "" || strings.Contains(banned, "\n") {
+			return fmt.Errorf("banned 中的内容不能为空或包含换行")
+		}
+	}
+	if len(r.Replace) == 0 && len(r.Banned) == 0 && !r.TrimTrailingWhitespace {
+		return fmt.Errorf("规则未配置任何处理")
+	}
+	return nil
+}
+
+// appliesTo 规则是否适用于模型
+func (r *OutputFilterRule) appliesTo(model string) bool {
+	if len(r.Models) == 0 {
+		return true
+	}
+	for _, pattern := range r.Models {
+		if modelPatternMatches(pattern, model) {
+			return true
+		}
+	}
+	return false
+}
+
+// forModel 为一次响应创建适用于该模型的过滤器，没有适用的规则时返回 nil
+func (f *OutputFilters) forModel(model string) *outputFilter {
+	if f == nil {
+		return nil
+	}
+	var filter *outputFilter
+	for i := range f.Rules {
+		rule := &f.Rules[i]
+		if !rule.appliesTo(model) {
+			continue
+		}
+		if filter == nil {
+			filter = &outputFilter{}
+		}
+		filter.replacements = append(filter.replacements, rule.Replace...)
+		filter.banned = append(filter.banned, rule.Banned...)
+		filter.trimTrailing = filter.trimTrailing || rule.TrimTrailingWhitespace
+	}
+	return filter
+}
+
+// outputFilter 一次响应的输出过滤状态
+// 正文按行处理：未结束的行暂存到下一片或 flush，因此正则与禁用内容不会因分片而漏判（但不跨行匹配）
+type outputFilter struct {
+	replacements []OutputReplacement
+	banned       []string
+	trimTrailing bool
+
+	pending   string // 未结束的行
+	held      string // 暂缓输出的末尾空行（去除末尾空白时使用）
+	truncated bool   // 已命中禁用内容，之后的输出全部丢弃
+}
+
+// feed 输入一段正文，返回已处理完整行的输出
+func (f *outputFilter) feed(text string) string {
+	if f.truncated {
+		return ""
+	}
+	buf := f.pending + text
+	cut := strings.LastIndexByte(buf, '\n')
+	if cut < 0 {
+		f.pending = buf
+		return ""
+	}
+	f.pending = buf[cut+1:]
+	return f.emit(f.process(buf[:cut+1]), false)
+}
+
+// flush 正文结束时处理暂存的最后一行
+func (f *outputFilter) flush() string {
+	if f.truncated {
+		return ""
+	}
+	pending := f.pending
+	f.pending = ""
+	return f.emit(f.process(pending), true)
+}
+
+// process 逐行应用替换、禁用内容截断与行尾空白清理
+func (f *outputFilter) process(block string) string {
+	if block == "" {
+		return ""
+	}
+	var out strings.Builder
+	for _, line := range strings.SplitAfter(block, "\n") {
+		if line == "" {
+			continue
+		}
+		content, newline := strings.CutSuffix(line, "\n")
+		for _, r := range f.replacements {
+			content = r.re.ReplaceAllString(content, r.With)
+		}
+		if index := f.bannedIndex(content); index >= 0 {
+			out.WriteString(content[:index])
+			f.truncated = true
+			break
+		}
+		if f.trimTrailing {
+			content = strings.TrimRight(content, " \t")
+		}
+		out.WriteString(content)
+		if newline {
+			out.WriteByte('\n')
+		}
+	}
+	return out.String()
+}
+
+// bannedIndex 返回最早出现的禁用内容位置，未命中时返回 -1
+func (f *outputFilter) bannedIndex(text string) int {
+	best := -1
+	for _, banned := range f.banned {
+		if i := strings.Index(text, banned); i >= 0 && (best < 0 || i < best) {
+			best = i
+		}
+	}
+	return best
+}
+
+// emit 去除末尾空白时暂缓输出末尾的换行，后面还有内容时再补上；正文结束或被截断时丢弃末尾空白
+func (f *outputFilter) emit(out string, final bool) string {
+	if !f.trimTrailing {
+		return out
+	}
+	out = f.held + out
+	f.held = ""
+	if final || f.truncated {
+		return strings.TrimRight(out, " \t\r\n")
+	}
+	trimmed := strings.TrimRight(out, "\n")
+	f.held = out[len(trimmed):]
+	return trimmed
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func withOutputFilters(t *testing.T, rules ...OutputFilterRule) {
+	original := outputFilters
+	outputFilters = &OutputFilters{Rules: rules}
+	for i := range outputFilters.Rules {
+		require.NoError(t, outputFilters.Rules[i].compile())
+	}
+	t.Cleanup(func() { outputFilters = original })
+}
+
+// feedChunks 逐片输入正文并在结束时 flush，返回拼接后的输出
+func feedChunks(limiter *outputLimiter, chunks ...string) string {
+	var out strings.Builder
+	for _, chunk := range chunks {
+		out.WriteString(limiter.feed(chunk))
+	}
+	out.WriteString(limiter.flush())
+	return out.String()
+}
+
+func TestLoadOutputFiltersFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "filters.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`rules:
+  - replace:
+      - pattern: '(?i)as an ai( language model)?,\s*'
+        with: ""
+    trim_trailing_whitespace: true
+  - models: [claude-haiku-*]
+    banned: [INTERNAL-ONLY]
+`), 0o600))
+
+	filters, err := LoadOutputFiltersFile(path)
+	require.NoError(t, err)
+	require.Len(t, filters.Rules, 2)
+	assert.Nil(t, (*OutputFilters)(nil).forModel("claude-sonnet-4"))
+	assert.Empty(t, filters.forModel("claude-sonnet-4").banned, "规则只作用于匹配的模型")
+	assert.Equal(t, []string{"INTERNAL-ONLY"}, filters.forModel("Claude-Haiku-4-5").banned)
+
+	invalid := map[string]string{
+		"empty.json":     `{"rules": []}`,
+		"noop.json":      `{"rules": [{"models": ["claude-*"]}]}`,
+		"bad-regex.json": `{"rules": [{"replace": [{"pattern": "(", "with": ""}]}]}`,
+		"no-regex.json":  `{"rules": [{"replace": [{"pattern": "", "with": "x"}]}]}`,
+		"banned.json":    `{"rules": [{"banned": [""]}]}`,
+		"model.json":     `{"rules": [{"models": ["*"], "trim_trailing_whitespace": true}]}`,
+		"broken.json":    `{`,
+	}
+	for name, content := range invalid {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o600))
+		_, err := LoadOutputFiltersFile(p)
+		assert.Error(t, err, name)
+	}
+}
+
+func TestOutputLimiter_Filter(t *testing.T) {
+	withOutputFilters(t,
+		OutputFilterRule{
+			Replace:                []OutputReplacement{{Pattern: `(?i)as an ai,\s*`, With: ""}, {Pattern: `secret-(\d+)`, With: "[redacted-$1]"}},
+			TrimTrailingWhitespace: true,
+		},
+		OutputFilterRule{Models: []string{"claude-haiku-*"}, Banned: []string{"INTERNAL"}},
+	)
+
+	// 替换与空白清理不受分片位置影响
+	limiter := newOutputLimiter(types.AnthropicRequest{Model: "claude-sonnet-4"})
+	out := feedChunks(limiter, "As an A", "I, hello  \nkey secr", "et-42 ok\t\n\n", "\n")
+	assert.Equal(t, "hello\nkey [redacted-42] ok", out)
+	assert.False(t, limiter.done())
+
+	// 末尾空行在后续还有正文时补上
+	limiter = newOutputLimiter(types.AnthropicRequest{Model: "claude-sonnet-4"})
+	assert.Equal(t, "a\n\nb", feedChunks(limiter, "a\n\n", "b  "))
+
+	// 命中禁用内容时截断并以 end_turn 结束
+	limiter = newOutputLimiter(types.AnthropicRequest{Model: "claude-haiku-4-5"})
+	out = feedChunks(limiter, "line one\nthis is INTER", "NAL data\nmore")
+	assert.Equal(t, "line one\nthis is", out)
+	assert.Equal(t, "end_turn", limiter.stopReason)
+	assert.Empty(t, limiter.feed("after"))
+
+	// 过滤后再执行停止序列
+	limiter = newOutputLimiter(types.AnthropicRequest{Model: "claude-sonnet-4", StopSequences: []string{"[redacted"}})
+	assert.Equal(t, "token ", feedChunks(limiter, "token secret-1\n"))
+	assert.Equal(t, "stop_sequence", limiter.stopReason)
+}
+
+func TestAnthropicStream_OutputFilter(t *testing.T) {
+	withOutputFilters(t, OutputFilterRule{
+		Replace: []OutputReplacement{{Pattern: `check`, With: "verify"}},
+		Banned:  []string{"weather"},
+	})
+
+	body := replayStream(t, textThenToolUpstream("Let me ch", "eck.\nSTOP the wea", "ther."), func(c *gin.Context, req types.AnthropicRequest) {
+		handleStreamRequest(c, req, &types.TokenWithUsage{})
+	})
+
+	result := consumeAnthropicStream(t, body)
+	assert.Equal(t, "Let me verify.\nSTOP the ", result.Text)
+	assert.Empty(t, result.Tools, "截断后的工具调用不应下发")
+	assert.Equal(t, "end_turn", result.StopReason)
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"strings"
+
+	"kiro2api/types"
+	"kiro2api/utils"
+)
+
+// outputLimiter 在客户端侧执行 stop_sequences 与 max_tokens
+// 上游不支持停止序列和输出上限，由代理截断正文并记录对应的 stop_reason
+// 可能构成停止序列前缀的尾部文本会暂存到下一片，避免序列跨分片时漏判
+// 配置了输出过滤规则时，正文先经过滤再执行限制，命中禁用内容时以 end_turn 结束
+type outputLimiter struct {
+	stopSequences []string
+	maxTokens     int           // <=0 表示不限制
+	filter        *outputFilter // nil 表示不过滤
+
+	pending      string // 暂存的疑似停止序列前缀
+	runeCount    int    // 已输出的字符数
+	chineseCount int    // 已输出的中文字符数
+
+	stopReason   string // 触发限制时为 "stop_sequence" 或 "max_tokens"
+	stopSequence string // 命中的停止序列
+}
+
+// newOutputLimiter 创建输出限制器
+func newOutputLimiter(req types.AnthropicRequest) *outputLimiter {
+	return &outputLimiter{
+		stopSequences: req.StopSequences,
+		maxTokens:     req.MaxTokens,
+		filter:        outputFilters.forModel(req.Model),
+	}
+}
+
+// done 是否已触发限制（之后的输出全部丢弃）
+func (l *outputLimiter) done() bool {
+	return l.stopReason != ""
+}
+
+// feed 输入一段正文，返回可以立即输出的部分
+func (l *outputLimiter) feed(text string) string {
+	if l.done() {
+		return ""
+	}
+	if l.filter == nil {
+		return l.limit(text)
+	}
+	out := l.limit(l.filter.feed(text))
+	return out + l.checkFiltered()
+}
+
+// limit 对正文执行停止序列与 max_tokens 限制
+func (l *outputLimiter) limit(text string) string {
+	buf := l.pending + text
+	l.pending = ""
+
+	if index, seq := l.findStopSequence(buf); index >= 0 {
+		out := l.limitTokens(buf[:index])
+		if !l.done() {
+			l.stopReason = "stop_sequence"
+			l.stopSequence = seq
+		}
+		return out
+	}
+
+	keep := l.stopPrefixLen(buf)
+	l.pending = buf[len(buf)-keep:]
+	return l.limitTokens(buf[:len(buf)-keep])
+}
+
+// flush 正文结束时输出暂存内容（未构成完整停止序列，按普通文本输出）
+func (l *outputLimiter) flush() string {
+	if l.done() {
+		return ""
+	}
+	out := ""
+	if l.filter != nil {
+		if out = l.limit(l.filter.flush()) + l.checkFiltered(); l.done() {
+			return out
+		}
+	}
+	pending := l.pending
+	l.pending = ""
+	return out + l.limitTokens(pending)
+}
+
+// checkFiltered 过滤器命中禁用内容时输出暂存的正文并以 end_turn 结束
+func (l *outputLimiter) checkFiltered() string {
+	if l.done() || !l.filter.truncated {
+		return ""
+	}
+	pending := l.pending
+	l.pending = ""
+	out := l.limitTokens(pending)
+	if !l.done() {
+		l.stopReason = "end_turn"
+	}
+	return out
+}
+
+// findStopSequence 返回最早出现的停止序列位置，未命中时返回 -1
+func (l *outputLimiter) findStopSequence(text string) (int, string) {
+	best, bestSeq := -1, ""
+	for _, seq := range l.stopSequences {
+		if seq == "" {
+			continue
+		}
+		if i := strings.Index(text, seq); i >= 0 && (best < 0 || i < best) {
+			best, bestSeq = i, seq
+		}
+	}
+	return best, bestSeq
+}
+
+// stopPrefixLen 返回 text 末尾可能是某个停止序列前缀的最长字节数
+func (l *outputLimiter) stopPrefixLen(text string) int {
+	longest := 0
+	for _, seq := range l.stopSequences {
+		for n := len(seq) - 1; n > longest; n-- {
+			if n <= len(text) && strings.HasSuffix(text, seq[:n]) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
+
+// limitTokens 按 max_tokens 截断文本，超出时记录 max_tokens 并丢弃剩余部分
+func (l *outputLimiter) limitTokens(text string) string {
+	if l.maxTokens <= 0 {
+		return text
+	}
+	for i, r := range text {
+		runes, chinese := l.runeCount+1, l.chineseCount
+		if utils.IsChineseRune(r) {
+			chinese++
+		}
+		if utils.EstimateTextTokensFromCounts(runes, chinese) > l.maxTokens {
+			l.stopReason = "max_tokens"
+			l.stopSequence = ""
+			return text[:i]
+		}
+		l.runeCount, l.chineseCount = runes, chinese
+	}
+	return text
+}
+
+// applyOutputLimits 非流式响应一次性应用输出限制，返回截断后的正文及触发的限制
+func applyOutputLimits(req types.AnthropicRequest, text string) (string, *outputLimiter) {
+	limiter := newOutputLimiter(req)
+	out := limiter.feed(text)
+	return out + limiter.flush(), limiter
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOutputLimiter_StopSequenceAcrossChunks(t *testing.T) {
+	limiter := newOutputLimiter(types.AnthropicRequest{StopSequences: []string{"WORLD"}})
+
+	assert.Equal(t, "Hello ", limiter.feed("Hello WO"), "疑似停止序列前缀应暂存")
+	assert.False(t, limiter.done())
+	assert.Empty(t, limiter.feed("RLD! more"))
+	assert.Empty(t, limiter.flush())
+	assert.Equal(t, "stop_sequence", limiter.stopReason)
+	assert.Equal(t, "WORLD", limiter.stopSequence)
+	assert.Empty(t, limiter.feed("after"), "触发限制后丢弃剩余输出")
+}
+
+func TestOutputLimiter_EarliestStopSequenceWins(t *testing.T) {
+	out, limiter := applyOutputLimits(types.AnthropicRequest{StopSequences: []string{"END", "\n\n"}}, "第一段\n\n第二段END")
+
+	assert.Equal(t, "第一段", out)
+	assert.Equal(t, "\n\n", limiter.stopSequence)
+}
+
+func TestOutputLimiter_IncompletePrefixFlushed(t *testing.T) {
+	limiter := newOutputLimiter(types.AnthropicRequest{StopSequences: []string{"###"}})
+
+	assert.Equal(t, "a", limiter.feed("a##"))
+	assert.Equal(t, "##b", limiter.feed("b"))
+	assert.Empty(t, limiter.feed("#"))
+	assert.Equal(t, "#", limiter.flush())
+	assert.False(t, limiter.done())
+}
+
+func TestOutputLimiter_MaxTokens(t *testing.T) {
+	out, limiter := applyOutputLimits(types.AnthropicRequest{MaxTokens: 3}, "abcdefghijklmnopqrstuvwxyz")
+
+	assert.Equal(t, "abcdefgh", out, "8个英文字符约3 token")
+	assert.Equal(t, "max_tokens", limiter.stopReason)
+	assert.Empty(t, limiter.stopSequence)
+}
+
+func TestOutputLimiter_NoLimits(t *testing.T) {
+	out, limiter := applyOutputLimits(types.AnthropicRequest{}, "任意长度的输出")
+
+	assert.Equal(t, "任意长度的输出", out)
+	assert.False(t, limiter.done())
+}
+
+// textThenToolUpstream 上游先输出文本再调用工具
+func textThenToolUpstream(chunks ...string) []byte {
+	upstream := thinkingUpstream(chunks...)
+	for _, payload := range []string{
+		`{"name":"get_weather","toolUseId":"tooluse_1"}`,
+		`{"name":"get_weather","toolUseId":"tooluse_1","input":"{\"city\":\"SF\"}"}`,
+		`{"name":"get_weather","toolUseId":"tooluse_1","stop":true}`,
+	} {
+		upstream = append(upstream, encodeEventStreamFrame("toolUseEvent", []byte(payload))...)
+	}
+	return upstream
+}
+
+// anthropicStopSequence 返回 message_delta 中的 stop_sequence
+func anthropicStopSequence(t *testing.T, body string) any {
+	t.Helper()
+	for _, ev := range parseSSE(t, body) {
+		var data map[string]any
+		require.NoError(t, json.Unmarshal([]byte(ev.Data), &data))
+		if data["type"] == "message_delta" {
+			return data["delta"].(map[string]any)["stop_sequence"]
+		}
+	}
+	t.Fatal("缺少 message_delta 事件")
+	return nil
+}
+
+func TestAnthropicStream_StopSequence(t *testing.T) {
+	upstream := textThenToolUpstream("Let me ch", "eck. STO", "P the weather.")
+
+	body := replayStream(t, upstream, func(c *gin.Context, req types.AnthropicRequest) {
+		req.StopSequences = []string{"STOP"}
+		handleStreamRequest(c, req, &types.TokenWithUsage{})
+	})
+
+	result := consumeAnthropicStream(t, body)
+	assert.Equal(t, "Let me check. ", result.Text)
+	assert.Empty(t, result.Tools, "停止序列之后的工具调用不应下发")
+	assert.Equal(t, "stop_sequence", result.StopReason)
+	assert.Equal(t, "STOP", anthropicStopSequence(t, body))
+}
+
+func TestAnthropicStream_MaxTokens(t *testing.T) {
+	upstream := textThenToolUpstream("abcdefghij", "klmnopqrstuvwxyz")
+
+	body := replayStream(t, upstream, func(c *gin.Context, req types.AnthropicRequest) {
+		req.MaxTokens = 3
+		handleStreamRequest(c, req, &types.TokenWithUsage{})
+	})
+
+	result := consumeAnthropicStream(t, body)
+	assert.Equal(t, "abcdefgh", result.Text)
+	assert.Empty(t, result.Tools)
+	assert.Equal(t, "max_tokens", result.StopReason)
+	assert.Nil(t, anthropicStopSequence(t, body))
+}
+
+func TestOpenAIStream_FinishReasons(t *testing.T) {
+	tests := []struct {
+		name         string
+		stop         []string
+		maxTokens    int
+		expectText   string
+		expectTools  int
+		expectReason string
+	}{
+		{"停止序列", []string{"STOP"}, 100, "Let me check. ", 0, "stop"},
+		{"达到max_tokens", nil, 3, "Let me c", 0, "length"},
+		{"工具调用", nil, 100, "Let me check. STOP the weather.", 1, "tool_calls"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := replayStream(t, textThenToolUpstream("Let me check. ", "STOP the weather."), func(c *gin.Context, req types.AnthropicRequest) {
+				req.StopSequences = tt.stop
+				req.MaxTokens = tt.maxTokens
+				handleOpenAIStreamRequest(c, req, types.TokenInfo{}, false)
+			})
+
+			result := consumeOpenAIStream(t, body)
+			assert.Equal(t, tt.expectText, result.Text)
+			assert.Len(t, result.Tools, tt.expectTools)
+			assert.Equal(t, tt.expectReason, result.StopReason)
+		})
+	}
+}
+
+func TestOpenAINonStream_StopAndLength(t *testing.T) {
+	tests := []struct {
+		name          string
+		stop          []string
+		maxTokens     int
+		expectContent string
+		expectReason  string
+	}{
+		{"停止序列", []string{"</answer>"}, 100, "<answer>42", "stop"},
+		{"达到max_tokens", nil, 3, "<answer>", "length"},
+		{"自然结束", nil, 100, "<answer>42</answer> done", "stop"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stubCompletions(t, "<answer>42</answer> done")
+
+			w := runOpenAINonStreamRequest(t, types.AnthropicRequest{
+				Model:         "claude-sonnet-4-20250514",
+				MaxTokens:     tt.maxTokens,
+				StopSequences: tt.stop,
+				Messages:      []types.AnthropicRequestMessage{{Role: "user", Content: "hi"}},
+			}, nil)
+
+			var resp types.OpenAIResponse
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tt.expectContent, resp.Choices[0].Message.Content)
+			assert.Equal(t, tt.expectReason, resp.Choices[0].FinishReason)
+		})
+	}
+}
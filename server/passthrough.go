@@ -0,0 +1,117 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"kiro2api/logger"
+	"kiro2api/types"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// passthroughHeader 客户端请求透传上游事件流的请求头，响应中以同名头标明已透传
+	passthroughHeader = "X-Kiro-Passthrough"
+	// passthroughEventStream 唯一支持的透传格式：CodeWhisperer 原生的 AWS event-stream
+	passthroughEventStream = "eventstream"
+)
+
+// PassthroughConfig 上游事件流透传配置
+// 能直接解析 AWS event-stream 的客户端（如级联的 kiro2api 或自研 SDK）无需逐事件解析与重新编码，
+// 透传时上游字节流原样写给客户端，请求侧的格式转换、token 选择与重试照常进行
+type PassthroughConfig struct {
+	AllowHeader bool            // 允许客户端通过 X-Kiro-Passthrough: eventstream 按请求开启
+	Models      map[string]bool // 这些模型的流式请求始终透传
+}
+
+// LoadPassthroughConfigFromEnv 从环境变量加载透传配置
+// - PASSTHROUGH_ALLOW_HEADER: 是否接受 X-Kiro-Passthrough 请求头（默认false）
+// - PASSTHROUGH_MODELS: 逗号分隔的模型名，流式请求始终透传（默认空）
+func LoadPassthroughConfigFromEnv() (PassthroughConfig, error) {
+	cfg := PassthroughConfig{
+		AllowHeader: utils.GetEnvBoolWithDefault("PASSTHROUGH_ALLOW_HEADER", false),
+		Models:      make(map[string]bool),
+	}
+	for _, model := range envList("PASSTHROUGH_MODELS") {
+		if strings.ContainsAny(model, " \t") {
+			return PassthroughConfig{}, fmt.Errorf("PASSTHROUGH_MODELS 中的模型名不能包含空白: %q", model)
+		}
+		cfg.Models[model] = true
+	}
+	return cfg, nil
+}
+
+// Enabled 是否配置了任何透传方式
+func (cfg PassthroughConfig) Enabled() bool {
+	return cfg.AllowHeader || len(cfg.Models) > 0
+}
+
+// resolve 判断请求是否透传；请求头取值无效、未开启请求头透传或用于非流式请求时返回错误
+func (cfg PassthroughConfig) resolve(c *gin.Context, req types.AnthropicRequest) (bool, error) {
+	if value := strings.TrimSpace(c.GetHeader(passthroughHeader)); value != "" {
+		switch {
+		case !strings.EqualFold(value, passthroughEventStream):
+			return false, fmt.Errorf("%s 只支持 %s", passthroughHeader, passthroughEventStream)
+		case !cfg.AllowHeader:
+			return false, fmt.Errorf("服务端未开启 %s（PASSTHROUGH_ALLOW_HEADER）", passthroughHeader)
+		case !req.Stream:
+			return false, fmt.Errorf("%s 只能用于流式请求", passthroughHeader)
+		}
+		return true, nil
+	}
+	return req.Stream && cfg.Models[req.Model], nil
+}
+
+// handlePassthroughStreamRequest 转换请求后将上游事件流原样写给客户端，不解析、不重新编码
+// 透传响应没有 SSE 保活注释（二进制流中不能插入），输出 token 不计入用量统计
+func handlePassthroughStreamRequest(c *gin.Context, anthropicReq types.AnthropicRequest, token *types.TokenWithUsage) {
+	// 客户端断开时立即取消上游请求
+	var streamErr error
+	finish := trackStream(c)
+	defer func() { finish(streamErr) }()
+
+	resp, err := execCWRequest(c, anthropicReq, token.TokenInfo, true)
+	if err != nil {
+		streamErr = err
+		return // 错误响应已由 execCWRequest 写出
+	}
+	defer resp.Body.Close()
+
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "application/vnd.amazon.eventstream"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("X-Accel-Buffering", "no")
+	c.Header(passthroughHeader, passthroughEventStream)
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	bufPtr := utils.GetStreamReadBuffer()
+	defer utils.PutStreamReadBuffer(bufPtr)
+	written, err := io.CopyBuffer(flushWriter{c.Writer}, resp.Body, *bufPtr)
+	streamErr = err
+	if err != nil && !errors.Is(err, c.Request.Context().Err()) {
+		logger.Warn("透传上游事件流中断",
+			addReqFields(c, logger.Err(err), logger.Int64("bytes", written))...)
+		return
+	}
+	logger.Debug("透传上游事件流完成", addReqFields(c, logger.Int64("bytes", written))...)
+}
+
+// flushWriter 每次写入后立即刷新，保证透传的事件逐条到达客户端
+type flushWriter struct {
+	w gin.ResponseWriter
+}
+
+func (f flushWriter) Write(p []byte) (int, error) {
+	n, err := f.w.Write(p)
+	f.w.Flush()
+	return n, err
+}
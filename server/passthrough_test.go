@@ -0,0 +1,75 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPassthroughConfig_Resolve(t *testing.T) {
+	t.Setenv("PASSTHROUGH_MODELS", "claude-sonnet-4-20250514, claude-3-7-sonnet-20250219")
+	cfg, err := LoadPassthroughConfigFromEnv()
+	require.NoError(t, err)
+	assert.True(t, cfg.Enabled())
+
+	resolve := func(cfg PassthroughConfig, header string, req types.AnthropicRequest) (bool, error) {
+		gin.SetMode(gin.TestMode)
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+		if header != "" {
+			c.Request.Header.Set(passthroughHeader, header)
+		}
+		return cfg.resolve(c, req)
+	}
+
+	ok, err := resolve(cfg, "", types.AnthropicRequest{Model: "claude-sonnet-4-20250514", Stream: true})
+	require.NoError(t, err)
+	assert.True(t, ok, "按模型透传")
+
+	ok, err = resolve(cfg, "", types.AnthropicRequest{Model: "claude-sonnet-4-20250514"})
+	require.NoError(t, err)
+	assert.False(t, ok, "非流式请求不透传")
+
+	ok, err = resolve(cfg, "", types.AnthropicRequest{Model: "claude-opus-4-20250514", Stream: true})
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = resolve(cfg, "eventstream", types.AnthropicRequest{Stream: true})
+	assert.Error(t, err, "未开启请求头透传")
+
+	cfg.AllowHeader = true
+	ok, err = resolve(cfg, "EventStream", types.AnthropicRequest{Model: "claude-opus-4-20250514", Stream: true})
+	require.NoError(t, err)
+	assert.True(t, ok, "按请求头透传")
+
+	_, err = resolve(cfg, "sse", types.AnthropicRequest{Stream: true})
+	assert.Error(t, err)
+	_, err = resolve(cfg, "eventstream", types.AnthropicRequest{})
+	assert.Error(t, err, "请求头不能用于非流式请求")
+}
+
+func TestHandlePassthroughStreamRequest_CopiesUpstreamBytes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var upstream bytes.Buffer
+	upstream.Write(encodeEventStreamFrame("assistantResponseEvent", []byte(`{"content":"你好"}`)))
+	upstream.Write(encodeEventStreamFrame("assistantResponseEvent", []byte(`{"content":"，世界"}`)))
+	stubUpstream(t, upstream.Bytes())
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	handlePassthroughStreamRequest(c, types.AnthropicRequest{Model: "claude-sonnet-4-20250514", MaxTokens: 100, Stream: true}, &types.TokenWithUsage{})
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/vnd.amazon.eventstream", w.Header().Get("Content-Type"))
+	assert.Equal(t, passthroughEventStream, w.Header().Get(passthroughHeader))
+	assert.Equal(t, upstream.Bytes(), w.Body.Bytes(), "上游字节原样写出")
+	assert.True(t, w.Flushed)
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 密码哈希算法
+const (
+	PasswordAlgoArgon2id = "argon2id"
+	PasswordAlgoBcrypt   = "bcrypt"
+)
+
+// argon2id 参数（RFC 9106 推荐的低内存配置）
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// HashPassword 生成密码哈希：argon2id 使用 PHC 字符串格式（$argon2id$v=19$m=...,t=...,p=...$盐$哈希），bcrypt 使用默认成本
+func HashPassword(password, algo string) (string, error) {
+	if password == "" {
+		return "", fmt.Errorf("密码不能为空")
+	}
+	switch algo {
+	case PasswordAlgoArgon2id, "":
+		salt := make([]byte, argon2SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", fmt.Errorf("生成盐失败: %w", err)
+		}
+		key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	case PasswordAlgoBcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			return "", fmt.Errorf("生成 bcrypt 哈希失败: %w", err)
+		}
+		return string(hash), nil
+	default:
+		return "", fmt.Errorf("不支持的哈希算法: %s（可选 argon2id/bcrypt）", algo)
+	}
+}
+
+// VerifyPasswordHash 校验密码与哈希是否匹配，哈希格式无效时返回错误
+func VerifyPasswordHash(hash, password string) (bool, error) {
+	switch {
+	case strings.HasPrefix(hash, "$argon2id$"):
+		params, err := parseArgon2Hash(hash)
+		if err != nil {
+			return false, err
+		}
+		key := argon2.IDKey([]byte(password), params.salt, params.time, params.memory, params.threads, uint32(len(params.key)))
+		return subtle.ConstantTimeCompare(key, params.key) == 1, nil
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("bcrypt 哈希无效: %w", err)
+		}
+		return true, nil
+	default:
+		return false, fmt.Errorf("无法识别的密码哈希（需为 bcrypt 或 argon2id 格式）")
+	}
+}
+
+// validatePasswordHash 校验哈希格式（不校验密码）
+func validatePasswordHash(hash string) error {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		_, err := parseArgon2Hash(hash)
+		return err
+	}
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return fmt.Errorf("无法识别的密码哈希（需为 bcrypt 或 argon2id 格式）")
+	}
+	return nil
+}
+
+type argon2Params struct {
+	memory  uint32
+	time    uint32
+	threads uint8
+	salt    []byte
+	key     []byte
+}
+
+// parseArgon2Hash 解析 PHC 格式的 argon2id 哈希
+func parseArgon2Hash(hash string) (argon2Params, error) {
+	invalid := fmt.Errorf("argon2id 哈希格式无效")
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return argon2Params{}, invalid
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2Params{}, fmt.Errorf("不支持的 argon2id 版本: %s", parts[2])
+	}
+	var p argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil || p.time == 0 || p.threads == 0 {
+		return argon2Params{}, invalid
+	}
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return argon2Params{}, invalid
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(p.key) == 0 {
+		return argon2Params{}, invalid
+	}
+	return p, nil
+}
+
+// dummyPasswordHash 用户不存在时用于比较的哈希，使耗时与存在哈希密码的用户一致
+var dummyPasswordHash = sync.OnceValue(func() string {
+	hash, _ := HashPassword("kiro2api-dummy-password", PasswordAlgoBcrypt)
+	return hash
+})
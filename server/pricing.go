@@ -0,0 +1,130 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"kiro2api/utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+// pricingTable 当前生效的模型价格表，未配置 PRICING_FILE 时为 nil（不计算费用）
+var pricingTable *PricingTable
+
+// ModelPrice 模型每 1K token 的价格
+type ModelPrice struct {
+	InputPer1K  float64 `json:"input_per_1k" yaml:"input_per_1k"`
+	OutputPer1K float64 `json:"output_per_1k" yaml:"output_per_1k"`
+}
+
+// PricingTable 模型价格表，用于估算请求费用做内部分摊
+// Models 的键为客户端请求的模型名（含别名），以 * 结尾时按前缀匹配（最长前缀优先）；都未匹配时使用 Default
+type PricingTable struct {
+	Currency string                `json:"currency,omitempty" yaml:"currency,omitempty"`
+	Default  *ModelPrice           `json:"default,omitempty" yaml:"default,omitempty"`
+	Models   map[string]ModelPrice `json:"models" yaml:"models"`
+}
+
+// LoadPricingFromEnv 从环境变量加载模型价格表，未配置时返回 nil
+// - PRICING_FILE: 价格文件（.yaml/.yml 按 YAML 解析，其余按 JSON）
+func LoadPricingFromEnv() (*PricingTable, error) {
+	path := utils.GetEnvWithDefault("PRICING_FILE", "")
+	if path == "" {
+		return nil, nil
+	}
+	return LoadPricingFile(path)
+}
+
+// LoadPricingFile 读取并校验模型价格文件
+func LoadPricingFile(path string) (*PricingTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取价格文件失败: %w", err)
+	}
+
+	var table PricingTable
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &table)
+	default:
+		err = json.Unmarshal(data, &table)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析价格文件失败: %w", err)
+	}
+
+	if table.Default != nil {
+		if err := table.Default.validate(); err != nil {
+			return nil, fmt.Errorf("default 价格无效: %w", err)
+		}
+	}
+	for model, price := range table.Models {
+		if strings.TrimSpace(strings.TrimSuffix(model, "*")) == "" {
+			return nil, fmt.Errorf("模型名不能为空")
+		}
+		if err := price.validate(); err != nil {
+			return nil, fmt.Errorf("模型 %s 的价格无效: %w", model, err)
+		}
+	}
+	if len(table.Models) == 0 && table.Default == nil {
+		return nil, fmt.Errorf("价格文件未配置任何模型价格")
+	}
+	if table.Currency == "" {
+		table.Currency = "USD"
+	}
+	return &table, nil
+}
+
+// validate 校验价格配置
+func (p ModelPrice) validate() error {
+	if p.InputPer1K < 0 || p.OutputPer1K < 0 {
+		return fmt.Errorf("价格不能为负数")
+	}
+	return nil
+}
+
+// priceFor 查找模型价格：精确匹配、最长的 * 前缀匹配、Default
+func (t *PricingTable) priceFor(model string) (ModelPrice, bool) {
+	if price, ok := t.Models[model]; ok {
+		return price, true
+	}
+	best, matched := "", false
+	var bestPrice ModelPrice
+	for pattern, price := range t.Models {
+		prefix, ok := strings.CutSuffix(pattern, "*")
+		if ok && strings.HasPrefix(model, prefix) && (!matched || len(prefix) > len(best)) {
+			best, bestPrice, matched = prefix, price, true
+		}
+	}
+	if matched {
+		return bestPrice, true
+	}
+	if t.Default != nil {
+		return *t.Default, true
+	}
+	return ModelPrice{}, false
+}
+
+// Cost 估算一次请求的费用，未配置价格表或模型没有价格时返回 false
+func (t *PricingTable) Cost(model string, inputTokens, outputTokens int) (float64, bool) {
+	if t == nil {
+		return 0, false
+	}
+	price, ok := t.priceFor(model)
+	if !ok {
+		return 0, false
+	}
+	return (float64(inputTokens)*price.InputPer1K + float64(outputTokens)*price.OutputPer1K) / 1000, true
+}
+
+// currency 价格表的币种，未配置价格表时为空
+func (t *PricingTable) currency() string {
+	if t == nil {
+		return ""
+	}
+	return t.Currency
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePricingFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadPricingFile(t *testing.T) {
+	path := writePricingFile(t, "pricing.yaml", `
+default:
+  input_per_1k: 0.001
+  output_per_1k: 0.002
+models:
+  claude-sonnet-4-5:
+    input_per_1k: 0.003
+    output_per_1k: 0.015
+  claude-opus-*:
+    input_per_1k: 0.015
+    output_per_1k: 0.075
+  claude-opus-4-1*:
+    input_per_1k: 0.02
+    output_per_1k: 0.1
+`)
+	table, err := LoadPricingFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "USD", table.Currency)
+
+	cost, ok := table.Cost("claude-sonnet-4-5", 2000, 1000)
+	require.True(t, ok)
+	assert.InDelta(t, 0.021, cost, 1e-9)
+
+	cost, _ = table.Cost("claude-opus-4-20250514", 1000, 1000)
+	assert.InDelta(t, 0.09, cost, 1e-9, "按前缀匹配")
+	cost, _ = table.Cost("claude-opus-4-1-20250805", 1000, 1000)
+	assert.InDelta(t, 0.12, cost, 1e-9, "最长前缀优先")
+	cost, _ = table.Cost("gpt-4o", 1000, 1000)
+	assert.InDelta(t, 0.003, cost, 1e-9, "未匹配时使用 default")
+
+	var nilTable *PricingTable
+	_, ok = nilTable.Cost("claude-sonnet-4-5", 1000, 1000)
+	assert.False(t, ok)
+}
+
+func TestLoadPricingFile_Invalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"negative": `{"models": {"claude-sonnet-4-5": {"input_per_1k": -1}}}`,
+		"empty":    `{"currency": "CNY"}`,
+		"blank":    `{"models": {"*": {"input_per_1k": 1}}}`,
+	} {
+		_, err := LoadPricingFile(writePricingFile(t, name+".json", content))
+		assert.Error(t, err, name)
+	}
+
+	table, err := LoadPricingFile(writePricingFile(t, "pricing.json", `{"models": {"claude-haiku-4-5": {"input_per_1k": 0.001, "output_per_1k": 0.005}}}`))
+	require.NoError(t, err)
+	_, ok := table.Cost("claude-sonnet-4-5", 1000, 1000)
+	assert.False(t, ok, "没有 default 时未配置的模型不计费")
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestPriority 请求优先级，数值越小越优先
+type RequestPriority int
+
+// 请求优先级：由调用方密钥策略的 priority 决定，未配置时为 normal
+const (
+	PriorityHigh RequestPriority = iota
+	PriorityNormal
+	PriorityLow
+)
+
+// priorityNames 优先级名称，按优先级顺序
+var priorityNames = []string{"high", "normal", "low"}
+
+func (p RequestPriority) String() string {
+	if p < PriorityHigh || p > PriorityLow {
+		return "normal"
+	}
+	return priorityNames[p]
+}
+
+// ParseRequestPriority 解析优先级名称（不区分大小写），空值为 normal
+func ParseRequestPriority(name string) (RequestPriority, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return PriorityNormal, nil
+	}
+	for i, n := range priorityNames {
+		if n == name {
+			return RequestPriority(i), nil
+		}
+	}
+	return PriorityNormal, fmt.Errorf("无效的优先级: %s（可选 high/normal/low）", name)
+}
+
+// requestPriority 当前请求的优先级（按调用方密钥的策略）
+func requestPriority(c *gin.Context) RequestPriority {
+	policy := keyPolicies.ForKey(GetClientKeyID(c))
+	if policy == nil {
+		return PriorityNormal
+	}
+	priority, _ := ParseRequestPriority(policy.Priority)
+	return priority
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"kiro2api/types"
+	"kiro2api/utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+// promptTemplatePlaceholder 模板中代表客户端系统提示的占位符
+const promptTemplatePlaceholder = "{{system}}"
+
+// PromptPolicy 系统提示策略，在转换为上游请求前改写系统提示
+// 最终系统提示依次为：Prepend、客户端系统提示（按 Template 包装）、Append
+type PromptPolicy struct {
+	Prepend           string `json:"prepend,omitempty" yaml:"prepend,omitempty"`                         // 置于客户端系统提示之前
+	Append            string `json:"append,omitempty" yaml:"append,omitempty"`                           // 置于客户端系统提示之后
+	StripClientSystem bool   `json:"strip_client_system,omitempty" yaml:"strip_client_system,omitempty"` // 丢弃客户端系统提示
+	Template          string `json:"template,omitempty" yaml:"template,omitempty"`                       // 包装客户端系统提示，{{system}} 为原文
+}
+
+// PromptPolicies 系统提示策略集合，按调用方密钥ID选择，未单独配置的密钥使用 Default
+type PromptPolicies struct {
+	Default *PromptPolicy           `json:"default,omitempty" yaml:"default,omitempty"`
+	Keys    map[string]PromptPolicy `json:"keys,omitempty" yaml:"keys,omitempty"`
+}
+
+// LoadPromptPoliciesFromEnv 从环境变量加载系统提示策略，未配置时返回 nil
+// - PROMPT_POLICY_FILE: 策略文件（.yaml/.yml 按 YAML 解析，其余按 JSON）
+func LoadPromptPoliciesFromEnv() (*PromptPolicies, error) {
+	path := utils.GetEnvWithDefault("PROMPT_POLICY_FILE", "")
+	if path == "" {
+		return nil, nil
+	}
+	return LoadPromptPoliciesFile(path)
+}
+
+// LoadPromptPoliciesFile 读取并校验系统提示策略文件
+func LoadPromptPoliciesFile(path string) (*PromptPolicies, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取系统提示策略文件失败: %w", err)
+	}
+
+	var policies PromptPolicies
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &policies)
+	default:
+		err = json.Unmarshal(data, &policies)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析系统提示策略文件失败: %w", err)
+	}
+
+	if policies.Default != nil {
+		if err := policies.Default.validate(); err != nil {
+			return nil, fmt.Errorf("default 策略无效: %w", err)
+		}
+	}
+	for keyID, policy := range policies.Keys {
+		if strings.TrimSpace(keyID) == "" {
+			return nil, fmt.Errorf("密钥ID不能为空")
+		}
+		if err := policy.validate(); err != nil {
+			return nil, fmt.Errorf("密钥 %s 的策略无效: %w", keyID, err)
+		}
+	}
+	return &policies, nil
+}
+
+// validate 校验策略配置
+func (p PromptPolicy) validate() error {
+	if p.Template != "" && !strings.Contains(p.Template, promptTemplatePlaceholder) {
+		return fmt.Errorf("template 必须包含 %s 占位符", promptTemplatePlaceholder)
+	}
+	if p.Template != "" && p.StripClientSystem {
+		return fmt.Errorf("template 与 strip_client_system 不能同时设置")
+	}
+	return nil
+}
+
+// ForKey 返回调用方密钥ID对应的策略，未配置时返回 nil
+func (ps *PromptPolicies) ForKey(keyID string) *PromptPolicy {
+	if ps == nil {
+		return nil
+	}
+	if policy, ok := ps.Keys[keyID]; ok {
+		return &policy
+	}
+	return ps.Default
+}
+
+// render 按策略生成最终的系统提示文本列表
+func (p *PromptPolicy) render(client []string) []string {
+	var out []string
+	if p.Prepend != "" {
+		out = append(out, p.Prepend)
+	}
+	if !p.StripClientSystem && len(client) > 0 {
+		if p.Template != "" {
+			out = append(out, strings.ReplaceAll(p.Template, promptTemplatePlaceholder, strings.Join(client, "\n")))
+		} else {
+			out = append(out, client...)
+		}
+	}
+	if p.Append != "" {
+		out = append(out, p.Append)
+	}
+	return out
+}
+
+// ApplyAnthropic 按策略改写 Anthropic 请求的 system，策略为 nil 时原样返回
+func (p *PromptPolicy) ApplyAnthropic(req types.AnthropicRequest) types.AnthropicRequest {
+	if p == nil {
+		return req
+	}
+	var client []string
+	for _, sys := range req.System {
+		if sys.Text != "" {
+			client = append(client, sys.Text)
+		}
+	}
+	req.System = systemBlocks(p.render(client))
+	return req
+}
+
+// ApplyOpenAI 按策略改写 OpenAI 请求的 system/developer 消息，策略为 nil 时原样返回
+// 客户端系统消息从 messages 中移除，改写结果作为 Anthropic system 块返回，由调用方在转换后前置
+func (p *PromptPolicy) ApplyOpenAI(req types.OpenAIRequest) (types.OpenAIRequest, []types.AnthropicSystemMessage) {
+	if p == nil {
+		return req, nil
+	}
+	var client []string
+	messages := make([]types.OpenAIMessage, 0, len(req.Messages))
+	for _, msg := range req.Messages {
+		if msg.Role != "system" && msg.Role != "developer" {
+			messages = append(messages, msg)
+			continue
+		}
+		if text := openAISystemText(msg.Content); text != "" {
+			client = append(client, text)
+		}
+	}
+	req.Messages = messages
+	return req, systemBlocks(p.render(client))
+}
+
+// openAISystemText 提取 OpenAI 系统消息文本（空字符串不替换为占位内容）
+func openAISystemText(content any) string {
+	if text, ok := content.(string); ok {
+		return text
+	}
+	text, err := utils.GetMessageContent(content)
+	if err != nil {
+		return ""
+	}
+	return text
+}
+
+// systemBlocks 将文本列表转换为 Anthropic system 块
+func systemBlocks(texts []string) []types.AnthropicSystemMessage {
+	if len(texts) == 0 {
+		return nil
+	}
+	blocks := make([]types.AnthropicSystemMessage, 0, len(texts))
+	for _, text := range texts {
+		blocks = append(blocks, types.AnthropicSystemMessage{Type: "text", Text: text})
+	}
+	return blocks
+}
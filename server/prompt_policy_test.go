@@ -0,0 +1,101 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func systemTexts(blocks []types.AnthropicSystemMessage) []string {
+	var out []string
+	for _, b := range blocks {
+		out = append(out, b.Text)
+	}
+	return out
+}
+
+func TestPromptPolicy_ApplyAnthropic(t *testing.T) {
+	req := types.AnthropicRequest{
+		System: []types.AnthropicSystemMessage{{Type: "text", Text: "client rules"}},
+	}
+
+	tests := []struct {
+		name   string
+		policy *PromptPolicy
+		want   []string
+	}{
+		{"未配置策略", nil, []string{"client rules"}},
+		{"前置与追加", &PromptPolicy{Prepend: "org guardrail", Append: "footer"}, []string{"org guardrail", "client rules", "footer"}},
+		{"丢弃客户端系统提示", &PromptPolicy{Prepend: "org guardrail", StripClientSystem: true}, []string{"org guardrail"}},
+		{"模板包装", &PromptPolicy{Template: "<client>{{system}}</client>"}, []string{"<client>client rules</client>"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.policy.ApplyAnthropic(req)
+			assert.Equal(t, tt.want, systemTexts(got.System))
+		})
+	}
+	assert.Equal(t, "client rules", req.System[0].Text, "不修改调用方的请求")
+}
+
+func TestPromptPolicy_ApplyOpenAI(t *testing.T) {
+	req := types.OpenAIRequest{
+		Messages: []types.OpenAIMessage{
+			{Role: "system", Content: "be terse"},
+			{Role: "developer", Content: ""},
+			{Role: "user", Content: "hi"},
+		},
+	}
+
+	got, system := (&PromptPolicy{Prepend: "org guardrail", Template: "[{{system}}]"}).ApplyOpenAI(req)
+	require.Len(t, got.Messages, 1)
+	assert.Equal(t, "user", got.Messages[0].Role)
+	assert.Equal(t, []string{"org guardrail", "[be terse]"}, systemTexts(system))
+	assert.Len(t, req.Messages, 3, "不修改调用方的请求")
+
+	var none *PromptPolicy
+	got, system = none.ApplyOpenAI(req)
+	assert.Len(t, got.Messages, 3)
+	assert.Nil(t, system)
+}
+
+func TestPromptPolicies_ForKey(t *testing.T) {
+	policies := &PromptPolicies{
+		Default: &PromptPolicy{Prepend: "default"},
+		Keys:    map[string]PromptPolicy{"team-a": {Prepend: "team-a"}},
+	}
+	assert.Equal(t, "team-a", policies.ForKey("team-a").Prepend)
+	assert.Equal(t, "default", policies.ForKey(defaultClientKeyID).Prepend)
+
+	var empty *PromptPolicies
+	assert.Nil(t, empty.ForKey("team-a"))
+}
+
+func TestLoadPromptPoliciesFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "policy.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+default:
+  prepend: "Follow company policy."
+keys:
+  team-a:
+    strip_client_system: true
+    append: "Answer in English."
+`), 0o644))
+
+	policies, err := LoadPromptPoliciesFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "Follow company policy.", policies.Default.Prepend)
+	assert.True(t, policies.Keys["team-a"].StripClientSystem)
+
+	invalid := filepath.Join(dir, "invalid.json")
+	require.NoError(t, os.WriteFile(invalid, []byte(`{"keys":{"team-a":{"template":"no placeholder"}}}`), 0o644))
+	_, err = LoadPromptPoliciesFile(invalid)
+	assert.Error(t, err)
+}
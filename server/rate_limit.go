@@ -0,0 +1,296 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"kiro2api/logger"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimit 令牌桶限流参数，RPS<=0 表示不限制
+type RateLimit struct {
+	RPS   float64 `json:"rps"`
+	Burst int     `json:"burst"`
+}
+
+// KeyRateLimits 单个调用方密钥的限流配置
+// 流式请求占用连接时间远长于非流式，因此使用独立的令牌桶，并额外限制同时进行的流数量
+type KeyRateLimits struct {
+	Request              RateLimit `json:"request"`                // 非流式请求
+	Stream               RateLimit `json:"stream"`                 // 流式请求
+	MaxConcurrentStreams int       `json:"max_concurrent_streams"` // 同时进行的流式请求上限，<=0 表示不限制
+}
+
+// enabled 是否配置了任意限制
+func (l KeyRateLimits) enabled() bool {
+	return l.Request.RPS > 0 || l.Stream.RPS > 0 || l.MaxConcurrentStreams > 0
+}
+
+// tokenBucket 令牌桶状态
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// take 尝试取出一个令牌，失败时返回需要等待的时间
+func (b *tokenBucket) take(limit RateLimit, now time.Time) (bool, time.Duration) {
+	if limit.RPS <= 0 {
+		return true, 0
+	}
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = math.Max(1, math.Ceil(limit.RPS))
+	}
+
+	if b.last.IsZero() {
+		b.tokens = burst
+	} else if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(burst, b.tokens+elapsed*limit.RPS)
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	wait := time.Duration((1 - b.tokens) / limit.RPS * float64(time.Second))
+	return false, wait
+}
+
+// keyRateState 单个密钥的限流状态
+type keyRateState struct {
+	request       tokenBucket
+	stream        tokenBucket
+	activeStreams int
+	lastSeen      time.Time
+}
+
+// 限流拒绝原因
+const (
+	rateLimitReasonRequest = "request_rate"       // 非流式请求速率超限
+	rateLimitReasonStream  = "stream_rate"        // 流式请求速率超限
+	rateLimitReasonStreams = "concurrent_streams" // 并发流数量超限
+)
+
+// RateLimitDecision 限流判定结果
+type RateLimitDecision struct {
+	Allowed    bool
+	Reason     string
+	RetryAfter time.Duration
+	release    func()
+}
+
+// Release 释放并发流名额（非流式或被拒绝的请求为空操作）
+func (d RateLimitDecision) Release() {
+	if d.release != nil {
+		d.release()
+	}
+}
+
+// V1RateLimiter /v1 按调用方密钥限流，流式与非流式请求使用独立的令牌桶
+type V1RateLimiter struct {
+	mu          sync.Mutex
+	defaults    KeyRateLimits
+	overrides   map[string]KeyRateLimits
+	states      map[string]*keyRateState
+	lastCleanup time.Time
+}
+
+// NewV1RateLimiter 创建限流器，overrides 按密钥ID覆盖默认配置
+func NewV1RateLimiter(defaults KeyRateLimits, overrides map[string]KeyRateLimits) *V1RateLimiter {
+	if overrides == nil {
+		overrides = make(map[string]KeyRateLimits)
+	}
+	return &V1RateLimiter{
+		defaults:    defaults,
+		overrides:   overrides,
+		states:      make(map[string]*keyRateState),
+		lastCleanup: time.Now(),
+	}
+}
+
+// LoadV1RateLimiterFromEnv 从环境变量加载限流配置，未配置任何限制时返回 nil
+// - RATE_LIMIT_RPS / RATE_LIMIT_BURST: 非流式请求速率与突发
+// - RATE_LIMIT_STREAM_RPS / RATE_LIMIT_STREAM_BURST: 流式请求速率与突发
+// - RATE_LIMIT_MAX_CONCURRENT_STREAMS: 每个密钥同时进行的流式请求上限
+// - RATE_LIMIT_FILE: JSON文件，按密钥ID覆盖默认配置 {"ci-runner": {"request": {...}, "stream": {...}, "max_concurrent_streams": 2}}
+func LoadV1RateLimiterFromEnv() (*V1RateLimiter, error) {
+	defaults := KeyRateLimits{
+		Request: RateLimit{
+			RPS:   utils.GetEnvFloatWithDefault("RATE_LIMIT_RPS", 0),
+			Burst: utils.GetEnvIntWithDefault("RATE_LIMIT_BURST", 0),
+		},
+		Stream: RateLimit{
+			RPS:   utils.GetEnvFloatWithDefault("RATE_LIMIT_STREAM_RPS", 0),
+			Burst: utils.GetEnvIntWithDefault("RATE_LIMIT_STREAM_BURST", 0),
+		},
+		MaxConcurrentStreams: utils.GetEnvIntWithDefault("RATE_LIMIT_MAX_CONCURRENT_STREAMS", 0),
+	}
+
+	var overrides map[string]KeyRateLimits
+	if path := os.Getenv("RATE_LIMIT_FILE"); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取限流配置文件失败: %w", err)
+		}
+		if err := json.Unmarshal(content, &overrides); err != nil {
+			return nil, fmt.Errorf("解析限流配置文件失败: %w", err)
+		}
+	}
+
+	if !defaults.enabled() && len(overrides) == 0 {
+		return nil, nil
+	}
+	return NewV1RateLimiter(defaults, overrides), nil
+}
+
+// limitsFor 获取密钥的限流配置
+func (l *V1RateLimiter) limitsFor(key string) KeyRateLimits {
+	if limits, ok := l.overrides[key]; ok {
+		return limits
+	}
+	return l.defaults
+}
+
+// Acquire 判定请求是否放行；放行的流式请求占用并发名额，需在结束后调用 Release
+func (l *V1RateLimiter) Acquire(key string, stream bool, now time.Time) RateLimitDecision {
+	limits := l.limitsFor(key)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastCleanup) > time.Minute {
+		l.cleanupLocked(now)
+		l.lastCleanup = now
+	}
+
+	state, exists := l.states[key]
+	if !exists {
+		state = &keyRateState{}
+		l.states[key] = state
+	}
+	state.lastSeen = now
+
+	if !stream {
+		if allowed, wait := state.request.take(limits.Request, now); !allowed {
+			return RateLimitDecision{Reason: rateLimitReasonRequest, RetryAfter: wait}
+		}
+		return RateLimitDecision{Allowed: true}
+	}
+
+	// 先检查并发上限，避免并发超限时白白消耗速率令牌
+	if limits.MaxConcurrentStreams > 0 && state.activeStreams >= limits.MaxConcurrentStreams {
+		return RateLimitDecision{Reason: rateLimitReasonStreams, RetryAfter: time.Second}
+	}
+	if allowed, wait := state.stream.take(limits.Stream, now); !allowed {
+		return RateLimitDecision{Reason: rateLimitReasonStream, RetryAfter: wait}
+	}
+
+	state.activeStreams++
+	var once sync.Once
+	return RateLimitDecision{
+		Allowed: true,
+		release: func() {
+			once.Do(func() {
+				l.mu.Lock()
+				state.activeStreams--
+				l.mu.Unlock()
+			})
+		},
+	}
+}
+
+// ActiveStreams 返回密钥当前进行中的流式请求数
+func (l *V1RateLimiter) ActiveStreams(key string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if state, ok := l.states[key]; ok {
+		return state.activeStreams
+	}
+	return 0
+}
+
+// cleanupLocked 清理长时间未使用且无进行中流的密钥状态（调用时需持有锁）
+func (l *V1RateLimiter) cleanupLocked(now time.Time) {
+	for key, state := range l.states {
+		if state.activeStreams == 0 && now.Sub(state.lastSeen) > 10*time.Minute {
+			delete(l.states, key)
+		}
+	}
+}
+
+// isStreamRequest 从请求体判断是否为流式请求（Anthropic 与 OpenAI 均使用 stream 字段）
+func isStreamRequest(body []byte) bool {
+	var probe struct {
+		Stream bool `json:"stream"`
+	}
+	if err := utils.FastUnmarshal(body, &probe); err != nil {
+		return false
+	}
+	return probe.Stream
+}
+
+// V1RateLimitMiddleware 按调用方密钥对 /v1 请求限流（需位于认证中间件之后）
+func V1RateLimitMiddleware(limiter *V1RateLimiter, prefixes []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil || c.Request.Method != http.MethodPost || !requiresAuth(c.Request.URL.Path, prefixes) {
+			c.Next()
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			respondError(c, http.StatusBadRequest, "读取请求体失败: %v", err)
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		release, ok := admitRateLimit(c, limiter, isStreamRequest(body))
+		if !ok {
+			c.Abort()
+			return
+		}
+		defer release()
+
+		c.Next()
+	}
+}
+
+// admitRateLimit 按调用方密钥判定一个请求是否放行，拒绝时写入 429 响应；
+// 放行的流式请求占用并发流名额，结束后调用 release 归还（WebSocket 的每个请求帧同样经此判定）
+func admitRateLimit(c *gin.Context, limiter *V1RateLimiter, stream bool) (release func(), ok bool) {
+	if limiter == nil {
+		return func() {}, true
+	}
+	key := GetClientKeyID(c)
+	decision := limiter.Acquire(key, stream, time.Now())
+	if !decision.Allowed {
+		retryAfter := int(math.Ceil(decision.RetryAfter.Seconds()))
+		if retryAfter < 1 {
+			retryAfter = 1
+		}
+		logger.Warn("请求被限流",
+			addReqFields(c,
+				logger.String("key_id", key),
+				logger.Bool("stream", stream),
+				logger.String("reason", decision.Reason),
+				logger.Int("retry_after", retryAfter),
+			)...)
+		c.Header("Retry-After", strconv.Itoa(retryAfter))
+		respondErrorWithCode(c, http.StatusTooManyRequests, ErrCodeRateLimited, "请求过于频繁（%s），请 %d 秒后重试", decision.Reason, retryAfter)
+		return nil, false
+	}
+	return decision.Release, true
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestV1RateLimiter_SeparateBuckets(t *testing.T) {
+	limiter := NewV1RateLimiter(KeyRateLimits{
+		Request: RateLimit{RPS: 1, Burst: 2},
+		Stream:  RateLimit{RPS: 1, Burst: 1},
+	}, nil)
+	now := time.Now()
+
+	assert.True(t, limiter.Acquire("k", false, now).Allowed)
+	assert.True(t, limiter.Acquire("k", false, now).Allowed)
+	denied := limiter.Acquire("k", false, now)
+	assert.False(t, denied.Allowed)
+	assert.Equal(t, rateLimitReasonRequest, denied.Reason)
+	assert.Equal(t, time.Second, denied.RetryAfter)
+
+	// 非流式桶耗尽不影响流式桶
+	stream := limiter.Acquire("k", true, now)
+	require.True(t, stream.Allowed)
+	stream.Release()
+	assert.Equal(t, rateLimitReasonStream, limiter.Acquire("k", true, now).Reason)
+
+	// 不同密钥独立计数，令牌随时间恢复
+	assert.True(t, limiter.Acquire("other", false, now).Allowed)
+	assert.True(t, limiter.Acquire("k", false, now.Add(time.Second)).Allowed)
+}
+
+func TestV1RateLimiter_ConcurrentStreams(t *testing.T) {
+	limiter := NewV1RateLimiter(KeyRateLimits{MaxConcurrentStreams: 2}, map[string]KeyRateLimits{
+		"ci": {MaxConcurrentStreams: 1},
+	})
+	now := time.Now()
+
+	first := limiter.Acquire("k", true, now)
+	second := limiter.Acquire("k", true, now)
+	require.True(t, first.Allowed)
+	require.True(t, second.Allowed)
+	third := limiter.Acquire("k", true, now)
+	assert.False(t, third.Allowed)
+	assert.Equal(t, rateLimitReasonStreams, third.Reason)
+
+	// 非流式请求不受并发流上限影响
+	assert.True(t, limiter.Acquire("k", false, now).Allowed)
+
+	// 重复释放只归还一次名额
+	first.Release()
+	first.Release()
+	assert.Equal(t, 1, limiter.ActiveStreams("k"))
+	assert.True(t, limiter.Acquire("k", true, now).Allowed)
+
+	// 按密钥覆盖默认配置
+	require.True(t, limiter.Acquire("ci", true, now).Allowed)
+	assert.False(t, limiter.Acquire("ci", true, now).Allowed)
+}
+
+func TestV1RateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := NewV1RateLimiter(KeyRateLimits{Request: RateLimit{RPS: 0.01, Burst: 1}, MaxConcurrentStreams: 1}, nil)
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) { c.Set(clientKeyIDKey, defaultClientKeyID) })
+	router.Use(V1RateLimitMiddleware(limiter, []string{"/v1"}))
+	router.POST("/v1/messages", func(c *gin.Context) {
+		body, _ := c.GetRawData()
+		c.String(http.StatusOK, string(body))
+	})
+
+	send := func(body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest("POST", "/v1/messages", strings.NewReader(body)))
+		return w
+	}
+
+	w := send(`{"model":"m"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `{"model":"m"}`, w.Body.String(), "请求体需恢复给后续处理")
+
+	w = send(`{"model":"m"}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// 流式请求结束后释放并发名额
+	assert.Equal(t, http.StatusOK, send(`{"stream":true}`).Code)
+	assert.Equal(t, http.StatusOK, send(`{"stream":true}`).Code)
+	assert.Equal(t, 0, limiter.ActiveStreams(defaultClientKeyID))
+}
+
+func TestLoadV1RateLimiterFromEnv(t *testing.T) {
+	for _, key := range []string{"RATE_LIMIT_RPS", "RATE_LIMIT_STREAM_RPS", "RATE_LIMIT_MAX_CONCURRENT_STREAMS", "RATE_LIMIT_FILE"} {
+		t.Setenv(key, "")
+	}
+	limiter, err := LoadV1RateLimiterFromEnv()
+	require.NoError(t, err)
+	assert.Nil(t, limiter, "未配置时不限流")
+
+	path := filepath.Join(t.TempDir(), "rate_limits.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"ci":{"stream":{"rps":2,"burst":4},"max_concurrent_streams":3}}`), 0o600))
+	t.Setenv("RATE_LIMIT_FILE", path)
+	t.Setenv("RATE_LIMIT_STREAM_RPS", "0.5")
+
+	limiter, err = LoadV1RateLimiterFromEnv()
+	require.NoError(t, err)
+	require.NotNil(t, limiter)
+	assert.Equal(t, 0.5, limiter.defaults.Stream.RPS)
+	assert.Equal(t, 3, limiter.limitsFor("ci").MaxConcurrentStreams)
+	assert.Equal(t, limiter.defaults, limiter.limitsFor("unknown"))
+}
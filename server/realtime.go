@@ -0,0 +1,197 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"kiro2api/logger"
+	"kiro2api/types"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+)
+
+// realtimePath WebSocket 流式聊天补全端点
+const realtimePath = "/v1/realtime"
+
+// realtimeIdleTimeout 等待下一条请求的空闲超时，超时后关闭连接
+const realtimeIdleTimeout = 5 * time.Minute
+
+// realtimeMaxFramesInFlight 同一连接上同时处理的请求帧上限
+// 前一个请求结束（含错误帧）前不读取下一帧，未读取的帧由 TCP 流控阻塞在客户端
+const realtimeMaxFramesInFlight = 1
+
+// realtimeDoneFrame 一次流式响应结束的帧（对应 SSE 的 [DONE]）
+var realtimeDoneFrame = []byte(`{"object":"chat.completion.done"}`)
+
+// handleRealtime WebSocket 流式聊天补全：供 SSE 会被代理缓冲或改写的客户端使用
+// 每个文本帧是一个 /v1/chat/completions 请求体（总是流式），响应的每个增量块作为一个 JSON 帧下发，
+// 以 realtimeDoneFrame 或错误帧结束；同一连接上的请求依次处理（见 realtimeMaxFramesInFlight）
+// 认证与请求截止时间由 /v1 中间件在握手时按连接生效；握手是 GET 请求，不经过限流与全局进行中名额，
+// 因此每个请求帧单独按调用方密钥限流、占用并发流名额与全局进行中名额，拒绝时以错误帧返回
+func handleRealtime(authService modelTokenSource, promptPolicies *PromptPolicies, limits realtimeLimits) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		server := websocket.Server{
+			// 认证使用 API Key 而非 Cookie，不存在跨站 WebSocket 劫持，不校验 Origin
+			Handshake: func(*websocket.Config, *http.Request) error { return nil },
+			Handler: func(conn *websocket.Conn) {
+				serveRealtime(c, conn, authService, promptPolicies, limits)
+			},
+		}
+		server.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// serveRealtime 读取请求帧并依次处理，直到连接关闭、空闲超时或请求截止时间到期
+func serveRealtime(c *gin.Context, conn *websocket.Conn, authService modelTokenSource, promptPolicies *PromptPolicies, limits realtimeLimits) {
+	original, request := c.Writer, c.Request
+	defer func() { c.Writer, c.Request = original, request }()
+
+	for request.Context().Err() == nil {
+		// 握手前服务器设置的读超时仍作用于连接，每次等待请求前重新设置
+		_ = conn.SetReadDeadline(time.Now().Add(realtimeIdleTimeout))
+		var frame []byte
+		if err := websocket.Message.Receive(conn, &frame); err != nil {
+			if !errors.Is(err, io.EOF) {
+				logger.Debug("WebSocket连接结束", addReqFields(c, logger.Err(err))...)
+			}
+			return
+		}
+		if !serveRealtimeRequest(c, conn, request, frame, authService, promptPolicies, limits) {
+			return
+		}
+	}
+}
+
+// serveRealtimeRequest 处理一个请求帧，客户端断开时返回 false
+// 请求复用 HTTP 处理流程：请求体替换为帧内容，普通响应（流式输出前的错误）由 wsResponseWriter 捕获后转发为错误帧
+func serveRealtimeRequest(c *gin.Context, conn *websocket.Conn, request *http.Request, frame []byte, authService modelTokenSource, promptPolicies *PromptPolicies, limits realtimeLimits) bool {
+	ctx, cancel := context.WithCancel(request.Context())
+	defer cancel()
+	writer := &wsResponseWriter{ResponseWriter: c.Writer, header: http.Header{}, status: http.StatusOK}
+	c.Writer = writer
+	c.Request = request.WithContext(ctx)
+	c.Request.Body = io.NopCloser(bytes.NewReader(frame))
+
+	if release, ok := limits.admit(c); ok {
+		handleRealtimeChat(c, authService, promptPolicies, &wsEmitter{conn: conn, cancel: cancel})
+		cancelSlotLeases(c)
+		release()
+	}
+
+	if writer.body.Len() > 0 {
+		if err := websocket.Message.Send(conn, writer.body.String()); err != nil {
+			return false
+		}
+	}
+	return ctx.Err() == nil
+}
+
+// realtimeLimits 按请求帧生效的限制，字段为 nil 表示未启用
+type realtimeLimits struct {
+	rateLimiter *V1RateLimiter
+	inflight    *InflightLimiter
+}
+
+// admit 与 /v1 的限流、全局进行中名额中间件相同的判定，请求帧总是流式
+// 拒绝时响应已写入 c，返回 false
+func (l realtimeLimits) admit(c *gin.Context) (release func(), ok bool) {
+	releaseRate, ok := admitRateLimit(c, l.rateLimiter, true)
+	if !ok {
+		return nil, false
+	}
+	releaseInflight, ok := admitInflight(c, l.inflight)
+	if !ok {
+		releaseRate()
+		return nil, false
+	}
+	return func() {
+		releaseInflight()
+		releaseRate()
+	}, true
+}
+
+// handleRealtimeChat 与 /v1/chat/completions 流式请求相同的处理流程，增量块经 emitter 以 WebSocket 帧下发
+func handleRealtimeChat(c *gin.Context, authService modelTokenSource, promptPolicies *PromptPolicies, emitter streamEmitter) {
+	reqCtx := &RequestContext{
+		GinContext:  c,
+		AuthService: authService,
+		RequestType: "Realtime",
+	}
+	tokenInfo, body, err := reqCtx.GetTokenAndBody()
+	if err != nil {
+		return // 错误已在GetTokenAndBody中处理
+	}
+
+	var openaiReq types.OpenAIRequest
+	if err := utils.SafeUnmarshal(body, &openaiReq); err != nil {
+		logger.Error("解析Realtime请求帧失败", logger.Err(err))
+		respondError(c, http.StatusBadRequest, "解析请求体失败: %v", err)
+		return
+	}
+	setAuditModel(c, openaiReq.Model)
+
+	anthropicReq, err := prepareOpenAIChatRequest(c, openaiReq, promptPolicies)
+	if err != nil {
+		respondInvalidRequest(c, err)
+		return
+	}
+	anthropicReq.Stream = true
+
+	includeUsage := openaiReq.StreamOptions != nil && openaiReq.StreamOptions.IncludeUsage
+	streamOpenAIResponse(c, anthropicReq, tokenInfo, includeUsage, &OpenAIStreamSender{emitter: emitter})
+}
+
+// wsEmitter 以 WebSocket 文本帧下发事件，每帧一个 JSON
+type wsEmitter struct {
+	conn   *websocket.Conn
+	cancel context.CancelFunc
+}
+
+func (*wsEmitter) start(*gin.Context) {}
+
+func (e *wsEmitter) emit(_ *gin.Context, payload []byte) error {
+	if err := websocket.Message.Send(e.conn, string(payload)); err != nil {
+		e.cancel() // 客户端已断开，取消上游请求
+		return err
+	}
+	return nil
+}
+
+func (e *wsEmitter) done(c *gin.Context) error {
+	return e.emit(c, realtimeDoneFrame)
+}
+
+func (*wsEmitter) keepalive() bool { return false }
+
+// wsResponseWriter WebSocket 连接上单个请求的 ResponseWriter
+// 连接已被接管，普通响应写入缓冲区，由调用方转发为帧；Flush 与响应头不再作用于连接
+type wsResponseWriter struct {
+	gin.ResponseWriter
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *wsResponseWriter) Header() http.Header { return w.header }
+
+func (w *wsResponseWriter) WriteHeader(code int) { w.status = code }
+
+func (w *wsResponseWriter) WriteHeaderNow() {}
+
+func (w *wsResponseWriter) Write(data []byte) (int, error) { return w.body.Write(data) }
+
+func (w *wsResponseWriter) WriteString(s string) (int, error) { return w.body.WriteString(s) }
+
+func (w *wsResponseWriter) Status() int { return w.status }
+
+func (w *wsResponseWriter) Size() int { return w.body.Len() }
+
+func (w *wsResponseWriter) Written() bool { return w.body.Len() > 0 }
+
+func (w *wsResponseWriter) Flush() {}
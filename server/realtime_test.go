@@ -0,0 +1,171 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/websocket"
+)
+
+func TestRealtime(t *testing.T) {
+	upstream := withUpstreamUsage(textThenToolUpstream("Let me check."), `{"tokenUsage":{"inputTokens":30,"outputTokens":12}}`)
+	original := execCWRequest
+	t.Cleanup(func() { execCWRequest = original })
+	execCWRequest = func(c *gin.Context, _ types.AnthropicRequest, _ types.TokenInfo, _ bool) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/vnd.amazon.eventstream"}},
+			Body:       io.NopCloser(bytes.NewReader(upstream)),
+		}, nil
+	}
+
+	r := gin.New()
+	r.GET(realtimePath, handleRealtime(&MockAuthService{token: types.TokenInfo{AccessToken: "test"}}, nil, realtimeLimits{}))
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+realtimePath, "", srv.URL)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// receiveUntilEnd 读取一次响应的所有帧，直到结束帧或错误帧
+	receiveUntilEnd := func() []map[string]any {
+		var frames []map[string]any
+		for {
+			var frame map[string]any
+			require.NoError(t, websocket.JSON.Receive(conn, &frame))
+			frames = append(frames, frame)
+			if frame["object"] == "chat.completion.done" || frame["error"] != nil {
+				return frames
+			}
+		}
+	}
+
+	request := `{"model":"claude-sonnet-4-20250514","messages":[{"role":"user","content":"天气如何"}],"stream_options":{"include_usage":true}}`
+	require.NoError(t, websocket.Message.Send(conn, request))
+	frames := receiveUntilEnd()
+	var text, finishReason string
+	var usage map[string]any
+	for _, frame := range frames[:len(frames)-1] {
+		assert.Equal(t, "chat.completion.chunk", frame["object"])
+		if u, ok := frame["usage"].(map[string]any); ok {
+			usage = u
+		}
+		for _, choice := range frame["choices"].([]any) {
+			choice := choice.(map[string]any)
+			delta := choice["delta"].(map[string]any)
+			if content, ok := delta["content"].(string); ok {
+				text += content
+			}
+			if reason, ok := choice["finish_reason"].(string); ok {
+				finishReason = reason
+			}
+		}
+	}
+	assert.Equal(t, "Let me check.", text)
+	assert.Equal(t, "tool_calls", finishReason)
+	require.NotNil(t, usage, "include_usage 时结束前下发用量块")
+	assert.Equal(t, float64(42), usage["total_tokens"])
+
+	// 请求错误以错误帧返回，连接保持可用
+	require.NoError(t, websocket.Message.Send(conn, `{"model":"claude-sonnet-4-20250514","messages":[{"role":"user","content":"hi"}],"max_tokens":0}`))
+	frames = receiveUntilEnd()
+	require.Len(t, frames, 1)
+	assert.NotNil(t, frames[0]["error"])
+
+	require.NoError(t, websocket.Message.Send(conn, request))
+	frames = receiveUntilEnd()
+	assert.Equal(t, "chat.completion.done", frames[len(frames)-1]["object"])
+}
+
+func TestRealtime_PerFrameLimits(t *testing.T) {
+	upstream := textThenToolUpstream("ok")
+	original := execCWRequest
+	t.Cleanup(func() { execCWRequest = original })
+	execCWRequest = func(c *gin.Context, _ types.AnthropicRequest, _ types.TokenInfo, _ bool) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/vnd.amazon.eventstream"}},
+			Body:       io.NopCloser(bytes.NewReader(upstream)),
+		}, nil
+	}
+
+	// 流式令牌桶只允许一次突发；全局进行中名额为 1
+	limits := realtimeLimits{
+		rateLimiter: NewV1RateLimiter(KeyRateLimits{Stream: RateLimit{RPS: 0.001, Burst: 1}}, nil),
+		inflight:    NewInflightLimiter(1, inflightModeReject, 0, 0),
+	}
+	r := gin.New()
+	r.GET(realtimePath, handleRealtime(&MockAuthService{token: types.TokenInfo{AccessToken: "test"}}, nil, limits))
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	conn, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+realtimePath, "", srv.URL)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	receiveLast := func() map[string]any {
+		for {
+			var frame map[string]any
+			require.NoError(t, websocket.JSON.Receive(conn, &frame))
+			if frame["object"] == "chat.completion.done" || frame["error"] != nil {
+				return frame
+			}
+		}
+	}
+	request := `{"model":"claude-sonnet-4-20250514","messages":[{"role":"user","content":"hi"}]}`
+
+	require.NoError(t, websocket.Message.Send(conn, request))
+	assert.Equal(t, "chat.completion.done", receiveLast()["object"])
+	assert.Equal(t, 0, limits.inflight.Stats().InFlight, "请求结束后归还全局名额")
+
+	// 同一连接上的下一帧同样经过限流，超限时以错误帧返回，连接保持可用
+	require.NoError(t, websocket.Message.Send(conn, request))
+	frame := receiveLast()
+	require.NotNil(t, frame["error"])
+	assert.Equal(t, ErrCodeRateLimited, frame["error"].(map[string]any)["code"])
+
+	// 全局进行中名额已满时以 503 错误帧拒绝
+	limits.rateLimiter = nil
+	release, ok := limits.inflight.Acquire(context.Background())
+	require.True(t, ok)
+	defer release()
+	r2 := gin.New()
+	r2.GET(realtimePath, handleRealtime(&MockAuthService{token: types.TokenInfo{AccessToken: "test"}}, nil, limits))
+	srv2 := httptest.NewServer(r2)
+	defer srv2.Close()
+	conn2, err := websocket.Dial("ws"+strings.TrimPrefix(srv2.URL, "http")+realtimePath, "", srv2.URL)
+	require.NoError(t, err)
+	defer conn2.Close()
+	require.NoError(t, websocket.Message.Send(conn2, request))
+	var rejected map[string]any
+	require.NoError(t, websocket.JSON.Receive(conn2, &rejected))
+	require.NotNil(t, rejected["error"])
+	assert.Equal(t, ErrCodeServerOverloaded, rejected["error"].(map[string]any)["code"])
+}
+
+func TestWSResponseWriter_CapturesResponse(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	writer := &wsResponseWriter{ResponseWriter: c.Writer, header: http.Header{}, status: http.StatusOK}
+	c.Writer = writer
+
+	respondError(c, http.StatusBadRequest, "%s", "bad")
+
+	assert.Equal(t, http.StatusBadRequest, writer.Status())
+	var body map[string]any
+	require.NoError(t, json.Unmarshal(writer.body.Bytes(), &body))
+	assert.NotNil(t, body["error"])
+	assert.Empty(t, w.Body.String(), "已接管的连接上不直接写响应")
+}
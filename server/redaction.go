@@ -0,0 +1,20 @@
+package server
+
+import (
+	"kiro2api/redact"
+	"kiro2api/utils"
+)
+
+// contentRedactor 请求/响应内容脱敏规则，未配置 REDACTION_RULES 时为 nil（不脱敏）
+// 同时作用于日志字段、审计记录与支持包中的错误样本
+var contentRedactor *redact.Redactor
+
+// LoadRedactorFromEnv 从环境变量加载脱敏规则，未配置时返回 nil
+// - REDACTION_RULES: 规则文件（.yaml/.yml 按 YAML 解析，其余按 JSON），每条规则使用内置规则或自定义正则
+func LoadRedactorFromEnv() (*redact.Redactor, error) {
+	path := utils.GetEnvWithDefault("REDACTION_RULES", "")
+	if path == "" {
+		return nil, nil
+	}
+	return redact.LoadFile(path)
+}
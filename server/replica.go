@@ -0,0 +1,85 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"kiro2api/auth"
+	"kiro2api/logger"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReplicaConfig 只读副本配置
+// 副本只提供Dashboard与统计，从共享的配置文件同步账号状态，拒绝 /v1 代理与所有变更操作，
+// 便于向更大范围开放监控而不暴露代理入口
+type ReplicaConfig struct {
+	Enabled      bool
+	SyncInterval time.Duration // 从共享配置文件同步的间隔
+}
+
+// LoadReplicaConfigFromEnv 从环境变量加载只读副本配置
+// - REPLICA_MODE: 是否以只读副本运行（默认false）
+// - REPLICA_SYNC_SECONDS: 同步共享配置文件的间隔（默认30）
+func LoadReplicaConfigFromEnv() ReplicaConfig {
+	return ReplicaConfig{
+		Enabled:      utils.GetEnvBool("REPLICA_MODE"),
+		SyncInterval: time.Duration(utils.GetEnvIntWithDefault("REPLICA_SYNC_SECONDS", 30)) * time.Second,
+	}
+}
+
+// replicaWritablePaths 只读副本中仍允许的非安全方法请求（登录会话与日志级别仅影响本实例）
+var replicaWritablePaths = []string{"/api/login", "/api/logout", "/api/admin/loglevel"}
+
+// ReadReplicaMiddleware 只读副本拒绝代理流量与管理后台的变更操作
+func ReadReplicaMiddleware(proxyPrefixes []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if requiresAuth(path, proxyPrefixes) {
+			respondErrorWithCode(c, http.StatusForbidden, "read_replica", "只读副本不提供代理服务，请访问主实例")
+			c.Abort()
+			return
+		}
+		if isUnsafeMethod(c.Request.Method) && strings.HasPrefix(path, "/api/") && !isReplicaWritablePath(path) {
+			c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "只读副本不允许修改，请在主实例操作"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// isReplicaWritablePath 判断路径是否在只读副本的放行列表中
+func isReplicaWritablePath(path string) bool {
+	for _, p := range replicaWritablePaths {
+		if path == p {
+			return true
+		}
+	}
+	return false
+}
+
+// startReplicaSync 定期从共享配置存储同步账号配置，返回停止函数
+func startReplicaSync(authService *auth.AuthService, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	if interval <= 0 {
+		return func() {}
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if _, err := authService.ReloadFromFile(); err != nil {
+					logger.Warn("只读副本同步共享配置失败", logger.Err(err))
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadReplicaMiddleware(t *testing.T) {
+	r := gin.New()
+	r.Use(ReadReplicaMiddleware([]string{"/v1"}))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.POST("/v1/messages", ok)
+	r.GET("/v1/models", ok)
+	r.GET("/api/tokens", ok)
+	r.POST("/api/tokens", ok)
+	r.DELETE("/api/tokens/:id", ok)
+	r.POST("/api/login", ok)
+	r.POST("/api/logout", ok)
+	r.PUT("/api/admin/loglevel", ok)
+	r.GET("/readyz", ok)
+
+	tests := []struct {
+		method string
+		path   string
+		status int
+	}{
+		{http.MethodPost, "/v1/messages", http.StatusForbidden},
+		{http.MethodGet, "/v1/models", http.StatusForbidden},
+		{http.MethodGet, "/api/tokens", http.StatusOK},
+		{http.MethodPost, "/api/tokens", http.StatusForbidden},
+		{http.MethodDelete, "/api/tokens/x", http.StatusForbidden},
+		{http.MethodPost, "/api/login", http.StatusOK},
+		{http.MethodPost, "/api/logout", http.StatusOK},
+		{http.MethodPut, "/api/admin/loglevel", http.StatusOK},
+		{http.MethodGet, "/readyz", http.StatusOK},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(tt.method, tt.path, nil))
+		assert.Equal(t, tt.status, w.Code, "%s %s", tt.method, tt.path)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/v1/messages", nil))
+	assert.Contains(t, w.Body.String(), "read_replica")
+}
+
+func TestLoadReplicaConfigFromEnv(t *testing.T) {
+	t.Setenv("REPLICA_MODE", "")
+	assert.False(t, LoadReplicaConfigFromEnv().Enabled)
+
+	t.Setenv("REPLICA_MODE", "true")
+	t.Setenv("REPLICA_SYNC_SECONDS", "5")
+	cfg := LoadReplicaConfigFromEnv()
+	assert.True(t, cfg.Enabled)
+	assert.Equal(t, "5s", cfg.SyncInterval.String())
+}
@@ -0,0 +1,243 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kiro2api/logger"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 请求签名相关请求头
+const (
+	signatureKeyIDHeader     = "X-Kiro-Key-Id"
+	signatureTimestampHeader = "X-Kiro-Timestamp"
+	signatureHeader          = "X-Kiro-Signature"
+)
+
+// clientKeyIDKey 上下文中记录调用方密钥ID（签名密钥ID，Bearer 认证时为 default）
+const clientKeyIDKey = "client_key_id"
+
+// defaultClientKeyID 使用 Bearer 令牌认证时的调用方密钥ID
+const defaultClientKeyID = "default"
+
+// internalIdentityKey 请求 context 中的内部调用方身份
+type internalIdentityKey struct{}
+
+// withInternalIdentity 以调用方密钥ID的身份在本机路由中派发请求（批量请求、模板试运行）：
+// 认证中间件直接采用该身份，不再校验 Bearer 令牌或签名，按密钥的限流、策略、租户账号范围与优先级照常生效；
+// 身份只保存在进程内的请求 context 中，无法通过网络请求伪造
+func withInternalIdentity(req *http.Request, keyID string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), internalIdentityKey{}, keyID))
+}
+
+// internalIdentity 读取本机派发请求的调用方密钥ID
+func internalIdentity(req *http.Request) (string, bool) {
+	keyID, ok := req.Context().Value(internalIdentityKey{}).(string)
+	return keyID, ok && keyID != ""
+}
+
+// validateClientKeyID 检查本机派发请求使用的调用方密钥ID：
+// default 仅在未强制签名（REQUEST_SIGNING_REQUIRED）时可用，其余须为已配置的签名密钥
+func validateClientKeyID(v *SignatureVerifier, keyID string) error {
+	if keyID == defaultClientKeyID {
+		if v != nil && v.required {
+			return fmt.Errorf("已强制请求签名，不能使用 %s 身份，请指定签名密钥ID", defaultClientKeyID)
+		}
+		return nil
+	}
+	if v == nil {
+		return fmt.Errorf("未知的调用方密钥: %s", keyID)
+	}
+	if _, ok := v.keys[keyID]; !ok {
+		return fmt.Errorf("未知的调用方密钥: %s", keyID)
+	}
+	return nil
+}
+
+// SigningKey 请求签名共享密钥
+type SigningKey struct {
+	ID     string `json:"id"`
+	Secret string `json:"secret"`
+}
+
+// SignatureVerifier HMAC请求签名校验器
+// 签名内容: timestamp + "\n" + METHOD + "\n" + RequestURI + "\n" + hex(sha256(body))
+// 签名算法: hex(HMAC-SHA256(secret, 签名内容))
+type SignatureVerifier struct {
+	keys     map[string][]byte
+	window   time.Duration // 允许的时间偏差（同时作为防重放窗口）
+	required bool          // 为 true 时 /v1 只接受签名请求
+
+	mu   sync.Mutex
+	seen map[string]time.Time // 窗口内已使用的签名 -> 过期时间
+}
+
+// NewSignatureVerifier 创建签名校验器
+func NewSignatureVerifier(keys []SigningKey, window time.Duration, required bool) (*SignatureVerifier, error) {
+	v := &SignatureVerifier{
+		keys:     make(map[string][]byte, len(keys)),
+		window:   window,
+		required: required,
+		seen:     make(map[string]time.Time),
+	}
+	for _, k := range keys {
+		if k.ID == "" || k.Secret == "" {
+			return nil, fmt.Errorf("签名密钥的id和secret不能为空")
+		}
+		if _, dup := v.keys[k.ID]; dup {
+			return nil, fmt.Errorf("签名密钥id重复: %s", k.ID)
+		}
+		v.keys[k.ID] = []byte(k.Secret)
+	}
+	if len(v.keys) == 0 {
+		return nil, fmt.Errorf("未配置签名密钥")
+	}
+	return v, nil
+}
+
+// LoadSignatureVerifierFromEnv 从环境变量加载签名配置，未配置密钥时返回 nil
+// - REQUEST_SIGNING_KEYS: "id1:secret1,id2:secret2"
+// - REQUEST_SIGNING_KEYS_FILE: JSON数组 [{"id":"...","secret":"..."}]
+// - REQUEST_SIGNING_WINDOW_SECONDS: 时间戳允许偏差（默认300）
+// - REQUEST_SIGNING_REQUIRED: true 时禁用 Bearer 令牌，只接受签名请求
+func LoadSignatureVerifierFromEnv() (*SignatureVerifier, error) {
+	var keys []SigningKey
+
+	if path := os.Getenv("REQUEST_SIGNING_KEYS_FILE"); path != "" {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取签名密钥文件失败: %w", err)
+		}
+		if err := json.Unmarshal(content, &keys); err != nil {
+			return nil, fmt.Errorf("解析签名密钥文件失败: %w", err)
+		}
+	}
+
+	for _, item := range strings.Split(os.Getenv("REQUEST_SIGNING_KEYS"), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		id, secret, ok := strings.Cut(item, ":")
+		if !ok {
+			return nil, fmt.Errorf("REQUEST_SIGNING_KEYS 格式无效，应为 id:secret")
+		}
+		keys = append(keys, SigningKey{ID: strings.TrimSpace(id), Secret: strings.TrimSpace(secret)})
+	}
+
+	if len(keys) == 0 {
+		return nil, nil
+	}
+
+	window := time.Duration(utils.GetEnvIntWithDefault("REQUEST_SIGNING_WINDOW_SECONDS", 300)) * time.Second
+	required := os.Getenv("REQUEST_SIGNING_REQUIRED") == "true"
+	return NewSignatureVerifier(keys, window, required)
+}
+
+// SignRequest 计算请求签名（供调用方与测试使用）
+func SignRequest(secret []byte, timestamp, method, requestURI string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "\n" + strings.ToUpper(method) + "\n" + requestURI + "\n" + hex.EncodeToString(bodyHash[:])))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// HasSignature 判断请求是否携带签名头
+func HasSignature(r *http.Request) bool {
+	return r.Header.Get(signatureHeader) != ""
+}
+
+// Verify 校验请求签名，成功返回密钥ID
+func (v *SignatureVerifier) Verify(r *http.Request, body []byte, now time.Time) (string, error) {
+	keyID := r.Header.Get(signatureKeyIDHeader)
+	timestamp := r.Header.Get(signatureTimestampHeader)
+	signature := strings.ToLower(r.Header.Get(signatureHeader))
+	if keyID == "" || timestamp == "" || signature == "" {
+		return "", fmt.Errorf("缺少签名请求头")
+	}
+
+	secret, ok := v.keys[keyID]
+	if !ok {
+		return "", fmt.Errorf("未知的签名密钥: %s", keyID)
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("无效的签名时间戳")
+	}
+	skew := now.Sub(time.Unix(ts, 0))
+	if skew > v.window || skew < -v.window {
+		return "", fmt.Errorf("签名时间戳超出允许范围")
+	}
+
+	expected := SignRequest(secret, timestamp, r.Method, r.URL.RequestURI(), body)
+	if !hmac.Equal([]byte(signature), []byte(expected)) {
+		return "", fmt.Errorf("签名不匹配")
+	}
+
+	if !v.markSeen(keyID+":"+signature, now) {
+		return "", fmt.Errorf("重复的签名请求")
+	}
+	return keyID, nil
+}
+
+// markSeen 记录窗口内使用过的签名，重复时返回 false
+func (v *SignatureVerifier) markSeen(key string, now time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for k, expiry := range v.seen {
+		if now.After(expiry) {
+			delete(v.seen, k)
+		}
+	}
+	if _, exists := v.seen[key]; exists {
+		return false
+	}
+	// 时间戳允许前后各偏差一个窗口，签名需保留两个窗口
+	v.seen[key] = now.Add(2 * v.window)
+	return true
+}
+
+// verifySignedRequest 读取请求体校验签名，并恢复请求体供后续处理
+func verifySignedRequest(c *gin.Context, verifier *SignatureVerifier) bool {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取请求体失败"})
+		return false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+	keyID, err := verifier.Verify(c.Request, body, time.Now())
+	if err != nil {
+		logger.Warn("请求签名校验失败",
+			logger.String("key_id", c.GetHeader(signatureKeyIDHeader)),
+			logger.String("ip", c.ClientIP()),
+			logger.Err(err))
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "401"})
+		return false
+	}
+
+	c.Set(clientKeyIDKey, keyID)
+	return true
+}
+
+// GetClientKeyID 从上下文读取调用方密钥ID（若不存在返回空串）
+func GetClientKeyID(c *gin.Context) string {
+	return c.GetString(clientKeyIDKey)
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSignedRequest(t *testing.T, keyID, secret string, ts time.Time, body string) *http.Request {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/v1/messages?beta=true", strings.NewReader(body))
+	timestamp := strconv.FormatInt(ts.Unix(), 10)
+	req.Header.Set(signatureKeyIDHeader, keyID)
+	req.Header.Set(signatureTimestampHeader, timestamp)
+	req.Header.Set(signatureHeader, SignRequest([]byte(secret), timestamp, "POST", "/v1/messages?beta=true", []byte(body)))
+	return req
+}
+
+func newSigningRouter(t *testing.T, required bool) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	verifier, err := NewSignatureVerifier([]SigningKey{{ID: "ci", Secret: "s3cret"}}, 5*time.Minute, required)
+	require.NoError(t, err)
+
+	router := gin.New()
+	router.Use(PathBasedAuthMiddlewareWithSigning("test-token-123", []string{"/v1"}, verifier))
+	router.POST("/v1/messages", func(c *gin.Context) {
+		body, _ := io.ReadAll(c.Request.Body)
+		c.JSON(http.StatusOK, gin.H{"key_id": GetClientKeyID(c), "body": string(body)})
+	})
+	return router
+}
+
+func TestRequestSigning_ValidSignature(t *testing.T) {
+	router := newSigningRouter(t, false)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newSignedRequest(t, "ci", "s3cret", time.Now(), `{"model":"x"}`))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"key_id":"ci"`)
+	// 校验后请求体需恢复给后续处理
+	assert.Contains(t, w.Body.String(), `{\"model\":\"x\"}`)
+}
+
+func TestRequestSigning_RejectsTamperedAndUnknown(t *testing.T) {
+	router := newSigningRouter(t, false)
+
+	tampered := newSignedRequest(t, "ci", "s3cret", time.Now(), `{"model":"x"}`)
+	tampered.Body = io.NopCloser(strings.NewReader(`{"model":"y"}`))
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, tampered)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, newSignedRequest(t, "other", "s3cret", time.Now(), `{}`))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, newSignedRequest(t, "ci", "wrong", time.Now(), `{}`))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRequestSigning_ReplayWindow(t *testing.T) {
+	router := newSigningRouter(t, false)
+
+	// 超出时间窗口
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, newSignedRequest(t, "ci", "s3cret", time.Now().Add(-10*time.Minute), `{}`))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// 窗口内重复的签名被拒绝
+	ts := time.Now()
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, newSignedRequest(t, "ci", "s3cret", ts, `{"n":1}`))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, newSignedRequest(t, "ci", "s3cret", ts, `{"n":1}`))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestRequestSigning_BearerFallbackAndRequired(t *testing.T) {
+	newBearer := func() *http.Request {
+		req := httptest.NewRequest("POST", "/v1/messages", strings.NewReader(`{}`))
+		req.Header.Set("Authorization", "Bearer test-token-123")
+		return req
+	}
+
+	w := httptest.NewRecorder()
+	newSigningRouter(t, false).ServeHTTP(w, newBearer())
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"key_id":"default"`)
+
+	w = httptest.NewRecorder()
+	newSigningRouter(t, true).ServeHTTP(w, newBearer())
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestLoadSignatureVerifierFromEnv(t *testing.T) {
+	t.Setenv("REQUEST_SIGNING_KEYS", "")
+	t.Setenv("REQUEST_SIGNING_KEYS_FILE", "")
+	verifier, err := LoadSignatureVerifierFromEnv()
+	require.NoError(t, err)
+	assert.Nil(t, verifier)
+
+	t.Setenv("REQUEST_SIGNING_KEYS", "a:1, b:2")
+	t.Setenv("REQUEST_SIGNING_WINDOW_SECONDS", "60")
+	verifier, err = LoadSignatureVerifierFromEnv()
+	require.NoError(t, err)
+	require.NotNil(t, verifier)
+	assert.Len(t, verifier.keys, 2)
+	assert.Equal(t, time.Minute, verifier.window)
+
+	t.Setenv("REQUEST_SIGNING_KEYS", "missing-secret")
+	_, err = LoadSignatureVerifierFromEnv()
+	assert.Error(t, err)
+}
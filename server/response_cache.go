@@ -0,0 +1,264 @@
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"kiro2api/logger"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 响应缓存相关请求头
+const (
+	cacheControlHeader = "X-Cache-Control" // 请求头：cache / max-age=<秒> / no-cache / no-store
+	cacheStatusHeader  = "X-Cache"         // 响应头：HIT / MISS
+)
+
+// ResponseCache 非流式响应缓存（LRU + TTL）
+// 缓存键为调用方密钥、端点与规范化请求（模型、消息、参数）的哈希；客户端需通过 X-Cache-Control 显式启用
+type ResponseCache struct {
+	maxEntries   int
+	ttl          time.Duration // 默认也是最长的缓存时间
+	maxBodyBytes int
+
+	mu    sync.Mutex
+	order *list.List // 最近使用的在前
+	items map[string]*list.Element
+	now   func() time.Time
+}
+
+type cachedResponse struct {
+	key         string
+	contentType string
+	body        []byte
+	storedAt    time.Time
+	expiresAt   time.Time
+}
+
+// LoadResponseCacheFromEnv 从环境变量加载响应缓存，未启用时返回 nil
+// - RESPONSE_CACHE_MAX_ENTRIES: 最大缓存条数（默认0，关闭）
+// - RESPONSE_CACHE_TTL_SECONDS: 缓存时间，也是 max-age 的上限（默认300）
+// - RESPONSE_CACHE_MAX_BODY_BYTES: 单条响应的最大字节数，超过时不缓存（默认1MB）
+func LoadResponseCacheFromEnv() (*ResponseCache, error) {
+	maxEntries := utils.GetEnvIntWithDefault("RESPONSE_CACHE_MAX_ENTRIES", 0)
+	if maxEntries < 0 {
+		return nil, fmt.Errorf("RESPONSE_CACHE_MAX_ENTRIES 不能为负数")
+	}
+	if maxEntries == 0 {
+		return nil, nil
+	}
+	ttlSeconds := utils.GetEnvIntWithDefault("RESPONSE_CACHE_TTL_SECONDS", 300)
+	if ttlSeconds <= 0 {
+		return nil, fmt.Errorf("RESPONSE_CACHE_TTL_SECONDS 必须大于0")
+	}
+	maxBodyBytes := utils.GetEnvIntWithDefault("RESPONSE_CACHE_MAX_BODY_BYTES", 1<<20)
+	if maxBodyBytes <= 0 {
+		return nil, fmt.Errorf("RESPONSE_CACHE_MAX_BODY_BYTES 必须大于0")
+	}
+	return NewResponseCache(maxEntries, time.Duration(ttlSeconds)*time.Second, maxBodyBytes), nil
+}
+
+// NewResponseCache 创建响应缓存
+func NewResponseCache(maxEntries int, ttl time.Duration, maxBodyBytes int) *ResponseCache {
+	return &ResponseCache{
+		maxEntries:   maxEntries,
+		ttl:          ttl,
+		maxBodyBytes: maxBodyBytes,
+		order:        list.New(),
+		items:        make(map[string]*list.Element),
+		now:          time.Now,
+	}
+}
+
+// Len 当前缓存条数（含尚未清理的过期条目）
+func (rc *ResponseCache) Len() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.order.Len()
+}
+
+func (rc *ResponseCache) get(key string) (*cachedResponse, bool) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	elem, ok := rc.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cachedResponse)
+	if !rc.now().Before(entry.expiresAt) {
+		rc.order.Remove(elem)
+		delete(rc.items, key)
+		return nil, false
+	}
+	rc.order.MoveToFront(elem)
+	return entry, true
+}
+
+func (rc *ResponseCache) set(key, contentType string, body []byte, ttl time.Duration) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	now := rc.now()
+	entry := &cachedResponse{key: key, contentType: contentType, body: body, storedAt: now, expiresAt: now.Add(ttl)}
+	if elem, ok := rc.items[key]; ok {
+		elem.Value = entry
+		rc.order.MoveToFront(elem)
+		return
+	}
+	rc.items[key] = rc.order.PushFront(entry)
+	for rc.order.Len() > rc.maxEntries {
+		oldest := rc.order.Back()
+		rc.order.Remove(oldest)
+		delete(rc.items, oldest.Value.(*cachedResponse).key)
+	}
+}
+
+// cacheDirective 解析后的 X-Cache-Control 请求头
+type cacheDirective struct {
+	lookup bool          // 命中时直接返回缓存
+	maxAge time.Duration // 可接受的最大缓存时长，0 表示不限制
+	store  bool          // 成功响应写入缓存
+	ttl    time.Duration // 本次写入的缓存时间
+}
+
+// parseCacheDirective 解析 X-Cache-Control（逗号分隔，不区分大小写）
+// - cache: 读取并写入缓存，使用默认缓存时间
+// - max-age=<秒>: 只接受不超过该时长的缓存，写入时的缓存时间取其与默认值的较小者；max-age=0 等同 no-store
+// - no-cache: 跳过读取，用新响应刷新缓存
+// - no-store: 不读不写（优先级最高）
+// 未设置请求头时不使用缓存
+func parseCacheDirective(header string, maxTTL time.Duration) cacheDirective {
+	var d cacheDirective
+	noCache, noStore := false, false
+	for _, part := range strings.Split(header, ",") {
+		part = strings.ToLower(strings.TrimSpace(part))
+		switch {
+		case part == "cache":
+			d.lookup, d.store, d.ttl = true, true, maxTTL
+		case strings.HasPrefix(part, "max-age="):
+			seconds, err := strconv.Atoi(strings.TrimPrefix(part, "max-age="))
+			if err != nil || seconds < 0 {
+				continue
+			}
+			if seconds == 0 {
+				noStore = true
+				continue
+			}
+			d.lookup, d.store = true, true
+			d.maxAge = time.Duration(seconds) * time.Second
+			d.ttl = min(d.maxAge, maxTTL)
+		case part == "no-cache":
+			noCache = true
+		case part == "no-store":
+			noStore = true
+		}
+	}
+	if noCache {
+		d.lookup, d.maxAge, d.store = false, 0, true
+		if d.ttl == 0 {
+			d.ttl = maxTTL
+		}
+	}
+	if noStore {
+		return cacheDirective{}
+	}
+	return d
+}
+
+// responseCacheKey 计算缓存键：调用方密钥、端点与规范化请求的 SHA-256
+// 请求在应用模型默认参数与系统提示策略之后序列化，字段顺序固定
+func responseCacheKey(endpoint, clientKeyID string, req any) (string, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("序列化请求失败: %w", err)
+	}
+	h := sha256.New()
+	h.Write([]byte(endpoint))
+	h.Write([]byte{0})
+	h.Write([]byte(clientKeyID))
+	h.Write([]byte{0})
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// cacheCaptureWriter 记录下发的响应体，超过上限后停止记录
+type cacheCaptureWriter struct {
+	gin.ResponseWriter
+	buf      bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *cacheCaptureWriter) Write(p []byte) (int, error) {
+	w.capture(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *cacheCaptureWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *cacheCaptureWriter) capture(p []byte) {
+	if w.overflow {
+		return
+	}
+	if w.buf.Len()+len(p) > w.limit {
+		w.overflow = true
+		w.buf.Reset()
+		return
+	}
+	w.buf.Write(p)
+}
+
+// serveWithResponseCache 按 X-Cache-Control 读取或写入缓存，未命中时调用 handle 处理请求
+// 只有 200 响应会被缓存；rc 为 nil（未启用）时直接处理
+func serveWithResponseCache(c *gin.Context, rc *ResponseCache, endpoint string, req any, handle func()) {
+	if rc == nil {
+		handle()
+		return
+	}
+	directive := parseCacheDirective(c.GetHeader(cacheControlHeader), rc.ttl)
+	if !directive.lookup && !directive.store {
+		handle()
+		return
+	}
+	key, err := responseCacheKey(endpoint, GetClientKeyID(c), req)
+	if err != nil {
+		logger.Warn("计算响应缓存键失败，跳过缓存", addReqFields(c, logger.Err(err))...)
+		handle()
+		return
+	}
+
+	if directive.lookup {
+		if entry, ok := rc.get(key); ok && (directive.maxAge == 0 || rc.now().Sub(entry.storedAt) <= directive.maxAge) {
+			logger.Debug("响应缓存命中", addReqFields(c, logger.String("endpoint", endpoint))...)
+			c.Header(cacheStatusHeader, "HIT")
+			c.Header("Age", strconv.Itoa(int(rc.now().Sub(entry.storedAt).Seconds())))
+			c.Data(http.StatusOK, entry.contentType, entry.body)
+			return
+		}
+	}
+
+	c.Header(cacheStatusHeader, "MISS")
+	writer := &cacheCaptureWriter{ResponseWriter: c.Writer, limit: rc.maxBodyBytes}
+	c.Writer = writer
+	handle()
+	c.Writer = writer.ResponseWriter
+
+	if directive.store && writer.Status() == http.StatusOK && !writer.overflow && writer.buf.Len() > 0 {
+		rc.set(key, writer.Header().Get("Content-Type"), writer.buf.Bytes(), directive.ttl)
+	}
+}
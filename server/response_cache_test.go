@@ -0,0 +1,145 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCacheDirective(t *testing.T) {
+	maxTTL := 5 * time.Minute
+	tests := []struct {
+		header string
+		want   cacheDirective
+	}{
+		{"", cacheDirective{}},
+		{"cache", cacheDirective{lookup: true, store: true, ttl: maxTTL}},
+		{"Max-Age=60", cacheDirective{lookup: true, maxAge: time.Minute, store: true, ttl: time.Minute}},
+		{"max-age=3600", cacheDirective{lookup: true, maxAge: time.Hour, store: true, ttl: maxTTL}},
+		{"max-age=0", cacheDirective{}},
+		{"no-cache", cacheDirective{store: true, ttl: maxTTL}},
+		{"no-cache, max-age=30", cacheDirective{store: true, ttl: 30 * time.Second}},
+		{"cache, no-store", cacheDirective{}},
+		{"max-age=abc", cacheDirective{}},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, parseCacheDirective(tt.header, maxTTL), tt.header)
+	}
+}
+
+func TestResponseCache_LRUAndTTL(t *testing.T) {
+	rc := NewResponseCache(2, time.Minute, 1024)
+	now := time.Now()
+	rc.now = func() time.Time { return now }
+
+	rc.set("a", "application/json", []byte("A"), time.Minute)
+	rc.set("b", "application/json", []byte("B"), time.Minute)
+	_, ok := rc.get("a") // a 变为最近使用
+	require.True(t, ok)
+	rc.set("c", "application/json", []byte("C"), time.Minute)
+
+	_, ok = rc.get("b")
+	assert.False(t, ok, "最久未使用的条目被淘汰")
+	assert.Equal(t, 2, rc.Len())
+
+	now = now.Add(time.Minute)
+	_, ok = rc.get("a")
+	assert.False(t, ok, "过期条目不返回")
+	assert.Equal(t, 1, rc.Len())
+}
+
+func TestServeWithResponseCache(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	rc := NewResponseCache(10, time.Minute, 1024)
+	calls := 0
+	status := http.StatusOK
+
+	r := gin.New()
+	r.POST("/v1/messages", func(c *gin.Context) {
+		c.Set(clientKeyIDKey, c.GetHeader("X-Test-Key"))
+		req := map[string]any{"model": "claude-sonnet-4-5", "prompt": c.Query("p")}
+		serveWithResponseCache(c, rc, "messages", req, func() {
+			calls++
+			c.JSON(status, gin.H{"call": calls})
+		})
+	})
+	send := func(prompt, key, cacheControl string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/v1/messages?p="+prompt, nil)
+		req.Header.Set("X-Test-Key", key)
+		if cacheControl != "" {
+			req.Header.Set(cacheControlHeader, cacheControl)
+		}
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// 未设置请求头时不使用缓存
+	send("hi", "k1", "")
+	send("hi", "k1", "")
+	assert.Equal(t, 2, calls)
+
+	w := send("hi", "k1", "cache")
+	assert.Equal(t, "MISS", w.Header().Get(cacheStatusHeader))
+	w = send("hi", "k1", "cache")
+	assert.Equal(t, "HIT", w.Header().Get(cacheStatusHeader))
+	assert.JSONEq(t, `{"call":3}`, w.Body.String())
+	assert.Contains(t, w.Header().Get("Content-Type"), "application/json")
+	assert.Equal(t, 3, calls)
+
+	// 不同请求与不同调用方密钥不共享缓存
+	send("other", "k1", "cache")
+	send("hi", "k2", "cache")
+	assert.Equal(t, 5, calls)
+
+	// no-cache 跳过读取并刷新缓存
+	send("hi", "k1", "no-cache")
+	w = send("hi", "k1", "cache")
+	assert.JSONEq(t, `{"call":6}`, w.Body.String())
+
+	// max-age 拒绝过旧的缓存
+	rc.now = func() time.Time { return time.Now().Add(30 * time.Second) }
+	w = send("hi", "k1", "max-age=10")
+	assert.Equal(t, "MISS", w.Header().Get(cacheStatusHeader))
+	w = send("hi", "k1", "max-age=60")
+	assert.Equal(t, "HIT", w.Header().Get(cacheStatusHeader))
+	assert.Equal(t, "0", w.Header().Get("Age"))
+	rc.now = time.Now
+
+	// 错误响应不缓存
+	status = http.StatusBadGateway
+	send("fail", "k1", "cache")
+	status = http.StatusOK
+	w = send("fail", "k1", "cache")
+	assert.Equal(t, "MISS", w.Header().Get(cacheStatusHeader))
+	assert.Equal(t, 9, calls)
+
+	// 未启用缓存时直接处理
+	serveWithResponseCache(nil, nil, "messages", nil, func() { calls++ })
+	assert.Equal(t, 10, calls)
+}
+
+func TestLoadResponseCacheFromEnv(t *testing.T) {
+	t.Setenv("RESPONSE_CACHE_MAX_ENTRIES", "")
+	rc, err := LoadResponseCacheFromEnv()
+	require.NoError(t, err)
+	assert.Nil(t, rc)
+
+	t.Setenv("RESPONSE_CACHE_MAX_ENTRIES", "100")
+	t.Setenv("RESPONSE_CACHE_TTL_SECONDS", "60")
+	rc, err = LoadResponseCacheFromEnv()
+	require.NoError(t, err)
+	require.NotNil(t, rc)
+	assert.Equal(t, 100, rc.maxEntries)
+	assert.Equal(t, time.Minute, rc.ttl)
+	assert.Equal(t, 1<<20, rc.maxBodyBytes)
+
+	t.Setenv("RESPONSE_CACHE_TTL_SECONDS", "0")
+	_, err = LoadResponseCacheFromEnv()
+	assert.Error(t, err)
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubCompletions 依次以给定文本作为上游回复，返回收到的请求
+func stubCompletions(t *testing.T, replies ...string) *[]types.AnthropicRequest {
+	t.Helper()
+	var received []types.AnthropicRequest
+	original := execCWRequest
+	t.Cleanup(func() { execCWRequest = original })
+	execCWRequest = func(c *gin.Context, req types.AnthropicRequest, _ types.TokenInfo, _ bool) (*http.Response, error) {
+		require.Less(t, len(received), len(replies), "上游调用次数超出预期")
+		reply := replies[len(received)]
+		received = append(received, req)
+		payload, _ := json.Marshal(map[string]string{"content": reply})
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/vnd.amazon.eventstream"}},
+			Body:       io.NopCloser(bytes.NewReader(encodeEventStreamFrame("assistantResponseEvent", payload))),
+		}, nil
+	}
+	return &received
+}
+
+func runOpenAINonStream(t *testing.T, format *types.OpenAIResponseFormat) *httptest.ResponseRecorder {
+	t.Helper()
+	req := types.AnthropicRequest{
+		Model:     "claude-sonnet-4-20250514",
+		MaxTokens: 100,
+		Messages:  []types.AnthropicRequestMessage{{Role: "user", Content: "给我一个人"}},
+	}
+	return runOpenAINonStreamRequest(t, req, format)
+}
+
+func runOpenAINonStreamRequest(t *testing.T, req types.AnthropicRequest, format *types.OpenAIResponseFormat) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	handleOpenAINonStreamRequest(c, req, types.TokenInfo{AccessToken: "t"}, format)
+	return w
+}
+
+func schemaFormat(strict bool) *types.OpenAIResponseFormat {
+	return &types.OpenAIResponseFormat{
+		Type: "json_schema",
+		JSONSchema: &types.OpenAIJSONSchema{
+			Name:   "person",
+			Strict: &strict,
+			Schema: map[string]any{
+				"type":     "object",
+				"required": []any{"name"},
+				"properties": map[string]any{
+					"name": map[string]any{"type": "string"},
+				},
+			},
+		},
+	}
+}
+
+func TestOpenAINonStream_ResponseFormatRepair(t *testing.T) {
+	received := stubCompletions(t, `{"nickname":"x"}`, "```json\n{\"name\":\"张三\"}\n```")
+
+	w := runOpenAINonStream(t, schemaFormat(true))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp types.OpenAIResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, `{"name":"张三"}`, resp.Choices[0].Message.Content, "返回去除代码块后的JSON")
+
+	require.Len(t, *received, 2)
+	repair := (*received)[1]
+	require.Len(t, repair.Messages, 3)
+	assert.Equal(t, `{"nickname":"x"}`, repair.Messages[1].Content)
+	assert.Contains(t, repair.Messages[2].Content, `缺少必填字段 "name"`)
+}
+
+func TestOpenAINonStream_ResponseFormatStrictViolation(t *testing.T) {
+	original := responseFormatRepairAttempts
+	responseFormatRepairAttempts = 1
+	t.Cleanup(func() { responseFormatRepairAttempts = original })
+	stubCompletions(t, "不是JSON", "仍然不是JSON")
+
+	w := runOpenAINonStream(t, schemaFormat(true))
+
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "response_format_violation")
+}
+
+func TestOpenAINonStream_ResponseFormatNonStrictReturnsLastOutput(t *testing.T) {
+	original := responseFormatRepairAttempts
+	t.Setenv("RESPONSE_FORMAT_REPAIR_ATTEMPTS", "0")
+	responseFormatRepairAttempts = loadResponseFormatRepairAttemptsFromEnv()
+	t.Cleanup(func() { responseFormatRepairAttempts = original })
+	received := stubCompletions(t, "不是JSON")
+
+	w := runOpenAINonStream(t, schemaFormat(false))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, *received, 1, "重试次数为0时不发起修复请求")
+	assert.Contains(t, w.Body.String(), "不是JSON")
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"kiro2api/auth"
+	"kiro2api/logger"
+	"kiro2api/types"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tokenSourceKey 上下文中保存的token来源，供上游失败时切换token重试
+const tokenSourceKey = "token_source"
+
+// tokenFailoverSource 支持失败切换的token来源（AuthService 实现）
+type tokenFailoverSource interface {
+	GetTokenForModel(model string) (types.TokenInfo, error)
+	ReportTokenFailure(configID string, status int)
+}
+
+// RetryPolicy 上游账号级错误的重试策略
+type RetryPolicy struct {
+	MaxRetries int          // 最多切换token重试的次数，0表示不重试
+	Statuses   map[int]bool // 触发重试的上游状态码
+}
+
+// defaultRetryStatuses 默认触发切换重试的状态码：token失效/无权限/限流
+var defaultRetryStatuses = []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests}
+
+// LoadRetryPolicyFromEnv 从环境变量加载重试策略
+// - UPSTREAM_RETRY_MAX: 最多切换token重试次数（默认2，0关闭）
+// - UPSTREAM_RETRY_STATUSES: 触发重试的状态码，逗号分隔（默认 401,403,429）
+func LoadRetryPolicyFromEnv() RetryPolicy {
+	policy := RetryPolicy{
+		MaxRetries: utils.GetEnvIntWithDefault("UPSTREAM_RETRY_MAX", 2),
+		Statuses:   make(map[int]bool),
+	}
+	for _, item := range strings.Split(utils.GetEnvWithDefault("UPSTREAM_RETRY_STATUSES", ""), ",") {
+		if status, err := strconv.Atoi(strings.TrimSpace(item)); err == nil && status > 0 {
+			policy.Statuses[status] = true
+		}
+	}
+	if len(policy.Statuses) == 0 {
+		policy.Statuses = defaultRetryPolicy().Statuses
+	}
+	return policy
+}
+
+// defaultRetryPolicy 默认重试策略：最多切换2次，状态码见 defaultRetryStatuses
+func defaultRetryPolicy() RetryPolicy {
+	policy := RetryPolicy{MaxRetries: 2, Statuses: make(map[int]bool, len(defaultRetryStatuses))}
+	for _, status := range defaultRetryStatuses {
+		policy.Statuses[status] = true
+	}
+	return policy
+}
+
+// upstreamRetryPolicy 全局上游重试策略，StartServer 在加载配置后按环境变量重新加载
+var upstreamRetryPolicy = defaultRetryPolicy()
+
+// setTokenSource 记录本次请求的token来源，启用失败切换
+func setTokenSource(c *gin.Context, source any) {
+	if s, ok := source.(tokenFailoverSource); ok {
+		c.Set(tokenSourceKey, s)
+	}
+}
+
+// nextRetryToken 判断是否应切换token重试，是则上报当前token失败并返回下一个token
+// 上游故障期间（多账号同时异常）暂停重试，避免放大上游压力
+func nextRetryToken(c *gin.Context, current types.TokenInfo, status, attempt int) (types.TokenInfo, bool) {
+	if attempt >= upstreamRetryPolicy.MaxRetries || !upstreamRetryPolicy.Statuses[status] {
+		return types.TokenInfo{}, false
+	}
+	value, exists := c.Get(tokenSourceKey)
+	if !exists {
+		return types.TokenInfo{}, false
+	}
+	source := value.(tokenFailoverSource)
+
+	if upstreamIncidents.InIncident() {
+		logger.Warn("上游故障期间暂停切换token重试", addReqFields(c, logger.Int("status", status))...)
+		return types.TokenInfo{}, false
+	}
+
+	source.ReportTokenFailure(current.ConfigID, status)
+	next, err := source.GetTokenForModel(c.GetString(requestModelKey))
+	if err != nil {
+		logger.Warn("无可切换的token，放弃重试",
+			addReqFields(c,
+				logger.Int("status", status),
+				logger.Err(err),
+			)...)
+		return types.TokenInfo{}, false
+	}
+	// 选择时预留的名额登记到请求，请求结束时未认领的预留统一取消
+	holdSlotLease(c, next.SlotLease)
+	if next.ConfigID == current.ConfigID && next.AccessToken == current.AccessToken {
+		auth.AccountSlots.Cancel(next.SlotLease)
+		return types.TokenInfo{}, false
+	}
+
+	rememberStickyToken(c, "", next.ConfigID)
+
+	logger.Info("上游拒绝token，切换token重试",
+		addReqFields(c,
+			logger.Int("status", status),
+			logger.Int("attempt", attempt+1),
+			logger.String("from_config", current.ConfigID),
+			logger.String("to_config", next.ConfigID),
+		)...)
+	return next, true
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kiro2api/auth"
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTokenSource 按顺序返回token并记录上报的失败
+type fakeTokenSource struct {
+	tokens   []types.TokenInfo
+	reported []string
+	models   []string
+}
+
+func (f *fakeTokenSource) GetTokenForModel(model string) (types.TokenInfo, error) {
+	f.models = append(f.models, model)
+	if len(f.tokens) == 0 {
+		return types.TokenInfo{}, fmt.Errorf("没有可用的token")
+	}
+	next := f.tokens[0]
+	f.tokens = f.tokens[1:]
+	return next, nil
+}
+
+func (f *fakeTokenSource) ReportTokenFailure(configID string, status int) {
+	f.reported = append(f.reported, fmt.Sprintf("%s:%d", configID, status))
+}
+
+func withRetryPolicy(t *testing.T, policy RetryPolicy) {
+	original := upstreamRetryPolicy
+	upstreamRetryPolicy = policy
+	t.Cleanup(func() { upstreamRetryPolicy = original })
+}
+
+func TestNextRetryToken_FailsOverOnAccountErrors(t *testing.T) {
+	withRetryPolicy(t, RetryPolicy{MaxRetries: 2, Statuses: map[int]bool{401: true, 403: true, 429: true}})
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	source := &fakeTokenSource{tokens: []types.TokenInfo{{ConfigID: "b", AccessToken: "tb"}, {ConfigID: "c", AccessToken: "tc"}}}
+	setTokenSource(c, source)
+
+	current := types.TokenInfo{ConfigID: "a", AccessToken: "ta"}
+	next, ok := nextRetryToken(c, current, http.StatusTooManyRequests, 0)
+	assert.True(t, ok)
+	assert.Equal(t, "b", next.ConfigID)
+
+	next, ok = nextRetryToken(c, next, http.StatusForbidden, 1)
+	assert.True(t, ok)
+	assert.Equal(t, "c", next.ConfigID)
+	assert.Equal(t, []string{"a:429", "b:403"}, source.reported)
+
+	// 达到最大重试次数
+	_, ok = nextRetryToken(c, next, http.StatusUnauthorized, 2)
+	assert.False(t, ok)
+}
+
+func TestNextRetryToken_NoRetry(t *testing.T) {
+	withRetryPolicy(t, RetryPolicy{MaxRetries: 2, Statuses: map[int]bool{429: true}})
+	current := types.TokenInfo{ConfigID: "a", AccessToken: "ta"}
+
+	// 未记录token来源时不重试
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	_, ok := nextRetryToken(c, current, http.StatusTooManyRequests, 0)
+	assert.False(t, ok)
+
+	source := &fakeTokenSource{}
+	setTokenSource(c, source)
+
+	// 非重试状态码不上报也不切换
+	_, ok = nextRetryToken(c, current, http.StatusBadRequest, 0)
+	assert.False(t, ok)
+	assert.Empty(t, source.reported)
+
+	// 无可切换的token
+	_, ok = nextRetryToken(c, current, http.StatusTooManyRequests, 0)
+	assert.False(t, ok)
+	assert.Equal(t, []string{"a:429"}, source.reported)
+
+	// 返回同一个token时不重试
+	source.tokens = []types.TokenInfo{current}
+	_, ok = nextRetryToken(c, current, http.StatusTooManyRequests, 0)
+	assert.False(t, ok)
+}
+
+func TestNextRetryToken_ReleasesReservedSlot(t *testing.T) {
+	withRetryPolicy(t, RetryPolicy{MaxRetries: 2, Statuses: map[int]bool{429: true}})
+	original := auth.AccountSlots
+	auth.AccountSlots = auth.NewSlotCounter()
+	t.Cleanup(func() { auth.AccountSlots = original })
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	current := types.TokenInfo{ConfigID: "a", AccessToken: "ta"}
+
+	// 唯一可用账号被重新选中：选择时预留的名额应立即归还
+	lease, ok := auth.AccountSlots.Reserve("a", 1)
+	require.True(t, ok)
+	same := current
+	same.SlotLease = lease
+	setTokenSource(c, &fakeTokenSource{tokens: []types.TokenInfo{same}})
+	_, ok = nextRetryToken(c, current, http.StatusTooManyRequests, 0)
+	assert.False(t, ok)
+	assert.Equal(t, 0, auth.AccountSlots.InFlight("a"))
+
+	// 切换到其他账号时预留登记到请求，请求结束时未认领的预留被取消
+	lease, ok = auth.AccountSlots.Reserve("b", 1)
+	require.True(t, ok)
+	setTokenSource(c, &fakeTokenSource{tokens: []types.TokenInfo{{ConfigID: "b", AccessToken: "tb", SlotLease: lease}}})
+	_, ok = nextRetryToken(c, current, http.StatusTooManyRequests, 0)
+	assert.True(t, ok)
+	assert.Equal(t, 1, auth.AccountSlots.InFlight("b"))
+	cancelSlotLeases(c)
+	assert.Equal(t, 0, auth.AccountSlots.InFlight("b"))
+}
+
+func TestLoadRetryPolicyFromEnv(t *testing.T) {
+	t.Setenv("UPSTREAM_RETRY_MAX", "")
+	t.Setenv("UPSTREAM_RETRY_STATUSES", "")
+	policy := LoadRetryPolicyFromEnv()
+	assert.Equal(t, 2, policy.MaxRetries)
+	assert.Equal(t, map[int]bool{401: true, 403: true, 429: true}, policy.Statuses)
+
+	t.Setenv("UPSTREAM_RETRY_MAX", "0")
+	t.Setenv("UPSTREAM_RETRY_STATUSES", "429, 503,x")
+	policy = LoadRetryPolicyFromEnv()
+	assert.Equal(t, 0, policy.MaxRetries)
+	assert.Equal(t, map[int]bool{429: true, 503: true}, policy.Statuses)
+}
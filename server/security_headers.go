@@ -0,0 +1,132 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// defaultContentSecurityPolicy Dashboard 页面的默认 CSP
+// Dashboard 使用内联事件处理器与 style 属性，script-src/style-src 需要 'unsafe-inline'；其余资源只允许同源
+const defaultContentSecurityPolicy = "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; " +
+	"img-src 'self' data:; connect-src 'self'; object-src 'none'; base-uri 'self'; form-action 'self'; frame-ancestors 'none'"
+
+// defaultSecurityHeaderOverrides SSE 端点的默认覆盖：事件流不是文档，不需要 CSP 与防嵌入头
+var defaultSecurityHeaderOverrides = map[string]map[string]string{
+	"/api/logs/stream": {"Content-Security-Policy": "", "X-Frame-Options": ""},
+}
+
+// SecurityHeadersConfig 安全响应头配置，值为空的头不设置
+type SecurityHeadersConfig struct {
+	ContentSecurityPolicy string                       // Dashboard 与管理接口的 CSP（/v1 不设置）
+	HSTSMaxAge            time.Duration                // HTTPS 请求的 Strict-Transport-Security max-age，0 不设置
+	HSTSIncludeSubdomains bool                         // HSTS 是否包含子域名
+	ReferrerPolicy        string                       // Referrer-Policy
+	FrameOptions          string                       // X-Frame-Options
+	Overrides             map[string]map[string]string // 路径前缀 → 覆盖的响应头（值为空表示不设置），最长前缀优先
+}
+
+// LoadSecurityHeadersConfigFromEnv 从环境变量加载安全响应头配置
+// - SECURITY_CSP: Dashboard 与管理接口的 Content-Security-Policy（默认只允许同源资源，off 关闭）
+// - SECURITY_HSTS_MAX_AGE_SECONDS: HTTPS 请求的 HSTS 有效期（默认31536000，0 关闭）
+// - SECURITY_HSTS_INCLUDE_SUBDOMAINS: HSTS 是否包含子域名（默认false）
+// - SECURITY_REFERRER_POLICY: Referrer-Policy（默认 same-origin，off 关闭）
+// - SECURITY_FRAME_OPTIONS: X-Frame-Options（默认 DENY，off 关闭）
+// - SECURITY_HEADER_OVERRIDES: 按路径前缀覆盖的 JSON，如 {"/api/logs/stream": {"Content-Security-Policy": ""}}，与默认的 SSE 覆盖合并
+func LoadSecurityHeadersConfigFromEnv() (SecurityHeadersConfig, error) {
+	seconds := utils.GetEnvIntWithDefault("SECURITY_HSTS_MAX_AGE_SECONDS", 31536000)
+	if seconds < 0 {
+		return SecurityHeadersConfig{}, fmt.Errorf("SECURITY_HSTS_MAX_AGE_SECONDS 不能为负数")
+	}
+	cfg := SecurityHeadersConfig{
+		ContentSecurityPolicy: headerSetting("SECURITY_CSP", defaultContentSecurityPolicy),
+		HSTSMaxAge:            time.Duration(seconds) * time.Second,
+		HSTSIncludeSubdomains: utils.GetEnvBoolWithDefault("SECURITY_HSTS_INCLUDE_SUBDOMAINS", false),
+		ReferrerPolicy:        headerSetting("SECURITY_REFERRER_POLICY", "same-origin"),
+		FrameOptions:          headerSetting("SECURITY_FRAME_OPTIONS", "DENY"),
+		Overrides:             make(map[string]map[string]string),
+	}
+	for prefix, headers := range defaultSecurityHeaderOverrides {
+		cfg.Overrides[prefix] = headers
+	}
+
+	if raw := strings.TrimSpace(os.Getenv("SECURITY_HEADER_OVERRIDES")); raw != "" {
+		var overrides map[string]map[string]string
+		if err := json.Unmarshal([]byte(raw), &overrides); err != nil {
+			return SecurityHeadersConfig{}, fmt.Errorf("SECURITY_HEADER_OVERRIDES 不是有效的 JSON: %w", err)
+		}
+		for prefix, headers := range overrides {
+			if !strings.HasPrefix(prefix, "/") {
+				return SecurityHeadersConfig{}, fmt.Errorf("SECURITY_HEADER_OVERRIDES 的路径前缀必须以 / 开头: %s", prefix)
+			}
+			cfg.Overrides[prefix] = headers
+		}
+	}
+	return cfg, nil
+}
+
+// headerSetting 读取响应头配置，off 表示不设置
+func headerSetting(key, def string) string {
+	value := strings.TrimSpace(utils.GetEnvWithDefault(key, def))
+	if strings.EqualFold(value, "off") {
+		return ""
+	}
+	return value
+}
+
+// headersFor 计算路径对应的安全响应头
+func (cfg SecurityHeadersConfig) headersFor(c *gin.Context) map[string]string {
+	path := c.Request.URL.Path
+	headers := map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"Referrer-Policy":        cfg.ReferrerPolicy,
+		"X-Frame-Options":        cfg.FrameOptions,
+	}
+	// /v1 是供外部客户端调用的 JSON/SSE 接口，CSP 只用于 Dashboard 与管理接口
+	if !strings.HasPrefix(path, "/v1") {
+		headers["Content-Security-Policy"] = cfg.ContentSecurityPolicy
+	}
+	if cfg.HSTSMaxAge > 0 && isSecureRequest(c) {
+		hsts := "max-age=" + strconv.Itoa(int(cfg.HSTSMaxAge/time.Second))
+		if cfg.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		headers["Strict-Transport-Security"] = hsts
+	}
+
+	// 按前缀从短到长应用覆盖，最长前缀最后生效
+	prefixes := make([]string, 0, len(cfg.Overrides))
+	for prefix := range cfg.Overrides {
+		if strings.HasPrefix(path, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) < len(prefixes[j]) })
+	for _, prefix := range prefixes {
+		for name, value := range cfg.Overrides[prefix] {
+			headers[http.CanonicalHeaderKey(name)] = value
+		}
+	}
+	return headers
+}
+
+// SecurityHeadersMiddleware 为响应添加安全头（CSP、HSTS、X-Content-Type-Options、Referrer-Policy、X-Frame-Options）
+func SecurityHeadersMiddleware(cfg SecurityHeadersConfig) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for name, value := range cfg.headersFor(c) {
+			if value != "" {
+				c.Header(name, value)
+			}
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecurityHeadersMiddleware(t *testing.T) {
+	t.Setenv("SECURITY_HEADER_OVERRIDES", `{"/static/embed": {"x-frame-options": "SAMEORIGIN"}}`)
+	cfg, err := LoadSecurityHeadersConfigFromEnv()
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(SecurityHeadersMiddleware(cfg))
+	r.GET("/*path", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(path string, secure bool) http.Header {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if secure {
+			req.TLS = &tls.ConnectionState{}
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Header()
+	}
+
+	h := get("/", false)
+	assert.Equal(t, defaultContentSecurityPolicy, h.Get("Content-Security-Policy"))
+	assert.Equal(t, "DENY", h.Get("X-Frame-Options"))
+	assert.Equal(t, "nosniff", h.Get("X-Content-Type-Options"))
+	assert.Equal(t, "same-origin", h.Get("Referrer-Policy"))
+	assert.Empty(t, h.Get("Strict-Transport-Security"), "明文 HTTP 不发送 HSTS")
+
+	assert.Equal(t, "max-age=31536000", get("/", true).Get("Strict-Transport-Security"))
+
+	h = get("/v1/messages", false)
+	assert.Empty(t, h.Get("Content-Security-Policy"), "/v1 不设置 CSP")
+	assert.Equal(t, "nosniff", h.Get("X-Content-Type-Options"))
+
+	h = get("/api/logs/stream", false)
+	assert.Empty(t, h.Get("Content-Security-Policy"), "SSE 端点默认覆盖")
+	assert.Empty(t, h.Get("X-Frame-Options"))
+	assert.Equal(t, "nosniff", h.Get("X-Content-Type-Options"))
+
+	assert.Equal(t, "SAMEORIGIN", get("/static/embed/x.html", false).Get("X-Frame-Options"))
+}
+
+func TestLoadSecurityHeadersConfigFromEnv_Invalid(t *testing.T) {
+	t.Setenv("SECURITY_HEADER_OVERRIDES", `{"api": {}}`)
+	_, err := LoadSecurityHeadersConfigFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("SECURITY_HEADER_OVERRIDES", "")
+	t.Setenv("SECURITY_CSP", "off")
+	cfg, err := LoadSecurityHeadersConfigFromEnv()
+	require.NoError(t, err)
+	assert.Empty(t, cfg.ContentSecurityPolicy)
+}
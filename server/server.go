@@ -1,15 +1,17 @@
 package server
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
-	"time"
+	"syscall"
 
 	"kiro2api/auth"
 	"kiro2api/config"
-	"kiro2api/converter"
+	"kiro2api/janitor"
 	"kiro2api/logger"
 	"kiro2api/types"
 	"kiro2api/utils"
@@ -20,89 +22,624 @@ import (
 // 移除全局httpClient，使用utils包中的共享客户端
 
 // StartServer 启动HTTP代理服务器
-func StartServer(port string, authToken string, authService *auth.AuthService) {
-	// 设置 gin 模式
-	ginMode := os.Getenv("GIN_MODE")
-	if ginMode == "" {
-		ginMode = gin.ReleaseMode
-	}
-	gin.SetMode(ginMode)
+// cfg 为启动时已校验的服务配置（config.LoadServerConfig）
+func StartServer(cfg *config.ServerConfig, authService *auth.AuthService) {
+	port, authToken := cfg.Port, cfg.ClientToken
+	gin.SetMode(cfg.GinMode)
+
+	// 上游故障检测：跨账号聚合上游错误（INCIDENT_* 环境变量），在 .env 与配置文件加载后创建
+	upstreamIncidents = LoadIncidentDetectorFromEnv()
+	// 上游账号级错误切换token重试（UPSTREAM_RETRY_* 环境变量）
+	upstreamRetryPolicy = LoadRetryPolicyFromEnv()
+	// 流式响应空闲保活间隔（SSE_KEEPALIVE_SECONDS）
+	sseKeepaliveInterval = loadSSEKeepaliveIntervalFromEnv()
+	// 透传给上游的请求ID头（UPSTREAM_REQUEST_ID_HEADER）
+	upstreamRequestIDHeader = loadUpstreamRequestIDHeaderFromEnv()
 
 	r := gin.New()
 
 	// 添加中间件
-	r.Use(gin.Logger())
 	r.Use(gin.Recovery())
-	// 注入请求ID，便于日志追踪
+	// 可信代理：只有来自 TRUSTED_PROXIES 的连接才采用转发头中的客户端IP（限流、登录限制与审计依赖 ClientIP）
+	if err := LoadTrustedProxyConfigFromEnv().Apply(r); err != nil {
+		logger.Error("启动失败: 可信代理配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	// 注入请求ID（或沿用客户端的 X-Request-ID），并输出结构化访问日志
 	r.Use(RequestIDMiddleware())
-	r.Use(corsMiddleware())
-	// 只对 /v1 开头的端点进行认证
-	r.Use(PathBasedAuthMiddleware(authToken, []string{"/v1"}))
+	r.Use(RequestLogMiddleware())
+	// OpenTelemetry 链路追踪（OTEL_* 环境变量配置导出），覆盖token选择、请求转换、上游调用与流解析
+	defer initTracing()()
+	r.Use(TracingMiddleware([]string{"/v1"}))
+	// 跨域策略：/v1 与管理后台分别配置允许的来源（CORS_* 环境变量）
+	corsConfig := LoadCORSConfigFromEnv()
+	if err := corsConfig.Validate(); err != nil {
+		logger.Error("启动失败: CORS配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	r.Use(CORSMiddleware(corsConfig))
+	// 安全响应头：Dashboard 的 CSP、HTTPS 下的 HSTS、禁止嵌入与 MIME 嗅探（SECURITY_* 环境变量），SSE 端点按路径覆盖
+	securityHeaders, err := LoadSecurityHeadersConfigFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 安全响应头配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	r.Use(SecurityHeadersMiddleware(securityHeaders))
+	// 可选的响应压缩：非流式的 JSON/文本响应按 Accept-Encoding 使用 gzip/deflate，SSE 与 NDJSON 流不压缩
+	compression, err := LoadCompressionConfigFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 响应压缩配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if compression.Enabled {
+		r.Use(CompressionMiddleware(compression))
+		logger.Info("响应压缩已启用",
+			logger.Int("min_bytes", compression.MinBytes),
+			logger.Int("level", compression.Level))
+	}
+	// 只读副本：仅提供Dashboard与统计，拒绝 /v1 代理与管理后台变更，账号配置从共享配置文件同步
+	replica := LoadReplicaConfigFromEnv()
+	if replica.Enabled {
+		r.Use(ReadReplicaMiddleware([]string{"/v1"}))
+		authService.SetReadOnly(true)
+		startReplicaSync(authService, replica.SyncInterval)
+		logger.Info("以只读副本模式运行",
+			logger.Duration("sync_interval", replica.SyncInterval))
+	}
+	// token主动刷新：到期前由后台逐个刷新，避免请求在token过期后同步等待刷新（只读副本不使用token）
+	refreshSchedule, err := auth.LoadRefreshScheduleFromEnv()
+	if err != nil {
+		logger.Error("启动失败: token主动刷新配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if refreshSchedule.Enabled() && !replica.Enabled {
+		refreshScheduler := authService.StartRefreshScheduler(refreshSchedule)
+		defer refreshScheduler.Stop()
+		logger.Info("token主动刷新已启用",
+			logger.Duration("margin", refreshSchedule.Margin),
+			logger.Duration("jitter", refreshSchedule.Jitter))
+	}
+	// 模型路由表：内置映射 + MODELS_CONFIG_FILE（别名、按模型默认参数与账号标签限制），文件变更时热加载
+	stopModelsReload, err := startModelsConfig(LoadModelsConfigFromEnv())
+	if err != nil {
+		logger.Error("启动失败: 加载模型路由表失败", logger.Err(err))
+		os.Exit(1)
+	}
+	defer stopModelsReload()
+	// 内容脱敏：日志字段、审计记录与错误样本落地前按 REDACTION_RULES 替换邮箱、API 密钥等敏感内容
+	contentRedactor, err = LoadRedactorFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 脱敏规则无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if contentRedactor != nil {
+		logger.SetRedactor(contentRedactor)
+		logger.Info("内容脱敏已启用", logger.Int("rule_count", contentRedactor.Len()))
+	}
+	// 输出过滤：模型正文下发给客户端前按 OUTPUT_FILTER_FILE 做正则替换、禁用内容截断与行尾空白清理
+	outputFilters, err = LoadOutputFiltersFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 输出过滤规则无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if outputFilters != nil {
+		logger.Info("输出过滤已启用", logger.Int("rule_count", len(outputFilters.Rules)))
+	}
+	inputGuard, err = LoadInputGuardFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 输入token上限配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if inputGuard != nil {
+		logger.Info("输入token上限已启用",
+			logger.Int("max_tokens", inputGuard.MaxTokens),
+			logger.String("mode", inputGuard.Mode),
+			logger.Int("keep_turns", inputGuard.KeepTurns))
+	}
+	// /v1 请求统计（异步写入，不阻塞请求）
+	initAuditLog()
+	r.Use(RequestStatsMiddleware([]string{"/v1"}))
+	// IP访问控制：管理后台与 /v1 分别配置允许/拒绝列表，拒绝时返回 403 并记录审计事件
+	ipAccess, err := LoadIPAccessConfigFromEnv()
+	if err != nil {
+		logger.Error("启动失败: IP访问控制配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	r.Use(IPAccessMiddleware(ipAccess))
+	// 只对 /v1 开头的端点进行认证（Bearer令牌或可选的HMAC请求签名）
+	signatureVerifier, err := LoadSignatureVerifierFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 请求签名配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if signatureVerifier != nil {
+		logger.Info("HMAC请求签名已启用",
+			logger.Int("key_count", len(signatureVerifier.keys)),
+			logger.String("window", signatureVerifier.window.String()),
+			logger.Bool("required", signatureVerifier.required))
+	}
+	r.Use(PathBasedAuthMiddlewareWithSigning(authToken, []string{"/v1"}, signatureVerifier))
+
+	// 系统提示策略：按调用方密钥前置/追加运营方系统提示、丢弃或包装客户端系统提示（PROMPT_POLICY_FILE）
+	promptPolicies, err := LoadPromptPoliciesFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 系统提示策略无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if promptPolicies != nil {
+		logger.Info("系统提示策略已启用",
+			logger.Bool("has_default", promptPolicies.Default != nil),
+			logger.Int("key_count", len(promptPolicies.Keys)))
+	}
+
+	// 多租户：按调用方密钥限定可使用的账号标签，不同团队使用隔离的上游账号（TENANT_FILE）
+	tenants, err = LoadTenantsFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 租户配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if tenants != nil {
+		logger.Info("多租户已启用",
+			logger.Int("key_count", len(tenants.Keys)),
+			logger.Bool("has_default", tenants.Default != nil))
+	}
+
+	// 密钥策略：按调用方密钥限制可用模型、截断 max_tokens/temperature、禁用工具，可通过 /api/keys/:id/policy 修改
+	keyPolicies, err = NewKeyPolicyStore(utils.GetEnvWithDefault("KEY_POLICIES_FILE", "key_policies.json"))
+	if err != nil {
+		logger.Error("启动失败: 加载密钥策略失败", logger.Err(err))
+		os.Exit(1)
+	}
+	if count := keyPolicies.Count(); count > 0 {
+		logger.Info("密钥策略已启用", logger.Int("key_count", count))
+	}
+
+	// token池饱和（耗尽或熔断）时按FIFO排队等待，超过队列深度或等待时间返回429与预计重试时间
+	tokenQueue, err = LoadTokenQueueFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 请求排队配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if tokenQueue != nil {
+		logger.Info("token池饱和排队已启用",
+			logger.Int("max_depth", tokenQueue.maxDepth),
+			logger.Duration("max_wait", tokenQueue.maxWait),
+			logger.Bool("shed_low_priority", tokenQueue.shedLow))
+	}
+
+	// 会话粘性路由：同一会话（X-Conversation-ID 或第一条用户消息）优先使用同一账号
+	stickyRoutes, err = LoadStickyRouterFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 会话粘性路由配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if stickyRoutes != nil {
+		logger.Info("会话粘性路由已启用",
+			logger.Duration("ttl", stickyRoutes.ttl),
+			logger.Int("max_entries", stickyRoutes.maxEntries))
+	}
+
+	// 非流式响应缓存：客户端通过 X-Cache-Control 显式启用，相同请求直接返回缓存结果
+	responseCache, err := LoadResponseCacheFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 响应缓存配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if responseCache != nil {
+		logger.Info("响应缓存已启用",
+			logger.Int("max_entries", responseCache.maxEntries),
+			logger.Duration("ttl", responseCache.ttl))
+	}
+
+	// 上游事件流透传：按模型或 X-Kiro-Passthrough 请求头将 AWS event-stream 原样写给客户端
+	passthrough, err := LoadPassthroughConfigFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 透传配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if passthrough.Enabled() {
+		logger.Info("上游事件流透传已启用",
+			logger.Bool("allow_header", passthrough.AllowHeader),
+			logger.Int("models", len(passthrough.Models)))
+	}
+
+	// /v1 按调用方密钥限流（流式与非流式独立令牌桶 + 并发流上限）
+	rateLimiter, err := LoadV1RateLimiterFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 限流配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if rateLimiter != nil {
+		logger.Info("/v1 限流已启用",
+			logger.Float64("rps", rateLimiter.defaults.Request.RPS),
+			logger.Float64("stream_rps", rateLimiter.defaults.Stream.RPS),
+			logger.Int("max_concurrent_streams", rateLimiter.defaults.MaxConcurrentStreams),
+			logger.Int("key_overrides", len(rateLimiter.overrides)))
+	}
+	r.Use(V1RateLimitMiddleware(rateLimiter, []string{"/v1"}))
+
+	// /v1 请求总时长上限（按端点配置），到期取消上游请求，避免挂起的上游无限占用协程
+	deadlines, err := LoadRequestDeadlinesFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 请求超时配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	r.Use(RequestDeadlineMiddleware(deadlines, []string{"/v1"}))
+
+	// Idempotency-Key：非流式请求的重试重放首次成功响应，不重复消耗上游额度（位于并发上限之前，重放不占用名额）
+	idempotencyStore, err := LoadIdempotencyStoreFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 幂等配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if idempotencyStore != nil {
+		logger.Info("Idempotency-Key 支持已启用",
+			logger.Duration("window", idempotencyStore.window),
+			logger.Int("max_entries", idempotencyStore.maxEntries))
+	}
+	r.Use(IdempotencyMiddleware(idempotencyStore, []string{"/v1"}))
+
+	// /v1 全局进行中请求上限，上游变慢时避免流式请求无限堆积
+	inflightLimiter, err = LoadInflightLimiterFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 全局并发上限配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if inflightLimiter != nil {
+		stats := inflightLimiter.Stats()
+		logger.Info("全局并发上限已启用",
+			logger.Int("max", stats.Max),
+			logger.String("mode", stats.Mode))
+	}
+	r.Use(InflightLimitMiddleware(inflightLimiter, []string{"/v1"}))
+
+	// 登记进行中的 /v1 请求，管理后台可查看并取消卡住的生成
+	r.Use(ActiveRequestMiddleware(activeRequests, []string{"/v1"}))
+
+	// 功能开关：高风险的新子系统默认关闭，按部署通过 FEATURE_FLAGS 启用
+	flags, err := LoadFeatureFlagsFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 功能开关配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	featureFlags = flags
+
+	// 请求捕获：带 X-Kiro-Capture: true 的请求保存可离线回放的捕获包（需配置 CAPTURE_DIR 并启用 enable_capture）
+	captureStore, err := LoadCaptureStoreFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 请求捕获配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if captureStore != nil && featureFlags.StartupEnabled(FeatureCapture) {
+		logger.Info("请求捕获已启用",
+			logger.String("dir", captureStore.dir),
+			logger.Int("max_bytes", captureStore.maxBytes))
+		r.Use(CaptureMiddleware(captureStore, func() bool { return featureFlags.Enabled(FeatureCapture) }))
+	} else if featureFlags.StartupEnabled(FeatureCapture) {
+		logger.Warn("已启用 enable_capture，但未配置 CAPTURE_DIR")
+	}
+
+	// Webhook通知：token刷新失败、被上游拒绝、额度耗尽与token池耗尽时通知运维（需启用 enable_webhooks）
+	notifierConfig, err := LoadNotifierConfigFromEnv()
+	if err != nil {
+		logger.Error("启动失败: Webhook通知配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if featureFlags.StartupEnabled(FeatureWebhooks) && notifierConfig.HasSinks() {
+		notifier := NewNotifier(notifierConfig, func() bool { return featureFlags.Enabled(FeatureWebhooks) })
+		defer notifier.Close()
+		auth.SetTokenEventHandler(notifier.Notify)
+		logger.Info("Webhook通知已启用",
+			logger.Int("sink_count", len(notifier.sinks)),
+			logger.Duration("cooldown", notifierConfig.Cooldown))
+	} else if notifierConfig.HasSinks() {
+		logger.Warn("已配置Webhook通知目标，但功能开关 enable_webhooks 未启用")
+	} else if featureFlags.StartupEnabled(FeatureWebhooks) {
+		logger.Warn("已启用 enable_webhooks，但未配置任何通知目标（WEBHOOK_URLS 等）")
+	}
+
+	// 模型价格表：按请求估算费用，写入请求统计记录并在用量报表中按密钥与账号汇总
+	pricingTable, err = LoadPricingFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 价格配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if pricingTable != nil {
+		logger.Info("模型价格表已加载",
+			logger.String("currency", pricingTable.Currency),
+			logger.Int("models", len(pricingTable.Models)),
+			logger.Bool("default", pricingTable.Default != nil))
+	}
+
+	// 每日用量报表：UTC 零点后汇总前一天的审计记录，写入目录或投递到 Webhook，用于计费对账
+	usageReportConfig, err := LoadUsageReportConfigFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 每日用量报表配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if usageReportConfig != nil {
+		if auditLog.Path() == "" {
+			logger.Error("启动失败: 每日用量报表需要配置 AUDIT_LOG_FILE")
+			os.Exit(1)
+		}
+		usageReporter := NewUsageReporter(*usageReportConfig, auditLog.Path())
+		usageReporter.Start()
+		defer usageReporter.Stop()
+		logger.Info("每日用量报表已启用",
+			logger.String("dir", usageReportConfig.Dir),
+			logger.Bool("webhook", usageReportConfig.WebhookURL != ""),
+			logger.String("format", usageReportConfig.Format))
+	}
+
+	// 备用上游：Kiro 账号全部耗尽或熔断时将 /v1/messages 与 /v1/chat/completions 转发到同格式的备用上游
+	fallbackChain, err = LoadFallbackChainFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 备用上游配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if fallbackChain != nil {
+		names := make([]string, 0, len(fallbackChain.Providers))
+		for _, p := range fallbackChain.Providers {
+			names = append(names, p.Name+"("+p.Type+")")
+		}
+		logger.Info("备用上游已配置", logger.String("providers", strings.Join(names, ", ")))
+	}
+
+	// 嵌入端点的次级后端：Kiro 不提供嵌入能力，/v1/embeddings 转发到 OpenAI 兼容后端
+	embeddingsBackend, err := LoadEmbeddingsBackendFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 嵌入后端配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	if embeddingsBackend != nil {
+		logger.Info("嵌入后端已配置", logger.String("url", embeddingsBackend.URL))
+	}
+
+	// 定期清理过期的运行期产物（批量任务输出、抓包、幂等记录），防止磁盘与内存无限增长
+	// 过期的幂等记录平时只在记录已满时清理，交给清理器定期回收
+	var janitorTargets []janitor.Target
+	if idempotencyStore != nil {
+		janitorTargets = append(janitorTargets, janitor.FuncTarget{Label: "idempotency_entries", Fn: idempotencyStore.Prune})
+	}
+	initJanitor(janitorTargets...)
 
 	// ==================== 登录系统配置 ====================
-	adminUser := utils.GetEnvWithDefault("ADMIN_USERNAME", "admin")
-	adminPass := os.Getenv("ADMIN_PASSWORD")
+	// 可选的OIDC单点登录
+	oidcConfig, err := LoadOIDCConfigFromEnv()
+	if err != nil {
+		logger.Error("启动失败: OIDC配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+
+	// 多用户文件优先；未配置时退回单管理员模式（ADMIN_USERNAME/ADMIN_PASSWORD 或 ADMIN_PASSWORD_HASH）
+	userStore, err := NewUserStore(cfg.Admin.UsersFile, &AdminUser{
+		Username:     cfg.Admin.Username,
+		Password:     cfg.Admin.Password,
+		PasswordHash: cfg.Admin.PasswordHash,
+		Role:         RoleAdmin,
+	})
+	if err != nil {
+		logger.Error("启动失败: 加载管理后台用户失败", logger.Err(err))
+		os.Exit(1)
+	}
 
-	// 强制要求设置管理员密码
-	if adminPass == "" {
-		logger.Error("启动失败: 未设置 ADMIN_PASSWORD 环境变量")
-		logger.Error("请设置管理员密码后重新启动:")
+	// 强制要求配置至少一种登录方式
+	if userStore.Count() == 0 && oidcConfig == nil {
+		logger.Error("启动失败: 未配置管理后台用户")
+		logger.Error("请设置管理员密码、用户文件或OIDC后重新启动:")
 		logger.Error("  ADMIN_PASSWORD=your_password ./kiro2api")
+		logger.Error("  ADMIN_PASSWORD_HASH=$(./kiro2api hash-password) ./kiro2api")
+		logger.Error("  ADMIN_USERS_FILE=/path/to/admin_users.json ./kiro2api")
+		logger.Error("  OIDC_ISSUER=https://sso.example.com OIDC_CLIENT_ID=... ./kiro2api")
 		os.Exit(1)
 	}
 
 	// 初始化会话管理器
-	idleMinutes := utils.GetEnvIntWithDefault("SESSION_IDLE_MINUTES", 30)
-	absoluteHours := utils.GetEnvIntWithDefault("SESSION_ABSOLUTE_HOURS", 12)
-	idleTimeout := time.Duration(idleMinutes) * time.Minute
-	absoluteTimeout := time.Duration(absoluteHours) * time.Hour
+	sessionManager := NewSessionManager(cfg.Admin.SessionIdle, cfg.Admin.SessionAbsolute)
+	// 登录失败锁定：按IP与用户名逐次延长锁定时长，失败过多的IP临时封禁（封禁列表重启后保留）
+	lockoutConfig, err := LoadLoginLockoutConfigFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 登录锁定配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	loginLockout, err := NewLoginLockout(lockoutConfig)
+	if err != nil {
+		logger.Error("启动失败: 加载登录封禁列表失败", logger.Err(err))
+		os.Exit(1)
+	}
+	cookieSameSite := ParseCookieSameSite(cfg.Admin.CookieSameSite)
+	authHandlers := NewAuthHandlers(sessionManager, userStore, cfg.Admin.SessionIdle, loginLockout, cookieSameSite)
+
+	var oidcHandlers *OIDCHandlers
+	if oidcConfig != nil {
+		oidcHandlers = NewOIDCHandlers(oidcConfig, authHandlers)
+		logger.Info("OIDC登录已启用",
+			logger.String("issuer", oidcConfig.Issuer),
+			logger.String("role_claim", oidcConfig.RoleClaim))
+	}
 
-	sessionManager := NewSessionManager(idleTimeout, absoluteTimeout)
-	authHandlers := NewAuthHandlers(sessionManager, adminUser, adminPass, idleTimeout)
+	// 时钟跳变检测：会话与冷却计时基于单调时钟，不受影响；token缓存需重新评估有效期
+	clockMonitor := utils.NewClockMonitor(config.ClockCheckInterval, config.ClockJumpThreshold)
+	clockMonitor.OnJump(func(jump utils.ClockJump) {
+		authService.InvalidateTokenCache()
+		logger.Warn("时钟跳变后已使token缓存失效",
+			logger.String("drift", jump.Drift.String()),
+			logger.Int("active_sessions", sessionManager.Count()))
+	})
+	clockMonitor.Start()
 
 	// 注册会话中间件（全局）
 	r.Use(SessionMiddleware(sessionManager))
 
 	logger.Info("登录系统已启用",
-		logger.String("admin_user", adminUser),
-		logger.Int("session_idle_minutes", idleMinutes),
-		logger.Int("session_absolute_hours", absoluteHours))
+		logger.Int("user_count", userStore.Count()),
+		logger.String("users_file", cfg.Admin.UsersFile),
+		logger.Duration("session_idle", cfg.Admin.SessionIdle),
+		logger.Duration("session_absolute", cfg.Admin.SessionAbsolute))
 
-	// 注册 CSRF 中间件（全局）- 对所有请求发放 token，仅对非安全方法验证
+	// 注册 CSRF 中间件（全局）- 对所有请求发放 token（已登录时为绑定到会话的 token），仅对非安全方法验证
 	// Secure cookie 属性现在基于实际请求协议自动判断（HTTP/HTTPS）
-	r.Use(CSRFMiddleware(false))
+	r.Use(CSRFMiddleware(cookieSameSite))
 
 	// ==================== 静态资源服务 ====================
-	r.Static("/static", "./static")
+	// Dashboard 资源通过 go:embed 内嵌在二进制中，HTML 引用追加版本戳便于长期缓存
+	assets := mustLoadEmbeddedAssets()
+	r.GET("/static/*filepath", assets.handler)
+	r.HEAD("/static/*filepath", assets.handler)
 
 	// Dashboard 首页（需要登录）
 	r.GET("/", DashboardAuthGuard(), func(c *gin.Context) {
-		c.File("./static/index.html")
+		assets.serve(c, "index.html")
 	})
 
 	// ==================== 认证API端点 ====================
 	r.POST("/api/login", authHandlers.HandleLogin)
 	r.POST("/api/logout", authHandlers.HandleLogout)
 	r.GET("/api/session", authHandlers.HandleSessionCheck)
+	r.GET("/api/oidc/status", oidcHandlers.HandleStatus)
+	if oidcHandlers != nil {
+		r.GET("/api/oidc/login", oidcHandlers.HandleLogin)
+		r.GET("/api/oidc/callback", oidcHandlers.HandleCallback)
+	}
+
+	// 账号上游实时用量查询：结果按 TOKEN_USAGE_CACHE_SECONDS 缓存，避免仪表盘频繁调用上游
+	tokenUsageTTL, err := LoadTokenUsageCacheTTLFromEnv()
+	if err != nil {
+		logger.Error("启动失败: 账号用量查询配置无效", logger.Err(err))
+		os.Exit(1)
+	}
+	tokenUsage := NewTokenUsageCache(tokenUsageTTL, authService.ProbeUsage)
 
 	// ==================== Token管理API（受保护）====================
 	adminAPI := r.Group("/api")
 	adminAPI.Use(AdminAPIAuthGuard())
+	adminAPI.Use(AdminAuditMiddleware())
 	adminAPI.GET("/tokens", func(c *gin.Context) {
 		handleTokenPoolAPI(c, authService)
 	})
+	adminAPI.GET("/tokens/list", func(c *gin.Context) {
+		handleListTokens(c, authService)
+	})
+	adminAPI.GET("/tokens/health", func(c *gin.Context) {
+		handleTokenHealth(c, authService)
+	})
+	adminAPI.GET("/tokens/snapshot", RequireRole(RoleOperator), func(c *gin.Context) {
+		handleTokenSnapshot(c, authService)
+	})
+	adminAPI.GET("/tokens/export", RequireRole(RoleOperator), func(c *gin.Context) {
+		handleExportTokens(c, authService)
+	})
+	adminAPI.POST("/tokens/import", func(c *gin.Context) {
+		handleImportTokens(c, authService)
+	})
 	adminAPI.POST("/tokens", func(c *gin.Context) {
 		handleAddToken(c, authService)
 	})
-	adminAPI.DELETE("/tokens/:index", func(c *gin.Context) {
+	adminAPI.DELETE("/tokens/:id", func(c *gin.Context) {
 		handleDeleteToken(c, authService)
 	})
+	adminAPI.PATCH("/tokens/:id", func(c *gin.Context) {
+		handleUpdateToken(c, authService)
+	})
+	adminAPI.GET("/tokens/:id/usage", func(c *gin.Context) {
+		handleTokenUsage(c, authService, tokenUsage)
+	})
+
+	adminAPI.GET("/incident", func(c *gin.Context) {
+		c.JSON(http.StatusOK, upstreamIncidents.State())
+	})
+	adminAPI.GET("/audit/stats", handleAuditStats)
+	adminAPI.GET("/queue", handleQueueStats)
+	adminAPI.GET("/upstream/pool", handleUpstreamPoolStats)
+	adminAPI.GET("/streams", handleStreamStats)
+	adminAPI.GET("/inflight", handleInflightStats)
+	adminAPI.GET("/requests/active", handleListActiveRequests)
+	adminAPI.GET("/usage/export", handleUsageExport)
+	adminAPI.DELETE("/requests/active/:id", handleCancelActiveRequest)
+	adminAPI.GET("/features", handleListFeatures)
+	adminAPI.GET("/errors", handleErrorCodeStats)
+	adminAPI.GET("/logs/stream", RequireRole(RoleAdmin), handleLogStream)
+	adminAPI.POST("/debug/convert", RequireRole(RoleAdmin), func(c *gin.Context) {
+		handleDebugConvert(c, authService, promptPolicies)
+	})
+
+	// ==================== 运维API（仅管理员）====================
+	opsAPI := adminAPI.Group("/admin")
+	opsAPI.Use(RequireRole(RoleAdmin))
+	opsAPI.GET("/support-bundle", func(c *gin.Context) {
+		handleSupportBundle(c, authService)
+	})
+	opsAPI.PUT("/features/:name", handleUpdateFeature)
+	opsAPI.GET("/login-lockouts", authHandlers.HandleListLoginLockouts)
+	opsAPI.DELETE("/login-lockouts", authHandlers.HandleClearLoginLockout)
+	opsAPI.DELETE("/login-lockouts/:key", authHandlers.HandleClearLoginLockout)
+	opsAPI.GET("/config", func(c *gin.Context) {
+		handleServerConfig(c, cfg)
+	})
+	opsAPI.GET("/janitor", handleJanitorStats)
+	opsAPI.POST("/janitor/run", handleJanitorRun)
+	opsAPI.GET("/loglevel", handleGetLogLevel)
+	opsAPI.PUT("/loglevel", handleSetLogLevel)
+
+	// ==================== 用户管理API（仅管理员）====================
+	usersAPI := adminAPI.Group("/users")
+	usersAPI.Use(RequireRole(RoleAdmin))
+	usersAPI.GET("", authHandlers.HandleListUsers)
+	usersAPI.POST("", authHandlers.HandleUpsertUser)
+	usersAPI.DELETE("/:username", authHandlers.HandleDeleteUser)
+
+	// ==================== 密钥策略API ====================
+	registerKeyPolicyRoutes(adminAPI)
+
+	// ==================== 请求模板API ====================
+	templateStore, err := NewTemplateStore(utils.GetEnvWithDefault("REQUEST_TEMPLATES_FILE", "request_templates.json"))
+	if err != nil {
+		logger.Error("启动失败: 加载请求模板失败", logger.Err(err))
+		os.Exit(1)
+	}
+	templateHandlers := NewTemplateHandlers(templateStore, r, signatureVerifier)
+	templatesAPI := adminAPI.Group("/templates")
+	templatesAPI.GET("", templateHandlers.HandleList)
+	templatesAPI.POST("", templateHandlers.HandleCreate)
+	templatesAPI.GET("/:id", templateHandlers.HandleGet)
+	templatesAPI.PUT("/:id", templateHandlers.HandleUpdate)
+	templatesAPI.DELETE("/:id", templateHandlers.HandleDelete)
+	templatesAPI.GET("/:id/request", templateHandlers.HandleRender)
+	registerFeatureRoutes(featureFlags, FeaturePlayground, templatesAPI, func(g *gin.RouterGroup) {
+		g.POST("/:id/run", templateHandlers.HandleRun)
+	})
+
+	// 异步批量请求（需启用 enable_batches）：请求以创建者的调用方身份在本机路由执行，结果持久化到 BATCH_OUTPUT_DIR
+	var batchStore *BatchStore
+	if featureFlags.StartupEnabled(FeatureBatches) {
+		batchConfig, err := LoadBatchConfigFromEnv()
+		if err == nil {
+			batchStore, err = NewBatchStore(batchConfig, r, signatureVerifier)
+		}
+		if err != nil {
+			logger.Error("启动失败: 批量请求配置无效", logger.Err(err))
+			os.Exit(1)
+		}
+		logger.Info("批量请求已启用",
+			logger.String("dir", batchConfig.Dir),
+			logger.Int("concurrency", batchConfig.Concurrency))
+	}
+	if batchStore != nil {
+		registerFeatureRoutes(featureFlags, FeatureBatches, r.Group("/v1/batches"), batchStore.RegisterRoutes)
+	}
+
+	// 就绪检查：附带上游故障推断状态
+	// 存活检查（不检查依赖）与就绪检查（可用token、配置文件可写、上游可达性）
+	r.GET("/healthz", handleHealthz)
+	r.GET("/readyz", func(c *gin.Context) {
+		handleReadyz(c, authService, replica.Enabled)
+	})
 
 	// GET /v1/models 端点
 	r.GET("/v1/models", func(c *gin.Context) {
 		// 构建模型列表
 		models := []types.Model{}
-		for anthropicModel := range config.ModelMap {
+		for _, anthropicModel := range config.CurrentModelTable().Names() {
 			model := types.Model{
 				ID:          anthropicModel,
 				Object:      "model",
@@ -123,6 +660,8 @@ func StartServer(port string, authToken string, authService *auth.AuthService) {
 		c.JSON(http.StatusOK, response)
 	})
 
+	// 思考内容改写：THINKING_STRIP 开启时只返回正文（Anthropic 与 OpenAI 端点共用）
+	thinkingStripEnabled = loadThinkingStripFromEnv()
 	r.POST("/v1/messages", func(c *gin.Context) {
 		// 使用RequestContext统一处理token获取和请求体读取
 		reqCtx := &RequestContext{
@@ -160,6 +699,9 @@ func StartServer(port string, authToken string, authService *auth.AuthService) {
 										"description":  description,
 										"input_schema": inputSchema,
 									}
+									if cacheControl, ok := toolMap["cache_control"]; ok {
+										normalizedTool["cache_control"] = cacheControl
+									}
 									normalizedTools = append(normalizedTools, normalizedTool)
 									continue
 								}
@@ -215,18 +757,39 @@ func StartServer(port string, authToken string, authService *auth.AuthService) {
 			return
 		}
 
+		if anthropicReq, err = prepareAnthropicRequest(c, anthropicReq, promptPolicies); err != nil {
+			respondInvalidRequest(c, err)
+			return
+		}
+
+		setAuditModel(c, anthropicReq.Model)
+
+		usePassthrough, err := passthrough.resolve(c, anthropicReq)
+		if err != nil {
+			respondInvalidRequest(c, err)
+			return
+		}
+		if usePassthrough {
+			handlePassthroughStreamRequest(c, anthropicReq, tokenWithUsage)
+			return
+		}
+
 		if anthropicReq.Stream {
 			handleStreamRequest(c, anthropicReq, tokenWithUsage)
 			return
 		}
 
-		handleNonStreamRequest(c, anthropicReq, tokenWithUsage.TokenInfo)
+		serveWithResponseCache(c, responseCache, "messages", anthropicReq, func() {
+			handleNonStreamRequest(c, anthropicReq, tokenWithUsage.TokenInfo)
+		})
 	})
 
 	// Token计数端点
 	r.POST("/v1/messages/count_tokens", handleCountTokens)
+	r.POST("/v1/tokens/count", handleOpenAICountTokens)
 
 	// 新增：OpenAI兼容的 /v1/chat/completions 端点
+	responseFormatRepairAttempts = loadResponseFormatRepairAttemptsFromEnv()
 	r.POST("/v1/chat/completions", func(c *gin.Context) {
 		// 使用RequestContext统一处理token获取和请求体读取
 		reqCtx := &RequestContext{
@@ -247,6 +810,8 @@ func StartServer(port string, authToken string, authService *auth.AuthService) {
 			return
 		}
 
+		setAuditModel(c, openaiReq.Model)
+
 		logger.Debug("OpenAI请求解析成功",
 			logger.String("model", openaiReq.Model),
 			logger.Bool("stream", openaiReq.Stream != nil && *openaiReq.Stream),
@@ -257,16 +822,43 @@ func StartServer(port string, authToken string, authService *auth.AuthService) {
 				return 16384
 			}()))
 
-		// 转换为Anthropic格式
-		anthropicReq := converter.ConvertOpenAIToAnthropic(openaiReq)
+		anthropicReq, err := prepareOpenAIChatRequest(c, openaiReq, promptPolicies)
+		if err != nil {
+			respondInvalidRequest(c, err)
+			return
+		}
 
 		if anthropicReq.Stream {
-			handleOpenAIStreamRequest(c, anthropicReq, tokenInfo)
+			includeUsage := openaiReq.StreamOptions != nil && openaiReq.StreamOptions.IncludeUsage
+			handleOpenAIStreamRequest(c, anthropicReq, tokenInfo, includeUsage)
 			return
 		}
-		handleOpenAINonStreamRequest(c, anthropicReq, tokenInfo)
+		cacheKey := struct {
+			Request        types.AnthropicRequest      `json:"request"`
+			ResponseFormat *types.OpenAIResponseFormat `json:"response_format,omitempty"`
+		}{anthropicReq, openaiReq.ResponseFormat}
+		serveWithResponseCache(c, responseCache, "chat_completions", cacheKey, func() {
+			handleOpenAINonStreamRequest(c, anthropicReq, tokenInfo, openaiReq.ResponseFormat)
+		})
 	})
 
+	// WebSocket 流式聊天补全端点（SSE 会被代理缓冲或改写时使用）
+	r.GET(realtimePath, handleRealtime(authService, promptPolicies, realtimeLimits{rateLimiter: rateLimiter, inflight: inflightLimiter}))
+
+	// 旧版 OpenAI 文本补全端点
+	r.POST("/v1/completions", handleTextCompletions(authService, promptPolicies, responseCache))
+
+	// OpenAI 兼容的嵌入端点，转发到配置的次级后端
+	r.POST("/v1/embeddings", handleEmbeddings(embeddingsBackend))
+
+	// Gemini 兼容端点：/v1beta/models/{model}:generateContent、:streamGenerateContent、:countTokens
+	r.POST(geminiPathPrefix+":action", handleGemini(authService, promptPolicies, responseCache))
+
+	// Ollama 兼容端点：/api/chat、/api/tags、/api/version 经 ollamaPathRewrite 改写到此前缀下
+	r.POST(ollamaRoutePrefix+"/api/chat", handleOllamaChat(authService, promptPolicies))
+	r.GET(ollamaRoutePrefix+"/api/tags", handleOllamaTags)
+	r.GET(ollamaRoutePrefix+"/api/version", handleOllamaVersion)
+
 	r.NoRoute(func(c *gin.Context) {
 		logger.Warn("访问未知端点",
 			logger.String("path", c.Request.URL.Path),
@@ -284,41 +876,118 @@ func StartServer(port string, authToken string, authService *auth.AuthService) {
 	logger.Info("  POST /api/login                 - 登录接口")
 	logger.Info("  POST /api/logout                - 登出接口")
 	logger.Info("  GET  /api/session               - 会话状态检查")
+	if oidcHandlers != nil {
+		logger.Info("  GET  /api/oidc/login            - SSO登录")
+		logger.Info("  GET  /api/oidc/callback         - SSO回调")
+	}
 	logger.Info("  GET  /api/tokens                - Token池状态API")
+	logger.Info("  GET  /api/tokens/list           - 账号列表（脱敏，只读内存状态）")
+	logger.Info("  GET  /api/tokens/health         - Token上游熔断器状态")
+	logger.Info("  GET  /api/tokens/snapshot       - Token池快照（备份）")
+	logger.Info("  GET  /api/tokens/export         - 导出Token池（默认脱敏，mask=false 仅管理员）")
+	logger.Info("  POST /api/tokens/import         - 批量导入Token")
 	logger.Info("  POST /api/tokens                - 添加Token")
-	logger.Info("  DELETE /api/tokens/:index       - 删除Token")
+	logger.Info("  PATCH /api/tokens/:id           - 更新Token（启用/禁用、名称、标签、并发上限）")
+	logger.Info("  DELETE /api/tokens/:id          - 删除Token")
+	logger.Info("  GET  /api/tokens/:id/usage      - 查询账号上游实时额度")
+	logger.Info("  GET  /api/users                 - 用户列表（管理员）")
+	logger.Info("  POST /api/users                 - 新增/更新用户（管理员）")
+	logger.Info("  DELETE /api/users/:username     - 删除用户（管理员）")
+	logger.Info("  GET  /api/keys/:id/policy       - 获取密钥策略")
+	logger.Info("  PUT  /api/keys/:id/policy       - 设置密钥策略（模型白名单、参数上限、禁用工具）")
+	logger.Info("  DELETE /api/keys/:id/policy     - 删除密钥策略")
+	logger.Info("  GET  /api/templates             - 请求模板列表")
+	logger.Info("  POST /api/templates             - 新建请求模板")
+	logger.Info("  PUT  /api/templates/:id         - 更新请求模板")
+	logger.Info("  DELETE /api/templates/:id       - 删除请求模板")
+	logger.Info("  GET  /api/templates/:id/request - 生成模板请求体")
+	if featureFlags.StartupEnabled(FeaturePlayground) {
+		logger.Info("  POST /api/templates/:id/run     - 试运行请求模板")
+	}
+	logger.Info("  GET  /api/incident              - 上游故障状态")
+	logger.Info("  GET  /api/audit/stats           - 审计写入队列与丢弃计数")
+	logger.Info("  GET  /api/upstream/pool         - 上游连接池配置与复用统计")
+	logger.Info("  GET  /api/streams               - 流式响应结果统计（含客户端中途断开数）")
+	logger.Info("  GET  /api/inflight              - 全局进行中请求数与拒绝统计")
+	logger.Info("  GET  /api/requests/active       - 进行中的请求（模型、调用方、token、时长、已输出字节）")
+	logger.Info("  DELETE /api/requests/active/:id - 取消进行中的请求")
+	logger.Info("  GET  /api/usage/export          - 按调用方密钥与账号导出用量报表（CSV/JSON）")
+	logger.Info("  GET  /api/features              - 功能开关状态")
+	logger.Info("  GET  /api/logs/stream           - SSE实时日志（管理员）")
+	logger.Info("  POST /api/debug/convert         - 转换预览（管理员）")
+	logger.Info("  GET  /api/admin/support-bundle  - 下载支持包（管理员）")
+	logger.Info("  PUT  /api/admin/features/:name  - 运行期切换功能开关（管理员）")
+	logger.Info("  GET  /api/admin/login-lockouts  - 登录失败锁定与IP封禁列表（管理员）")
+	logger.Info("  DELETE /api/admin/login-lockouts[/:key] - 清除登录锁定（管理员）")
+	logger.Info("  GET  /api/admin/config          - 查看生效的服务配置（管理员，密钥脱敏）")
+	logger.Info("  GET  /api/admin/janitor         - 运行期产物清理指标（管理员）")
+	logger.Info("  POST /api/admin/janitor/run     - 立即清理过期产物（管理员）")
+	logger.Info("  GET  /api/admin/loglevel        - 查询当前日志级别（管理员）")
+	logger.Info("  PUT  /api/admin/loglevel        - 运行期调整日志级别（管理员）")
+	logger.Info("  GET  /healthz                   - 存活检查")
+	logger.Info("  GET  /readyz                    - 就绪检查（token、配置文件、上游可达性）")
 	logger.Info("  GET  /v1/models                 - 模型列表")
 	logger.Info("  POST /v1/messages               - Anthropic API代理")
 	logger.Info("  POST /v1/messages/count_tokens  - Token计数接口")
+	logger.Info("  POST /v1/tokens/count           - Token计数接口（OpenAI格式）")
 	logger.Info("  POST /v1/chat/completions       - OpenAI API代理")
+	logger.Info("  POST /v1/completions            - OpenAI旧版文本补全")
+	logger.Info("  POST /v1/embeddings             - OpenAI嵌入接口（转发到嵌入后端）")
+	logger.Info("  GET  /v1/realtime               - WebSocket流式聊天补全")
+	if batchStore != nil {
+		logger.Info("  POST /v1/batches                - 创建批量任务（JSONL）")
+		logger.Info("  GET  /v1/batches/:id            - 批量任务状态")
+		logger.Info("  GET  /v1/batches/:id/output     - 下载批量结果")
+	}
+	logger.Info("  POST /v1beta/models/{model}:*   - Gemini API兼容接口")
+	logger.Info("  POST /api/chat                  - Ollama API兼容接口（NDJSON流式）")
+	logger.Info("  GET  /api/tags                  - Ollama 模型列表")
+	logger.Info("  GET  /api/version               - Ollama 版本信息")
 	logger.Info("按Ctrl+C停止服务器")
 
-	// 创建自定义HTTP服务器以支持长时间请求
-	server := &http.Server{
-		Addr:    ":" + port,
-		Handler: r,
+	if batchStore != nil {
+		batchStore.Resume()
 	}
 
-	logger.Info("启动HTTP服务器", logger.String("port", port))
+	// 创建自定义HTTP服务器：限制读取客户端请求的时间，流式响应总时长由请求截止时间控制
+	timeouts := serverTimeoutsFrom(cfg.Timeouts)
+	server := newHTTPServer(":"+port, ollamaPathRewrite(r), timeouts)
 
-	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		logger.Error("启动服务器失败", logger.Err(err), logger.String("port", port))
+	logger.Info("启动HTTP服务器",
+		logger.String("port", port),
+		logger.Duration("read_timeout", timeouts.Read),
+		logger.Duration("request_deadline", deadlines.Default),
+		logger.Duration("upstream_connect_timeout", utils.UpstreamConnectTimeout()),
+		logger.Duration("upstream_first_byte_timeout", utils.UpstreamFirstByteTimeout()),
+		logger.Bool("upstream_http2", utils.CurrentUpstreamClientConfig().HTTP2))
+
+	// 原生 TLS：证书文件（变更或 SIGHUP 时热加载）或 ACME 自动申请证书，未配置时使用明文 HTTP
+	tlsConfig, stopTLSReload, err := LoadTLSConfigFromEnv().Build()
+	if err != nil {
+		logger.Error("启动失败: TLS配置无效", logger.Err(err))
 		os.Exit(1)
 	}
-}
+	defer stopTLSReload()
 
-// corsMiddleware CORS中间件
-func corsMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Content-Type, Authorization, x-api-key, X-CSRF-Token")
+	if tlsConfig != nil {
+		server.TLSConfig = tlsConfig
+		logger.Info("已启用TLS", logger.String("port", port))
+	}
 
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(http.StatusOK)
-			return
+	// SIGINT/SIGTERM 时优雅退出：等待在途请求完成后落盘审计队列
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err = serveUntilSignal(ctx, server, func() error {
+		if tlsConfig != nil {
+			return server.ListenAndServeTLS("", "")
 		}
-
-		c.Next()
+		return server.ListenAndServe()
+	}, serverShutdownTimeout)
+	closeAuditLog()
+	if err != nil {
+		logger.Error("启动服务器失败", logger.Err(err), logger.String("port", port))
+		os.Exit(1)
 	}
+	logger.Info("服务器已停止")
 }
+
@@ -0,0 +1,17 @@
+package server
+
+import (
+	"net/http"
+
+	"kiro2api/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleServerConfig 只读展示启动时加载的服务配置（密钥脱敏）及相关环境变量
+func handleServerConfig(c *gin.Context, cfg *config.ServerConfig) {
+	c.JSON(http.StatusOK, gin.H{
+		"config":      cfg.View(),
+		"environment": collectEffectiveSettings(),
+	})
+}
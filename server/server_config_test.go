@@ -0,0 +1,31 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kiro2api/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleServerConfig_MasksSecrets(t *testing.T) {
+	t.Setenv("KIRO_CLIENT_TOKEN", "client-secret")
+	t.Setenv("ADMIN_PASSWORD", "admin-secret")
+	cfg, err := config.LoadServerConfig()
+	require.NoError(t, err)
+
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/admin/config", nil)
+	handleServerConfig(c, cfg)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"gin_mode":"release"`)
+	assert.NotContains(t, w.Body.String(), "client-secret")
+	assert.NotContains(t, w.Body.String(), "admin-secret")
+}
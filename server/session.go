@@ -15,6 +15,8 @@ const sessionCookieName = "kiro_sid"
 type Session struct {
 	ID        string
 	User      string
+	Role      Role
+	CSRFToken string // 绑定到会话的 CSRF token，登录时随会话一起生成（即每次登录轮换）
 	CreatedAt time.Time
 	LastSeen  time.Time
 }
@@ -44,16 +46,22 @@ func NewSessionManager(idleTimeout, absoluteTimeout time.Duration) *SessionManag
 }
 
 // CreateSession 创建新会话
-func (m *SessionManager) CreateSession(user string) (Session, error) {
+func (m *SessionManager) CreateSession(user string, role Role) (Session, error) {
 	id, err := generateSessionID()
 	if err != nil {
 		return Session{}, err
 	}
+	csrfToken, err := generateCSRFToken()
+	if err != nil {
+		return Session{}, err
+	}
 
 	now := time.Now()
 	s := Session{
 		ID:        id,
 		User:      user,
+		Role:      role,
+		CSRFToken: csrfToken,
 		CreatedAt: now,
 		LastSeen:  now,
 	}
@@ -63,7 +71,8 @@ func (m *SessionManager) CreateSession(user string) (Session, error) {
 	m.mu.Unlock()
 
 	logger.Debug("创建新会话",
-		logger.String("user", user))
+		logger.String("user", user),
+		logger.String("role", string(role)))
 	return s, nil
 }
 
@@ -98,6 +107,27 @@ func (m *SessionManager) Delete(id string) {
 	logger.Debug("会话已删除")
 }
 
+// RevokeUser 删除用户的全部会话，返回删除的会话数
+// 会话在登录时缓存角色，用户被删除或角色变更后需重新登录才能按新角色授权
+func (m *SessionManager) RevokeUser(username string) int {
+	m.mu.Lock()
+	revoked := 0
+	for id, s := range m.sessions {
+		if s.User == username {
+			delete(m.sessions, id)
+			revoked++
+		}
+	}
+	m.mu.Unlock()
+
+	if revoked > 0 {
+		logger.Info("已撤销用户会话",
+			logger.String("username", username),
+			logger.Int("count", revoked))
+	}
+	return revoked
+}
+
 // Close 停止后台清理
 func (m *SessionManager) Close() {
 	close(m.stop)
@@ -146,6 +176,8 @@ func (m *SessionManager) cleanupExpired() {
 }
 
 // isExpired 检查会话是否过期（调用时需持有锁）
+// CreatedAt/LastSeen 均来自 time.Now()，Sub 使用单调时钟计算，
+// NTP校正或手动修改系统时间不会导致会话批量过期
 func (m *SessionManager) isExpired(s Session, now time.Time) bool {
 	// 检查空闲超时
 	if m.idleTimeout > 0 && now.Sub(s.LastSeen) > m.idleTimeout {
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"kiro2api/logger"
+)
+
+// serverShutdownTimeout 收到退出信号后等待在途请求完成的时长，超时后强制关闭连接
+const serverShutdownTimeout = 30 * time.Second
+
+// serveUntilSignal 运行 serve 直到其返回或 ctx 结束（SIGINT/SIGTERM）
+// ctx 结束时停止接收新连接，在 timeout 内等待在途请求完成，之后由调用方关闭审计写入器等资源
+func serveUntilSignal(ctx context.Context, server *http.Server, serve func() error, timeout time.Duration) error {
+	errCh := make(chan error, 1)
+	go func() { errCh <- serve() }()
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return err
+	case <-ctx.Done():
+	}
+
+	logger.Info("收到退出信号，停止接收新请求并等待在途请求完成", logger.Duration("timeout", timeout))
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Warn("等待在途请求超时，强制关闭连接", logger.Err(err))
+		_ = server.Close()
+	}
+
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
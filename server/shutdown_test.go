@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kiro2api/audit"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeUntilSignal_DrainsInflightRequests(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	started := make(chan struct{})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(200 * time.Millisecond)
+		_, _ = io.WriteString(w, "done")
+	})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serveUntilSignal(ctx, srv, func() error { return srv.Serve(listener) }, 5*time.Second)
+	}()
+
+	type result struct {
+		body string
+		err  error
+	}
+	respCh := make(chan result, 1)
+	go func() {
+		resp, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			respCh <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		respCh <- result{body: string(body), err: err}
+	}()
+
+	<-started
+	cancel()
+
+	res := <-respCh
+	require.NoError(t, res.err)
+	assert.Equal(t, "done", res.body, "退出时应等待在途请求完成")
+	require.NoError(t, <-served)
+}
+
+func TestCloseAuditLog_FlushesQueuedRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	writer, err := audit.NewWriter(path, audit.DefaultOptions())
+	require.NoError(t, err)
+
+	orig := auditLog
+	auditLog = writer
+	t.Cleanup(func() { auditLog = orig })
+
+	for i := 0; i < 100; i++ {
+		auditLog.Write(audit.Record{Kind: audit.KindAdmin, Path: "/api/tokens"})
+	}
+	closeAuditLog()
+
+	assert.Equal(t, int64(100), writer.Stats().Written)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"path":"/api/tokens"`)
+}
@@ -0,0 +1,471 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// SSE 中继一致性测试：将录制的上游事件流回放给流式处理器，
+// 再用与官方 SDK 等价的解析逻辑消费输出，事件顺序或字段名漂移时测试失败。
+// 用例位于 testdata/sse_conformance/*.json。
+
+// conformanceCase 一致性测试用例
+type conformanceCase struct {
+	Description string `json:"description"`
+	Upstream    []struct {
+		Event   string          `json:"event"`
+		Payload json.RawMessage `json:"payload"`
+	} `json:"upstream"`
+	Expect struct {
+		Text                string            `json:"text"`
+		Tools               []conformanceTool `json:"tools"`
+		AnthropicStopReason string            `json:"anthropic_stop_reason"`
+		OpenAIFinishReason  string            `json:"openai_finish_reason"`
+	} `json:"expect"`
+}
+
+// conformanceTool 客户端最终拼装出的工具调用
+type conformanceTool struct {
+	ID    string         `json:"-"`
+	Name  string         `json:"name"`
+	Input map[string]any `json:"input"`
+}
+
+// conformanceResult 客户端累积出的最终消息
+type conformanceResult struct {
+	Text       string
+	Tools      []conformanceTool
+	StopReason string
+}
+
+func TestSSEConformance(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	paths, err := filepath.Glob(filepath.Join("testdata", "sse_conformance", "*.json"))
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		var tc conformanceCase
+		require.NoError(t, json.Unmarshal(content, &tc), path)
+
+		var upstream bytes.Buffer
+		for _, ev := range tc.Upstream {
+			upstream.Write(encodeEventStreamFrame(ev.Event, ev.Payload))
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+
+		t.Run(name+"/anthropic", func(t *testing.T) {
+			body := replayStream(t, upstream.Bytes(), func(c *gin.Context, req types.AnthropicRequest) {
+				handleStreamRequest(c, req, &types.TokenWithUsage{})
+			})
+			result := consumeAnthropicStream(t, body)
+			assertConformanceResult(t, tc, result, tc.Expect.AnthropicStopReason)
+		})
+
+		t.Run(name+"/openai", func(t *testing.T) {
+			body := replayStream(t, upstream.Bytes(), func(c *gin.Context, req types.AnthropicRequest) {
+				handleOpenAIStreamRequest(c, req, types.TokenInfo{}, false)
+			})
+			result := consumeOpenAIStream(t, body)
+			assertConformanceResult(t, tc, result, tc.Expect.OpenAIFinishReason)
+		})
+	}
+}
+
+// assertConformanceResult 对比客户端累积结果与用例预期
+func assertConformanceResult(t *testing.T, tc conformanceCase, result conformanceResult, stopReason string) {
+	t.Helper()
+	assert.Equal(t, tc.Expect.Text, result.Text, tc.Description)
+	assert.Equal(t, stopReason, result.StopReason, tc.Description)
+	require.Len(t, result.Tools, len(tc.Expect.Tools), tc.Description)
+
+	seen := make(map[string]bool)
+	for i, want := range tc.Expect.Tools {
+		got := result.Tools[i]
+		assert.NotEmpty(t, got.ID, "工具调用缺少id")
+		assert.False(t, seen[got.ID], "工具调用id重复: %s", got.ID)
+		seen[got.ID] = true
+		assert.Equal(t, want.Name, got.Name)
+		assert.Equal(t, want.Input, got.Input)
+	}
+}
+
+// replayStream 以录制的上游字节流替换 CodeWhisperer 请求并执行流式处理器，返回下游响应体
+func replayStream(t *testing.T, upstream []byte, handler func(*gin.Context, types.AnthropicRequest)) string {
+	t.Helper()
+
+	stubUpstream(t, upstream)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	handler(c, types.AnthropicRequest{Model: "claude-sonnet-4-20250514", MaxTokens: 100, Stream: true})
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/event-stream")
+	return w.Body.String()
+}
+
+// stubUpstream 以录制的上游字节流替换 CodeWhisperer 请求，测试结束后恢复
+func stubUpstream(tb testing.TB, upstream []byte) {
+	original := execCWRequest
+	tb.Cleanup(func() { execCWRequest = original })
+	execCWRequest = func(c *gin.Context, _ types.AnthropicRequest, _ types.TokenInfo, _ bool) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/vnd.amazon.eventstream"}},
+			Body:       io.NopCloser(bytes.NewReader(upstream)),
+		}, nil
+	}
+}
+
+// encodeEventStreamFrame 编码 AWS event-stream 帧
+func encodeEventStreamFrame(eventType string, payload []byte) []byte {
+	var headers bytes.Buffer
+	for _, h := range [][2]string{
+		{":message-type", "event"},
+		{":event-type", eventType},
+		{":content-type", "application/json"},
+	} {
+		headers.WriteByte(byte(len(h[0])))
+		headers.WriteString(h[0])
+		headers.WriteByte(7) // string
+		_ = binary.Write(&headers, binary.BigEndian, uint16(len(h[1])))
+		headers.WriteString(h[1])
+	}
+
+	totalLen := uint32(12 + headers.Len() + len(payload) + 4)
+	var frame bytes.Buffer
+	_ = binary.Write(&frame, binary.BigEndian, totalLen)
+	_ = binary.Write(&frame, binary.BigEndian, uint32(headers.Len()))
+	_ = binary.Write(&frame, binary.BigEndian, crc32.ChecksumIEEE(frame.Bytes()))
+	frame.Write(headers.Bytes())
+	frame.Write(payload)
+	_ = binary.Write(&frame, binary.BigEndian, crc32.ChecksumIEEE(frame.Bytes()))
+	return frame.Bytes()
+}
+
+// sseEvent 解析后的 SSE 事件
+type sseEvent struct {
+	Event string
+	Data  string
+}
+
+// parseSSE 按 SSE 规范拆分事件（空行分隔，多行 data 以换行拼接，忽略注释行）
+func parseSSE(t *testing.T, body string) []sseEvent {
+	t.Helper()
+
+	var events []sseEvent
+	var current sseEvent
+	var data []string
+	flush := func() {
+		if current.Event != "" || len(data) > 0 {
+			current.Data = strings.Join(data, "\n")
+			events = append(events, current)
+		}
+		current, data = sseEvent{}, nil
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			flush()
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "event:"):
+			current.Event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		default:
+			t.Fatalf("无法识别的SSE行: %q", line)
+		}
+	}
+	require.NoError(t, scanner.Err())
+	flush()
+	return events
+}
+
+// consumeAnthropicStream 按 Anthropic SDK 的 MessageStream 累积逻辑消费事件流，
+// 并校验 SDK 依赖的事件顺序与字段
+func consumeAnthropicStream(t *testing.T, body string) conformanceResult {
+	t.Helper()
+
+	type block struct {
+		kind    string
+		id      string
+		name    string
+		text    strings.Builder
+		partial strings.Builder
+		stopped bool
+	}
+
+	events := parseSSE(t, body)
+	require.NotEmpty(t, events)
+
+	var blocks []*block
+	var result conformanceResult
+	started, delta, stopped := false, false, false
+
+	for i, ev := range events {
+		var data map[string]any
+		require.NoError(t, json.Unmarshal([]byte(ev.Data), &data), "事件 %d 不是合法JSON: %s", i, ev.Data)
+		typ, _ := data["type"].(string)
+		require.Equal(t, ev.Event, typ, "事件 %d 的 event 名与 data.type 不一致", i)
+		require.False(t, stopped, "message_stop 之后仍有事件: %s", typ)
+
+		if typ != "message_start" && typ != "ping" {
+			require.True(t, started, "message_start 必须是首个事件，实际为 %s", typ)
+		}
+
+		switch typ {
+		case "ping":
+		case "message_start":
+			require.False(t, started, "重复的 message_start")
+			started = true
+			msg, ok := data["message"].(map[string]any)
+			require.True(t, ok, "message_start 缺少 message")
+			assert.NotEmpty(t, msg["id"])
+			assert.Equal(t, "message", msg["type"])
+			assert.Equal(t, "assistant", msg["role"])
+			assert.NotEmpty(t, msg["model"])
+			assert.IsType(t, []any{}, msg["content"])
+			usage, ok := msg["usage"].(map[string]any)
+			require.True(t, ok, "message_start 缺少 usage")
+			assert.IsType(t, float64(0), usage["input_tokens"])
+
+		case "content_block_start":
+			require.False(t, delta, "message_delta 之后不应再开始内容块")
+			index := requireIndex(t, data)
+			require.Equal(t, len(blocks), index, "content_block_start 的 index 必须连续")
+			for _, b := range blocks {
+				require.True(t, b.stopped, "上一个内容块未结束就开始了新块")
+			}
+			cb, ok := data["content_block"].(map[string]any)
+			require.True(t, ok, "content_block_start 缺少 content_block")
+			b := &block{}
+			b.kind, _ = cb["type"].(string)
+			switch b.kind {
+			case "text":
+				assert.IsType(t, "", cb["text"])
+			case "tool_use":
+				b.id, _ = cb["id"].(string)
+				b.name, _ = cb["name"].(string)
+				require.NotEmpty(t, b.id, "tool_use 块缺少 id")
+				require.NotEmpty(t, b.name, "tool_use 块缺少 name")
+				assert.IsType(t, map[string]any{}, cb["input"])
+			default:
+				t.Fatalf("未知的内容块类型: %v", cb["type"])
+			}
+			blocks = append(blocks, b)
+
+		case "content_block_delta":
+			index := requireIndex(t, data)
+			require.Less(t, index, len(blocks), "content_block_delta 引用了未开始的内容块")
+			b := blocks[index]
+			require.False(t, b.stopped, "content_block_delta 出现在 content_block_stop 之后")
+			d, ok := data["delta"].(map[string]any)
+			require.True(t, ok, "content_block_delta 缺少 delta")
+			switch d["type"] {
+			case "text_delta":
+				require.Equal(t, "text", b.kind, "text_delta 只能出现在 text 块")
+				text, ok := d["text"].(string)
+				require.True(t, ok, "text_delta 缺少 text")
+				b.text.WriteString(text)
+			case "input_json_delta":
+				require.Equal(t, "tool_use", b.kind, "input_json_delta 只能出现在 tool_use 块")
+				partial, ok := d["partial_json"].(string)
+				require.True(t, ok, "input_json_delta 缺少 partial_json")
+				b.partial.WriteString(partial)
+			default:
+				t.Fatalf("未知的 delta 类型: %v", d["type"])
+			}
+
+		case "content_block_stop":
+			index := requireIndex(t, data)
+			require.Less(t, index, len(blocks), "content_block_stop 引用了未开始的内容块")
+			require.False(t, blocks[index].stopped, "重复的 content_block_stop")
+			blocks[index].stopped = true
+
+		case "message_delta":
+			require.False(t, delta, "重复的 message_delta")
+			delta = true
+			for i, b := range blocks {
+				require.True(t, b.stopped, "message_delta 之前内容块 %d 未结束", i)
+			}
+			d, ok := data["delta"].(map[string]any)
+			require.True(t, ok, "message_delta 缺少 delta")
+			result.StopReason, _ = d["stop_reason"].(string)
+			assert.Contains(t, []string{"end_turn", "max_tokens", "stop_sequence", "tool_use"}, result.StopReason)
+			usage, ok := data["usage"].(map[string]any)
+			require.True(t, ok, "message_delta 缺少 usage")
+			assert.IsType(t, float64(0), usage["output_tokens"])
+
+		case "message_stop":
+			require.True(t, delta, "message_stop 之前缺少 message_delta")
+			stopped = true
+
+		default:
+			t.Fatalf("未知的事件类型: %s (%s)", typ, ev.Data)
+		}
+	}
+	require.True(t, stopped, "事件流未以 message_stop 结束")
+
+	var text strings.Builder
+	for _, b := range blocks {
+		switch b.kind {
+		case "text":
+			text.WriteString(b.text.String())
+		case "tool_use":
+			result.Tools = append(result.Tools, conformanceTool{
+				ID:    b.id,
+				Name:  b.name,
+				Input: parseToolArguments(t, b.partial.String()),
+			})
+		}
+	}
+	result.Text = text.String()
+	return result
+}
+
+// consumeOpenAIStream 按 OpenAI SDK 的 chunk 累积逻辑消费事件流，
+// 并校验 SDK 依赖的 chunk 结构、工具调用分片规则与 [DONE] 结束标记
+func consumeOpenAIStream(t *testing.T, body string) conformanceResult {
+	t.Helper()
+
+	type toolCall struct {
+		id        string
+		name      string
+		arguments strings.Builder
+	}
+
+	events := parseSSE(t, body)
+	require.NotEmpty(t, events)
+	require.Equal(t, "[DONE]", events[len(events)-1].Data, "事件流必须以 data: [DONE] 结束")
+
+	var result conformanceResult
+	var text strings.Builder
+	var calls []*toolCall
+	var streamID string
+	finished := false
+
+	for i, ev := range events[:len(events)-1] {
+		assert.Empty(t, ev.Event, "OpenAI 流不应带 event 字段")
+		require.NotEqual(t, "[DONE]", ev.Data, "[DONE] 只能出现在末尾")
+
+		var chunk map[string]any
+		require.NoError(t, json.Unmarshal([]byte(ev.Data), &chunk), "chunk %d 不是合法JSON: %s", i, ev.Data)
+		require.False(t, finished, "finish_reason 之后仍有 chunk: %s", ev.Data)
+
+		id, _ := chunk["id"].(string)
+		require.NotEmpty(t, id, "chunk 缺少 id")
+		if streamID == "" {
+			streamID = id
+		}
+		assert.Equal(t, streamID, id, "同一流内 chunk id 必须一致")
+		assert.Equal(t, "chat.completion.chunk", chunk["object"])
+		assert.IsType(t, float64(0), chunk["created"])
+		assert.NotEmpty(t, chunk["model"])
+
+		choices, ok := chunk["choices"].([]any)
+		require.True(t, ok, "chunk 缺少 choices")
+		require.Len(t, choices, 1)
+		choice := choices[0].(map[string]any)
+		assert.Equal(t, float64(0), choice["index"])
+		d, ok := choice["delta"].(map[string]any)
+		require.True(t, ok, "choice 缺少 delta")
+
+		if i == 0 {
+			assert.Equal(t, "assistant", d["role"], "首个 chunk 必须携带 role")
+		}
+		if content, ok := d["content"].(string); ok {
+			text.WriteString(content)
+		}
+
+		if rawCalls, ok := d["tool_calls"]; ok {
+			list, ok := rawCalls.([]any)
+			require.True(t, ok, "tool_calls 必须是数组")
+			for _, raw := range list {
+				call := raw.(map[string]any)
+				idx, ok := call["index"].(float64)
+				require.True(t, ok, "tool_call 缺少 index")
+				fn, _ := call["function"].(map[string]any)
+
+				if int(idx) == len(calls) {
+					// 新的工具调用：首个分片必须携带 id、type 与函数名
+					callID, _ := call["id"].(string)
+					require.NotEmpty(t, callID, "工具调用首个分片缺少 id")
+					require.Equal(t, "function", call["type"])
+					require.NotNil(t, fn, "工具调用首个分片缺少 function")
+					name, _ := fn["name"].(string)
+					require.NotEmpty(t, name, "工具调用首个分片缺少 function.name")
+					calls = append(calls, &toolCall{id: callID, name: name})
+				}
+				require.Less(t, int(idx), len(calls), "tool_call index 不连续")
+				if fn != nil {
+					if args, ok := fn["arguments"].(string); ok {
+						calls[int(idx)].arguments.WriteString(args)
+					}
+				}
+			}
+		}
+
+		if reason, ok := choice["finish_reason"].(string); ok {
+			assert.Contains(t, []string{"stop", "length", "tool_calls", "content_filter"}, reason)
+			result.StopReason = reason
+			finished = true
+		} else {
+			assert.Nil(t, choice["finish_reason"], "finish_reason 只能为字符串或 null")
+		}
+	}
+	require.True(t, finished, "事件流缺少 finish_reason")
+
+	result.Text = text.String()
+	for _, call := range calls {
+		result.Tools = append(result.Tools, conformanceTool{
+			ID:    call.id,
+			Name:  call.name,
+			Input: parseToolArguments(t, call.arguments.String()),
+		})
+	}
+	return result
+}
+
+// requireIndex 读取事件中的 index 字段
+func requireIndex(t *testing.T, data map[string]any) int {
+	t.Helper()
+	index, ok := data["index"].(float64)
+	require.True(t, ok, "事件缺少 index: %v", data)
+	return int(index)
+}
+
+// parseToolArguments 解析拼接后的工具参数，空参数按 SDK 行为视为 {}
+func parseToolArguments(t *testing.T, raw string) map[string]any {
+	t.Helper()
+	input := map[string]any{}
+	if strings.TrimSpace(raw) == "" {
+		return input
+	}
+	require.NoError(t, json.Unmarshal([]byte(raw), &input), fmt.Sprintf("工具参数不是合法JSON: %s", raw))
+	return input
+}
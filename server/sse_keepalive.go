@@ -0,0 +1,137 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"kiro2api/logger"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseKeepaliveInterval 流式响应空闲多久后发送保活注释（SSE_KEEPALIVE_SECONDS，默认15秒，0关闭）
+// 长时间的工具调用或推理停顿期间无数据下发，部分反向代理与客户端会断开空闲连接
+// StartServer 在加载配置后经 loadSSEKeepaliveIntervalFromEnv 设置
+var sseKeepaliveInterval = 15 * time.Second
+
+// loadSSEKeepaliveIntervalFromEnv 从环境变量读取保活间隔（SSE_KEEPALIVE_SECONDS）
+func loadSSEKeepaliveIntervalFromEnv() time.Duration {
+	return time.Duration(utils.GetEnvIntWithDefault("SSE_KEEPALIVE_SECONDS", 15)) * time.Second
+}
+
+// sseKeepaliveComment SSE注释行，客户端按规范忽略
+const sseKeepaliveComment = ": ping\n\n"
+
+// setSSEHeaders 设置SSE响应头，禁用浏览器与反向代理（nginx等）的缓存和缓冲
+func setSSEHeaders(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream; charset=utf-8")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+}
+
+// keepaliveWriter 串行化写入的 ResponseWriter
+// 事件由多次写入拼成（event行、data行），保活注释只能插在事件边界（上次写入以空行结尾）处
+type keepaliveWriter struct {
+	gin.ResponseWriter
+	mu         sync.Mutex
+	lastWrite  time.Time
+	lastByte   byte
+	atBoundary bool
+}
+
+func (w *keepaliveWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n, err := w.ResponseWriter.Write(p)
+	w.track(p[:n])
+	return n, err
+}
+
+func (w *keepaliveWriter) WriteString(s string) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n, err := w.ResponseWriter.WriteString(s)
+	w.track([]byte(s[:n]))
+	return n, err
+}
+
+func (w *keepaliveWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.ResponseWriter.Flush()
+}
+
+// track 记录写入时间与是否停在事件边界（调用时需持有锁）
+func (w *keepaliveWriter) track(p []byte) {
+	if len(p) == 0 {
+		return
+	}
+	prev := w.lastByte
+	if len(p) > 1 {
+		prev = p[len(p)-2]
+	}
+	w.lastByte = p[len(p)-1]
+	w.atBoundary = prev == '\n' && w.lastByte == '\n'
+	w.lastWrite = time.Now()
+}
+
+// pingIfIdle 空闲超过间隔且位于事件边界时写入保活注释，返回写入错误（客户端已断开）
+func (w *keepaliveWriter) pingIfIdle(interval time.Duration, now time.Time) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.atBoundary || now.Sub(w.lastWrite) < interval {
+		return nil
+	}
+	if _, err := w.ResponseWriter.WriteString(sseKeepaliveComment); err != nil {
+		return err
+	}
+	w.ResponseWriter.Flush()
+	w.lastWrite = now
+	return nil
+}
+
+// startSSEKeepalive 为流式响应启动保活：空闲超过间隔时在事件边界写入 `: ping` 注释
+// 返回的 stop 函数需在处理器返回前调用，停止后台协程并恢复原始 Writer
+func startSSEKeepalive(c *gin.Context, interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		return func() {}
+	}
+
+	original := c.Writer
+	w := &keepaliveWriter{ResponseWriter: original, lastWrite: time.Now(), atBoundary: true}
+	c.Writer = w
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// 以半个间隔检查，保证空闲时间不超过约1.5个间隔
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-c.Request.Context().Done():
+				return
+			case now := <-ticker.C:
+				if err := w.pingIfIdle(interval, now); err != nil {
+					logger.Debug("发送SSE保活注释失败，停止保活", addReqFields(c, logger.Err(err))...)
+					return
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			wg.Wait()
+			c.Writer = original
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSSEKeepalive_PingsOnlyAtEventBoundary(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	original := c.Writer
+
+	stop := startSSEKeepalive(c, 20*time.Millisecond)
+
+	// 事件写到一半时停顿，不能插入注释
+	_, _ = c.Writer.WriteString("event: ping\n")
+	time.Sleep(80 * time.Millisecond)
+	_, _ = c.Writer.WriteString("data: {}\n\n")
+	time.Sleep(80 * time.Millisecond)
+	stop()
+	stop()
+
+	body := w.Body.String()
+	require.True(t, strings.HasPrefix(body, "event: ping\ndata: {}\n\n"+sseKeepaliveComment), body)
+	assert.Same(t, original, c.Writer, "停止后恢复原始Writer")
+}
+
+func TestSSEKeepalive_Disabled(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	original := c.Writer
+
+	stop := startSSEKeepalive(c, 0)
+	assert.Same(t, original, c.Writer)
+	stop()
+}
+
+func TestSetSSEHeaders(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	setSSEHeaders(c)
+
+	assert.Equal(t, "no", w.Header().Get("X-Accel-Buffering"))
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/event-stream")
+}
+
+func TestLoadSSEKeepaliveIntervalFromEnv(t *testing.T) {
+	t.Setenv("SSE_KEEPALIVE_SECONDS", "")
+	assert.Equal(t, 15*time.Second, loadSSEKeepaliveIntervalFromEnv())
+	t.Setenv("SSE_KEEPALIVE_SECONDS", "0")
+	assert.Equal(t, time.Duration(0), loadSSEKeepaliveIntervalFromEnv())
+}
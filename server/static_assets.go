@@ -0,0 +1,151 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"kiro2api/config"
+	"kiro2api/static"
+
+	"github.com/gin-gonic/gin"
+)
+
+// staticAssetRefPattern HTML 中引用的 /static/ 下的 CSS/JS 地址
+var staticAssetRefPattern = regexp.MustCompile(`(/static/[^"'?#]+\.(?:css|js))(["'])`)
+
+// staticFile 预处理后的静态资源
+type staticFile struct {
+	content     []byte
+	contentType string
+	etag        string
+}
+
+// staticAssets Dashboard 静态资源，启动时从内嵌文件系统加载
+// HTML 中的 CSS/JS 引用追加 ?v=<版本> 作为缓存版本戳
+type staticAssets struct {
+	version string
+	files   map[string]staticFile // 相对路径（如 css/dashboard.css）-> 资源
+}
+
+// loadStaticAssets 读取文件系统中的全部资源（跳过 Go 源文件）
+// version 为空时使用资源内容摘要作为版本戳
+func loadStaticAssets(fsys fs.FS, version string) (*staticAssets, error) {
+	raw := make(map[string][]byte)
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.HasSuffix(name, ".go") {
+			return nil
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		raw[name] = content
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("读取静态资源失败: %w", err)
+	}
+	if _, ok := raw["index.html"]; !ok {
+		return nil, fmt.Errorf("静态资源缺少 index.html")
+	}
+	if _, ok := raw["login.html"]; !ok {
+		return nil, fmt.Errorf("静态资源缺少 login.html")
+	}
+
+	if version == "" {
+		version = contentDigest(raw)
+	}
+	assets := &staticAssets{version: version, files: make(map[string]staticFile, len(raw))}
+	for name, content := range raw {
+		if strings.HasSuffix(name, ".html") {
+			content = staticAssetRefPattern.ReplaceAll(content, []byte("${1}?v="+version+"${2}"))
+		}
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = http.DetectContentType(content)
+		}
+		sum := sha256.Sum256(content)
+		assets.files[name] = staticFile{
+			content:     content,
+			contentType: contentType,
+			etag:        `"` + hex.EncodeToString(sum[:8]) + `"`,
+		}
+	}
+	return assets, nil
+}
+
+// contentDigest 计算全部资源内容的摘要（按路径排序）
+func contentDigest(files map[string][]byte) string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		h.Write([]byte(name))
+		h.Write(files[name])
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// staticAssetVersion 构建时注入的版本号作为缓存版本戳，开发构建返回空（使用内容摘要）
+func staticAssetVersion() string {
+	if config.Version == "" || config.Version == "dev" {
+		return ""
+	}
+	return config.Version
+}
+
+// serve 返回指定资源，支持 ETag 协商缓存
+// HTML 不缓存；带有当前版本戳的 CSS/JS 长期缓存，其余每次重新验证
+func (a *staticAssets) serve(c *gin.Context, name string) {
+	file, ok := a.files[name]
+	if !ok {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case strings.HasSuffix(name, ".html"):
+		c.Header("Cache-Control", "no-cache")
+	case c.Query("v") == a.version:
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	default:
+		c.Header("Cache-Control", "no-cache")
+	}
+	c.Header("ETag", file.etag)
+	// 启用响应压缩时 ETag 会被改为弱 ETag，协商时忽略 W/ 前缀
+	if strings.TrimPrefix(c.GetHeader("If-None-Match"), "W/") == file.etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, file.contentType, file.content)
+}
+
+// handler 处理 /static/*filepath
+func (a *staticAssets) handler(c *gin.Context) {
+	name := strings.TrimPrefix(path.Clean("/"+c.Param("filepath")), "/")
+	a.serve(c, name)
+}
+
+// mustLoadEmbeddedAssets 加载内嵌的 Dashboard 资源，资源缺失属于构建错误
+func mustLoadEmbeddedAssets() *staticAssets {
+	assets, err := loadStaticAssets(static.Files, staticAssetVersion())
+	if err != nil {
+		panic(fmt.Sprintf("加载内嵌静态资源失败: %v", err))
+	}
+	return assets
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newStaticRouter(assets *staticAssets) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/static/*filepath", assets.handler)
+	return r
+}
+
+func getStatic(r *gin.Engine, target string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestEmbeddedAssets_IncludeDashboard(t *testing.T) {
+	assets := mustLoadEmbeddedAssets()
+	r := newStaticRouter(assets)
+
+	for _, target := range []string{"/static/login.html", "/static/index.html", "/static/js/dashboard.js", "/static/css/login.css"} {
+		w := getStatic(r, target, nil)
+		assert.Equal(t, http.StatusOK, w.Code, target)
+		assert.NotEmpty(t, w.Body.String(), target)
+	}
+
+	w := getStatic(r, "/static/login.html", nil)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), "/static/js/login.js?v="+assets.version, "HTML 引用追加版本戳")
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+
+	assert.Equal(t, http.StatusNotFound, getStatic(r, "/static/embed.go", nil).Code, "不暴露 Go 源文件")
+	assert.Equal(t, http.StatusNotFound, getStatic(r, "/static/../go.mod", nil).Code)
+}
+
+func TestStaticAssets_CacheHeaders(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":  {Data: []byte(`<link href="/static/css/app.css"><script src='/static/js/app.js'></script>`)},
+		"login.html":  {Data: []byte(`<html></html>`)},
+		"css/app.css": {Data: []byte(`body{}`)},
+		"js/app.js":   {Data: []byte(`console.log(1)`)},
+	}
+	assets, err := loadStaticAssets(fsys, "v1.2.3")
+	require.NoError(t, err)
+	assert.Equal(t, `<link href="/static/css/app.css?v=v1.2.3"><script src='/static/js/app.js?v=v1.2.3'></script>`,
+		string(assets.files["index.html"].content))
+
+	r := newStaticRouter(assets)
+	w := getStatic(r, "/static/css/app.css?v=v1.2.3", nil)
+	assert.Equal(t, "public, max-age=31536000, immutable", w.Header().Get("Cache-Control"))
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/css")
+
+	w = getStatic(r, "/static/css/app.css?v=old", nil)
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"), "旧版本戳需要重新验证")
+
+	etag := w.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	w = getStatic(r, "/static/css/app.css", map[string]string{"If-None-Match": etag})
+	assert.Equal(t, http.StatusNotModified, w.Code)
+	assert.Empty(t, w.Body.String())
+}
+
+func TestLoadStaticAssets_MissingPages(t *testing.T) {
+	_, err := loadStaticAssets(fstest.MapFS{"index.html": {Data: []byte("x")}}, "")
+	assert.Error(t, err, "缺少 login.html 时启动失败")
+
+	assets, err := loadStaticAssets(fstest.MapFS{
+		"index.html": {Data: []byte("a")},
+		"login.html": {Data: []byte("b")},
+	}, "")
+	require.NoError(t, err)
+	assert.Len(t, assets.version, 12, "开发构建使用内容摘要作为版本戳")
+}
@@ -0,0 +1,198 @@
+package server
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"kiro2api/logger"
+	"kiro2api/types"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// conversationIDHeader 客户端显式指定会话ID的请求头
+const conversationIDHeader = "X-Conversation-ID"
+
+// conversationKeyKey 上下文中保存的会话键，切换token重试后更新粘性账号
+const conversationKeyKey = "conversation_key"
+
+// maxConversationIDLength 显式会话ID的最大长度，超过时截断
+const maxConversationIDLength = 256
+
+// stickyRoutes 会话粘性路由表（nil 表示未启用）
+var stickyRoutes *StickyRouter
+
+// stickyTokenSource 支持优先选择指定账号的token来源（AuthService 实现）
+type stickyTokenSource interface {
+	GetTokenForModelPreferring(model, preferID string) (types.TokenInfo, error)
+	GetTokenWithUsageForModelPreferring(model, preferID string) (*types.TokenWithUsage, error)
+}
+
+// StickyRouter 会话到账号的粘性映射（LRU + TTL）
+// 同一会话的请求优先使用上次的账号，提升上游缓存与会话亲和性；账号不可用时回退到顺序策略并改绑
+type StickyRouter struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu    sync.Mutex
+	order *list.List // 最近使用的在前
+	items map[string]*list.Element
+	now   func() time.Time
+}
+
+type stickyEntry struct {
+	key       string
+	configID  string
+	expiresAt time.Time
+}
+
+// LoadStickyRouterFromEnv 从环境变量加载会话粘性路由，未启用时返回 nil
+// - STICKY_ROUTING_TTL_SECONDS: 会话空闲多久后解除绑定（默认0，关闭）
+// - STICKY_ROUTING_MAX_ENTRIES: 最多记录的会话数，超过时淘汰最久未使用的（默认10000）
+func LoadStickyRouterFromEnv() (*StickyRouter, error) {
+	ttlSeconds := utils.GetEnvIntWithDefault("STICKY_ROUTING_TTL_SECONDS", 0)
+	if ttlSeconds < 0 {
+		return nil, fmt.Errorf("STICKY_ROUTING_TTL_SECONDS 不能为负数")
+	}
+	if ttlSeconds == 0 {
+		return nil, nil
+	}
+	maxEntries := utils.GetEnvIntWithDefault("STICKY_ROUTING_MAX_ENTRIES", 10000)
+	if maxEntries <= 0 {
+		return nil, fmt.Errorf("STICKY_ROUTING_MAX_ENTRIES 必须大于0")
+	}
+	return NewStickyRouter(time.Duration(ttlSeconds)*time.Second, maxEntries), nil
+}
+
+// NewStickyRouter 创建会话粘性路由表
+func NewStickyRouter(ttl time.Duration, maxEntries int) *StickyRouter {
+	return &StickyRouter{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		order:      list.New(),
+		items:      make(map[string]*list.Element),
+		now:        time.Now,
+	}
+}
+
+// Lookup 返回会话绑定的账号ID，未绑定或已过期时返回空串
+func (r *StickyRouter) Lookup(key string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	elem, ok := r.items[key]
+	if !ok {
+		return ""
+	}
+	entry := elem.Value.(*stickyEntry)
+	if !r.now().Before(entry.expiresAt) {
+		r.order.Remove(elem)
+		delete(r.items, key)
+		return ""
+	}
+	return entry.configID
+}
+
+// Remember 将会话绑定到账号并续期
+func (r *StickyRouter) Remember(key, configID string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	expiresAt := r.now().Add(r.ttl)
+	if elem, ok := r.items[key]; ok {
+		entry := elem.Value.(*stickyEntry)
+		entry.configID, entry.expiresAt = configID, expiresAt
+		r.order.MoveToFront(elem)
+		return
+	}
+	r.items[key] = r.order.PushFront(&stickyEntry{key: key, configID: configID, expiresAt: expiresAt})
+	for r.order.Len() > r.maxEntries {
+		oldest := r.order.Back()
+		r.order.Remove(oldest)
+		delete(r.items, oldest.Value.(*stickyEntry).key)
+	}
+}
+
+// Len 当前记录的会话数（含尚未清理的过期条目）
+func (r *StickyRouter) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.order.Len()
+}
+
+// conversationKey 计算会话键：X-Conversation-ID 请求头，或第一条用户消息内容的 SHA-256
+// 会话键带调用方密钥前缀，不同密钥的相同会话互不影响；无法识别会话时返回空串
+func conversationKey(c *gin.Context, body []byte) string {
+	prefix := GetClientKeyID(c) + "|"
+	if id := strings.TrimSpace(c.GetHeader(conversationIDHeader)); id != "" {
+		if len(id) > maxConversationIDLength {
+			id = id[:maxConversationIDLength]
+		}
+		return prefix + "id:" + id
+	}
+
+	// Anthropic 与 OpenAI 请求的 messages 结构一致（role + content）
+	var req struct {
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	if err := utils.FastUnmarshal(body, &req); err != nil {
+		return ""
+	}
+	for _, msg := range req.Messages {
+		if msg.Role != "user" || len(msg.Content) == 0 {
+			continue
+		}
+		// 去掉空白差异，客户端重新序列化历史消息时保持稳定
+		var compact bytes.Buffer
+		content := []byte(msg.Content)
+		if err := json.Compact(&compact, content); err == nil {
+			content = compact.Bytes()
+		}
+		sum := sha256.Sum256(content)
+		return prefix + "msg:" + hex.EncodeToString(sum[:])
+	}
+	return ""
+}
+
+// stickyPreference 识别请求所属会话并返回绑定的账号ID（未启用、无法识别会话或未绑定时返回空串）
+func stickyPreference(c *gin.Context, body []byte) string {
+	if stickyRoutes == nil {
+		return ""
+	}
+	key := conversationKey(c, body)
+	if key == "" {
+		return ""
+	}
+	c.Set(conversationKeyKey, key)
+	return stickyRoutes.Lookup(key)
+}
+
+// rememberStickyToken 将请求所属会话绑定到实际使用的账号；与原绑定不同时记录回退
+func rememberStickyToken(c *gin.Context, previousID, configID string) {
+	if stickyRoutes == nil || configID == "" {
+		return
+	}
+	key := c.GetString(conversationKeyKey)
+	if key == "" {
+		return
+	}
+	if previousID != "" && previousID != configID {
+		logger.Info("会话粘性账号不可用，改绑到其他账号",
+			addReqFields(c,
+				logger.String("from_config", previousID),
+				logger.String("to_config", configID),
+			)...)
+	}
+	stickyRoutes.Remember(key, configID)
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kiro2api/auth"
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stickyFakeSource 按账号顺序轮换的token来源，优先返回可用的指定账号
+type stickyFakeSource struct {
+	accounts  []string
+	down      map[string]bool
+	next      int
+	preferred []string // 每次请求的 preferID
+}
+
+func (f *stickyFakeSource) GetTokenForModel(model string) (types.TokenInfo, error) {
+	return f.GetTokenForModelPreferring(model, "")
+}
+
+func (f *stickyFakeSource) GetTokenWithUsageForModel(model string) (*types.TokenWithUsage, error) {
+	return f.GetTokenWithUsageForModelPreferring(model, "")
+}
+
+func (f *stickyFakeSource) GetTokenForModelPreferring(model, preferID string) (types.TokenInfo, error) {
+	f.preferred = append(f.preferred, preferID)
+	if preferID != "" && !f.down[preferID] {
+		return types.TokenInfo{ConfigID: preferID, AccessToken: preferID}, nil
+	}
+	for range f.accounts {
+		id := f.accounts[f.next%len(f.accounts)]
+		f.next++
+		if !f.down[id] {
+			return types.TokenInfo{ConfigID: id, AccessToken: id}, nil
+		}
+	}
+	return types.TokenInfo{}, auth.ErrTokenPoolExhausted
+}
+
+func (f *stickyFakeSource) GetTokenWithUsageForModelPreferring(model, preferID string) (*types.TokenWithUsage, error) {
+	token, err := f.GetTokenForModelPreferring(model, preferID)
+	if err != nil {
+		return nil, err
+	}
+	return &types.TokenWithUsage{TokenInfo: token, AvailableCount: 10}, nil
+}
+
+func newStickyContext(body, conversationID, clientKey string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("POST", "/v1/messages", bytes.NewBufferString(body))
+	if conversationID != "" {
+		c.Request.Header.Set(conversationIDHeader, conversationID)
+	}
+	c.Set(clientKeyIDKey, clientKey)
+	return c
+}
+
+func TestConversationKey(t *testing.T) {
+	first := `{"messages":[{"role":"user","content":"写一首诗"}]}`
+	followUp := `{"messages":[
+		{"role": "user", "content": "写一首诗"},
+		{"role": "assistant", "content": "床前明月光"},
+		{"role": "user", "content": "再来一首"}]}`
+	openai := `{"messages":[{"role":"system","content":"你是诗人"},{"role":"user","content":"写一首诗"}]}`
+
+	key := conversationKey(newStickyContext(first, "", "k1"), []byte(first))
+	require.NotEmpty(t, key)
+	assert.Equal(t, key, conversationKey(newStickyContext(followUp, "", "k1"), []byte(followUp)), "后续轮次与首轮属于同一会话")
+	assert.Equal(t, key, conversationKey(newStickyContext(openai, "", "k1"), []byte(openai)), "跳过系统消息")
+	assert.NotEqual(t, key, conversationKey(newStickyContext(first, "", "k2"), []byte(first)), "不同调用方密钥互不影响")
+
+	explicit := conversationKey(newStickyContext(first, "conv-1", "k1"), []byte(first))
+	assert.Equal(t, "k1|id:conv-1", explicit)
+	assert.Empty(t, conversationKey(newStickyContext(`{"messages":[]}`, "", "k1"), []byte(`{"messages":[]}`)))
+}
+
+func TestStickyRouter_TTLAndLRU(t *testing.T) {
+	r := NewStickyRouter(time.Minute, 2)
+	now := time.Now()
+	r.now = func() time.Time { return now }
+
+	r.Remember("a", "cfg-1")
+	r.Remember("b", "cfg-2")
+	r.Remember("a", "cfg-3") // 改绑并变为最近使用
+	r.Remember("c", "cfg-4")
+	assert.Equal(t, "cfg-3", r.Lookup("a"))
+	assert.Empty(t, r.Lookup("b"), "最久未使用的会话被淘汰")
+
+	now = now.Add(time.Minute)
+	assert.Empty(t, r.Lookup("a"), "空闲超过TTL后解除绑定")
+	assert.Equal(t, 1, r.Len())
+}
+
+func TestRequestContext_StickyRouting(t *testing.T) {
+	original := stickyRoutes
+	stickyRoutes = NewStickyRouter(time.Minute, 100)
+	defer func() { stickyRoutes = original }()
+
+	source := &stickyFakeSource{accounts: []string{"a", "b", "c"}, down: map[string]bool{}}
+	send := func(body, conversationID string) string {
+		c := newStickyContext(body, conversationID, "k1")
+		reqCtx := &RequestContext{GinContext: c, AuthService: source, RequestType: "test"}
+		token, _, err := reqCtx.GetTokenWithUsageAndBody()
+		require.NoError(t, err)
+		return token.ConfigID
+	}
+
+	conv1 := `{"model":"m","messages":[{"role":"user","content":"任务一"}]}`
+	conv2 := `{"model":"m","messages":[{"role":"user","content":"任务二"}]}`
+	assert.Equal(t, "a", send(conv1, ""))
+	assert.Equal(t, "b", send(conv2, ""))
+	assert.Equal(t, "a", send(conv1, ""), "同一会话使用同一账号")
+	assert.Equal(t, "b", send(conv2, ""))
+	assert.Equal(t, []string{"", "", "a", "b"}, source.preferred)
+
+	// 粘性账号不可用时回退并改绑
+	source.down["a"] = true
+	fallback := send(conv1, "")
+	assert.NotEqual(t, "a", fallback)
+	source.down["a"] = false
+	assert.Equal(t, fallback, send(conv1, ""))
+
+	// 显式会话ID优先于消息内容
+	explicit := send(conv2, "explicit")
+	assert.Equal(t, explicit, send(conv1, "explicit"))
+	assert.Equal(t, fallback, send(conv1, ""))
+}
+
+func TestLoadStickyRouterFromEnv(t *testing.T) {
+	t.Setenv("STICKY_ROUTING_TTL_SECONDS", "")
+	r, err := LoadStickyRouterFromEnv()
+	require.NoError(t, err)
+	assert.Nil(t, r)
+
+	t.Setenv("STICKY_ROUTING_TTL_SECONDS", "600")
+	r, err = LoadStickyRouterFromEnv()
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, 10*time.Minute, r.ttl)
+	assert.Equal(t, 10000, r.maxEntries)
+
+	t.Setenv("STICKY_ROUTING_MAX_ENTRIES", "0")
+	_, err = LoadStickyRouterFromEnv()
+	assert.Error(t, err)
+}
@@ -9,6 +9,10 @@ import (
 type StopReasonManager struct {
 	hasActiveToolCalls bool
 	hasCompletedTools  bool
+
+	// 客户端侧输出限制触发的结束原因（stop_sequence 或 max_tokens），优先于工具调用
+	outputLimitReason string
+	stopSequence      string
 }
 
 // NewStopReasonManager 创建stop_reason管理器
@@ -29,8 +33,23 @@ func (srm *StopReasonManager) UpdateToolCallStatus(hasActiveCalls, hasCompleted
 		logger.Bool("has_completed_tools", hasCompleted))
 }
 
+// MarkOutputLimit 记录 stop_sequences 或 max_tokens 截断导致的结束
+func (srm *StopReasonManager) MarkOutputLimit(reason, stopSequence string) {
+	srm.outputLimitReason = reason
+	srm.stopSequence = stopSequence
+}
+
+// StopSequence 返回命中的停止序列（未命中时为空）
+func (srm *StopReasonManager) StopSequence() string {
+	return srm.stopSequence
+}
+
 // DetermineStopReason 根据Claude官方规范确定stop_reason
 func (srm *StopReasonManager) DetermineStopReason() string {
+	// 输出在停止序列或 max_tokens 处被截断，之后的内容（包括工具调用）不会下发
+	if srm.outputLimitReason != "" {
+		return srm.outputLimitReason
+	}
 
 	// 检查是否有工具调用（活跃或已完成）
 	// *** 关键修复：根据Claude规范，只要消息包含tool_use块，stop_reason就应该是tool_use ***
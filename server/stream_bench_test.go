@@ -0,0 +1,92 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"kiro2api/types"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 流式转换路径的分配基准：回放1000个文本分片的上游事件流
+// 对比复用缓冲区前后：go test ./server -run '^$' -bench Stream1000 -benchmem
+
+// benchmarkUpstream1000 构造包含1000个 assistantResponseEvent 的上游事件流
+func benchmarkUpstream1000() []byte {
+	var upstream bytes.Buffer
+	for i := range 1000 {
+		payload := fmt.Sprintf(`{"content":"第%d段 The quick brown fox jumps over the lazy dog."}`, i)
+		upstream.Write(encodeEventStreamFrame("assistantResponseEvent", []byte(payload)))
+	}
+	return upstream.Bytes()
+}
+
+func benchmarkReplay(b *testing.B, handler func(*gin.Context, types.AnthropicRequest)) {
+	gin.SetMode(gin.TestMode)
+	upstream := benchmarkUpstream1000()
+	req := types.AnthropicRequest{Model: "claude-sonnet-4-20250514", MaxTokens: 1 << 20, Stream: true}
+
+	stubUpstream(b, upstream)
+	b.ReportAllocs()
+	for b.Loop() {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/v1/messages", nil)
+		handler(c, req)
+	}
+}
+
+func BenchmarkAnthropicStream1000Chunks(b *testing.B) {
+	benchmarkReplay(b, func(c *gin.Context, req types.AnthropicRequest) {
+		handleStreamRequest(c, req, &types.TokenWithUsage{})
+	})
+}
+
+func BenchmarkOpenAIStream1000Chunks(b *testing.B) {
+	benchmarkReplay(b, func(c *gin.Context, req types.AnthropicRequest) {
+		handleOpenAIStreamRequest(c, req, types.TokenInfo{}, false)
+	})
+}
+
+// BenchmarkSSEEventEncoding 单个 SSE 事件的组装：fmt 逐段写出（改动前） vs 复用缓冲区一次写出
+func BenchmarkSSEEventEncoding(b *testing.B) {
+	event := map[string]any{
+		"type":  "content_block_delta",
+		"index": 0,
+		"delta": map[string]any{"type": "text_delta", "text": "The quick brown fox jumps over the lazy dog."},
+	}
+
+	b.Run("fmt", func(b *testing.B) {
+		var out bytes.Buffer
+		b.ReportAllocs()
+		for b.Loop() {
+			out.Reset()
+			data, err := utils.SafeMarshal(event)
+			if err != nil {
+				b.Fatal(err)
+			}
+			fmt.Fprintf(&out, "event: %s\n", "content_block_delta")
+			fmt.Fprintf(&out, "data: %s\n\n", string(data))
+		}
+	})
+
+	b.Run("pooled", func(b *testing.B) {
+		var out bytes.Buffer
+		b.ReportAllocs()
+		for b.Loop() {
+			out.Reset()
+			buf := utils.GetBuffer()
+			buf.WriteString("event: content_block_delta\ndata: ")
+			if err := utils.AppendJSON(buf, event); err != nil {
+				b.Fatal(err)
+			}
+			buf.WriteString("\n\n")
+			out.Write(buf.Bytes())
+			utils.PutBuffer(buf)
+		}
+	})
+}
@@ -0,0 +1,121 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"kiro2api/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// errClientDisconnected 写入下游失败，客户端已断开
+var errClientDisconnected = errors.New("客户端已断开")
+
+// streamMetrics 流式响应结果计数
+var streamMetrics struct {
+	active          atomic.Int64 // 进行中的流
+	started         atomic.Int64 // 开始的流
+	completed       atomic.Int64 // 正常结束的流
+	clientCancelled atomic.Int64 // 客户端中途断开、上游请求被取消的流
+	adminCancelled  atomic.Int64 // 管理员取消的流
+	upstreamErrors  atomic.Int64 // 上游中途失败的流
+	failed          atomic.Int64 // 上游请求失败或流处理出错的流
+	timeouts        atomic.Int64 // 超过请求最大时长的流
+}
+
+// StreamStats 流式响应统计快照
+type StreamStats struct {
+	Active          int64 `json:"active"`
+	Started         int64 `json:"started"`
+	Completed       int64 `json:"completed"`
+	ClientCancelled int64 `json:"client_cancelled"`
+	AdminCancelled  int64 `json:"admin_cancelled"`
+	UpstreamErrors  int64 `json:"upstream_errors"`
+	Failed          int64 `json:"failed"`
+	Timeouts        int64 `json:"timeouts"`
+}
+
+// GetStreamStats 返回流式响应统计
+func GetStreamStats() StreamStats {
+	m := &streamMetrics
+	return StreamStats{
+		Active:          m.active.Load(),
+		Started:         m.started.Load(),
+		Completed:       m.completed.Load(),
+		ClientCancelled: m.clientCancelled.Load(),
+		AdminCancelled:  m.adminCancelled.Load(),
+		UpstreamErrors:  m.upstreamErrors.Load(),
+		Failed:          m.failed.Load(),
+		Timeouts:        m.timeouts.Load(),
+	}
+}
+
+// handleStreamStats 返回流式响应统计
+func handleStreamStats(c *gin.Context) {
+	c.JSON(http.StatusOK, GetStreamStats())
+}
+
+// trackStream 为流式请求绑定可取消的上下文，须在发起上游请求前调用
+// 客户端断开（请求上下文被取消或写入下游失败）时立即取消上游请求与读取，上游不再继续生成；
+// 返回的 finish 在流结束时调用，按结果计数，err 为流处理返回的错误
+func trackStream(c *gin.Context) (finish func(err error)) {
+	ctx, cancel := context.WithCancelCause(c.Request.Context())
+	c.Request = c.Request.WithContext(ctx)
+	c.Writer = &disconnectWriter{ResponseWriter: c.Writer, cancel: cancel}
+
+	streamMetrics.started.Add(1)
+	streamMetrics.active.Add(1)
+	return func(err error) {
+		defer cancel(nil)
+		streamMetrics.active.Add(-1)
+
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			streamMetrics.timeouts.Add(1)
+		case errors.Is(context.Cause(ctx), errCancelledByAdmin):
+			streamMetrics.adminCancelled.Add(1)
+		case ctx.Err() != nil:
+			streamMetrics.clientCancelled.Add(1)
+			logger.Info("客户端中途断开，已取消上游请求",
+				addReqFields(c, logger.String("cause", context.Cause(ctx).Error()))...)
+		case streamErrorCode(err) != "":
+			streamMetrics.upstreamErrors.Add(1)
+		case err != nil:
+			streamMetrics.failed.Add(1)
+		default:
+			streamMetrics.completed.Add(1)
+		}
+	}
+}
+
+// clientGone 客户端是否已断开（请求上下文被取消但不是因为超过最大时长或管理员取消）
+func clientGone(c *gin.Context) bool {
+	err := c.Request.Context().Err()
+	return err != nil && !errors.Is(err, context.DeadlineExceeded) && !cancelledByAdmin(c)
+}
+
+// disconnectWriter 写入下游失败时取消请求上下文
+// 连接断开后服务端可能要等下一次读取才取消请求上下文，写入失败是更早的信号
+type disconnectWriter struct {
+	gin.ResponseWriter
+	cancel context.CancelCauseFunc
+}
+
+func (w *disconnectWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	if err != nil {
+		w.cancel(errClientDisconnected)
+	}
+	return n, err
+}
+
+func (w *disconnectWriter) WriteString(s string) (int, error) {
+	n, err := w.ResponseWriter.WriteString(s)
+	if err != nil {
+		w.cancel(errClientDisconnected)
+	}
+	return n, err
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// blockingBody 先返回 first，之后阻塞到上游请求上下文被取消（与真实 Transport 行为一致）
+type blockingBody struct {
+	ctx     context.Context
+	first   []byte
+	onBlock func()
+}
+
+func (b *blockingBody) Read(p []byte) (int, error) {
+	if len(b.first) > 0 {
+		n := copy(p, b.first)
+		b.first = b.first[n:]
+		return n, nil
+	}
+	if b.onBlock != nil {
+		b.onBlock()
+		b.onBlock = nil
+	}
+	<-b.ctx.Done()
+	return 0, b.ctx.Err()
+}
+
+func (b *blockingBody) Close() error { return nil }
+
+// stubBlockingUpstream 上游返回一帧后挂起，返回上游请求使用的上下文
+func stubBlockingUpstream(t *testing.T, onBlock func()) *context.Context {
+	var upstreamCtx context.Context
+	original := execCWRequest
+	t.Cleanup(func() { execCWRequest = original })
+	execCWRequest = func(c *gin.Context, _ types.AnthropicRequest, _ types.TokenInfo, _ bool) (*http.Response, error) {
+		upstreamCtx = c.Request.Context()
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body: &blockingBody{
+				ctx:     upstreamCtx,
+				first:   encodeEventStreamFrame("assistantResponseEvent", []byte(`{"content":"hello"}`)),
+				onBlock: onBlock,
+			},
+		}, nil
+	}
+	return &upstreamCtx
+}
+
+// runWithTimeout 执行处理器，超时未返回说明上游读取没有被取消
+func runWithTimeout(t *testing.T, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("客户端断开后处理器仍在等待上游")
+	}
+}
+
+func TestClientDisconnectCancelsUpstream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	handlers := map[string]func(*gin.Context, types.AnthropicRequest){
+		"anthropic": func(c *gin.Context, req types.AnthropicRequest) {
+			handleStreamRequest(c, req, &types.TokenWithUsage{})
+		},
+		"openai": func(c *gin.Context, req types.AnthropicRequest) {
+			handleOpenAIStreamRequest(c, req, types.TokenInfo{}, false)
+		},
+	}
+
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			reqCtx, disconnect := context.WithCancel(context.Background())
+			defer disconnect()
+			upstreamCtx := stubBlockingUpstream(t, disconnect)
+			before := GetStreamStats()
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil).WithContext(reqCtx)
+			runWithTimeout(t, func() {
+				handler(c, types.AnthropicRequest{Model: "claude-sonnet-4-20250514", MaxTokens: 100, Stream: true})
+			})
+
+			require.NotNil(t, *upstreamCtx)
+			assert.ErrorIs(t, (*upstreamCtx).Err(), context.Canceled, "上游请求应随客户端断开取消")
+			assert.Contains(t, w.Body.String(), "hello", "断开前的内容照常下发")
+			assert.NotContains(t, w.Body.String(), "message_stop")
+			assert.NotContains(t, w.Body.String(), "[DONE]")
+
+			after := GetStreamStats()
+			assert.Equal(t, before.ClientCancelled+1, after.ClientCancelled)
+			assert.Equal(t, before.Active, after.Active)
+		})
+	}
+}
+
+// failingWriter 模拟客户端已断开：写入响应体总是失败
+type failingWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (w failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write: broken pipe")
+}
+
+func TestWriteFailureCancelsUpstream(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	upstreamCtx := stubBlockingUpstream(t, nil)
+
+	c, _ := gin.CreateTestContext(failingWriter{httptest.NewRecorder()})
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	runWithTimeout(t, func() {
+		handleStreamRequest(c, types.AnthropicRequest{Model: "claude-sonnet-4-20250514", MaxTokens: 100, Stream: true}, &types.TokenWithUsage{})
+	})
+
+	require.NotNil(t, *upstreamCtx)
+	assert.ErrorIs(t, context.Cause(*upstreamCtx), errClientDisconnected)
+}
+
+func TestStreamStatsCountsCompleted(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stubFailingUpstream(t, encodeEventStreamFrame("assistantResponseEvent", []byte(`{"content":"done"}`)), nil)
+	before := GetStreamStats()
+
+	runStream(t, func(c *gin.Context, req types.AnthropicRequest) {
+		handleOpenAIStreamRequest(c, req, types.TokenInfo{}, false)
+	})
+
+	after := GetStreamStats()
+	assert.Equal(t, before.Started+1, after.Started)
+	assert.Equal(t, before.Completed+1, after.Completed)
+	assert.Equal(t, before.ClientCancelled, after.ClientCancelled)
+}
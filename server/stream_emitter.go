@@ -0,0 +1,65 @@
+package server
+
+import (
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// streamEmitter 流式响应的传输层
+// 流解析与格式转换只产出完整的 JSON 事件，由 emitter 决定以 SSE、NDJSON 还是 WebSocket 帧写给客户端
+type streamEmitter interface {
+	// start 在写出响应前调用，设置传输相关的响应头
+	start(c *gin.Context)
+	// emit 下发一条完整事件；payload 可能来自复用的缓冲区，只在调用期间有效
+	emit(c *gin.Context, payload []byte) error
+	// done 下发流结束标记
+	done(c *gin.Context) error
+	// keepalive 生成停顿期间是否发送 SSE 保活注释
+	keepalive() bool
+}
+
+// sseEmitter 以 SSE data 行下发，结束标记为 [DONE]
+type sseEmitter struct{}
+
+func (sseEmitter) start(c *gin.Context) { setSSEHeaders(c) }
+
+func (sseEmitter) emit(c *gin.Context, payload []byte) error {
+	return writeFrame(c, "data: ", payload, "\n\n")
+}
+
+func (e sseEmitter) done(c *gin.Context) error {
+	return e.emit(c, []byte("[DONE]"))
+}
+
+func (sseEmitter) keepalive() bool { return true }
+
+// ndjsonEmitter 以换行分隔的 JSON 下发（Ollama 流格式），没有结束标记
+type ndjsonEmitter struct{}
+
+func (ndjsonEmitter) start(c *gin.Context) {
+	setSSEHeaders(c)
+	c.Header("Content-Type", "application/x-ndjson")
+}
+
+func (ndjsonEmitter) emit(c *gin.Context, payload []byte) error {
+	return writeFrame(c, "", payload, "\n")
+}
+
+func (ndjsonEmitter) done(*gin.Context) error { return nil }
+
+func (ndjsonEmitter) keepalive() bool { return false }
+
+// writeFrame 在复用的缓冲区中拼接前缀、负载与后缀，一次写出并刷新
+func writeFrame(c *gin.Context, prefix string, payload []byte, suffix string) error {
+	buf := utils.GetBuffer()
+	defer utils.PutBuffer(buf)
+	buf.WriteString(prefix)
+	buf.Write(payload)
+	buf.WriteString(suffix)
+	if _, err := c.Writer.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+)
+
+// 流式响应开始后上游异常的机器可读错误码，随终止错误事件下发，
+// 客户端据此区分被截断的响应与正常结束的响应
+const (
+	streamErrUpstreamDisconnected = "upstream_disconnected" // 读取上游响应失败（连接中断或重置）
+	streamErrUpstreamTruncated    = "upstream_truncated"    // 上游在事件帧中途结束
+	streamErrTimeout              = "stream_timeout"        // 超过请求最大时长，上游读取已取消
+	streamErrCancelled            = "request_cancelled"     // 管理员取消了请求，上游读取已取消
+)
+
+// streamError 流式响应开始后发生的上游错误
+type streamError struct {
+	Code string
+	Err  error
+}
+
+func (e *streamError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Code, e.Err)
+}
+
+func (e *streamError) Unwrap() error {
+	return e.Err
+}
+
+// newStreamError 以错误码包装流中错误
+func newStreamError(code string, err error) *streamError {
+	return &streamError{Code: code, Err: err}
+}
+
+// streamErrorCode 返回错误链中的流错误码，不是流错误时返回空
+func streamErrorCode(err error) string {
+	var se *streamError
+	if errors.As(err, &se) {
+		return se.Code
+	}
+	return ""
+}
+
+// anthropicStreamErrorType 流错误码对应的 Anthropic 错误类型（见错误码表），没有错误码时为 overloaded_error
+func anthropicStreamErrorType(code string) string {
+	if code == "" {
+		return "overloaded_error"
+	}
+	_, anthropicType := errorTypes(code, errorStatus(code))
+	return anthropicType
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/iotest"
+
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubFailingUpstream 上游先返回 body 再以 err 结束读取
+func stubFailingUpstream(t *testing.T, body []byte, err error) {
+	original := execCWRequest
+	t.Cleanup(func() { execCWRequest = original })
+	execCWRequest = func(c *gin.Context, _ types.AnthropicRequest, _ types.TokenInfo, _ bool) (*http.Response, error) {
+		var reader io.Reader = bytes.NewReader(body)
+		if err != nil {
+			reader = io.MultiReader(reader, iotest.ErrReader(err))
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/vnd.amazon.eventstream"}},
+			Body:       io.NopCloser(reader),
+		}, nil
+	}
+}
+
+// runStream 执行流式处理器并返回解析后的 SSE 事件
+func runStream(t *testing.T, handler func(*gin.Context, types.AnthropicRequest)) []sseEvent {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	handler(c, types.AnthropicRequest{Model: "claude-sonnet-4-20250514", MaxTokens: 100, Stream: true})
+	return parseSSE(t, w.Body.String())
+}
+
+func TestMidStreamUpstreamErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	frame := encodeEventStreamFrame("assistantResponseEvent", []byte(`{"content":"partial answer"}`))
+
+	tests := []struct {
+		name     string
+		body     []byte
+		err      error
+		code     string
+		anthType string
+	}{
+		{"连接中断", frame, errors.New("connection reset by peer"), streamErrUpstreamDisconnected, "api_error"},
+		{"帧中途结束", append(bytes.Clone(frame), frame[:20]...), nil, streamErrUpstreamTruncated, "api_error"},
+		{"意外EOF", frame, io.ErrUnexpectedEOF, streamErrUpstreamTruncated, "api_error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+"/anthropic", func(t *testing.T) {
+			stubFailingUpstream(t, tt.body, tt.err)
+			events := runStream(t, func(c *gin.Context, req types.AnthropicRequest) {
+				handleStreamRequest(c, req, &types.TokenWithUsage{})
+			})
+			require.NotEmpty(t, events)
+
+			last := events[len(events)-1]
+			require.Equal(t, "error", last.Event)
+			var data map[string]any
+			require.NoError(t, json.Unmarshal([]byte(last.Data), &data))
+			errBody := data["error"].(map[string]any)
+			assert.Equal(t, tt.anthType, errBody["type"])
+			assert.Equal(t, tt.code, errBody["code"])
+
+			for _, ev := range events {
+				assert.NotEqual(t, "message_stop", ev.Event, "截断的响应不应伪装成正常结束")
+			}
+			assert.Contains(t, events[len(events)-2].Data, "partial answer", "错误前已收到的内容照常下发")
+		})
+
+		t.Run(tt.name+"/openai", func(t *testing.T) {
+			stubFailingUpstream(t, tt.body, tt.err)
+			events := runStream(t, func(c *gin.Context, req types.AnthropicRequest) {
+				handleOpenAIStreamRequest(c, req, types.TokenInfo{}, false)
+			})
+			require.NotEmpty(t, events)
+
+			last := events[len(events)-1]
+			require.NotEqual(t, "[DONE]", last.Data)
+			var data map[string]any
+			require.NoError(t, json.Unmarshal([]byte(last.Data), &data))
+			errBody := data["error"].(map[string]any)
+			assert.Equal(t, "server_error", errBody["type"])
+			assert.Equal(t, tt.code, errBody["code"])
+			assert.NotContains(t, events[len(events)-2].Data, `"finish_reason":"stop"`)
+		})
+	}
+}
+
+func TestCompleteStreamHasNoError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stubFailingUpstream(t, encodeEventStreamFrame("assistantResponseEvent", []byte(`{"content":"done"}`)), nil)
+
+	events := runStream(t, func(c *gin.Context, req types.AnthropicRequest) {
+		handleStreamRequest(c, req, &types.TokenWithUsage{})
+	})
+	require.NotEmpty(t, events)
+	assert.Equal(t, "message_stop", events[len(events)-1].Event)
+}
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"strings"
@@ -34,6 +35,7 @@ type StreamProcessorContext struct {
 
 	// 统计信息
 	totalOutputTokens    int // 累计发送给客户端的输出 token 数
+	upstreamUsage        upstreamUsage
 	totalReadBytes       int
 	totalProcessedEvents int
 	lastParseErr         error
@@ -46,6 +48,13 @@ type StreamProcessorContext struct {
 	// 问题：每个 input_json_delta 单独计算 len(partialJSON)/4 会导致小于4字节的分段被舍弃
 	// 解决：累加每个块的JSON字节数，在 content_block_stop 时一次性计算 token
 	jsonBytesByBlockIndex map[int]int // 每个工具块累积的JSON字节数
+
+	// 扩展思考：将正文开头的 <thinking> 内容改写为 thinking 内容块（未开启时为 nil）
+	thinking *thinkingStream
+
+	// 客户端侧执行 stop_sequences 与 max_tokens
+	limiter       *outputLimiter
+	lastTextIndex int // 最近一个正文增量的内容块索引，用于输出限制器暂存内容
 }
 
 // NewStreamProcessorContext 创建流处理上下文
@@ -71,6 +80,8 @@ func NewStreamProcessorContext(
 		toolUseIdByBlockIndex: make(map[int]string),
 		completedToolUseIds:   make(map[string]bool),
 		jsonBytesByBlockIndex: make(map[int]int), // *** 初始化JSON字节累加器 ***
+		thinking:              newThinkingStream(req),
+		limiter:               newOutputLimiter(req),
 	}
 }
 
@@ -108,10 +119,7 @@ func (ctx *StreamProcessorContext) Cleanup() {
 // initializeSSEResponse 初始化SSE响应头
 func initializeSSEResponse(c *gin.Context) error {
 	// 设置SSE响应头，禁用反向代理缓冲
-	c.Header("Content-Type", "text/event-stream; charset=utf-8")
-	c.Header("Cache-Control", "no-cache")
-	c.Header("Connection", "keep-alive")
-	c.Header("X-Accel-Buffering", "no")
+	setSSEHeaders(c)
 
 	// 确认底层Writer支持Flush
 	if _, ok := c.Writer.(io.Writer); !ok {
@@ -239,6 +247,7 @@ func (ctx *StreamProcessorContext) sendFinalEvents() error {
 	// 	logger.Int("completed_count", len(ctx.completedToolUseIds)))
 
 	ctx.stopReasonManager.UpdateToolCallStatus(hasActiveTools, hasCompletedTools)
+	ctx.stopReasonManager.MarkOutputLimit(ctx.limiter.stopReason, ctx.limiter.stopSequence)
 
 	// *** 关键修复：使用累计的实际发送 token 数 ***
 	// 设计原则：token 计费应该基于实际发送给客户端的 SSE 事件内容
@@ -263,6 +272,11 @@ func (ctx *StreamProcessorContext) sendFinalEvents() error {
 		}
 	}
 
+	// 上游 metadataEvent 提供了用量时以上游为准
+	inputTokens := ctx.inputTokens
+	inputTokens, outputTokens = ctx.upstreamUsage.apply(inputTokens, outputTokens)
+	setAuditUsage(ctx.c, inputTokens, outputTokens)
+
 	// 确定stop_reason
 	stopReason := ctx.stopReasonManager.DetermineStopReason()
 
@@ -272,7 +286,7 @@ func (ctx *StreamProcessorContext) sendFinalEvents() error {
 		logger.Int("output_tokens", outputTokens))
 
 	// 创建并发送结束事件
-	finalEvents := createAnthropicFinalEvents(outputTokens, ctx.inputTokens, stopReason)
+	finalEvents := createAnthropicFinalEvents(ctx.upstreamUsage.anthropicUsage(inputTokens, outputTokens), stopReason, ctx.stopReasonManager.StopSequence())
 	for _, event := range finalEvents {
 		if err := ctx.sseStateManager.SendEvent(ctx.c, ctx.sender, event); err != nil {
 			logger.Error("结束事件发送违规", logger.Err(err))
@@ -282,6 +296,11 @@ func (ctx *StreamProcessorContext) sendFinalEvents() error {
 	return nil
 }
 
+// exceptionUsage 上游异常提前结束时的用量
+func (ctx *StreamProcessorContext) exceptionUsage() map[string]any {
+	return ctx.upstreamUsage.anthropicUsage(ctx.inputTokens, ctx.totalOutputTokens)
+}
+
 // 辅助函数
 
 // extractIndex 从数据映射中提取索引
@@ -318,7 +337,9 @@ func NewEventStreamProcessor(ctx *StreamProcessorContext) *EventStreamProcessor
 
 // ProcessEventStream 处理事件流的主循环
 func (esp *EventStreamProcessor) ProcessEventStream(reader io.Reader) error {
-	buf := make([]byte, 1024)
+	bufPtr := utils.GetStreamReadBuffer()
+	defer utils.PutStreamReadBuffer(bufPtr)
+	buf := *bufPtr
 
 	for {
 		n, err := reader.Read(buf)
@@ -348,12 +369,26 @@ func (esp *EventStreamProcessor) ProcessEventStream(reader io.Reader) error {
 			}
 		}
 
+		// 已命中停止序列或达到 max_tokens，不再读取上游剩余输出
+		if esp.ctx.limiter.done() {
+			logger.Debug("输出达到客户端侧限制，停止读取上游",
+				addReqFields(esp.ctx.c,
+					logger.String("stop_reason", esp.ctx.limiter.stopReason),
+					logger.Int("total_read_bytes", esp.ctx.totalReadBytes),
+				)...)
+			break
+		}
+
 		if err != nil {
 			if err == io.EOF {
 				logger.Debug("响应流结束",
 					addReqFields(esp.ctx.c,
 						logger.Int("total_read_bytes", esp.ctx.totalReadBytes),
 					)...)
+				if pending := esp.ctx.compliantParser.Pending(); pending > 0 {
+					return esp.upstreamFailure(newStreamError(streamErrUpstreamTruncated,
+						fmt.Errorf("上游在帧中途结束，剩余 %d 字节", pending)))
+				}
 			} else {
 				logger.Error("读取响应流时发生错误",
 					addReqFields(esp.ctx.c,
@@ -361,13 +396,44 @@ func (esp *EventStreamProcessor) ProcessEventStream(reader io.Reader) error {
 						logger.Int("total_read_bytes", esp.ctx.totalReadBytes),
 						logger.String("direction", "upstream_response"),
 					)...)
+				// 请求上下文已结束（客户端断开或超过最大时长）时由调用方处理
+				if esp.ctx.c.Request.Context().Err() == nil {
+					code := streamErrUpstreamDisconnected
+					if errors.Is(err, io.ErrUnexpectedEOF) {
+						code = streamErrUpstreamTruncated
+					}
+					return esp.upstreamFailure(newStreamError(code, err))
+				}
 			}
 			break
 		}
 	}
 
-	// 直传模式：无需冲刷剩余文本
-	return nil
+	// 直传模式：无需冲刷剩余文本；开启思考时输出拆分器暂存的内容
+	if esp.ctx.thinking != nil {
+		for _, dataMap := range esp.ctx.thinking.flush() {
+			if err := esp.forwardEvent(dataMap); err != nil {
+				return err
+			}
+		}
+	}
+	// 输出限制器暂存的疑似停止序列前缀
+	return esp.flushLimiter()
+}
+
+// upstreamFailure 上游中途失败：先输出已暂存的内容再返回流错误，调用方据此下发错误事件而不是正常结束
+func (esp *EventStreamProcessor) upstreamFailure(err *streamError) error {
+	if esp.ctx.thinking != nil {
+		for _, dataMap := range esp.ctx.thinking.flush() {
+			if ferr := esp.forwardEvent(dataMap); ferr != nil {
+				return ferr
+			}
+		}
+	}
+	if ferr := esp.flushLimiter(); ferr != nil {
+		return ferr
+	}
+	return err
 }
 
 // processEvent 处理单个事件
@@ -378,6 +444,83 @@ func (esp *EventStreamProcessor) processEvent(event parser.SSEEvent) error {
 		return nil
 	}
 
+	// 上游用量只用于最终计费，不转发给客户端
+	if esp.ctx.upstreamUsage.record(dataMap) {
+		return nil
+	}
+
+	if esp.ctx.thinking == nil {
+		return esp.forwardEvent(dataMap)
+	}
+	for _, rewritten := range esp.ctx.thinking.rewrite(dataMap) {
+		if err := esp.forwardEvent(rewritten); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// limitEvent 对事件应用输出限制，返回需要转发的事件（nil 表示丢弃）
+// 正文增量按 stop_sequences 与 max_tokens 截断；其他事件转发前先输出暂存的正文
+func (esp *EventStreamProcessor) limitEvent(dataMap map[string]any) (map[string]any, error) {
+	limiter := esp.ctx.limiter
+	if limiter.done() {
+		return nil, nil
+	}
+
+	if dataMap["type"] == "content_block_delta" {
+		if delta, ok := dataMap["delta"].(map[string]any); ok && delta["type"] == "text_delta" {
+			text, _ := delta["text"].(string)
+			esp.ctx.lastTextIndex = extractIndex(dataMap)
+			limited := limiter.feed(text)
+			if limited == text {
+				return dataMap, nil // 包括上游的空增量，保持内容块索引与上游一致
+			}
+			if limited == "" {
+				return nil, nil
+			}
+			return textDeltaEvent(esp.ctx.lastTextIndex, limited), nil
+		}
+	}
+
+	if err := esp.flushLimiter(); err != nil {
+		return nil, err
+	}
+	if limiter.done() {
+		return nil, nil
+	}
+	return dataMap, nil
+}
+
+// flushLimiter 输出限制器暂存的正文
+func (esp *EventStreamProcessor) flushLimiter() error {
+	text := esp.ctx.limiter.flush()
+	if text == "" {
+		return nil
+	}
+	return esp.sendEvent(textDeltaEvent(esp.ctx.lastTextIndex, text))
+}
+
+// textDeltaEvent 构造正文增量事件
+func textDeltaEvent(index int, text string) map[string]any {
+	return map[string]any{
+		"type":  "content_block_delta",
+		"index": index,
+		"delta": map[string]any{"type": "text_delta", "text": text},
+	}
+}
+
+// forwardEvent 应用输出限制后转发单个事件
+func (esp *EventStreamProcessor) forwardEvent(dataMap map[string]any) error {
+	limited, err := esp.limitEvent(dataMap)
+	if err != nil || limited == nil {
+		return err
+	}
+	return esp.sendEvent(limited)
+}
+
+// sendEvent 转发单个事件并累计输出token
+func (esp *EventStreamProcessor) sendEvent(dataMap map[string]any) error {
 	eventType, _ := dataMap["type"].(string)
 
 	// 处理不同类型的事件
@@ -425,6 +568,12 @@ func (esp *EventStreamProcessor) processEvent(event parser.SSEEvent) error {
 				if text, ok := delta["text"].(string); ok {
 					esp.ctx.totalOutputTokens += esp.ctx.tokenEstimator.EstimateTextTokens(text)
 				}
+
+			case "thinking_delta":
+				// 思考内容增量，与文本同样计费
+				if thinking, ok := delta["thinking"].(string); ok {
+					esp.ctx.totalOutputTokens += esp.ctx.tokenEstimator.EstimateTextTokens(thinking)
+				}
 			
 			case "input_json_delta":
 				// *** 修复：累加JSON字节数，延迟到content_block_stop时统一计算 ***
@@ -503,10 +652,7 @@ func (esp *EventStreamProcessor) handleExceptionEvent(dataMap map[string]any) bo
 				"stop_reason":   "max_tokens",
 				"stop_sequence": nil,
 			},
-			"usage": map[string]any{
-				"input_tokens":  esp.ctx.inputTokens,
-				"output_tokens": esp.ctx.totalOutputTokens,
-			},
+			"usage": esp.ctx.exceptionUsage(),
 		}
 
 		// 发送max_tokens事件
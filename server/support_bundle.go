@@ -0,0 +1,307 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"kiro2api/auth"
+	"kiro2api/config"
+	"kiro2api/logger"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// maxErrorSamples 保留的最近错误样本数
+	maxErrorSamples = 50
+	// maxErrorSampleBody 单个错误样本保留的响应体长度
+	maxErrorSampleBody = 2048
+	// maxBundleLogBytes 支持包中日志文件的最大长度（取末尾）
+	maxBundleLogBytes = 1 << 20
+)
+
+// ErrorSample 最近的错误样本
+type ErrorSample struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	Path      string    `json:"path,omitempty"`
+	Kind      string    `json:"kind"`
+	Status    int       `json:"status,omitempty"`
+	Message   string    `json:"message"`
+}
+
+// errorSampleRing 固定容量的错误样本环形缓冲
+type errorSampleRing struct {
+	mu      sync.Mutex
+	samples []ErrorSample
+	next    int
+	full    bool
+}
+
+func newErrorSampleRing(capacity int) *errorSampleRing {
+	return &errorSampleRing{samples: make([]ErrorSample, capacity)}
+}
+
+// recentErrors 全局错误样本缓冲
+var recentErrors = newErrorSampleRing(maxErrorSamples)
+
+// Add 追加错误样本（消息会被脱敏并截断）
+func (r *errorSampleRing) Add(sample ErrorSample) {
+	sample.Message = redactSecrets(sample.Message)
+	if len(sample.Message) > maxErrorSampleBody {
+		sample.Message = sample.Message[:maxErrorSampleBody] + "...(truncated)"
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.samples[r.next] = sample
+	r.next = (r.next + 1) % len(r.samples)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// List 按时间顺序返回错误样本
+func (r *errorSampleRing) List() []ErrorSample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.full {
+		return append([]ErrorSample(nil), r.samples[:r.next]...)
+	}
+	out := make([]ErrorSample, 0, len(r.samples))
+	out = append(out, r.samples[r.next:]...)
+	out = append(out, r.samples[:r.next]...)
+	return out
+}
+
+// recordErrorSample 从请求上下文记录错误样本
+func recordErrorSample(c *gin.Context, kind string, status int, message string) {
+	sample := ErrorSample{
+		Time:    time.Now(),
+		Kind:    kind,
+		Status:  status,
+		Message: contentRedactor.String(message),
+	}
+	if c != nil {
+		sample.RequestID = GetRequestID(c)
+		if c.Request != nil {
+			sample.Path = c.Request.URL.Path
+		}
+	}
+	recentErrors.Add(sample)
+}
+
+// secretPatterns 需要在支持包中脱敏的内容
+var secretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)("(?:refreshToken|accessToken|clientSecret|password|authorization|x-api-key)"\s*:\s*")[^"]*(")`),
+	regexp.MustCompile(`(?i)(Bearer\s+)[A-Za-z0-9._~+/=-]+()`),
+}
+
+// redactSecrets 脱敏文本中的令牌与密码
+func redactSecrets(text string) string {
+	for _, re := range secretPatterns {
+		text = re.ReplaceAllString(text, "${1}***${2}")
+	}
+	return text
+}
+
+// supportBundleEnvPrefixes 支持包中收集的环境变量前缀
+var supportBundleEnvPrefixes = []string{
+	"KIRO_", "ADMIN_", "SESSION_", "OIDC_", "INCIDENT_", "CIRCUIT_BREAKER_", "RATE_LIMIT_", "UPSTREAM_", "SERVER_", "REQUEST_DEADLINE_", "AUDIT_", "LOG_", "SSE_", "FEATURE_", "JANITOR_", "BATCH_", "CAPTURE_", "IMAGE_", "RESPONSE_FORMAT_", "THINKING_", "MODELS_", "PROMPT_POLICY_", "REDACTION_", "OUTPUT_FILTER_", "INPUT_", "TLS_", "TRUSTED_PROXY", "V1_IP_", "CORS_", "VAULT_", "AWS_REGION", "AWS_DEFAULT_REGION", "REPLICA_", "WEBHOOK_", "RESPONSE_CACHE_", "IDEMPOTENCY_", "RESPONSE_COMPRESSION", "TOKEN_QUEUE_", "INFLIGHT_", "USAGE_REPORT_", "PRICING_FILE", "EMBEDDINGS_", "FALLBACK_FILE", "TENANT_FILE", "KEY_POLICIES_FILE", "PRIORITY_", "TOKEN_REFRESH_", "TOKEN_USAGE_", "STICKY_ROUTING_", "OTEL_", "GIN_MODE", "PORT", "LOGIN_", "SECURITY_", "PASSTHROUGH_",
+	"AUTH_CONFIG_FILE", "REQUEST_TEMPLATES_FILE", "REQUEST_SIGNING_", "MAX_TOOL_DESCRIPTION_LENGTH", "DEBUG", "LAZY_WARMUP", "TOKEN_TAG_PREFERENCE",
+}
+
+// isSecretEnv 判断环境变量是否为敏感配置（OTEL_EXPORTER_OTLP_HEADERS 等通常携带认证头，Webhook 地址通常内含密钥）
+func isSecretEnv(key string) bool {
+	upper := strings.ToUpper(key)
+	for _, marker := range []string{"TOKEN", "PASSWORD", "SECRET", "KEY", "HEADERS", "URLS", "WEBHOOK_URL"} {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// collectEffectiveSettings 收集生效的环境变量配置（敏感值脱敏）
+func collectEffectiveSettings() map[string]string {
+	settings := make(map[string]string)
+	for _, kv := range os.Environ() {
+		key, value, ok := strings.Cut(kv, "=")
+		if !ok {
+			continue
+		}
+		for _, prefix := range supportBundleEnvPrefixes {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+			if isSecretEnv(key) && value != "" {
+				value = fmt.Sprintf("***（已设置，长度%d）", len(value))
+			}
+			settings[key] = value
+			break
+		}
+	}
+	return settings
+}
+
+// collectVersionInfo 收集版本与运行时信息
+func collectVersionInfo() map[string]any {
+	info := map[string]any{
+		"version":    config.Version,
+		"build_time": config.BuildTime,
+		"go_version": runtime.Version(),
+		"os":         runtime.GOOS,
+		"arch":       runtime.GOARCH,
+		"num_cpu":    runtime.NumCPU(),
+		"goroutines": runtime.NumGoroutine(),
+	}
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range buildInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision", "vcs.time", "vcs.modified":
+				info[setting.Key] = setting.Value
+			}
+		}
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	info["heap_alloc_bytes"] = mem.HeapAlloc
+	return info
+}
+
+// readRecentLogs 读取日志文件末尾（未配置 LOG_FILE 时返回说明）
+func readRecentLogs() []byte {
+	path := os.Getenv("LOG_FILE")
+	if path == "" {
+		return []byte("未配置 LOG_FILE，支持包中不包含日志文件内容\n")
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return []byte(fmt.Sprintf("读取日志文件失败: %v\n", err))
+	}
+	defer f.Close()
+
+	if info, err := f.Stat(); err == nil && info.Size() > maxBundleLogBytes {
+		if _, err := f.Seek(-maxBundleLogBytes, io.SeekEnd); err != nil {
+			return []byte(fmt.Sprintf("读取日志文件失败: %v\n", err))
+		}
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return []byte(fmt.Sprintf("读取日志文件失败: %v\n", err))
+	}
+	return []byte(redactSecrets(string(data)))
+}
+
+// buildSupportBundle 生成支持包zip内容
+func buildSupportBundle(authService *auth.AuthService) ([]byte, error) {
+	snapshot, err := authService.Snapshot(auth.SnapshotOptions{Secrets: auth.SnapshotSecretsOmit})
+	if err != nil {
+		return nil, err
+	}
+
+	generatedAt := time.Now().UTC()
+	files := map[string]any{
+		"version.json":  collectVersionInfo(),
+		"settings.json": collectEffectiveSettings(),
+		"auth_config.redacted.json": map[string]any{
+			"config_file": snapshot.ConfigFile,
+			"accounts":    snapshot.Accounts,
+		},
+		"pool_health.json": map[string]any{
+			"upstream": upstreamIncidents.State(),
+			"audit":    auditLog.Stats(),
+			"breakers": auth.UpstreamBreakers.Snapshots(),
+			"pool":     utils.GetUpstreamPoolStats(),
+			"streams":  GetStreamStats(),
+			"inflight": inflightLimiter.Stats(),
+		},
+		"errors.json": recentErrors.List(),
+	}
+
+	names := make([]string, 0, len(files)+2)
+	for name := range files {
+		names = append(names, name)
+	}
+	names = append(names, "logs.txt")
+	sort.Strings(names)
+
+	files["manifest.json"] = map[string]any{
+		"generated_at": generatedAt,
+		"version":      config.Version,
+		"files":        names,
+	}
+
+	buf := bytes.NewBuffer(nil)
+	zw := zip.NewWriter(buf)
+	for name, content := range files {
+		data, err := json.MarshalIndent(content, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("序列化 %s 失败: %w", name, err)
+		}
+		if err := writeZipFile(zw, name, data, generatedAt); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeZipFile(zw, "logs.txt", readRecentLogs(), generatedAt); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("生成支持包失败: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// writeZipFile 写入单个zip条目
+func writeZipFile(zw *zip.Writer, name string, data []byte, modified time.Time) error {
+	w, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: modified,
+	})
+	if err != nil {
+		return fmt.Errorf("写入 %s 失败: %w", name, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("写入 %s 失败: %w", name, err)
+	}
+	return nil
+}
+
+// handleSupportBundle 下载脱敏后的支持包
+func handleSupportBundle(c *gin.Context, authService *auth.AuthService) {
+	data, err := buildSupportBundle(authService)
+	if err != nil {
+		logger.Error("生成支持包失败", logger.Err(err))
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"error":   "生成支持包失败: " + err.Error(),
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("kiro2api-support-%s.zip", time.Now().UTC().Format("20060102-150405"))
+	logger.Info("生成支持包",
+		logger.String("filename", filename),
+		logger.Int("size", len(data)),
+		logger.String("operator", GetSessionUser(c)))
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "application/zip", data)
+}
@@ -0,0 +1,88 @@
+package server
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"kiro2api/auth"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestAuthService 创建使用临时配置文件的AuthService
+func newTestAuthService(t *testing.T, configs ...auth.AuthConfig) *auth.AuthService {
+	if len(configs) == 0 {
+		configs = []auth.AuthConfig{{AuthType: auth.AuthMethodSocial, RefreshToken: "test_refresh_token"}}
+	}
+	return auth.NewAuthServiceWithConfigs(configs, filepath.Join(t.TempDir(), "auth_config.json"))
+}
+
+func TestRedactSecrets(t *testing.T) {
+	in := `{"refreshToken":"abc123","clientSecret":"s3cr3t","auth":"Social"} Authorization: Bearer eyJhbGciOi.x.y`
+	out := redactSecrets(in)
+
+	assert.NotContains(t, out, "abc123")
+	assert.NotContains(t, out, "s3cr3t")
+	assert.NotContains(t, out, "eyJhbGciOi")
+	assert.Contains(t, out, `"refreshToken":"***"`)
+	assert.Contains(t, out, `"auth":"Social"`)
+}
+
+func TestErrorSampleRing_WrapsInOrder(t *testing.T) {
+	ring := newErrorSampleRing(3)
+	for i := 0; i < 5; i++ {
+		ring.Add(ErrorSample{Time: time.Now(), Kind: "k", Status: 500 + i, Message: "m"})
+	}
+
+	samples := ring.List()
+	require.Len(t, samples, 3)
+	assert.Equal(t, 502, samples[0].Status)
+	assert.Equal(t, 504, samples[2].Status)
+}
+
+func TestIsSecretEnv(t *testing.T) {
+	assert.True(t, isSecretEnv("KIRO_CLIENT_TOKEN"))
+	assert.True(t, isSecretEnv("ADMIN_PASSWORD"))
+	assert.True(t, isSecretEnv("OIDC_CLIENT_SECRET"))
+	assert.True(t, isSecretEnv("USAGE_REPORT_WEBHOOK_URL"))
+	assert.False(t, isSecretEnv("LOG_LEVEL"))
+}
+
+func TestBuildSupportBundle(t *testing.T) {
+	t.Setenv("KIRO_CLIENT_TOKEN", "super-secret-key")
+	t.Setenv("LOG_LEVEL", "debug")
+	as := newTestAuthService(t)
+
+	data, err := buildSupportBundle(as)
+	require.NoError(t, err)
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	contents := map[string][]byte{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		require.NoError(t, err)
+		body, err := io.ReadAll(rc)
+		require.NoError(t, err)
+		rc.Close()
+		contents[f.Name] = body
+	}
+
+	for _, name := range []string{"manifest.json", "version.json", "settings.json", "auth_config.redacted.json", "pool_health.json", "errors.json", "logs.txt"} {
+		assert.Contains(t, contents, name)
+	}
+
+	var settings map[string]string
+	require.NoError(t, json.Unmarshal(contents["settings.json"], &settings))
+	assert.Equal(t, "debug", settings["LOG_LEVEL"])
+	assert.NotContains(t, settings["KIRO_CLIENT_TOKEN"], "super-secret-key")
+
+	assert.NotContains(t, string(contents["auth_config.redacted.json"]), "test_refresh_token")
+}
@@ -0,0 +1,447 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"kiro2api/logger"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 模板适用的API格式
+const (
+	TemplateAPIAnthropic = "anthropic" // POST /v1/messages
+	TemplateAPIOpenAI    = "openai"    // POST /v1/chat/completions
+)
+
+// maxTemplateRunBody 模板试运行时返回的响应体最大长度
+const maxTemplateRunBody = 16 * 1024
+
+// errTemplateNotFound 模板不存在
+var errTemplateNotFound = errors.New("模板不存在")
+
+// RequestTemplate 保存的请求模板（冒烟测试、试运行使用）
+type RequestTemplate struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	API         string          `json:"api"`
+	Model       string          `json:"model"`
+	System      string          `json:"system,omitempty"`
+	Messages    json.RawMessage `json:"messages"`
+	Params      map[string]any  `json:"params,omitempty"` // max_tokens、temperature 等其他请求参数
+	CreatedBy   string          `json:"created_by,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// Path 返回模板对应的 /v1 端点
+func (t RequestTemplate) Path() string {
+	if t.API == TemplateAPIOpenAI {
+		return "/v1/chat/completions"
+	}
+	return "/v1/messages"
+}
+
+// BuildRequestBody 生成可直接发送到 /v1 端点的请求体
+func (t RequestTemplate) BuildRequestBody(stream bool) (map[string]any, error) {
+	var messages []any
+	if err := json.Unmarshal(t.Messages, &messages); err != nil {
+		return nil, fmt.Errorf("解析模板消息失败: %w", err)
+	}
+
+	body := make(map[string]any, len(t.Params)+4)
+	for k, v := range t.Params {
+		body[k] = v
+	}
+	body["model"] = t.Model
+	body["stream"] = stream
+
+	if t.System != "" {
+		if t.API == TemplateAPIOpenAI {
+			messages = append([]any{map[string]any{"role": "system", "content": t.System}}, messages...)
+		} else {
+			body["system"] = t.System
+		}
+	}
+	body["messages"] = messages
+
+	if t.API == TemplateAPIAnthropic {
+		if _, ok := body["max_tokens"]; !ok {
+			body["max_tokens"] = 1024
+		}
+	}
+	return body, nil
+}
+
+// validateTemplate 校验模板字段
+func validateTemplate(t RequestTemplate) error {
+	if strings.TrimSpace(t.Name) == "" {
+		return fmt.Errorf("模板名称不能为空")
+	}
+	if t.API != TemplateAPIAnthropic && t.API != TemplateAPIOpenAI {
+		return fmt.Errorf("无效的api: %s（可选 anthropic/openai）", t.API)
+	}
+	if t.Model == "" {
+		return fmt.Errorf("model不能为空")
+	}
+	var messages []json.RawMessage
+	if err := json.Unmarshal(t.Messages, &messages); err != nil || len(messages) == 0 {
+		return fmt.Errorf("messages必须是非空数组")
+	}
+	for _, reserved := range []string{"model", "messages", "stream", "system"} {
+		if _, ok := t.Params[reserved]; ok {
+			return fmt.Errorf("params中不能包含 %s，请使用对应字段", reserved)
+		}
+	}
+	return nil
+}
+
+// TemplateStore 请求模板存储（文件持久化）
+type TemplateStore struct {
+	mu        sync.RWMutex
+	templates map[string]RequestTemplate
+	filePath  string // 为空时仅保存在内存中
+}
+
+// NewTemplateStore 创建模板存储，文件存在时加载
+func NewTemplateStore(filePath string) (*TemplateStore, error) {
+	s := &TemplateStore{
+		templates: make(map[string]RequestTemplate),
+		filePath:  filePath,
+	}
+	if filePath == "" {
+		return s, nil
+	}
+
+	content, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取模板文件失败: %w\n模板文件路径: %s", err, filePath)
+	}
+
+	var templates []RequestTemplate
+	if err := json.Unmarshal(content, &templates); err != nil {
+		return nil, fmt.Errorf("解析模板文件失败: %w\n模板文件路径: %s", err, filePath)
+	}
+	for _, t := range templates {
+		if t.ID == "" {
+			t.ID = utils.GenerateUUID()
+		}
+		s.templates[t.ID] = t
+	}
+
+	logger.Info("从文件加载请求模板",
+		logger.String("file_path", filePath),
+		logger.Int("template_count", len(s.templates)))
+	return s, nil
+}
+
+// List 返回按名称排序的模板列表
+func (s *TemplateStore) List() []RequestTemplate {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	templates := make([]RequestTemplate, 0, len(s.templates))
+	for _, t := range s.templates {
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		if templates[i].Name != templates[j].Name {
+			return templates[i].Name < templates[j].Name
+		}
+		return templates[i].ID < templates[j].ID
+	})
+	return templates
+}
+
+// Get 获取指定模板
+func (s *TemplateStore) Get(id string) (RequestTemplate, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.templates[id]
+	return t, ok
+}
+
+// Create 新建模板并持久化
+func (s *TemplateStore) Create(t RequestTemplate) (RequestTemplate, error) {
+	if err := validateTemplate(t); err != nil {
+		return RequestTemplate{}, err
+	}
+
+	now := time.Now().UTC()
+	t.ID = utils.GenerateUUID()
+	t.CreatedAt = now
+	t.UpdatedAt = now
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.templates[t.ID] = t
+	if err := s.saveLocked(); err != nil {
+		delete(s.templates, t.ID)
+		return RequestTemplate{}, err
+	}
+	return t, nil
+}
+
+// Update 替换模板内容（保留ID、创建信息）并持久化
+func (s *TemplateStore) Update(id string, t RequestTemplate) (RequestTemplate, error) {
+	if err := validateTemplate(t); err != nil {
+		return RequestTemplate{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, exists := s.templates[id]
+	if !exists {
+		return RequestTemplate{}, fmt.Errorf("%w: %s", errTemplateNotFound, id)
+	}
+
+	t.ID = id
+	t.CreatedBy = previous.CreatedBy
+	t.CreatedAt = previous.CreatedAt
+	t.UpdatedAt = time.Now().UTC()
+
+	s.templates[id] = t
+	if err := s.saveLocked(); err != nil {
+		s.templates[id] = previous
+		return RequestTemplate{}, err
+	}
+	return t, nil
+}
+
+// Delete 删除模板并持久化
+func (s *TemplateStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, exists := s.templates[id]
+	if !exists {
+		return fmt.Errorf("%w: %s", errTemplateNotFound, id)
+	}
+
+	delete(s.templates, id)
+	if err := s.saveLocked(); err != nil {
+		s.templates[id] = previous
+		return err
+	}
+	return nil
+}
+
+// saveLocked 持久化模板到文件（调用时需持有锁）
+func (s *TemplateStore) saveLocked() error {
+	if s.filePath == "" {
+		return nil
+	}
+
+	templates := make([]RequestTemplate, 0, len(s.templates))
+	for _, t := range s.templates {
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].CreatedAt.Before(templates[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(templates, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化模板失败: %w", err)
+	}
+	if err := os.WriteFile(s.filePath, data, 0o600); err != nil {
+		return fmt.Errorf("写入模板文件失败: %w\n模板文件路径: %s", err, s.filePath)
+	}
+	return nil
+}
+
+// TemplateHandlers 请求模板API处理器
+type TemplateHandlers struct {
+	store    *TemplateStore
+	engine   http.Handler       // 试运行时将请求直接交给本机路由处理
+	verifier *SignatureVerifier // 校验试运行使用的调用方密钥，为 nil 表示未启用请求签名
+}
+
+// NewTemplateHandlers 创建模板API处理器
+func NewTemplateHandlers(store *TemplateStore, engine http.Handler, verifier *SignatureVerifier) *TemplateHandlers {
+	return &TemplateHandlers{store: store, engine: engine, verifier: verifier}
+}
+
+// HandleList 列出所有模板
+func (h *TemplateHandlers) HandleList(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success":   true,
+		"templates": h.store.List(),
+	})
+}
+
+// HandleGet 获取单个模板
+func (h *TemplateHandlers) HandleGet(c *gin.Context) {
+	t, ok := h.store.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": errTemplateNotFound.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "template": t})
+}
+
+// HandleCreate 新建模板
+func (h *TemplateHandlers) HandleCreate(c *gin.Context) {
+	var t RequestTemplate
+	if err := c.ShouldBindJSON(&t); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "无效的请求格式: " + err.Error()})
+		return
+	}
+	t.CreatedBy = GetSessionUser(c)
+
+	created, err := h.store.Create(t)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	logger.Info("新建请求模板",
+		logger.String("id", created.ID),
+		logger.String("name", created.Name),
+		logger.String("operator", created.CreatedBy))
+	c.JSON(http.StatusOK, gin.H{"success": true, "template": created})
+}
+
+// HandleUpdate 更新模板
+func (h *TemplateHandlers) HandleUpdate(c *gin.Context) {
+	var t RequestTemplate
+	if err := c.ShouldBindJSON(&t); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": "无效的请求格式: " + err.Error()})
+		return
+	}
+
+	updated, err := h.store.Update(c.Param("id"), t)
+	if err != nil {
+		c.JSON(templateErrorStatus(err), gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	logger.Info("更新请求模板",
+		logger.String("id", updated.ID),
+		logger.String("operator", GetSessionUser(c)))
+	c.JSON(http.StatusOK, gin.H{"success": true, "template": updated})
+}
+
+// HandleDelete 删除模板
+func (h *TemplateHandlers) HandleDelete(c *gin.Context) {
+	id := c.Param("id")
+	if err := h.store.Delete(id); err != nil {
+		c.JSON(templateErrorStatus(err), gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	logger.Info("删除请求模板",
+		logger.String("id", id),
+		logger.String("operator", GetSessionUser(c)))
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "模板已删除"})
+}
+
+// HandleRender 返回模板生成的请求（端点与请求体），供外部工具直接使用
+// 查询参数 stream=true 生成流式请求
+func (h *TemplateHandlers) HandleRender(c *gin.Context) {
+	t, ok := h.store.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": errTemplateNotFound.Error()})
+		return
+	}
+
+	body, err := t.BuildRequestBody(c.Query("stream") == "true")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"method":  http.MethodPost,
+		"path":    t.Path(),
+		"body":    body,
+	})
+}
+
+// HandleRun 以调用方密钥的身份、非流式方式执行模板，返回状态码、耗时与响应体
+// 查询参数 key_id 指定调用方密钥（默认 default，强制请求签名时须为签名密钥ID），
+// 按该密钥的限流、策略、租户账号范围与优先级执行
+func (h *TemplateHandlers) HandleRun(c *gin.Context) {
+	t, ok := h.store.Get(c.Param("id"))
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"success": false, "error": errTemplateNotFound.Error()})
+		return
+	}
+	keyID := strings.TrimSpace(c.DefaultQuery("key_id", defaultClientKeyID))
+	if err := validateClientKeyID(h.verifier, keyID); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	body, err := t.BuildRequestBody(false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	payload, err := json.Marshal(body)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodPost, t.Path(), bytes.NewReader(payload))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"success": false, "error": err.Error()})
+		return
+	}
+	req = withInternalIdentity(req, keyID)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Request-ID", GetRequestID(c)+"-template")
+	req.RemoteAddr = c.Request.RemoteAddr
+
+	start := time.Now()
+	recorder := httptest.NewRecorder()
+	h.engine.ServeHTTP(recorder, req)
+	latency := time.Since(start)
+
+	respBody := recorder.Body.String()
+	if len(respBody) > maxTemplateRunBody {
+		respBody = respBody[:maxTemplateRunBody] + "...(truncated)"
+	}
+
+	logger.Info("试运行请求模板",
+		logger.String("id", t.ID),
+		logger.String("name", t.Name),
+		logger.String("key_id", keyID),
+		logger.Int("status", recorder.Code),
+		logger.Int64("latency_ms", latency.Milliseconds()),
+		logger.String("operator", GetSessionUser(c)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    recorder.Code == http.StatusOK,
+		"status":     recorder.Code,
+		"latency_ms": latency.Milliseconds(),
+		"path":       t.Path(),
+		"response":   respBody,
+	})
+}
+
+// templateErrorStatus 将模板操作错误映射为HTTP状态码
+func templateErrorStatus(err error) int {
+	if errors.Is(err, errTemplateNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusBadRequest
+}
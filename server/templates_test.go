@@ -0,0 +1,133 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestTemplate() RequestTemplate {
+	return RequestTemplate{
+		Name:     "smoke",
+		API:      TemplateAPIOpenAI,
+		Model:    "claude-sonnet-4-20250514",
+		System:   "be brief",
+		Messages: json.RawMessage(`[{"role":"user","content":"ping"}]`),
+		Params:   map[string]any{"max_tokens": 32},
+	}
+}
+
+func TestTemplateStore_CRUDPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "templates.json")
+	store, err := NewTemplateStore(path)
+	require.NoError(t, err)
+
+	created, err := store.Create(newTestTemplate())
+	require.NoError(t, err)
+	assert.NotEmpty(t, created.ID)
+
+	update := newTestTemplate()
+	update.Name = "smoke-v2"
+	updated, err := store.Update(created.ID, update)
+	require.NoError(t, err)
+	assert.Equal(t, created.CreatedAt, updated.CreatedAt)
+
+	reloaded, err := NewTemplateStore(path)
+	require.NoError(t, err)
+	got, ok := reloaded.Get(created.ID)
+	require.True(t, ok)
+	assert.Equal(t, "smoke-v2", got.Name)
+
+	require.NoError(t, reloaded.Delete(created.ID))
+	assert.ErrorIs(t, reloaded.Delete(created.ID), errTemplateNotFound)
+}
+
+func TestValidateTemplate(t *testing.T) {
+	cases := map[string]func(*RequestTemplate){
+		"empty name":       func(t *RequestTemplate) { t.Name = " " },
+		"bad api":          func(t *RequestTemplate) { t.API = "gemini" },
+		"empty messages":   func(t *RequestTemplate) { t.Messages = json.RawMessage(`[]`) },
+		"reserved param":   func(t *RequestTemplate) { t.Params = map[string]any{"stream": true} },
+		"missing model":    func(t *RequestTemplate) { t.Model = "" },
+		"messages not arr": func(t *RequestTemplate) { t.Messages = json.RawMessage(`{}`) },
+	}
+	for name, mutate := range cases {
+		tmpl := newTestTemplate()
+		mutate(&tmpl)
+		assert.Error(t, validateTemplate(tmpl), name)
+	}
+	assert.NoError(t, validateTemplate(newTestTemplate()))
+}
+
+func TestRequestTemplate_BuildRequestBody(t *testing.T) {
+	tmpl := newTestTemplate()
+	body, err := tmpl.BuildRequestBody(false)
+	require.NoError(t, err)
+	messages := body["messages"].([]any)
+	require.Len(t, messages, 2)
+	assert.Equal(t, "system", messages[0].(map[string]any)["role"])
+	assert.Equal(t, 32, body["max_tokens"])
+
+	tmpl.API = TemplateAPIAnthropic
+	tmpl.Params = nil
+	body, err = tmpl.BuildRequestBody(true)
+	require.NoError(t, err)
+	assert.Equal(t, "be brief", body["system"])
+	assert.Equal(t, true, body["stream"])
+	assert.Equal(t, 1024, body["max_tokens"])
+	assert.Equal(t, "/v1/messages", tmpl.Path())
+}
+
+func TestTemplateHandlers_Run(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store, err := NewTemplateStore("")
+	require.NoError(t, err)
+	created, err := store.Create(newTestTemplate())
+	require.NoError(t, err)
+
+	// 强制请求签名：试运行以指定的签名密钥身份经过认证中间件
+	verifier, err := NewSignatureVerifier([]SigningKey{{ID: "team-a", Secret: "s"}}, time.Minute, true)
+	require.NoError(t, err)
+	var gotKey, gotAuth string
+	var gotBody map[string]any
+	upstream := gin.New()
+	upstream.Use(PathBasedAuthMiddlewareWithSigning("secret-key", []string{"/v1"}, verifier))
+	upstream.POST("/v1/chat/completions", func(c *gin.Context) {
+		gotKey, gotAuth = GetClientKeyID(c), c.GetHeader("Authorization")
+		data, _ := io.ReadAll(c.Request.Body)
+		_ = json.Unmarshal(data, &gotBody)
+		c.JSON(http.StatusOK, gin.H{"id": "chatcmpl-1"})
+	})
+
+	h := NewTemplateHandlers(store, upstream, verifier)
+	r := gin.New()
+	r.POST("/api/templates/:id/run", h.HandleRun)
+	run := func(query string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/templates/"+created.ID+"/run"+query, strings.NewReader("")))
+		return w
+	}
+
+	w := run("?key_id=team-a")
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, true, resp["success"])
+	assert.Contains(t, resp["response"], "chatcmpl-1")
+	assert.Equal(t, "team-a", gotKey)
+	assert.Empty(t, gotAuth, "不再携带服务端密钥")
+	assert.Equal(t, false, gotBody["stream"])
+
+	// 强制签名时不能以 default 身份运行，未知密钥同样拒绝
+	assert.Equal(t, http.StatusBadRequest, run("").Code)
+	assert.Equal(t, http.StatusBadRequest, run("?key_id=other").Code)
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"kiro2api/auth"
+	"kiro2api/types"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// tenants 当前生效的多租户配置，未配置 TENANT_FILE 时为 nil（所有密钥共享整个账号池）
+var tenants *Tenants
+
+// Tenants 多租户配置：按调用方密钥ID限定可使用的账号标签，账号只要带有其中任一标签即可被选中
+// 未单独配置的密钥使用 Default；Default 也未配置时不限制
+type Tenants struct {
+	Default []string            `json:"default,omitempty" yaml:"default,omitempty"`
+	Keys    map[string][]string `json:"keys" yaml:"keys"`
+}
+
+// LoadTenantsFromEnv 从环境变量加载多租户配置，未配置时返回 nil
+// - TENANT_FILE: 租户文件（.yaml/.yml 按 YAML 解析，其余按 JSON）
+func LoadTenantsFromEnv() (*Tenants, error) {
+	path := utils.GetEnvWithDefault("TENANT_FILE", "")
+	if path == "" {
+		return nil, nil
+	}
+	return LoadTenantsFile(path)
+}
+
+// LoadTenantsFile 读取并校验多租户配置文件，标签按账号标签的规则规范化
+func LoadTenantsFile(path string) (*Tenants, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取租户文件失败: %w", err)
+	}
+
+	var t Tenants
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &t)
+	default:
+		err = json.Unmarshal(data, &t)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析租户文件失败: %w", err)
+	}
+
+	if t.Default != nil {
+		if t.Default = auth.NormalizeTags(t.Default); t.Default == nil {
+			return nil, fmt.Errorf("default 至少需要一个账号标签")
+		}
+	}
+	for keyID, tags := range t.Keys {
+		if strings.TrimSpace(keyID) == "" {
+			return nil, fmt.Errorf("密钥ID不能为空")
+		}
+		normalized := auth.NormalizeTags(tags)
+		if normalized == nil {
+			return nil, fmt.Errorf("密钥 %s 至少需要一个账号标签", keyID)
+		}
+		t.Keys[keyID] = normalized
+	}
+	if len(t.Keys) == 0 && t.Default == nil {
+		return nil, fmt.Errorf("租户文件未配置任何密钥")
+	}
+	return &t, nil
+}
+
+// TagsFor 返回密钥可使用的账号标签，nil 表示不限制
+func (t *Tenants) TagsFor(keyID string) []string {
+	if t == nil {
+		return nil
+	}
+	if tags, ok := t.Keys[keyID]; ok {
+		return tags
+	}
+	return t.Default
+}
+
+// tenantTokenProvider 支持按账号标签选择token的来源（AuthService 实现）
+type tenantTokenProvider interface {
+	GetTokenForTags(model, preferID string, tags []string) (types.TokenInfo, error)
+	GetTokenWithUsageForTags(model, preferID string, tags []string) (*types.TokenWithUsage, error)
+}
+
+// tenantTokenSource 限定在租户账号标签内选择token的来源
+// 同时实现粘性路由与失败切换需要的接口，切换token重试也不会越过租户边界
+type tenantTokenSource struct {
+	provider tenantTokenProvider
+	failover tokenFailoverSource
+	tags     []string
+}
+
+func (s *tenantTokenSource) GetTokenForModel(model string) (types.TokenInfo, error) {
+	return s.provider.GetTokenForTags(model, "", s.tags)
+}
+
+func (s *tenantTokenSource) GetTokenWithUsageForModel(model string) (*types.TokenWithUsage, error) {
+	return s.provider.GetTokenWithUsageForTags(model, "", s.tags)
+}
+
+func (s *tenantTokenSource) GetTokenForModelPreferring(model, preferID string) (types.TokenInfo, error) {
+	return s.provider.GetTokenForTags(model, preferID, s.tags)
+}
+
+func (s *tenantTokenSource) GetTokenWithUsageForModelPreferring(model, preferID string) (*types.TokenWithUsage, error) {
+	return s.provider.GetTokenWithUsageForTags(model, preferID, s.tags)
+}
+
+func (s *tenantTokenSource) ReportTokenFailure(configID string, status int) {
+	if s.failover != nil {
+		s.failover.ReportTokenFailure(configID, status)
+	}
+}
+
+// unscopedTokenSource 不支持按标签选择的token来源（测试替身），配置了租户限制时拒绝选择，不越过租户边界
+type unscopedTokenSource struct {
+	tags []string
+}
+
+func (s unscopedTokenSource) GetTokenForModel(model string) (types.TokenInfo, error) {
+	return types.TokenInfo{}, s.err(model)
+}
+
+func (s unscopedTokenSource) GetTokenWithUsageForModel(model string) (*types.TokenWithUsage, error) {
+	return nil, s.err(model)
+}
+
+func (s unscopedTokenSource) err(model string) error {
+	return fmt.Errorf("%w: %s（token来源不支持按账号标签 %s 选择）", auth.ErrNoEligibleToken, model, strings.Join(s.tags, ","))
+}
+
+// tenantScopedSource 按调用方密钥的租户配置限定token来源，未限制时原样返回
+func tenantScopedSource(c *gin.Context, source modelTokenSource) modelTokenSource {
+	tags := tenants.TagsFor(GetClientKeyID(c))
+	if len(tags) == 0 {
+		return source
+	}
+	provider, ok := source.(tenantTokenProvider)
+	if !ok {
+		return unscopedTokenSource{tags: tags}
+	}
+	failover, _ := source.(tokenFailoverSource)
+	return &tenantTokenSource{provider: provider, failover: failover, tags: tags}
+}
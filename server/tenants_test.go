@@ -0,0 +1,121 @@
+package server
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"kiro2api/auth"
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTenantProvider 记录选择token时使用的账号标签
+type fakeTenantProvider struct {
+	tags     []string
+	preferID string
+	reported []string
+}
+
+func (f *fakeTenantProvider) GetTokenForModel(model string) (types.TokenInfo, error) {
+	return f.GetTokenForTags(model, "", nil)
+}
+
+func (f *fakeTenantProvider) GetTokenWithUsageForModel(model string) (*types.TokenWithUsage, error) {
+	return f.GetTokenWithUsageForTags(model, "", nil)
+}
+
+func (f *fakeTenantProvider) GetTokenForTags(model, preferID string, tags []string) (types.TokenInfo, error) {
+	f.tags, f.preferID = tags, preferID
+	return types.TokenInfo{AccessToken: "t", ConfigID: "a"}, nil
+}
+
+func (f *fakeTenantProvider) GetTokenWithUsageForTags(model, preferID string, tags []string) (*types.TokenWithUsage, error) {
+	token, err := f.GetTokenForTags(model, preferID, tags)
+	return &types.TokenWithUsage{TokenInfo: token}, err
+}
+
+func (f *fakeTenantProvider) ReportTokenFailure(configID string, status int) {
+	f.reported = append(f.reported, configID)
+}
+
+func withTenants(t *testing.T, value *Tenants) {
+	original := tenants
+	tenants = value
+	t.Cleanup(func() { tenants = original })
+}
+
+func tenantContext(keyID string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Set(clientKeyIDKey, keyID)
+	return c
+}
+
+func TestLoadTenantsFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tenants.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("default: [Shared]\nkeys:\n  team-a: [' Team-A ', team-a, shared]\n"), 0o600))
+
+	loaded, err := LoadTenantsFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team-a", "shared"}, loaded.TagsFor("team-a"))
+	assert.Equal(t, []string{"shared"}, loaded.TagsFor("other"))
+
+	jsonPath := filepath.Join(dir, "tenants.json")
+	require.NoError(t, os.WriteFile(jsonPath, []byte(`{"keys": {"team-b": ["team-b"]}}`), 0o600))
+	loaded, err = LoadTenantsFile(jsonPath)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team-b"}, loaded.TagsFor("team-b"))
+	assert.Nil(t, loaded.TagsFor("default"), "未配置 default 时其他密钥不限制")
+
+	var nilTenants *Tenants
+	assert.Nil(t, nilTenants.TagsFor("team-a"))
+
+	invalid := map[string]string{
+		"empty.json":         `{}`,
+		"no-tags.json":       `{"keys": {"team-a": [" "]}}`,
+		"blank-key.json":     `{"keys": {" ": ["a"]}}`,
+		"empty-default.json": `{"default": []}`,
+		"broken.json":        `{`,
+	}
+	for name, content := range invalid {
+		p := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(p, []byte(content), 0o600))
+		_, err := LoadTenantsFile(p)
+		assert.Error(t, err, name)
+	}
+	_, err = LoadTenantsFile(filepath.Join(dir, "missing.json"))
+	assert.Error(t, err)
+}
+
+func TestTenantScopedSource(t *testing.T) {
+	provider := &fakeTenantProvider{}
+
+	// 未配置多租户时原样返回
+	withTenants(t, nil)
+	assert.Same(t, provider, tenantScopedSource(tenantContext("team-a"), provider))
+
+	withTenants(t, &Tenants{Keys: map[string][]string{"team-a": {"team-a"}}})
+	assert.Same(t, provider, tenantScopedSource(tenantContext("other"), provider), "未配置的密钥不限制")
+
+	source := tenantScopedSource(tenantContext("team-a"), provider)
+	_, err := source.GetTokenForModel("claude-sonnet-4")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team-a"}, provider.tags)
+
+	// 粘性路由与失败切换同样限定在租户标签内
+	_, err = source.(stickyTokenSource).GetTokenWithUsageForModelPreferring("claude-sonnet-4", "b")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"team-a"}, provider.tags)
+	assert.Equal(t, "b", provider.preferID)
+	source.(tokenFailoverSource).ReportTokenFailure("a", 429)
+	assert.Equal(t, []string{"a"}, provider.reported)
+
+	// 不支持按标签选择的来源拒绝选择，不越过租户边界
+	_, err = tenantScopedSource(tenantContext("team-a"), &MockAuthService{}).GetTokenForModel("claude-sonnet-4")
+	assert.ErrorIs(t, err, auth.ErrNoEligibleToken)
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"kiro2api/converter"
+	"kiro2api/types"
+	"kiro2api/utils"
+)
+
+// thinkingStripEnabled 为 true 时丢弃思考内容，只向客户端返回正文（THINKING_STRIP）
+// StartServer 注册推理端点时经 loadThinkingStripFromEnv 设置
+var thinkingStripEnabled bool
+
+// loadThinkingStripFromEnv 读取 THINKING_STRIP
+func loadThinkingStripFromEnv() bool {
+	return utils.GetEnvBool("THINKING_STRIP")
+}
+
+// thinkingBlockIndex 思考块固定占用第一个内容块
+const thinkingBlockIndex = 0
+
+// thinkingStream 将上游正文开头的 <thinking> 内容改写为 Anthropic thinking 内容块
+// 出现思考块时，上游的内容块索引整体后移一位，为思考块让出 index 0
+type thinkingStream struct {
+	splitter *converter.ThinkingSplitter
+	strip    bool
+	offset   int  // 上游内容块索引的偏移量（出现思考块后为1）
+	started  bool // 是否已发送思考内容
+	closed   bool // 思考块是否已关闭
+}
+
+// newThinkingStream 请求开启思考时返回改写器，否则返回 nil（事件原样直传）
+func newThinkingStream(req types.AnthropicRequest) *thinkingStream {
+	if !converter.ThinkingEnabled(req) {
+		return nil
+	}
+	return &thinkingStream{splitter: converter.NewThinkingSplitter(), strip: thinkingStripEnabled}
+}
+
+// rewrite 将一个上游事件改写为发往客户端的事件序列
+func (ts *thinkingStream) rewrite(dataMap map[string]any) []map[string]any {
+	eventType, _ := dataMap["type"].(string)
+	if eventType == "content_block_delta" {
+		if delta, ok := dataMap["delta"].(map[string]any); ok && delta["type"] == "text_delta" {
+			text, _ := delta["text"].(string)
+			return ts.emit(ts.splitter.Feed(text), extractIndex(dataMap))
+		}
+	}
+
+	var events []map[string]any
+	switch eventType {
+	case "content_block_start", "content_block_delta", "content_block_stop", "message_delta", "message_stop":
+		// 正文之外的内容开始或消息结束，思考区域随之结束
+		events = ts.emit(ts.splitter.Flush(), 0)
+		events = append(events, ts.closeThinking()...)
+	}
+	return append(events, ts.shiftIndex(dataMap))
+}
+
+// flush 上游结束时输出暂存内容
+func (ts *thinkingStream) flush() []map[string]any {
+	return append(ts.emit(ts.splitter.Flush(), 0), ts.closeThinking()...)
+}
+
+// emit 将拆分片段转换为内容块增量事件
+func (ts *thinkingStream) emit(segments []converter.ThinkingSegment, upstreamIndex int) []map[string]any {
+	var events []map[string]any
+	for _, segment := range segments {
+		if segment.Thinking {
+			if ts.strip || ts.closed {
+				continue
+			}
+			if !ts.started {
+				ts.started = true
+				ts.offset = 1
+			}
+			events = append(events, map[string]any{
+				"type":  "content_block_delta",
+				"index": thinkingBlockIndex,
+				"delta": map[string]any{"type": "thinking_delta", "thinking": segment.Text},
+			})
+			continue
+		}
+		events = append(events, ts.closeThinking()...)
+		events = append(events, map[string]any{
+			"type":  "content_block_delta",
+			"index": upstreamIndex + ts.offset,
+			"delta": map[string]any{"type": "text_delta", "text": segment.Text},
+		})
+	}
+	return events
+}
+
+// closeThinking 正文开始前关闭思考块
+func (ts *thinkingStream) closeThinking() []map[string]any {
+	if !ts.started || ts.closed {
+		return nil
+	}
+	ts.closed = true
+	return []map[string]any{{"type": "content_block_stop", "index": thinkingBlockIndex}}
+}
+
+// shiftIndex 按偏移量调整上游事件的内容块索引
+func (ts *thinkingStream) shiftIndex(dataMap map[string]any) map[string]any {
+	if ts.offset == 0 {
+		return dataMap
+	}
+	index := extractIndex(dataMap)
+	if index < 0 {
+		return dataMap
+	}
+	shifted := make(map[string]any, len(dataMap))
+	for k, v := range dataMap {
+		shifted[k] = v
+	}
+	shifted["index"] = index + ts.offset
+	return shifted
+}
+
+// splitReasoning 非流式响应拆分思考内容与正文，未开启思考时原样返回正文
+func splitReasoning(req types.AnthropicRequest, text string) (thinking, content string) {
+	if !converter.ThinkingEnabled(req) {
+		return "", text
+	}
+	thinking, content = converter.SplitThinking(text)
+	if thinkingStripEnabled {
+		thinking = ""
+	}
+	return thinking, content
+}
@@ -0,0 +1,156 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// thinkingUpstream 上游以多个分片返回带思考标签的回复
+func thinkingUpstream(chunks ...string) []byte {
+	var upstream bytes.Buffer
+	for _, chunk := range chunks {
+		payload, _ := json.Marshal(map[string]string{"content": chunk})
+		upstream.Write(encodeEventStreamFrame("assistantResponseEvent", payload))
+	}
+	return upstream.Bytes()
+}
+
+func withThinking(req types.AnthropicRequest) types.AnthropicRequest {
+	req.Thinking = &types.AnthropicThinking{Type: "enabled", BudgetTokens: 2048}
+	return req
+}
+
+func setThinkingStrip(t *testing.T, strip bool) {
+	t.Helper()
+	original := thinkingStripEnabled
+	t.Setenv("THINKING_STRIP", strconv.FormatBool(strip))
+	thinkingStripEnabled = loadThinkingStripFromEnv()
+	t.Cleanup(func() { thinkingStripEnabled = original })
+}
+
+// anthropicBlocks 按事件累积 Anthropic 内容块，返回 [类型, 内容] 列表并校验块的开始/结束顺序
+func anthropicBlocks(t *testing.T, body string) [][2]string {
+	t.Helper()
+	var blocks [][2]string
+	open := -1
+	for _, ev := range parseSSE(t, body) {
+		var data map[string]any
+		require.NoError(t, json.Unmarshal([]byte(ev.Data), &data))
+		switch data["type"] {
+		case "content_block_start":
+			index := requireIndex(t, data)
+			require.Equal(t, -1, open, "上一个内容块未结束就开始了新块")
+			require.Equal(t, len(blocks), index, "content_block_start 的 index 必须连续")
+			cb := data["content_block"].(map[string]any)
+			blocks = append(blocks, [2]string{cb["type"].(string), ""})
+			open = index
+		case "content_block_delta":
+			index := requireIndex(t, data)
+			require.Equal(t, open, index)
+			delta := data["delta"].(map[string]any)
+			switch delta["type"] {
+			case "thinking_delta":
+				blocks[index][1] += delta["thinking"].(string)
+			case "text_delta":
+				blocks[index][1] += delta["text"].(string)
+			}
+		case "content_block_stop":
+			require.Equal(t, open, requireIndex(t, data))
+			open = -1
+		}
+	}
+	return blocks
+}
+
+func TestAnthropicStream_Thinking(t *testing.T) {
+	setThinkingStrip(t, false)
+	upstream := thinkingUpstream("<think", "ing>先想", "一想</thinking>\n\n答案", "是42")
+
+	body := replayStream(t, upstream, func(c *gin.Context, req types.AnthropicRequest) {
+		handleStreamRequest(c, withThinking(req), &types.TokenWithUsage{})
+	})
+
+	assert.Equal(t, [][2]string{{"thinking", "先想一想"}, {"text", "答案是42"}}, anthropicBlocks(t, body))
+}
+
+func TestAnthropicStream_ThinkingStripped(t *testing.T) {
+	setThinkingStrip(t, true)
+	upstream := thinkingUpstream("<thinking>先想一想</thinking>", "答案是42")
+
+	body := replayStream(t, upstream, func(c *gin.Context, req types.AnthropicRequest) {
+		handleStreamRequest(c, withThinking(req), &types.TokenWithUsage{})
+	})
+
+	assert.Equal(t, [][2]string{{"text", "答案是42"}}, anthropicBlocks(t, body))
+}
+
+func TestAnthropicStream_ThinkingNotRequested(t *testing.T) {
+	upstream := thinkingUpstream("<thinking>x</thinking>答案")
+
+	body := replayStream(t, upstream, func(c *gin.Context, req types.AnthropicRequest) {
+		handleStreamRequest(c, req, &types.TokenWithUsage{})
+	})
+
+	assert.Equal(t, [][2]string{{"text", "<thinking>x</thinking>答案"}}, anthropicBlocks(t, body), "未开启思考时原样直传")
+}
+
+func TestOpenAIStream_ReasoningContent(t *testing.T) {
+	upstream := thinkingUpstream("<thinking>先想", "一想</thinking>答案")
+
+	for _, strip := range []bool{false, true} {
+		setThinkingStrip(t, strip)
+		body := replayStream(t, upstream, func(c *gin.Context, req types.AnthropicRequest) {
+			handleOpenAIStreamRequest(c, withThinking(req), types.TokenInfo{}, false)
+		})
+
+		var reasoning, content string
+		for _, ev := range parseSSE(t, body) {
+			if ev.Data == "[DONE]" {
+				continue
+			}
+			var chunk struct {
+				Choices []struct {
+					Delta struct {
+						Content          string `json:"content"`
+						ReasoningContent string `json:"reasoning_content"`
+					} `json:"delta"`
+				} `json:"choices"`
+			}
+			require.NoError(t, json.Unmarshal([]byte(ev.Data), &chunk))
+			for _, choice := range chunk.Choices {
+				reasoning += choice.Delta.ReasoningContent
+				content += choice.Delta.Content
+			}
+		}
+		assert.Equal(t, "答案", content)
+		if strip {
+			assert.Empty(t, reasoning)
+		} else {
+			assert.Equal(t, "先想一想", reasoning)
+		}
+	}
+}
+
+func TestOpenAINonStream_ReasoningContent(t *testing.T) {
+	setThinkingStrip(t, false)
+	stubCompletions(t, "<thinking>先想一想</thinking>\n答案")
+
+	w := runOpenAINonStreamRequest(t, withThinking(types.AnthropicRequest{
+		Model:     "claude-sonnet-4-20250514",
+		MaxTokens: 100,
+		Messages:  []types.AnthropicRequestMessage{{Role: "user", Content: "hi"}},
+	}), nil)
+
+	var resp types.OpenAIResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, "答案", resp.Choices[0].Message.Content)
+	assert.Equal(t, "先想一想", resp.Choices[0].Message.ReasoningContent)
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"kiro2api/config"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServerTimeouts 下游连接（客户端 → 本服务）的超时配置
+// 不设置 WriteTimeout：流式响应的总时长由 RequestDeadlines 按端点控制
+type ServerTimeouts struct {
+	ReadHeader time.Duration // 读取请求头超时
+	Read       time.Duration // 读取完整请求（含请求体）超时
+	Idle       time.Duration // keep-alive 空闲连接超时
+}
+
+// serverTimeoutsFrom 取服务配置中的下游连接超时
+// （SERVER_READ_HEADER_TIMEOUT_SECONDS / SERVER_READ_TIMEOUT_SECONDS / SERVER_IDLE_TIMEOUT_SECONDS，见 config.LoadServerConfig）
+func serverTimeoutsFrom(t config.TimeoutSettings) ServerTimeouts {
+	return ServerTimeouts{ReadHeader: t.ReadHeader, Read: t.Read, Idle: t.Idle}
+}
+
+// newHTTPServer 创建带超时配置的HTTP服务器
+func newHTTPServer(addr string, handler http.Handler, timeouts ServerTimeouts) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: timeouts.ReadHeader,
+		ReadTimeout:       timeouts.Read,
+		IdleTimeout:       timeouts.Idle,
+	}
+}
+
+// RequestDeadlines 按端点配置的请求总时长上限（含流式响应），超时后取消上游请求
+type RequestDeadlines struct {
+	Default   time.Duration
+	Overrides map[string]time.Duration // 路径前缀 → 时长，最长前缀优先
+}
+
+// LoadRequestDeadlinesFromEnv 从环境变量加载请求总时长上限
+// - REQUEST_DEADLINE_SECONDS: 默认上限（默认900，0不限制）
+// - REQUEST_DEADLINE_OVERRIDES: 按端点覆盖，如 "/v1/chat/completions=300,/v1/messages/count_tokens=30"
+func LoadRequestDeadlinesFromEnv() (RequestDeadlines, error) {
+	deadlines := RequestDeadlines{
+		Default:   time.Duration(utils.GetEnvIntWithDefault("REQUEST_DEADLINE_SECONDS", 900)) * time.Second,
+		Overrides: make(map[string]time.Duration),
+	}
+	for _, item := range strings.Split(os.Getenv("REQUEST_DEADLINE_OVERRIDES"), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		path, value, ok := strings.Cut(item, "=")
+		seconds, err := strconv.Atoi(strings.TrimSpace(value))
+		if !ok || !strings.HasPrefix(path, "/") || err != nil || seconds < 0 {
+			return RequestDeadlines{}, fmt.Errorf("REQUEST_DEADLINE_OVERRIDES 配置无效: %s", item)
+		}
+		deadlines.Overrides[strings.TrimSpace(path)] = time.Duration(seconds) * time.Second
+	}
+	return deadlines, nil
+}
+
+// For 获取路径对应的总时长上限，0表示不限制
+func (d RequestDeadlines) For(path string) time.Duration {
+	best, matched := "", false
+	for prefix := range d.Overrides {
+		if strings.HasPrefix(path, prefix) && len(prefix) >= len(best) {
+			best, matched = prefix, true
+		}
+	}
+	if matched {
+		return d.Overrides[best]
+	}
+	return d.Default
+}
+
+// RequestDeadlineMiddleware 为匹配前缀的请求设置总时长上限
+// 上游请求绑定该上下文，上游挂起时到期即取消，不会无限占用协程
+func RequestDeadlineMiddleware(deadlines RequestDeadlines, prefixes []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requiresAuth(c.Request.URL.Path, prefixes) {
+			c.Next()
+			return
+		}
+		timeout := deadlines.For(c.Request.URL.Path)
+		if timeout <= 0 {
+			c.Next()
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+// isTimeoutError 判断是否为超时错误（请求总时长到期、首字节超时、连接超时）
+func isTimeoutError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kiro2api/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadRequestDeadlinesFromEnv(t *testing.T) {
+	t.Setenv("REQUEST_DEADLINE_SECONDS", "600")
+	t.Setenv("REQUEST_DEADLINE_OVERRIDES", "/v1/chat/completions=300, /v1/messages/count_tokens=30,/v1/messages=0")
+	deadlines, err := LoadRequestDeadlinesFromEnv()
+	require.NoError(t, err)
+
+	assert.Equal(t, 300*time.Second, deadlines.For("/v1/chat/completions"))
+	assert.Equal(t, 30*time.Second, deadlines.For("/v1/messages/count_tokens"), "最长前缀优先")
+	assert.Equal(t, time.Duration(0), deadlines.For("/v1/messages"))
+	assert.Equal(t, 600*time.Second, deadlines.For("/v1/models"))
+
+	for _, raw := range []string{"v1/messages=10", "/v1/messages", "/v1/messages=abc"} {
+		t.Setenv("REQUEST_DEADLINE_OVERRIDES", raw)
+		_, err := LoadRequestDeadlinesFromEnv()
+		assert.Error(t, err, raw)
+	}
+}
+
+func TestRequestDeadlineMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	deadlines := RequestDeadlines{
+		Default:   time.Minute,
+		Overrides: map[string]time.Duration{"/v1/slow": 20 * time.Millisecond},
+	}
+
+	var remaining time.Duration
+	var ctxErr error
+	r := gin.New()
+	r.Use(RequestDeadlineMiddleware(deadlines, []string{"/v1"}))
+	r.GET("/v1/models", func(c *gin.Context) {
+		deadline, ok := c.Request.Context().Deadline()
+		require.True(t, ok)
+		remaining = time.Until(deadline)
+	})
+	r.GET("/v1/slow", func(c *gin.Context) {
+		// 模拟挂起的上游：请求上下文到期后立即返回
+		select {
+		case <-c.Request.Context().Done():
+			ctxErr = c.Request.Context().Err()
+		case <-time.After(time.Second):
+		}
+	})
+	r.GET("/api/tokens", func(c *gin.Context) {
+		_, ok := c.Request.Context().Deadline()
+		assert.False(t, ok, "非 /v1 请求不设置截止时间")
+	})
+
+	for _, path := range []string{"/v1/models", "/v1/slow", "/api/tokens"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	assert.InDelta(t, time.Minute.Seconds(), remaining.Seconds(), 1)
+	assert.ErrorIs(t, ctxErr, context.DeadlineExceeded)
+}
+
+func TestHandleRequestSendError_Timeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	handleRequestSendError(c, context.DeadlineExceeded)
+	assert.Equal(t, http.StatusGatewayTimeout, w.Code)
+	assert.Contains(t, w.Body.String(), "upstream_timeout")
+}
+
+func TestNewHTTPServer_AppliesTimeouts(t *testing.T) {
+	t.Setenv("SERVER_READ_TIMEOUT_SECONDS", "30")
+	cfg, err := config.LoadServerConfig()
+	require.NoError(t, err)
+	server := newHTTPServer(":0", http.NotFoundHandler(), serverTimeoutsFrom(cfg.Timeouts))
+	assert.Equal(t, 30*time.Second, server.ReadTimeout)
+	assert.Equal(t, 10*time.Second, server.ReadHeaderTimeout)
+	assert.Zero(t, server.WriteTimeout, "流式响应不受写超时限制")
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"kiro2api/logger"
+	"kiro2api/utils"
+
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// TLSConfig 原生 TLS 配置，证书文件与 ACME 二选一，均未配置时使用明文 HTTP
+type TLSConfig struct {
+	CertFile       string        // 证书文件（PEM，可包含证书链）
+	KeyFile        string        // 私钥文件（PEM）
+	ReloadInterval time.Duration // 检查证书文件变更的间隔，<=0 表示只在 SIGHUP 时重新加载
+
+	ACMEDomains  []string // ACME 自动申请证书的域名白名单
+	ACMECacheDir string   // ACME 证书与账号密钥缓存目录
+	ACMEEmail    string   // ACME 账号联系邮箱（可选）
+}
+
+// LoadTLSConfigFromEnv 从环境变量加载 TLS 配置
+// - TLS_CERT_FILE / TLS_KEY_FILE: 证书与私钥文件，文件变更或收到 SIGHUP 时热加载
+// - TLS_RELOAD_SECONDS: 检查证书文件变更的间隔（默认30，0 表示只在 SIGHUP 时重新加载）
+// - TLS_ACME_DOMAINS: 逗号分隔的域名，设置后通过 ACME（Let's Encrypt，TLS-ALPN-01）自动申请证书
+// - TLS_ACME_CACHE_DIR: ACME 缓存目录（默认 ./acme-cache）
+// - TLS_ACME_EMAIL: ACME 账号联系邮箱
+func LoadTLSConfigFromEnv() TLSConfig {
+	cfg := TLSConfig{
+		CertFile:       strings.TrimSpace(os.Getenv("TLS_CERT_FILE")),
+		KeyFile:        strings.TrimSpace(os.Getenv("TLS_KEY_FILE")),
+		ReloadInterval: time.Duration(utils.GetEnvIntWithDefault("TLS_RELOAD_SECONDS", 30)) * time.Second,
+		ACMECacheDir:   utils.GetEnvWithDefault("TLS_ACME_CACHE_DIR", "./acme-cache"),
+		ACMEEmail:      strings.TrimSpace(os.Getenv("TLS_ACME_EMAIL")),
+	}
+	for _, domain := range strings.Split(os.Getenv("TLS_ACME_DOMAINS"), ",") {
+		if domain = strings.TrimSpace(domain); domain != "" {
+			cfg.ACMEDomains = append(cfg.ACMEDomains, domain)
+		}
+	}
+	return cfg
+}
+
+// Enabled 是否启用 TLS
+func (cfg TLSConfig) Enabled() bool {
+	return cfg.CertFile != "" || cfg.KeyFile != "" || len(cfg.ACMEDomains) > 0
+}
+
+// Validate 校验 TLS 配置
+func (cfg TLSConfig) Validate() error {
+	if (cfg.CertFile == "") != (cfg.KeyFile == "") {
+		return fmt.Errorf("TLS_CERT_FILE 与 TLS_KEY_FILE 必须同时设置")
+	}
+	if cfg.CertFile != "" && len(cfg.ACMEDomains) > 0 {
+		return fmt.Errorf("证书文件与 TLS_ACME_DOMAINS 不能同时设置")
+	}
+	if len(cfg.ACMEDomains) > 0 && cfg.ACMECacheDir == "" {
+		return fmt.Errorf("启用 ACME 时 TLS_ACME_CACHE_DIR 不能为空")
+	}
+	return nil
+}
+
+// Build 生成 *tls.Config 并启动证书热加载，返回停止函数
+// 未启用 TLS 时返回 nil 配置
+func (cfg TLSConfig) Build() (*tls.Config, func(), error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	if !cfg.Enabled() {
+		return nil, func() {}, nil
+	}
+
+	if len(cfg.ACMEDomains) > 0 {
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(cfg.ACMEDomains...),
+			Cache:      autocert.DirCache(cfg.ACMECacheDir),
+			Email:      cfg.ACMEEmail,
+		}
+		tlsConfig := manager.TLSConfig()
+		tlsConfig.MinVersion = tls.VersionTLS12
+		return tlsConfig, func() {}, nil
+	}
+
+	reloader, err := newCertReloader(cfg.CertFile, cfg.KeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	stop := reloader.watch(cfg.ReloadInterval)
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+	return tlsConfig, stop, nil
+}
+
+// certReloader 持有当前证书，文件修改时间变化或收到 SIGHUP 时重新加载
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	certTime time.Time
+	keyTime  time.Time
+}
+
+// newCertReloader 加载证书，首次加载失败返回错误
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.reload(false); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// GetCertificate 供 tls.Config 使用，返回当前证书
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// reload 重新加载证书，返回是否已替换
+// force 为 false 时仅在证书或私钥文件修改时间变化时加载；加载失败时保留当前证书
+func (r *certReloader) reload(force bool) (bool, error) {
+	certInfo, err := os.Stat(r.certFile)
+	if err != nil {
+		return false, fmt.Errorf("读取证书文件失败: %w", err)
+	}
+	keyInfo, err := os.Stat(r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("读取私钥文件失败: %w", err)
+	}
+
+	r.mu.RLock()
+	unchanged := certInfo.ModTime().Equal(r.certTime) && keyInfo.ModTime().Equal(r.keyTime)
+	r.mu.RUnlock()
+	if unchanged && !force {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("加载TLS证书失败: %w", err)
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.certTime = certInfo.ModTime()
+	r.keyTime = keyInfo.ModTime()
+	r.mu.Unlock()
+
+	fields := []logger.Field{logger.String("cert_file", r.certFile)}
+	if cert.Leaf != nil {
+		fields = append(fields, logger.String("not_after", cert.Leaf.NotAfter.Format(time.RFC3339)))
+	}
+	logger.Info("TLS证书已加载", fields...)
+	return true, nil
+}
+
+// watch 按间隔检查证书文件变更并监听 SIGHUP，返回停止函数
+func (r *certReloader) watch(interval time.Duration) func() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	var ticker *time.Ticker
+	if interval > 0 {
+		ticker = time.NewTicker(interval)
+		tick = ticker.C
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer signal.Stop(hup)
+		if ticker != nil {
+			defer ticker.Stop()
+		}
+		for {
+			var err error
+			select {
+			case <-done:
+				return
+			case <-hup:
+				logger.Info("收到SIGHUP，重新加载TLS证书")
+				_, err = r.reload(true)
+			case <-tick:
+				_, err = r.reload(false)
+			}
+			if err != nil {
+				logger.Warn("重新加载TLS证书失败，继续使用当前证书",
+					logger.String("cert_file", r.certFile),
+					logger.Err(err))
+			}
+		}
+	}()
+	return func() { close(done) }
+}
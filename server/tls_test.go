@@ -0,0 +1,105 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeSelfSignedCert 生成自签名证书与私钥并写入文件，设置修改时间便于检测变更
+func writeSelfSignedCert(t *testing.T, certFile, keyFile, commonName string, modTime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{commonName},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+}
+
+func currentCommonName(t *testing.T, r *certReloader) string {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloader_ReloadsOnChange(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	base := time.Now().Add(-time.Hour)
+	writeSelfSignedCert(t, certFile, keyFile, "old.example.com", base)
+
+	r, err := newCertReloader(certFile, keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, "old.example.com", currentCommonName(t, r))
+
+	reloaded, err := r.reload(false)
+	require.NoError(t, err)
+	assert.False(t, reloaded, "文件未修改时不重新加载")
+
+	// 证书文件损坏：保留当前证书
+	require.NoError(t, os.WriteFile(certFile, []byte("broken"), 0o600))
+	_, err = r.reload(true)
+	assert.Error(t, err)
+	assert.Equal(t, "old.example.com", currentCommonName(t, r))
+
+	writeSelfSignedCert(t, certFile, keyFile, "new.example.com", base.Add(time.Minute))
+	reloaded, err = r.reload(false)
+	require.NoError(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, "new.example.com", currentCommonName(t, r))
+}
+
+func TestTLSConfig_Validate(t *testing.T) {
+	assert.False(t, TLSConfig{}.Enabled())
+	assert.Error(t, TLSConfig{CertFile: "tls.crt"}.Validate(), "缺少私钥")
+	assert.Error(t, TLSConfig{CertFile: "tls.crt", KeyFile: "tls.key", ACMEDomains: []string{"a.example.com"}}.Validate())
+	assert.Error(t, TLSConfig{ACMEDomains: []string{"a.example.com"}}.Validate(), "缺少缓存目录")
+	assert.NoError(t, TLSConfig{ACMEDomains: []string{"a.example.com"}, ACMECacheDir: t.TempDir()}.Validate())
+
+	tlsConfig, stop, err := TLSConfig{}.Build()
+	require.NoError(t, err)
+	stop()
+	assert.Nil(t, tlsConfig, "未配置时使用明文HTTP")
+}
+
+func TestTLSConfig_BuildWithCertFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	writeSelfSignedCert(t, certFile, keyFile, "proxy.example.com", time.Now())
+
+	tlsConfig, stop, err := TLSConfig{CertFile: certFile, KeyFile: keyFile}.Build()
+	require.NoError(t, err)
+	defer stop()
+	assert.Equal(t, uint16(tls.VersionTLS12), tlsConfig.MinVersion)
+	cert, err := tlsConfig.GetCertificate(&tls.ClientHelloInfo{ServerName: "proxy.example.com"})
+	require.NoError(t, err)
+	assert.NotNil(t, cert)
+}
@@ -1,8 +1,13 @@
 package server
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
-	"strconv"
+	"time"
 
 	"kiro2api/auth"
 	"kiro2api/logger"
@@ -12,10 +17,16 @@ import (
 
 // AddTokenRequest 添加Token的请求结构
 type AddTokenRequest struct {
-	AuthType     string `json:"auth"`
-	RefreshToken string `json:"refreshToken"`
-	ClientID     string `json:"clientId,omitempty"`
-	ClientSecret string `json:"clientSecret,omitempty"`
+	AuthType      string   `json:"auth"`
+	RefreshToken  string   `json:"refreshToken"`
+	ClientID      string   `json:"clientId,omitempty"`
+	ClientSecret  string   `json:"clientSecret,omitempty"`
+	Label         string   `json:"label,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+	Note          string   `json:"note,omitempty"`
+	ProxyURL      string   `json:"proxyUrl,omitempty"`
+	Models        []string `json:"models,omitempty"`
+	MaxConcurrent int      `json:"maxConcurrent,omitempty"`
 }
 
 // TokenAPIResponse 通用API响应结构
@@ -24,22 +35,12 @@ type TokenAPIResponse struct {
 	Message string `json:"message,omitempty"`
 	Error   string `json:"error,omitempty"`
 	Count   int    `json:"count,omitempty"`
-}
-
-// registerTokenManagementRoutes 注册Token管理相关的路由
-func registerTokenManagementRoutes(r *gin.Engine, authService *auth.AuthService) {
-	// 添加Token
-	r.POST("/api/tokens", func(c *gin.Context) {
-		handleAddToken(c, authService)
-	})
-
-	// 删除Token
-	r.DELETE("/api/tokens/:index", func(c *gin.Context) {
-		handleDeleteToken(c, authService)
-	})
+	// ExistingID 添加的refreshToken与已有账号重复时（409），已有账号的ID
+	ExistingID string `json:"existing_id,omitempty"`
 }
 
 // handleAddToken 处理添加Token的请求
+// 默认添加前向上游刷新token验证账号，并在响应中返回账号的过期时间与额度；查询参数 validate=false 跳过验证
 func handleAddToken(c *gin.Context, authService *auth.AuthService) {
 	var req AddTokenRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -62,51 +63,92 @@ func handleAddToken(c *gin.Context, authService *auth.AuthService) {
 
 	// 创建AuthConfig
 	config := auth.AuthConfig{
-		AuthType:     req.AuthType,
-		RefreshToken: req.RefreshToken,
-		ClientID:     req.ClientID,
-		ClientSecret: req.ClientSecret,
+		AuthType:      req.AuthType,
+		RefreshToken:  req.RefreshToken,
+		ClientID:      req.ClientID,
+		ClientSecret:  req.ClientSecret,
+		Label:         req.Label,
+		Tags:          req.Tags,
+		Note:          req.Note,
+		ProxyURL:      req.ProxyURL,
+		Models:        req.Models,
+		MaxConcurrent: req.MaxConcurrent,
 	}
 
-	// 添加配置
-	if err := authService.AddConfig(config); err != nil {
-		logger.Error("添加Token配置失败", logger.Err(err))
-		c.JSON(http.StatusInternalServerError, TokenAPIResponse{
-			Success: false,
-			Error:   "添加Token失败: " + err.Error(),
+	// 默认先向上游刷新验证账号，validate=false 时跳过（添加后在后台刷新）
+	if c.DefaultQuery("validate", "true") == "false" {
+		if err := authService.AddConfig(config); err != nil {
+			respondAddTokenError(c, err)
+			return
+		}
+		logger.Info("通过API添加Token成功",
+			logger.String("auth_type", config.AuthType),
+			logger.Int("total_count", authService.GetConfigCount()))
+		c.JSON(http.StatusOK, TokenAPIResponse{
+			Success: true,
+			Message: "Token添加成功",
+			Count:   authService.GetConfigCount(),
 		})
 		return
 	}
 
-	logger.Info("通过API添加Token成功",
-		logger.String("auth_type", config.AuthType),
+	added, cached, err := authService.AddValidatedConfig(config)
+	if err != nil {
+		respondAddTokenError(c, err)
+		return
+	}
+
+	logger.Info("通过API添加Token成功（已通过上游验证）",
+		logger.String("id", added.ID),
+		logger.String("auth_type", added.AuthType),
 		logger.Int("total_count", authService.GetConfigCount()))
 
-	c.JSON(http.StatusOK, TokenAPIResponse{
-		Success: true,
-		Message: "Token添加成功",
-		Count:   authService.GetConfigCount(),
+	account := gin.H{
+		"id":         added.ID,
+		"auth":       added.AuthType,
+		"label":      added.Label,
+		"expires_at": cached.Token.ExpiresAt.Format(time.RFC3339),
+	}
+	if cached.UsageInfo != nil {
+		account["usage"] = summarizeUsageLimits(cached.UsageInfo)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Token添加成功",
+		"count":   authService.GetConfigCount(),
+		"account": account,
 	})
 }
 
-// handleDeleteToken 处理删除Token的请求
-func handleDeleteToken(c *gin.Context, authService *auth.AuthService) {
-	indexStr := c.Param("index")
-	index, err := strconv.Atoi(indexStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, TokenAPIResponse{
-			Success: false,
-			Error:   "无效的索引参数",
+// respondAddTokenError 添加Token失败的响应：重复时返回409与已有账号ID，上游验证失败时返回422
+func respondAddTokenError(c *gin.Context, err error) {
+	var dup *auth.DuplicateConfigError
+	if errors.As(err, &dup) {
+		logger.Warn("添加的Token与已有账号重复", logger.String("existing_id", dup.ExistingID))
+		c.JSON(http.StatusConflict, TokenAPIResponse{
+			Success:    false,
+			Error:      "添加Token失败: " + err.Error(),
+			ExistingID: dup.ExistingID,
 		})
 		return
 	}
+	logger.Error("添加Token配置失败", logger.Err(err))
+	c.JSON(tokenErrorStatus(err), TokenAPIResponse{
+		Success: false,
+		Error:   "添加Token失败: " + err.Error(),
+	})
+}
+
+// handleDeleteToken 处理删除Token的请求（按稳定ID）
+func handleDeleteToken(c *gin.Context, authService *auth.AuthService) {
+	id := c.Param("id")
 
 	// 删除配置
-	if err := authService.RemoveConfig(index); err != nil {
+	if err := authService.RemoveConfigByID(id); err != nil {
 		logger.Error("删除Token配置失败",
-			logger.Int("index", index),
+			logger.String("id", id),
 			logger.Err(err))
-		c.JSON(http.StatusBadRequest, TokenAPIResponse{
+		c.JSON(tokenErrorStatus(err), TokenAPIResponse{
 			Success: false,
 			Error:   "删除Token失败: " + err.Error(),
 		})
@@ -114,7 +156,7 @@ func handleDeleteToken(c *gin.Context, authService *auth.AuthService) {
 	}
 
 	logger.Info("通过API删除Token成功",
-		logger.Int("deleted_index", index),
+		logger.String("deleted_id", id),
 		logger.Int("remaining_count", authService.GetConfigCount()))
 
 	c.JSON(http.StatusOK, TokenAPIResponse{
@@ -123,3 +165,220 @@ func handleDeleteToken(c *gin.Context, authService *auth.AuthService) {
 		Count:   authService.GetConfigCount(),
 	})
 }
+
+// handleUpdateToken 部分更新Token（启用/禁用、显示名称、标签、备注）
+func handleUpdateToken(c *gin.Context, authService *auth.AuthService) {
+	id := c.Param("id")
+
+	var patch auth.ConfigPatch
+	if err := c.ShouldBindJSON(&patch); err != nil {
+		c.JSON(http.StatusBadRequest, TokenAPIResponse{
+			Success: false,
+			Error:   "无效的请求格式: " + err.Error(),
+		})
+		return
+	}
+
+	if patch.MaxConcurrent != nil && *patch.MaxConcurrent < 0 {
+		c.JSON(http.StatusBadRequest, TokenAPIResponse{
+			Success: false,
+			Error:   "maxConcurrent不能为负数",
+		})
+		return
+	}
+
+	updated, err := authService.UpdateConfig(id, patch)
+	if err != nil {
+		logger.Error("更新Token配置失败",
+			logger.String("id", id),
+			logger.Err(err))
+		c.JSON(tokenErrorStatus(err), TokenAPIResponse{
+			Success: false,
+			Error:   "更新Token失败: " + err.Error(),
+		})
+		return
+	}
+
+	logger.Info("通过API更新Token成功",
+		logger.String("id", id),
+		logger.Bool("disabled", updated.Disabled),
+		logger.String("operator", GetSessionUser(c)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Token更新成功",
+		"token": gin.H{
+			"id":             updated.ID,
+			"disabled":       updated.Disabled,
+			"label":          updated.Label,
+			"tags":           updated.Tags,
+			"note":           updated.Note,
+			"models":         updated.Models,
+			"max_concurrent": updated.MaxConcurrent,
+		},
+	})
+}
+
+// tokenErrorStatus 将配置操作错误映射为HTTP状态码
+func tokenErrorStatus(err error) int {
+	if errors.Is(err, auth.ErrConfigNotFound) {
+		return http.StatusNotFound
+	}
+	if errors.Is(err, auth.ErrReadOnly) {
+		return http.StatusForbidden
+	}
+	if errors.Is(err, auth.ErrDuplicateConfig) {
+		return http.StatusConflict
+	}
+	if errors.Is(err, auth.ErrConfigValidation) {
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// handleTokenSnapshot 返回Token池的时间点快照，供外部备份系统使用
+// 查询参数:
+//   - secrets: omit（默认）/ plain（仅管理员）
+//   - public_key: base64编码的PEM格式RSA公钥（也可通过 X-Snapshot-Public-Key 头传入），
+//     提供时密钥字段将被加密
+func handleTokenSnapshot(c *gin.Context, authService *auth.AuthService) {
+	opts := auth.SnapshotOptions{
+		Secrets: c.DefaultQuery("secrets", auth.SnapshotSecretsOmit),
+	}
+
+	encodedKey := c.Query("public_key")
+	if encodedKey == "" {
+		encodedKey = c.GetHeader("X-Snapshot-Public-Key")
+	}
+	if encodedKey != "" {
+		pemData, err := base64.StdEncoding.DecodeString(encodedKey)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, TokenAPIResponse{
+				Success: false,
+				Error:   "public_key 必须为base64编码的PEM公钥",
+			})
+			return
+		}
+		publicKey, err := auth.ParseSnapshotPublicKey(pemData)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, TokenAPIResponse{
+				Success: false,
+				Error:   err.Error(),
+			})
+			return
+		}
+		opts.Secrets = auth.SnapshotSecretsEncrypt
+		opts.PublicKey = publicKey
+	}
+
+	// 明文密钥快照等同于导出全部凭证，仅管理员可用
+	if opts.Secrets == auth.SnapshotSecretsPlain && !abortIfRoleDenied(c, RoleAdmin) {
+		return
+	}
+
+	snapshot, err := authService.Snapshot(opts)
+	if err != nil {
+		logger.Warn("生成Token池快照失败", logger.Err(err))
+		c.JSON(http.StatusBadRequest, TokenAPIResponse{
+			Success: false,
+			Error:   "生成快照失败: " + err.Error(),
+		})
+		return
+	}
+
+	logger.Info("生成Token池快照",
+		logger.String("secrets", snapshot.Secrets),
+		logger.Int("account_count", len(snapshot.Accounts)),
+		logger.String("operator", GetSessionUser(c)))
+
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// handleExportTokens 导出Token池为JSON文件下载
+// 默认脱敏密钥字段（脱敏后的文件不能再导入）；查询参数 mask=false 导出明文，仅管理员可用
+func handleExportTokens(c *gin.Context, authService *auth.AuthService) {
+	mask := c.Query("mask") != "false" && c.Query("mask") != "0"
+
+	// 明文导出等同于导出全部凭证，与明文快照一样仅管理员可用
+	if !mask && !abortIfRoleDenied(c, RoleAdmin) {
+		return
+	}
+	export := authService.Export(mask)
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, TokenAPIResponse{
+			Success: false,
+			Error:   "导出失败: " + err.Error(),
+		})
+		return
+	}
+
+	logger.Info("导出Token池",
+		logger.Bool("masked", mask),
+		logger.Int("account_count", len(export.Accounts)),
+		logger.String("operator", GetSessionUser(c)))
+
+	filename := fmt.Sprintf("kiro2api-tokens-%s.json", time.Now().UTC().Format("20060102-150405"))
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	c.Header("Cache-Control", "no-store")
+	c.Data(http.StatusOK, "application/json; charset=utf-8", data)
+}
+
+// handleImportTokens 批量导入Token（接受导出文件格式或配置数组），按refreshToken哈希去重
+func handleImportTokens(c *gin.Context, authService *auth.AuthService) {
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, TokenAPIResponse{
+			Success: false,
+			Error:   "读取请求体失败: " + err.Error(),
+		})
+		return
+	}
+
+	var configs []auth.AuthConfig
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &configs)
+	} else {
+		var export auth.PoolExport
+		err = json.Unmarshal(trimmed, &export)
+		configs = export.Accounts
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, TokenAPIResponse{
+			Success: false,
+			Error:   "无效的导入格式: " + err.Error(),
+		})
+		return
+	}
+	if len(configs) == 0 {
+		c.JSON(http.StatusBadRequest, TokenAPIResponse{
+			Success: false,
+			Error:   "导入内容为空",
+		})
+		return
+	}
+
+	result, err := authService.Import(configs)
+	if err != nil {
+		logger.Error("导入Token失败", logger.Err(err))
+		c.JSON(tokenErrorStatus(err), TokenAPIResponse{
+			Success: false,
+			Error:   "导入失败: " + err.Error(),
+		})
+		return
+	}
+
+	logger.Info("通过API导入Token",
+		logger.Int("imported", result.Imported),
+		logger.Int("duplicates", result.Duplicates),
+		logger.Int("invalid", len(result.Invalid)),
+		logger.String("operator", GetSessionUser(c)))
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"result":  result,
+		"count":   authService.GetConfigCount(),
+	})
+}
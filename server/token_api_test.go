@@ -0,0 +1,166 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"kiro2api/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenAPI_UpdateAndDeleteByID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	as := newTestAuthService(t, auth.AuthConfig{ID: "abc", AuthType: auth.AuthMethodSocial, RefreshToken: "rt"})
+
+	r := gin.New()
+	r.PATCH("/api/tokens/:id", func(c *gin.Context) { handleUpdateToken(c, as) })
+	r.DELETE("/api/tokens/:id", func(c *gin.Context) { handleDeleteToken(c, as) })
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPatch, "/api/tokens/abc", strings.NewReader(`{"disabled":true,"tags":["Backup"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	cfg, ok := as.GetConfigByID("abc")
+	require.True(t, ok)
+	assert.True(t, cfg.Disabled)
+	assert.Equal(t, []string{"backup"}, cfg.Tags)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/tokens/missing", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/tokens/abc", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 0, as.GetConfigCount())
+}
+
+func TestTokenAPI_AddDuplicateReturnsConflict(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	as := newTestAuthService(t, auth.AuthConfig{ID: "abc", AuthType: auth.AuthMethodSocial, RefreshToken: "rt"})
+
+	r := gin.New()
+	r.POST("/api/tokens", func(c *gin.Context) { handleAddToken(c, as) })
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/tokens", strings.NewReader(`{"auth":"Social","refreshToken":"rt"}`))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusConflict, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), `"existing_id":"abc"`)
+	assert.Equal(t, 1, as.GetConfigCount())
+}
+
+func TestTokenAPI_ListMasksSecrets(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	as := newTestAuthService(t,
+		auth.AuthConfig{ID: "a", AuthType: auth.AuthMethodSocial, RefreshToken: "aaaa-secret-refresh-zzzz", Label: "主账号"},
+		auth.AuthConfig{ID: "b", AuthType: auth.AuthMethodIdC, RefreshToken: "bbbb-secret-refresh-yyyy", ClientID: "cid", ClientSecret: "client-secret", Disabled: true},
+	)
+
+	r := gin.New()
+	r.GET("/api/tokens/list", func(c *gin.Context) { handleListTokens(c, as) })
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/tokens/list", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	body := w.Body.String()
+	assert.NotContains(t, body, "secret-refresh")
+	assert.NotContains(t, body, "client-secret")
+
+	var resp struct {
+		Total  int `json:"total"`
+		Tokens []struct {
+			ID           string `json:"id"`
+			RefreshToken string `json:"refreshToken"`
+			Label        string `json:"label"`
+			Status       string `json:"status"`
+			Health       string `json:"health"`
+		} `json:"tokens"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, 2, resp.Total)
+	assert.Equal(t, "aaaa****zzzz", resp.Tokens[0].RefreshToken)
+	assert.Equal(t, "主账号", resp.Tokens[0].Label)
+	assert.Equal(t, auth.AccountStatusPending, resp.Tokens[0].Status)
+	assert.Equal(t, "closed", resp.Tokens[0].Health)
+	assert.Equal(t, auth.AccountStatusDisabled, resp.Tokens[1].Status)
+}
+
+func TestTokenAPI_PlainSnapshotRequiresAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	as := newTestAuthService(t, auth.AuthConfig{ID: "a", AuthType: auth.AuthMethodSocial, RefreshToken: "aaaa-secret-refresh-zzzz"})
+
+	newRouter := func(role Role) *gin.Engine {
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			c.Set(sessionUserKey, "u")
+			c.Set(sessionRoleKey, role)
+			c.Next()
+		})
+		r.GET("/api/tokens/snapshot", RequireRole(RoleOperator), func(c *gin.Context) { handleTokenSnapshot(c, as) })
+		return r
+	}
+
+	tests := []struct {
+		role  Role
+		query string
+		want  int
+	}{
+		{RoleOperator, "", http.StatusOK},
+		{RoleOperator, "?secrets=plain", http.StatusForbidden},
+		{RoleAdmin, "?secrets=plain", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		newRouter(tt.role).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/tokens/snapshot"+tt.query, nil))
+		assert.Equal(t, tt.want, w.Code, "%s as %s", tt.query, tt.role)
+		if tt.want == http.StatusForbidden {
+			assert.NotContains(t, w.Body.String(), "secret-refresh")
+		}
+	}
+}
+
+func TestTokenAPI_PlainExportRequiresAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	as := newTestAuthService(t, auth.AuthConfig{ID: "a", AuthType: auth.AuthMethodSocial, RefreshToken: "aaaa-secret-refresh-zzzz"})
+
+	newRouter := func(role Role) *gin.Engine {
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			c.Set(sessionUserKey, "u")
+			c.Set(sessionRoleKey, role)
+			c.Next()
+		})
+		r.GET("/api/tokens/export", RequireRole(RoleOperator), func(c *gin.Context) { handleExportTokens(c, as) })
+		return r
+	}
+
+	tests := []struct {
+		role      Role
+		query     string
+		want      int
+		plaintext bool
+	}{
+		{RoleOperator, "", http.StatusOK, false},
+		{RoleOperator, "?mask=false", http.StatusForbidden, false},
+		{RoleAdmin, "", http.StatusOK, false},
+		{RoleAdmin, "?mask=false", http.StatusOK, true},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		newRouter(tt.role).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/tokens/export"+tt.query, nil))
+		assert.Equal(t, tt.want, w.Code, "%s as %s", tt.query, tt.role)
+		assert.Equal(t, tt.plaintext, strings.Contains(w.Body.String(), "secret-refresh"), "%s as %s", tt.query, tt.role)
+	}
+}
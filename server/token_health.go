@@ -0,0 +1,106 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"kiro2api/auth"
+	"kiro2api/breaker"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleTokenHealth 返回每个token在各上游端点上的熔断器状态
+// 未出现过上游错误的token没有熔断器记录，视为 closed
+func handleTokenHealth(c *gin.Context, authService *auth.AuthService) {
+	byConfig := breakersByConfig()
+
+	configs := authService.GetConfigs()
+	tokens := make([]gin.H, 0, len(configs))
+	openCount := 0
+	for i, cfg := range configs {
+		breakers := byConfig[cfg.ID]
+		state := worstBreakerState(breakers)
+		if state == breaker.StateOpen {
+			openCount++
+		}
+		if breakers == nil {
+			breakers = []breaker.Snapshot{}
+		}
+		tokens = append(tokens, gin.H{
+			"index":    i,
+			"id":       cfg.ID,
+			"label":    cfg.Label,
+			"disabled": cfg.Disabled,
+			"breaker":  state,
+			"breakers": breakers,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"timestamp": time.Now().Format(time.RFC3339),
+		"circuit_breaker": gin.H{
+			"threshold":        auth.UpstreamBreakers.Threshold(),
+			"cooldown_seconds": int(auth.UpstreamBreakers.Cooldown().Seconds()),
+		},
+		"total_tokens": len(tokens),
+		"open_tokens":  openCount,
+		"tokens":       tokens,
+	})
+}
+
+// breakersByConfig 按账号ID分组上游熔断器快照
+func breakersByConfig() map[string][]breaker.Snapshot {
+	byConfig := make(map[string][]breaker.Snapshot)
+	for _, snap := range auth.UpstreamBreakers.Snapshots() {
+		configID, _ := breaker.SplitKey(snap.Key)
+		byConfig[configID] = append(byConfig[configID], snap)
+	}
+	return byConfig
+}
+
+// worstBreakerState 账号在各端点上最差的熔断器状态：open > half_open > closed
+func worstBreakerState(breakers []breaker.Snapshot) string {
+	state := breaker.StateClosed
+	for _, snap := range breakers {
+		if snap.State == breaker.StateOpen {
+			return breaker.StateOpen
+		}
+		if snap.State == breaker.StateHalfOpen {
+			state = breaker.StateHalfOpen
+		}
+	}
+	return state
+}
+
+// tokenListItem 账号列表中的一项：脱敏的账号摘要、熔断器状态与最近一次查询到的额度
+type tokenListItem struct {
+	auth.AccountSummary
+	Health string `json:"health"`
+	Usage  gin.H  `json:"usage,omitempty"`
+}
+
+// handleListTokens 列出Token池中的账号（脱敏），只读取内存中的配置、token缓存与熔断器状态，不访问上游
+// 供管理界面枚举账号；refreshToken 仅保留首尾各4位
+func handleListTokens(c *gin.Context, authService *auth.AuthService) {
+	byConfig := breakersByConfig()
+	accounts := authService.Accounts()
+
+	tokens := make([]tokenListItem, 0, len(accounts))
+	for _, account := range accounts {
+		item := tokenListItem{
+			AccountSummary: account,
+			Health:         worstBreakerState(byConfig[account.ID]),
+		}
+		if account.Usage != nil {
+			item.Usage = summarizeUsageLimits(account.Usage)
+		}
+		tokens = append(tokens, item)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"timestamp": time.Now().Format(time.RFC3339),
+		"total":     len(tokens),
+		"tokens":    tokens,
+	})
+}
@@ -0,0 +1,383 @@
+package server
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"kiro2api/auth"
+	"kiro2api/logger"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tokenQueue token池饱和时的请求排队（nil 表示未启用，饱和时直接失败）
+var tokenQueue *TokenQueue
+
+// QueueRejectedError 排队失败：队列已满、等待超时或低优先级请求被拒绝
+type QueueRejectedError struct {
+	Reason     string        // queue_full / queue_timeout / low_priority_shed
+	RetryAfter time.Duration // 建议的重试等待时间
+	Cause      error         // 最后一次获取token的错误
+}
+
+func (e *QueueRejectedError) Error() string {
+	switch e.Reason {
+	case "queue_full":
+		return "token池已饱和且等待队列已满"
+	case "low_priority_shed":
+		return "token池已饱和，低优先级请求不排队"
+	}
+	return fmt.Sprintf("token池已饱和，排队等待超时: %v", e.Cause)
+}
+
+func (e *QueueRejectedError) Unwrap() error { return e.Cause }
+
+// TokenQueue token池饱和时的有界优先级等待队列
+// 队列按优先级排序，同一优先级按到达顺序；只有队首的请求轮询获取token，
+// 高优先级请求到达时插到低优先级请求之前（队首被抢占后回到等待），队列已满时挤出排在最后的低优先级请求；
+// 超过最大深度立即拒绝，超过最长等待时间超时
+type TokenQueue struct {
+	maxDepth     int
+	maxWait      time.Duration
+	pollInterval time.Duration
+	shedLow      bool // token池饱和时低优先级请求不排队，直接拒绝
+
+	mu        sync.Mutex
+	waiters   *list.List // *queueWaiter，按优先级与到达顺序排列
+	served    int64
+	timeout   int64
+	full      int64
+	shed      int64
+	preempted int64
+	avgWait   time.Duration // 排队成功请求等待时间的指数移动平均
+}
+
+// queueWaiter 排队中的请求
+type queueWaiter struct {
+	priority RequestPriority
+	turn     chan struct{} // 轮到队首时关闭；被高优先级请求抢占队首后换成新的通道
+	evicted  chan struct{} // 队列已满时被高优先级请求挤出队列时关闭
+}
+
+// QueueStats 排队统计
+type QueueStats struct {
+	Enabled         bool           `json:"enabled"`
+	Depth           int            `json:"depth"`
+	DepthByPriority map[string]int `json:"depth_by_priority,omitempty"`
+	MaxDepth        int            `json:"max_depth"`
+	MaxWaitSeconds  float64        `json:"max_wait_seconds"`
+	ShedLowPriority bool           `json:"shed_low_priority"`
+	Served          int64          `json:"served"`
+	TimedOut        int64          `json:"timed_out"`
+	Rejected        int64          `json:"rejected"`
+	Shed            int64          `json:"shed"`
+	Preempted       int64          `json:"preempted"`
+	AvgWaitMs       int64          `json:"avg_wait_ms"`
+}
+
+// LoadTokenQueueFromEnv 从环境变量加载排队配置，未启用时返回 nil
+// - TOKEN_QUEUE_MAX_DEPTH: 最大排队请求数（默认0，关闭）
+// - TOKEN_QUEUE_MAX_WAIT_SECONDS: 单个请求的最长等待时间（默认30）
+// - TOKEN_QUEUE_POLL_MS: 队首请求重新获取token的间隔（默认500）
+// - PRIORITY_SHED_LOW: token池饱和时低优先级请求不排队，直接拒绝（默认 false）
+func LoadTokenQueueFromEnv() (*TokenQueue, error) {
+	maxDepth := utils.GetEnvIntWithDefault("TOKEN_QUEUE_MAX_DEPTH", 0)
+	if maxDepth < 0 {
+		return nil, fmt.Errorf("TOKEN_QUEUE_MAX_DEPTH 不能为负数")
+	}
+	if maxDepth == 0 {
+		return nil, nil
+	}
+	maxWait := utils.GetEnvIntWithDefault("TOKEN_QUEUE_MAX_WAIT_SECONDS", 30)
+	if maxWait <= 0 {
+		return nil, fmt.Errorf("TOKEN_QUEUE_MAX_WAIT_SECONDS 必须大于0")
+	}
+	pollMs := utils.GetEnvIntWithDefault("TOKEN_QUEUE_POLL_MS", 500)
+	if pollMs <= 0 {
+		return nil, fmt.Errorf("TOKEN_QUEUE_POLL_MS 必须大于0")
+	}
+	q := NewTokenQueue(maxDepth, time.Duration(maxWait)*time.Second, time.Duration(pollMs)*time.Millisecond)
+	q.shedLow = utils.GetEnvBoolWithDefault("PRIORITY_SHED_LOW", false)
+	return q, nil
+}
+
+// NewTokenQueue 创建等待队列
+func NewTokenQueue(maxDepth int, maxWait, pollInterval time.Duration) *TokenQueue {
+	return &TokenQueue{
+		maxDepth:     maxDepth,
+		maxWait:      maxWait,
+		pollInterval: pollInterval,
+		waiters:      list.New(),
+	}
+}
+
+// Depth 当前排队请求数
+func (q *TokenQueue) Depth() int {
+	if q == nil {
+		return 0
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.waiters.Len()
+}
+
+// Stats 排队统计（未启用时只返回 enabled=false）
+func (q *TokenQueue) Stats() QueueStats {
+	if q == nil {
+		return QueueStats{}
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	byPriority := make(map[string]int)
+	for e := q.waiters.Front(); e != nil; e = e.Next() {
+		byPriority[e.Value.(*queueWaiter).priority.String()]++
+	}
+	return QueueStats{
+		Enabled:         true,
+		Depth:           q.waiters.Len(),
+		DepthByPriority: byPriority,
+		MaxDepth:        q.maxDepth,
+		MaxWaitSeconds:  q.maxWait.Seconds(),
+		ShedLowPriority: q.shedLow,
+		Served:          q.served,
+		TimedOut:        q.timeout,
+		Rejected:        q.full,
+		Shed:            q.shed,
+		Preempted:       q.preempted,
+		AvgWaitMs:       q.avgWait.Milliseconds(),
+	}
+}
+
+// Wait 以普通优先级排队，见 WaitPriority
+func (q *TokenQueue) Wait(ctx context.Context, try func() error) error {
+	return q.WaitPriority(ctx, PriorityNormal, try)
+}
+
+// WaitPriority 按优先级排队直到 try 成功、返回非饱和错误、等待超时、被挤出队列或请求取消
+// try 返回 isPoolSaturated 的错误时继续等待
+func (q *TokenQueue) WaitPriority(ctx context.Context, priority RequestPriority, try func() error) error {
+	start := time.Now()
+
+	q.mu.Lock()
+	if priority == PriorityLow && q.shedLow {
+		q.shed++
+		retryAfter := q.estimateUnlocked(q.waiters.Len())
+		q.mu.Unlock()
+		return &QueueRejectedError{Reason: "low_priority_shed", RetryAfter: retryAfter}
+	}
+	if q.waiters.Len() >= q.maxDepth && !q.evictLowerUnlocked(priority) {
+		q.full++
+		retryAfter := q.estimateUnlocked(q.waiters.Len())
+		q.mu.Unlock()
+		return &QueueRejectedError{Reason: "queue_full", RetryAfter: retryAfter}
+	}
+	w := &queueWaiter{priority: priority, turn: make(chan struct{}), evicted: make(chan struct{})}
+	elem := q.enqueueUnlocked(w)
+	q.mu.Unlock()
+	defer q.leave(elem)
+
+	timer := time.NewTimer(q.maxWait)
+	defer timer.Stop()
+	ticker := time.NewTicker(q.pollInterval)
+	defer ticker.Stop()
+
+	var lastErr error
+	for {
+		// 等待轮到队首
+		select {
+		case <-q.turnOf(w):
+		case <-w.evicted:
+			return q.evictedError(lastErr)
+		case <-timer.C:
+			return q.timedOut(lastErr)
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		// 位于队首时轮询获取token，被高优先级请求抢占后回到等待
+		for q.isHead(elem) {
+			err := try()
+			if err == nil {
+				q.recordServed(time.Since(start))
+				return nil
+			}
+			if !isPoolSaturated(err) {
+				return err
+			}
+			lastErr = err
+			select {
+			case <-ticker.C:
+			case <-w.evicted:
+				return q.evictedError(lastErr)
+			case <-timer.C:
+				return q.timedOut(lastErr)
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// enqueueUnlocked 按优先级插入等待者（排在同优先级请求之后），成为队首时唤醒它并让原队首回到等待
+// 调用者必须持有 q.mu
+func (q *TokenQueue) enqueueUnlocked(w *queueWaiter) *list.Element {
+	head := q.waiters.Front()
+	var elem *list.Element
+	for e := q.waiters.Back(); e != nil; e = e.Prev() {
+		if e.Value.(*queueWaiter).priority <= w.priority {
+			elem = q.waiters.InsertAfter(w, e)
+			break
+		}
+	}
+	if elem == nil {
+		elem = q.waiters.PushFront(w)
+	}
+	if q.waiters.Front() == elem {
+		if head != nil {
+			head.Value.(*queueWaiter).turn = make(chan struct{})
+			q.preempted++
+		}
+		close(w.turn)
+	}
+	return elem
+}
+
+// evictLowerUnlocked 队列已满时挤出排在最后、优先级低于 priority 的等待者，返回是否腾出了位置
+// 调用者必须持有 q.mu
+func (q *TokenQueue) evictLowerUnlocked(priority RequestPriority) bool {
+	tail := q.waiters.Back()
+	if tail == nil || tail.Value.(*queueWaiter).priority <= priority {
+		return false
+	}
+	q.waiters.Remove(tail)
+	close(tail.Value.(*queueWaiter).evicted)
+	return true
+}
+
+// turnOf 返回等待者当前的 turn 通道
+func (q *TokenQueue) turnOf(w *queueWaiter) chan struct{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return w.turn
+}
+
+// isHead 等待者是否位于队首
+func (q *TokenQueue) isHead(elem *list.Element) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.waiters.Front() == elem
+}
+
+// leave 移出队列，队首离开时唤醒下一个等待者（已被挤出的等待者不在队列中，忽略）
+func (q *TokenQueue) leave(elem *list.Element) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	wasHead := q.waiters.Front() == elem
+	q.waiters.Remove(elem)
+	if next := q.waiters.Front(); wasHead && next != nil {
+		close(next.Value.(*queueWaiter).turn)
+	}
+}
+
+func (q *TokenQueue) timedOut(cause error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.timeout++
+	return &QueueRejectedError{Reason: "queue_timeout", RetryAfter: q.estimateUnlocked(q.waiters.Len() - 1), Cause: cause}
+}
+
+// evictedError 被高优先级请求挤出队列，按队列已满处理
+func (q *TokenQueue) evictedError(cause error) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.full++
+	return &QueueRejectedError{Reason: "queue_full", RetryAfter: q.estimateUnlocked(q.waiters.Len()), Cause: cause}
+}
+
+func (q *TokenQueue) recordServed(wait time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.served++
+	if q.avgWait == 0 {
+		q.avgWait = wait
+		return
+	}
+	q.avgWait = (q.avgWait*4 + wait) / 5
+}
+
+// estimateUnlocked 估算排在 ahead 个请求之后还需等待的时间
+// 没有历史数据时按最长等待时间估算；调用者必须持有 q.mu
+func (q *TokenQueue) estimateUnlocked(ahead int) time.Duration {
+	if ahead < 0 {
+		ahead = 0
+	}
+	if q.avgWait == 0 {
+		return q.maxWait
+	}
+	return max(q.avgWait*time.Duration(ahead+1), time.Second)
+}
+
+// isPoolSaturated token池暂时没有可用token（耗尽、熔断或并发已满），等待后可能恢复
+func isPoolSaturated(err error) bool {
+	return errors.Is(err, auth.ErrTokenPoolExhausted) || errors.Is(err, auth.ErrAllTokensCircuitOpen) ||
+		errors.Is(err, auth.ErrAllTokensBusy)
+}
+
+// acquireTokenQueued 获取token，token池饱和且启用了排队时按调用方密钥的优先级进入等待队列
+// 队列中已有请求时新请求直接排队，同一优先级先到先得
+func acquireTokenQueued[T any](c *gin.Context, acquire func() (T, error)) (T, error) {
+	if tokenQueue == nil {
+		return acquire()
+	}
+	if tokenQueue.Depth() == 0 {
+		result, err := acquire()
+		if err == nil || !isPoolSaturated(err) {
+			return result, err
+		}
+	}
+
+	priority := requestPriority(c)
+	logger.Debug("token池已饱和，请求进入等待队列",
+		addReqFields(c,
+			logger.Int("queue_depth", tokenQueue.Depth()),
+			logger.String("priority", priority.String()),
+		)...)
+	var result T
+	err := tokenQueue.WaitPriority(c.Request.Context(), priority, func() error {
+		var err error
+		result, err = acquire()
+		return err
+	})
+	return result, err
+}
+
+// respondQueueRejected 排队失败时返回带预计重试时间的429
+func respondQueueRejected(c *gin.Context, err *QueueRejectedError) {
+	retryAfter := int(math.Ceil(err.RetryAfter.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	logger.Warn("token池饱和，请求排队失败",
+		addReqFields(c,
+			logger.String("reason", err.Reason),
+			logger.Int("retry_after", retryAfter),
+			logger.Int("queue_depth", tokenQueue.Depth()),
+		)...)
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, errorEnvelope(c, http.StatusTooManyRequests, ErrCodeTokenPoolSaturated,
+		fmt.Sprintf("%v，请 %d 秒后重试", err, retryAfter),
+		gin.H{"reason": err.Reason, "retry_after": retryAfter}))
+}
+
+// handleQueueStats 返回排队统计
+func handleQueueStats(c *gin.Context) {
+	c.JSON(http.StatusOK, tokenQueue.Stats())
+}
@@ -0,0 +1,251 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"kiro2api/auth"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenQueue_FIFO(t *testing.T) {
+	q := NewTokenQueue(10, time.Second, time.Millisecond)
+
+	var mu sync.Mutex
+	available := 0
+	var order []int
+	try := func(id int) func() error {
+		return func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			if available == 0 {
+				return auth.ErrTokenPoolExhausted
+			}
+			available--
+			order = append(order, id)
+			return nil
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			assert.NoError(t, q.Wait(context.Background(), try(id)))
+		}(i)
+		require.Eventually(t, func() bool { return q.Depth() == i+1 }, time.Second, time.Millisecond)
+	}
+
+	mu.Lock()
+	available = 3
+	mu.Unlock()
+	wg.Wait()
+
+	assert.Equal(t, []int{0, 1, 2}, order)
+	stats := q.Stats()
+	assert.Equal(t, 0, stats.Depth)
+	assert.Equal(t, int64(3), stats.Served)
+}
+
+func TestTokenQueue_Rejections(t *testing.T) {
+	q := NewTokenQueue(1, 50*time.Millisecond, 5*time.Millisecond)
+	saturated := func() error { return auth.ErrAllTokensCircuitOpen }
+
+	// 队首等待期间，超过深度的请求立即被拒绝
+	done := make(chan error, 1)
+	go func() { done <- q.Wait(context.Background(), saturated) }()
+	require.Eventually(t, func() bool { return q.Depth() == 1 }, time.Second, time.Millisecond)
+
+	var rejected *QueueRejectedError
+	err := q.Wait(context.Background(), saturated)
+	require.ErrorAs(t, err, &rejected)
+	assert.Equal(t, "queue_full", rejected.Reason)
+	assert.Equal(t, 50*time.Millisecond, rejected.RetryAfter, "没有历史数据时按最长等待时间估算")
+
+	// 等待超时保留最后一次获取token的错误
+	err = <-done
+	require.ErrorAs(t, err, &rejected)
+	assert.Equal(t, "queue_timeout", rejected.Reason)
+	assert.ErrorIs(t, err, auth.ErrAllTokensCircuitOpen)
+
+	// 非饱和错误直接返回
+	other := errors.New("refresh failed")
+	assert.Equal(t, other, q.Wait(context.Background(), func() error { return other }))
+
+	// 请求取消时退出队列
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, q.Wait(ctx, saturated), context.Canceled)
+
+	stats := q.Stats()
+	assert.Equal(t, int64(1), stats.Rejected)
+	assert.Equal(t, int64(1), stats.TimedOut)
+	assert.Equal(t, 0, stats.Depth)
+}
+
+func TestTokenQueue_Priority(t *testing.T) {
+	q := NewTokenQueue(3, time.Second, time.Millisecond)
+
+	var mu sync.Mutex
+	available := 0
+	var order []string
+	try := func(name string) func() error {
+		return func() error {
+			mu.Lock()
+			defer mu.Unlock()
+			if available == 0 {
+				return auth.ErrTokenPoolExhausted
+			}
+			available--
+			order = append(order, name)
+			return nil
+		}
+	}
+
+	var wg sync.WaitGroup
+	results := make(map[string]error)
+	enqueue := func(name string, priority RequestPriority) {
+		queued := q.Stats().DepthByPriority[priority.String()]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := q.WaitPriority(context.Background(), priority, try(name))
+			mu.Lock()
+			results[name] = err
+			mu.Unlock()
+		}()
+		require.Eventually(t, func() bool { return q.Stats().DepthByPriority[priority.String()] == queued+1 }, time.Second, time.Millisecond)
+	}
+
+	// 低优先级请求先到并成为队首，高优先级请求到达后抢占队首
+	enqueue("low-1", PriorityLow)
+	enqueue("low-2", PriorityLow)
+	enqueue("high", PriorityHigh)
+	assert.Equal(t, int64(1), q.Stats().Preempted)
+
+	// 队列已满时普通优先级请求挤出排在最后的低优先级请求
+	enqueue("normal", PriorityNormal)
+	assert.Equal(t, map[string]int{"high": 1, "normal": 1, "low": 1}, q.Stats().DepthByPriority)
+
+	// 队列已满且没有更低优先级的请求时拒绝
+	var rejected *QueueRejectedError
+	require.ErrorAs(t, q.WaitPriority(context.Background(), PriorityLow, try("late")), &rejected)
+	assert.Equal(t, "queue_full", rejected.Reason)
+
+	mu.Lock()
+	available = 3
+	mu.Unlock()
+	wg.Wait()
+
+	assert.Equal(t, []string{"high", "normal", "low-1"}, order)
+	require.ErrorAs(t, results["low-2"], &rejected)
+	assert.Equal(t, "queue_full", rejected.Reason)
+	assert.Equal(t, int64(2), q.Stats().Rejected)
+}
+
+func TestTokenQueue_ShedLowPriority(t *testing.T) {
+	q := NewTokenQueue(3, time.Second, time.Millisecond)
+	q.shedLow = true
+	calls := 0
+	try := func() error {
+		calls++
+		return nil
+	}
+
+	var rejected *QueueRejectedError
+	require.ErrorAs(t, q.WaitPriority(context.Background(), PriorityLow, try), &rejected)
+	assert.Equal(t, "low_priority_shed", rejected.Reason)
+	assert.Equal(t, 0, calls, "低优先级请求不排队")
+
+	require.NoError(t, q.WaitPriority(context.Background(), PriorityNormal, try))
+	stats := q.Stats()
+	assert.Equal(t, int64(1), stats.Shed)
+	assert.True(t, stats.ShedLowPriority)
+}
+
+func TestAcquireTokenQueued(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	original := tokenQueue
+	defer func() { tokenQueue = original }()
+
+	newContext := func() (*gin.Context, *httptest.ResponseRecorder) {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+		return c, w
+	}
+
+	// 未启用排队时立即失败
+	tokenQueue = nil
+	c, _ := newContext()
+	calls := 0
+	_, err := acquireTokenQueued(c, func() (string, error) {
+		calls++
+		return "", auth.ErrTokenPoolExhausted
+	})
+	assert.ErrorIs(t, err, auth.ErrTokenPoolExhausted)
+	assert.Equal(t, 1, calls)
+
+	// 启用后等待token恢复
+	tokenQueue = NewTokenQueue(5, time.Second, time.Millisecond)
+	calls = 0
+	token, err := acquireTokenQueued(c, func() (string, error) {
+		calls++
+		if calls < 3 {
+			return "", auth.ErrTokenPoolExhausted
+		}
+		return "tok", nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "tok", token)
+
+	// 排队失败返回带重试时间的429
+	tokenQueue = NewTokenQueue(5, 20*time.Millisecond, time.Millisecond)
+	c, w := newContext()
+	_, err = acquireTokenQueued(c, func() (string, error) { return "", auth.ErrTokenPoolExhausted })
+	require.Error(t, err)
+	respondTokenUnavailable(c, err)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	var body struct {
+		Error struct {
+			Code       string `json:"code"`
+			Reason     string `json:"reason"`
+			RetryAfter int    `json:"retry_after"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "token_pool_saturated", body.Error.Code)
+	assert.Equal(t, "queue_timeout", body.Error.Reason)
+	assert.Equal(t, 1, body.Error.RetryAfter)
+}
+
+func TestLoadTokenQueueFromEnv(t *testing.T) {
+	t.Setenv("TOKEN_QUEUE_MAX_DEPTH", "")
+	q, err := LoadTokenQueueFromEnv()
+	require.NoError(t, err)
+	assert.Nil(t, q)
+	assert.False(t, q.Stats().Enabled)
+
+	t.Setenv("TOKEN_QUEUE_MAX_DEPTH", "50")
+	q, err = LoadTokenQueueFromEnv()
+	require.NoError(t, err)
+	require.NotNil(t, q)
+	assert.Equal(t, 50, q.maxDepth)
+	assert.Equal(t, 30*time.Second, q.maxWait)
+	assert.Equal(t, 500*time.Millisecond, q.pollInterval)
+
+	t.Setenv("TOKEN_QUEUE_MAX_WAIT_SECONDS", "0")
+	_, err = LoadTokenQueueFromEnv()
+	assert.Error(t, err)
+}
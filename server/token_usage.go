@@ -0,0 +1,165 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"kiro2api/auth"
+	"kiro2api/logger"
+	"kiro2api/types"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/sync/singleflight"
+)
+
+// TokenUsageCache 账号上游实时用量的查询缓存
+// 同一账号在缓存周期内复用上次的查询结果，并发查询同一账号时合并为一次上游调用
+type TokenUsageCache struct {
+	ttl   time.Duration
+	probe func(id string) (*types.UsageLimits, error)
+	now   func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]tokenUsageEntry
+	group   singleflight.Group
+}
+
+// tokenUsageEntry 一次上游查询的结果
+type tokenUsageEntry struct {
+	usage     *types.UsageLimits
+	checkedAt time.Time
+}
+
+// LoadTokenUsageCacheTTLFromEnv 从环境变量加载账号用量查询的缓存时长
+// - TOKEN_USAGE_CACHE_SECONDS: 查询结果缓存多久（默认300，0表示每次都查询上游）
+func LoadTokenUsageCacheTTLFromEnv() (time.Duration, error) {
+	seconds := utils.GetEnvIntWithDefault("TOKEN_USAGE_CACHE_SECONDS", 300)
+	if seconds < 0 {
+		return 0, fmt.Errorf("TOKEN_USAGE_CACHE_SECONDS 不能为负数")
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// NewTokenUsageCache 创建账号用量查询缓存，probe 向上游查询指定账号的使用限制
+func NewTokenUsageCache(ttl time.Duration, probe func(id string) (*types.UsageLimits, error)) *TokenUsageCache {
+	return &TokenUsageCache{
+		ttl:     ttl,
+		probe:   probe,
+		now:     time.Now,
+		entries: make(map[string]tokenUsageEntry),
+	}
+}
+
+// Get 返回账号的用量，缓存未过期且未要求刷新时直接返回缓存结果（cached 为 true）
+func (uc *TokenUsageCache) Get(id string, refresh bool) (entry tokenUsageEntry, cached bool, err error) {
+	if !refresh {
+		uc.mu.Lock()
+		entry, ok := uc.entries[id]
+		uc.mu.Unlock()
+		if ok && uc.now().Sub(entry.checkedAt) < uc.ttl {
+			return entry, true, nil
+		}
+	}
+
+	result, err, _ := uc.group.Do(id, func() (any, error) {
+		usage, err := uc.probe(id)
+		if err != nil {
+			return nil, err
+		}
+		entry := tokenUsageEntry{usage: usage, checkedAt: uc.now()}
+		uc.mu.Lock()
+		uc.entries[id] = entry
+		uc.mu.Unlock()
+		return entry, nil
+	})
+	if err != nil {
+		return tokenUsageEntry{}, false, err
+	}
+	return result.(tokenUsageEntry), false, nil
+}
+
+// Forget 删除账号的缓存结果（账号被删除时调用）
+func (uc *TokenUsageCache) Forget(id string) {
+	uc.mu.Lock()
+	defer uc.mu.Unlock()
+	delete(uc.entries, id)
+}
+
+// handleTokenUsage 查询账号在上游的实时剩余额度与重置时间
+// 查询参数 refresh=true 时忽略缓存，直接查询上游
+func handleTokenUsage(c *gin.Context, authService *auth.AuthService, usageCache *TokenUsageCache) {
+	id := c.Param("id")
+	if _, ok := authService.GetConfigByID(id); !ok {
+		usageCache.Forget(id)
+		c.JSON(http.StatusNotFound, TokenAPIResponse{
+			Success: false,
+			Error:   fmt.Sprintf("%v: %s", auth.ErrConfigNotFound, id),
+		})
+		return
+	}
+
+	entry, cached, err := usageCache.Get(id, c.Query("refresh") == "true")
+	if err != nil {
+		logger.Warn("查询账号上游用量失败",
+			logger.String("id", id),
+			logger.Err(err))
+		c.JSON(http.StatusBadGateway, TokenAPIResponse{
+			Success: false,
+			Error:   "查询上游用量失败: " + err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":    true,
+		"id":         id,
+		"cached":     cached,
+		"checked_at": entry.checkedAt.Format(time.RFC3339),
+		"usage":      summarizeUsageLimits(entry.usage),
+	})
+}
+
+// summarizeUsageLimits 提取仪表盘关心的额度信息（与轮换相同，优先 CREDIT，其次 AGENTIC_REQUEST）
+// 总额度与已用量包含处于 ACTIVE 状态的免费试用额度
+func summarizeUsageLimits(usage *types.UsageLimits) gin.H {
+	summary := gin.H{
+		"remaining":        auth.CalculateAvailableCount(usage),
+		"days_until_reset": usage.DaysUntilReset,
+		"next_reset":       formatEpochSeconds(usage.NextDateReset),
+		"subscription":     usage.SubscriptionInfo.SubscriptionTitle,
+		"user_email":       maskEmail(usage.UserInfo.Email),
+	}
+
+	for _, targetType := range []string{"CREDIT", "AGENTIC_REQUEST"} {
+		for _, breakdown := range usage.UsageBreakdownList {
+			if breakdown.ResourceType != targetType {
+				continue
+			}
+			totalLimit := breakdown.UsageLimitWithPrecision
+			totalUsed := breakdown.CurrentUsageWithPrecision
+			if breakdown.FreeTrialInfo != nil && breakdown.FreeTrialInfo.FreeTrialStatus == "ACTIVE" {
+				totalLimit += breakdown.FreeTrialInfo.UsageLimitWithPrecision
+				totalUsed += breakdown.FreeTrialInfo.CurrentUsageWithPrecision
+			}
+			summary["resource_type"] = targetType
+			summary["total_limit"] = totalLimit
+			summary["current_usage"] = totalUsed
+			if breakdown.NextDateReset > 0 {
+				summary["next_reset"] = formatEpochSeconds(breakdown.NextDateReset)
+			}
+			return summary
+		}
+	}
+	return summary
+}
+
+// formatEpochSeconds 将上游返回的秒级时间戳格式化为 RFC3339，缺省时返回空串
+func formatEpochSeconds(seconds float64) string {
+	if seconds <= 0 {
+		return ""
+	}
+	return time.Unix(int64(seconds), 0).UTC().Format(time.RFC3339)
+}
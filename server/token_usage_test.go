@@ -0,0 +1,110 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"kiro2api/auth"
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokenUsageCache_Get(t *testing.T) {
+	calls := 0
+	cache := NewTokenUsageCache(time.Minute, func(id string) (*types.UsageLimits, error) {
+		calls++
+		if id == "bad" {
+			return nil, errors.New("upstream 403")
+		}
+		return &types.UsageLimits{DaysUntilReset: calls}, nil
+	})
+	now := time.Now()
+	cache.now = func() time.Time { return now }
+
+	entry, cached, err := cache.Get("a", false)
+	require.NoError(t, err)
+	assert.False(t, cached)
+	assert.Equal(t, 1, entry.usage.DaysUntilReset)
+
+	entry, cached, err = cache.Get("a", false)
+	require.NoError(t, err)
+	assert.True(t, cached, "缓存周期内复用上次结果")
+	assert.Equal(t, 1, calls)
+
+	_, cached, err = cache.Get("a", true)
+	require.NoError(t, err)
+	assert.False(t, cached, "refresh 跳过缓存")
+	assert.Equal(t, 2, calls)
+
+	now = now.Add(2 * time.Minute)
+	entry, cached, _ = cache.Get("a", false)
+	assert.False(t, cached, "过期后重新查询")
+	assert.Equal(t, 3, entry.usage.DaysUntilReset)
+
+	_, _, err = cache.Get("bad", false)
+	assert.Error(t, err)
+	_, _, err = cache.Get("bad", false)
+	assert.Error(t, err, "失败结果不缓存")
+	assert.Equal(t, 5, calls)
+}
+
+func TestHandleTokenUsage(t *testing.T) {
+	authService := auth.NewAuthServiceWithConfigs([]auth.AuthConfig{
+		{ID: "usage-1", AuthType: auth.AuthMethodSocial, RefreshToken: "rt"},
+	}, "")
+	cache := NewTokenUsageCache(time.Minute, func(string) (*types.UsageLimits, error) {
+		return &types.UsageLimits{
+			DaysUntilReset:   12,
+			NextDateReset:    1767225600,
+			SubscriptionInfo: types.SubscriptionInfo{SubscriptionTitle: "KIRO PRO"},
+			UserInfo:         types.UserInfo{Email: "alice@example.com"},
+			UsageBreakdownList: []types.UsageBreakdown{
+				{ResourceType: "AGENTIC_REQUEST", UsageLimitWithPrecision: 10},
+				{
+					ResourceType:              "CREDIT",
+					UsageLimitWithPrecision:   1000,
+					CurrentUsageWithPrecision: 250.5,
+					FreeTrialInfo:             &types.FreeTrialInfo{FreeTrialStatus: "ACTIVE", UsageLimitWithPrecision: 500, CurrentUsageWithPrecision: 100},
+				},
+			},
+		}, nil
+	})
+
+	r := gin.New()
+	r.GET("/api/tokens/:id/usage", func(c *gin.Context) {
+		handleTokenUsage(c, authService, cache)
+	})
+	get := func(path string) (int, map[string]any) {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var body map[string]any
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		return w.Code, body
+	}
+
+	code, body := get("/api/tokens/usage-1/usage")
+	require.Equal(t, http.StatusOK, code)
+	assert.Equal(t, false, body["cached"])
+	usage := body["usage"].(map[string]any)
+	assert.Equal(t, "CREDIT", usage["resource_type"], "优先 CREDIT")
+	assert.Equal(t, float64(1500), usage["total_limit"])
+	assert.Equal(t, 350.5, usage["current_usage"])
+	assert.Equal(t, 1149.5, usage["remaining"])
+	assert.Equal(t, "2026-01-01T00:00:00Z", usage["next_reset"])
+	assert.Equal(t, float64(12), usage["days_until_reset"])
+	assert.Equal(t, "KIRO PRO", usage["subscription"])
+	assert.NotContains(t, usage["user_email"], "alice@", "邮箱脱敏")
+
+	_, body = get("/api/tokens/usage-1/usage")
+	assert.Equal(t, true, body["cached"])
+
+	code, _ = get("/api/tokens/missing/usage")
+	assert.Equal(t, http.StatusNotFound, code)
+}
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"kiro2api/config"
+	"kiro2api/logger"
+	"kiro2api/tracing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// initTracing 按标准 OTEL 环境变量初始化链路追踪，返回退出前刷新 span 的函数
+func initTracing() func() {
+	shutdown, err := tracing.Init(context.Background(), config.Version)
+	if err != nil {
+		logger.Warn("初始化链路追踪失败，已禁用", logger.Err(err))
+		return func() {}
+	}
+	if tracing.Enabled() {
+		logger.Info("OpenTelemetry链路追踪已启用")
+	}
+	return func() {
+		if err := shutdown(context.Background()); err != nil {
+			logger.Warn("关闭链路追踪失败", logger.Err(err))
+		}
+	}
+}
+
+// TracingMiddleware 为匹配前缀的请求创建服务端 span，沿用客户端传入的 traceparent
+// span 写入请求上下文，后续的token选择、请求转换、上游调用与流解析均作为其子 span
+func TracingMiddleware(prefixes []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !requiresAuth(c.Request.URL.Path, prefixes) {
+			c.Next()
+			return
+		}
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := tracing.Tracer().Start(ctx, c.Request.Method+" "+route,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", route),
+				attribute.String("request.id", GetRequestID(c)),
+			))
+		defer span.End()
+
+		// 日志附带 trace_id，便于从日志跳转到链路
+		if traceID := tracing.TraceID(ctx); traceID != "" {
+			ctx = logger.ContextWithFields(ctx, logger.String("trace_id", traceID))
+		}
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if model := c.GetString(requestModelKey); model != "" {
+			span.SetAttributes(attribute.String("gen_ai.request.model", model))
+		}
+		if code := c.GetString(errorCodeKey); code != "" {
+			span.SetAttributes(attribute.String("error.type", code))
+		}
+		if status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, fmt.Sprintf("HTTP %d", status))
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"kiro2api/tracing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracingMiddleware_ParentsPipelineSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	originalProvider, originalPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(originalProvider)
+		otel.SetTextMapPropagator(originalPropagator)
+	})
+
+	r := gin.New()
+	r.Use(TracingMiddleware([]string{"/v1"}))
+	r.POST("/v1/messages", func(c *gin.Context) {
+		_, span := tracing.Start(c.Request.Context(), "token.select")
+		span.End()
+		c.Set(requestModelKey, "claude-sonnet-4-5")
+		c.Status(http.StatusBadGateway)
+	})
+	r.GET("/api/tokens", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	req := httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/tokens", nil))
+
+	ended := recorder.Ended()
+	require.Len(t, ended, 2, "非 /v1 请求不创建 span")
+	child, server := ended[0], ended[1]
+	assert.Equal(t, "token.select", child.Name())
+	assert.Equal(t, "POST /v1/messages", server.Name())
+	assert.Equal(t, server.SpanContext().SpanID(), child.Parent().SpanID())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String(), "沿用客户端传入的 traceparent")
+	assert.Equal(t, "Error", server.Status().Code.String())
+
+	attrs := map[string]any{}
+	for _, attr := range server.Attributes() {
+		attrs[string(attr.Key)] = attr.Value.AsInterface()
+	}
+	assert.Equal(t, int64(http.StatusBadGateway), attrs["http.response.status_code"])
+	assert.Equal(t, "claude-sonnet-4-5", attrs["gen_ai.request.model"])
+}
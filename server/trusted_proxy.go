@@ -0,0 +1,118 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TrustedProxyConfig 可信代理配置，决定 c.ClientIP() 是否采用 X-Forwarded-For / X-Real-IP
+type TrustedProxyConfig struct {
+	Proxies []string // 可信代理的IP或CIDR，为空时不信任任何代理（客户端IP即连接地址）
+	Hops    int      // >0 时取 X-Forwarded-For 从右往左第 Hops 个地址作为客户端IP
+}
+
+// LoadTrustedProxyConfigFromEnv 从环境变量加载可信代理配置
+// - TRUSTED_PROXIES: 逗号分隔的IP或CIDR（如 "10.0.0.0/8,127.0.0.1"），未设置时不信任转发头
+// - TRUSTED_PROXY_HOPS: 客户端与服务之间的代理层数（默认0：从右往左跳过可信代理地址）
+func LoadTrustedProxyConfigFromEnv() TrustedProxyConfig {
+	return TrustedProxyConfig{
+		Proxies: envList("TRUSTED_PROXIES"),
+		Hops:    utils.GetEnvIntWithDefault("TRUSTED_PROXY_HOPS", 0),
+	}
+}
+
+// Apply 将可信代理配置应用到 gin 引擎，需在其他读取 ClientIP 的中间件之前调用
+func (cfg TrustedProxyConfig) Apply(r *gin.Engine) error {
+	if cfg.Hops < 0 {
+		return fmt.Errorf("TRUSTED_PROXY_HOPS 不能为负数")
+	}
+	if cfg.Hops > 0 && len(cfg.Proxies) == 0 {
+		return fmt.Errorf("设置 TRUSTED_PROXY_HOPS 时必须配置 TRUSTED_PROXIES")
+	}
+
+	networks, err := parseIPNetworks(cfg.Proxies)
+	if err != nil {
+		return fmt.Errorf("TRUSTED_PROXIES 无效: %w", err)
+	}
+	// gin 默认信任所有代理，客户端可伪造 X-Forwarded-For 绕过按IP的限流
+	if err := r.SetTrustedProxies(cfg.Proxies); err != nil {
+		return fmt.Errorf("TRUSTED_PROXIES 无效: %w", err)
+	}
+	if cfg.Hops > 0 {
+		r.Use(forwardedHopsMiddleware(networks, cfg.Hops))
+	}
+	return nil
+}
+
+// parseIPNetworks 将IP或CIDR解析为网段，单个IP视为 /32（IPv6 为 /128）
+func parseIPNetworks(items []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(items))
+	for _, item := range items {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("地址无效: %s", item)
+			}
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			item = fmt.Sprintf("%s/%d", item, bits)
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("网段无效: %s", item)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// forwardedHopsMiddleware 按代理层数改写 X-Forwarded-For，只保留从右往左第 hops 个地址
+// 仅在连接来自可信代理时生效，最左侧之外由客户端伪造的地址会被丢弃；
+// 地址数少于 hops 时取最左侧地址（请求经过的代理少于配置层数）
+func forwardedHopsMiddleware(trusted []*net.IPNet, hops int) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !ipInNetworks(net.ParseIP(c.RemoteIP()), trusted) {
+			c.Next()
+			return
+		}
+
+		c.Request.Header.Del("X-Real-IP")
+		var items []string
+		for _, item := range strings.Split(c.Request.Header.Get("X-Forwarded-For"), ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		if len(items) == 0 {
+			c.Next()
+			return
+		}
+
+		index := len(items) - hops
+		if index < 0 {
+			index = 0
+		}
+		c.Request.Header.Set("X-Forwarded-For", items[index])
+		c.Next()
+	}
+}
+
+// ipInNetworks 判断IP是否属于任一网段
+func ipInNetworks(ip net.IP, networks []*net.IPNet) bool {
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clientIPFor 使用可信代理配置处理一次请求，返回 c.ClientIP()
+func clientIPFor(t *testing.T, cfg TrustedProxyConfig, remoteAddr string, headers map[string]string) string {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	require.NoError(t, cfg.Apply(r))
+
+	var got string
+	r.GET("/ip", func(c *gin.Context) { got = c.ClientIP() })
+
+	req := httptest.NewRequest(http.MethodGet, "/ip", nil)
+	req.RemoteAddr = remoteAddr
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	r.ServeHTTP(httptest.NewRecorder(), req)
+	return got
+}
+
+func TestTrustedProxy_ClientIP(t *testing.T) {
+	spoofed := map[string]string{"X-Forwarded-For": "6.6.6.6, 203.0.113.7", "X-Real-IP": "6.6.6.6"}
+
+	tests := []struct {
+		name       string
+		cfg        TrustedProxyConfig
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"未配置时忽略转发头", TrustedProxyConfig{}, "198.51.100.1:4000", spoofed, "198.51.100.1"},
+		{"非可信代理忽略转发头", TrustedProxyConfig{Proxies: []string{"10.0.0.0/8"}}, "198.51.100.1:4000", spoofed, "198.51.100.1"},
+		{"可信代理取最右侧非可信地址", TrustedProxyConfig{Proxies: []string{"10.0.0.0/8"}}, "10.0.0.5:4000", spoofed, "203.0.113.7"},
+		{"按层数取地址", TrustedProxyConfig{Proxies: []string{"10.0.0.5"}, Hops: 1}, "10.0.0.5:4000",
+			map[string]string{"X-Forwarded-For": "6.6.6.6, 10.0.0.9, 203.0.113.7"}, "203.0.113.7"},
+		{"两层代理", TrustedProxyConfig{Proxies: []string{"10.0.0.5"}, Hops: 2}, "10.0.0.5:4000",
+			map[string]string{"X-Forwarded-For": "6.6.6.6, 203.0.113.7, 10.0.0.9"}, "203.0.113.7"},
+		{"地址少于层数取最左侧", TrustedProxyConfig{Proxies: []string{"10.0.0.5"}, Hops: 3}, "10.0.0.5:4000",
+			map[string]string{"X-Forwarded-For": "203.0.113.7"}, "203.0.113.7"},
+		{"按层数时忽略X-Real-IP", TrustedProxyConfig{Proxies: []string{"10.0.0.5"}, Hops: 1}, "10.0.0.5:4000",
+			map[string]string{"X-Real-IP": "6.6.6.6"}, "10.0.0.5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, clientIPFor(t, tt.cfg, tt.remoteAddr, tt.headers))
+		})
+	}
+}
+
+func TestTrustedProxyConfig_Invalid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	assert.Error(t, TrustedProxyConfig{Proxies: []string{"not-an-ip"}}.Apply(gin.New()))
+	assert.Error(t, TrustedProxyConfig{Hops: 1}.Apply(gin.New()), "层数需要配合可信代理")
+	assert.Error(t, TrustedProxyConfig{Proxies: []string{"10.0.0.1"}, Hops: -1}.Apply(gin.New()))
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// upstreamEventStreamType 上游正常响应的内容类型（AWS EventStream 二进制帧）
+	upstreamEventStreamType = "application/vnd.amazon.eventstream"
+	// maxUpstreamSnippetRead 识别为异常响应后读取的最大字节数
+	maxUpstreamSnippetRead = 4096
+	// maxUpstreamSnippetRunes 返回给客户端的片段长度
+	maxUpstreamSnippetRunes = 200
+)
+
+// 异常响应体类型
+const (
+	upstreamBodyHTML = "html"
+	upstreamBodyText = "text"
+	upstreamBodyJSON = "json"
+)
+
+// UpstreamContentError 上游返回了无法按事件流解析的响应（验证门户、WAF拦截页等）
+type UpstreamContentError struct {
+	StatusCode  int
+	ContentType string
+	Kind        string
+	Snippet     string
+}
+
+func (e *UpstreamContentError) Error() string {
+	return fmt.Sprintf("上游返回非预期的%s响应（HTTP %d, Content-Type: %q）: %s", e.Kind, e.StatusCode, e.ContentType, e.Snippet)
+}
+
+// classifyUpstreamBody 根据内容类型与正文开头判断响应体类型
+func classifyUpstreamBody(contentType string, body []byte) string {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		return upstreamBodyHTML
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return upstreamBodyJSON
+	}
+
+	trimmed := bytes.TrimLeft(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")), " \t\r\n")
+	switch {
+	case len(trimmed) == 0:
+		return upstreamBodyText
+	case trimmed[0] == '<':
+		return upstreamBodyHTML
+	case trimmed[0] == '{' || trimmed[0] == '[':
+		return upstreamBodyJSON
+	}
+	return upstreamBodyText
+}
+
+var (
+	htmlTitlePattern   = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	htmlDropPattern    = regexp.MustCompile(`(?is)<(script|style)[^>]*>.*?</(script|style)>`)
+	htmlTagPattern     = regexp.MustCompile(`(?s)<[^>]*>`)
+	whitespacePattern  = regexp.MustCompile(`\s+`)
+	htmlEntityReplacer = strings.NewReplacer("&nbsp;", " ", "&amp;", "&", "&lt;", "<", "&gt;", ">", "&quot;", `"`, "&#39;", "'")
+)
+
+// upstreamSnippet 提取便于定位问题的响应片段：HTML 取标题与正文文字，并截断、脱敏
+func upstreamSnippet(kind string, body []byte) string {
+	text := string(body)
+	if kind == upstreamBodyHTML {
+		title := ""
+		if m := htmlTitlePattern.FindStringSubmatch(text); m != nil {
+			title = strings.TrimSpace(m[1])
+		}
+		text = htmlTagPattern.ReplaceAllString(htmlDropPattern.ReplaceAllString(text, " "), " ")
+		if title != "" {
+			text = title + " - " + strings.Replace(text, title, "", 1)
+		}
+		text = htmlEntityReplacer.Replace(text)
+	}
+	text = strings.TrimSpace(whitespacePattern.ReplaceAllString(text, " "))
+	text = strings.TrimSuffix(strings.TrimSpace(text), " -")
+	text = strings.ToValidUTF8(text, "")
+	if utf8.RuneCountInString(text) > maxUpstreamSnippetRunes {
+		text = string([]rune(text)[:maxUpstreamSnippetRunes]) + "..."
+	}
+	if text == "" {
+		text = "(空响应体)"
+	}
+	return redactSecrets(text)
+}
+
+// newUpstreamContentError 构造异常响应错误
+func newUpstreamContentError(resp *http.Response, kind string, body []byte) *UpstreamContentError {
+	return &UpstreamContentError{
+		StatusCode:  resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Kind:        kind,
+		Snippet:     upstreamSnippet(kind, body),
+	}
+}
+
+// guardUpstreamStream 校验上游成功响应确为事件流
+// Content-Type 为事件流时直接放行；声明为 HTML/JSON/文本时判定为异常；
+// 未声明或未知类型时预读首字节：事件流帧以4字节大端长度开头，首字节不会是 '<' 或 '{'
+// 预读的数据会回填到 resp.Body，不影响后续解析
+func guardUpstreamStream(resp *http.Response) *UpstreamContentError {
+	contentType := resp.Header.Get("Content-Type")
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	if mediaType == upstreamEventStreamType {
+		return nil
+	}
+
+	declaredBad := mediaType == "text/html" || mediaType == "application/xhtml+xml" ||
+		mediaType == "application/json" || strings.HasPrefix(mediaType, "text/")
+	if !declaredBad {
+		reader := bufio.NewReader(resp.Body)
+		head, _ := reader.Peek(1)
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{reader, resp.Body}
+		if len(head) > 0 && head[0] != '<' && head[0] != '{' && head[0] != '[' {
+			return nil
+		}
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxUpstreamSnippetRead))
+	return newUpstreamContentError(resp, classifyUpstreamBody(contentType, body), body)
+}
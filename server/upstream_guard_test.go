@@ -0,0 +1,91 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newUpstreamResponse(status int, contentType, body string) *http.Response {
+	resp := &http.Response{
+		StatusCode: status,
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+	if contentType != "" {
+		resp.Header.Set("Content-Type", contentType)
+	}
+	return resp
+}
+
+const captivePortalPage = `<!DOCTYPE html><html><head><title>Access Denied</title>
+<style>body{color:red}</style><script>var token="x";</script></head>
+<body><h1>Access Denied</h1><p>Request blocked by&nbsp;firewall. Ref: 1234</p></body></html>`
+
+func TestClassifyUpstreamBody(t *testing.T) {
+	assert.Equal(t, upstreamBodyHTML, classifyUpstreamBody("text/html; charset=utf-8", []byte("oops")))
+	assert.Equal(t, upstreamBodyJSON, classifyUpstreamBody("application/json", []byte("")))
+	assert.Equal(t, upstreamBodyHTML, classifyUpstreamBody("", []byte("\xef\xbb\xbf  <html>")))
+	assert.Equal(t, upstreamBodyJSON, classifyUpstreamBody("application/octet-stream", []byte(`{"message":"x"}`)))
+	assert.Equal(t, upstreamBodyText, classifyUpstreamBody("text/plain", []byte("502 Bad Gateway")))
+}
+
+func TestUpstreamSnippet_HTML(t *testing.T) {
+	snippet := upstreamSnippet(upstreamBodyHTML, []byte(captivePortalPage))
+	assert.True(t, strings.HasPrefix(snippet, "Access Denied - "), snippet)
+	assert.Contains(t, snippet, "Request blocked by firewall. Ref: 1234")
+	assert.NotContains(t, snippet, "<")
+	assert.NotContains(t, snippet, "color:red")
+	assert.NotContains(t, snippet, "var token")
+
+	long := upstreamSnippet(upstreamBodyText, []byte(strings.Repeat("错", 500)))
+	assert.Equal(t, maxUpstreamSnippetRunes+3, len([]rune(long)))
+}
+
+func TestGuardUpstreamStream(t *testing.T) {
+	frame := "\x00\x00\x00\x10binary-frame"
+
+	resp := newUpstreamResponse(http.StatusOK, upstreamEventStreamType, frame)
+	require.Nil(t, guardUpstreamStream(resp))
+
+	// 未声明类型时预读首字节，数据需完整保留给解析器
+	resp = newUpstreamResponse(http.StatusOK, "", frame)
+	require.Nil(t, guardUpstreamStream(resp))
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, frame, string(data))
+
+	resp = newUpstreamResponse(http.StatusOK, "", captivePortalPage)
+	contentErr := guardUpstreamStream(resp)
+	require.NotNil(t, contentErr)
+	assert.Equal(t, upstreamBodyHTML, contentErr.Kind)
+	assert.Contains(t, contentErr.Snippet, "Access Denied")
+
+	resp = newUpstreamResponse(http.StatusOK, "application/json", `{"message":"maintenance"}`)
+	contentErr = guardUpstreamStream(resp)
+	require.NotNil(t, contentErr)
+	assert.Equal(t, upstreamBodyJSON, contentErr.Kind)
+
+	resp = newUpstreamResponse(http.StatusOK, "", "")
+	require.NotNil(t, guardUpstreamStream(resp), "空响应体不应被当作事件流")
+}
+
+func TestHandleCodeWhispererError_HTMLPage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/messages", nil)
+
+	handled := handleCodeWhispererError(c, newUpstreamResponse(http.StatusForbidden, "text/html", captivePortalPage))
+	require.True(t, handled)
+	assert.Equal(t, http.StatusBadGateway, w.Code)
+	assert.Contains(t, w.Body.String(), "upstream_invalid_response")
+	assert.Contains(t, w.Body.String(), "Access Denied")
+	assert.NotContains(t, w.Body.String(), "<html>")
+}
@@ -0,0 +1,29 @@
+package server
+
+import (
+	"net/http"
+
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handleUpstreamPoolStats 返回上游连接池的生效配置与复用统计
+func handleUpstreamPoolStats(c *gin.Context) {
+	cfg := utils.CurrentUpstreamClientConfig()
+	c.JSON(http.StatusOK, gin.H{
+		"config": gin.H{
+			"http2":                   cfg.HTTP2,
+			"max_idle_conns":          cfg.MaxIdleConns,
+			"max_idle_conns_per_host": cfg.MaxIdleConnsPerHost,
+			"max_conns_per_host":      cfg.MaxConnsPerHost,
+			"idle_conn_timeout":       cfg.IdleConnTimeout.String(),
+			"connect_timeout":         cfg.ConnectTimeout.String(),
+			"keepalive":               cfg.KeepAlive.String(),
+			"tls_handshake_timeout":   cfg.TLSHandshakeTimeout.String(),
+			"tls_session_cache_size":  cfg.TLSSessionCacheSize,
+			"first_byte_timeout":      cfg.FirstByteTimeout.String(),
+		},
+		"stats": utils.GetUpstreamPoolStats(),
+	})
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"kiro2api/logger"
+	"kiro2api/parser"
+	"kiro2api/types"
+	"kiro2api/utils"
+)
+
+// upstreamUsage 上游 metadataEvent 提供的 token 用量，未提供的字段为 nil
+type upstreamUsage struct {
+	inputTokens         *int
+	outputTokens        *int
+	cacheCreationTokens *int // 写入提示缓存的输入 token
+	cacheReadTokens     *int // 命中提示缓存的输入 token
+}
+
+// record 记录解析器产生的用量事件，返回 false 表示不是用量事件
+func (u *upstreamUsage) record(dataMap map[string]any) bool {
+	if dataMap["type"] != "usage" {
+		return false
+	}
+	if v, ok := dataMap["input_tokens"].(int); ok {
+		u.inputTokens = &v
+	}
+	if v, ok := dataMap["output_tokens"].(int); ok {
+		u.outputTokens = &v
+	}
+	if v, ok := dataMap["cache_creation_input_tokens"].(int); ok {
+		u.cacheCreationTokens = &v
+	}
+	if v, ok := dataMap["cache_read_input_tokens"].(int); ok {
+		u.cacheReadTokens = &v
+	}
+	logger.Debug("收到上游token用量", logger.Any("usage", dataMap))
+	return true
+}
+
+// apply 用上游用量覆盖本地估算值
+func (u upstreamUsage) apply(inputTokens, outputTokens int) (int, int) {
+	if u.inputTokens != nil {
+		inputTokens = *u.inputTokens
+	}
+	if u.outputTokens != nil {
+		outputTokens = *u.outputTokens
+	}
+	return inputTokens, outputTokens
+}
+
+// recordEvents 记录非流式解析结果中的用量事件
+func (u *upstreamUsage) recordEvents(events []parser.SSEEvent) {
+	for _, event := range events {
+		if dataMap, ok := event.Data.(map[string]any); ok {
+			u.record(dataMap)
+		}
+	}
+}
+
+// anthropicUsage 构造 Anthropic usage 对象：上游用量覆盖本地估算，
+// 提示缓存用量只来自上游，未提供时为 0（字段始终存在，便于使用提示缓存的客户端统计）
+func (u upstreamUsage) anthropicUsage(inputTokens, outputTokens int) map[string]any {
+	inputTokens, outputTokens = u.apply(inputTokens, outputTokens)
+	cacheCreation, cacheRead := 0, 0
+	if u.cacheCreationTokens != nil {
+		cacheCreation = *u.cacheCreationTokens
+	}
+	if u.cacheReadTokens != nil {
+		cacheRead = *u.cacheReadTokens
+	}
+	return map[string]any{
+		"input_tokens":                inputTokens,
+		"output_tokens":               outputTokens,
+		"cache_creation_input_tokens": cacheCreation,
+		"cache_read_input_tokens":     cacheRead,
+	}
+}
+
+// estimateInputTokens 按实际发送给上游的数据估算输入 token
+func estimateInputTokens(req types.AnthropicRequest) int {
+	return utils.NewTokenEstimator().EstimateTokens(&types.CountTokensRequest{
+		Model:    req.Model,
+		System:   req.System,
+		Messages: req.Messages,
+		Tools:    filterSupportedTools(req.Tools), // 过滤不支持的工具后计算
+	})
+}
+
+// openAIUsage 构造 OpenAI usage 对象（字段均为必填，不省略 0 值）
+func openAIUsage(promptTokens, completionTokens int) map[string]any {
+	return map[string]any{
+		"prompt_tokens":     promptTokens,
+		"completion_tokens": completionTokens,
+		"total_tokens":      promptTokens + completionTokens,
+	}
+}
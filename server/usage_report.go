@@ -0,0 +1,401 @@
+package server
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"kiro2api/audit"
+	"kiro2api/logger"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 用量报表格式
+const (
+	usageFormatCSV  = "csv"
+	usageFormatJSON = "json"
+)
+
+// usageDateLayout 报表日期参数与日报文件名使用的日期格式（UTC）
+const usageDateLayout = "2006-01-02"
+
+// UsageSummary 一个调用方密钥或账号在报表时间范围内的用量与估算费用汇总
+type UsageSummary struct {
+	Group        string           `json:"group"` // key / account
+	Name         string           `json:"name"`
+	Requests     int64            `json:"requests"`
+	Errors       int64            `json:"errors"`                // 状态码 >= 400 的请求
+	ErrorCodes   map[string]int64 `json:"error_codes,omitempty"` // 按错误码的失败请求数
+	InputTokens  int64            `json:"input_tokens"`
+	OutputTokens int64            `json:"output_tokens"`
+	Cost         float64          `json:"cost"` // 按请求时的价格表估算，未配置 PRICING_FILE 时为 0
+}
+
+// UsageReport 按调用方密钥与账号汇总的用量报表，数据来自审计文件中的 request 记录
+type UsageReport struct {
+	From        time.Time      `json:"from"`
+	To          time.Time      `json:"to"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Currency    string         `json:"currency,omitempty"` // 当前价格表的币种
+	TotalCost   float64        `json:"total_cost"`
+	Keys        []UsageSummary `json:"keys"`
+	Accounts    []UsageSummary `json:"accounts"`
+}
+
+// BuildUsageReport 汇总审计文件中 [from, to) 内的 /v1 请求记录
+// 没有调用方密钥的请求（认证失败）不计入密钥汇总，没有到达上游的请求（如 count_tokens）不计入账号汇总
+func BuildUsageReport(path string, from, to time.Time) (UsageReport, error) {
+	keys := make(map[string]*UsageSummary)
+	accounts := make(map[string]*UsageSummary)
+	add := func(group map[string]*UsageSummary, groupName, name string, rec audit.Record) {
+		if name == "" {
+			return
+		}
+		summary, ok := group[name]
+		if !ok {
+			summary = &UsageSummary{Group: groupName, Name: name}
+			group[name] = summary
+		}
+		summary.Requests++
+		if rec.Status >= http.StatusBadRequest {
+			summary.Errors++
+		}
+		if rec.ErrorCode != "" {
+			if summary.ErrorCodes == nil {
+				summary.ErrorCodes = make(map[string]int64)
+			}
+			summary.ErrorCodes[rec.ErrorCode]++
+		}
+		summary.InputTokens += int64(rec.InputTokens)
+		summary.OutputTokens += int64(rec.OutputTokens)
+		summary.Cost += rec.Cost
+	}
+
+	totalCost := 0.0
+	err := audit.ReadRecords(path, from, to, func(rec audit.Record) bool {
+		if rec.Kind == audit.KindRequest {
+			totalCost += rec.Cost
+			add(keys, "key", rec.ClientKey, rec)
+			add(accounts, "account", rec.Account, rec)
+		}
+		return true
+	})
+	if err != nil {
+		return UsageReport{}, err
+	}
+	return UsageReport{
+		From:        from,
+		To:          to,
+		GeneratedAt: time.Now().UTC(),
+		Currency:    pricingTable.currency(),
+		TotalCost:   totalCost,
+		Keys:        sortedSummaries(keys),
+		Accounts:    sortedSummaries(accounts),
+	}, nil
+}
+
+// sortedSummaries 按名称排序，保证同一数据生成的报表内容一致
+func sortedSummaries(group map[string]*UsageSummary) []UsageSummary {
+	list := make([]UsageSummary, 0, len(group))
+	for _, summary := range group {
+		list = append(list, *summary)
+	}
+	slices.SortFunc(list, func(a, b UsageSummary) int { return cmp.Compare(a.Name, b.Name) })
+	return list
+}
+
+// Encode 按格式输出报表：csv 每行一个密钥或账号（group 列区分），json 为完整结构
+func (r UsageReport) Encode(w io.Writer, format string) error {
+	if format == usageFormatJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(r)
+	}
+
+	writer := csv.NewWriter(w)
+	_ = writer.Write([]string{"from", "to", "group", "name", "requests", "errors", "input_tokens", "output_tokens", "cost"})
+	from, to := r.From.Format(time.RFC3339), r.To.Format(time.RFC3339)
+	for _, summary := range slices.Concat(r.Keys, r.Accounts) {
+		_ = writer.Write([]string{
+			from, to, summary.Group, summary.Name,
+			strconv.FormatInt(summary.Requests, 10),
+			strconv.FormatInt(summary.Errors, 10),
+			strconv.FormatInt(summary.InputTokens, 10),
+			strconv.FormatInt(summary.OutputTokens, 10),
+			strconv.FormatFloat(summary.Cost, 'f', 6, 64),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// usageContentType 报表格式对应的 Content-Type
+func usageContentType(format string) string {
+	if format == usageFormatJSON {
+		return "application/json"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// parseUsageFormat 解析报表格式，空值为 csv
+func parseUsageFormat(value string) (string, error) {
+	switch format := strings.ToLower(strings.TrimSpace(value)); format {
+	case "", usageFormatCSV:
+		return usageFormatCSV, nil
+	case usageFormatJSON:
+		return usageFormatJSON, nil
+	default:
+		return "", fmt.Errorf("不支持的报表格式: %s（可选 csv/json）", value)
+	}
+}
+
+// parseUsageTime 解析报表时间参数：RFC3339 时间或 UTC 日期（YYYY-MM-DD），
+// 日期作为结束时间时包含当天（取次日零点）
+func parseUsageTime(value string, end bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.Parse(usageDateLayout, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("时间格式无效: %s（应为 YYYY-MM-DD 或 RFC3339）", value)
+	}
+	if end {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+// handleUsageExport 导出用量报表
+// GET /api/usage/export?from=2026-10-01&to=2026-10-31&format=csv，from 默认当天零点（UTC），to 默认当前时间
+func handleUsageExport(c *gin.Context) {
+	path := auditLog.Path()
+	if path == "" {
+		respondErrorWithCode(c, http.StatusServiceUnavailable, "audit_disabled", "未配置 AUDIT_LOG_FILE，无法生成用量报表")
+		return
+	}
+
+	format, err := parseUsageFormat(c.Query("format"))
+	if err != nil {
+		respondError(c, http.StatusBadRequest, "%v", err)
+		return
+	}
+	now := time.Now().UTC()
+	from, to := now.Truncate(24*time.Hour), now
+	if value := c.Query("from"); value != "" {
+		if from, err = parseUsageTime(value, false); err != nil {
+			respondError(c, http.StatusBadRequest, "from %v", err)
+			return
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = parseUsageTime(value, true); err != nil {
+			respondError(c, http.StatusBadRequest, "to %v", err)
+			return
+		}
+	}
+	if !from.Before(to) {
+		respondError(c, http.StatusBadRequest, "from 必须早于 to")
+		return
+	}
+
+	report, err := BuildUsageReport(path, from, to)
+	if err != nil {
+		logger.Error("生成用量报表失败", addReqFields(c, logger.Err(err))...)
+		respondError(c, http.StatusInternalServerError, "生成用量报表失败: %v", err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := report.Encode(&buf, format); err != nil {
+		respondError(c, http.StatusInternalServerError, "输出用量报表失败: %v", err)
+		return
+	}
+	filename := fmt.Sprintf("usage-%s-%s.%s", from.UTC().Format("20060102T150405Z"), to.UTC().Format("20060102T150405Z"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, usageContentType(format), buf.Bytes())
+}
+
+// UsageReportConfig 每日用量报表任务配置
+type UsageReportConfig struct {
+	Dir        string        // 日报输出目录
+	WebhookURL string        // 日报投递地址
+	Secret     string        // 投递请求体签名密钥（X-Kiro-Signature: sha256=<hex>）
+	Format     string        // csv / json
+	Delay      time.Duration // UTC 零点后延迟生成，等待异步写入的审计记录落盘
+}
+
+// LoadUsageReportConfigFromEnv 从环境变量加载每日用量报表任务，未启用时返回 nil
+// - USAGE_REPORT_DIR: 日报输出目录，文件名 usage-YYYY-MM-DD.<format>
+// - USAGE_REPORT_WEBHOOK_URL: 日报投递地址（POST 报表内容）
+// - USAGE_REPORT_SECRET: 投递请求体签名密钥（可选）
+// - USAGE_REPORT_FORMAT: csv（默认）或 json
+// - USAGE_REPORT_DELAY_MINUTES: UTC 零点后延迟生成的分钟数（默认5）
+func LoadUsageReportConfigFromEnv() (*UsageReportConfig, error) {
+	cfg := &UsageReportConfig{
+		Dir:        strings.TrimSpace(os.Getenv("USAGE_REPORT_DIR")),
+		WebhookURL: strings.TrimSpace(os.Getenv("USAGE_REPORT_WEBHOOK_URL")),
+		Secret:     os.Getenv("USAGE_REPORT_SECRET"),
+	}
+	if cfg.Dir == "" && cfg.WebhookURL == "" {
+		return nil, nil
+	}
+	format, err := parseUsageFormat(os.Getenv("USAGE_REPORT_FORMAT"))
+	if err != nil {
+		return nil, fmt.Errorf("USAGE_REPORT_FORMAT 无效: %w", err)
+	}
+	cfg.Format = format
+	if cfg.WebhookURL != "" && !strings.HasPrefix(cfg.WebhookURL, "http://") && !strings.HasPrefix(cfg.WebhookURL, "https://") {
+		return nil, fmt.Errorf("USAGE_REPORT_WEBHOOK_URL 必须是 http(s) 地址")
+	}
+	delay := utils.GetEnvIntWithDefault("USAGE_REPORT_DELAY_MINUTES", 5)
+	if delay < 0 {
+		return nil, fmt.Errorf("USAGE_REPORT_DELAY_MINUTES 不能为负数")
+	}
+	cfg.Delay = time.Duration(delay) * time.Minute
+	if cfg.Dir != "" {
+		if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+			return nil, fmt.Errorf("创建用量报表目录失败: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+// UsageReporter 每天 UTC 零点后生成前一天的用量报表，写入目录并/或投递到 Webhook
+type UsageReporter struct {
+	cfg       UsageReportConfig
+	auditPath string
+	client    *http.Client
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// NewUsageReporter 创建每日用量报表任务
+func NewUsageReporter(cfg UsageReportConfig, auditPath string) *UsageReporter {
+	return &UsageReporter{
+		cfg:       cfg,
+		auditPath: auditPath,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Start 启动后台任务；配置了输出目录时先补生成缺失的前一天日报
+func (r *UsageReporter) Start() {
+	go func() {
+		defer close(r.done)
+		// 零点后的延迟窗口内启动时由下方的定时执行生成，避免重复投递
+		now := time.Now().UTC()
+		if today := now.Truncate(24 * time.Hour); r.cfg.Dir != "" && now.Sub(today) >= r.cfg.Delay {
+			yesterday := today.AddDate(0, 0, -1)
+			if _, err := os.Stat(r.reportPath(yesterday)); os.IsNotExist(err) {
+				r.runLogged(yesterday)
+			}
+		}
+		for {
+			now := time.Now().UTC()
+			next := now.Truncate(24 * time.Hour).Add(r.cfg.Delay)
+			if !next.After(now) {
+				next = next.AddDate(0, 0, 1)
+			}
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-r.stop:
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+			r.runLogged(next.Truncate(24*time.Hour).AddDate(0, 0, -1))
+		}
+	}()
+}
+
+// Stop 停止后台任务
+func (r *UsageReporter) Stop() {
+	close(r.stop)
+	<-r.done
+}
+
+func (r *UsageReporter) runLogged(day time.Time) {
+	if err := r.Run(day); err != nil {
+		logger.Error("生成每日用量报表失败", logger.String("day", day.Format(usageDateLayout)), logger.Err(err))
+		return
+	}
+	logger.Info("每日用量报表已生成", logger.String("day", day.Format(usageDateLayout)))
+}
+
+// reportPath 日报文件路径
+func (r *UsageReporter) reportPath(day time.Time) string {
+	return filepath.Join(r.cfg.Dir, fmt.Sprintf("usage-%s.%s", day.Format(usageDateLayout), r.cfg.Format))
+}
+
+// Run 生成指定 UTC 日期的日报，写入目录（先写临时文件再重命名）并投递到 Webhook
+func (r *UsageReporter) Run(day time.Time) error {
+	from := day.UTC().Truncate(24 * time.Hour)
+	report, err := BuildUsageReport(r.auditPath, from, from.AddDate(0, 0, 1))
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := report.Encode(&buf, r.cfg.Format); err != nil {
+		return fmt.Errorf("输出用量报表失败: %w", err)
+	}
+
+	if r.cfg.Dir != "" {
+		path := r.reportPath(from)
+		if err := os.WriteFile(path+".tmp", buf.Bytes(), 0o600); err != nil {
+			return fmt.Errorf("写入用量报表失败: %w", err)
+		}
+		if err := os.Rename(path+".tmp", path); err != nil {
+			return fmt.Errorf("写入用量报表失败: %w", err)
+		}
+	}
+	if r.cfg.WebhookURL != "" {
+		if err := r.post(from, buf.Bytes()); err != nil {
+			return fmt.Errorf("投递用量报表失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// post 投递日报，X-Kiro-Report-Date 为报表日期
+func (r *UsageReporter) post(day time.Time, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, r.cfg.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", usageContentType(r.cfg.Format))
+	req.Header.Set("User-Agent", "kiro2api-usage-report")
+	req.Header.Set("X-Kiro-Report-Date", day.Format(usageDateLayout))
+	if r.cfg.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(r.cfg.Secret))
+		mac.Write(body)
+		req.Header.Set("X-Kiro-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("目标返回 %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"kiro2api/audit"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var usageTestDay = time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+// withUsageAuditLog 写入测试记录并把全局审计写入器指向该文件
+func withUsageAuditLog(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	writer, err := audit.NewWriter(path, audit.DefaultOptions())
+	require.NoError(t, err)
+
+	records := []audit.Record{
+		{Time: usageTestDay.Add(time.Hour), ClientKey: "default", Account: "acc-1", Status: 200, InputTokens: 100, OutputTokens: 20, Cost: 0.5},
+		{Time: usageTestDay.Add(2 * time.Hour), ClientKey: "default", Account: "acc-2", Status: 200, InputTokens: 50, OutputTokens: 10, Cost: 0.25},
+		{Time: usageTestDay.Add(3 * time.Hour), ClientKey: "ci-runner", Account: "acc-1", Status: 502, ErrorCode: "upstream_error"},
+		{Time: usageTestDay.Add(4 * time.Hour), ClientKey: "ci-runner", Status: 200},     // count_tokens 等不经过上游
+		{Time: usageTestDay.Add(5 * time.Hour), Status: 401},                             // 认证失败
+		{Time: usageTestDay.Add(25 * time.Hour), ClientKey: "default", Account: "acc-1"}, // 次日
+	}
+	for _, rec := range records {
+		rec.Kind = audit.KindRequest
+		writer.Write(rec)
+	}
+	writer.Write(audit.Record{Time: usageTestDay.Add(time.Hour), Kind: audit.KindAdmin, Actor: "admin"})
+	writer.Close()
+
+	original := auditLog
+	auditLog = writer
+	t.Cleanup(func() { auditLog = original })
+	return path
+}
+
+func TestBuildUsageReport(t *testing.T) {
+	path := withUsageAuditLog(t)
+
+	report, err := BuildUsageReport(path, usageTestDay, usageTestDay.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	assert.Equal(t, []UsageSummary{
+		{Group: "key", Name: "ci-runner", Requests: 2, Errors: 1, ErrorCodes: map[string]int64{"upstream_error": 1}},
+		{Group: "key", Name: "default", Requests: 2, InputTokens: 150, OutputTokens: 30, Cost: 0.75},
+	}, report.Keys)
+	assert.Equal(t, []UsageSummary{
+		{Group: "account", Name: "acc-1", Requests: 2, Errors: 1, ErrorCodes: map[string]int64{"upstream_error": 1}, InputTokens: 100, OutputTokens: 20, Cost: 0.5},
+		{Group: "account", Name: "acc-2", Requests: 1, InputTokens: 50, OutputTokens: 10, Cost: 0.25},
+	}, report.Accounts)
+	assert.Equal(t, 0.75, report.TotalCost)
+}
+
+func TestHandleUsageExport(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	withUsageAuditLog(t)
+	r := gin.New()
+	r.GET("/api/usage/export", handleUsageExport)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/usage/export?from=2026-10-01&to=2026-10-01", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/csv")
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 5)
+	assert.Equal(t, "from,to,group,name,requests,errors,input_tokens,output_tokens,cost", lines[0])
+	assert.Equal(t, "2026-10-01T00:00:00Z,2026-10-02T00:00:00Z,key,default,2,0,150,30,0.750000", lines[2])
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/usage/export?from=2026-10-01&to=2026-10-02&format=json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var report UsageReport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Len(t, report.Accounts, 2)
+	assert.Equal(t, int64(3), report.Keys[1].Requests, "日期范围包含结束当天")
+
+	for _, query := range []string{"format=xml", "from=yesterday", "from=2026-10-02&to=2026-10-01"} {
+		w = httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/usage/export?"+query, nil))
+		assert.Equal(t, http.StatusBadRequest, w.Code, query)
+	}
+
+	auditLog = nil
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/usage/export", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "audit_disabled")
+}
+
+func TestUsageReporter_WritesAndPostsDailyReport(t *testing.T) {
+	path := withUsageAuditLog(t)
+
+	var body []byte
+	var header http.Header
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+	}))
+	defer target.Close()
+
+	dir := t.TempDir()
+	reporter := NewUsageReporter(UsageReportConfig{Dir: dir, WebhookURL: target.URL, Secret: "s3cret", Format: usageFormatJSON}, path)
+	require.NoError(t, reporter.Run(usageTestDay.Add(12*time.Hour)))
+
+	written, err := os.ReadFile(filepath.Join(dir, "usage-2026-10-01.json"))
+	require.NoError(t, err)
+	assert.Equal(t, written, body)
+	assert.Equal(t, "2026-10-01", header.Get("X-Kiro-Report-Date"))
+	mac := hmac.New(sha256.New, []byte("s3cret"))
+	mac.Write(body)
+	assert.Equal(t, "sha256="+hex.EncodeToString(mac.Sum(nil)), header.Get("X-Kiro-Signature"))
+
+	var report UsageReport
+	require.NoError(t, json.Unmarshal(written, &report))
+	assert.Equal(t, usageTestDay, report.From)
+	assert.Len(t, report.Keys, 2)
+}
@@ -0,0 +1,135 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// withUpstreamUsage 在上游流末尾追加携带 token 用量的 metadataEvent
+func withUpstreamUsage(upstream []byte, payload string) []byte {
+	return append(upstream, encodeEventStreamFrame("metadataEvent", []byte(payload))...)
+}
+
+// anthropicUsage 返回 message_start 与 message_delta 中的 usage
+func anthropicUsage(t *testing.T, body string) (start, final map[string]any) {
+	t.Helper()
+	for _, ev := range parseSSE(t, body) {
+		var data map[string]any
+		require.NoError(t, json.Unmarshal([]byte(ev.Data), &data))
+		switch data["type"] {
+		case "message_start":
+			start = data["message"].(map[string]any)["usage"].(map[string]any)
+		case "message_delta":
+			final = data["usage"].(map[string]any)
+		case "usage":
+			t.Fatal("上游用量事件不应转发给客户端")
+		}
+	}
+	require.NotNil(t, final, "缺少 message_delta usage")
+	return start, final
+}
+
+// openAIUsageChunk 返回 [DONE] 前的用量块，并校验其前一个块携带 finish_reason
+func openAIUsageChunk(t *testing.T, body string) map[string]any {
+	t.Helper()
+	events := parseSSE(t, body)
+	require.GreaterOrEqual(t, len(events), 3)
+	require.Equal(t, "[DONE]", events[len(events)-1].Data)
+
+	var last, finish map[string]any
+	require.NoError(t, json.Unmarshal([]byte(events[len(events)-2].Data), &last))
+	require.NoError(t, json.Unmarshal([]byte(events[len(events)-3].Data), &finish))
+	assert.Equal(t, []any{}, last["choices"], "用量块的 choices 必须为空数组")
+	assert.NotNil(t, finish["choices"].([]any)[0].(map[string]any)["finish_reason"])
+
+	usage, ok := last["usage"].(map[string]any)
+	require.True(t, ok, "最后一个数据块缺少 usage")
+	return usage
+}
+
+func TestAnthropicStream_UsageEstimated(t *testing.T) {
+	body := replayStream(t, thinkingUpstream("Hello ", "world"), func(c *gin.Context, req types.AnthropicRequest) {
+		req.Messages = []types.AnthropicRequestMessage{{Role: "user", Content: "hi"}}
+		handleStreamRequest(c, req, &types.TokenWithUsage{})
+	})
+
+	start, final := anthropicUsage(t, body)
+	assert.Equal(t, start["input_tokens"], final["input_tokens"])
+	assert.Greater(t, final["input_tokens"], float64(0))
+	assert.Greater(t, final["output_tokens"], float64(0))
+}
+
+func TestAnthropicStream_UsageFromUpstream(t *testing.T) {
+	upstream := withUpstreamUsage(thinkingUpstream("Hello"), `{"tokenUsage":{"inputTokens":321,"outputTokens":45}}`)
+
+	body := replayStream(t, upstream, func(c *gin.Context, req types.AnthropicRequest) {
+		handleStreamRequest(c, req, &types.TokenWithUsage{})
+	})
+
+	_, final := anthropicUsage(t, body)
+	assert.Equal(t, float64(321), final["input_tokens"])
+	assert.Equal(t, float64(45), final["output_tokens"])
+}
+
+func TestAnthropicUsage_PromptCache(t *testing.T) {
+	upstream := withUpstreamUsage(thinkingUpstream("Hello"),
+		`{"tokenUsage":{"inputTokens":20,"outputTokens":5,"cacheReadInputTokens":1800,"cacheWriteInputTokens":0}}`)
+
+	body := replayStream(t, upstream, func(c *gin.Context, req types.AnthropicRequest) {
+		handleStreamRequest(c, req, &types.TokenWithUsage{})
+	})
+	start, final := anthropicUsage(t, body)
+	assert.Equal(t, float64(0), start["cache_read_input_tokens"])
+	assert.Equal(t, float64(0), start["cache_creation_input_tokens"])
+	assert.Equal(t, float64(20), final["input_tokens"])
+	assert.Equal(t, float64(1800), final["cache_read_input_tokens"])
+	assert.Equal(t, float64(0), final["cache_creation_input_tokens"])
+
+	// 上游未提供缓存用量时字段为 0
+	var none upstreamUsage
+	usage := none.anthropicUsage(10, 2)
+	assert.Equal(t, 0, usage["cache_creation_input_tokens"])
+	assert.Equal(t, 0, usage["cache_read_input_tokens"])
+}
+
+func TestOpenAIStream_IncludeUsage(t *testing.T) {
+	body := replayStream(t, textThenToolUpstream("Let me check."), func(c *gin.Context, req types.AnthropicRequest) {
+		req.Messages = []types.AnthropicRequestMessage{{Role: "user", Content: "天气如何"}}
+		handleOpenAIStreamRequest(c, req, types.TokenInfo{}, true)
+	})
+
+	usage := openAIUsageChunk(t, body)
+	prompt := usage["prompt_tokens"].(float64)
+	completion := usage["completion_tokens"].(float64)
+	assert.Greater(t, prompt, float64(0))
+	assert.Greater(t, completion, float64(12), "包含文本与工具调用的用量")
+	assert.Equal(t, prompt+completion, usage["total_tokens"])
+}
+
+func TestOpenAIStream_UsageFromUpstream(t *testing.T) {
+	upstream := withUpstreamUsage(thinkingUpstream("Hello"), `{"tokenUsage":{"inputTokens":100,"outputTokens":8}}`)
+
+	body := replayStream(t, upstream, func(c *gin.Context, req types.AnthropicRequest) {
+		handleOpenAIStreamRequest(c, req, types.TokenInfo{}, true)
+	})
+
+	assert.Equal(t, map[string]any{
+		"prompt_tokens":     float64(100),
+		"completion_tokens": float64(8),
+		"total_tokens":      float64(108),
+	}, openAIUsageChunk(t, body))
+}
+
+func TestOpenAIStream_UsageOmittedByDefault(t *testing.T) {
+	body := replayStream(t, thinkingUpstream("Hello"), func(c *gin.Context, req types.AnthropicRequest) {
+		handleOpenAIStreamRequest(c, req, types.TokenInfo{}, false)
+	})
+
+	assert.NotContains(t, body, `"usage"`)
+}
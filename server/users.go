@@ -0,0 +1,315 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"kiro2api/logger"
+)
+
+// Role 管理后台用户角色
+type Role string
+
+// 角色常量（权限由低到高）
+const (
+	RoleViewer   Role = "viewer"   // 只读：查看Token池与统计
+	RoleOperator Role = "operator" // 运维：管理Token
+	RoleAdmin    Role = "admin"    // 管理员：管理用户与密钥
+)
+
+// roleRank 角色权限等级，数值越大权限越高
+var roleRank = map[Role]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// ParseRole 解析角色字符串，非法值返回错误
+func ParseRole(s string) (Role, error) {
+	role := Role(s)
+	if _, ok := roleRank[role]; !ok {
+		return "", fmt.Errorf("无效的角色: %s（可选 viewer/operator/admin）", s)
+	}
+	return role, nil
+}
+
+// Allows 判断当前角色是否满足所需角色
+func (r Role) Allows(required Role) bool {
+	return roleRank[r] >= roleRank[required] && roleRank[r] > 0
+}
+
+// AdminUser 管理后台用户
+// 密码可以是明文 Password，也可以是 PasswordHash（bcrypt/argon2id，见 kiro2api hash-password），二者只能设置其一
+type AdminUser struct {
+	Username     string `json:"username"`
+	Password     string `json:"password,omitempty"`
+	PasswordHash string `json:"password_hash,omitempty"`
+	Role         Role   `json:"role"`
+}
+
+// hasCredential 是否设置了密码或密码哈希
+func (u AdminUser) hasCredential() bool {
+	return u.Password != "" || u.PasswordHash != ""
+}
+
+// UserStore 管理后台用户存储（文件持久化）
+type UserStore struct {
+	mu       sync.RWMutex
+	users    map[string]AdminUser
+	filePath string // 为空时仅保存在内存中
+}
+
+// NewUserStore 创建用户存储
+// filePath 非空且文件存在时从文件加载；否则使用 fallback 用户（单管理员兼容模式）
+// 是否允许零用户启动（例如仅使用SSO登录）由调用方决定
+func NewUserStore(filePath string, fallback *AdminUser) (*UserStore, error) {
+	s := &UserStore{
+		users:    make(map[string]AdminUser),
+		filePath: filePath,
+	}
+
+	if filePath != "" {
+		if info, err := os.Stat(filePath); err == nil && !info.IsDir() {
+			if err := s.loadFromFile(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// 文件中没有用户时使用兼容的单管理员配置
+	if len(s.users) == 0 && fallback != nil && fallback.hasCredential() {
+		user := *fallback
+		if user.Role == "" {
+			user.Role = RoleAdmin
+		}
+		if err := validateAdminUser(user); err != nil {
+			return nil, fmt.Errorf("管理员配置无效: %w", err)
+		}
+		// 明文密码只在内存中转换为哈希，之后通过管理后台修改用户时用户文件中不会出现明文
+		if user.Password != "" {
+			hash, err := HashPassword(user.Password, PasswordAlgoArgon2id)
+			if err != nil {
+				return nil, fmt.Errorf("管理员配置无效: %w", err)
+			}
+			user.Password, user.PasswordHash = "", hash
+		}
+		s.users[user.Username] = user
+	}
+
+	return s, nil
+}
+
+// loadFromFile 从用户文件加载并校验用户
+func (s *UserStore) loadFromFile() error {
+	content, err := os.ReadFile(s.filePath)
+	if err != nil {
+		return fmt.Errorf("读取用户文件失败: %w\n用户文件路径: %s", err, s.filePath)
+	}
+
+	var users []AdminUser
+	if err := json.Unmarshal(content, &users); err != nil {
+		return fmt.Errorf("解析用户文件失败: %w\n用户文件路径: %s", err, s.filePath)
+	}
+
+	for _, u := range users {
+		if err := validateAdminUser(u); err != nil {
+			return fmt.Errorf("用户文件中存在无效用户: %w", err)
+		}
+		s.users[u.Username] = u
+	}
+
+	logger.Info("从文件加载管理后台用户",
+		logger.String("file_path", s.filePath),
+		logger.Int("user_count", len(s.users)))
+	return nil
+}
+
+// validateAdminUser 校验用户字段
+func validateAdminUser(u AdminUser) error {
+	if u.Username == "" {
+		return fmt.Errorf("用户名不能为空")
+	}
+	if !u.hasCredential() {
+		return fmt.Errorf("用户 %s 的密码不能为空", u.Username)
+	}
+	if u.Password != "" && u.PasswordHash != "" {
+		return fmt.Errorf("用户 %s 不能同时设置 password 与 password_hash", u.Username)
+	}
+	if u.PasswordHash != "" {
+		if err := validatePasswordHash(u.PasswordHash); err != nil {
+			return fmt.Errorf("用户 %s: %w", u.Username, err)
+		}
+	}
+	if _, err := ParseRole(string(u.Role)); err != nil {
+		return fmt.Errorf("用户 %s: %w", u.Username, err)
+	}
+	return nil
+}
+
+// Authenticate 校验用户名和密码（明文常数时间比较，或校验密码哈希），成功返回用户信息
+func (s *UserStore) Authenticate(username, password string) (AdminUser, bool) {
+	s.mu.RLock()
+	user, exists := s.users[username]
+	hashed := s.hasHashedLocked()
+	s.mu.RUnlock()
+
+	// 用户不存在时仍执行一次比较，避免通过耗时差异枚举用户名
+	if !exists {
+		user = AdminUser{Password: password + "\x00"}
+		if hashed {
+			user = AdminUser{PasswordHash: dummyPasswordHash()}
+		}
+	}
+
+	var passMatch bool
+	if user.PasswordHash != "" {
+		match, err := VerifyPasswordHash(user.PasswordHash, password)
+		if err != nil {
+			logger.Error("校验管理后台密码哈希失败", logger.String("username", username), logger.Err(err))
+		}
+		passMatch = match
+	} else {
+		passMatch = subtle.ConstantTimeCompare([]byte(password), []byte(user.Password)) == 1
+	}
+
+	if !exists || !passMatch {
+		return AdminUser{}, false
+	}
+	return user, true
+}
+
+// Count 返回用户数量
+func (s *UserStore) Count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.users)
+}
+
+// Get 获取指定用户
+func (s *UserStore) Get(username string) (AdminUser, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	user, ok := s.users[username]
+	return user, ok
+}
+
+// List 返回按用户名排序的用户列表
+func (s *UserStore) List() []AdminUser {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	users := make([]AdminUser, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+	return users
+}
+
+// Upsert 新增或更新用户并持久化
+func (s *UserStore) Upsert(user AdminUser) error {
+	if err := validateAdminUser(user); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.users[user.Username]
+	s.users[user.Username] = user
+
+	// 不允许把最后一个管理员降级
+	if existed && previous.Role == RoleAdmin && user.Role != RoleAdmin && s.countAdminsLocked() == 0 {
+		s.users[user.Username] = previous
+		return fmt.Errorf("至少需要保留一个管理员")
+	}
+
+	if err := s.saveLocked(); err != nil {
+		if existed {
+			s.users[user.Username] = previous
+		} else {
+			delete(s.users, user.Username)
+		}
+		return err
+	}
+	return nil
+}
+
+// Remove 删除用户并持久化
+func (s *UserStore) Remove(username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, exists := s.users[username]
+	if !exists {
+		return fmt.Errorf("用户不存在: %s", username)
+	}
+
+	delete(s.users, username)
+
+	if user.Role == RoleAdmin && s.countAdminsLocked() == 0 {
+		s.users[username] = user
+		return fmt.Errorf("至少需要保留一个管理员")
+	}
+
+	if err := s.saveLocked(); err != nil {
+		s.users[username] = user
+		return err
+	}
+	return nil
+}
+
+// hasHashedLocked 是否存在使用密码哈希的用户（调用时需持有锁）
+func (s *UserStore) hasHashedLocked() bool {
+	for _, u := range s.users {
+		if u.PasswordHash != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// countAdminsLocked 统计管理员数量（调用时需持有锁）
+func (s *UserStore) countAdminsLocked() int {
+	count := 0
+	for _, u := range s.users {
+		if u.Role == RoleAdmin {
+			count++
+		}
+	}
+	return count
+}
+
+// saveLocked 持久化用户到文件（调用时需持有锁）
+func (s *UserStore) saveLocked() error {
+	if s.filePath == "" {
+		return nil
+	}
+
+	users := make([]AdminUser, 0, len(s.users))
+	for _, u := range s.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Username < users[j].Username
+	})
+
+	data, err := json.MarshalIndent(users, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化用户失败: %w", err)
+	}
+	if err := os.WriteFile(s.filePath, data, 0o600); err != nil {
+		return fmt.Errorf("写入用户文件失败: %w\n用户文件路径: %s", err, s.filePath)
+	}
+
+	logger.Info("管理后台用户已持久化到文件",
+		logger.String("file_path", s.filePath),
+		logger.Int("user_count", len(users)))
+	return nil
+}
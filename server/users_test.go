@@ -0,0 +1,268 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRole_Allows(t *testing.T) {
+	assert.True(t, RoleAdmin.Allows(RoleOperator))
+	assert.True(t, RoleOperator.Allows(RoleViewer))
+	assert.True(t, RoleViewer.Allows(RoleViewer))
+	assert.False(t, RoleViewer.Allows(RoleOperator))
+	assert.False(t, RoleOperator.Allows(RoleAdmin))
+	assert.False(t, Role("").Allows(RoleViewer))
+}
+
+func TestUserStore_FallbackAdmin(t *testing.T) {
+	store, err := NewUserStore("", &AdminUser{Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+
+	user, ok := store.Authenticate("admin", "secret")
+	assert.True(t, ok)
+	assert.Equal(t, RoleAdmin, user.Role)
+
+	_, ok = store.Authenticate("admin", "wrong")
+	assert.False(t, ok)
+	_, ok = store.Authenticate("nobody", "secret")
+	assert.False(t, ok)
+}
+
+func TestUserStore_NoUsers(t *testing.T) {
+	store, err := NewUserStore("", &AdminUser{Username: "admin"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, store.Count())
+}
+
+func TestUserStore_LoadAndPersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	require.NoError(t, os.WriteFile(path, []byte(`[
+		{"username":"root","password":"p1","role":"admin"},
+		{"username":"ro","password":"p2","role":"viewer"}
+	]`), 0o600))
+
+	store, err := NewUserStore(path, &AdminUser{Username: "admin", Password: "ignored"})
+	require.NoError(t, err)
+	assert.Len(t, store.List(), 2)
+
+	_, ok := store.Authenticate("admin", "ignored")
+	assert.False(t, ok, "用户文件存在时不应启用兼容管理员")
+
+	require.NoError(t, store.Upsert(AdminUser{Username: "ops", Password: "p3", Role: RoleOperator}))
+
+	reloaded, err := NewUserStore(path, nil)
+	require.NoError(t, err)
+	user, ok := reloaded.Authenticate("ops", "p3")
+	assert.True(t, ok)
+	assert.Equal(t, RoleOperator, user.Role)
+}
+
+func TestUserStore_KeepsLastAdmin(t *testing.T) {
+	store, err := NewUserStore("", &AdminUser{Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+
+	assert.Error(t, store.Remove("admin"))
+	assert.Error(t, store.Upsert(AdminUser{Username: "admin", Password: "secret", Role: RoleViewer}))
+
+	_, ok := store.Authenticate("admin", "secret")
+	assert.True(t, ok)
+}
+
+func TestUserStore_InvalidRole(t *testing.T) {
+	store, err := NewUserStore("", &AdminUser{Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+	assert.Error(t, store.Upsert(AdminUser{Username: "x", Password: "y", Role: "root"}))
+}
+
+func TestAdminAPIAuthGuard_Roles(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(role Role) *gin.Engine {
+		r := gin.New()
+		r.Use(func(c *gin.Context) {
+			c.Set(sessionUserKey, "u")
+			c.Set(sessionRoleKey, role)
+			c.Next()
+		})
+		api := r.Group("/api")
+		api.Use(AdminAPIAuthGuard())
+		api.GET("/tokens", func(c *gin.Context) { c.Status(http.StatusOK) })
+		api.POST("/tokens", func(c *gin.Context) { c.Status(http.StatusOK) })
+		api.GET("/users", RequireRole(RoleAdmin), func(c *gin.Context) { c.Status(http.StatusOK) })
+		return r
+	}
+
+	tests := []struct {
+		role   Role
+		method string
+		path   string
+		want   int
+	}{
+		{RoleViewer, http.MethodGet, "/api/tokens", http.StatusOK},
+		{RoleViewer, http.MethodPost, "/api/tokens", http.StatusForbidden},
+		{RoleOperator, http.MethodPost, "/api/tokens", http.StatusOK},
+		{RoleOperator, http.MethodGet, "/api/users", http.StatusForbidden},
+		{RoleAdmin, http.MethodGet, "/api/users", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(tt.method, tt.path, nil)
+		newRouter(tt.role).ServeHTTP(w, req)
+		assert.Equal(t, tt.want, w.Code, "%s %s as %s", tt.method, tt.path, tt.role)
+	}
+}
+
+func TestAdminAPIAuthGuard_Unauthenticated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.GET("/api/tokens", AdminAPIAuthGuard(), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/tokens", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestUserStore_PasswordHash(t *testing.T) {
+	for _, algo := range []string{PasswordAlgoArgon2id, PasswordAlgoBcrypt} {
+		t.Run(algo, func(t *testing.T) {
+			hash, err := HashPassword("secret", algo)
+			require.NoError(t, err)
+			store, err := NewUserStore("", &AdminUser{Username: "admin", PasswordHash: hash})
+			require.NoError(t, err)
+
+			_, ok := store.Authenticate("admin", "secret")
+			assert.True(t, ok)
+			_, ok = store.Authenticate("admin", "wrong")
+			assert.False(t, ok)
+			_, ok = store.Authenticate("nobody", "secret")
+			assert.False(t, ok)
+			_, ok = store.Authenticate("admin", hash)
+			assert.False(t, ok, "哈希本身不能作为密码登录")
+		})
+	}
+
+	_, err := NewUserStore("", &AdminUser{Username: "admin", PasswordHash: "not-a-hash"})
+	assert.Error(t, err)
+	_, err = NewUserStore("", &AdminUser{Username: "admin", Password: "secret", PasswordHash: "$2a$10$x"})
+	assert.Error(t, err)
+}
+
+func TestUserStore_FallbackPasswordNotPersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	store, err := NewUserStore(path, &AdminUser{Username: "admin", Password: "fallback-secret"})
+	require.NoError(t, err)
+
+	user, ok := store.Get("admin")
+	require.True(t, ok)
+	assert.Empty(t, user.Password)
+	assert.True(t, strings.HasPrefix(user.PasswordHash, "$argon2id$"))
+
+	require.NoError(t, store.Upsert(AdminUser{Username: "ops", Password: "p3", Role: RoleOperator}))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "fallback-secret")
+
+	reloaded, err := NewUserStore(path, nil)
+	require.NoError(t, err)
+	_, ok = reloaded.Authenticate("admin", "fallback-secret")
+	assert.True(t, ok)
+}
+
+func TestAuthHandlers_UpsertUserStoresHash(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	path := filepath.Join(t.TempDir(), "users.json")
+	store, err := NewUserStore(path, &AdminUser{Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+	sessions := NewSessionManager(time.Hour, time.Hour)
+	t.Cleanup(sessions.Close)
+	h := NewAuthHandlers(sessions, store, time.Hour, newTestLoginLockout(t), http.SameSiteLaxMode)
+
+	r := gin.New()
+	r.PUT("/api/users", h.HandleUpsertUser)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/api/users",
+		strings.NewReader(`{"username":"ops","password":"ops-plain-secret","role":"operator"}`)))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "ops-plain-secret")
+	assert.Contains(t, string(data), `"password_hash": "$argon2id$`)
+
+	user, ok := store.Authenticate("ops", "ops-plain-secret")
+	require.True(t, ok)
+	assert.Equal(t, RoleOperator, user.Role)
+}
+
+func TestAuthHandlers_RevokeSessionsOnUserChange(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	store, err := NewUserStore("", &AdminUser{Username: "admin", Password: "secret"})
+	require.NoError(t, err)
+	require.NoError(t, store.Upsert(AdminUser{Username: "ops", Password: "p1", Role: RoleOperator}))
+	require.NoError(t, store.Upsert(AdminUser{Username: "ro", Password: "p2", Role: RoleViewer}))
+
+	sessions := NewSessionManager(time.Hour, time.Hour)
+	t.Cleanup(sessions.Close)
+	h := NewAuthHandlers(sessions, store, time.Hour, newTestLoginLockout(t), http.SameSiteLaxMode)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(sessionUserKey, "admin")
+		c.Set(sessionRoleKey, RoleAdmin)
+		c.Next()
+	})
+	r.POST("/api/users", h.HandleUpsertUser)
+	r.DELETE("/api/users/:username", h.HandleDeleteUser)
+
+	opsSession, err := sessions.CreateSession("ops", RoleOperator)
+	require.NoError(t, err)
+	roSession, err := sessions.CreateSession("ro", RoleViewer)
+	require.NoError(t, err)
+
+	// 角色与密码都未变更时不影响已有会话
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/users",
+		strings.NewReader(`{"username":"ops","role":"operator"}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+	_, ok := sessions.Validate(opsSession.ID)
+	assert.True(t, ok)
+
+	// 修改密码撤销会话
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/users",
+		strings.NewReader(`{"username":"ops","password":"p9","role":"operator"}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+	_, ok = sessions.Validate(opsSession.ID)
+	assert.False(t, ok, "修改密码后旧会话应失效")
+	_, ok = store.Authenticate("ops", "p9")
+	assert.True(t, ok)
+
+	// 角色变更撤销会话
+	opsSession, err = sessions.CreateSession("ops", RoleOperator)
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/api/users",
+		strings.NewReader(`{"username":"ops","role":"viewer"}`)))
+	require.Equal(t, http.StatusOK, w.Code)
+	_, ok = sessions.Validate(opsSession.ID)
+	assert.False(t, ok, "角色变更后旧会话应失效")
+
+	// 删除用户撤销会话
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, "/api/users/ro", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	_, ok = sessions.Validate(roSession.ID)
+	assert.False(t, ok, "删除用户后旧会话应失效")
+}
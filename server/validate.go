@@ -0,0 +1,125 @@
+package server
+
+import (
+	"crypto/tls"
+	"fmt"
+	"os"
+	"strings"
+
+	"kiro2api/auth"
+	"kiro2api/config"
+	"kiro2api/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ConfigCheck 单项启动配置的校验结果，Err 为 nil 表示通过
+type ConfigCheck struct {
+	Name string
+	Err  error
+}
+
+// ValidateConfig 按启动时的规则校验环境变量与配置文件，不启动服务、不写文件、不发起网络请求
+// 校验项与 StartServer 中导致启动失败的检查一致
+func ValidateConfig() []ConfigCheck {
+	checks := []ConfigCheck{
+		{"可信代理", LoadTrustedProxyConfigFromEnv().Apply(gin.New())},
+		{"CORS", LoadCORSConfigFromEnv().Validate()},
+		{"模型路由表", validateModelsConfig(LoadModelsConfigFromEnv())},
+	}
+	add := func(name string, err error) {
+		checks = append(checks, ConfigCheck{Name: name, Err: err})
+	}
+
+	_, err := config.LoadServerConfig()
+	add("服务配置", err)
+	_, err = LoadSecurityHeadersConfigFromEnv()
+	add("安全响应头", err)
+	_, err = LoadCompressionConfigFromEnv()
+	add("响应压缩", err)
+	_, err = utils.LoadUpstreamClientConfigFromEnv()
+	add("上游连接池", err)
+	_, err = auth.LoadRefreshScheduleFromEnv()
+	add("token主动刷新", err)
+	_, err = LoadRedactorFromEnv()
+	add("脱敏规则", err)
+	_, err = LoadIPAccessConfigFromEnv()
+	add("IP访问控制", err)
+	_, err = LoadSignatureVerifierFromEnv()
+	add("请求签名", err)
+	_, err = LoadPromptPoliciesFromEnv()
+	add("系统提示策略", err)
+	_, err = LoadTokenQueueFromEnv()
+	add("请求排队", err)
+	_, err = LoadStickyRouterFromEnv()
+	add("会话粘性路由", err)
+	_, err = LoadResponseCacheFromEnv()
+	add("响应缓存", err)
+	_, err = LoadPassthroughConfigFromEnv()
+	add("事件流透传", err)
+	_, err = LoadV1RateLimiterFromEnv()
+	add("限流", err)
+	_, err = LoadRequestDeadlinesFromEnv()
+	add("请求超时", err)
+	flags, err := LoadFeatureFlagsFromEnv()
+	add("功能开关", err)
+	batchConfig, err := LoadBatchConfigFromEnv()
+	if err == nil && flags != nil && flags.StartupEnabled(FeatureBatches) {
+		err = batchConfig.Validate()
+	}
+	add("批量请求", err)
+	_, err = LoadTokenUsageCacheTTLFromEnv()
+	add("账号用量查询", err)
+	_, err = LoadNotifierConfigFromEnv()
+	add("Webhook通知", err)
+	add("管理后台登录", validateAdminLogin())
+	_, err = LoadLoginLockoutConfigFromEnv()
+	add("登录锁定", err)
+	_, err = NewTemplateStore(utils.GetEnvWithDefault("REQUEST_TEMPLATES_FILE", "request_templates.json"))
+	add("请求模板", err)
+	add("TLS", validateTLSConfig(LoadTLSConfigFromEnv()))
+	return checks
+}
+
+// validateModelsConfig 解析模型路由文件（不替换当前路由表）
+func validateModelsConfig(cfg ModelsConfig) error {
+	if cfg.FilePath == "" {
+		return nil
+	}
+	_, err := config.LoadModelTableFile(cfg.FilePath)
+	return err
+}
+
+// validateAdminLogin 至少需要一种管理后台登录方式（用户文件、ADMIN_PASSWORD/ADMIN_PASSWORD_HASH 或 OIDC）
+func validateAdminLogin() error {
+	oidcConfig, err := LoadOIDCConfigFromEnv()
+	if err != nil {
+		return err
+	}
+	userStore, err := NewUserStore(os.Getenv("ADMIN_USERS_FILE"), &AdminUser{
+		Username:     utils.GetEnvWithDefault("ADMIN_USERNAME", "admin"),
+		Password:     os.Getenv("ADMIN_PASSWORD"),
+		PasswordHash: strings.TrimSpace(os.Getenv("ADMIN_PASSWORD_HASH")),
+		Role:         RoleAdmin,
+	})
+	if err != nil {
+		return err
+	}
+	if userStore.Count() == 0 && oidcConfig == nil {
+		return fmt.Errorf("未配置管理后台用户（ADMIN_PASSWORD、ADMIN_PASSWORD_HASH、ADMIN_USERS_FILE 或 OIDC_ISSUER）")
+	}
+	return nil
+}
+
+// validateTLSConfig 校验 TLS 配置并尝试加载证书文件（ACME 证书在运行时申请，不做检查）
+func validateTLSConfig(cfg TLSConfig) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	if cfg.CertFile != "" {
+		if _, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile); err != nil {
+			return fmt.Errorf("加载证书失败: %w", err)
+		}
+	}
+	return nil
+}
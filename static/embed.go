@@ -0,0 +1,9 @@
+// Package static 内嵌 Web Dashboard 静态资源，单个二进制即可提供管理界面
+package static
+
+import "embed"
+
+// Files 内嵌的 Dashboard 资源（HTML/CSS/JS）
+//
+//go:embed index.html login.html css js
+var Files embed.FS
@@ -10,7 +10,9 @@ class TokenDashboard {
         this.autoRefreshInterval = null;
         this.isAutoRefreshEnabled = false;
         this.apiBaseUrl = '/api';
-        this.pendingDeleteIndex = null;
+        this.pendingDeleteId = null;
+        this.logSource = null;
+        this.maxLogLines = 1000;
 
         this.init();
     }
@@ -44,6 +46,17 @@ class TokenDashboard {
                 if (logoutBtn) {
                     logoutBtn.style.display = data.authenticated ? 'inline-block' : 'none';
                 }
+                // 只读角色隐藏写操作入口
+                this.role = data.role || '';
+                const addBtn = document.querySelector('.add-btn');
+                if (addBtn && this.role === 'viewer') {
+                    addBtn.style.display = 'none';
+                }
+                // 实时日志仅对管理员开放
+                const logsBtn = document.getElementById('logsBtn');
+                if (logsBtn) {
+                    logsBtn.style.display = this.role === 'admin' ? 'inline-block' : 'none';
+                }
             }
         } catch (error) {
             // 会话检查失败，可能未启用登录系统
@@ -94,6 +107,7 @@ class TokenDashboard {
             if (e.target.classList.contains('modal')) {
                 this.hideAddTokenModal();
                 this.hideDeleteConfirmModal();
+                this.hideLogModal();
             }
         });
     }
@@ -115,6 +129,8 @@ class TokenDashboard {
             this.updateTokenTable(data);
             this.updateStatusBar(data);
             this.updateLastUpdateTime();
+            this.refreshIncidentState();
+            this.refreshUsage();
 
         } catch (error) {
             console.error('刷新Token数据失败:', error);
@@ -153,7 +169,11 @@ class TokenDashboard {
 
         return `
             <tr class="${token.error ? 'row-error' : ''}">
-                <td>${token.user_email || 'unknown'}</td>
+                <td>
+                    ${token.label ? `<div class="token-label">${this.escapeHtml(token.label)}</div>` : ''}
+                    ${token.user_email || 'unknown'}
+                    ${this.renderTags(token.tags)}
+                </td>
                 <td><span class="token-preview">${token.token_preview || 'N/A'}</span></td>
                 <td>${token.auth_type || 'Social'}</td>
                 <td>${token.remaining_usage || 0}</td>
@@ -161,12 +181,32 @@ class TokenDashboard {
                 <td>${this.formatDateTime(token.last_used)}</td>
                 <td class="status-cell">${statusBadge}</td>
                 <td>
-                    <button class="btn-delete-small" onclick="dashboard.showDeleteConfirmModal(${index})">删除</button>
+                    <button class="btn-toggle-small" onclick="dashboard.toggleToken('${token.id}', ${token.status !== 'disabled'})">${token.status === 'disabled' ? '启用' : '禁用'}</button>
+                    <button class="btn-delete-small" onclick="dashboard.showDeleteConfirmModal('${token.id}')">删除</button>
                 </td>
             </tr>
         `;
     }
 
+    /**
+     * 渲染标签徽章
+     */
+    renderTags(tags) {
+        if (!tags || tags.length === 0) {
+            return '';
+        }
+        return `<div class="token-tags">${tags.map(tag => `<span class="tag-badge">${this.escapeHtml(tag)}</span>`).join('')}</div>`;
+    }
+
+    /**
+     * 转义HTML，避免标签/备注中的内容被当作标记渲染
+     */
+    escapeHtml(text) {
+        const div = document.createElement('div');
+        div.textContent = String(text);
+        return div.innerHTML;
+    }
+
     /**
      * 显示空状态
      */
@@ -190,6 +230,72 @@ class TokenDashboard {
         this.updateElement('activeTokens', data.active_tokens || 0);
     }
 
+    /**
+     * 获取上游故障推断状态
+     */
+    async refreshIncidentState() {
+        const labels = {
+            normal: '正常',
+            degraded: '个别账号异常',
+            incident: '上游故障'
+        };
+        try {
+            const response = await fetch(`${this.apiBaseUrl}/incident`);
+            if (!response.ok) {
+                return;
+            }
+            const state = await response.json();
+            const el = document.getElementById('upstreamStatus');
+            if (el) {
+                el.textContent = labels[state.status] || state.status;
+                el.title = state.last_error || '';
+                el.style.color = state.status === 'incident' ? '#dc3545'
+                    : state.status === 'degraded' ? '#fd7e14' : '';
+            }
+        } catch (error) {
+            console.debug('获取上游状态失败:', error);
+        }
+    }
+
+    /**
+     * 获取今日用量与估算费用（未配置审计文件时隐藏）
+     */
+    async refreshUsage() {
+        const card = document.getElementById('usageCard');
+        const costItem = document.getElementById('todayCostItem');
+        try {
+            const response = await fetch(`${this.apiBaseUrl}/usage/export?format=json`);
+            if (!response.ok) {
+                card.style.display = 'none';
+                costItem.style.display = 'none';
+                return;
+            }
+            const report = await response.json();
+            const currency = report.currency || '';
+            const formatCost = (cost) => currency ? `${(cost || 0).toFixed(4)} ${currency}` : '-';
+            const groupLabels = { key: '调用方密钥', account: '账号' };
+            const rows = [...(report.keys || []), ...(report.accounts || [])].map(summary => `
+                <tr>
+                    <td>${groupLabels[summary.group] || summary.group}</td>
+                    <td>${this.escapeHtml(summary.name)}</td>
+                    <td>${summary.requests}</td>
+                    <td>${summary.errors}</td>
+                    <td>${summary.input_tokens}</td>
+                    <td>${summary.output_tokens}</td>
+                    <td>${this.escapeHtml(formatCost(summary.cost))}</td>
+                </tr>
+            `).join('');
+
+            document.getElementById('usageTableBody').innerHTML = rows
+                || '<tr><td colspan="7" class="empty-state">今日暂无请求</td></tr>';
+            card.style.display = '';
+            costItem.style.display = currency ? '' : 'none';
+            this.updateElement('todayCost', formatCost(report.total_cost));
+        } catch (error) {
+            console.debug('获取用量报表失败:', error);
+        }
+    }
+
     /**
      * 更新最后更新时间
      */
@@ -409,8 +515,8 @@ class TokenDashboard {
     /**
      * 显示删除确认模态框
      */
-    showDeleteConfirmModal(index) {
-        this.pendingDeleteIndex = index;
+    showDeleteConfirmModal(id) {
+        this.pendingDeleteId = id;
         document.getElementById('deleteConfirmModal').style.display = 'flex';
     }
 
@@ -418,7 +524,7 @@ class TokenDashboard {
      * 隐藏删除确认模态框
      */
     hideDeleteConfirmModal() {
-        this.pendingDeleteIndex = null;
+        this.pendingDeleteId = null;
         document.getElementById('deleteConfirmModal').style.display = 'none';
     }
 
@@ -426,10 +532,10 @@ class TokenDashboard {
      * 确认删除Token
      */
     async confirmDeleteToken() {
-        if (this.pendingDeleteIndex === null) return;
+        if (!this.pendingDeleteId) return;
 
         try {
-            const response = await fetch(`${this.apiBaseUrl}/tokens/${this.pendingDeleteIndex}`, {
+            const response = await fetch(`${this.apiBaseUrl}/tokens/${encodeURIComponent(this.pendingDeleteId)}`, {
                 method: 'DELETE',
                 headers: {
                     'X-CSRF-Token': this.getCsrfToken()
@@ -451,11 +557,118 @@ class TokenDashboard {
         }
     }
 
+    /**
+     * 启用/禁用Token
+     */
+    async toggleToken(id, disabled) {
+        try {
+            const response = await fetch(`${this.apiBaseUrl}/tokens/${encodeURIComponent(id)}`, {
+                method: 'PATCH',
+                headers: {
+                    'Content-Type': 'application/json',
+                    'X-CSRF-Token': this.getCsrfToken()
+                },
+                body: JSON.stringify({ disabled })
+            });
+
+            const result = await response.json();
+
+            if (result.success) {
+                this.refreshTokens();
+                this.showToast(disabled ? '账号已禁用' : '账号已启用');
+            } else {
+                this.showToast(result.error || '操作失败', 'error');
+            }
+        } catch (error) {
+            console.error('更新Token失败:', error);
+            this.showToast('网络错误: ' + error.message, 'error');
+        }
+    }
+
     // ==================== 工具方法 ====================
 
     /**
      * 显示提示消息
      */
+    /**
+     * 显示实时日志模态框并开始订阅
+     */
+    showLogModal() {
+        document.getElementById('logModal').style.display = 'flex';
+        this.startLogStream();
+    }
+
+    /**
+     * 隐藏实时日志模态框并断开订阅
+     */
+    hideLogModal() {
+        document.getElementById('logModal').style.display = 'none';
+        this.stopLogStream();
+    }
+
+    /**
+     * 按所选级别(重新)订阅 /api/logs/stream，断线后由 EventSource 自动重连并续传
+     */
+    startLogStream() {
+        this.stopLogStream();
+        this.clearLogOutput();
+
+        const level = document.getElementById('logLevel').value;
+        const source = new EventSource(`${this.apiBaseUrl}/logs/stream?level=${encodeURIComponent(level)}`);
+        source.addEventListener('log', (e) => this.appendLogLine(e.data));
+        source.onopen = () => this.updateElement('logStatus', '已连接');
+        source.onerror = () => this.updateElement('logStatus', '连接中断，正在重连...');
+        this.logSource = source;
+    }
+
+    /**
+     * 断开日志订阅
+     */
+    stopLogStream() {
+        if (this.logSource) {
+            this.logSource.close();
+            this.logSource = null;
+        }
+        this.updateElement('logStatus', '未连接');
+    }
+
+    /**
+     * 追加一行日志，超出上限时移除最早的行
+     */
+    appendLogLine(data) {
+        const output = document.getElementById('logOutput');
+        let text = data;
+        let level = '';
+        try {
+            const entry = JSON.parse(data);
+            level = (entry.level || '').toLowerCase();
+            const { timestamp, level: _, message, ...fields } = entry;
+            const extra = Object.keys(fields).length ? ' ' + JSON.stringify(fields) : '';
+            text = `${timestamp} ${(entry.level || '').padEnd(5)} ${message}${extra}`;
+        } catch (error) {
+            // 非JSON内容原样显示
+        }
+
+        const stickToBottom = output.scrollTop + output.clientHeight >= output.scrollHeight - 20;
+        const line = document.createElement('div');
+        line.className = level ? `log-${level}` : '';
+        line.textContent = text;
+        output.appendChild(line);
+        while (output.childElementCount > this.maxLogLines) {
+            output.removeChild(output.firstChild);
+        }
+        if (stickToBottom) {
+            output.scrollTop = output.scrollHeight;
+        }
+    }
+
+    /**
+     * 清空日志显示
+     */
+    clearLogOutput() {
+        document.getElementById('logOutput').innerHTML = '';
+    }
+
     showToast(message, type = 'success') {
         // 移除现有的toast
         const existingToast = document.querySelector('.toast');
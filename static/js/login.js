@@ -6,6 +6,7 @@
 
     // 页面加载时检查会话状态
     checkSession();
+    checkSSO();
 
     // 绑定表单提交事件
     const form = document.getElementById('loginForm');
@@ -39,6 +40,37 @@
         }
     }
 
+    /**
+     * 检查是否启用SSO登录，并展示回调错误
+     */
+    async function checkSSO() {
+        const ssoErrors = {
+            denied: 'SSO 授权被拒绝',
+            state: 'SSO 登录已过期，请重试',
+            verify: 'SSO 身份校验失败',
+            forbidden: '当前账号未被授权访问管理面板',
+            session: '创建会话失败，请重试'
+        };
+        const params = new URLSearchParams(window.location.search);
+        const ssoError = params.get('sso_error');
+        if (ssoError) {
+            showError(ssoErrors[ssoError] || 'SSO 登录失败');
+        }
+
+        try {
+            const response = await fetch('/api/oidc/status');
+            if (response.ok) {
+                const data = await response.json();
+                const section = document.getElementById('ssoSection');
+                if (section && data.enabled) {
+                    section.style.display = 'block';
+                }
+            }
+        } catch (error) {
+            console.debug('SSO状态检查失败:', error);
+        }
+    }
+
     /**
      * 处理登录表单提交
      */
@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName 本服务埋点使用的 Tracer 名称
+const instrumentationName = "kiro2api"
+
+// defaultServiceName 未配置 OTEL_SERVICE_NAME 时的服务名
+const defaultServiceName = "kiro2api"
+
+// Enabled 根据标准 OTEL 环境变量判断是否启用链路追踪
+// - OTEL_SDK_DISABLED=true 时关闭
+// - OTEL_TRACES_EXPORTER=none 时关闭，=otlp 时启用
+// - 未指定导出器时，仅在配置了 OTEL_EXPORTER_OTLP_(TRACES_)ENDPOINT 时启用，避免默认向 localhost 发送数据
+func Enabled() bool {
+	if strings.EqualFold(strings.TrimSpace(os.Getenv("OTEL_SDK_DISABLED")), "true") {
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("OTEL_TRACES_EXPORTER"))) {
+	case "none":
+		return false
+	case "otlp":
+		return true
+	}
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// Init 初始化全局 TracerProvider（OTLP/HTTP 导出），未启用时保持默认的空实现
+// 导出地址、请求头、超时、采样等均由标准 OTEL 环境变量控制
+// （OTEL_EXPORTER_OTLP_*、OTEL_SERVICE_NAME、OTEL_RESOURCE_ATTRIBUTES、OTEL_TRACES_SAMPLER 等）
+// 返回的 shutdown 用于退出前刷新未导出的 span
+func Init(ctx context.Context, version string) (shutdown func(context.Context) error, err error) {
+	noop := func(context.Context) error { return nil }
+	if !Enabled() {
+		return noop, nil
+	}
+	if exporter := strings.ToLower(strings.TrimSpace(os.Getenv("OTEL_TRACES_EXPORTER"))); exporter != "" && exporter != "otlp" {
+		return noop, errors.New("仅支持 OTEL_TRACES_EXPORTER=otlp 或 none")
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return noop, err
+	}
+
+	serviceName := defaultServiceName
+	if name := strings.TrimSpace(os.Getenv("OTEL_SERVICE_NAME")); name != "" {
+		serviceName = name
+	}
+	// 后加载的检测器覆盖前者：OTEL_SERVICE_NAME / OTEL_RESOURCE_ATTRIBUTES 优先于默认值
+	res, err := resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(
+			attribute.String("service.name", serviceName),
+			attribute.String("service.version", version),
+		),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		return noop, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return provider.Shutdown, nil
+}
+
+// Tracer 返回本服务的 Tracer
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentationName)
+}
+
+// Start 创建子 span
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End 结束 span，err 非空时标记为错误
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// EndOnClose 包装响应体，在调用方关闭响应体时结束 span（用于覆盖流式读取的完整耗时）
+// span 未被采样时直接结束并返回原响应体
+func EndOnClose(body io.ReadCloser, span trace.Span) io.ReadCloser {
+	if !span.IsRecording() {
+		span.End()
+		return body
+	}
+	return &spanBody{ReadCloser: body, span: span}
+}
+
+// spanBody 关闭时结束 span 的响应体
+type spanBody struct {
+	io.ReadCloser
+	span  trace.Span
+	bytes int64
+	once  sync.Once
+}
+
+func (b *spanBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.bytes += int64(n)
+	return n, err
+}
+
+func (b *spanBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.span.SetAttributes(attribute.Int64("http.response.body.size", b.bytes))
+		b.span.End()
+	})
+	return err
+}
+
+// TraceID 返回上下文中 span 的 trace ID（未采样时返回空串）
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() || !sc.IsSampled() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
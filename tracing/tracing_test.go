@@ -0,0 +1,72 @@
+package tracing
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestEnabled(t *testing.T) {
+	t.Setenv("OTEL_SDK_DISABLED", "")
+	t.Setenv("OTEL_TRACES_EXPORTER", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+	t.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	assert.False(t, Enabled(), "未配置导出地址时默认关闭")
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318")
+	assert.True(t, Enabled())
+
+	t.Setenv("OTEL_TRACES_EXPORTER", "none")
+	assert.False(t, Enabled())
+
+	t.Setenv("OTEL_TRACES_EXPORTER", "otlp")
+	t.Setenv("OTEL_SDK_DISABLED", "true")
+	assert.False(t, Enabled())
+}
+
+func TestInit_Disabled(t *testing.T) {
+	t.Setenv("OTEL_SDK_DISABLED", "true")
+	shutdown, err := Init(context.Background(), "test")
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
+
+// useRecorder 将全局 TracerProvider 替换为内存记录器
+func useRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	original := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	t.Cleanup(func() { otel.SetTracerProvider(original) })
+	return recorder
+}
+
+func TestEndOnClose(t *testing.T) {
+	recorder := useRecorder(t)
+
+	ctx, span := Start(context.Background(), "upstream.http")
+	assert.NotEmpty(t, TraceID(ctx))
+	body := EndOnClose(io.NopCloser(strings.NewReader("hello")), span)
+
+	data, err := io.ReadAll(body)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	assert.Empty(t, recorder.Ended(), "读取期间 span 未结束")
+
+	require.NoError(t, body.Close())
+	require.NoError(t, body.Close())
+	ended := recorder.Ended()
+	require.Len(t, ended, 1)
+	assert.Equal(t, "upstream.http", ended[0].Name())
+	for _, attr := range ended[0].Attributes() {
+		if attr.Key == "http.response.body.size" {
+			assert.Equal(t, int64(5), attr.Value.AsInt64())
+		}
+	}
+}
@@ -2,9 +2,16 @@ package types
 
 // AnthropicTool 表示 Anthropic API 的工具结构
 type AnthropicTool struct {
-	Name        string         `json:"name"`
-	Description string         `json:"description"`
-	InputSchema map[string]any `json:"input_schema"`
+	Name         string         `json:"name"`
+	Description  string         `json:"description"`
+	InputSchema  map[string]any `json:"input_schema"`
+	CacheControl *CacheControl  `json:"cache_control,omitempty"`
+}
+
+// CacheControl 提示缓存断点标记（cache_control）
+type CacheControl struct {
+	Type string `json:"type"`          // 目前只有 "ephemeral"
+	TTL  string `json:"ttl,omitempty"` // "5m"（默认）或 "1h"
 }
 
 // ToolChoice 表示工具选择策略
@@ -24,6 +31,15 @@ type AnthropicRequest struct {
 	Stream      bool                      `json:"stream"`
 	Temperature *float64                  `json:"temperature,omitempty"`
 	Metadata    map[string]any            `json:"metadata,omitempty"`
+	Thinking    *AnthropicThinking        `json:"thinking,omitempty"`
+	// StopSequences 自定义停止序列，输出遇到任一序列即停止（不包含该序列）
+	StopSequences []string `json:"stop_sequences,omitempty"`
+}
+
+// AnthropicThinking 表示扩展思考配置
+type AnthropicThinking struct {
+	Type         string `json:"type"` // "enabled" 或 "disabled"
+	BudgetTokens int    `json:"budget_tokens,omitempty"`
 }
 
 // AnthropicStreamResponse 表示 Anthropic 流式响应的结构
@@ -50,8 +66,9 @@ type AnthropicRequestMessage struct {
 }
 
 type AnthropicSystemMessage struct {
-	Type string `json:"type"`
-	Text string `json:"text"` // 可以是 string 或 []ContentBlock
+	Type         string        `json:"type"`
+	Text         string        `json:"text"` // 可以是 string 或 []ContentBlock
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
 }
 
 // ContentBlock 表示消息内容块的结构
@@ -65,11 +82,14 @@ type ContentBlock struct {
 	ID        *string      `json:"id,omitempty"`       // tool_use的唯一标识符
 	IsError   *bool        `json:"is_error,omitempty"` // tool_result是否表示错误
 	Source    *ImageSource `json:"source,omitempty"`   // 图片数据源
+	// CacheControl 提示缓存断点标记
+	CacheControl *CacheControl `json:"cache_control,omitempty"`
 }
 
 // ImageSource 表示图片数据源的结构
 type ImageSource struct {
-	Type      string `json:"type"`       // "base64"
-	MediaType string `json:"media_type"` // "image/jpeg", "image/png", "image/gif", "image/webp"
-	Data      string `json:"data"`       // base64编码的图片数据
+	Type      string `json:"type"`          // "base64" 或 "url"
+	MediaType string `json:"media_type"`    // "image/jpeg", "image/png", "image/gif", "image/webp"
+	Data      string `json:"data"`          // base64编码的图片数据
+	URL       string `json:"url,omitempty"` // type为"url"时的图片地址，转换时下载为base64
 }
@@ -75,3 +75,18 @@ func NewModelNotFoundErrorType(model, requestId string) *ModelNotFoundErrorType
 		ErrorData: NewModelNotFoundError(model, requestId),
 	}
 }
+
+// InvalidImageError 图片输入无效（格式不支持、过大、下载失败等），属于客户端请求错误
+type InvalidImageError struct {
+	Err error
+}
+
+// Error 实现 error 接口
+func (e *InvalidImageError) Error() string {
+	return fmt.Sprintf("图片输入无效: %v", e.Err)
+}
+
+// Unwrap 返回原始错误
+func (e *InvalidImageError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,76 @@
+package types
+
+// Ollama API 兼容的数据结构（/api/chat、/api/tags）
+
+// OllamaChatRequest /api/chat 请求
+type OllamaChatRequest struct {
+	Model    string          `json:"model"`
+	Messages []OllamaMessage `json:"messages"`
+	Tools    []OpenAITool    `json:"tools,omitempty"` // 与 OpenAI tools 格式相同
+	// Stream 未设置时默认为 true（与 Ollama 一致）
+	Stream *bool `json:"stream,omitempty"`
+	// Format "json" 或 JSON Schema 对象，约束输出格式
+	Format  any            `json:"format,omitempty"`
+	Options *OllamaOptions `json:"options,omitempty"`
+	// Think 为 true 时开启思考，思考内容通过 message.thinking 返回
+	Think *bool `json:"think,omitempty"`
+}
+
+type OllamaMessage struct {
+	Role      string           `json:"role"` // system、user、assistant、tool
+	Content   string           `json:"content"`
+	Thinking  string           `json:"thinking,omitempty"`
+	Images    []string         `json:"images,omitempty"` // base64 编码的图片
+	ToolCalls []OllamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"` // role 为 tool 时对应的函数名
+}
+
+type OllamaToolCall struct {
+	Function OllamaToolCallFunction `json:"function"`
+}
+
+type OllamaToolCallFunction struct {
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments"`
+}
+
+// OllamaOptions 生成参数（只转换上游支持的部分）
+type OllamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	NumPredict  *int     `json:"num_predict,omitempty"` // 最大输出token数，-1 表示不限制
+	Stop        []string `json:"stop,omitempty"`
+}
+
+// OllamaChatResponse /api/chat 响应（流式时每行一个）
+type OllamaChatResponse struct {
+	Model     string        `json:"model"`
+	CreatedAt string        `json:"created_at"`
+	Message   OllamaMessage `json:"message"`
+	Done      bool          `json:"done"`
+	// 以下字段只在 done 为 true 时返回
+	DoneReason         string `json:"done_reason,omitempty"` // stop、length
+	TotalDuration      int64  `json:"total_duration,omitempty"`
+	LoadDuration       int64  `json:"load_duration,omitempty"`
+	PromptEvalCount    int    `json:"prompt_eval_count,omitempty"`
+	PromptEvalDuration int64  `json:"prompt_eval_duration,omitempty"`
+	EvalCount          int    `json:"eval_count,omitempty"`
+	EvalDuration       int64  `json:"eval_duration,omitempty"`
+}
+
+// OllamaModel /api/tags 中的模型条目
+type OllamaModel struct {
+	Name       string             `json:"name"`
+	Model      string             `json:"model"`
+	ModifiedAt string             `json:"modified_at"`
+	Size       int64              `json:"size"`
+	Digest     string             `json:"digest"`
+	Details    OllamaModelDetails `json:"details"`
+}
+
+type OllamaModelDetails struct {
+	Format            string   `json:"format"`
+	Family            string   `json:"family"`
+	Families          []string `json:"families"`
+	ParameterSize     string   `json:"parameter_size"`
+	QuantizationLevel string   `json:"quantization_level"`
+}
@@ -2,9 +2,10 @@ package types
 
 // OpenAI兼容的数据结构
 type OpenAIMessage struct {
-	Role      string           `json:"role"`
-	Content   any              `json:"content"` // 可以是 string 或 []ContentBlock
-	ToolCalls []OpenAIToolCall `json:"tool_calls,omitempty"`
+	Role             string           `json:"role"`
+	Content          any              `json:"content"` // 可以是 string 或 []ContentBlock
+	ReasoningContent string           `json:"reasoning_content,omitempty"`
+	ToolCalls        []OpenAIToolCall `json:"tool_calls,omitempty"`
 }
 
 type OpenAIToolCall struct {
@@ -48,6 +49,35 @@ type OpenAIRequest struct {
 	Stream      *bool           `json:"stream,omitempty"`
 	Tools       []OpenAITool    `json:"tools,omitempty"`
 	ToolChoice  any             `json:"tool_choice,omitempty"` // 可以是 "auto", "none", "required" 或 OpenAIToolChoice
+	// MaxCompletionTokens 新版输出上限参数，同时设置时优先于 max_tokens
+	MaxCompletionTokens *int `json:"max_completion_tokens,omitempty"`
+	// Stop 停止序列，可以是 string 或 []string（最多4个）
+	Stop any `json:"stop,omitempty"`
+	// ReasoningEffort 思考强度（minimal/low/medium/high），映射为思考预算
+	ReasoningEffort string `json:"reasoning_effort,omitempty"`
+	// StreamOptions 流式选项，include_usage 为 true 时在结束前追加用量块
+	StreamOptions *OpenAIStreamOptions `json:"stream_options,omitempty"`
+	// ResponseFormat 结构化输出要求（text、json_object 或 json_schema）
+	ResponseFormat *OpenAIResponseFormat `json:"response_format,omitempty"`
+}
+
+// OpenAIStreamOptions 表示 OpenAI 的 stream_options 参数
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// OpenAIResponseFormat 表示 OpenAI 的 response_format 参数
+type OpenAIResponseFormat struct {
+	Type       string            `json:"type"` // "text", "json_object", "json_schema"
+	JSONSchema *OpenAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+// OpenAIJSONSchema 表示 response_format.json_schema
+type OpenAIJSONSchema struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	Schema      map[string]any `json:"schema,omitempty"`
+	Strict      *bool          `json:"strict,omitempty"`
 }
 
 type OpenAIChoice struct {
@@ -64,3 +94,40 @@ type OpenAIResponse struct {
 	Choices []OpenAIChoice `json:"choices"`
 	Usage   Usage          `json:"usage"`
 }
+
+// OpenAICompletionRequest 旧版文本补全请求（POST /v1/completions）
+type OpenAICompletionRequest struct {
+	Model string `json:"model"`
+	// Prompt 提示文本，可以是 string 或只含一个字符串的数组
+	Prompt      any      `json:"prompt"`
+	MaxTokens   *int     `json:"max_tokens,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty"`
+	Stream      *bool    `json:"stream,omitempty"`
+	// Stop 停止序列，可以是 string 或 []string（最多4个）
+	Stop any `json:"stop,omitempty"`
+	// Echo 为 true 时在补全文本前回显提示
+	Echo bool `json:"echo,omitempty"`
+	// Suffix、N、BestOf、Logprobs 仅用于校验，不支持时返回400
+	Suffix        string               `json:"suffix,omitempty"`
+	N             *int                 `json:"n,omitempty"`
+	BestOf        *int                 `json:"best_of,omitempty"`
+	Logprobs      *int                 `json:"logprobs,omitempty"`
+	StreamOptions *OpenAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type OpenAICompletionChoice struct {
+	Text         string `json:"text"`
+	Index        int    `json:"index"`
+	Logprobs     any    `json:"logprobs"`
+	FinishReason string `json:"finish_reason"`
+}
+
+// OpenAICompletionResponse 旧版文本补全响应
+type OpenAICompletionResponse struct {
+	ID      string                   `json:"id"`
+	Object  string                   `json:"object"`
+	Created int64                    `json:"created"`
+	Model   string                   `json:"model"`
+	Choices []OpenAICompletionChoice `json:"choices"`
+	Usage   Usage                    `json:"usage"`
+}
@@ -2,6 +2,8 @@ package types
 
 import (
 	"time"
+
+	"kiro2api/config"
 )
 
 // Token 统一的token管理结构，合并了TokenInfo、RefreshResponse、RefreshRequest的功能
@@ -14,20 +16,42 @@ type Token struct {
 	// API响应字段
 	ExpiresIn  int    `json:"expiresIn,omitempty"`  // 多少秒后失效，来自RefreshResponse
 	ProfileArn string `json:"profileArn,omitempty"` // 来自RefreshResponse
+
+	// 所属认证配置（不序列化）
+	ConfigID  string `json:"-"` // 认证配置稳定ID，用于熔断器等按账号统计
+	ProxyURL  string `json:"-"` // 出站代理，推理与使用限制查询经此代理发出
+	SlotLease uint64 `json:"-"` // 选择token时预留的账号并发名额，发出上游请求时认领（0 表示未预留）
 }
 
 // FromRefreshResponse 从RefreshResponse创建Token
 func (t *Token) FromRefreshResponse(resp RefreshResponse, originalRefreshToken string) {
 	t.AccessToken = resp.AccessToken
-	t.RefreshToken = originalRefreshToken // 保持原始refresh token
+	t.RefreshToken = originalRefreshToken // 上游未轮换时保持原始refresh token
+	if resp.RefreshToken != "" {
+		t.RefreshToken = resp.RefreshToken
+	}
 	t.ExpiresIn = resp.ExpiresIn
 	t.ProfileArn = resp.ProfileArn
 	t.ExpiresAt = time.Now().Add(time.Duration(resp.ExpiresIn) * time.Second)
 }
 
-// IsExpired 检查token是否已过期
+// IsExpired 检查token是否已过期（含 config.TokenExpirySkew 提前量）
 func (t *Token) IsExpired() bool {
-	return time.Now().After(t.ExpiresAt)
+	return t.IsExpiredAt(time.Now(), config.TokenExpirySkew)
+}
+
+// IsExpiredAt 检查token在 now 时刻是否已过期，skew 为提前量
+// 同时使用单调时钟与墙上时钟判断，任一判定过期即视为过期：
+//   - 单调时钟不受NTP回拨影响，避免时钟回拨后继续使用实际已过期的token
+//   - 墙上时钟覆盖虚拟机暂停期间单调时钟停走的情况
+//
+// 墙上时钟前跳只会导致提前刷新，不会使用过期token
+func (t *Token) IsExpiredAt(now time.Time, skew time.Duration) bool {
+	deadline := t.ExpiresAt.Add(-skew)
+	if !now.Before(deadline) {
+		return true
+	}
+	return !now.Round(0).Before(deadline.Round(0))
 }
 
 // 兼容性别名 - 逐步迁移时使用
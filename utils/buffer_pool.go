@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"bytes"
+	"sync"
+)
+
+const (
+	// maxPooledBufferSize 超过该容量的缓冲区不放回池中，避免个别超大事件长期占用内存
+	maxPooledBufferSize = 64 * 1024
+	// StreamReadBufferSize 读取上游事件流的缓冲区大小
+	StreamReadBufferSize = 8 * 1024
+)
+
+// bufferPool 组装 SSE 事件、编码JSON等场景复用的 bytes.Buffer
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// readBufferPool 读取上游事件流的固定大小缓冲区
+var readBufferPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, StreamReadBufferSize)
+		return &buf
+	},
+}
+
+// GetBuffer 从池中取出一个已清空的缓冲区，用完后调用 PutBuffer 归还
+func GetBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+// PutBuffer 归还缓冲区；归还后调用方不能再持有其内容（包括 Bytes() 返回的切片）
+func PutBuffer(buf *bytes.Buffer) {
+	if buf == nil || buf.Cap() > maxPooledBufferSize {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// GetStreamReadBuffer 取出一个 StreamReadBufferSize 大小的读缓冲区，用完后调用 PutStreamReadBuffer 归还
+func GetStreamReadBuffer() *[]byte {
+	return readBufferPool.Get().(*[]byte)
+}
+
+// PutStreamReadBuffer 归还读缓冲区
+func PutStreamReadBuffer(buf *[]byte) {
+	if buf == nil || len(*buf) != StreamReadBufferSize {
+		return
+	}
+	readBufferPool.Put(buf)
+}
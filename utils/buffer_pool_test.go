@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBufferPool(t *testing.T) {
+	buf := GetBuffer()
+	buf.WriteString("stale")
+	PutBuffer(buf)
+	assert.Zero(t, GetBuffer().Len(), "取出的缓冲区总是空的")
+
+	// 超大缓冲区不放回池中（sync.Pool 不保证复用，这里只验证不会panic且取出的是空缓冲区）
+	big := bytes.NewBuffer(make([]byte, 0, maxPooledBufferSize+1))
+	PutBuffer(big)
+	PutBuffer(nil)
+	assert.Zero(t, GetBuffer().Len())
+
+	read := GetStreamReadBuffer()
+	require.Len(t, *read, StreamReadBufferSize)
+	PutStreamReadBuffer(read)
+	short := make([]byte, 16)
+	PutStreamReadBuffer(&short)
+	assert.Len(t, *GetStreamReadBuffer(), StreamReadBufferSize, "长度不符的缓冲区不放回")
+}
+
+func TestAppendJSON(t *testing.T) {
+	buf := GetBuffer()
+	defer PutBuffer(buf)
+	buf.WriteString("data: ")
+	require.NoError(t, AppendJSON(buf, map[string]any{"text": "<b>", "n": 1}))
+
+	expected, err := FastMarshal(map[string]any{"text": "<b>", "n": 1})
+	require.NoError(t, err)
+	assert.Equal(t, "data: "+string(expected), buf.String(), "与 FastMarshal 输出一致且不含结尾换行")
+
+	assert.Error(t, AppendJSON(buf, make(chan int)))
+}
@@ -2,54 +2,198 @@ package utils
 
 import (
 	"crypto/tls"
+	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"sync"
 	"time"
 
 	"kiro2api/config"
 )
 
 var (
-	// SharedHTTPClient 共享的HTTP客户端实例，优化了连接池和性能配置
-	SharedHTTPClient *http.Client
+	// SharedHTTPClient 共享的HTTP客户端实例，所有上游请求复用同一个 Transport（连接池）
+	// 指针在进程内保持不变，ConfigureUpstreamClient 只替换其 Transport
+	SharedHTTPClient = &http.Client{}
+
+	// sharedTransport 共享的底层 Transport，按代理出站的客户端基于它复制
+	sharedTransport *http.Transport
+
+	// upstreamClientConfig 当前生效的上游客户端配置
+	upstreamClientMu     sync.RWMutex
+	upstreamClientConfig UpstreamClientConfig
 )
 
+// UpstreamClientConfig 上游HTTP客户端的连接池、HTTP/2 与 TLS 会话复用配置
+type UpstreamClientConfig struct {
+	HTTP2               bool          // 是否尝试 HTTP/2（ALPN 协商，不支持时回退 HTTP/1.1）
+	MaxIdleConns        int           // 所有主机的空闲连接总数上限
+	MaxIdleConnsPerHost int           // 每个主机保留的空闲连接数
+	MaxConnsPerHost     int           // 每个主机的连接总数上限，0 不限制
+	IdleConnTimeout     time.Duration // 空闲连接保留时长
+	ConnectTimeout      time.Duration // 连接建立超时
+	KeepAlive           time.Duration // TCP keep-alive 探测间隔
+	TLSHandshakeTimeout time.Duration // TLS 握手超时
+	TLSSessionCacheSize int           // TLS 会话缓存条目数（会话复用，省去完整握手），0 关闭
+	FirstByteTimeout    time.Duration // 响应头（首字节）超时，0 不限制
+}
+
+// DefaultUpstreamClientConfig 默认上游客户端配置
+func DefaultUpstreamClientConfig() UpstreamClientConfig {
+	return UpstreamClientConfig{
+		HTTP2:               true,
+		MaxIdleConns:        100,
+		MaxIdleConnsPerHost: 20,
+		IdleConnTimeout:     90 * time.Second,
+		ConnectTimeout:      15 * time.Second,
+		KeepAlive:           config.HTTPClientKeepAlive,
+		TLSHandshakeTimeout: config.HTTPClientTLSHandshakeTimeout,
+		TLSSessionCacheSize: 64,
+		FirstByteTimeout:    120 * time.Second,
+	}
+}
+
+// LoadUpstreamClientConfigFromEnv 从环境变量加载上游客户端配置
+// - UPSTREAM_HTTP2: 是否尝试 HTTP/2（默认true）
+// - UPSTREAM_MAX_IDLE_CONNS: 空闲连接总数上限（默认100）
+// - UPSTREAM_MAX_IDLE_CONNS_PER_HOST: 每个主机的空闲连接数（默认20）
+// - UPSTREAM_MAX_CONNS_PER_HOST: 每个主机的连接总数上限（默认0，不限制）
+// - UPSTREAM_IDLE_CONN_TIMEOUT_SECONDS: 空闲连接保留时长（默认90）
+// - UPSTREAM_CONNECT_TIMEOUT_SECONDS: 连接建立超时（默认15）
+// - UPSTREAM_KEEPALIVE_SECONDS: TCP keep-alive 间隔（默认30）
+// - UPSTREAM_TLS_HANDSHAKE_TIMEOUT_SECONDS: TLS 握手超时（默认15）
+// - UPSTREAM_TLS_SESSION_CACHE_SIZE: TLS 会话缓存条目数（默认64，0 关闭会话复用）
+// - UPSTREAM_FIRST_BYTE_TIMEOUT_SECONDS: 首字节超时（默认120，0 不限制）
+func LoadUpstreamClientConfigFromEnv() (UpstreamClientConfig, error) {
+	def := DefaultUpstreamClientConfig()
+	seconds := func(key string, d time.Duration) time.Duration {
+		return time.Duration(GetEnvIntWithDefault(key, int(d/time.Second))) * time.Second
+	}
+	cfg := UpstreamClientConfig{
+		HTTP2:               GetEnvBoolWithDefault("UPSTREAM_HTTP2", def.HTTP2),
+		MaxIdleConns:        GetEnvIntWithDefault("UPSTREAM_MAX_IDLE_CONNS", def.MaxIdleConns),
+		MaxIdleConnsPerHost: GetEnvIntWithDefault("UPSTREAM_MAX_IDLE_CONNS_PER_HOST", def.MaxIdleConnsPerHost),
+		MaxConnsPerHost:     GetEnvIntWithDefault("UPSTREAM_MAX_CONNS_PER_HOST", def.MaxConnsPerHost),
+		IdleConnTimeout:     seconds("UPSTREAM_IDLE_CONN_TIMEOUT_SECONDS", def.IdleConnTimeout),
+		ConnectTimeout:      seconds("UPSTREAM_CONNECT_TIMEOUT_SECONDS", def.ConnectTimeout),
+		KeepAlive:           seconds("UPSTREAM_KEEPALIVE_SECONDS", def.KeepAlive),
+		TLSHandshakeTimeout: seconds("UPSTREAM_TLS_HANDSHAKE_TIMEOUT_SECONDS", def.TLSHandshakeTimeout),
+		TLSSessionCacheSize: GetEnvIntWithDefault("UPSTREAM_TLS_SESSION_CACHE_SIZE", def.TLSSessionCacheSize),
+		FirstByteTimeout:    seconds("UPSTREAM_FIRST_BYTE_TIMEOUT_SECONDS", def.FirstByteTimeout),
+	}
+
+	switch {
+	case cfg.MaxIdleConns < 0 || cfg.MaxIdleConnsPerHost < 0 || cfg.MaxConnsPerHost < 0:
+		return UpstreamClientConfig{}, fmt.Errorf("UPSTREAM_MAX_*_CONNS* 不能为负数")
+	case cfg.MaxIdleConns > 0 && cfg.MaxIdleConnsPerHost > cfg.MaxIdleConns:
+		return UpstreamClientConfig{}, fmt.Errorf("UPSTREAM_MAX_IDLE_CONNS_PER_HOST (%d) 不能大于 UPSTREAM_MAX_IDLE_CONNS (%d)",
+			cfg.MaxIdleConnsPerHost, cfg.MaxIdleConns)
+	case cfg.MaxConnsPerHost > 0 && cfg.MaxIdleConnsPerHost > cfg.MaxConnsPerHost:
+		return UpstreamClientConfig{}, fmt.Errorf("UPSTREAM_MAX_IDLE_CONNS_PER_HOST (%d) 不能大于 UPSTREAM_MAX_CONNS_PER_HOST (%d)",
+			cfg.MaxIdleConnsPerHost, cfg.MaxConnsPerHost)
+	case cfg.ConnectTimeout <= 0:
+		return UpstreamClientConfig{}, fmt.Errorf("UPSTREAM_CONNECT_TIMEOUT_SECONDS 必须大于0")
+	case cfg.TLSHandshakeTimeout <= 0:
+		return UpstreamClientConfig{}, fmt.Errorf("UPSTREAM_TLS_HANDSHAKE_TIMEOUT_SECONDS 必须大于0")
+	case cfg.IdleConnTimeout < 0 || cfg.KeepAlive < 0 || cfg.FirstByteTimeout < 0:
+		return UpstreamClientConfig{}, fmt.Errorf("UPSTREAM_*_SECONDS 不能为负数")
+	case cfg.TLSSessionCacheSize < 0:
+		return UpstreamClientConfig{}, fmt.Errorf("UPSTREAM_TLS_SESSION_CACHE_SIZE 不能为负数")
+	}
+	return cfg, nil
+}
+
 func init() {
 	// 检查TLS配置并记录日志
-	skipTLS := shouldSkipTLSVerify()
-	if skipTLS {
+	if shouldSkipTLSVerify() {
 		os.Stderr.WriteString("[WARNING] TLS证书验证已禁用 - 仅适用于开发/调试环境\n")
 	}
+	// init 时 .env 尚未加载，先按默认配置创建，启动时由 ConfigureUpstreamClient 按环境变量重建
+	ConfigureUpstreamClient(DefaultUpstreamClientConfig())
+}
 
-	// 创建统一的HTTP客户端
-	SharedHTTPClient = &http.Client{
-		Transport: &http.Transport{
-			// 连接建立配置
-			DialContext: (&net.Dialer{
-				Timeout:   15 * time.Second,
-				KeepAlive: config.HTTPClientKeepAlive,
-				DualStack: true,
-			}).DialContext,
-
-			// TLS配置
-			TLSHandshakeTimeout: config.HTTPClientTLSHandshakeTimeout,
-			TLSClientConfig: &tls.Config{
-				InsecureSkipVerify: skipTLS,
-				MinVersion:         tls.VersionTLS12,
-				MaxVersion:         tls.VersionTLS13,
-				CipherSuites: []uint16{
-					tls.TLS_AES_256_GCM_SHA384,
-					tls.TLS_CHACHA20_POLY1305_SHA256,
-					tls.TLS_AES_128_GCM_SHA256,
-				},
-			},
-
-			// HTTP配置
-			ForceAttemptHTTP2:  false,
-			DisableCompression: false,
+// ConfigureUpstreamClient 按配置重建共享 Transport，并清空按代理缓存的客户端
+// 应在开始处理请求前调用；旧 Transport 的空闲连接会被关闭
+func ConfigureUpstreamClient(cfg UpstreamClientConfig) {
+	transport := newUpstreamTransport(cfg)
+
+	upstreamClientMu.Lock()
+	old := sharedTransport
+	sharedTransport = transport
+	upstreamClientConfig = cfg
+	SharedHTTPClient.Transport = &instrumentedTransport{base: transport}
+	upstreamClientMu.Unlock()
+
+	resetProxyClients()
+	if old != nil {
+		old.CloseIdleConnections()
+	}
+}
+
+// CurrentUpstreamClientConfig 当前生效的上游客户端配置
+func CurrentUpstreamClientConfig() UpstreamClientConfig {
+	upstreamClientMu.RLock()
+	defer upstreamClientMu.RUnlock()
+	return upstreamClientConfig
+}
+
+// newUpstreamTransport 创建上游 Transport：显式连接池、HTTP/2 协商与 TLS 会话复用
+func newUpstreamTransport(cfg UpstreamClientConfig) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   cfg.ConnectTimeout,
+		KeepAlive: cfg.KeepAlive,
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: shouldSkipTLSVerify(),
+		MinVersion:         tls.VersionTLS12,
+		MaxVersion:         tls.VersionTLS13,
+		CipherSuites: []uint16{
+			tls.TLS_AES_256_GCM_SHA384,
+			tls.TLS_CHACHA20_POLY1305_SHA256,
+			tls.TLS_AES_128_GCM_SHA256,
 		},
 	}
+	if cfg.TLSSessionCacheSize > 0 {
+		tlsConfig.ClientSessionCache = tls.NewLRUClientSessionCache(cfg.TLSSessionCacheSize)
+	}
+
+	transport := &http.Transport{
+		DialContext: instrumentDial(dialer.DialContext),
+
+		// 连接池
+		MaxIdleConns:        cfg.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.MaxIdleConnsPerHost,
+		MaxConnsPerHost:     cfg.MaxConnsPerHost,
+		IdleConnTimeout:     cfg.IdleConnTimeout,
+
+		// 首字节超时：上游在该时间内未返回响应头视为挂起，避免协程被无限占用
+		ResponseHeaderTimeout: cfg.FirstByteTimeout,
+
+		// TLS配置
+		TLSHandshakeTimeout: cfg.TLSHandshakeTimeout,
+		TLSClientConfig:     tlsConfig,
+
+		// HTTP配置：自定义 DialContext/TLSClientConfig 时需显式开启 HTTP/2 尝试
+		ForceAttemptHTTP2:  cfg.HTTP2,
+		DisableCompression: false,
+	}
+	if !cfg.HTTP2 {
+		// 非 nil 的空 map 禁用 HTTP/2 升级
+		transport.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+	}
+	return transport
+}
+
+// UpstreamConnectTimeout 当前生效的上游连接建立超时
+func UpstreamConnectTimeout() time.Duration {
+	return CurrentUpstreamClientConfig().ConnectTimeout
+}
+
+// UpstreamFirstByteTimeout 当前生效的上游响应头（首字节）超时，0 不限制
+func UpstreamFirstByteTimeout() time.Duration {
+	return CurrentUpstreamClientConfig().FirstByteTimeout
 }
 
 // shouldSkipTLSVerify 根据GIN_MODE决定是否跳过TLS证书验证
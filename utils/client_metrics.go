@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+)
+
+// upstreamPoolMetrics 上游连接池计数（所有上游 Transport 共用，包括按代理出站的客户端）
+var upstreamPoolMetrics struct {
+	requests    atomic.Int64 // 发出的请求数
+	inFlight    atomic.Int64 // 尚未读完响应体的请求数
+	reusedConns atomic.Int64 // 复用连接池中已有连接的请求数
+	newConns    atomic.Int64 // 使用新建连接的请求数
+	http2       atomic.Int64 // 以 HTTP/2 完成的请求数
+	dials       atomic.Int64 // 建立的 TCP 连接数
+	dialErrors  atomic.Int64 // 建立 TCP 连接失败次数
+	openConns   atomic.Int64 // 当前打开的 TCP 连接数
+	tlsResumed  atomic.Int64 // 通过 TLS 会话复用完成握手的连接数
+}
+
+// UpstreamPoolStats 上游连接池统计快照
+type UpstreamPoolStats struct {
+	Requests    int64   `json:"requests"`
+	InFlight    int64   `json:"in_flight"`
+	ReusedConns int64   `json:"reused_conns"`
+	NewConns    int64   `json:"new_conns"`
+	ReuseRatio  float64 `json:"reuse_ratio"`
+	HTTP2       int64   `json:"http2_requests"`
+	Dials       int64   `json:"dials"`
+	DialErrors  int64   `json:"dial_errors"`
+	OpenConns   int64   `json:"open_conns"`
+	TLSResumed  int64   `json:"tls_resumed"`
+}
+
+// GetUpstreamPoolStats 返回上游连接池统计
+func GetUpstreamPoolStats() UpstreamPoolStats {
+	m := &upstreamPoolMetrics
+	stats := UpstreamPoolStats{
+		Requests:    m.requests.Load(),
+		InFlight:    m.inFlight.Load(),
+		ReusedConns: m.reusedConns.Load(),
+		NewConns:    m.newConns.Load(),
+		HTTP2:       m.http2.Load(),
+		Dials:       m.dials.Load(),
+		DialErrors:  m.dialErrors.Load(),
+		OpenConns:   m.openConns.Load(),
+		TLSResumed:  m.tlsResumed.Load(),
+	}
+	if total := stats.ReusedConns + stats.NewConns; total > 0 {
+		stats.ReuseRatio = float64(stats.ReusedConns) / float64(total)
+	}
+	return stats
+}
+
+// instrumentDial 包装 DialContext，统计建立的连接数、失败次数与当前打开的连接数
+func instrumentDial(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			upstreamPoolMetrics.dialErrors.Add(1)
+			return nil, err
+		}
+		upstreamPoolMetrics.dials.Add(1)
+		upstreamPoolMetrics.openConns.Add(1)
+		return &countedConn{Conn: conn}, nil
+	}
+}
+
+// countedConn 关闭时减少打开的连接数（只计一次）
+type countedConn struct {
+	net.Conn
+	closeOnce sync.Once
+}
+
+func (c *countedConn) Close() error {
+	c.closeOnce.Do(func() { upstreamPoolMetrics.openConns.Add(-1) })
+	return c.Conn.Close()
+}
+
+// instrumentedTransport 通过 httptrace 统计连接复用、HTTP/2 与进行中的请求
+type instrumentedTransport struct {
+	base *http.Transport
+}
+
+func (t *instrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	m := &upstreamPoolMetrics
+	m.requests.Add(1)
+	m.inFlight.Add(1)
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				m.reusedConns.Add(1)
+			} else {
+				m.newConns.Add(1)
+			}
+		},
+		TLSHandshakeDone: func(state tls.ConnectionState, err error) {
+			if err == nil && state.DidResume {
+				m.tlsResumed.Add(1)
+			}
+		},
+	}
+	ctx := httptrace.WithClientTrace(req.Context(), trace)
+
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		m.inFlight.Add(-1)
+		return nil, err
+	}
+	if resp.ProtoMajor == 2 {
+		m.http2.Add(1)
+	}
+	resp.Body = &inFlightBody{ReadCloser: resp.Body}
+	return resp, nil
+}
+
+// CloseIdleConnections 供 http.Client.CloseIdleConnections 调用
+func (t *instrumentedTransport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+}
+
+// inFlightBody 响应体关闭时结束进行中的请求计数（只计一次）
+type inFlightBody struct {
+	io.ReadCloser
+	closeOnce sync.Once
+}
+
+func (b *inFlightBody) Close() error {
+	b.closeOnce.Do(func() { upstreamPoolMetrics.inFlight.Add(-1) })
+	return b.ReadCloser.Close()
+}
@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestUpstreamClient 基于 newUpstreamTransport 创建客户端，并信任测试服务器的证书
+func newTestUpstreamClient(t *testing.T, cfg UpstreamClientConfig, srv *httptest.Server) *http.Client {
+	transport := newUpstreamTransport(cfg)
+	if srv.Certificate() != nil {
+		pool := x509.NewCertPool()
+		pool.AddCert(srv.Certificate())
+		transport.TLSClientConfig.RootCAs = pool
+	}
+	t.Cleanup(transport.CloseIdleConnections)
+	return &http.Client{Transport: &instrumentedTransport{base: transport}}
+}
+
+func getAndDrain(t *testing.T, client *http.Client, url string) *http.Response {
+	resp, err := client.Get(url)
+	require.NoError(t, err)
+	_, _ = io.Copy(io.Discard, resp.Body)
+	require.NoError(t, resp.Body.Close())
+	return resp
+}
+
+func TestUpstreamClient_ReusesConnectionsAndNegotiatesHTTP2(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	before := GetUpstreamPoolStats()
+	client := newTestUpstreamClient(t, DefaultUpstreamClientConfig(), srv)
+	for range 3 {
+		resp := getAndDrain(t, client, srv.URL)
+		assert.Equal(t, 2, resp.ProtoMajor)
+	}
+
+	after := GetUpstreamPoolStats()
+	assert.Equal(t, int64(3), after.Requests-before.Requests)
+	assert.Equal(t, int64(1), after.NewConns-before.NewConns, "HTTP/2 多路复用同一连接")
+	assert.Equal(t, int64(2), after.ReusedConns-before.ReusedConns)
+	assert.Equal(t, int64(3), after.HTTP2-before.HTTP2)
+	assert.Equal(t, int64(1), after.Dials-before.Dials)
+	assert.Equal(t, before.InFlight, after.InFlight, "响应体关闭后不再计入进行中")
+}
+
+func TestUpstreamClient_HTTP2Disabled(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	cfg := DefaultUpstreamClientConfig()
+	cfg.HTTP2 = false
+	client := newTestUpstreamClient(t, cfg, srv)
+	assert.Equal(t, 1, getAndDrain(t, client, srv.URL).ProtoMajor)
+}
+
+func TestUpstreamClient_TLSSessionResumption(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	before := GetUpstreamPoolStats()
+	client := newTestUpstreamClient(t, DefaultUpstreamClientConfig(), srv)
+	getAndDrain(t, client, srv.URL)
+	client.CloseIdleConnections() // 强制下一次请求重新握手
+	getAndDrain(t, client, srv.URL)
+
+	after := GetUpstreamPoolStats()
+	assert.Equal(t, int64(2), after.NewConns-before.NewConns)
+	assert.Equal(t, int64(1), after.TLSResumed-before.TLSResumed, "第二次握手复用 TLS 会话")
+}
+
+func TestLoadUpstreamClientConfigFromEnv(t *testing.T) {
+	cfg, err := LoadUpstreamClientConfigFromEnv()
+	require.NoError(t, err)
+	assert.Equal(t, DefaultUpstreamClientConfig(), cfg)
+
+	t.Setenv("UPSTREAM_MAX_IDLE_CONNS", "10")
+	t.Setenv("UPSTREAM_MAX_IDLE_CONNS_PER_HOST", "20")
+	_, err = LoadUpstreamClientConfigFromEnv()
+	assert.Error(t, err)
+
+	t.Setenv("UPSTREAM_MAX_IDLE_CONNS_PER_HOST", "5")
+	t.Setenv("UPSTREAM_CONNECT_TIMEOUT_SECONDS", "0")
+	_, err = LoadUpstreamClientConfigFromEnv()
+	assert.Error(t, err)
+}
+
+func TestConfigureUpstreamClient_ResetsProxyClients(t *testing.T) {
+	t.Cleanup(func() { ConfigureUpstreamClient(DefaultUpstreamClientConfig()) })
+
+	shared := SharedHTTPClient
+	before, err := HTTPClientForProxy("http://127.0.0.1:18081")
+	require.NoError(t, err)
+
+	cfg := DefaultUpstreamClientConfig()
+	cfg.MaxIdleConnsPerHost = 5
+	ConfigureUpstreamClient(cfg)
+
+	assert.Same(t, shared, SharedHTTPClient, "共享客户端指针保持不变")
+	assert.Equal(t, 5, CurrentUpstreamClientConfig().MaxIdleConnsPerHost)
+	after, err := HTTPClientForProxy("http://127.0.0.1:18081")
+	require.NoError(t, err)
+	assert.NotSame(t, before, after, "重建后按新配置创建代理客户端")
+	assert.Equal(t, 5, after.Transport.(*instrumentedTransport).base.MaxIdleConnsPerHost)
+}
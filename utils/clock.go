@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"sync"
+	"time"
+
+	"kiro2api/logger"
+)
+
+// ClockJump 一次检测到的时钟跳变
+type ClockJump struct {
+	DetectedAt time.Time     `json:"detected_at"`
+	Drift      time.Duration `json:"drift"` // 墙上时钟相对单调时钟的偏移，正数表示前跳
+}
+
+// ClockDrift 计算两次采样之间墙上时钟相对单调时钟的偏移
+// prev 和 now 都必须是 time.Now() 的返回值（携带单调时钟读数）
+func ClockDrift(prev, now time.Time) time.Duration {
+	wallElapsed := now.Round(0).Sub(prev.Round(0))
+	monoElapsed := now.Sub(prev)
+	return wallElapsed - monoElapsed
+}
+
+// ClockMonitor 定期比较墙上时钟与单调时钟，检测NTP校正、虚拟机暂停/恢复等导致的时钟跳变
+type ClockMonitor struct {
+	mu        sync.RWMutex
+	interval  time.Duration
+	threshold time.Duration
+	handlers  []func(ClockJump)
+	lastJump  *ClockJump
+	jumpCount int
+	stop      chan struct{}
+	stopOnce  sync.Once
+}
+
+// NewClockMonitor 创建时钟跳变监视器
+func NewClockMonitor(interval, threshold time.Duration) *ClockMonitor {
+	return &ClockMonitor{
+		interval:  interval,
+		threshold: threshold,
+		stop:      make(chan struct{}),
+	}
+}
+
+// OnJump 注册时钟跳变回调（需在 Start 之前注册）
+func (m *ClockMonitor) OnJump(handler func(ClockJump)) {
+	m.mu.Lock()
+	m.handlers = append(m.handlers, handler)
+	m.mu.Unlock()
+}
+
+// Start 启动后台检测
+func (m *ClockMonitor) Start() {
+	go m.loop()
+	logger.Info("时钟跳变检测已启动",
+		logger.String("interval", m.interval.String()),
+		logger.String("threshold", m.threshold.String()))
+}
+
+// Stop 停止后台检测
+func (m *ClockMonitor) Stop() {
+	m.stopOnce.Do(func() { close(m.stop) })
+}
+
+// LastJump 返回最近一次检测到的跳变及累计次数
+func (m *ClockMonitor) LastJump() (*ClockJump, int) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.lastJump == nil {
+		return nil, m.jumpCount
+	}
+	jump := *m.lastJump
+	return &jump, m.jumpCount
+}
+
+func (m *ClockMonitor) loop() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	prev := time.Now()
+	for {
+		select {
+		case <-ticker.C:
+			now := time.Now()
+			m.evaluate(ClockDrift(prev, now), now)
+			prev = now
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// evaluate 偏移超过阈值时记录并通知回调
+func (m *ClockMonitor) evaluate(drift time.Duration, now time.Time) bool {
+	if drift < m.threshold && drift > -m.threshold {
+		return false
+	}
+
+	jump := ClockJump{DetectedAt: now, Drift: drift}
+	m.mu.Lock()
+	m.lastJump = &jump
+	m.jumpCount++
+	handlers := make([]func(ClockJump), len(m.handlers))
+	copy(handlers, m.handlers)
+	m.mu.Unlock()
+
+	logger.Warn("检测到系统时钟跳变",
+		logger.String("drift", drift.String()),
+		logger.String("wall_time", now.Round(0).Format(time.RFC3339)))
+
+	for _, handler := range handlers {
+		handler(jump)
+	}
+	return true
+}
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClockDrift_NoJump(t *testing.T) {
+	prev := time.Now()
+	now := time.Now()
+	assert.Less(t, ClockDrift(prev, now).Abs(), time.Millisecond)
+}
+
+func TestClockDrift_WithoutMonotonic(t *testing.T) {
+	// 无单调时钟读数时两种差值一致，偏移为0
+	prev := time.Now().Round(0)
+	assert.Equal(t, time.Duration(0), ClockDrift(prev, prev.Add(time.Hour)))
+}
+
+func TestClockMonitor_Evaluate(t *testing.T) {
+	m := NewClockMonitor(time.Second, 30*time.Second)
+	var got []ClockJump
+	m.OnJump(func(j ClockJump) { got = append(got, j) })
+
+	assert.False(t, m.evaluate(10*time.Second, time.Now()))
+	assert.False(t, m.evaluate(-10*time.Second, time.Now()))
+	jump, count := m.LastJump()
+	assert.Nil(t, jump)
+	assert.Equal(t, 0, count)
+
+	assert.True(t, m.evaluate(time.Hour, time.Now()))
+	assert.True(t, m.evaluate(-time.Minute, time.Now()))
+
+	jump, count = m.LastJump()
+	require.NotNil(t, jump)
+	assert.Equal(t, 2, count)
+	assert.Equal(t, -time.Minute, jump.Drift)
+	require.Len(t, got, 2)
+	assert.Equal(t, time.Hour, got[0].Drift)
+}
@@ -64,3 +64,13 @@ func GetEnvIntWithDefault(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+// GetEnvFloatWithDefault 获取浮点类型环境变量（带默认值）
+func GetEnvFloatWithDefault(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if floatValue, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+			return floatValue
+		}
+	}
+	return defaultValue
+}
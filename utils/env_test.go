@@ -139,3 +139,15 @@ func TestMultipleEnvChecks(t *testing.T) {
 
 	assert.True(t, IsDebugMode()) // DEBUG=true 优先级最高
 }
+
+func TestGetEnvFloatWithDefault(t *testing.T) {
+	os.Setenv("TEST_FLOAT", " 0.5 ")
+	defer os.Unsetenv("TEST_FLOAT")
+	assert.Equal(t, 0.5, GetEnvFloatWithDefault("TEST_FLOAT", 2))
+
+	os.Setenv("TEST_FLOAT", "abc")
+	assert.Equal(t, 2.0, GetEnvFloatWithDefault("TEST_FLOAT", 2))
+
+	os.Unsetenv("TEST_FLOAT")
+	assert.Equal(t, 2.0, GetEnvFloatWithDefault("TEST_FLOAT", 2))
+}
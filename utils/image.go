@@ -2,9 +2,17 @@ package utils
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
 	"regexp"
 	"strings"
+	"syscall"
+	"time"
 
 	"kiro2api/types"
 )
@@ -203,9 +211,14 @@ func ConvertImageURLToImageSource(imageURL map[string]any) (*types.ImageSource,
 		return nil, fmt.Errorf("image_url的url字段必须是字符串")
 	}
 
+	// http(s) 图片按需下载
+	if IsRemoteImageURL(urlStr) {
+		return FetchImageSource(urlStr)
+	}
+
 	// 检查是否是data URL
 	if !strings.HasPrefix(urlStr, "data:") {
-		return nil, fmt.Errorf("目前仅支持data URL格式的图片")
+		return nil, fmt.Errorf("仅支持data URL或http(s)图片地址")
 	}
 
 	// 解析data URL
@@ -220,3 +233,130 @@ func ConvertImageURLToImageSource(imageURL map[string]any) (*types.ImageSource,
 		Data:      base64Data,
 	}, nil
 }
+
+// 图片URL下载配置：每次下载时读取环境变量，.env 与配置文件在包初始化之后才加载
+
+// imageFetchEnabled 是否允许下载 http(s) 图片（IMAGE_URL_FETCH，默认开启）
+func imageFetchEnabled() bool {
+	return GetEnvBoolWithDefault("IMAGE_URL_FETCH", true)
+}
+
+// imageFetchTimeout 单张图片下载超时（IMAGE_FETCH_TIMEOUT_SECONDS，默认15秒）
+func imageFetchTimeout() time.Duration {
+	return time.Duration(GetEnvIntWithDefault("IMAGE_FETCH_TIMEOUT_SECONDS", 15)) * time.Second
+}
+
+// imageFetchAllowPrivate 是否允许访问内网地址（IMAGE_FETCH_ALLOW_PRIVATE，默认禁止，防止SSRF）
+func imageFetchAllowPrivate() bool {
+	return GetEnvBool("IMAGE_FETCH_ALLOW_PRIVATE")
+}
+
+// maxImageFetchRedirects 图片下载允许的最大重定向次数
+const maxImageFetchRedirects = 3
+
+// errPrivateImageHost 图片地址解析到内网时返回的错误
+var errPrivateImageHost = errors.New("不允许访问内网地址")
+
+// IsRemoteImageURL 判断是否为需要下载的 http(s) 图片地址
+func IsRemoteImageURL(raw string) bool {
+	lower := strings.ToLower(raw)
+	return strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")
+}
+
+// isPublicIP 判断是否为公网地址
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	// 100.64.0.0/10 运营商级NAT
+	if ip4 := ip.To4(); ip4 != nil && ip4[0] == 100 && ip4[1]&0xC0 == 64 {
+		return false
+	}
+	return true
+}
+
+// imageFetchClient 构建图片下载客户端：限制重定向次数，并在建立连接时校验实际IP（防DNS重绑定）
+func imageFetchClient() *http.Client {
+	timeout := imageFetchTimeout()
+	dialer := &net.Dialer{Timeout: timeout}
+	if !imageFetchAllowPrivate() {
+		dialer.Control = func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("%w: %s", errPrivateImageHost, host)
+			}
+			return nil
+		}
+	}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxImageFetchRedirects {
+				return fmt.Errorf("重定向次数过多")
+			}
+			if !IsRemoteImageURL(req.URL.String()) {
+				return fmt.Errorf("不支持的重定向地址: %s", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// FetchImageSource 下载 http(s) 图片并转换为 base64 ImageSource
+// 校验大小（MaxImageSize）与格式（以文件头识别为准）
+func FetchImageSource(rawURL string) (*types.ImageSource, error) {
+	if !imageFetchEnabled() {
+		return nil, fmt.Errorf("未启用图片URL下载（IMAGE_URL_FETCH=false），请使用base64或data URL")
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" || !IsRemoteImageURL(rawURL) {
+		return nil, fmt.Errorf("无效的图片地址: %s", rawURL)
+	}
+
+	resp, err := imageFetchClient().Get(parsed.String())
+	if err != nil {
+		if errors.Is(err, errPrivateImageHost) {
+			return nil, fmt.Errorf("下载图片失败: %w", errPrivateImageHost)
+		}
+		return nil, fmt.Errorf("下载图片失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("下载图片失败: HTTP %d", resp.StatusCode)
+	}
+	if resp.ContentLength > MaxImageSize {
+		return nil, fmt.Errorf("图片数据过大: %d 字节，最大支持 %d 字节", resp.ContentLength, MaxImageSize)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, MaxImageSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("读取图片失败: %v", err)
+	}
+	if len(data) > MaxImageSize {
+		return nil, fmt.Errorf("图片数据过大，最大支持 %d 字节", MaxImageSize)
+	}
+
+	// 以文件头识别格式，响应声明的 Content-Type 仅用于错误提示
+	mediaType, err := DetectImageFormat(data)
+	if err != nil {
+		declared, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+		if declared == "" {
+			declared = "未知"
+		}
+		return nil, fmt.Errorf("不支持的图片格式: %s（支持 jpeg/png/gif/webp/bmp）", declared)
+	}
+
+	return &types.ImageSource{
+		Type:      "base64",
+		MediaType: mediaType,
+		Data:      base64.StdEncoding.EncodeToString(data),
+	}, nil
+}
@@ -1,9 +1,14 @@
 package utils
 
 import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestDetectImageFormat_JPEG(t *testing.T) {
@@ -65,3 +70,99 @@ func TestSupportedImageFormats(t *testing.T) {
 func TestMaxImageSize(t *testing.T) {
 	assert.Equal(t, 20*1024*1024, MaxImageSize)
 }
+
+// allowPrivateImageFetch 测试服务器监听在回环地址，需临时放开内网限制
+func allowPrivateImageFetch(t *testing.T) {
+	t.Helper()
+	t.Setenv("IMAGE_FETCH_ALLOW_PRIVATE", "true")
+}
+
+var testPNG = []byte{0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A, 0x00, 0x00, 0x00, 0x0D}
+
+func TestFetchImageSource_Success(t *testing.T) {
+	allowPrivateImageFetch(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 声明的类型与实际不符时以文件头为准
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write(testPNG)
+	}))
+	defer srv.Close()
+
+	source, err := FetchImageSource(srv.URL + "/a.png")
+
+	require.NoError(t, err)
+	assert.Equal(t, "base64", source.Type)
+	assert.Equal(t, "image/png", source.MediaType)
+	assert.Equal(t, base64.StdEncoding.EncodeToString(testPNG), source.Data)
+	assert.NoError(t, ValidateImageContent(source))
+}
+
+func TestFetchImageSource_NotAnImage(t *testing.T) {
+	allowPrivateImageFetch(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_, _ = w.Write([]byte("<html><body>not found</body></html>"))
+	}))
+	defer srv.Close()
+
+	_, err := FetchImageSource(srv.URL)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "不支持的图片格式: text/html")
+}
+
+func TestFetchImageSource_HTTPError(t *testing.T) {
+	allowPrivateImageFetch(t)
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	_, err := FetchImageSource(srv.URL)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "HTTP 404")
+}
+
+func TestFetchImageSource_TooLarge(t *testing.T) {
+	allowPrivateImageFetch(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(testPNG)
+		_, _ = w.Write([]byte(strings.Repeat("x", MaxImageSize)))
+	}))
+	defer srv.Close()
+
+	_, err := FetchImageSource(srv.URL)
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "图片数据过大")
+}
+
+func TestFetchImageSource_BlocksPrivateHost(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(testPNG)
+	}))
+	defer srv.Close()
+
+	t.Setenv("IMAGE_FETCH_ALLOW_PRIVATE", "false")
+
+	_, err := FetchImageSource(srv.URL)
+
+	require.Error(t, err)
+	assert.ErrorIs(t, err, errPrivateImageHost)
+}
+
+func TestFetchImageSource_Disabled(t *testing.T) {
+	// 开关在下载时读取，.env 中的设置同样生效
+	t.Setenv("IMAGE_URL_FETCH", "false")
+
+	_, err := FetchImageSource("https://example.com/a.png")
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "IMAGE_URL_FETCH=false")
+}
+
+func TestConvertImageURLToImageSource_UnsupportedScheme(t *testing.T) {
+	_, err := ConvertImageURLToImageSource(map[string]any{"url": "ftp://example.com/a.png"})
+
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "仅支持data URL或http(s)图片地址")
+}
@@ -1,10 +1,18 @@
+//go:build !jsonsonic || go1.26
+
 package utils
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
 )
 
-// 高性能JSON配置 - 临时使用标准库替代 sonic (Go 1.24 兼容性问题)
+// 默认使用标准库 encoding/json；使用 -tags jsonsonic 构建时切换为 sonic（见 json_sonic.go）
+// 当前依赖的 sonic 版本只支持 Go 1.24/1.25，更高版本的 Go 即使带 jsonsonic 标签也使用标准库
+
+// JSONBackend 当前构建使用的JSON实现
+const JSONBackend = "encoding/json"
 
 // FastMarshal 高性能JSON序列化
 func FastMarshal(v any) ([]byte, error) {
@@ -30,3 +38,18 @@ func SafeUnmarshal(data []byte, v any) error {
 func MarshalIndent(v any, prefix, indent string) ([]byte, error) {
 	return json.MarshalIndent(v, prefix, indent)
 }
+
+// AppendJSON 将 v 序列化后追加到 buf（与 FastMarshal 输出一致，不含结尾换行），用于在复用的缓冲区中组装事件
+func AppendJSON(buf *bytes.Buffer, v any) error {
+	if err := json.NewEncoder(buf).Encode(v); err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1) // Encoder 会追加换行
+	return nil
+}
+
+// DecodeFrom 直接从 r 解码一个JSON值，调用方无需先 io.ReadAll 再 FastUnmarshal
+// 与 FastUnmarshal 一致，值之后只允许空白字符
+func DecodeFrom(r io.Reader, v any) error {
+	return decodeSingle(json.NewDecoder(r), v)
+}
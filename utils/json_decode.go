@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// jsonStreamDecoder encoding/json 与 sonic 流式解码器的公共接口
+type jsonStreamDecoder interface {
+	Decode(v any) error
+}
+
+// decodeSingle 解码一个JSON值并确认其后没有多余内容
+func decodeSingle(dec jsonStreamDecoder, v any) error {
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	var extra any
+	if err := dec.Decode(&extra); !errors.Is(err, io.EOF) {
+		if err == nil {
+			return fmt.Errorf("JSON值之后存在多余内容")
+		}
+		return fmt.Errorf("JSON值之后存在多余内容: %w", err)
+	}
+	return nil
+}
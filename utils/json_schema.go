@@ -0,0 +1,282 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxSchemaErrors 单次校验最多收集的错误条数
+const maxSchemaErrors = 20
+
+// ValidateJSONSchema 按 JSON Schema 子集校验值（value 需为 json.Unmarshal 到 any 的结果）
+// 支持 type/enum/const/properties/required/additionalProperties/items/min*/max*/anyOf/oneOf/allOf
+// 以及文档内 $ref（#/$defs/... 与 #/definitions/...），其余关键字忽略
+// 返回不符合项的描述（带 JSON Pointer 路径），为空表示校验通过
+func ValidateJSONSchema(schema map[string]any, value any) []string {
+	v := &schemaValidator{root: schema}
+	v.validate(schema, value, "", 0)
+	return v.errors
+}
+
+type schemaValidator struct {
+	root   map[string]any
+	errors []string
+}
+
+// maxSchemaDepth 防止循环 $ref 导致无限递归
+const maxSchemaDepth = 64
+
+func (v *schemaValidator) fail(path, format string, args ...any) {
+	if len(v.errors) >= maxSchemaErrors {
+		return
+	}
+	if path == "" {
+		path = "/"
+	}
+	v.errors = append(v.errors, path+": "+fmt.Sprintf(format, args...))
+}
+
+func (v *schemaValidator) validate(schema map[string]any, value any, path string, depth int) {
+	if schema == nil {
+		return
+	}
+	if depth > maxSchemaDepth {
+		v.fail(path, "schema 嵌套过深")
+		return
+	}
+
+	if ref, ok := schema["$ref"].(string); ok {
+		target, err := v.resolveRef(ref)
+		if err != nil {
+			v.fail(path, "%v", err)
+			return
+		}
+		v.validate(target, value, path, depth+1)
+		return
+	}
+
+	if types, ok := schemaTypes(schema["type"]); ok && !matchesAnyType(types, value) {
+		v.fail(path, "类型应为 %s，实际为 %s", strings.Join(types, "|"), jsonTypeOf(value))
+		return
+	}
+
+	if enum, ok := schema["enum"].([]any); ok && !containsJSONValue(enum, value) {
+		v.fail(path, "取值不在 enum 范围内")
+	}
+	if constValue, ok := schema["const"]; ok && !jsonValuesEqual(constValue, value) {
+		v.fail(path, "取值应为 %v", constValue)
+	}
+
+	switch typed := value.(type) {
+	case map[string]any:
+		v.validateObject(schema, typed, path, depth)
+	case []any:
+		v.validateArray(schema, typed, path, depth)
+	case string:
+		length := utf8.RuneCountInString(typed)
+		if n, ok := schemaNumber(schema["minLength"]); ok && float64(length) < n {
+			v.fail(path, "长度不能小于 %v", n)
+		}
+		if n, ok := schemaNumber(schema["maxLength"]); ok && float64(length) > n {
+			v.fail(path, "长度不能大于 %v", n)
+		}
+	case float64:
+		if n, ok := schemaNumber(schema["minimum"]); ok && typed < n {
+			v.fail(path, "不能小于 %v", n)
+		}
+		if n, ok := schemaNumber(schema["maximum"]); ok && typed > n {
+			v.fail(path, "不能大于 %v", n)
+		}
+	}
+
+	if subschemas, ok := schema["allOf"].([]any); ok {
+		for _, sub := range subschemas {
+			v.validate(asSchema(sub), value, path, depth+1)
+		}
+	}
+	if subschemas, ok := schema["anyOf"].([]any); ok && v.countMatches(subschemas, value, depth) == 0 {
+		v.fail(path, "不满足 anyOf 中的任一 schema")
+	}
+	if subschemas, ok := schema["oneOf"].([]any); ok && v.countMatches(subschemas, value, depth) != 1 {
+		v.fail(path, "应恰好满足 oneOf 中的一个 schema")
+	}
+}
+
+func (v *schemaValidator) validateObject(schema map[string]any, obj map[string]any, path string, depth int) {
+	if required, ok := schema["required"].([]any); ok {
+		for _, name := range required {
+			if key, ok := name.(string); ok {
+				if _, exists := obj[key]; !exists {
+					v.fail(path, "缺少必填字段 %q", key)
+				}
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]any)
+	// 按字段名排序，保证错误顺序稳定
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		childPath := path + "/" + escapeJSONPointer(key)
+		if propSchema, ok := properties[key]; ok {
+			v.validate(asSchema(propSchema), obj[key], childPath, depth+1)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.fail(path, "不允许的字段 %q", key)
+			}
+		case map[string]any:
+			v.validate(additional, obj[key], childPath, depth+1)
+		}
+	}
+}
+
+func (v *schemaValidator) validateArray(schema map[string]any, arr []any, path string, depth int) {
+	if n, ok := schemaNumber(schema["minItems"]); ok && float64(len(arr)) < n {
+		v.fail(path, "元素个数不能少于 %v", n)
+	}
+	if n, ok := schemaNumber(schema["maxItems"]); ok && float64(len(arr)) > n {
+		v.fail(path, "元素个数不能多于 %v", n)
+	}
+	if items, ok := schema["items"].(map[string]any); ok {
+		for i, item := range arr {
+			v.validate(items, item, fmt.Sprintf("%s/%d", path, i), depth+1)
+		}
+	}
+}
+
+// countMatches 统计值满足的子 schema 个数（子 schema 的错误不计入结果）
+func (v *schemaValidator) countMatches(subschemas []any, value any, depth int) int {
+	matches := 0
+	for _, sub := range subschemas {
+		probe := &schemaValidator{root: v.root}
+		probe.validate(asSchema(sub), value, "", depth+1)
+		if len(probe.errors) == 0 {
+			matches++
+		}
+	}
+	return matches
+}
+
+// resolveRef 解析文档内引用
+func (v *schemaValidator) resolveRef(ref string) (map[string]any, error) {
+	if ref == "#" {
+		return v.root, nil
+	}
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("不支持的 $ref: %s", ref)
+	}
+	var current any = v.root
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		part = strings.ReplaceAll(strings.ReplaceAll(part, "~1", "/"), "~0", "~")
+		obj, ok := current.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("无法解析 $ref: %s", ref)
+		}
+		if current, ok = obj[part]; !ok {
+			return nil, fmt.Errorf("无法解析 $ref: %s", ref)
+		}
+	}
+	target, ok := current.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("无法解析 $ref: %s", ref)
+	}
+	return target, nil
+}
+
+func asSchema(value any) map[string]any {
+	schema, _ := value.(map[string]any)
+	return schema
+}
+
+func schemaTypes(raw any) ([]string, bool) {
+	switch t := raw.(type) {
+	case string:
+		return []string{t}, true
+	case []any:
+		types := make([]string, 0, len(t))
+		for _, item := range t {
+			if s, ok := item.(string); ok {
+				types = append(types, s)
+			}
+		}
+		return types, len(types) > 0
+	}
+	return nil, false
+}
+
+func schemaNumber(raw any) (float64, bool) {
+	switch n := raw.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func matchesAnyType(types []string, value any) bool {
+	actual := jsonTypeOf(value)
+	for _, t := range types {
+		if t == actual {
+			return true
+		}
+		if t == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonTypeOf 返回值对应的 JSON Schema 类型名
+func jsonTypeOf(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return "integer"
+		}
+		return "number"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func containsJSONValue(values []any, value any) bool {
+	for _, candidate := range values {
+		if jsonValuesEqual(candidate, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonValuesEqual(a, b any) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func escapeJSONPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mustJSON(t *testing.T, raw string) map[string]any {
+	t.Helper()
+	var v map[string]any
+	require.NoError(t, json.Unmarshal([]byte(raw), &v))
+	return v
+}
+
+func TestValidateJSONSchema(t *testing.T) {
+	schema := mustJSON(t, `{
+		"type": "object",
+		"properties": {
+			"status": {"enum": ["ok", "error"]},
+			"tags": {"type": "array", "items": {"type": "string", "maxLength": 3}, "maxItems": 2},
+			"owner": {"$ref": "#/$defs/user"},
+			"score": {"anyOf": [{"type": "number"}, {"type": "null"}]}
+		},
+		"required": ["status"],
+		"$defs": {"user": {"type": "object", "required": ["id"], "properties": {"id": {"type": "integer"}}}}
+	}`)
+
+	tests := []struct {
+		name  string
+		value string
+		want  []string
+	}{
+		{"合法", `{"status":"ok","tags":["a"],"owner":{"id":1},"score":null}`, nil},
+		{"缺少字段", `{}`, []string{`/: 缺少必填字段 "status"`}},
+		{"枚举", `{"status":"done"}`, []string{"/status: 取值不在 enum 范围内"}},
+		{"数组", `{"status":"ok","tags":["abcd",1,"c"]}`, []string{
+			"/tags: 元素个数不能多于 2",
+			"/tags/0: 长度不能大于 3",
+			"/tags/1: 类型应为 string，实际为 integer",
+		}},
+		{"引用", `{"status":"ok","owner":{"id":1.5}}`, []string{"/owner/id: 类型应为 integer，实际为 number"}},
+		{"anyOf", `{"status":"ok","score":"high"}`, []string{"/score: 不满足 anyOf 中的任一 schema"}},
+		{"顶层类型", `[]`, []string{"/: 类型应为 object，实际为 array"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var value any
+			require.NoError(t, json.Unmarshal([]byte(tt.value), &value))
+			assert.Equal(t, tt.want, ValidateJSONSchema(schema, value))
+		})
+	}
+}
+
+func TestValidateJSONSchema_RecursiveRef(t *testing.T) {
+	schema := mustJSON(t, `{"$ref": "#"}`)
+
+	errors := ValidateJSONSchema(schema, map[string]any{})
+
+	assert.Equal(t, []string{"/: schema 嵌套过深"}, errors)
+}
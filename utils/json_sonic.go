@@ -0,0 +1,57 @@
+//go:build jsonsonic && !go1.26
+
+package utils
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/bytedance/sonic"
+)
+
+// jsonAPI 与 encoding/json 行为一致的 sonic 配置（转义HTML、map键排序、校验UTF-8）
+// sonic 在不支持的CPU架构上自动回退到 encoding/json
+var jsonAPI = sonic.ConfigStd
+
+// JSONBackend 当前构建使用的JSON实现
+const JSONBackend = "sonic"
+
+// FastMarshal 高性能JSON序列化
+func FastMarshal(v any) ([]byte, error) {
+	return jsonAPI.Marshal(v)
+}
+
+// FastUnmarshal 高性能JSON反序列化
+func FastUnmarshal(data []byte, v any) error {
+	return jsonAPI.Unmarshal(data, v)
+}
+
+// SafeMarshal 安全JSON序列化（带验证）
+func SafeMarshal(v any) ([]byte, error) {
+	return jsonAPI.Marshal(v)
+}
+
+// SafeUnmarshal 安全JSON反序列化（带验证）
+func SafeUnmarshal(data []byte, v any) error {
+	return jsonAPI.Unmarshal(data, v)
+}
+
+// MarshalIndent 带缩进的JSON序列化
+func MarshalIndent(v any, prefix, indent string) ([]byte, error) {
+	return jsonAPI.MarshalIndent(v, prefix, indent)
+}
+
+// AppendJSON 将 v 序列化后追加到 buf（与 FastMarshal 输出一致，不含结尾换行），用于在复用的缓冲区中组装事件
+func AppendJSON(buf *bytes.Buffer, v any) error {
+	if err := jsonAPI.NewEncoder(buf).Encode(v); err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1) // Encoder 会追加换行
+	return nil
+}
+
+// DecodeFrom 直接从 r 解码一个JSON值，调用方无需先 io.ReadAll 再 FastUnmarshal
+// 与 FastUnmarshal 一致，值之后只允许空白字符
+func DecodeFrom(r io.Reader, v any) error {
+	return decodeSingle(jsonAPI.NewDecoder(r), v)
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"kiro2api/types"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeFrom(t *testing.T) {
+	var req types.AnthropicRequest
+	require.NoError(t, DecodeFrom(strings.NewReader(`{"model":"claude-sonnet-4","max_tokens":16,"stream":true}`+"\n\t "), &req))
+	assert.Equal(t, "claude-sonnet-4", req.Model)
+	assert.Equal(t, 16, req.MaxTokens)
+	assert.True(t, req.Stream)
+
+	assert.Error(t, DecodeFrom(strings.NewReader(`{"model":"a"} {"model":"b"}`), &req), "多个JSON值")
+	assert.Error(t, DecodeFrom(strings.NewReader(`{"model":"a"} trailing`), &req), "值之后的垃圾数据")
+	assert.Error(t, DecodeFrom(strings.NewReader(`{"model":`), &req), "截断的JSON")
+	assert.Error(t, DecodeFrom(strings.NewReader(""), &req), "空输入")
+}
+
+// benchmarkRequestBody 构造一个包含长对话历史的请求体，接近 Claude Code 等客户端的大请求
+func benchmarkRequestBody(messages int) []byte {
+	req := types.AnthropicRequest{Model: "claude-sonnet-4", MaxTokens: 8192, Stream: true}
+	for i := range messages {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		req.Messages = append(req.Messages, types.AnthropicRequestMessage{
+			Role:    role,
+			Content: fmt.Sprintf("第%d轮：%s", i, strings.Repeat("The quick brown fox jumps over the lazy dog. ", 40)),
+		})
+	}
+	body, err := FastMarshal(req)
+	if err != nil {
+		panic(err)
+	}
+	return body
+}
+
+// 基准测试：go test ./utils -run '^$' -bench JSON -benchmem 与加 -tags jsonsonic 的结果对比
+func BenchmarkJSONFastUnmarshal(b *testing.B) {
+	body := benchmarkRequestBody(200)
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	for b.Loop() {
+		var req types.AnthropicRequest
+		if err := FastUnmarshal(body, &req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkJSONFastMarshal(b *testing.B) {
+	var req types.AnthropicRequest
+	if err := FastUnmarshal(benchmarkRequestBody(200), &req); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := FastMarshal(&req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkJSONReadAllUnmarshal 先读入完整请求体再解析（DecodeFrom 的对照组）
+func BenchmarkJSONReadAllUnmarshal(b *testing.B) {
+	body := benchmarkRequestBody(200)
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	for b.Loop() {
+		data, err := io.ReadAll(bytes.NewReader(body))
+		if err != nil {
+			b.Fatal(err)
+		}
+		var req types.AnthropicRequest
+		if err := FastUnmarshal(data, &req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkJSONDecodeFrom 直接从 io.Reader 解码
+func BenchmarkJSONDecodeFrom(b *testing.B) {
+	body := benchmarkRequestBody(200)
+	b.SetBytes(int64(len(body)))
+	b.ReportAllocs()
+	for b.Loop() {
+		var req types.AnthropicRequest
+		if err := DecodeFrom(bytes.NewReader(body), &req); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package utils
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"kiro2api/tracing"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// proxyClients 按代理地址缓存的HTTP客户端
+// 每个代理地址独享一个 Transport（独立连接池），使用相同代理的账号共享连接
+var (
+	proxyClientsMu sync.Mutex
+	proxyClients   = make(map[string]*http.Client)
+)
+
+// ParseProxyURL 解析并校验出站代理地址，支持 http、https、socks5、socks5h
+func ParseProxyURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, fmt.Errorf("代理地址无效: %w", err)
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("不支持的代理协议: %q（支持 http/https/socks5/socks5h）", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("代理地址缺少主机: %s", RedactProxyURL(raw))
+	}
+	return u, nil
+}
+
+// RedactProxyURL 隐藏代理地址中的认证信息，用于日志与接口展示
+func RedactProxyURL(raw string) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.User == nil {
+		return raw
+	}
+	u.User = url.User("***")
+	return u.String()
+}
+
+// HTTPClientForProxy 返回经指定代理出站的HTTP客户端
+// 代理为空时返回 SharedHTTPClient；同一代理地址复用同一客户端及其连接池
+func HTTPClientForProxy(proxyURL string) (*http.Client, error) {
+	proxyURL = strings.TrimSpace(proxyURL)
+	if proxyURL == "" {
+		return SharedHTTPClient, nil
+	}
+
+	proxyClientsMu.Lock()
+	defer proxyClientsMu.Unlock()
+
+	if client, ok := proxyClients[proxyURL]; ok {
+		return client, nil
+	}
+
+	u, err := ParseProxyURL(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	// 基于共享 Transport 的连接池、HTTP/2 与TLS配置复制，仅替换出站代理
+	upstreamClientMu.RLock()
+	transport := sharedTransport.Clone()
+	upstreamClientMu.RUnlock()
+	transport.Proxy = http.ProxyURL(u)
+
+	client := &http.Client{
+		Transport: &instrumentedTransport{base: transport},
+		Timeout:   SharedHTTPClient.Timeout,
+	}
+	proxyClients[proxyURL] = client
+	return client, nil
+}
+
+// resetProxyClients 清空按代理缓存的客户端并关闭其空闲连接（共享 Transport 重建后调用）
+func resetProxyClients() {
+	proxyClientsMu.Lock()
+	clients := proxyClients
+	proxyClients = make(map[string]*http.Client)
+	proxyClientsMu.Unlock()
+
+	for _, client := range clients {
+		client.CloseIdleConnections()
+	}
+}
+
+// DoRequestViaProxy 经指定代理执行HTTP请求，代理为空时等同于 DoRequest
+// 每次请求记录一个 upstream.http span：响应头返回时记录首字节耗时，响应体关闭时结束
+func DoRequestViaProxy(req *http.Request, proxyURL string) (*http.Response, error) {
+	client, err := HTTPClientForProxy(proxyURL)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, span := tracing.Start(req.Context(), "upstream.http",
+		attribute.String("http.request.method", req.Method),
+		attribute.String("server.address", req.URL.Host),
+		attribute.String("url.path", req.URL.Path),
+		attribute.Bool("upstream.via_proxy", strings.TrimSpace(proxyURL) != ""))
+	start := time.Now()
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		tracing.End(span, err)
+		return nil, err
+	}
+	span.SetAttributes(
+		attribute.Int("http.response.status_code", resp.StatusCode),
+		attribute.Int64("upstream.ttfb_ms", time.Since(start).Milliseconds()))
+	span.AddEvent("first_byte")
+	resp.Body = tracing.EndOnClose(resp.Body, span)
+	return resp, nil
+}
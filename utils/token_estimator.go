@@ -205,12 +205,26 @@ func (e *TokenEstimator) EstimateTextTokens(text string) int {
 	// 统计中文字符数（扫描全部字符）
 	chineseChars := 0
 	for _, r := range runes {
-		// 中文字符范围（CJK统一汉字）
-		if r >= 0x4E00 && r <= 0x9FFF {
+		if IsChineseRune(r) {
 			chineseChars++
 		}
 	}
 
+	return EstimateTextTokensFromCounts(runeCount, chineseChars)
+}
+
+// IsChineseRune 判断字符是否属于 CJK 统一汉字（中英文按不同密度估算 token）
+func IsChineseRune(r rune) bool {
+	return r >= 0x4E00 && r <= 0x9FFF
+}
+
+// EstimateTextTokensFromCounts 按字符总数与中文字符数估算文本 token 数
+// 供需要增量累计文本长度的场景使用（如流式输出的 max_tokens 截断），结果与 EstimateTextTokens 一致
+func EstimateTextTokensFromCounts(runeCount, chineseChars int) int {
+	if runeCount <= 0 {
+		return 0
+	}
+
 	// 混合语言token估算
 	// 根据官方测试数据精确校准：
 	// 纯中文: '你'(1字符)→2tokens, '你好'(2字符)→3tokens